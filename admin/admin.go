@@ -0,0 +1,545 @@
+// Package admin serves an HTTP API to inspect and control a running
+// gitcollector.WorkerPool: its queues, workers, providers, latencies and
+// recent failures, pausing and resizing it and enqueuing download jobs.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/metrics"
+
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+var (
+	// ErrJobsDisabled is returned when a Job is submitted to a Server
+	// without Enqueuer.
+	ErrJobsDisabled = errors.NewKind("ad-hoc jobs are disabled")
+
+	// ErrWrongRequest is returned when the body of a request can't be
+	// decoded.
+	ErrWrongRequest = errors.NewKind("wrong request: %s")
+)
+
+// Enqueuer receives the repository URLs submitted to a Server, like a
+// discovery.AdhocProvider.
+type Enqueuer interface {
+	// Enqueue schedules the download of the given repository URL.
+	Enqueue(ctx context.Context, endpoint string) error
+}
+
+// ServerOpts represents configuration options for a Server.
+type ServerOpts struct {
+	// Addr is the address the API is served at once the server is
+	// started, empty means it isn't served but the Handler can still be
+	// mounted elsewhere.
+	Addr string
+	// Events is the gitcollector.JobEventBus of the pool the recent
+	// failures and the latencies are taken from, nil means they aren't
+	// reported.
+	Events *gitcollector.JobEventBus
+	// MaxFailures is the number of recent failures kept, default to 100.
+	MaxFailures int
+	// Enqueuer receives the URLs of the download Jobs submitted to the
+	// API, nil means they're rejected.
+	Enqueuer Enqueuer
+	// Log is the logger used to report the failures serving the API,
+	// default to log.New(nil).
+	Log log.Logger
+}
+
+const (
+	maxFailures = 100
+	// eventsBuffer is the number of events buffered so the pool isn't
+	// held while a request reads the failures.
+	eventsBuffer = 100
+)
+
+// Queue is the depth of the queues of the pool.
+type Queue struct {
+	// Queued is the number of Jobs waiting for a worker.
+	Queued int `json:"queued"`
+	// Delayed is the number of DelayedJobs waiting for their time.
+	Delayed int `json:"delayed"`
+}
+
+// Status is the state of the pool.
+type Status struct {
+	Queue
+	Workers int  `json:"workers"`
+	Busy    int  `json:"busy"`
+	Paused  bool `json:"paused"`
+	// Failed is the number of Jobs failed since the server started.
+	Failed int `json:"failed"`
+	// Providers are the states of the watched providers.
+	Providers []*ProviderState `json:"providers,omitempty"`
+	// Latencies are the percentiles of the time spent processing the
+	// Jobs over the last minutes by kind, download or update, like the
+	// ones of metrics.Collector.
+	Latencies map[string]*Latency `json:"latencies,omitempty"`
+}
+
+// ProviderState is the gitcollector.ProviderState of a provider.
+type ProviderState struct {
+	Name          string     `json:"name"`
+	Discovered    int        `json:"discovered"`
+	Cursor        string     `json:"cursor,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+	// RateLimitRemaining is the number of requests left until the rate
+	// limit reset, -1 if unknown.
+	RateLimitRemaining int        `json:"rate_limit_remaining"`
+	RateLimitReset     *time.Time `json:"rate_limit_reset,omitempty"`
+	Done               bool       `json:"done"`
+}
+
+// Latency holds the latency percentiles of a kind of Job, in seconds.
+type Latency struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50_seconds"`
+	P90   float64 `json:"p90_seconds"`
+	P99   float64 `json:"p99_seconds"`
+	Max   float64 `json:"max_seconds"`
+}
+
+// Failure is a failed Job.
+type Failure struct {
+	Job      string                  `json:"job"`
+	Worker   string                  `json:"worker"`
+	Attempts int                     `json:"attempts"`
+	Class    gitcollector.ErrorClass `json:"class"`
+	Code     gitcollector.ErrorCode  `json:"code"`
+	Error    string                  `json:"error"`
+	Elapsed  float64                 `json:"elapsed_seconds"`
+	Failed   time.Time               `json:"failed"`
+}
+
+// Server serves the admin API of a gitcollector.WorkerPool:
+//
+//	GET  /status    the Status of the pool
+//	GET  /queue     the depth of its queues
+//	GET  /workers   the gitcollector.Heartbeat of every worker
+//	POST /workers   sets the number of workers, {"workers": n}
+//	GET  /jobs      the Heartbeats of the workers processing a Job
+//	POST /jobs      enqueues downloads, {"urls": ["https://..."]}
+//	GET  /failures  the recent Failures, the newest first
+//	POST /pause     pauses the pool
+//	POST /resume    resumes the pool
+//
+// Every response is a JSON document, the errors are {"error": "message"}.
+type Server struct {
+	wp   *gitcollector.WorkerPool
+	opts *ServerOpts
+	mux  *http.ServeMux
+	sub  *gitcollector.JobSubscription
+
+	latency *metrics.LatencyTracker
+
+	mu        sync.Mutex
+	failures  []*Failure
+	next      int
+	failed    int
+	providers []gitcollector.ProviderStatus
+
+	collected chan struct{}
+	listener  net.Listener
+	server    *http.Server
+}
+
+// NewServer builds a new Server of the given pool. The address, if any, is
+// listened on right away so a wrong one is reported before the collection
+// starts. It must be built before the pool runs to report all its failures.
+func NewServer(
+	wp *gitcollector.WorkerPool,
+	opts *ServerOpts,
+) (*Server, error) {
+	if opts == nil {
+		opts = &ServerOpts{}
+	}
+
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = maxFailures
+	}
+
+	if opts.Log == nil {
+		opts.Log = log.New(nil)
+	}
+
+	s := &Server{
+		wp:        wp,
+		opts:      opts,
+		mux:       http.NewServeMux(),
+		latency:   metrics.NewLatencyTracker(nil),
+		collected: make(chan struct{}),
+	}
+
+	s.mux.HandleFunc("/status", s.get(func() interface{} {
+		return s.Status()
+	}))
+	s.mux.HandleFunc("/queue", s.get(func() interface{} {
+		return s.queue()
+	}))
+	s.mux.HandleFunc("/workers", s.workers)
+	s.mux.HandleFunc("/jobs", s.jobs)
+	s.mux.HandleFunc("/failures", s.get(func() interface{} {
+		return s.Failures()
+	}))
+	s.mux.HandleFunc("/pause", s.post(func() { wp.Pause() }))
+	s.mux.HandleFunc("/resume", s.post(func() { wp.Resume() }))
+
+	if opts.Events != nil {
+		s.sub = opts.Events.Subscribe(eventsBuffer)
+		go s.collect()
+	} else {
+		close(s.collected)
+	}
+
+	if opts.Addr == "" {
+		return s, nil
+	}
+
+	listener, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		if s.sub != nil {
+			s.sub.Close()
+		}
+
+		return nil, err
+	}
+
+	s.listener = listener
+	s.server = &http.Server{Handler: s.mux}
+	return s, nil
+}
+
+// Handler returns the http.Handler of the API.
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start serves the API in the background if the server has an address.
+func (s *Server) Start() {
+	if s.server == nil {
+		return
+	}
+
+	go func() {
+		err := s.server.Serve(s.listener)
+		if err != nil && err != http.ErrServerClosed {
+			s.opts.Log.Errorf(err, "couldn't serve the admin api")
+		}
+	}()
+}
+
+// Close stops serving the API and reporting the failures.
+func (s *Server) Close() error {
+	if s.sub != nil {
+		s.sub.Close()
+	}
+
+	<-s.collected
+	if s.server != nil {
+		return s.server.Close()
+	}
+
+	return nil
+}
+
+func (s *Server) collect() {
+	defer close(s.collected)
+	for event := range s.sub.Events() {
+		if event.Result == nil {
+			continue
+		}
+
+		s.latency.Observe(metrics.JobKind(event.Job), event.Result.Elapsed)
+		if event.Type != gitcollector.JobFailed ||
+			event.Result.Failure == nil {
+			continue
+		}
+
+		f := event.Result.Failure
+		s.add(&Failure{
+			Job:      JobDescription(event.Job),
+			Worker:   event.Worker,
+			Attempts: event.Attempt,
+			Class:    f.Class,
+			Code:     f.Code,
+			Error:    f.Err.Error(),
+			Elapsed:  f.Elapsed.Seconds(),
+			Failed:   event.Time,
+		})
+	}
+}
+
+// add keeps the Failure in a ring of MaxFailures.
+func (s *Server) add(f *Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failed++
+	if len(s.failures) < s.opts.MaxFailures {
+		s.failures = append(s.failures, f)
+		return
+	}
+
+	s.failures[s.next] = f
+	s.next = (s.next + 1) % len(s.failures)
+}
+
+// Failures returns the recent Failures, the newest first.
+func (s *Server) Failures() []*Failure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures := make([]*Failure, 0, len(s.failures))
+	for i := range s.failures {
+		j := s.next - 1 - i
+		if j < 0 {
+			j += len(s.failures)
+		}
+
+		failures = append(failures, s.failures[j])
+	}
+
+	return failures
+}
+
+// WatchProviders sets the providers whose states are reported, replacing the
+// previous ones. It can be called while the pool runs, once they're built.
+func (s *Server) WatchProviders(providers ...gitcollector.ProviderStatus) {
+	s.mu.Lock()
+	s.providers = providers
+	s.mu.Unlock()
+}
+
+func (s *Server) queue() *Queue {
+	return &Queue{
+		Queued:  s.wp.Queued(),
+		Delayed: s.wp.Delayed(),
+	}
+}
+
+// Status returns the Status of the pool.
+func (s *Server) Status() *Status {
+	// the heartbeats don't wait for an ongoing resize, unlike Size.
+	beats := s.wp.Heartbeats()
+	status := &Status{
+		Queue:   *s.queue(),
+		Workers: len(beats),
+		Paused:  s.wp.Paused(),
+	}
+
+	for _, hb := range beats {
+		if hb.Busy {
+			status.Busy++
+		}
+	}
+
+	s.mu.Lock()
+	status.Failed = s.failed
+	providers := s.providers
+	s.mu.Unlock()
+
+	for _, p := range providers {
+		status.Providers = append(status.Providers, providerState(p.Status()))
+	}
+
+	for kind, p := range s.latency.Snapshot() {
+		if status.Latencies == nil {
+			status.Latencies = make(map[string]*Latency)
+		}
+
+		status.Latencies[kind] = &Latency{
+			Count: p.Count,
+			P50:   p.P50.Seconds(),
+			P90:   p.P90.Seconds(),
+			P99:   p.P99.Seconds(),
+			Max:   p.Max.Seconds(),
+		}
+	}
+
+	return status
+}
+
+func providerState(state gitcollector.ProviderState) *ProviderState {
+	ps := &ProviderState{
+		Name:               state.Name,
+		Discovered:         state.Discovered,
+		Cursor:             state.Cursor,
+		RateLimitRemaining: state.RateLimitRemaining,
+		Done:               state.Done,
+	}
+
+	if state.LastError != nil {
+		t := state.LastErrorTime
+		ps.LastError = state.LastError.Error()
+		ps.LastErrorTime = &t
+	}
+
+	if !state.RateLimitReset.IsZero() {
+		t := state.RateLimitReset
+		ps.RateLimitReset = &t
+	}
+
+	return ps
+}
+
+func (s *Server) workers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.wp.Heartbeats())
+	case http.MethodPost:
+		var req struct {
+			Workers *int `json:"workers"`
+		}
+
+		if err := decode(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if req.Workers == nil || *req.Workers < 0 {
+			writeError(w, http.StatusBadRequest,
+				ErrWrongRequest.New("workers can't be negative"))
+			return
+		}
+
+		s.wp.SetWorkers(*req.Workers)
+		writeJSON(w, http.StatusOK, s.Status())
+	default:
+		notAllowed(w)
+	}
+}
+
+func (s *Server) jobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		busy := []gitcollector.Heartbeat{}
+		for _, hb := range s.wp.Heartbeats() {
+			if hb.Busy {
+				busy = append(busy, hb)
+			}
+		}
+
+		writeJSON(w, http.StatusOK, busy)
+	case http.MethodPost:
+		var req struct {
+			URLs []string `json:"urls"`
+		}
+
+		if err := decode(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		enqueued, err := s.Enqueue(r.Context(), req.URLs)
+		switch {
+		case ErrJobsDisabled.Is(err):
+			writeError(w, http.StatusForbidden, err)
+			return
+		case ErrWrongRequest.Is(err):
+			writeError(w, http.StatusBadRequest, err)
+			return
+		case err != nil:
+			writeJSON(w, http.StatusServiceUnavailable,
+				map[string]interface{}{
+					"enqueued": enqueued,
+					"error":    err.Error(),
+				},
+			)
+			return
+		}
+
+		writeJSON(w, http.StatusAccepted, map[string]int{
+			"enqueued": enqueued,
+		})
+	default:
+		notAllowed(w)
+	}
+}
+
+// Enqueue submits the download of the given repository URLs to the Enqueuer,
+// returning how many were enqueued before an error. It returns
+// ErrJobsDisabled if the Server doesn't have an Enqueuer.
+func (s *Server) Enqueue(ctx context.Context, urls []string) (int, error) {
+	if s.opts.Enqueuer == nil {
+		return 0, ErrJobsDisabled.New()
+	}
+
+	if len(urls) == 0 {
+		return 0, ErrWrongRequest.New("no urls given")
+	}
+
+	for i, url := range urls {
+		if err := s.opts.Enqueuer.Enqueue(ctx, url); err != nil {
+			return i, err
+		}
+	}
+
+	return len(urls), nil
+}
+
+func (s *Server) get(fn func() interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			notAllowed(w)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, fn())
+	}
+}
+
+func (s *Server) post(fn func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			notAllowed(w)
+			return
+		}
+
+		fn()
+		writeJSON(w, http.StatusOK, s.Status())
+	}
+}
+
+func decode(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return ErrWrongRequest.New(err)
+	}
+
+	return nil
+}
+
+func notAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed,
+		fmt.Errorf("method not allowed"))
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// JobDescription describes a Job with its String method, or its type if it
+// doesn't implement fmt.Stringer.
+func JobDescription(job gitcollector.Job) string {
+	if s, ok := job.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return fmt.Sprintf("%T", job)
+}
@@ -0,0 +1,253 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testJob struct {
+	id      string
+	process func(context.Context) error
+}
+
+func (j *testJob) Process(ctx context.Context) error {
+	return j.process(ctx)
+}
+
+func (j *testJob) String() string {
+	return j.id
+}
+
+type testProvider gitcollector.ProviderState
+
+func (p *testProvider) Status() gitcollector.ProviderState {
+	return gitcollector.ProviderState(*p)
+}
+
+type testEnqueuer struct {
+	urls []string
+}
+
+func (e *testEnqueuer) Enqueue(_ context.Context, url string) error {
+	if url == "stopped" {
+		return gitcollector.ErrProviderStopped.New()
+	}
+
+	e.urls = append(e.urls, url)
+	return nil
+}
+
+func TestServer(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan gitcollector.Job, 5)
+	bus := gitcollector.NewJobEventBus()
+	wp := gitcollector.NewWorkerPool(
+		func(ctx context.Context) (gitcollector.Job, error) {
+			select {
+			case job, ok := <-queue:
+				if !ok {
+					return nil, gitcollector.ErrJobSource.New()
+				}
+
+				return job, nil
+			case <-ctx.Done():
+				return nil, gitcollector.ErrNewJobsNotFound.New()
+			}
+		},
+		&gitcollector.WorkerPoolOpts{
+			Events:         bus,
+			WaitJobTimeout: 50 * time.Millisecond,
+		},
+	)
+
+	enqueuer := &testEnqueuer{}
+	s, err := NewServer(wp, &ServerOpts{
+		Events:      bus,
+		MaxFailures: 2,
+		Enqueuer:    enqueuer,
+	})
+	require.NoError(err)
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	do := func(method, path string, body string, v interface{}) int {
+		req, err := http.NewRequest(method, srv.URL+path,
+			bytes.NewBufferString(body))
+		require.NoError(err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(err)
+		defer res.Body.Close()
+
+		require.Equal("application/json", res.Header.Get("Content-Type"))
+		if v != nil {
+			require.NoError(json.NewDecoder(res.Body).Decode(v))
+		}
+
+		return res.StatusCode
+	}
+
+	wp.SetWorkers(1)
+	wp.Run()
+
+	for i := 0; i < 3; i++ {
+		queue <- &testJob{
+			id: fmt.Sprintf("job-%d", i),
+			process: func(context.Context) error {
+				return fmt.Errorf("foo")
+			},
+		}
+	}
+
+	var status Status
+	deadline := time.Now().Add(5 * time.Second)
+	// the workers are idle once the failure is reported
+	for (status.Failed < 3 || status.Busy > 0) &&
+		time.Now().Before(deadline) {
+		require.Equal(http.StatusOK, do("GET", "/status", "", &status))
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the failed jobs are timed too
+	require.Equal(3, status.Latencies["unknown"].Count)
+	status.Latencies = nil
+	require.Equal(Status{Workers: 1, Failed: 3}, status)
+
+	// only the newest failures are kept
+	var failures []*Failure
+	require.Equal(http.StatusOK, do("GET", "/failures", "", &failures))
+	require.Len(failures, 2)
+	require.Equal("job-2", failures[0].Job)
+	require.Equal("job-1", failures[1].Job)
+	require.Equal("foo", failures[0].Error)
+	require.Equal(gitcollector.ErrorClassUnknown, failures[0].Class)
+	require.Equal(1, failures[0].Attempts)
+	require.NotEmpty(failures[0].Worker)
+
+	// the jobs being processed
+	started := make(chan struct{})
+	release := make(chan struct{})
+	queue <- &testJob{id: "blocked", process: func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}}
+
+	<-started
+	var busy []gitcollector.Heartbeat
+	require.Equal(http.StatusOK, do("GET", "/jobs", "", &busy))
+	require.Len(busy, 1)
+	require.Equal("blocked", busy[0].Job)
+
+	require.Equal(http.StatusOK, do("POST", "/pause", "", &status))
+	require.True(status.Paused)
+	require.True(wp.Paused())
+	require.Equal(1, status.Busy)
+	close(release)
+
+	require.Equal(http.StatusOK, do("POST", "/resume", "", &status))
+	require.False(status.Paused)
+
+	require.Equal(http.StatusOK,
+		do("POST", "/workers", `{"workers": 3}`, &status))
+	require.Equal(3, status.Workers)
+	require.Equal(3, wp.Size())
+
+	var beats []gitcollector.Heartbeat
+	require.Equal(http.StatusOK, do("GET", "/workers", "", &beats))
+	require.Len(beats, 3)
+
+	var queued Queue
+	require.Equal(http.StatusOK, do("GET", "/queue", "", &queued))
+	require.Equal(Queue{}, queued)
+
+	// the states of the providers
+	failed := time.Now().Truncate(time.Second)
+	s.WatchProviders(&testProvider{
+		Name:               "github:src-d",
+		Discovered:         2,
+		Cursor:             "3",
+		LastError:          fmt.Errorf("bar"),
+		LastErrorTime:      failed,
+		RateLimitRemaining: -1,
+	}, &testProvider{Name: "list", Done: true})
+
+	var providers Status
+	require.Equal(http.StatusOK, do("GET", "/status", "", &providers))
+	require.Len(providers.Providers, 2)
+	require.Equal("github:src-d", providers.Providers[0].Name)
+	require.Equal(2, providers.Providers[0].Discovered)
+	require.Equal("3", providers.Providers[0].Cursor)
+	require.Equal("bar", providers.Providers[0].LastError)
+	require.True(failed.Equal(*providers.Providers[0].LastErrorTime))
+	require.Equal(-1, providers.Providers[0].RateLimitRemaining)
+	require.Nil(providers.Providers[0].RateLimitReset)
+	require.True(providers.Providers[1].Done)
+	require.Nil(providers.Providers[1].LastErrorTime)
+
+	var res map[string]interface{}
+	require.Equal(http.StatusBadRequest,
+		do("POST", "/workers", `{"workers": -1}`, &res))
+	require.Contains(res["error"], "negative")
+	require.Equal(http.StatusBadRequest, do("POST", "/workers", `{`, nil))
+	require.Equal(http.StatusMethodNotAllowed, do("POST", "/status", "", nil))
+	require.Equal(http.StatusMethodNotAllowed, do("GET", "/pause", "", nil))
+
+	// the ad-hoc jobs
+	require.Equal(http.StatusAccepted, do("POST", "/jobs",
+		`{"urls": ["https://github.com/a/a", "https://github.com/b/b"]}`,
+		&res,
+	))
+	require.EqualValues(2, res["enqueued"])
+	require.Equal([]string{
+		"https://github.com/a/a", "https://github.com/b/b",
+	}, enqueuer.urls)
+
+	require.Equal(http.StatusServiceUnavailable, do("POST", "/jobs",
+		`{"urls": ["https://github.com/c/c", "stopped"]}`, &res,
+	))
+	require.EqualValues(1, res["enqueued"])
+	require.Equal(http.StatusBadRequest,
+		do("POST", "/jobs", `{"urls": []}`, nil))
+
+	s.opts.Enqueuer = nil
+	require.Equal(http.StatusForbidden, do("POST", "/jobs",
+		`{"urls": ["https://github.com/a/a"]}`, &res,
+	))
+	require.Equal(ErrJobsDisabled.New().Error(), res["error"])
+
+	close(queue)
+	wp.Wait()
+	bus.Close()
+	require.NoError(s.Close())
+}
+
+func TestServerAddr(t *testing.T) {
+	var require = require.New(t)
+
+	wp := gitcollector.NewWorkerPool(nil, &gitcollector.WorkerPoolOpts{})
+	s, err := NewServer(wp, &ServerOpts{Addr: "127.0.0.1:0"})
+	require.NoError(err)
+	s.Start()
+
+	res, err := http.Get("http://" + s.listener.Addr().String() + "/status")
+	require.NoError(err)
+	var status Status
+	require.NoError(json.NewDecoder(res.Body).Decode(&status))
+	require.NoError(res.Body.Close())
+	require.Equal(Status{}, status)
+
+	require.NoError(s.Close())
+
+	_, err = NewServer(wp, &ServerOpts{Addr: "wrong address"})
+	require.Error(err)
+}
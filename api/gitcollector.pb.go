@@ -0,0 +1,1860 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: gitcollector.proto
+
+package api
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	duration "github.com/golang/protobuf/ptypes/duration"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type JobEvent_Type int32
+
+const (
+	JobEvent_UNKNOWN   JobEvent_Type = 0
+	JobEvent_ENQUEUED  JobEvent_Type = 1
+	JobEvent_STARTED   JobEvent_Type = 2
+	JobEvent_RETRIED   JobEvent_Type = 3
+	JobEvent_SUCCEEDED JobEvent_Type = 4
+	JobEvent_FAILED    JobEvent_Type = 5
+)
+
+var JobEvent_Type_name = map[int32]string{
+	0: "UNKNOWN",
+	1: "ENQUEUED",
+	2: "STARTED",
+	3: "RETRIED",
+	4: "SUCCEEDED",
+	5: "FAILED",
+}
+
+var JobEvent_Type_value = map[string]int32{
+	"UNKNOWN":   0,
+	"ENQUEUED":  1,
+	"STARTED":   2,
+	"RETRIED":   3,
+	"SUCCEEDED": 4,
+	"FAILED":    5,
+}
+
+func (x JobEvent_Type) String() string {
+	return proto.EnumName(JobEvent_Type_name, int32(x))
+}
+
+func (JobEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{16, 0}
+}
+
+type GetStatusRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetStatusRequest) Reset()         { *m = GetStatusRequest{} }
+func (m *GetStatusRequest) String() string { return proto.CompactTextString(m) }
+func (*GetStatusRequest) ProtoMessage()    {}
+func (*GetStatusRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{0}
+}
+
+func (m *GetStatusRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetStatusRequest.Unmarshal(m, b)
+}
+func (m *GetStatusRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetStatusRequest.Marshal(b, m, deterministic)
+}
+func (m *GetStatusRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetStatusRequest.Merge(m, src)
+}
+func (m *GetStatusRequest) XXX_Size() int {
+	return xxx_messageInfo_GetStatusRequest.Size(m)
+}
+func (m *GetStatusRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetStatusRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetStatusRequest proto.InternalMessageInfo
+
+type Status struct {
+	// queued is the number of jobs waiting for a worker.
+	Queued int32 `protobuf:"varint,1,opt,name=queued,proto3" json:"queued,omitempty"`
+	// delayed is the number of jobs waiting to be retried.
+	Delayed int32 `protobuf:"varint,2,opt,name=delayed,proto3" json:"delayed,omitempty"`
+	Workers int32 `protobuf:"varint,3,opt,name=workers,proto3" json:"workers,omitempty"`
+	Busy    int32 `protobuf:"varint,4,opt,name=busy,proto3" json:"busy,omitempty"`
+	Paused  bool  `protobuf:"varint,5,opt,name=paused,proto3" json:"paused,omitempty"`
+	// failed is the number of jobs failed since the server started.
+	Failed int32 `protobuf:"varint,6,opt,name=failed,proto3" json:"failed,omitempty"`
+	// providers are the states of the providers discovering the jobs.
+	Providers []*Provider `protobuf:"bytes,7,rep,name=providers,proto3" json:"providers,omitempty"`
+	// latencies are the percentiles of the time spent processing the jobs
+	// over the last minutes, by kind.
+	Latencies            []*Latency `protobuf:"bytes,8,rep,name=latencies,proto3" json:"latencies,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
+}
+
+func (m *Status) Reset()         { *m = Status{} }
+func (m *Status) String() string { return proto.CompactTextString(m) }
+func (*Status) ProtoMessage()    {}
+func (*Status) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{1}
+}
+
+func (m *Status) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Status.Unmarshal(m, b)
+}
+func (m *Status) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Status.Marshal(b, m, deterministic)
+}
+func (m *Status) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Status.Merge(m, src)
+}
+func (m *Status) XXX_Size() int {
+	return xxx_messageInfo_Status.Size(m)
+}
+func (m *Status) XXX_DiscardUnknown() {
+	xxx_messageInfo_Status.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Status proto.InternalMessageInfo
+
+func (m *Status) GetQueued() int32 {
+	if m != nil {
+		return m.Queued
+	}
+	return 0
+}
+
+func (m *Status) GetDelayed() int32 {
+	if m != nil {
+		return m.Delayed
+	}
+	return 0
+}
+
+func (m *Status) GetWorkers() int32 {
+	if m != nil {
+		return m.Workers
+	}
+	return 0
+}
+
+func (m *Status) GetBusy() int32 {
+	if m != nil {
+		return m.Busy
+	}
+	return 0
+}
+
+func (m *Status) GetPaused() bool {
+	if m != nil {
+		return m.Paused
+	}
+	return false
+}
+
+func (m *Status) GetFailed() int32 {
+	if m != nil {
+		return m.Failed
+	}
+	return 0
+}
+
+func (m *Status) GetProviders() []*Provider {
+	if m != nil {
+		return m.Providers
+	}
+	return nil
+}
+
+func (m *Status) GetLatencies() []*Latency {
+	if m != nil {
+		return m.Latencies
+	}
+	return nil
+}
+
+type Provider struct {
+	Name       string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Discovered int32  `protobuf:"varint,2,opt,name=discovered,proto3" json:"discovered,omitempty"`
+	// cursor is the position of the provider in its source.
+	Cursor        string               `protobuf:"bytes,3,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	LastError     string               `protobuf:"bytes,4,opt,name=last_error,json=lastError,proto3" json:"last_error,omitempty"`
+	LastErrorTime *timestamp.Timestamp `protobuf:"bytes,5,opt,name=last_error_time,json=lastErrorTime,proto3" json:"last_error_time,omitempty"`
+	// rate_limit_remaining is the number of requests left until the rate
+	// limit reset, -1 if unknown.
+	RateLimitRemaining   int32                `protobuf:"varint,6,opt,name=rate_limit_remaining,json=rateLimitRemaining,proto3" json:"rate_limit_remaining,omitempty"`
+	RateLimitReset       *timestamp.Timestamp `protobuf:"bytes,7,opt,name=rate_limit_reset,json=rateLimitReset,proto3" json:"rate_limit_reset,omitempty"`
+	Done                 bool                 `protobuf:"varint,8,opt,name=done,proto3" json:"done,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *Provider) Reset()         { *m = Provider{} }
+func (m *Provider) String() string { return proto.CompactTextString(m) }
+func (*Provider) ProtoMessage()    {}
+func (*Provider) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{2}
+}
+
+func (m *Provider) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Provider.Unmarshal(m, b)
+}
+func (m *Provider) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Provider.Marshal(b, m, deterministic)
+}
+func (m *Provider) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Provider.Merge(m, src)
+}
+func (m *Provider) XXX_Size() int {
+	return xxx_messageInfo_Provider.Size(m)
+}
+func (m *Provider) XXX_DiscardUnknown() {
+	xxx_messageInfo_Provider.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Provider proto.InternalMessageInfo
+
+func (m *Provider) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Provider) GetDiscovered() int32 {
+	if m != nil {
+		return m.Discovered
+	}
+	return 0
+}
+
+func (m *Provider) GetCursor() string {
+	if m != nil {
+		return m.Cursor
+	}
+	return ""
+}
+
+func (m *Provider) GetLastError() string {
+	if m != nil {
+		return m.LastError
+	}
+	return ""
+}
+
+func (m *Provider) GetLastErrorTime() *timestamp.Timestamp {
+	if m != nil {
+		return m.LastErrorTime
+	}
+	return nil
+}
+
+func (m *Provider) GetRateLimitRemaining() int32 {
+	if m != nil {
+		return m.RateLimitRemaining
+	}
+	return 0
+}
+
+func (m *Provider) GetRateLimitReset() *timestamp.Timestamp {
+	if m != nil {
+		return m.RateLimitReset
+	}
+	return nil
+}
+
+func (m *Provider) GetDone() bool {
+	if m != nil {
+		return m.Done
+	}
+	return false
+}
+
+type Latency struct {
+	// kind is the kind of the jobs, download or update.
+	Kind                 string             `protobuf:"bytes,1,opt,name=kind,proto3" json:"kind,omitempty"`
+	Count                int32              `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+	P50                  *duration.Duration `protobuf:"bytes,3,opt,name=p50,proto3" json:"p50,omitempty"`
+	P90                  *duration.Duration `protobuf:"bytes,4,opt,name=p90,proto3" json:"p90,omitempty"`
+	P99                  *duration.Duration `protobuf:"bytes,5,opt,name=p99,proto3" json:"p99,omitempty"`
+	Max                  *duration.Duration `protobuf:"bytes,6,opt,name=max,proto3" json:"max,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *Latency) Reset()         { *m = Latency{} }
+func (m *Latency) String() string { return proto.CompactTextString(m) }
+func (*Latency) ProtoMessage()    {}
+func (*Latency) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{3}
+}
+
+func (m *Latency) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Latency.Unmarshal(m, b)
+}
+func (m *Latency) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Latency.Marshal(b, m, deterministic)
+}
+func (m *Latency) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Latency.Merge(m, src)
+}
+func (m *Latency) XXX_Size() int {
+	return xxx_messageInfo_Latency.Size(m)
+}
+func (m *Latency) XXX_DiscardUnknown() {
+	xxx_messageInfo_Latency.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Latency proto.InternalMessageInfo
+
+func (m *Latency) GetKind() string {
+	if m != nil {
+		return m.Kind
+	}
+	return ""
+}
+
+func (m *Latency) GetCount() int32 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+func (m *Latency) GetP50() *duration.Duration {
+	if m != nil {
+		return m.P50
+	}
+	return nil
+}
+
+func (m *Latency) GetP90() *duration.Duration {
+	if m != nil {
+		return m.P90
+	}
+	return nil
+}
+
+func (m *Latency) GetP99() *duration.Duration {
+	if m != nil {
+		return m.P99
+	}
+	return nil
+}
+
+func (m *Latency) GetMax() *duration.Duration {
+	if m != nil {
+		return m.Max
+	}
+	return nil
+}
+
+type SetWorkersRequest struct {
+	Workers              int32    `protobuf:"varint,1,opt,name=workers,proto3" json:"workers,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SetWorkersRequest) Reset()         { *m = SetWorkersRequest{} }
+func (m *SetWorkersRequest) String() string { return proto.CompactTextString(m) }
+func (*SetWorkersRequest) ProtoMessage()    {}
+func (*SetWorkersRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{4}
+}
+
+func (m *SetWorkersRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SetWorkersRequest.Unmarshal(m, b)
+}
+func (m *SetWorkersRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SetWorkersRequest.Marshal(b, m, deterministic)
+}
+func (m *SetWorkersRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SetWorkersRequest.Merge(m, src)
+}
+func (m *SetWorkersRequest) XXX_Size() int {
+	return xxx_messageInfo_SetWorkersRequest.Size(m)
+}
+func (m *SetWorkersRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SetWorkersRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SetWorkersRequest proto.InternalMessageInfo
+
+func (m *SetWorkersRequest) GetWorkers() int32 {
+	if m != nil {
+		return m.Workers
+	}
+	return 0
+}
+
+type PauseRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PauseRequest) Reset()         { *m = PauseRequest{} }
+func (m *PauseRequest) String() string { return proto.CompactTextString(m) }
+func (*PauseRequest) ProtoMessage()    {}
+func (*PauseRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{5}
+}
+
+func (m *PauseRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PauseRequest.Unmarshal(m, b)
+}
+func (m *PauseRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PauseRequest.Marshal(b, m, deterministic)
+}
+func (m *PauseRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PauseRequest.Merge(m, src)
+}
+func (m *PauseRequest) XXX_Size() int {
+	return xxx_messageInfo_PauseRequest.Size(m)
+}
+func (m *PauseRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PauseRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PauseRequest proto.InternalMessageInfo
+
+type ResumeRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ResumeRequest) Reset()         { *m = ResumeRequest{} }
+func (m *ResumeRequest) String() string { return proto.CompactTextString(m) }
+func (*ResumeRequest) ProtoMessage()    {}
+func (*ResumeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{6}
+}
+
+func (m *ResumeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResumeRequest.Unmarshal(m, b)
+}
+func (m *ResumeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResumeRequest.Marshal(b, m, deterministic)
+}
+func (m *ResumeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResumeRequest.Merge(m, src)
+}
+func (m *ResumeRequest) XXX_Size() int {
+	return xxx_messageInfo_ResumeRequest.Size(m)
+}
+func (m *ResumeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResumeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResumeRequest proto.InternalMessageInfo
+
+type ListWorkersRequest struct {
+	// busy only returns the workers processing a job.
+	Busy                 bool     `protobuf:"varint,1,opt,name=busy,proto3" json:"busy,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListWorkersRequest) Reset()         { *m = ListWorkersRequest{} }
+func (m *ListWorkersRequest) String() string { return proto.CompactTextString(m) }
+func (*ListWorkersRequest) ProtoMessage()    {}
+func (*ListWorkersRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{7}
+}
+
+func (m *ListWorkersRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListWorkersRequest.Unmarshal(m, b)
+}
+func (m *ListWorkersRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListWorkersRequest.Marshal(b, m, deterministic)
+}
+func (m *ListWorkersRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListWorkersRequest.Merge(m, src)
+}
+func (m *ListWorkersRequest) XXX_Size() int {
+	return xxx_messageInfo_ListWorkersRequest.Size(m)
+}
+func (m *ListWorkersRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListWorkersRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListWorkersRequest proto.InternalMessageInfo
+
+func (m *ListWorkersRequest) GetBusy() bool {
+	if m != nil {
+		return m.Busy
+	}
+	return false
+}
+
+type Worker struct {
+	Worker string `protobuf:"bytes,1,opt,name=worker,proto3" json:"worker,omitempty"`
+	Busy   bool   `protobuf:"varint,2,opt,name=busy,proto3" json:"busy,omitempty"`
+	// job describes the job being processed.
+	Job                  string               `protobuf:"bytes,3,opt,name=job,proto3" json:"job,omitempty"`
+	JobStarted           *timestamp.Timestamp `protobuf:"bytes,4,opt,name=job_started,json=jobStarted,proto3" json:"job_started,omitempty"`
+	LastActivity         *timestamp.Timestamp `protobuf:"bytes,5,opt,name=last_activity,json=lastActivity,proto3" json:"last_activity,omitempty"`
+	Stuck                bool                 `protobuf:"varint,6,opt,name=stuck,proto3" json:"stuck,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *Worker) Reset()         { *m = Worker{} }
+func (m *Worker) String() string { return proto.CompactTextString(m) }
+func (*Worker) ProtoMessage()    {}
+func (*Worker) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{8}
+}
+
+func (m *Worker) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Worker.Unmarshal(m, b)
+}
+func (m *Worker) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Worker.Marshal(b, m, deterministic)
+}
+func (m *Worker) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Worker.Merge(m, src)
+}
+func (m *Worker) XXX_Size() int {
+	return xxx_messageInfo_Worker.Size(m)
+}
+func (m *Worker) XXX_DiscardUnknown() {
+	xxx_messageInfo_Worker.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Worker proto.InternalMessageInfo
+
+func (m *Worker) GetWorker() string {
+	if m != nil {
+		return m.Worker
+	}
+	return ""
+}
+
+func (m *Worker) GetBusy() bool {
+	if m != nil {
+		return m.Busy
+	}
+	return false
+}
+
+func (m *Worker) GetJob() string {
+	if m != nil {
+		return m.Job
+	}
+	return ""
+}
+
+func (m *Worker) GetJobStarted() *timestamp.Timestamp {
+	if m != nil {
+		return m.JobStarted
+	}
+	return nil
+}
+
+func (m *Worker) GetLastActivity() *timestamp.Timestamp {
+	if m != nil {
+		return m.LastActivity
+	}
+	return nil
+}
+
+func (m *Worker) GetStuck() bool {
+	if m != nil {
+		return m.Stuck
+	}
+	return false
+}
+
+type ListWorkersResponse struct {
+	Workers              []*Worker `protobuf:"bytes,1,rep,name=workers,proto3" json:"workers,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *ListWorkersResponse) Reset()         { *m = ListWorkersResponse{} }
+func (m *ListWorkersResponse) String() string { return proto.CompactTextString(m) }
+func (*ListWorkersResponse) ProtoMessage()    {}
+func (*ListWorkersResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{9}
+}
+
+func (m *ListWorkersResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListWorkersResponse.Unmarshal(m, b)
+}
+func (m *ListWorkersResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListWorkersResponse.Marshal(b, m, deterministic)
+}
+func (m *ListWorkersResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListWorkersResponse.Merge(m, src)
+}
+func (m *ListWorkersResponse) XXX_Size() int {
+	return xxx_messageInfo_ListWorkersResponse.Size(m)
+}
+func (m *ListWorkersResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListWorkersResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListWorkersResponse proto.InternalMessageInfo
+
+func (m *ListWorkersResponse) GetWorkers() []*Worker {
+	if m != nil {
+		return m.Workers
+	}
+	return nil
+}
+
+type ListFailuresRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListFailuresRequest) Reset()         { *m = ListFailuresRequest{} }
+func (m *ListFailuresRequest) String() string { return proto.CompactTextString(m) }
+func (*ListFailuresRequest) ProtoMessage()    {}
+func (*ListFailuresRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{10}
+}
+
+func (m *ListFailuresRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListFailuresRequest.Unmarshal(m, b)
+}
+func (m *ListFailuresRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListFailuresRequest.Marshal(b, m, deterministic)
+}
+func (m *ListFailuresRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListFailuresRequest.Merge(m, src)
+}
+func (m *ListFailuresRequest) XXX_Size() int {
+	return xxx_messageInfo_ListFailuresRequest.Size(m)
+}
+func (m *ListFailuresRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListFailuresRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListFailuresRequest proto.InternalMessageInfo
+
+type Failure struct {
+	Job                  string               `protobuf:"bytes,1,opt,name=job,proto3" json:"job,omitempty"`
+	Worker               string               `protobuf:"bytes,2,opt,name=worker,proto3" json:"worker,omitempty"`
+	Attempts             int32                `protobuf:"varint,3,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	Class                string               `protobuf:"bytes,4,opt,name=class,proto3" json:"class,omitempty"`
+	Code                 int32                `protobuf:"varint,5,opt,name=code,proto3" json:"code,omitempty"`
+	Error                string               `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	Elapsed              *duration.Duration   `protobuf:"bytes,7,opt,name=elapsed,proto3" json:"elapsed,omitempty"`
+	Failed               *timestamp.Timestamp `protobuf:"bytes,8,opt,name=failed,proto3" json:"failed,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *Failure) Reset()         { *m = Failure{} }
+func (m *Failure) String() string { return proto.CompactTextString(m) }
+func (*Failure) ProtoMessage()    {}
+func (*Failure) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{11}
+}
+
+func (m *Failure) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Failure.Unmarshal(m, b)
+}
+func (m *Failure) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Failure.Marshal(b, m, deterministic)
+}
+func (m *Failure) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Failure.Merge(m, src)
+}
+func (m *Failure) XXX_Size() int {
+	return xxx_messageInfo_Failure.Size(m)
+}
+func (m *Failure) XXX_DiscardUnknown() {
+	xxx_messageInfo_Failure.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Failure proto.InternalMessageInfo
+
+func (m *Failure) GetJob() string {
+	if m != nil {
+		return m.Job
+	}
+	return ""
+}
+
+func (m *Failure) GetWorker() string {
+	if m != nil {
+		return m.Worker
+	}
+	return ""
+}
+
+func (m *Failure) GetAttempts() int32 {
+	if m != nil {
+		return m.Attempts
+	}
+	return 0
+}
+
+func (m *Failure) GetClass() string {
+	if m != nil {
+		return m.Class
+	}
+	return ""
+}
+
+func (m *Failure) GetCode() int32 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+func (m *Failure) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *Failure) GetElapsed() *duration.Duration {
+	if m != nil {
+		return m.Elapsed
+	}
+	return nil
+}
+
+func (m *Failure) GetFailed() *timestamp.Timestamp {
+	if m != nil {
+		return m.Failed
+	}
+	return nil
+}
+
+type ListFailuresResponse struct {
+	Failures             []*Failure `protobuf:"bytes,1,rep,name=failures,proto3" json:"failures,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
+}
+
+func (m *ListFailuresResponse) Reset()         { *m = ListFailuresResponse{} }
+func (m *ListFailuresResponse) String() string { return proto.CompactTextString(m) }
+func (*ListFailuresResponse) ProtoMessage()    {}
+func (*ListFailuresResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{12}
+}
+
+func (m *ListFailuresResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListFailuresResponse.Unmarshal(m, b)
+}
+func (m *ListFailuresResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListFailuresResponse.Marshal(b, m, deterministic)
+}
+func (m *ListFailuresResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListFailuresResponse.Merge(m, src)
+}
+func (m *ListFailuresResponse) XXX_Size() int {
+	return xxx_messageInfo_ListFailuresResponse.Size(m)
+}
+func (m *ListFailuresResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListFailuresResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListFailuresResponse proto.InternalMessageInfo
+
+func (m *ListFailuresResponse) GetFailures() []*Failure {
+	if m != nil {
+		return m.Failures
+	}
+	return nil
+}
+
+type SubmitJobsRequest struct {
+	// urls are the repositories to download.
+	Urls                 []string `protobuf:"bytes,1,rep,name=urls,proto3" json:"urls,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubmitJobsRequest) Reset()         { *m = SubmitJobsRequest{} }
+func (m *SubmitJobsRequest) String() string { return proto.CompactTextString(m) }
+func (*SubmitJobsRequest) ProtoMessage()    {}
+func (*SubmitJobsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{13}
+}
+
+func (m *SubmitJobsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubmitJobsRequest.Unmarshal(m, b)
+}
+func (m *SubmitJobsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubmitJobsRequest.Marshal(b, m, deterministic)
+}
+func (m *SubmitJobsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubmitJobsRequest.Merge(m, src)
+}
+func (m *SubmitJobsRequest) XXX_Size() int {
+	return xxx_messageInfo_SubmitJobsRequest.Size(m)
+}
+func (m *SubmitJobsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubmitJobsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubmitJobsRequest proto.InternalMessageInfo
+
+func (m *SubmitJobsRequest) GetUrls() []string {
+	if m != nil {
+		return m.Urls
+	}
+	return nil
+}
+
+type SubmitJobsResponse struct {
+	Enqueued             int32    `protobuf:"varint,1,opt,name=enqueued,proto3" json:"enqueued,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubmitJobsResponse) Reset()         { *m = SubmitJobsResponse{} }
+func (m *SubmitJobsResponse) String() string { return proto.CompactTextString(m) }
+func (*SubmitJobsResponse) ProtoMessage()    {}
+func (*SubmitJobsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{14}
+}
+
+func (m *SubmitJobsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubmitJobsResponse.Unmarshal(m, b)
+}
+func (m *SubmitJobsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubmitJobsResponse.Marshal(b, m, deterministic)
+}
+func (m *SubmitJobsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubmitJobsResponse.Merge(m, src)
+}
+func (m *SubmitJobsResponse) XXX_Size() int {
+	return xxx_messageInfo_SubmitJobsResponse.Size(m)
+}
+func (m *SubmitJobsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubmitJobsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubmitJobsResponse proto.InternalMessageInfo
+
+func (m *SubmitJobsResponse) GetEnqueued() int32 {
+	if m != nil {
+		return m.Enqueued
+	}
+	return 0
+}
+
+type WatchJobsRequest struct {
+	// types are the events streamed, all of them if empty.
+	Types                []JobEvent_Type `protobuf:"varint,1,rep,packed,name=types,proto3,enum=gitcollector.api.JobEvent_Type" json:"types,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *WatchJobsRequest) Reset()         { *m = WatchJobsRequest{} }
+func (m *WatchJobsRequest) String() string { return proto.CompactTextString(m) }
+func (*WatchJobsRequest) ProtoMessage()    {}
+func (*WatchJobsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{15}
+}
+
+func (m *WatchJobsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WatchJobsRequest.Unmarshal(m, b)
+}
+func (m *WatchJobsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WatchJobsRequest.Marshal(b, m, deterministic)
+}
+func (m *WatchJobsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WatchJobsRequest.Merge(m, src)
+}
+func (m *WatchJobsRequest) XXX_Size() int {
+	return xxx_messageInfo_WatchJobsRequest.Size(m)
+}
+func (m *WatchJobsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_WatchJobsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WatchJobsRequest proto.InternalMessageInfo
+
+func (m *WatchJobsRequest) GetTypes() []JobEvent_Type {
+	if m != nil {
+		return m.Types
+	}
+	return nil
+}
+
+type JobEvent struct {
+	Type    JobEvent_Type        `protobuf:"varint,1,opt,name=type,proto3,enum=gitcollector.api.JobEvent_Type" json:"type,omitempty"`
+	Job     string               `protobuf:"bytes,2,opt,name=job,proto3" json:"job,omitempty"`
+	Worker  string               `protobuf:"bytes,3,opt,name=worker,proto3" json:"worker,omitempty"`
+	Attempt int32                `protobuf:"varint,4,opt,name=attempt,proto3" json:"attempt,omitempty"`
+	Time    *timestamp.Timestamp `protobuf:"bytes,5,opt,name=time,proto3" json:"time,omitempty"`
+	// error is the error of the retried attempt or the failed job.
+	Error string `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	// backoff is the time waited before retrying.
+	Backoff *duration.Duration `protobuf:"bytes,7,opt,name=backoff,proto3" json:"backoff,omitempty"`
+	// elapsed is the time spent processing the succeeded or failed job.
+	Elapsed       *duration.Duration `protobuf:"bytes,8,opt,name=elapsed,proto3" json:"elapsed,omitempty"`
+	BytesFetched  uint64             `protobuf:"varint,9,opt,name=bytes_fetched,json=bytesFetched,proto3" json:"bytes_fetched,omitempty"`
+	ObjectsPacked uint64             `protobuf:"varint,10,opt,name=objects_packed,json=objectsPacked,proto3" json:"objects_packed,omitempty"`
+	// class and code classify the error of the failed job.
+	Class string `protobuf:"bytes,11,opt,name=class,proto3" json:"class,omitempty"`
+	Code  int32  `protobuf:"varint,12,opt,name=code,proto3" json:"code,omitempty"`
+	// dropped is the number of events not streamed before this one because
+	// the client didn't keep up with them.
+	Dropped              uint64   `protobuf:"varint,13,opt,name=dropped,proto3" json:"dropped,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *JobEvent) Reset()         { *m = JobEvent{} }
+func (m *JobEvent) String() string { return proto.CompactTextString(m) }
+func (*JobEvent) ProtoMessage()    {}
+func (*JobEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{16}
+}
+
+func (m *JobEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_JobEvent.Unmarshal(m, b)
+}
+func (m *JobEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_JobEvent.Marshal(b, m, deterministic)
+}
+func (m *JobEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_JobEvent.Merge(m, src)
+}
+func (m *JobEvent) XXX_Size() int {
+	return xxx_messageInfo_JobEvent.Size(m)
+}
+func (m *JobEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_JobEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_JobEvent proto.InternalMessageInfo
+
+func (m *JobEvent) GetType() JobEvent_Type {
+	if m != nil {
+		return m.Type
+	}
+	return JobEvent_UNKNOWN
+}
+
+func (m *JobEvent) GetJob() string {
+	if m != nil {
+		return m.Job
+	}
+	return ""
+}
+
+func (m *JobEvent) GetWorker() string {
+	if m != nil {
+		return m.Worker
+	}
+	return ""
+}
+
+func (m *JobEvent) GetAttempt() int32 {
+	if m != nil {
+		return m.Attempt
+	}
+	return 0
+}
+
+func (m *JobEvent) GetTime() *timestamp.Timestamp {
+	if m != nil {
+		return m.Time
+	}
+	return nil
+}
+
+func (m *JobEvent) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *JobEvent) GetBackoff() *duration.Duration {
+	if m != nil {
+		return m.Backoff
+	}
+	return nil
+}
+
+func (m *JobEvent) GetElapsed() *duration.Duration {
+	if m != nil {
+		return m.Elapsed
+	}
+	return nil
+}
+
+func (m *JobEvent) GetBytesFetched() uint64 {
+	if m != nil {
+		return m.BytesFetched
+	}
+	return 0
+}
+
+func (m *JobEvent) GetObjectsPacked() uint64 {
+	if m != nil {
+		return m.ObjectsPacked
+	}
+	return 0
+}
+
+func (m *JobEvent) GetClass() string {
+	if m != nil {
+		return m.Class
+	}
+	return ""
+}
+
+func (m *JobEvent) GetCode() int32 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+func (m *JobEvent) GetDropped() uint64 {
+	if m != nil {
+		return m.Dropped
+	}
+	return 0
+}
+
+type ListRepositoriesRequest struct {
+	// endpoint only returns the repositories with an endpoint containing it.
+	Endpoint string `protobuf:"bytes,1,opt,name=endpoint,proto3" json:"endpoint,omitempty"`
+	// limit is the maximum number of repositories returned, all of them if
+	// 0.
+	Limit                int32    `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListRepositoriesRequest) Reset()         { *m = ListRepositoriesRequest{} }
+func (m *ListRepositoriesRequest) String() string { return proto.CompactTextString(m) }
+func (*ListRepositoriesRequest) ProtoMessage()    {}
+func (*ListRepositoriesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{17}
+}
+
+func (m *ListRepositoriesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListRepositoriesRequest.Unmarshal(m, b)
+}
+func (m *ListRepositoriesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListRepositoriesRequest.Marshal(b, m, deterministic)
+}
+func (m *ListRepositoriesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListRepositoriesRequest.Merge(m, src)
+}
+func (m *ListRepositoriesRequest) XXX_Size() int {
+	return xxx_messageInfo_ListRepositoriesRequest.Size(m)
+}
+func (m *ListRepositoriesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListRepositoriesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListRepositoriesRequest proto.InternalMessageInfo
+
+func (m *ListRepositoriesRequest) GetEndpoint() string {
+	if m != nil {
+		return m.Endpoint
+	}
+	return ""
+}
+
+func (m *ListRepositoriesRequest) GetLimit() int32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+type Repository struct {
+	// location is the location the repository is stored in.
+	Location string `protobuf:"bytes,1,opt,name=location,proto3" json:"location,omitempty"`
+	// id is the identifier of the repository in its location.
+	Id         string   `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Endpoints  []string `protobuf:"bytes,3,rep,name=endpoints,proto3" json:"endpoints,omitempty"`
+	References int64    `protobuf:"varint,4,opt,name=references,proto3" json:"references,omitempty"`
+	// size is the size in bytes of the location.
+	Size                 int64                `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`
+	Updated              *timestamp.Timestamp `protobuf:"bytes,6,opt,name=updated,proto3" json:"updated,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *Repository) Reset()         { *m = Repository{} }
+func (m *Repository) String() string { return proto.CompactTextString(m) }
+func (*Repository) ProtoMessage()    {}
+func (*Repository) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{18}
+}
+
+func (m *Repository) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Repository.Unmarshal(m, b)
+}
+func (m *Repository) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Repository.Marshal(b, m, deterministic)
+}
+func (m *Repository) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Repository.Merge(m, src)
+}
+func (m *Repository) XXX_Size() int {
+	return xxx_messageInfo_Repository.Size(m)
+}
+func (m *Repository) XXX_DiscardUnknown() {
+	xxx_messageInfo_Repository.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Repository proto.InternalMessageInfo
+
+func (m *Repository) GetLocation() string {
+	if m != nil {
+		return m.Location
+	}
+	return ""
+}
+
+func (m *Repository) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Repository) GetEndpoints() []string {
+	if m != nil {
+		return m.Endpoints
+	}
+	return nil
+}
+
+func (m *Repository) GetReferences() int64 {
+	if m != nil {
+		return m.References
+	}
+	return 0
+}
+
+func (m *Repository) GetSize() int64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
+}
+
+func (m *Repository) GetUpdated() *timestamp.Timestamp {
+	if m != nil {
+		return m.Updated
+	}
+	return nil
+}
+
+type RediscoverRequest struct {
+	Org                  string   `protobuf:"bytes,1,opt,name=org,proto3" json:"org,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RediscoverRequest) Reset()         { *m = RediscoverRequest{} }
+func (m *RediscoverRequest) String() string { return proto.CompactTextString(m) }
+func (*RediscoverRequest) ProtoMessage()    {}
+func (*RediscoverRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{19}
+}
+
+func (m *RediscoverRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RediscoverRequest.Unmarshal(m, b)
+}
+func (m *RediscoverRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RediscoverRequest.Marshal(b, m, deterministic)
+}
+func (m *RediscoverRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RediscoverRequest.Merge(m, src)
+}
+func (m *RediscoverRequest) XXX_Size() int {
+	return xxx_messageInfo_RediscoverRequest.Size(m)
+}
+func (m *RediscoverRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RediscoverRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RediscoverRequest proto.InternalMessageInfo
+
+func (m *RediscoverRequest) GetOrg() string {
+	if m != nil {
+		return m.Org
+	}
+	return ""
+}
+
+type RediscoverResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RediscoverResponse) Reset()         { *m = RediscoverResponse{} }
+func (m *RediscoverResponse) String() string { return proto.CompactTextString(m) }
+func (*RediscoverResponse) ProtoMessage()    {}
+func (*RediscoverResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d89845755d08e916, []int{20}
+}
+
+func (m *RediscoverResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RediscoverResponse.Unmarshal(m, b)
+}
+func (m *RediscoverResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RediscoverResponse.Marshal(b, m, deterministic)
+}
+func (m *RediscoverResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RediscoverResponse.Merge(m, src)
+}
+func (m *RediscoverResponse) XXX_Size() int {
+	return xxx_messageInfo_RediscoverResponse.Size(m)
+}
+func (m *RediscoverResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RediscoverResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RediscoverResponse proto.InternalMessageInfo
+
+func init() {
+	proto.RegisterEnum("gitcollector.api.JobEvent_Type", JobEvent_Type_name, JobEvent_Type_value)
+	proto.RegisterType((*GetStatusRequest)(nil), "gitcollector.api.GetStatusRequest")
+	proto.RegisterType((*Status)(nil), "gitcollector.api.Status")
+	proto.RegisterType((*Provider)(nil), "gitcollector.api.Provider")
+	proto.RegisterType((*Latency)(nil), "gitcollector.api.Latency")
+	proto.RegisterType((*SetWorkersRequest)(nil), "gitcollector.api.SetWorkersRequest")
+	proto.RegisterType((*PauseRequest)(nil), "gitcollector.api.PauseRequest")
+	proto.RegisterType((*ResumeRequest)(nil), "gitcollector.api.ResumeRequest")
+	proto.RegisterType((*ListWorkersRequest)(nil), "gitcollector.api.ListWorkersRequest")
+	proto.RegisterType((*Worker)(nil), "gitcollector.api.Worker")
+	proto.RegisterType((*ListWorkersResponse)(nil), "gitcollector.api.ListWorkersResponse")
+	proto.RegisterType((*ListFailuresRequest)(nil), "gitcollector.api.ListFailuresRequest")
+	proto.RegisterType((*Failure)(nil), "gitcollector.api.Failure")
+	proto.RegisterType((*ListFailuresResponse)(nil), "gitcollector.api.ListFailuresResponse")
+	proto.RegisterType((*SubmitJobsRequest)(nil), "gitcollector.api.SubmitJobsRequest")
+	proto.RegisterType((*SubmitJobsResponse)(nil), "gitcollector.api.SubmitJobsResponse")
+	proto.RegisterType((*WatchJobsRequest)(nil), "gitcollector.api.WatchJobsRequest")
+	proto.RegisterType((*JobEvent)(nil), "gitcollector.api.JobEvent")
+	proto.RegisterType((*ListRepositoriesRequest)(nil), "gitcollector.api.ListRepositoriesRequest")
+	proto.RegisterType((*Repository)(nil), "gitcollector.api.Repository")
+	proto.RegisterType((*RediscoverRequest)(nil), "gitcollector.api.RediscoverRequest")
+	proto.RegisterType((*RediscoverResponse)(nil), "gitcollector.api.RediscoverResponse")
+}
+
+func init() { proto.RegisterFile("gitcollector.proto", fileDescriptor_d89845755d08e916) }
+
+var fileDescriptor_d89845755d08e916 = []byte{
+	// 1352 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x56, 0xdd, 0x6e, 0xdb, 0xc6,
+	0x12, 0x3e, 0xd4, 0xbf, 0xc6, 0x3f, 0x51, 0xf6, 0xf8, 0x9c, 0xc3, 0x23, 0xa4, 0x89, 0xc1, 0xc4,
+	0x8d, 0x8b, 0x22, 0xb2, 0xe1, 0x34, 0x68, 0x8d, 0x5c, 0x14, 0x8e, 0xa5, 0x14, 0x4e, 0x1c, 0x37,
+	0xa5, 0xed, 0x1a, 0x08, 0x10, 0x08, 0x2b, 0x72, 0xa5, 0xac, 0x4d, 0x71, 0x19, 0xee, 0xd2, 0x8d,
+	0xfa, 0x0a, 0x7d, 0x84, 0xbe, 0x4c, 0x2f, 0xda, 0x97, 0xe8, 0x0b, 0xf4, 0x15, 0x7a, 0x59, 0xec,
+	0x0f, 0x29, 0x4a, 0xa6, 0x2d, 0xdf, 0xed, 0xcc, 0x7e, 0x33, 0x4b, 0x7e, 0xfb, 0xcd, 0xcc, 0x02,
+	0x1a, 0x51, 0xe1, 0xb1, 0x20, 0x20, 0x9e, 0x60, 0x71, 0x27, 0x8a, 0x99, 0x60, 0xa8, 0x35, 0xe3,
+	0xc3, 0x11, 0x6d, 0xdf, 0x1f, 0x31, 0x36, 0x0a, 0xc8, 0x96, 0xda, 0x1f, 0x24, 0xc3, 0x2d, 0x3f,
+	0x89, 0xb1, 0xa0, 0x2c, 0xd4, 0x11, 0xed, 0x07, 0xf3, 0xfb, 0x82, 0x8e, 0x09, 0x17, 0x78, 0x1c,
+	0x69, 0x80, 0x83, 0xa0, 0xf5, 0x1d, 0x11, 0xc7, 0x02, 0x8b, 0x84, 0xbb, 0xe4, 0x63, 0x42, 0xb8,
+	0x70, 0x7e, 0x29, 0x41, 0x4d, 0x7b, 0xd0, 0x7f, 0xa1, 0xf6, 0x31, 0x21, 0x09, 0xf1, 0x6d, 0x6b,
+	0xdd, 0xda, 0xac, 0xba, 0xc6, 0x42, 0x36, 0xd4, 0x7d, 0x12, 0xe0, 0x09, 0xf1, 0xed, 0x92, 0xda,
+	0x48, 0x4d, 0xb9, 0xf3, 0x13, 0x8b, 0x2f, 0x48, 0xcc, 0xed, 0xb2, 0xde, 0x31, 0x26, 0x42, 0x50,
+	0x19, 0x24, 0x7c, 0x62, 0x57, 0x94, 0x5b, 0xad, 0x65, 0xfe, 0x08, 0x27, 0x9c, 0xf8, 0x76, 0x75,
+	0xdd, 0xda, 0x6c, 0xb8, 0xc6, 0x92, 0xfe, 0x21, 0xa6, 0x01, 0xf1, 0xed, 0x9a, 0x3e, 0x57, 0x5b,
+	0xe8, 0x1b, 0x68, 0x46, 0x31, 0xbb, 0xa4, 0xbe, 0xcc, 0x5f, 0x5f, 0x2f, 0x6f, 0x2e, 0xed, 0xb4,
+	0x3b, 0xf3, 0xac, 0x74, 0xde, 0x1a, 0x88, 0x3b, 0x05, 0xa3, 0xaf, 0xa1, 0x19, 0x60, 0x41, 0x42,
+	0x8f, 0x12, 0x6e, 0x37, 0x54, 0xe4, 0xff, 0xaf, 0x46, 0x1e, 0x2a, 0xc8, 0xc4, 0x9d, 0x62, 0x9d,
+	0x3f, 0x4a, 0xd0, 0x48, 0x13, 0xca, 0x7f, 0x08, 0xf1, 0x98, 0x28, 0x36, 0x9a, 0xae, 0x5a, 0xa3,
+	0xfb, 0x00, 0x3e, 0xe5, 0x1e, 0xbb, 0x24, 0x71, 0x46, 0x47, 0xce, 0x23, 0xff, 0xc5, 0x4b, 0x62,
+	0xce, 0x62, 0x45, 0x48, 0xd3, 0x35, 0x16, 0xfa, 0x0c, 0x20, 0xc0, 0x5c, 0xf4, 0x49, 0x1c, 0xb3,
+	0x58, 0xb1, 0xd2, 0x94, 0xe7, 0x72, 0xd1, 0x93, 0x0e, 0xf4, 0x02, 0xee, 0x4c, 0xb7, 0xfb, 0xf2,
+	0xde, 0x14, 0x47, 0xea, 0x87, 0xd5, 0xa5, 0x76, 0xd2, 0x4b, 0xed, 0x9c, 0xa4, 0x97, 0xea, 0xae,
+	0x64, 0xf1, 0xd2, 0x87, 0xb6, 0x61, 0x2d, 0xc6, 0x82, 0xf4, 0x03, 0x3a, 0xa6, 0xa2, 0x1f, 0x93,
+	0x31, 0xa6, 0x21, 0x0d, 0x47, 0x86, 0x54, 0x24, 0xf7, 0x0e, 0xe5, 0x96, 0x9b, 0xee, 0xa0, 0x2e,
+	0xb4, 0x66, 0x22, 0x38, 0x11, 0x76, 0x7d, 0xe1, 0xb1, 0xab, 0xb9, 0x4c, 0x9c, 0x08, 0x49, 0x93,
+	0xcf, 0x42, 0x62, 0x37, 0xd4, 0xa5, 0xaa, 0xb5, 0xf3, 0x97, 0x05, 0x75, 0x43, 0xaf, 0xdc, 0xbf,
+	0xa0, 0xa1, 0x9f, 0xd2, 0x28, 0xd7, 0x68, 0x0d, 0xaa, 0x1e, 0x4b, 0x42, 0x61, 0x18, 0xd4, 0x06,
+	0xfa, 0x12, 0xca, 0xd1, 0xb3, 0x6d, 0xc5, 0x9c, 0xba, 0xb0, 0xb9, 0x4f, 0xe8, 0x1a, 0xb9, 0xbb,
+	0x12, 0xa5, 0xc0, 0xbb, 0xdb, 0x76, 0x65, 0x31, 0x78, 0xd7, 0x80, 0x77, 0xed, 0xea, 0x2d, 0xc0,
+	0xbb, 0x12, 0x3c, 0xc6, 0x9f, 0xec, 0xda, 0x42, 0xf0, 0x18, 0x7f, 0x72, 0x9e, 0xc0, 0xdd, 0x63,
+	0x22, 0xce, 0xb4, 0xec, 0x4d, 0x51, 0xe5, 0xeb, 0xc2, 0x9a, 0xa9, 0x0b, 0x67, 0x15, 0x96, 0xdf,
+	0x4a, 0xd5, 0xa7, 0xe5, 0x77, 0x07, 0x56, 0x5c, 0xc2, 0x93, 0x71, 0xe6, 0xd8, 0x04, 0x74, 0x48,
+	0xf9, 0x7c, 0xc2, 0xb4, 0x9c, 0x2c, 0xcd, 0xb1, 0x5c, 0x3b, 0x7f, 0x5a, 0x50, 0xd3, 0x30, 0xa9,
+	0x3a, 0x7d, 0x80, 0x21, 0xd9, 0x58, 0x59, 0x58, 0x69, 0x1a, 0x86, 0x5a, 0x50, 0x3e, 0x67, 0x03,
+	0x23, 0x4f, 0xb9, 0x44, 0xcf, 0x61, 0xe9, 0x9c, 0x0d, 0xfa, 0x5c, 0xe0, 0x58, 0x10, 0xdf, 0xae,
+	0x2c, 0x54, 0x00, 0x9c, 0xb3, 0xc1, 0xb1, 0x46, 0xa3, 0x6f, 0x41, 0xc9, 0xb0, 0x8f, 0x3d, 0x41,
+	0x2f, 0xa9, 0x98, 0xdc, 0x42, 0xb7, 0xcb, 0x32, 0x60, 0xcf, 0xe0, 0xa5, 0x14, 0xb8, 0x48, 0xbc,
+	0x0b, 0xc5, 0x77, 0xc3, 0xd5, 0x86, 0x73, 0x00, 0xff, 0x9e, 0xa1, 0x81, 0x47, 0x2c, 0xe4, 0x04,
+	0xed, 0xe4, 0x89, 0x95, 0x65, 0x6d, 0x5f, 0x2d, 0x6b, 0x1d, 0x33, 0xa5, 0xfc, 0x3f, 0x3a, 0xd5,
+	0x4b, 0x4c, 0x83, 0x24, 0x26, 0x59, 0xe3, 0xfb, 0xdb, 0x82, 0xba, 0xf1, 0xa5, 0x9c, 0x58, 0x53,
+	0x4e, 0xa6, 0x8c, 0x96, 0x66, 0x18, 0x6d, 0x43, 0x03, 0x0b, 0x41, 0xc6, 0x91, 0x48, 0x5b, 0x5e,
+	0x66, 0x2b, 0x51, 0x07, 0x98, 0x73, 0x53, 0xde, 0xda, 0x90, 0x77, 0xe0, 0x31, 0x5f, 0xd7, 0x73,
+	0xd5, 0x55, 0x6b, 0x89, 0xd4, 0x8d, 0xa0, 0xa6, 0x91, 0xca, 0x40, 0x4f, 0xa1, 0x4e, 0x02, 0x1c,
+	0xc9, 0x06, 0x59, 0x5f, 0xa4, 0xbd, 0x14, 0x89, 0x76, 0xb2, 0xe6, 0xd9, 0x58, 0x48, 0xbc, 0x41,
+	0x3a, 0x6f, 0x60, 0x6d, 0x96, 0x11, 0xc3, 0xee, 0x33, 0x68, 0x0c, 0x8d, 0xcf, 0xb6, 0xae, 0xeb,
+	0x9a, 0x26, 0xca, 0xcd, 0xa0, 0xce, 0x63, 0xb8, 0x7b, 0x9c, 0x0c, 0xc6, 0x54, 0xbc, 0x62, 0x83,
+	0xbc, 0x62, 0x93, 0x38, 0xd0, 0x79, 0x9a, 0xae, 0x5a, 0x3b, 0xdb, 0x80, 0xf2, 0x40, 0x73, 0x6a,
+	0x1b, 0x1a, 0x24, 0x9c, 0x19, 0x3c, 0x99, 0xed, 0x1c, 0x40, 0xeb, 0x0c, 0x0b, 0xef, 0x43, 0x3e,
+	0xf3, 0x33, 0xa8, 0x8a, 0x49, 0x64, 0x3e, 0x71, 0x75, 0xe7, 0xc1, 0xd5, 0x4f, 0x7c, 0xc5, 0x06,
+	0xbd, 0x4b, 0x12, 0x8a, 0xce, 0xc9, 0x24, 0x22, 0xae, 0x46, 0x3b, 0xbf, 0x56, 0xa0, 0x91, 0x6e,
+	0xa0, 0xa7, 0x50, 0x91, 0x5e, 0x75, 0xde, 0x2d, 0x52, 0x28, 0x70, 0xaa, 0x92, 0x52, 0x91, 0x4a,
+	0xca, 0x33, 0x2a, 0xb1, 0xa1, 0x6e, 0x54, 0x61, 0x06, 0x60, 0x6a, 0xa2, 0x0e, 0x54, 0x6e, 0xd9,
+	0xdd, 0x15, 0xee, 0x7a, 0xa5, 0x0c, 0xb0, 0x77, 0xc1, 0x86, 0xc3, 0x5b, 0x28, 0xc5, 0x20, 0xf3,
+	0xf2, 0x6a, 0xdc, 0x5a, 0x5e, 0x0f, 0x61, 0x65, 0x30, 0x11, 0x84, 0xf7, 0x87, 0x44, 0x78, 0x1f,
+	0x88, 0x6f, 0x37, 0xd7, 0xad, 0xcd, 0x8a, 0xbb, 0xac, 0x9c, 0x2f, 0xb5, 0x0f, 0x6d, 0xc0, 0x2a,
+	0x1b, 0x9c, 0x13, 0x4f, 0xf0, 0x7e, 0x84, 0xbd, 0x0b, 0xe2, 0xdb, 0xa0, 0x50, 0x2b, 0xc6, 0xfb,
+	0x56, 0x39, 0xa7, 0xf5, 0xb1, 0x54, 0x54, 0x1f, 0xcb, 0xb9, 0xfa, 0x90, 0x2f, 0x8e, 0x98, 0x45,
+	0x11, 0xf1, 0xed, 0x15, 0x95, 0x29, 0x35, 0x9d, 0x1f, 0xa1, 0x22, 0x6f, 0x04, 0x2d, 0x41, 0xfd,
+	0xf4, 0xe8, 0xf5, 0xd1, 0xf7, 0x67, 0x47, 0xad, 0x7f, 0xa1, 0x65, 0x68, 0xf4, 0x8e, 0x7e, 0x38,
+	0xed, 0x9d, 0xf6, 0xba, 0x2d, 0x4b, 0x6e, 0x1d, 0x9f, 0xec, 0xb9, 0x27, 0xbd, 0x6e, 0xab, 0x24,
+	0x0d, 0xb7, 0x77, 0xe2, 0x1e, 0xf4, 0xba, 0xad, 0x32, 0x5a, 0x81, 0xe6, 0xf1, 0xe9, 0xfe, 0x7e,
+	0xaf, 0xd7, 0xed, 0x75, 0x5b, 0x15, 0x04, 0x50, 0x7b, 0xb9, 0x77, 0x70, 0xd8, 0xeb, 0xb6, 0xaa,
+	0xce, 0x6b, 0xf8, 0x9f, 0x2c, 0x09, 0x97, 0x44, 0x8c, 0x53, 0xc1, 0x62, 0x9a, 0x35, 0x0a, 0xad,
+	0x4f, 0x3f, 0x62, 0x34, 0x14, 0xa6, 0x43, 0x64, 0xb6, 0xfc, 0x25, 0x35, 0x3c, 0xd3, 0x39, 0xa6,
+	0x0c, 0xe7, 0x37, 0x0b, 0x20, 0xcb, 0x34, 0x91, 0x09, 0x02, 0xe6, 0x29, 0x62, 0xd3, 0x04, 0xa9,
+	0x8d, 0x56, 0xa1, 0x44, 0x7d, 0x23, 0xa9, 0x12, 0xf5, 0xd1, 0x3d, 0x68, 0xa6, 0xc9, 0x65, 0x83,
+	0x91, 0xb5, 0x33, 0x75, 0xc8, 0xd7, 0x47, 0x4c, 0x86, 0x24, 0x26, 0xa1, 0x47, 0x74, 0x9b, 0x29,
+	0xbb, 0x39, 0x8f, 0xe4, 0x92, 0xd3, 0x9f, 0xb5, 0xba, 0xca, 0xae, 0x5a, 0xa3, 0xaf, 0xa0, 0x9e,
+	0x44, 0x3e, 0x16, 0xe6, 0x79, 0x75, 0xb3, 0xe8, 0x52, 0xa8, 0xb3, 0x01, 0x77, 0x5d, 0x92, 0xbe,
+	0x6b, 0x52, 0x26, 0x5a, 0x50, 0x66, 0xf1, 0x28, 0x6d, 0x93, 0x2c, 0x1e, 0x39, 0x6b, 0x80, 0xf2,
+	0x30, 0x5d, 0xd1, 0x3b, 0xbf, 0xd7, 0xa0, 0xbe, 0xcf, 0x42, 0x11, 0xb3, 0x00, 0x1d, 0x40, 0x33,
+	0x7b, 0x73, 0x22, 0xe7, 0x6a, 0xa1, 0xcd, 0x3f, 0x48, 0xdb, 0x05, 0x1d, 0xdd, 0x44, 0xbf, 0x06,
+	0x98, 0x8e, 0x5a, 0xf4, 0xb0, 0x00, 0x37, 0x3f, 0x88, 0x6f, 0x48, 0xb6, 0x07, 0x55, 0x35, 0x88,
+	0xd1, 0xfd, 0x82, 0x27, 0x65, 0x6e, 0x42, 0xdf, 0x90, 0x62, 0x1f, 0x6a, 0x7a, 0x76, 0xa3, 0x82,
+	0x06, 0x32, 0x33, 0xd5, 0x6f, 0x48, 0xf2, 0x0e, 0x96, 0x72, 0x83, 0x0e, 0x3d, 0x2a, 0x78, 0xa6,
+	0x5e, 0x79, 0x0e, 0xb4, 0x37, 0x16, 0xa0, 0x4c, 0x67, 0x7d, 0x0f, 0xcb, 0xf9, 0x3e, 0x8f, 0xae,
+	0x09, 0x9b, 0x9b, 0x8c, 0xed, 0xcf, 0x17, 0xc1, 0x4c, 0xfa, 0x33, 0x80, 0x69, 0x3b, 0x2f, 0xbc,
+	0x8f, 0xf9, 0xa9, 0xd0, 0x7e, 0x74, 0x33, 0xc8, 0x24, 0x7e, 0x03, 0xcd, 0xac, 0xeb, 0x17, 0x69,
+	0x66, 0x7e, 0x24, 0xb4, 0xdb, 0xd7, 0x37, 0xf0, 0x6d, 0x0b, 0xbd, 0x87, 0xd6, 0x7c, 0x6d, 0xa3,
+	0x2f, 0x8a, 0xff, 0xb1, 0xa0, 0xfe, 0xdb, 0xf7, 0x8a, 0x2e, 0x37, 0x2d, 0xee, 0x6d, 0x4b, 0xd2,
+	0x30, 0xad, 0x81, 0x22, 0x1a, 0xae, 0x14, 0x52, 0xfb, 0xd1, 0xcd, 0x20, 0x4d, 0xc3, 0x8b, 0xc7,
+	0xef, 0x36, 0x46, 0x54, 0x7c, 0x48, 0x06, 0x1d, 0x8f, 0x8d, 0xb7, 0x78, 0xec, 0x3d, 0xf1, 0xb7,
+	0xf2, 0x71, 0x5b, 0x38, 0xa2, 0xcf, 0x71, 0x44, 0x07, 0x35, 0x55, 0xc9, 0x4f, 0xff, 0x19, 0x00,
+	0xdf, 0x75, 0x21, 0x85, 0x47, 0x0e, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// ControlClient is the client API for Control service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type ControlClient interface {
+	// GetStatus returns the status of the worker pool.
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*Status, error)
+	// SetWorkers changes the number of workers of the pool.
+	SetWorkers(ctx context.Context, in *SetWorkersRequest, opts ...grpc.CallOption) (*Status, error)
+	// Pause stops starting new jobs, the running ones finish.
+	Pause(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*Status, error)
+	// Resume starts processing jobs again after a Pause.
+	Resume(ctx context.Context, in *ResumeRequest, opts ...grpc.CallOption) (*Status, error)
+	// ListWorkers returns the activity of the workers.
+	ListWorkers(ctx context.Context, in *ListWorkersRequest, opts ...grpc.CallOption) (*ListWorkersResponse, error)
+	// ListFailures returns the recent failed jobs, the newest first.
+	ListFailures(ctx context.Context, in *ListFailuresRequest, opts ...grpc.CallOption) (*ListFailuresResponse, error)
+	// SubmitJobs enqueues the download of repositories.
+	SubmitJobs(ctx context.Context, in *SubmitJobsRequest, opts ...grpc.CallOption) (*SubmitJobsResponse, error)
+	// WatchJobs streams the lifecycle events of the jobs until the client
+	// cancels it or the collection finishes.
+	WatchJobs(ctx context.Context, in *WatchJobsRequest, opts ...grpc.CallOption) (Control_WatchJobsClient, error)
+	// ListRepositories streams the repositories stored in the library.
+	ListRepositories(ctx context.Context, in *ListRepositoriesRequest, opts ...grpc.CallOption) (Control_ListRepositoriesClient, error)
+	// Rediscover discovers the repositories of an organization again,
+	// enqueuing them along with the rest of the jobs.
+	Rediscover(ctx context.Context, in *RediscoverRequest, opts ...grpc.CallOption) (*RediscoverResponse, error)
+}
+
+type controlClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewControlClient(cc grpc.ClientConnInterface) ControlClient {
+	return &controlClient{cc}
+}
+
+func (c *controlClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/gitcollector.api.Control/GetStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) SetWorkers(ctx context.Context, in *SetWorkersRequest, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/gitcollector.api.Control/SetWorkers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) Pause(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/gitcollector.api.Control/Pause", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) Resume(ctx context.Context, in *ResumeRequest, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/gitcollector.api.Control/Resume", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) ListWorkers(ctx context.Context, in *ListWorkersRequest, opts ...grpc.CallOption) (*ListWorkersResponse, error) {
+	out := new(ListWorkersResponse)
+	err := c.cc.Invoke(ctx, "/gitcollector.api.Control/ListWorkers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) ListFailures(ctx context.Context, in *ListFailuresRequest, opts ...grpc.CallOption) (*ListFailuresResponse, error) {
+	out := new(ListFailuresResponse)
+	err := c.cc.Invoke(ctx, "/gitcollector.api.Control/ListFailures", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) SubmitJobs(ctx context.Context, in *SubmitJobsRequest, opts ...grpc.CallOption) (*SubmitJobsResponse, error) {
+	out := new(SubmitJobsResponse)
+	err := c.cc.Invoke(ctx, "/gitcollector.api.Control/SubmitJobs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) WatchJobs(ctx context.Context, in *WatchJobsRequest, opts ...grpc.CallOption) (Control_WatchJobsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Control_serviceDesc.Streams[0], "/gitcollector.api.Control/WatchJobs", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &controlWatchJobsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Control_WatchJobsClient interface {
+	Recv() (*JobEvent, error)
+	grpc.ClientStream
+}
+
+type controlWatchJobsClient struct {
+	grpc.ClientStream
+}
+
+func (x *controlWatchJobsClient) Recv() (*JobEvent, error) {
+	m := new(JobEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *controlClient) ListRepositories(ctx context.Context, in *ListRepositoriesRequest, opts ...grpc.CallOption) (Control_ListRepositoriesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Control_serviceDesc.Streams[1], "/gitcollector.api.Control/ListRepositories", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &controlListRepositoriesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Control_ListRepositoriesClient interface {
+	Recv() (*Repository, error)
+	grpc.ClientStream
+}
+
+type controlListRepositoriesClient struct {
+	grpc.ClientStream
+}
+
+func (x *controlListRepositoriesClient) Recv() (*Repository, error) {
+	m := new(Repository)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *controlClient) Rediscover(ctx context.Context, in *RediscoverRequest, opts ...grpc.CallOption) (*RediscoverResponse, error) {
+	out := new(RediscoverResponse)
+	err := c.cc.Invoke(ctx, "/gitcollector.api.Control/Rediscover", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ControlServer is the server API for Control service.
+type ControlServer interface {
+	// GetStatus returns the status of the worker pool.
+	GetStatus(context.Context, *GetStatusRequest) (*Status, error)
+	// SetWorkers changes the number of workers of the pool.
+	SetWorkers(context.Context, *SetWorkersRequest) (*Status, error)
+	// Pause stops starting new jobs, the running ones finish.
+	Pause(context.Context, *PauseRequest) (*Status, error)
+	// Resume starts processing jobs again after a Pause.
+	Resume(context.Context, *ResumeRequest) (*Status, error)
+	// ListWorkers returns the activity of the workers.
+	ListWorkers(context.Context, *ListWorkersRequest) (*ListWorkersResponse, error)
+	// ListFailures returns the recent failed jobs, the newest first.
+	ListFailures(context.Context, *ListFailuresRequest) (*ListFailuresResponse, error)
+	// SubmitJobs enqueues the download of repositories.
+	SubmitJobs(context.Context, *SubmitJobsRequest) (*SubmitJobsResponse, error)
+	// WatchJobs streams the lifecycle events of the jobs until the client
+	// cancels it or the collection finishes.
+	WatchJobs(*WatchJobsRequest, Control_WatchJobsServer) error
+	// ListRepositories streams the repositories stored in the library.
+	ListRepositories(*ListRepositoriesRequest, Control_ListRepositoriesServer) error
+	// Rediscover discovers the repositories of an organization again,
+	// enqueuing them along with the rest of the jobs.
+	Rediscover(context.Context, *RediscoverRequest) (*RediscoverResponse, error)
+}
+
+// UnimplementedControlServer can be embedded to have forward compatible implementations.
+type UnimplementedControlServer struct {
+}
+
+func (*UnimplementedControlServer) GetStatus(ctx context.Context, req *GetStatusRequest) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (*UnimplementedControlServer) SetWorkers(ctx context.Context, req *SetWorkersRequest) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetWorkers not implemented")
+}
+func (*UnimplementedControlServer) Pause(ctx context.Context, req *PauseRequest) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pause not implemented")
+}
+func (*UnimplementedControlServer) Resume(ctx context.Context, req *ResumeRequest) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Resume not implemented")
+}
+func (*UnimplementedControlServer) ListWorkers(ctx context.Context, req *ListWorkersRequest) (*ListWorkersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWorkers not implemented")
+}
+func (*UnimplementedControlServer) ListFailures(ctx context.Context, req *ListFailuresRequest) (*ListFailuresResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFailures not implemented")
+}
+func (*UnimplementedControlServer) SubmitJobs(ctx context.Context, req *SubmitJobsRequest) (*SubmitJobsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitJobs not implemented")
+}
+func (*UnimplementedControlServer) WatchJobs(req *WatchJobsRequest, srv Control_WatchJobsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchJobs not implemented")
+}
+func (*UnimplementedControlServer) ListRepositories(req *ListRepositoriesRequest, srv Control_ListRepositoriesServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListRepositories not implemented")
+}
+func (*UnimplementedControlServer) Rediscover(ctx context.Context, req *RediscoverRequest) (*RediscoverResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rediscover not implemented")
+}
+
+func RegisterControlServer(s *grpc.Server, srv ControlServer) {
+	s.RegisterService(&_Control_serviceDesc, srv)
+}
+
+func _Control_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gitcollector.api.Control/GetStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_SetWorkers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetWorkersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).SetWorkers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gitcollector.api.Control/SetWorkers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).SetWorkers(ctx, req.(*SetWorkersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_Pause_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Pause(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gitcollector.api.Control/Pause",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Pause(ctx, req.(*PauseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_Resume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResumeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Resume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gitcollector.api.Control/Resume",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Resume(ctx, req.(*ResumeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_ListWorkers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWorkersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).ListWorkers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gitcollector.api.Control/ListWorkers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).ListWorkers(ctx, req.(*ListWorkersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_ListFailures_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFailuresRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).ListFailures(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gitcollector.api.Control/ListFailures",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).ListFailures(ctx, req.(*ListFailuresRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_SubmitJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitJobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).SubmitJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gitcollector.api.Control/SubmitJobs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).SubmitJobs(ctx, req.(*SubmitJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_WatchJobs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchJobsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ControlServer).WatchJobs(m, &controlWatchJobsServer{stream})
+}
+
+type Control_WatchJobsServer interface {
+	Send(*JobEvent) error
+	grpc.ServerStream
+}
+
+type controlWatchJobsServer struct {
+	grpc.ServerStream
+}
+
+func (x *controlWatchJobsServer) Send(m *JobEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Control_ListRepositories_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRepositoriesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ControlServer).ListRepositories(m, &controlListRepositoriesServer{stream})
+}
+
+type Control_ListRepositoriesServer interface {
+	Send(*Repository) error
+	grpc.ServerStream
+}
+
+type controlListRepositoriesServer struct {
+	grpc.ServerStream
+}
+
+func (x *controlListRepositoriesServer) Send(m *Repository) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Control_Rediscover_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RediscoverRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Rediscover(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gitcollector.api.Control/Rediscover",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Rediscover(ctx, req.(*RediscoverRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Control_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "gitcollector.api.Control",
+	HandlerType: (*ControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStatus",
+			Handler:    _Control_GetStatus_Handler,
+		},
+		{
+			MethodName: "SetWorkers",
+			Handler:    _Control_SetWorkers_Handler,
+		},
+		{
+			MethodName: "Pause",
+			Handler:    _Control_Pause_Handler,
+		},
+		{
+			MethodName: "Resume",
+			Handler:    _Control_Resume_Handler,
+		},
+		{
+			MethodName: "ListWorkers",
+			Handler:    _Control_ListWorkers_Handler,
+		},
+		{
+			MethodName: "ListFailures",
+			Handler:    _Control_ListFailures_Handler,
+		},
+		{
+			MethodName: "SubmitJobs",
+			Handler:    _Control_SubmitJobs_Handler,
+		},
+		{
+			MethodName: "Rediscover",
+			Handler:    _Control_Rediscover_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchJobs",
+			Handler:       _Control_WatchJobs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListRepositories",
+			Handler:       _Control_ListRepositories_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "gitcollector.proto",
+}
@@ -0,0 +1,553 @@
+// Package api serves the Control gRPC service to inspect and control a running
+// collection from the orchestration tooling. It mirrors the admin HTTP API,
+// sharing its admin.Server, and also streams the lifecycle events of the jobs,
+// lists the repositories of the library and discovers organizations again.
+package api
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. gitcollector.proto
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/admin"
+	"github.com/src-d/gitcollector/discovery"
+	"github.com/src-d/gitcollector/export"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/src-d/go-borges"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// errLimit stops the listing of the repositories once the limit is reached.
+var errLimit = errors.NewKind("limit reached")
+
+// Discoverer discovers the organizations given to Rediscover, like a
+// discovery.AdhocProvider.
+type Discoverer interface {
+	// Discover starts the discovery of the organization in the
+	// background.
+	Discover(org string) error
+}
+
+// ServerOpts represents configuration options for a Server.
+type ServerOpts struct {
+	// Addr is the address the service is served at once the server is
+	// started, empty means it isn't served but it can still be registered
+	// in another grpc.Server.
+	Addr string
+	// Admin reports the status and the failures of the pool and receives
+	// the submitted jobs, shared with the admin HTTP API. Default to an
+	// admin.Server without failures nor jobs.
+	Admin *admin.Server
+	// Events is the gitcollector.JobEventBus of the pool streamed by
+	// WatchJobs, nil means it's unavailable.
+	Events *gitcollector.JobEventBus
+	// EventsBuffer is the number of events buffered for every WatchJobs
+	// stream, the ones not fitting are dropped instead of holding the
+	// pool. Default to 1000.
+	EventsBuffer int
+	// Discoverer receives the organizations given to Rediscover, nil
+	// means they're rejected.
+	Discoverer Discoverer
+	// Library is listed by ListRepositories, nil means it's unavailable.
+	Library borges.Library
+	// LibraryOpts are the options of the listing of the Library.
+	LibraryOpts *export.LibraryOpts
+	// Log is the logger used to report the failures serving the service,
+	// default to log.New(nil).
+	Log log.Logger
+}
+
+const eventsBuffer = 1000
+
+// Server implements the ControlServer of a gitcollector.WorkerPool.
+type Server struct {
+	UnimplementedControlServer
+
+	wp       *gitcollector.WorkerPool
+	opts     *ServerOpts
+	ownAdmin bool
+
+	listener net.Listener
+	server   *grpc.Server
+}
+
+var _ ControlServer = (*Server)(nil)
+
+// NewServer builds a new Server of the given pool. The address, if any, is
+// listened on right away so a wrong one is reported before the collection
+// starts.
+func NewServer(
+	wp *gitcollector.WorkerPool,
+	opts *ServerOpts,
+) (*Server, error) {
+	if opts == nil {
+		opts = &ServerOpts{}
+	}
+
+	if opts.EventsBuffer <= 0 {
+		opts.EventsBuffer = eventsBuffer
+	}
+
+	if opts.LibraryOpts == nil {
+		opts.LibraryOpts = &export.LibraryOpts{}
+	}
+
+	if opts.Log == nil {
+		opts.Log = log.New(nil)
+	}
+
+	s := &Server{wp: wp, opts: opts}
+	if opts.Admin == nil {
+		adm, err := admin.NewServer(wp, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.Admin, s.ownAdmin = adm, true
+	}
+
+	s.server = grpc.NewServer()
+	RegisterControlServer(s.server, s)
+	if opts.Addr == "" {
+		return s, nil
+	}
+
+	listener, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s.listener = listener
+	return s, nil
+}
+
+// Start serves the service in the background if the server has an address.
+func (s *Server) Start() {
+	if s.listener == nil {
+		return
+	}
+
+	go func() {
+		err := s.server.Serve(s.listener)
+		if err != nil && err != grpc.ErrServerStopped {
+			s.opts.Log.Errorf(err, "couldn't serve the grpc api")
+		}
+	}()
+}
+
+// Close stops serving the service, the streams are canceled.
+func (s *Server) Close() error {
+	s.server.Stop()
+	if s.ownAdmin {
+		return s.opts.Admin.Close()
+	}
+
+	return nil
+}
+
+// GetStatus implements the ControlServer interface.
+func (s *Server) GetStatus(
+	context.Context,
+	*GetStatusRequest,
+) (*Status, error) {
+	return s.status(), nil
+}
+
+// SetWorkers implements the ControlServer interface.
+func (s *Server) SetWorkers(
+	_ context.Context,
+	req *SetWorkersRequest,
+) (*Status, error) {
+	if req.Workers < 0 {
+		return nil, status.Error(codes.InvalidArgument,
+			admin.ErrWrongRequest.New("workers can't be negative").Error())
+	}
+
+	s.wp.SetWorkers(int(req.Workers))
+	return s.status(), nil
+}
+
+// Pause implements the ControlServer interface.
+func (s *Server) Pause(context.Context, *PauseRequest) (*Status, error) {
+	s.wp.Pause()
+	return s.status(), nil
+}
+
+// Resume implements the ControlServer interface.
+func (s *Server) Resume(context.Context, *ResumeRequest) (*Status, error) {
+	s.wp.Resume()
+	return s.status(), nil
+}
+
+func (s *Server) status() *Status {
+	st := s.opts.Admin.Status()
+	res := &Status{
+		Queued:  int32(st.Queued),
+		Delayed: int32(st.Delayed),
+		Workers: int32(st.Workers),
+		Busy:    int32(st.Busy),
+		Paused:  st.Paused,
+		Failed:  int32(st.Failed),
+	}
+
+	for _, p := range st.Providers {
+		provider := &Provider{
+			Name:               p.Name,
+			Discovered:         int32(p.Discovered),
+			Cursor:             p.Cursor,
+			LastError:          p.LastError,
+			RateLimitRemaining: int32(p.RateLimitRemaining),
+			Done:               p.Done,
+		}
+
+		if p.LastErrorTime != nil {
+			provider.LastErrorTime = timestampProto(*p.LastErrorTime)
+		}
+
+		if p.RateLimitReset != nil {
+			provider.RateLimitReset = timestampProto(*p.RateLimitReset)
+		}
+
+		res.Providers = append(res.Providers, provider)
+	}
+
+	kinds := make([]string, 0, len(st.Latencies))
+	for kind := range st.Latencies {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	for _, kind := range kinds {
+		l := st.Latencies[kind]
+		res.Latencies = append(res.Latencies, &Latency{
+			Kind:  kind,
+			Count: int32(l.Count),
+			P50:   secondsProto(l.P50),
+			P90:   secondsProto(l.P90),
+			P99:   secondsProto(l.P99),
+			Max:   secondsProto(l.Max),
+		})
+	}
+
+	return res
+}
+
+// ListWorkers implements the ControlServer interface.
+func (s *Server) ListWorkers(
+	_ context.Context,
+	req *ListWorkersRequest,
+) (*ListWorkersResponse, error) {
+	res := &ListWorkersResponse{}
+	for _, hb := range s.wp.Heartbeats() {
+		if req.Busy && !hb.Busy {
+			continue
+		}
+
+		w := &Worker{
+			Worker:       hb.Worker,
+			Busy:         hb.Busy,
+			Job:          hb.Job,
+			LastActivity: timestampProto(hb.LastActivity),
+			Stuck:        hb.Stuck,
+		}
+
+		if hb.JobStarted != nil {
+			w.JobStarted = timestampProto(*hb.JobStarted)
+		}
+
+		res.Workers = append(res.Workers, w)
+	}
+
+	return res, nil
+}
+
+// ListFailures implements the ControlServer interface.
+func (s *Server) ListFailures(
+	context.Context,
+	*ListFailuresRequest,
+) (*ListFailuresResponse, error) {
+	res := &ListFailuresResponse{}
+	for _, f := range s.opts.Admin.Failures() {
+		res.Failures = append(res.Failures, &Failure{
+			Job:      f.Job,
+			Worker:   f.Worker,
+			Attempts: int32(f.Attempts),
+			Class:    string(f.Class),
+			Code:     int32(f.Code),
+			Error:    f.Error,
+			Elapsed: ptypes.DurationProto(
+				time.Duration(f.Elapsed * float64(time.Second)),
+			),
+			Failed: timestampProto(f.Failed),
+		})
+	}
+
+	return res, nil
+}
+
+// SubmitJobs implements the ControlServer interface. When only some of the
+// jobs are enqueued the error is returned with the number of them in the
+// enqueued-jobs metadata.
+func (s *Server) SubmitJobs(
+	ctx context.Context,
+	req *SubmitJobsRequest,
+) (*SubmitJobsResponse, error) {
+	n, err := s.opts.Admin.Enqueue(ctx, req.Urls)
+	if err != nil {
+		if n > 0 {
+			grpc.SetTrailer(ctx, enqueuedMD(n))
+		}
+
+		return nil, statusError(err)
+	}
+
+	return &SubmitJobsResponse{Enqueued: int32(n)}, nil
+}
+
+// WatchJobs implements the ControlServer interface. The events the client
+// doesn't keep up with are dropped, the number of them is reported by the
+// next one streamed.
+func (s *Server) WatchJobs(
+	req *WatchJobsRequest,
+	stream Control_WatchJobsServer,
+) error {
+	if s.opts.Events == nil {
+		return status.Error(codes.Unavailable, "job events not available")
+	}
+
+	types := map[JobEvent_Type]bool{}
+	for _, t := range req.Types {
+		types[t] = true
+	}
+
+	// the subscription is drained right away, so the pool isn't held by
+	// a slow client.
+	sub := s.opts.Events.Subscribe(0)
+	events := make(chan *JobEvent, s.opts.EventsBuffer)
+	go func() {
+		defer close(events)
+		var dropped uint64
+		for e := range sub.Events() {
+			event := jobEvent(e)
+			if len(types) > 0 && !types[event.Type] {
+				continue
+			}
+
+			event.Dropped = dropped
+			select {
+			case events <- event:
+				dropped = 0
+			default:
+				dropped++
+			}
+		}
+	}()
+
+	defer func() {
+		sub.Close()
+		for range events {
+		}
+	}()
+
+	// the headers tell the client the events are being watched.
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// ListRepositories implements the ControlServer interface.
+func (s *Server) ListRepositories(
+	req *ListRepositoriesRequest,
+	stream Control_ListRepositoriesServer,
+) error {
+	if s.opts.Library == nil {
+		return status.Error(codes.Unavailable, "library not available")
+	}
+
+	w := &repositoryStream{req: req, stream: stream}
+	_, err := export.Library(
+		stream.Context(), s.opts.Library, w, s.opts.LibraryOpts,
+	)
+
+	if err != nil && !errLimit.Is(err) {
+		return statusError(err)
+	}
+
+	return nil
+}
+
+// Rediscover implements the ControlServer interface.
+func (s *Server) Rediscover(
+	_ context.Context,
+	req *RediscoverRequest,
+) (*RediscoverResponse, error) {
+	if s.opts.Discoverer == nil {
+		return nil, status.Error(codes.FailedPrecondition,
+			discovery.ErrDiscoveryDisabled.New().Error())
+	}
+
+	if err := s.opts.Discoverer.Discover(req.Org); err != nil {
+		return nil, statusError(err)
+	}
+
+	return &RediscoverResponse{}, nil
+}
+
+// repositoryStream is an export.RepositoryWriter sending the repositories
+// matching the request.
+type repositoryStream struct {
+	req    *ListRepositoriesRequest
+	stream Control_ListRepositoriesServer
+	sent   int32
+}
+
+var _ export.RepositoryWriter = (*repositoryStream)(nil)
+
+func (w *repositoryStream) Write(r *export.Repository) error {
+	if w.req.Limit > 0 && w.sent >= w.req.Limit {
+		return errLimit.New()
+	}
+
+	if w.req.Endpoint != "" && !matchEndpoint(r.Endpoints, w.req.Endpoint) {
+		return nil
+	}
+
+	w.sent++
+	repo := &Repository{
+		Location:   r.Location,
+		Id:         r.ID,
+		Endpoints:  r.Endpoints,
+		References: r.References,
+		Size:       r.Size,
+	}
+
+	if !r.Updated.IsZero() {
+		repo.Updated = timestampProto(r.Updated)
+	}
+
+	return w.stream.Send(repo)
+}
+
+func (w *repositoryStream) Close() error {
+	return nil
+}
+
+func matchEndpoint(endpoints []string, filter string) bool {
+	for _, ep := range endpoints {
+		if strings.Contains(ep, filter) {
+			return true
+		}
+	}
+
+	return false
+}
+
+var eventTypes = map[gitcollector.JobEventType]JobEvent_Type{
+	gitcollector.JobEnqueued:  JobEvent_ENQUEUED,
+	gitcollector.JobStarted:   JobEvent_STARTED,
+	gitcollector.JobRetried:   JobEvent_RETRIED,
+	gitcollector.JobSucceeded: JobEvent_SUCCEEDED,
+	gitcollector.JobFailed:    JobEvent_FAILED,
+}
+
+func jobEvent(e *gitcollector.JobEvent) *JobEvent {
+	event := &JobEvent{
+		Type:    eventTypes[e.Type],
+		Job:     admin.JobDescription(e.Job),
+		Worker:  e.Worker,
+		Attempt: int32(e.Attempt),
+		Time:    timestampProto(e.Time),
+	}
+
+	if e.Err != nil {
+		event.Error = e.Err.Error()
+	}
+
+	if e.Backoff > 0 {
+		event.Backoff = ptypes.DurationProto(e.Backoff)
+	}
+
+	if r := e.Result; r != nil {
+		event.Elapsed = ptypes.DurationProto(r.Elapsed)
+		event.BytesFetched = r.BytesFetched
+		event.ObjectsPacked = r.ObjectsPacked
+		if f := r.Failure; f != nil {
+			event.Error = f.Err.Error()
+			event.Class = string(f.Class)
+			event.Code = int32(f.Code)
+		}
+	}
+
+	return event
+}
+
+// enqueuedMD returns the metadata with the number of jobs enqueued by a
+// failed SubmitJobs.
+func enqueuedMD(n int) metadata.MD {
+	return metadata.Pairs("enqueued-jobs", strconv.Itoa(n))
+}
+
+// statusError returns the gRPC status of the given error.
+func statusError(err error) error {
+	code := codes.Internal
+	switch {
+	case admin.ErrJobsDisabled.Is(err),
+		discovery.ErrDiscoveryDisabled.Is(err):
+		code = codes.FailedPrecondition
+	case admin.ErrWrongRequest.Is(err),
+		discovery.ErrEndpointsNotFound.Is(err):
+		code = codes.InvalidArgument
+	case discovery.ErrDiscoveryRunning.Is(err):
+		code = codes.AlreadyExists
+	case gitcollector.ErrProviderStopped.Is(err):
+		code = codes.Unavailable
+	case err == context.Canceled:
+		code = codes.Canceled
+	case err == context.DeadlineExceeded:
+		code = codes.DeadlineExceeded
+	}
+
+	return status.Error(code, err.Error())
+}
+
+func secondsProto(seconds float64) *duration.Duration {
+	return ptypes.DurationProto(time.Duration(seconds * float64(time.Second)))
+}
+
+func timestampProto(t time.Time) *timestamp.Timestamp {
+	ts, err := ptypes.TimestampProto(t)
+	if err != nil {
+		return nil
+	}
+
+	return ts
+}
@@ -0,0 +1,350 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/admin"
+	"github.com/src-d/gitcollector/discovery"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+type testJob struct {
+	id      string
+	process func(context.Context) error
+}
+
+func (j *testJob) Process(ctx context.Context) error {
+	return j.process(ctx)
+}
+
+func (j *testJob) String() string {
+	return j.id
+}
+
+type testEnqueuer struct {
+	urls []string
+}
+
+func (e *testEnqueuer) Enqueue(_ context.Context, url string) error {
+	if url == "stopped" {
+		return gitcollector.ErrProviderStopped.New()
+	}
+
+	e.urls = append(e.urls, url)
+	return nil
+}
+
+type testProvider gitcollector.ProviderState
+
+func (p *testProvider) Status() gitcollector.ProviderState {
+	return gitcollector.ProviderState(*p)
+}
+
+type testDiscoverer struct {
+	orgs []string
+}
+
+func (d *testDiscoverer) Discover(org string) error {
+	for _, o := range d.orgs {
+		if o == org {
+			return discovery.ErrDiscoveryRunning.New(org)
+		}
+	}
+
+	d.orgs = append(d.orgs, org)
+	return nil
+}
+
+func TestServer(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan gitcollector.Job, 5)
+	bus := gitcollector.NewJobEventBus()
+	wp := gitcollector.NewWorkerPool(
+		func(ctx context.Context) (gitcollector.Job, error) {
+			select {
+			case job, ok := <-queue:
+				if !ok {
+					return nil, gitcollector.ErrJobSource.New()
+				}
+
+				return job, nil
+			case <-ctx.Done():
+				return nil, gitcollector.ErrNewJobsNotFound.New()
+			}
+		},
+		&gitcollector.WorkerPoolOpts{
+			Events:         bus,
+			WaitJobTimeout: 50 * time.Millisecond,
+		},
+	)
+
+	enqueuer := &testEnqueuer{}
+	adm, err := admin.NewServer(wp, &admin.ServerOpts{
+		Events:   bus,
+		Enqueuer: enqueuer,
+	})
+	require.NoError(err)
+
+	discoverer := &testDiscoverer{}
+	s, err := NewServer(wp, &ServerOpts{
+		Addr:       "127.0.0.1:0",
+		Admin:      adm,
+		Events:     bus,
+		Discoverer: discoverer,
+	})
+	require.NoError(err)
+	s.Start()
+
+	client, conn := dial(t, s)
+	defer conn.Close()
+	ctx := context.Background()
+
+	wp.SetWorkers(1)
+	wp.Run()
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watch, err := client.WatchJobs(watchCtx, &WatchJobsRequest{
+		Types: []JobEvent_Type{JobEvent_SUCCEEDED, JobEvent_FAILED},
+	})
+	require.NoError(err)
+	// the stream is subscribed once its headers are received
+	_, err = watch.Header()
+	require.NoError(err)
+
+	queue <- &testJob{id: "job-ok", process: func(context.Context) error {
+		return nil
+	}}
+	queue <- &testJob{id: "job-ko", process: func(context.Context) error {
+		return fmt.Errorf("foo")
+	}}
+
+	event, err := watch.Recv()
+	require.NoError(err)
+	require.Equal(JobEvent_SUCCEEDED, event.Type)
+	require.Equal("job-ok", event.Job)
+	require.NotEmpty(event.Worker)
+
+	event, err = watch.Recv()
+	require.NoError(err)
+	require.Equal(JobEvent_FAILED, event.Type)
+	require.Equal("job-ko", event.Job)
+	require.Equal("foo", event.Error)
+	require.Equal(string(gitcollector.ErrorClassUnknown), event.Class)
+	require.Zero(event.Dropped)
+	cancel()
+
+	var st *Status
+	deadline := time.Now().Add(5 * time.Second)
+	// the workers are idle once the failure is reported
+	for (st == nil || st.Failed < 1 || st.Busy > 0) &&
+		time.Now().Before(deadline) {
+		st, err = client.GetStatus(ctx, &GetStatusRequest{})
+		require.NoError(err)
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the succeeded and failed jobs are timed
+	require.Len(st.Latencies, 1)
+	require.Equal("unknown", st.Latencies[0].Kind)
+	require.Equal(int32(2), st.Latencies[0].Count)
+	require.NotNil(st.Latencies[0].P99)
+	st.Latencies = nil
+	require.Equal(&Status{Workers: 1, Failed: 1}, st)
+
+	adm.WatchProviders(&testProvider{
+		Name:               "github:src-d",
+		Discovered:         3,
+		LastError:          fmt.Errorf("bar"),
+		LastErrorTime:      time.Now(),
+		RateLimitRemaining: 10,
+	})
+	st, err = client.GetStatus(ctx, &GetStatusRequest{})
+	require.NoError(err)
+	require.Len(st.Providers, 1)
+	require.Equal("github:src-d", st.Providers[0].Name)
+	require.Equal(int32(3), st.Providers[0].Discovered)
+	require.Equal("bar", st.Providers[0].LastError)
+	require.NotNil(st.Providers[0].LastErrorTime)
+	require.Equal(int32(10), st.Providers[0].RateLimitRemaining)
+	require.Nil(st.Providers[0].RateLimitReset)
+
+	failures, err := client.ListFailures(ctx, &ListFailuresRequest{})
+	require.NoError(err)
+	require.Len(failures.Failures, 1)
+	require.Equal("job-ko", failures.Failures[0].Job)
+	require.Equal(int32(1), failures.Failures[0].Attempts)
+
+	st, err = client.Pause(ctx, &PauseRequest{})
+	require.NoError(err)
+	require.True(st.Paused)
+	require.True(wp.Paused())
+
+	st, err = client.Resume(ctx, &ResumeRequest{})
+	require.NoError(err)
+	require.False(st.Paused)
+
+	st, err = client.SetWorkers(ctx, &SetWorkersRequest{Workers: 3})
+	require.NoError(err)
+	require.Equal(int32(3), st.Workers)
+	require.Equal(3, wp.Size())
+
+	_, err = client.SetWorkers(ctx, &SetWorkersRequest{Workers: -1})
+	require.Equal(codes.InvalidArgument, status.Code(err))
+
+	workers, err := client.ListWorkers(ctx, &ListWorkersRequest{})
+	require.NoError(err)
+	require.Len(workers.Workers, 3)
+	workers, err = client.ListWorkers(ctx, &ListWorkersRequest{Busy: true})
+	require.NoError(err)
+	require.Empty(workers.Workers)
+
+	// the ad-hoc jobs
+	res, err := client.SubmitJobs(ctx, &SubmitJobsRequest{
+		Urls: []string{"https://github.com/a/a", "https://github.com/b/b"},
+	})
+	require.NoError(err)
+	require.Equal(int32(2), res.Enqueued)
+	require.Equal([]string{
+		"https://github.com/a/a", "https://github.com/b/b",
+	}, enqueuer.urls)
+
+	var trailer metadata.MD
+	_, err = client.SubmitJobs(ctx, &SubmitJobsRequest{
+		Urls: []string{"https://github.com/c/c", "stopped"},
+	}, grpc.Trailer(&trailer))
+	require.Equal(codes.Unavailable, status.Code(err))
+	require.Equal([]string{"1"}, trailer["enqueued-jobs"])
+
+	_, err = client.SubmitJobs(ctx, &SubmitJobsRequest{})
+	require.Equal(codes.InvalidArgument, status.Code(err))
+
+	// the organizations discovered again
+	_, err = client.Rediscover(ctx, &RediscoverRequest{Org: "src-d"})
+	require.NoError(err)
+	require.Equal([]string{"src-d"}, discoverer.orgs)
+	_, err = client.Rediscover(ctx, &RediscoverRequest{Org: "src-d"})
+	require.Equal(codes.AlreadyExists, status.Code(err))
+
+	// the library isn't available
+	repos, err := client.ListRepositories(ctx, &ListRepositoriesRequest{})
+	require.NoError(err)
+	_, err = repos.Recv()
+	require.Equal(codes.Unavailable, status.Code(err))
+
+	close(queue)
+	wp.Wait()
+	bus.Close()
+	require.NoError(s.Close())
+	require.NoError(adm.Close())
+}
+
+func TestServerDisabled(t *testing.T) {
+	var require = require.New(t)
+
+	wp := gitcollector.NewWorkerPool(nil, &gitcollector.WorkerPoolOpts{})
+	s, err := NewServer(wp, &ServerOpts{Addr: "127.0.0.1:0"})
+	require.NoError(err)
+	s.Start()
+
+	client, conn := dial(t, s)
+	defer conn.Close()
+	ctx := context.Background()
+
+	st, err := client.GetStatus(ctx, &GetStatusRequest{})
+	require.NoError(err)
+	require.Equal(&Status{}, st)
+
+	_, err = client.SubmitJobs(ctx, &SubmitJobsRequest{
+		Urls: []string{"https://github.com/a/a"},
+	})
+	require.Equal(codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.Rediscover(ctx, &RediscoverRequest{Org: "src-d"})
+	require.Equal(codes.FailedPrecondition, status.Code(err))
+
+	watch, err := client.WatchJobs(ctx, &WatchJobsRequest{})
+	require.NoError(err)
+	_, err = watch.Recv()
+	require.Equal(codes.Unavailable, status.Code(err))
+
+	require.NoError(s.Close())
+
+	_, err = NewServer(wp, &ServerOpts{Addr: "wrong address"})
+	require.Error(err)
+}
+
+func TestServerListRepositories(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	lib, err := siva.NewLibrary("test", fs, siva.LibraryOptions{
+		Transactional: true,
+		TempFS:        memfs.New(),
+	})
+	require.NoError(err)
+
+	for _, name := range []string{"foo", "bar", "baz"} {
+		loc, err := lib.AddLocation(borges.LocationID(name))
+		require.NoError(err)
+
+		r, err := loc.Init(borges.RepositoryID("github.com/src-d/" + name))
+		require.NoError(err)
+		require.NoError(r.Commit())
+	}
+
+	wp := gitcollector.NewWorkerPool(nil, &gitcollector.WorkerPoolOpts{})
+	s, err := NewServer(wp, &ServerOpts{Addr: "127.0.0.1:0", Library: lib})
+	require.NoError(err)
+	s.Start()
+	defer s.Close()
+
+	client, conn := dial(t, s)
+	defer conn.Close()
+	list := func(req *ListRepositoriesRequest) []string {
+		stream, err := client.ListRepositories(context.Background(), req)
+		require.NoError(err)
+
+		var ids []string
+		for {
+			repo, err := stream.Recv()
+			if err == io.EOF {
+				return ids
+			}
+
+			require.NoError(err)
+			require.Equal("github.com/src-d/"+repo.Location, repo.Id)
+			ids = append(ids, repo.Id)
+		}
+	}
+
+	require.Len(list(&ListRepositoriesRequest{}), 3)
+	require.Len(list(&ListRepositoriesRequest{Limit: 2}), 2)
+	require.Equal([]string{"github.com/src-d/bar"},
+		list(&ListRepositoriesRequest{Endpoint: "src-d/bar"}))
+	require.Empty(list(&ListRepositoriesRequest{Endpoint: "missing"}))
+}
+
+func dial(t *testing.T, s *Server) (ControlClient, *grpc.ClientConn) {
+	conn, err := grpc.Dial(
+		s.listener.Addr().String(),
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+	)
+	require.NoError(t, err)
+
+	return NewControlClient(conn), conn
+}
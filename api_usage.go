@@ -0,0 +1,197 @@
+package gitcollector
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// API request categories given by APICategory.
+const (
+	APICategoryRepos      = "repos"
+	APICategoryStarred    = "starred"
+	APICategoryOrgs       = "orgs"
+	APICategoryGraphQL    = "graphql"
+	APICategoryRepository = "repository"
+	APICategoryContents   = "contents"
+	APICategoryReadme     = "readme"
+	APICategoryOther      = "other"
+)
+
+// APIRequests is the number of API requests of a category made by a provider.
+type APIRequests struct {
+	Provider string `json:"provider"`
+	Category string `json:"category"`
+	Requests int    `json:"requests"`
+	// Failed is the number of requests without a response or answered
+	// with an error status, the rate limited ones included.
+	Failed int `json:"failed,omitempty"`
+}
+
+// APIUsage accounts the API requests made by every provider during a run, by
+// endpoint category, so the campaigns can be planned within the token quotas
+// and the anomalies, like pagination storms, detected. It only counts the
+// requests, the RateLimiter is the one limiting them. A nil APIUsage doesn't
+// count anything.
+type APIUsage struct {
+	mu       sync.Mutex
+	requests map[[2]string]*APIRequests
+	// remaining holds the rate limit remaining reported by the last
+	// response to every provider.
+	remaining map[string]int
+}
+
+// NewAPIUsage builds a new APIUsage.
+func NewAPIUsage() *APIUsage {
+	return &APIUsage{
+		requests:  map[[2]string]*APIRequests{},
+		remaining: map[string]int{},
+	}
+}
+
+// Record counts a request of the category made by the provider.
+func (u *APIUsage) Record(provider, category string, failed bool) {
+	if u == nil {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key := [2]string{provider, category}
+	r, ok := u.requests[key]
+	if !ok {
+		r = &APIRequests{Provider: provider, Category: category}
+		u.requests[key] = r
+	}
+
+	r.Requests++
+	if failed {
+		r.Failed++
+	}
+}
+
+// Requests returns a snapshot of the requests counted sorted by provider and
+// category.
+func (u *APIUsage) Requests() []APIRequests {
+	if u == nil {
+		return nil
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	requests := make([]APIRequests, 0, len(u.requests))
+	for _, r := range u.requests {
+		requests = append(requests, *r)
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].Provider != requests[j].Provider {
+			return requests[i].Provider < requests[j].Provider
+		}
+
+		return requests[i].Category < requests[j].Category
+	})
+
+	return requests
+}
+
+// RateLimitRemaining records the rate limit remaining reported to the
+// provider.
+func (u *APIUsage) RateLimitRemaining(provider string, remaining int) {
+	if u == nil {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.remaining[provider] = remaining
+}
+
+// RateLimits returns the rate limit remaining reported by the last response
+// to every provider, if it was reported.
+func (u *APIUsage) RateLimits() map[string]int {
+	if u == nil {
+		return nil
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	limits := make(map[string]int, len(u.remaining))
+	for provider, remaining := range u.remaining {
+		limits[provider] = remaining
+	}
+
+	return limits
+}
+
+// Transport wraps the given http.RoundTripper counting the requests made
+// through it as made by the provider, along with the rate limit remaining
+// reported by the responses. A nil RoundTripper is the
+// http.DefaultTransport.
+func (u *APIUsage) Transport(
+	provider string,
+	next http.RoundTripper,
+) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	if u == nil {
+		return next
+	}
+
+	return &apiUsageTransport{usage: u, provider: provider, next: next}
+}
+
+const rateLimitRemainingHeader = "X-RateLimit-Remaining"
+
+type apiUsageTransport struct {
+	usage    *APIUsage
+	provider string
+	next     http.RoundTripper
+}
+
+func (t *apiUsageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.next.RoundTrip(req)
+	failed := err != nil || res.StatusCode >= 400
+	t.usage.Record(t.provider, APICategory(req.URL.Path), failed)
+	if err == nil {
+		header := res.Header.Get(rateLimitRemainingHeader)
+		if remaining, err := strconv.Atoi(header); err == nil {
+			t.usage.RateLimitRemaining(t.provider, remaining)
+		}
+	}
+
+	return res, err
+}
+
+// APICategory returns the category of the github API endpoint with the given
+// path. The prefixes of the enterprise servers API are ignored.
+func APICategory(path string) string {
+	path = strings.TrimPrefix(path, "/api/v3")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case parts[len(parts)-1] == "graphql":
+		return APICategoryGraphQL
+	case parts[len(parts)-1] == "starred":
+		return APICategoryStarred
+	case parts[0] == "orgs" && len(parts) == 3 && parts[2] == "repos":
+		return APICategoryRepos
+	case parts[0] == "user" && len(parts) == 2 && parts[1] == "orgs":
+		return APICategoryOrgs
+	case parts[0] == "repos" && len(parts) == 3:
+		return APICategoryRepository
+	case parts[0] == "repos" && len(parts) > 3 && parts[3] == "contents":
+		return APICategoryContents
+	case parts[0] == "repos" && len(parts) == 4 && parts[3] == "readme":
+		return APICategoryReadme
+	}
+
+	return APICategoryOther
+}
@@ -0,0 +1,71 @@
+package gitcollector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIUsage(t *testing.T) {
+	var require = require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/repos/src-d/gitcollector/readme" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			w.Header().Set("X-RateLimit-Remaining", r.URL.Query().Get("page"))
+		},
+	))
+	defer server.Close()
+
+	usage := NewAPIUsage()
+	client := &http.Client{Transport: usage.Transport("github:src-d", nil)}
+	for _, path := range []string{
+		"/orgs/src-d/repos",
+		"/orgs/src-d/repos?page=2",
+		"/repos/src-d/gitcollector/readme",
+	} {
+		res, err := client.Get(server.URL + path)
+		require.NoError(err)
+		res.Body.Close()
+	}
+
+	usage.Record("metadata", APICategoryRepository, false)
+	require.Equal([]APIRequests{
+		{Provider: "github:src-d", Category: APICategoryReadme, Requests: 1, Failed: 1},
+		{Provider: "github:src-d", Category: APICategoryRepos, Requests: 2},
+		{Provider: "metadata", Category: APICategoryRepository, Requests: 1},
+	}, usage.Requests())
+	require.Equal(map[string]int{"github:src-d": 2}, usage.RateLimits())
+
+	var nilUsage *APIUsage
+	nilUsage.Record("github:src-d", APICategoryRepos, false)
+	require.Nil(nilUsage.Requests())
+	require.Nil(nilUsage.RateLimits())
+	require.Equal(http.DefaultTransport, nilUsage.Transport("github:src-d", nil))
+}
+
+func TestAPICategory(t *testing.T) {
+	var require = require.New(t)
+
+	for path, category := range map[string]string{
+		"/orgs/src-d/repos":         APICategoryRepos,
+		"/api/v3/orgs/src-d/repos":  APICategoryRepos,
+		"/users/jfontan/starred":    APICategoryStarred,
+		"/user/starred":             APICategoryStarred,
+		"/user/orgs":                APICategoryOrgs,
+		"/api/graphql":              APICategoryGraphQL,
+		"/graphql":                  APICategoryGraphQL,
+		"/repos/src-d/gitcollector": APICategoryRepository,
+		"/repos/src-d/gitcollector/contents/go.mod": APICategoryContents,
+		"/repos/src-d/gitcollector/readme":          APICategoryReadme,
+		"/rate_limit":                               APICategoryOther,
+	} {
+		require.Equal(category, APICategory(path), path)
+	}
+}
@@ -0,0 +1,41 @@
+// Package auth provides library.AuthProvider implementations to fetch from
+// code hosts requiring authentication schemes other than static tokens, like
+// OAuth2 refresh tokens, AWS SigV4 signatures or SSH keys.
+package auth
+
+import (
+	"context"
+
+	"github.com/src-d/gitcollector/library"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// Hosts is a library.AuthProvider choosing the AuthProvider by the host of
+// the endpoints. The provider with an empty host is used for the hosts not
+// found, they're fetched without authentication if there isn't one.
+type Hosts map[string]library.AuthProvider
+
+var _ library.AuthProvider = Hosts(nil)
+
+// Auth implements the library.AuthProvider interface.
+func (h Hosts) Auth(
+	ctx context.Context,
+	endpoint string,
+) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, ok := h[ep.Host]
+	if !ok {
+		provider, ok = h[""]
+	}
+
+	if !ok || provider == nil {
+		return nil, nil
+	}
+
+	return provider.Auth(ctx, endpoint)
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+func TestHosts(t *testing.T) {
+	var require = require.New(t)
+
+	provider := func(user string) library.AuthProvider {
+		return library.AuthFn(func(
+			context.Context,
+			string,
+		) (transport.AuthMethod, error) {
+			return &http.BasicAuth{Username: user}, nil
+		})
+	}
+
+	hosts := Hosts{"github.com": provider("github")}
+
+	auth, err := hosts.Auth(context.Background(), "https://github.com/a/b")
+	require.NoError(err)
+	require.Equal("github", auth.(*http.BasicAuth).Username)
+
+	auth, err = hosts.Auth(context.Background(), "git@github.com:a/b.git")
+	require.NoError(err)
+	require.Equal("github", auth.(*http.BasicAuth).Username)
+
+	auth, err = hosts.Auth(context.Background(), "https://gitlab.com/a/b")
+	require.NoError(err)
+	require.Nil(auth)
+
+	hosts[""] = provider("default")
+	auth, err = hosts.Auth(context.Background(), "https://gitlab.com/a/b")
+	require.NoError(err)
+	require.Equal("default", auth.(*http.BasicAuth).Username)
+}
+
+func TestSSH(t *testing.T) {
+	var require = require.New(t)
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(err)
+
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(err)
+
+	s := NewSSH(StaticSigner(signer), &SSHOpts{
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+
+	auth, err := s.Auth(context.Background(), "git@github.com:a/b.git")
+	require.NoError(err)
+
+	keys, ok := auth.(*gitssh.PublicKeys)
+	require.True(ok)
+	require.Equal("git", keys.User)
+	require.Equal(signer, keys.Signer)
+	require.NotNil(keys.HostKeyCallback)
+}
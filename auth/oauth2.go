@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/src-d/gitcollector/library"
+
+	"golang.org/x/oauth2"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+// OAuth2Opts represents configuration options for the OAuth2 authentication.
+type OAuth2Opts struct {
+	// Username is sent along with the access tokens, default to oauth2.
+	// Some hosts require a specific one, like x-token-auth for Bitbucket.
+	Username string
+}
+
+const defaultOAuth2Username = "oauth2"
+
+// OAuth2 is a library.AuthProvider authenticating with the access tokens of
+// an oauth2.TokenSource, they're refreshed once they expire.
+type OAuth2 struct {
+	src      oauth2.TokenSource
+	username string
+}
+
+var _ library.AuthProvider = (*OAuth2)(nil)
+
+// NewOAuth2 builds a new OAuth2 using the tokens of the given source.
+func NewOAuth2(src oauth2.TokenSource, opts *OAuth2Opts) *OAuth2 {
+	if opts == nil {
+		opts = &OAuth2Opts{}
+	}
+
+	username := opts.Username
+	if username == "" {
+		username = defaultOAuth2Username
+	}
+
+	return &OAuth2{
+		src:      oauth2.ReuseTokenSource(nil, src),
+		username: username,
+	}
+}
+
+// NewOAuth2Refresh builds a new OAuth2 getting the access tokens from the
+// token endpoint of the given configuration with a refresh token.
+func NewOAuth2Refresh(
+	cfg *oauth2.Config,
+	refreshToken string,
+	opts *OAuth2Opts,
+) *OAuth2 {
+	src := cfg.TokenSource(
+		context.Background(),
+		&oauth2.Token{RefreshToken: refreshToken},
+	)
+
+	return NewOAuth2(src, opts)
+}
+
+// Auth implements the library.AuthProvider interface.
+func (o *OAuth2) Auth(
+	_ context.Context,
+	_ string,
+) (transport.AuthMethod, error) {
+	token, err := o.src.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.BasicAuth{
+		Username: o.username,
+		Password: token.AccessToken,
+	}, nil
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+type testTokenSource struct {
+	refreshes int
+	expiry    time.Time
+}
+
+func (s *testTokenSource) Token() (*oauth2.Token, error) {
+	s.refreshes++
+	return &oauth2.Token{
+		AccessToken: fmt.Sprintf("token-%d", s.refreshes),
+		Expiry:      s.expiry,
+	}, nil
+}
+
+func TestOAuth2(t *testing.T) {
+	var require = require.New(t)
+
+	src := &testTokenSource{expiry: time.Now().Add(time.Hour)}
+	o := NewOAuth2(src, &OAuth2Opts{Username: "x-token-auth"})
+
+	for i := 0; i < 3; i++ {
+		auth, err := o.Auth(context.Background(), "https://example.com/a")
+		require.NoError(err)
+
+		basic, ok := auth.(*http.BasicAuth)
+		require.True(ok)
+		require.Equal("x-token-auth", basic.Username)
+		require.Equal("token-1", basic.Password)
+	}
+
+	require.Equal(1, src.refreshes)
+}
+
+func TestOAuth2Refresh(t *testing.T) {
+	var require = require.New(t)
+
+	src := &testTokenSource{expiry: time.Now().Add(-time.Hour)}
+	o := NewOAuth2(src, nil)
+
+	auth, err := o.Auth(context.Background(), "https://example.com/a")
+	require.NoError(err)
+	require.Equal("oauth2", auth.(*http.BasicAuth).Username)
+	require.Equal("token-1", auth.(*http.BasicAuth).Password)
+
+	auth, err = o.Auth(context.Background(), "https://example.com/a")
+	require.NoError(err)
+	require.Equal("token-2", auth.(*http.BasicAuth).Password)
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/src-d/gitcollector/library"
+
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+var (
+	// ErrCredentialsNotFound is returned when there are no AWS credentials
+	// to sign the requests.
+	ErrCredentialsNotFound = errors.NewKind("AWS credentials not found")
+
+	// ErrRegionNotFound is returned when the AWS region of an endpoint
+	// can't be found.
+	ErrRegionNotFound = errors.NewKind("AWS region not found for %s")
+)
+
+// AWSCredentials are the AWS credentials used to sign the requests.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is only set for temporary credentials.
+	SessionToken string
+}
+
+// AWSCredentialsFn retrieves the AWS credentials, it's called before every
+// fetch so temporary credentials can be renewed.
+type AWSCredentialsFn func(context.Context) (*AWSCredentials, error)
+
+// StaticAWSCredentials is an AWSCredentialsFn always returning the given
+// credentials.
+func StaticAWSCredentials(creds *AWSCredentials) AWSCredentialsFn {
+	return func(context.Context) (*AWSCredentials, error) {
+		return creds, nil
+	}
+}
+
+// EnvAWSCredentials is an AWSCredentialsFn reading the credentials from the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment
+// variables.
+func EnvAWSCredentials(context.Context) (*AWSCredentials, error) {
+	creds := &AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, ErrCredentialsNotFound.New()
+	}
+
+	return creds, nil
+}
+
+// SigV4Opts represents configuration options for the SigV4 authentication.
+type SigV4Opts struct {
+	// Credentials retrieves the credentials signing the requests, default
+	// to EnvAWSCredentials.
+	Credentials AWSCredentialsFn
+	// Region is the AWS region of the endpoints, by default it's taken
+	// from hosts like git-codecommit.<region>.amazonaws.com.
+	Region string
+	// Service is the name of the signed AWS service, default to
+	// codecommit.
+	Service string
+	// Now returns the signing time, default to time.Now.
+	Now func() time.Time
+}
+
+const (
+	defaultSigV4Service = "codecommit"
+	sigV4Algorithm      = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat     = "20060102T150405"
+	sigV4DateFormat     = "20060102"
+
+	codeCommitHostPrefix = "git-codecommit."
+)
+
+// SigV4 is a library.AuthProvider signing the git requests with AWS
+// signature version 4 the way AWS CodeCommit expects. The signatures are
+// short lived so a new one is made for every fetch.
+type SigV4 struct {
+	creds   AWSCredentialsFn
+	region  string
+	service string
+	now     func() time.Time
+}
+
+var _ library.AuthProvider = (*SigV4)(nil)
+
+// NewSigV4 builds a new SigV4.
+func NewSigV4(opts *SigV4Opts) *SigV4 {
+	if opts == nil {
+		opts = &SigV4Opts{}
+	}
+
+	s := &SigV4{
+		creds:   opts.Credentials,
+		region:  opts.Region,
+		service: opts.Service,
+		now:     opts.Now,
+	}
+
+	if s.creds == nil {
+		s.creds = EnvAWSCredentials
+	}
+
+	if s.service == "" {
+		s.service = defaultSigV4Service
+	}
+
+	if s.now == nil {
+		s.now = time.Now
+	}
+
+	return s
+}
+
+// Auth implements the library.AuthProvider interface.
+func (s *SigV4) Auth(
+	ctx context.Context,
+	endpoint string,
+) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	region := s.region
+	if region == "" {
+		region = hostRegion(ep.Host)
+	}
+
+	if region == "" {
+		return nil, ErrRegionNotFound.New(endpoint)
+	}
+
+	creds, err := s.creds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if creds == nil {
+		return nil, ErrCredentialsNotFound.New()
+	}
+
+	username := creds.AccessKeyID
+	if creds.SessionToken != "" {
+		username += "%" + creds.SessionToken
+	}
+
+	return &http.BasicAuth{
+		Username: username,
+		Password: s.sign(creds, region, ep.Host, ep.Path),
+	}, nil
+}
+
+// sign returns the password for the request to the given path, made of the
+// signing time and the signature of the request.
+func (s *SigV4) sign(
+	creds *AWSCredentials,
+	region, host, path string,
+) string {
+	now := s.now().UTC()
+	timestamp := now.Format(sigV4TimeFormat)
+	date := now.Format(sigV4DateFormat)
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, s.service)
+
+	request := fmt.Sprintf("GIT\n%s\n\nhost:%s\n\nhost\n", path, host)
+	hash := sha256.Sum256([]byte(request))
+	toSign := strings.Join([]string{
+		sigV4Algorithm,
+		timestamp,
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, region, s.service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	return timestamp + "Z" + hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// hostRegion returns the region of AWS CodeCommit hosts, an empty string
+// for any other host.
+func hostRegion(host string) string {
+	if !strings.HasPrefix(host, codeCommitHostPrefix) {
+		return ""
+	}
+
+	parts := strings.Split(host, ".")
+	if len(parts) < 3 {
+		return ""
+	}
+
+	return parts[1]
+}
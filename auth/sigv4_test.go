@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+const codeCommitEndpoint = "https://git-codecommit.eu-west-1.amazonaws.com/v1/repos/gitcollector"
+
+func TestSigV4(t *testing.T) {
+	var require = require.New(t)
+
+	now := time.Date(2019, 10, 14, 12, 0, 0, 0, time.UTC)
+	s := NewSigV4(&SigV4Opts{
+		Credentials: StaticAWSCredentials(&AWSCredentials{
+			AccessKeyID:     "key",
+			SecretAccessKey: "secret",
+		}),
+		Now: func() time.Time { return now },
+	})
+
+	auth, err := s.Auth(context.Background(), codeCommitEndpoint)
+	require.NoError(err)
+
+	basic, ok := auth.(*http.BasicAuth)
+	require.True(ok)
+	require.Equal("key", basic.Username)
+	require.Equal(
+		"20191014T120000Zb83ef71c559ff6d0cd258e994d0d7e2a0377"+
+			"03916b1052d24ef4a19c5328848c",
+		basic.Password,
+	)
+
+	now = now.Add(time.Minute)
+	auth, err = s.Auth(context.Background(), codeCommitEndpoint)
+	require.NoError(err)
+	require.NotEqual(basic.Password, auth.(*http.BasicAuth).Password)
+}
+
+func TestSigV4SessionToken(t *testing.T) {
+	var require = require.New(t)
+
+	s := NewSigV4(&SigV4Opts{
+		Credentials: StaticAWSCredentials(&AWSCredentials{
+			AccessKeyID:     "key",
+			SecretAccessKey: "secret",
+			SessionToken:    "session",
+		}),
+	})
+
+	auth, err := s.Auth(context.Background(), codeCommitEndpoint)
+	require.NoError(err)
+	require.Equal("key%session", auth.(*http.BasicAuth).Username)
+}
+
+func TestSigV4Region(t *testing.T) {
+	var require = require.New(t)
+
+	creds := StaticAWSCredentials(&AWSCredentials{
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+	})
+
+	s := NewSigV4(&SigV4Opts{Credentials: creds})
+	_, err := s.Auth(context.Background(), "https://git.example.com/repo")
+	require.True(ErrRegionNotFound.Is(err))
+
+	s = NewSigV4(&SigV4Opts{Credentials: creds, Region: "us-east-1"})
+	_, err = s.Auth(context.Background(), "https://git.example.com/repo")
+	require.NoError(err)
+
+	require.Equal("eu-west-1",
+		hostRegion("git-codecommit.eu-west-1.amazonaws.com"))
+	require.Equal("", hostRegion("github.com"))
+}
+
+func TestSigV4NoCredentials(t *testing.T) {
+	var require = require.New(t)
+
+	s := NewSigV4(&SigV4Opts{
+		Credentials: func(context.Context) (*AWSCredentials, error) {
+			return nil, nil
+		},
+	})
+
+	_, err := s.Auth(context.Background(), codeCommitEndpoint)
+	require.True(ErrCredentialsNotFound.Is(err))
+}
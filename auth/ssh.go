@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/src-d/gitcollector/library"
+
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+// SignerFn retrieves the ssh.Signer to authenticate the fetches of an
+// endpoint, like one holding a short lived certificate.
+type SignerFn func(ctx context.Context, endpoint string) (ssh.Signer, error)
+
+// StaticSigner is a SignerFn always returning the given ssh.Signer.
+func StaticSigner(signer ssh.Signer) SignerFn {
+	return func(context.Context, string) (ssh.Signer, error) {
+		return signer, nil
+	}
+}
+
+// SSHOpts represents configuration options for the SSH authentication.
+type SSHOpts struct {
+	// User is the SSH user, default to git.
+	User string
+	// HostKeyCallback verifies the keys of the hosts, default to the
+	// known_hosts files of the user.
+	HostKeyCallback ssh.HostKeyCallback
+}
+
+const defaultSSHUser = "git"
+
+// SSH is a library.AuthProvider authenticating with the keys of a SignerFn.
+type SSH struct {
+	signer   SignerFn
+	user     string
+	callback ssh.HostKeyCallback
+}
+
+var _ library.AuthProvider = (*SSH)(nil)
+
+// NewSSH builds a new SSH using the signers of the given SignerFn.
+func NewSSH(signer SignerFn, opts *SSHOpts) *SSH {
+	if opts == nil {
+		opts = &SSHOpts{}
+	}
+
+	user := opts.User
+	if user == "" {
+		user = defaultSSHUser
+	}
+
+	return &SSH{
+		signer:   signer,
+		user:     user,
+		callback: opts.HostKeyCallback,
+	}
+}
+
+// Auth implements the library.AuthProvider interface.
+func (s *SSH) Auth(
+	ctx context.Context,
+	endpoint string,
+) (transport.AuthMethod, error) {
+	signer, err := s.signer(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gitssh.PublicKeys{
+		User:   s.user,
+		Signer: signer,
+		HostKeyCallbackHelper: gitssh.HostKeyCallbackHelper{
+			HostKeyCallback: s.callback,
+		},
+	}, nil
+}
@@ -0,0 +1,290 @@
+// Package benchmark measures the performance of the scheduling and the
+// processing of jobs using the synthetic repositories of the simulation
+// package, so performance changes can be validated without network access.
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/downloader"
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/metrics"
+	"github.com/src-d/gitcollector/simulation"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+const (
+	// Scheduler is the name of the benchmark processing no-op jobs, it
+	// measures the overhead of the scheduling.
+	Scheduler = "scheduler"
+	// EndToEnd is the name of the benchmark downloading synthetic
+	// repositories into a library.
+	EndToEnd = "end_to_end"
+)
+
+// Opts represents configuration options for the benchmarks.
+type Opts struct {
+	// Workers is the number of workers processing the jobs, default to
+	// GOMAXPROCS.
+	Workers int
+	// Jobs is the number of no-op jobs of the Scheduler benchmark,
+	// default to 10000.
+	Jobs int
+	// Orgs are the organizations the jobs are spread over, default to
+	// a, b, c and d.
+	Orgs []string
+	// QueueSize is the capacity of the channel the jobs are sent to, like
+	// the one fed by the providers, default to 100.
+	QueueSize int
+	// Simulation configures the synthetic repositories of the EndToEnd
+	// benchmark, its organizations are overridden by Orgs.
+	Simulation *simulation.Opts
+	// LibFS and TempFS are the filesystems of the library and the
+	// temporal files of the EndToEnd benchmark, default to memory ones.
+	LibFS  billy.Filesystem
+	TempFS billy.Filesystem
+	// Logger is given to the jobs, default to one only logging errors.
+	Logger log.Logger
+}
+
+const (
+	defaultJobs      = 10000
+	defaultQueueSize = 100
+)
+
+var defaultOrgs = []string{"a", "b", "c", "d"}
+
+func (o *Opts) defaults() (*Opts, error) {
+	opts := Opts{}
+	if o != nil {
+		opts = *o
+	}
+
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(-1)
+	}
+
+	if opts.Jobs <= 0 {
+		opts.Jobs = defaultJobs
+	}
+
+	if len(opts.Orgs) == 0 {
+		opts.Orgs = defaultOrgs
+	}
+
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+
+	if opts.Logger == nil {
+		f := &log.LoggerFactory{Level: log.ErrorLevel}
+		logger, err := f.New(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.Logger = logger
+	}
+
+	return &opts, nil
+}
+
+// Result holds the measures of a benchmark.
+type Result struct {
+	Name          string        `json:"name"`
+	Jobs          int           `json:"jobs"`
+	Failed        int           `json:"failed"`
+	Elapsed       time.Duration `json:"elapsed"`
+	JobsPerSecond float64       `json:"jobs_per_second"`
+	// QueueP50 and QueueP99 are the percentiles of the time the jobs
+	// wait since they're queued until they're processed.
+	QueueP50 time.Duration `json:"queue_p50"`
+	QueueP99 time.Duration `json:"queue_p99"`
+}
+
+// String implements the fmt.Stringer interface.
+func (r *Result) String() string {
+	return fmt.Sprintf(
+		"%s: %d jobs (%d failed) in %s, %.1f jobs/s, queue p50 %s p99 %s",
+		r.Name, r.Jobs, r.Failed, r.Elapsed, r.JobsPerSecond,
+		r.QueueP50, r.QueueP99,
+	)
+}
+
+// Run runs all the benchmarks.
+func Run(ctx context.Context, opts *Opts) ([]*Result, error) {
+	var results []*Result
+	for _, bench := range []func(context.Context, *Opts) (*Result, error){
+		RunScheduler,
+		RunEndToEnd,
+	} {
+		res, err := bench(ctx, opts)
+		if err != nil {
+			return results, err
+		}
+
+		results = append(results, res)
+	}
+
+	return results, nil
+}
+
+// RunScheduler runs the Scheduler benchmark.
+func RunScheduler(ctx context.Context, o *Opts) (*Result, error) {
+	opts, err := o.defaults()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*library.Job, opts.Jobs)
+	for i := range jobs {
+		org := opts.Orgs[i%len(opts.Orgs)]
+		jobs[i] = &library.Job{
+			Type: library.JobDownload,
+			Endpoints: []string{fmt.Sprintf(
+				"%s://%s/%s/job-%d", simulation.Scheme,
+				simulation.Host, org, i,
+			)},
+		}
+	}
+
+	noop := func(context.Context, *library.Job) error { return nil }
+	return run(ctx, Scheduler, jobs, nil, memfs.New(), noop, opts)
+}
+
+// RunEndToEnd runs the EndToEnd benchmark.
+func RunEndToEnd(ctx context.Context, o *Opts) (*Result, error) {
+	opts, err := o.defaults()
+	if err != nil {
+		return nil, err
+	}
+
+	simOpts := simulation.Opts{}
+	if opts.Simulation != nil {
+		simOpts = *opts.Simulation
+	}
+
+	simOpts.Orgs = opts.Orgs
+	sim := simulation.New(&simOpts)
+	sim.Install()
+	defer simulation.Uninstall()
+
+	libFS, temp := opts.LibFS, opts.TempFS
+	if libFS == nil {
+		libFS = memfs.New()
+	}
+
+	if temp == nil {
+		temp = memfs.New()
+	}
+
+	lib, err := siva.NewLibrary("benchmark", libFS, siva.LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+		TempFS:        temp,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*library.Job
+	for _, r := range sim.Repositories() {
+		jobs = append(jobs, &library.Job{
+			Type:      library.JobDownload,
+			Endpoints: []string{r.Endpoint()},
+		})
+	}
+
+	return run(ctx, EndToEnd, jobs, lib, temp, downloader.Download, opts)
+}
+
+// run processes the jobs with a WorkerPool scheduling them the same way the
+// download command does.
+func run(
+	ctx context.Context,
+	name string,
+	jobs []*library.Job,
+	lib borges.Library,
+	temp billy.Filesystem,
+	fn library.JobFn,
+	opts *Opts,
+) (*Result, error) {
+	var (
+		mu       sync.Mutex
+		enqueued = make(map[string]time.Time, len(jobs))
+		latency  = metrics.NewLatencyTracker(&metrics.LatencyOpts{
+			Window:     24 * time.Hour,
+			MaxSamples: len(jobs),
+		})
+	)
+
+	timed := func(ctx context.Context, job *library.Job) error {
+		mu.Lock()
+		queued := enqueued[job.Endpoints[0]]
+		mu.Unlock()
+
+		latency.Observe(name, time.Since(queued))
+		return fn(ctx, job)
+	}
+
+	download := make(chan gitcollector.Job, opts.QueueSize)
+	schedule := library.NewDownloadJobScheduleFn(
+		lib, download, timed, false, nil, opts.Logger, temp,
+	)
+
+	if len(opts.Orgs) > 1 {
+		schedule = gitcollector.NewFairScheduleFn(
+			schedule,
+			&gitcollector.FairScheduleOpts{Key: library.OrgJobKey},
+		)
+	}
+
+	wp := gitcollector.NewWorkerPool(schedule, &gitcollector.WorkerPoolOpts{
+		NotWaitNewJobs: true,
+	})
+	wp.SetWorkers(opts.Workers)
+
+	start := time.Now()
+	wp.RunContext(ctx)
+	go func() {
+		defer close(download)
+		for _, job := range jobs {
+			mu.Lock()
+			enqueued[job.Endpoints[0]] = time.Now()
+			mu.Unlock()
+
+			select {
+			case download <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	res := &Result{Name: name, Jobs: len(jobs)}
+	if err := wp.WaitError(); err != nil {
+		runErr, ok := err.(*gitcollector.RunError)
+		if !ok || runErr.Context != nil || len(runErr.Providers) > 0 {
+			return nil, err
+		}
+
+		res.Failed = runErr.Failed
+	}
+
+	res.Elapsed = time.Since(start)
+	res.JobsPerSecond = float64(len(jobs)) / res.Elapsed.Seconds()
+
+	p := latency.Percentiles(name)
+	res.QueueP50, res.QueueP99 = p.P50, p.P99
+	return res, nil
+}
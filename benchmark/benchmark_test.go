@@ -0,0 +1,91 @@
+package benchmark
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector/simulation"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	var require = require.New(t)
+
+	results, err := Run(context.Background(), &Opts{
+		Jobs:       500,
+		Simulation: &simulation.Opts{Repos: 5, Forks: 0.5},
+	})
+	require.NoError(err)
+	require.Len(results, 2)
+
+	require.Equal(Scheduler, results[0].Name)
+	require.Equal(500, results[0].Jobs)
+	require.Equal(EndToEnd, results[1].Name)
+	require.Equal(20, results[1].Jobs)
+
+	for _, r := range results {
+		require.Zero(r.Failed)
+		require.True(r.JobsPerSecond > 0)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(WriteResults(&buf, results))
+	read, err := ReadResults(&buf)
+	require.NoError(err)
+	require.Equal(results, read)
+}
+
+func TestCompare(t *testing.T) {
+	var require = require.New(t)
+
+	baseline := []*Result{
+		{Name: "a", JobsPerSecond: 100, QueueP99: time.Second},
+		{Name: "b", JobsPerSecond: 100, QueueP99: time.Second},
+	}
+
+	current := []*Result{
+		{Name: "a", JobsPerSecond: 95, QueueP99: 1050 * time.Millisecond},
+		{Name: "b", JobsPerSecond: 80, QueueP99: 2 * time.Second},
+		{Name: "c", JobsPerSecond: 1},
+	}
+
+	regressions := Compare(baseline, current, 0.1)
+	require.Len(regressions, 2)
+	require.Equal("b", regressions[0].Name)
+	require.Equal("jobs_per_second", regressions[0].Measure)
+	require.Equal("queue_p99", regressions[1].Measure)
+}
+
+func BenchmarkScheduler(b *testing.B) {
+	benchmark(b, RunScheduler, &Opts{Jobs: 1000})
+}
+
+func BenchmarkEndToEnd(b *testing.B) {
+	benchmark(b, RunEndToEnd, &Opts{
+		Simulation: &simulation.Opts{Repos: 25, Forks: 0.2},
+	})
+}
+
+func benchmark(
+	b *testing.B,
+	fn func(context.Context, *Opts) (*Result, error),
+	opts *Opts,
+) {
+	var jobs, rate float64
+	for i := 0; i < b.N; i++ {
+		res, err := fn(context.Background(), opts)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		jobs += float64(res.Jobs)
+		rate += res.JobsPerSecond
+		b.ReportMetric(float64(res.QueueP99.Microseconds()), "queue_p99_us")
+	}
+
+	b.ReportMetric(rate/float64(b.N), "jobs/s")
+	b.ReportMetric(jobs/float64(b.N), "jobs/op")
+}
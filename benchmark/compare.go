@@ -0,0 +1,80 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Regression is a measure of a benchmark worse than the baseline one beyond
+// the tolerance.
+type Regression struct {
+	Name     string
+	Measure  string
+	Baseline float64
+	Current  float64
+}
+
+// String implements the fmt.Stringer interface.
+func (r *Regression) String() string {
+	return fmt.Sprintf("%s %s: %.2f, baseline %.2f",
+		r.Name, r.Measure, r.Current, r.Baseline)
+}
+
+// Compare returns the regressions of the current results over the baseline
+// ones. A tolerance of 0.1 allows the measures to be up to a 10% worse. The
+// benchmarks missing in either of them are ignored.
+func Compare(baseline, current []*Result, tolerance float64) []*Regression {
+	base := make(map[string]*Result, len(baseline))
+	for _, r := range baseline {
+		base[r.Name] = r
+	}
+
+	var regressions []*Regression
+	for _, cur := range current {
+		b, ok := base[cur.Name]
+		if !ok {
+			continue
+		}
+
+		// higher is better
+		if cur.JobsPerSecond < b.JobsPerSecond*(1-tolerance) {
+			regressions = append(regressions, &Regression{
+				Name:     cur.Name,
+				Measure:  "jobs_per_second",
+				Baseline: b.JobsPerSecond,
+				Current:  cur.JobsPerSecond,
+			})
+		}
+
+		// lower is better
+		if b.QueueP99 > 0 &&
+			float64(cur.QueueP99) > float64(b.QueueP99)*(1+tolerance) {
+			regressions = append(regressions, &Regression{
+				Name:     cur.Name,
+				Measure:  "queue_p99",
+				Baseline: b.QueueP99.Seconds(),
+				Current:  cur.QueueP99.Seconds(),
+			})
+		}
+	}
+
+	return regressions
+}
+
+// ReadResults decodes results written by WriteResults.
+func ReadResults(r io.Reader) ([]*Result, error) {
+	var results []*Result
+	if err := json.NewDecoder(r).Decode(&results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// WriteResults encodes the results as JSON, to be used as a baseline.
+func WriteResults(w io.Writer, results []*Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
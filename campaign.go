@@ -0,0 +1,279 @@
+package gitcollector
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrPhaseFailed is returned when a phase of a campaign fails, the
+	// following phases aren't run.
+	ErrPhaseFailed = errors.NewKind("campaign phase %s failed: %s")
+
+	// ErrCampaignState is returned when the state file of a campaign
+	// belongs to a different campaign.
+	ErrCampaignState = errors.NewKind(
+		"state file %s belongs to the campaign %q")
+)
+
+// Settings are the options of a campaign phase by name, like the long name of
+// a command line flag without dashes.
+type Settings map[string]interface{}
+
+// Phase is one of the ordered stages of a Campaign, like the discovery of an
+// organization, the backfill of another one or the continuous updates of the
+// library.
+type Phase struct {
+	// Name identifies the phase in the campaign.
+	Name string `json:"name"`
+	// Settings of the phase, they take precedence over the defaults of
+	// the campaign.
+	Settings Settings `json:"settings,omitempty"`
+	// Every repeats the phase with the given interval, as a Go duration
+	// like 6h, until the campaign is stopped. Only the last phase can be
+	// repeated.
+	Every string `json:"every,omitempty"`
+
+	every time.Duration
+}
+
+// Interval returns the time between the runs of a repeated phase, 0 if the
+// phase runs once.
+func (p *Phase) Interval() time.Duration {
+	return p.every
+}
+
+// Campaign is a collection defined as ordered phases with their own settings,
+// run one after another.
+type Campaign struct {
+	// Name identifies the campaign in its state file.
+	Name string `json:"name"`
+	// Defaults are the settings shared by every phase.
+	Defaults Settings `json:"defaults,omitempty"`
+	// Phases are run in order, each one once the previous one finished.
+	Phases []*Phase `json:"phases"`
+}
+
+// LoadCampaign reads and validates the campaign defined in the given JSON file.
+func LoadCampaign(path string) (*Campaign, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Campaign
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// Validate checks the definition of the campaign, all the problems found are
+// returned at once as a ConfigError.
+func (c *Campaign) Validate() error {
+	var cerr ConfigError
+	if len(c.Phases) == 0 {
+		cerr.Add("phases", "the campaign doesn't have any phase")
+	}
+
+	names := map[string]bool{}
+	for i, p := range c.Phases {
+		field := "phases." + p.Name
+		switch {
+		case p.Name == "":
+			cerr.Add("phases", "phase %d doesn't have a name", i+1)
+		case names[p.Name]:
+			cerr.Add(field, "duplicated phase name")
+		}
+
+		names[p.Name] = true
+
+		if p.Every == "" {
+			continue
+		}
+
+		every, err := time.ParseDuration(p.Every)
+		switch {
+		case err != nil:
+			cerr.Add(field+".every", "%s", err)
+		case every <= 0:
+			cerr.Add(field+".every", "must be positive, got %s", p.Every)
+		case i != len(c.Phases)-1:
+			cerr.Add(field+".every", "only the last phase can be repeated")
+		}
+
+		p.every = every
+	}
+
+	return cerr.Err()
+}
+
+// Settings returns the settings of the given phase merged over the defaults of
+// the campaign.
+func (c *Campaign) Settings(p *Phase) Settings {
+	s := Settings{}
+	for k, v := range c.Defaults {
+		s[k] = v
+	}
+
+	for k, v := range p.Settings {
+		s[k] = v
+	}
+
+	return s
+}
+
+// PhaseFn runs a phase of a campaign with the given settings until it
+// finishes or the context is canceled.
+type PhaseFn func(ctx context.Context, p *Phase, s Settings) error
+
+// CampaignOpts represents configuration options for RunCampaign.
+type CampaignOpts struct {
+	// StatePath is the file where the finished phases are recorded, so a
+	// campaign run again resumes from the phase it was running. The
+	// campaign starts from the first phase every time by default.
+	StatePath string
+	// OnPhase is called at the start of every run of a phase.
+	OnPhase func(p *Phase, run int)
+}
+
+// CampaignState records the phases of a campaign already finished.
+type CampaignState struct {
+	Campaign string        `json:"campaign"`
+	Finished []PhaseRecord `json:"finished"`
+}
+
+// PhaseRecord describes a finished phase of a campaign.
+type PhaseRecord struct {
+	Name     string    `json:"name"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+// RunCampaign runs the phases of the campaign in order with the given PhaseFn.
+// A phase interrupted by the cancellation of the context isn't recorded as
+// finished, so it's run again when the campaign resumes. A repeated phase runs
+// until the context is canceled.
+func RunCampaign(
+	ctx context.Context,
+	c *Campaign,
+	fn PhaseFn,
+	opts *CampaignOpts,
+) error {
+	if opts == nil {
+		opts = &CampaignOpts{}
+	}
+
+	state, err := loadCampaignState(opts.StatePath, c.Name)
+	if err != nil {
+		return err
+	}
+
+	done := map[string]bool{}
+	for _, r := range state.Finished {
+		done[r.Name] = true
+	}
+
+	for _, p := range c.Phases {
+		if done[p.Name] {
+			continue
+		}
+
+		for run := 1; ; run++ {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			if opts.OnPhase != nil {
+				opts.OnPhase(p, run)
+			}
+
+			started := time.Now()
+			if err := fn(ctx, p, c.Settings(p)); err != nil {
+				return ErrPhaseFailed.New(p.Name, err)
+			}
+
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			if p.every <= 0 {
+				state.Finished = append(state.Finished, PhaseRecord{
+					Name:     p.Name,
+					Started:  started.UTC(),
+					Finished: time.Now().UTC(),
+				})
+
+				err := saveCampaignState(opts.StatePath, state)
+				if err != nil {
+					return err
+				}
+
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Until(started.Add(p.every))):
+			}
+		}
+	}
+
+	return nil
+}
+
+func loadCampaignState(path, name string) (*CampaignState, error) {
+	state := &CampaignState{Campaign: name}
+	if path == "" {
+		return state, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+
+	if state.Campaign != name {
+		return nil, ErrCampaignState.New(path, state.Campaign)
+	}
+
+	return state, nil
+}
+
+func saveCampaignState(path string, state *CampaignState) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// the state is written aside and renamed, so it's never truncated.
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
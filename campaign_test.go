@@ -0,0 +1,120 @@
+package gitcollector
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadCampaign(t *testing.T) {
+	var require = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "campaign.json")
+	require.NoError(ioutil.WriteFile(path, []byte(`{
+		"name": "test",
+		"defaults": {"library": "/lib", "workers": 4},
+		"phases": [
+			{"name": "discover", "settings": {"orgs": "a"}},
+			{"name": "backfill", "settings": {"orgs": "b", "backfill": true, "workers": 8}},
+			{"name": "updates", "every": "6h"}
+		]
+	}`), 0644))
+
+	c, err := LoadCampaign(path)
+	require.NoError(err)
+	require.Len(c.Phases, 3)
+	require.Zero(c.Phases[0].Interval())
+	require.Equal(6*time.Hour, c.Phases[2].Interval())
+	require.Equal(Settings{
+		"library":  "/lib",
+		"workers":  float64(8),
+		"orgs":     "b",
+		"backfill": true,
+	}, c.Settings(c.Phases[1]))
+	require.Equal(Settings{
+		"library": "/lib",
+		"workers": float64(4),
+	}, c.Settings(c.Phases[2]))
+
+	c = &Campaign{Phases: []*Phase{
+		{Name: "a", Every: "1h"},
+		{Name: "a", Every: "foo"},
+		{Every: "-1h"},
+	}}
+	err = c.Validate()
+	require.Error(err)
+	require.Len(err.(*ConfigError).Problems, 5)
+
+	require.Error((&Campaign{}).Validate())
+}
+
+func TestRunCampaign(t *testing.T) {
+	var require = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	c := &Campaign{
+		Name:     "test",
+		Defaults: Settings{"workers": 1},
+		Phases: []*Phase{
+			{Name: "first"},
+			{Name: "second", Settings: Settings{"workers": 2}},
+			{Name: "third", Every: "10ms"},
+		},
+	}
+	require.NoError(c.Validate())
+
+	opts := &CampaignOpts{StatePath: filepath.Join(dir, "state.json")}
+
+	var runs []string
+	failing := "second"
+	fn := func(ctx context.Context, p *Phase, s Settings) error {
+		runs = append(runs, fmt.Sprintf("%s:%v", p.Name, s["workers"]))
+		if p.Name == failing {
+			return fmt.Errorf("foo")
+		}
+
+		return nil
+	}
+
+	err = RunCampaign(context.Background(), c, fn, opts)
+	require.True(ErrPhaseFailed.Is(err))
+	require.Equal([]string{"first:1", "second:2"}, runs)
+
+	// the campaign resumes from the failed phase and repeats the last one
+	// until it's canceled.
+	runs = nil
+	failing = ""
+	ctx, cancel := context.WithCancel(context.Background())
+	fn2 := func(ctx context.Context, p *Phase, s Settings) error {
+		if len(runs) == 3 {
+			cancel()
+		}
+
+		return fn(ctx, p, s)
+	}
+
+	require.NoError(RunCampaign(ctx, c, fn2, opts))
+	require.Equal([]string{"second:2", "third:1", "third:1", "third:1"}, runs)
+
+	data, err := ioutil.ReadFile(opts.StatePath)
+	require.NoError(err)
+	require.Contains(string(data), `"second"`)
+	require.NotContains(string(data), `"third"`)
+
+	c.Name = "other"
+	err = RunCampaign(context.Background(), c, fn, opts)
+	require.True(ErrCampaignState.Is(err))
+}
@@ -0,0 +1,133 @@
+// Command batch downloads into a siva library the repositories of a file with
+// a repository URL per line, or of the standard input. It's an example of a
+// batch collection built with the public API of gitcollector, the failed
+// repositories are reported once all of them are processed.
+//
+//	batch -library /path/to/repos -list repos.txt
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/discovery"
+	"github.com/src-d/gitcollector/downloader"
+	"github.com/src-d/gitcollector/internal/signals"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// queueSize is the capacity of the queue of the download jobs.
+const queueSize = 100
+
+func main() {
+	var (
+		path    = flag.String("library", "", "path where download to")
+		list    = flag.String("list", discovery.StdinList, "file with a repository URL per line, - for the standard input")
+		token   = flag.String("token", os.Getenv("GITHUB_TOKEN"), "github token")
+		tmp     = flag.String("tmp", os.TempDir(), "directory to place temporal files")
+		updates = flag.Bool("updates", false, "update the repositories already downloaded")
+		workers = flag.Int("workers", runtime.GOMAXPROCS(-1), "number of workers")
+	)
+
+	flag.Parse()
+	if *path == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	temp := osfs.New(*tmp)
+	lib, err := siva.NewLibrary("batch", osfs.New(*path), siva.LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+		TempFS:        temp,
+	})
+	if err != nil {
+		log.Errorf(err, "unable to open the library")
+		os.Exit(1)
+	}
+
+	err = batch(signals.InterruptContext(nil), lib, temp, &batchOpts{
+		List:    *list,
+		Stdin:   os.Stdin,
+		Token:   *token,
+		Updates: *updates,
+		Workers: *workers,
+	})
+	if err != nil {
+		log.Errorf(err, "batch download failed")
+		os.Exit(1)
+	}
+
+	log.Infof("batch download finished")
+}
+
+// batchOpts represents configuration options for batch.
+type batchOpts struct {
+	// List is the path of the list, discovery.StdinList to read Stdin.
+	List  string
+	Stdin io.Reader
+	// Token authenticates the downloads of all the repositories.
+	Token string
+	// Updates allows to update the repositories already downloaded.
+	Updates bool
+	Workers int
+}
+
+// batch downloads the repositories of the list into the library, returning a
+// gitcollector.RunError if any of them failed.
+func batch(
+	ctx context.Context,
+	lib borges.Library,
+	temp billy.Filesystem,
+	opts *batchOpts,
+) error {
+	download := make(chan gitcollector.Job, queueSize)
+	schedule := library.NewDownloadJobScheduleFn(
+		lib,
+		download,
+		downloader.Download,
+		opts.Updates,
+		nil,
+		log.New(nil),
+		temp,
+	)
+
+	// the tokens are given by organization, the same one is used for all
+	// the repositories of the list instead.
+	schedule = library.WithJobSetup(schedule, func(job *library.Job) error {
+		job.AuthToken = func(string) string { return opts.Token }
+		return nil
+	})
+
+	wp := gitcollector.NewWorkerPool(schedule, &gitcollector.WorkerPoolOpts{})
+	wp.SetWorkers(opts.Workers)
+	wp.RunContext(ctx)
+
+	provider := discovery.NewListProvider(
+		opts.List,
+		download,
+		&discovery.ListProviderOpts{Stdin: opts.Stdin},
+	)
+
+	go func() {
+		// the workers finish once the queue is closed and emptied.
+		defer close(download)
+
+		err := gitcollector.StartProvider(ctx, provider)
+		if err != nil && !gitcollector.ErrProviderStopped.Is(err) {
+			wp.ProviderFailed(err)
+		}
+	}()
+
+	return wp.WaitError()
+}
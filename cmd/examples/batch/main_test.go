@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/discovery"
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/simulation"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestBatch(t *testing.T) {
+	var require = require.New(t)
+
+	sim := simulation.New(&simulation.Opts{Repos: 6, Seed: 11, Forks: 0.5})
+	sim.Install()
+	defer simulation.Uninstall()
+
+	var lines []string
+	for _, r := range sim.Repositories() {
+		lines = append(lines, r.Endpoint())
+	}
+
+	dir, err := ioutil.TempDir("", "batch")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	list := filepath.Join(dir, "repos.txt")
+	data := "# synthetic repositories\n" + strings.Join(lines, "\n")
+	require.NoError(ioutil.WriteFile(list, []byte(data), 0644))
+
+	lib := testLibrary(t)
+	require.NoError(batch(context.Background(), lib, memfs.New(), &batchOpts{
+		List:    list,
+		Workers: 2,
+	}))
+
+	for _, r := range sim.Repositories() {
+		id, err := library.NewRepositoryID(r.Endpoint())
+		require.NoError(err)
+
+		ok, _, _, err := lib.Has(id)
+		require.NoError(err)
+		require.True(ok, r.FullName())
+	}
+}
+
+func TestBatchFailed(t *testing.T) {
+	var require = require.New(t)
+
+	sim := simulation.New(&simulation.Opts{Repos: 2, Seed: 11})
+	sim.Install()
+	defer simulation.Uninstall()
+
+	stdin := strings.Join([]string{
+		sim.Repositories()[0].Endpoint(),
+		"sim://simulation/sim/missing",
+		sim.Repositories()[1].Endpoint(),
+	}, "\n")
+
+	lib := testLibrary(t)
+	err := batch(context.Background(), lib, memfs.New(), &batchOpts{
+		List:    discovery.StdinList,
+		Stdin:   strings.NewReader(stdin),
+		Workers: 1,
+	})
+	require.Error(err)
+
+	runErr, ok := err.(*gitcollector.RunError)
+	require.True(ok)
+	require.Equal(1, runErr.Failed)
+
+	for _, r := range sim.Repositories() {
+		id, err := library.NewRepositoryID(r.Endpoint())
+		require.NoError(err)
+
+		ok, _, _, err := lib.Has(id)
+		require.NoError(err)
+		require.True(ok, r.FullName())
+	}
+}
+
+func testLibrary(t *testing.T) borges.Library {
+	lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+	})
+	require.NoError(t, err)
+	return lib
+}
@@ -0,0 +1,110 @@
+// Command mirror downloads all the repositories of a github organization into
+// a siva library, updating the ones already downloaded. It's an example of a
+// collection built with the public API of gitcollector.
+//
+//	mirror -library /path/to/repos -org src-d -token $GITHUB_TOKEN
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"runtime"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/discovery"
+	"github.com/src-d/gitcollector/downloader"
+	"github.com/src-d/gitcollector/internal/signals"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// queueSize is the capacity of the queue of the download jobs.
+const queueSize = 100
+
+func main() {
+	var (
+		path    = flag.String("library", "", "path where download to")
+		org     = flag.String("org", "", "github organization to mirror")
+		token   = flag.String("token", os.Getenv("GITHUB_TOKEN"), "github token")
+		tmp     = flag.String("tmp", os.TempDir(), "directory to place temporal files")
+		workers = flag.Int("workers", runtime.GOMAXPROCS(-1), "number of workers")
+	)
+
+	flag.Parse()
+	if *path == "" || *org == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	temp := osfs.New(*tmp)
+	lib, err := siva.NewLibrary("mirror", osfs.New(*path), siva.LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+		TempFS:        temp,
+	})
+	if err != nil {
+		log.Errorf(err, "unable to open the library")
+		os.Exit(1)
+	}
+
+	iter := discovery.NewGHOrgReposIter(*org, &discovery.GHReposIterOpts{
+		AuthToken: *token,
+	})
+
+	tokens := map[string]string{*org: *token}
+	err = mirror(signals.InterruptContext(nil), lib, temp, iter, tokens, *workers)
+	if err != nil {
+		log.Errorf(err, "mirror of %s failed", *org)
+		os.Exit(1)
+	}
+
+	log.Infof("mirror of %s finished", *org)
+}
+
+// mirror downloads the repositories returned by the iterator into the
+// library until the iterator has no more of them or the context is done.
+func mirror(
+	ctx context.Context,
+	lib borges.Library,
+	temp billy.Filesystem,
+	iter discovery.GHRepositoriesIter,
+	tokens map[string]string,
+	workers int,
+) error {
+	download := make(chan gitcollector.Job, queueSize)
+	wp := gitcollector.NewWorkerPool(
+		library.NewDownloadJobScheduleFn(
+			lib,
+			download,
+			downloader.Download,
+			true,
+			tokens,
+			log.New(nil),
+			temp,
+		),
+		&gitcollector.WorkerPoolOpts{},
+	)
+
+	wp.SetWorkers(workers)
+	wp.RunContext(ctx)
+
+	provider := discovery.NewGHProvider(download, iter, nil)
+	go func() {
+		// the workers finish once the queue is closed and emptied.
+		defer close(download)
+
+		err := gitcollector.StartProvider(ctx, provider)
+		if err != nil && ctx.Err() == nil &&
+			!discovery.ErrNewRepositoriesNotFound.Is(err) {
+			wp.ProviderFailed(err)
+		}
+	}()
+
+	return wp.WaitError()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/simulation"
+
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestMirror(t *testing.T) {
+	var require = require.New(t)
+
+	sim := simulation.New(&simulation.Opts{
+		Orgs:  []string{"src-d", "bblfsh"},
+		Repos: 5,
+		Seed:  3,
+		Forks: 0.5,
+	})
+	sim.Install()
+	defer simulation.Uninstall()
+
+	lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+	})
+	require.NoError(err)
+
+	// mirroring twice updates the repositories already downloaded.
+	for i := 0; i < 2; i++ {
+		require.NoError(mirror(
+			context.Background(),
+			lib,
+			memfs.New(),
+			sim.OrgIter("src-d"),
+			nil,
+			2,
+		))
+	}
+
+	for _, r := range sim.Repositories() {
+		id, err := library.NewRepositoryID(r.Endpoint())
+		require.NoError(err)
+
+		ok, _, _, err := lib.Has(id)
+		require.NoError(err)
+		require.Equal(r.Org == "src-d", ok, r.FullName())
+	}
+}
+
+func TestMirrorCanceled(t *testing.T) {
+	var require = require.New(t)
+
+	sim := simulation.New(&simulation.Opts{Repos: 5})
+	sim.Install()
+	defer simulation.Uninstall()
+
+	lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+	})
+	require.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = mirror(ctx, lib, memfs.New(), sim.OrgIter("sim"), nil, 2)
+	require.Error(err)
+}
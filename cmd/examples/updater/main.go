@@ -0,0 +1,157 @@
+// Command updater is a daemon fetching periodically the changes of all the
+// repositories of a siva library, until it's interrupted. It's an example of a
+// continuous collection built with the public API of gitcollector.
+//
+//	updater -library /path/to/repos -interval 24h
+//
+// The updates can also follow cron expressions, overridden by organization:
+//
+//	updater -library /path/to/repos -schedule "0 3 * * *" -org-schedule "src-d=0 3 * * sun"
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/internal/signals"
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/updater"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// queueSize is the capacity of the queue of the update jobs.
+const queueSize = 100
+
+func main() {
+	var (
+		path     = flag.String("library", "", "path of the library to update")
+		token    = flag.String("token", os.Getenv("GITHUB_TOKEN"), "github token")
+		interval = flag.Duration("interval", 24*time.Hour, "time between updates of the library")
+		once     = flag.Bool("once", false, "update the library once and exit")
+		workers  = flag.Int("workers", runtime.GOMAXPROCS(-1), "number of workers")
+		schedule = flag.String("schedule", "", "cron expression of the updates instead of -interval, like \"0 3 * * *\"")
+		orgs     = orgSchedules{}
+	)
+
+	flag.Var(orgs, "org-schedule", "cron expression of the updates of an organization, as org=expression, it can be repeated")
+	flag.Parse()
+	if *path == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	lib, err := siva.NewLibrary("updater", osfs.New(*path), siva.LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+	})
+	if err != nil {
+		log.Errorf(err, "unable to open the library")
+		os.Exit(1)
+	}
+
+	opts := &updater.UpdatesProviderOpts{
+		TriggerOnce:     *once,
+		TriggerInterval: *interval,
+		OrgSchedules:    orgs,
+	}
+
+	if *schedule != "" {
+		opts.Schedule, err = updater.ParseSchedule(*schedule)
+		if err != nil {
+			log.Errorf(err, "wrong -schedule")
+			os.Exit(2)
+		}
+	}
+
+	ctx := signals.InterruptContext(nil)
+	err = update(ctx, lib, *token, opts, *workers)
+	if err != nil && ctx.Err() == nil {
+		log.Errorf(err, "update of %s failed", *path)
+		os.Exit(1)
+	}
+
+	log.Infof("updater of %s stopped", *path)
+}
+
+// update updates the locations of the library on the schedules of the given
+// options until the context is done, or just once.
+func update(
+	ctx context.Context,
+	lib borges.Library,
+	token string,
+	opts *updater.UpdatesProviderOpts,
+	workers int,
+) error {
+	queue := make(chan gitcollector.Job, queueSize)
+	schedule := library.NewUpdateJobScheduleFn(
+		lib, queue, updater.Update, nil, log.New(nil),
+	)
+
+	// the tokens are given by organization, the same one is used for all
+	// the repositories of the library instead.
+	schedule = library.WithJobSetup(schedule, func(job *library.Job) error {
+		job.AuthToken = func(string) string { return token }
+		return nil
+	})
+
+	wp := gitcollector.NewWorkerPool(schedule, &gitcollector.WorkerPoolOpts{})
+	wp.SetWorkers(workers)
+	wp.RunContext(ctx)
+
+	provider := updater.NewUpdatesProvider(lib, queue, opts)
+
+	go func() {
+		err := gitcollector.StartProvider(ctx, provider)
+		if err != nil && !gitcollector.ErrProviderStopped.Is(err) {
+			wp.ProviderFailed(err)
+		}
+
+		// the provider may still be enqueueing once it's stopped, the
+		// workers are stopped by the context then.
+		if ctx.Err() == nil {
+			close(queue)
+		}
+	}()
+
+	return wp.WaitError()
+}
+
+// orgSchedules is a flag.Value collecting the schedules of the organizations
+// given as org=expression.
+type orgSchedules map[string]*updater.Schedule
+
+func (o orgSchedules) String() string {
+	var values []string
+	for org, s := range o {
+		values = append(values, org+"="+s.String())
+	}
+
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+func (o orgSchedules) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 {
+		return fmt.Errorf("org=expression expected, %q given", value)
+	}
+
+	s, err := updater.ParseSchedule(value[i+1:])
+	if err != nil {
+		return err
+	}
+
+	o[value[:i]] = s
+	return nil
+}
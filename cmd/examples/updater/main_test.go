@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector/downloader"
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/simulation"
+	"github.com/src-d/gitcollector/updater"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+func testLibrary(t *testing.T, sim *simulation.Simulation) borges.Library {
+	lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+	})
+	require.NoError(t, err)
+
+	for _, r := range sim.Repositories() {
+		require.NoError(t, downloader.Download(
+			context.Background(),
+			&library.Job{
+				Lib:       lib,
+				Type:      library.JobDownload,
+				Endpoints: []string{r.Endpoint()},
+				TempFS:    memfs.New(),
+				AuthToken: func(string) string { return "" },
+				Logger:    log.New(nil),
+			},
+		))
+	}
+
+	return lib
+}
+
+func TestUpdateOnce(t *testing.T) {
+	var require = require.New(t)
+
+	sim := simulation.New(&simulation.Opts{Repos: 5, Seed: 5, Forks: 0.5})
+	sim.Install()
+	defer simulation.Uninstall()
+
+	lib := testLibrary(t, sim)
+	require.NoError(update(
+		context.Background(), lib, "", &updater.UpdatesProviderOpts{
+			TriggerOnce:     true,
+			TriggerInterval: time.Hour,
+		}, 2,
+	))
+}
+
+func TestUpdateDaemon(t *testing.T) {
+	var require = require.New(t)
+
+	sim := simulation.New(&simulation.Opts{Repos: 5, Seed: 5})
+	sim.Install()
+	defer simulation.Uninstall()
+
+	lib := testLibrary(t, sim)
+
+	// the daemon keeps updating the library until it's stopped.
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 200*time.Millisecond,
+	)
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- update(ctx, lib, "", &updater.UpdatesProviderOpts{
+			TriggerInterval: 10 * time.Millisecond,
+		}, 2)
+	}()
+
+	select {
+	case err := <-done:
+		require.Error(err)
+		require.Equal(context.DeadlineExceeded, ctx.Err())
+	case <-time.After(10 * time.Second):
+		require.FailNow("the daemon didn't stop")
+	}
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"os"
+
+	"github.com/src-d/gitcollector"
 	"github.com/src-d/gitcollector/cmd/gitcollector/subcmd"
+	"github.com/src-d/gitcollector/sandbox"
 	"gopkg.in/src-d/go-cli.v0"
 )
 
@@ -13,6 +17,25 @@ var (
 var app = cli.New("gitcollector", version, build, "source{d} tool to download repositories into siva files")
 
 func main() {
+	// the sandboxed processes run their task instead of a subcommand.
+	sandbox.Init()
+
+	subcmd.Version = version
 	app.AddCommand(&subcmd.DownloadCmd{})
-	app.RunMain()
+	app.AddCommand(&subcmd.CampaignCmd{})
+	app.AddCommand(&subcmd.MigrateCmd{})
+	app.AddCommand(&subcmd.MaintainCmd{})
+	app.AddCommand(&subcmd.RebuildCmd{})
+	app.AddCommand(&subcmd.DuplicatesCmd{})
+	app.AddCommand(&subcmd.TrashCmd{})
+	app.AddCommand(&subcmd.AuditCmd{})
+	app.AddCommand(&subcmd.AnnotateCmd{})
+	app.AddCommand(&subcmd.ExportCmd{})
+	app.AddCommand(&subcmd.HeartbeatCmd{})
+	app.AddCommand(&subcmd.BenchmarkCmd{})
+	// the errors are logged by the subcommands, the exit code tells their
+	// class to the supervisors.
+	if err := app.Run(os.Args); err != nil {
+		os.Exit(gitcollector.ExitCode(err))
+	}
 }
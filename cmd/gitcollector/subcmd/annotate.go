@@ -0,0 +1,92 @@
+package subcmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// AnnotateCmd is the gitcollector subcommand to manage the annotations of the
+// locations of a library.
+type AnnotateCmd struct {
+	cli.Command `name:"annotate" short-description:"pin locations, mark them as do-not-update or attach notes to them"`
+
+	LibPath     string `long:"library" description:"path to the library" env:"GITCOLLECTOR_LIBRARY" required:"true"`
+	Location    string `long:"location" description:"location to annotate, the annotated locations are listed if it's not set"`
+	Pin         bool   `long:"pin" description:"pin the location so it can't be deleted"`
+	Unpin       bool   `long:"unpin" description:"remove the pin of the location"`
+	NoUpdate    bool   `long:"no-update" description:"mark the location as do-not-update, it won't be fetched, extended nor modified by the maintenance"`
+	AllowUpdate bool   `long:"allow-update" description:"remove the do-not-update mark of the location"`
+	Note        string `long:"note" description:"note attached to the location"`
+	ClearNotes  bool   `long:"clear-notes" description:"remove the notes of the location"`
+}
+
+// Execute runs the command.
+func (c *AnnotateCmd) Execute(args []string) error {
+	info, err := os.Stat(c.LibPath)
+	check(err, "wrong path to locate the library")
+
+	if !info.IsDir() {
+		check(
+			fmt.Errorf("%s isn't a directory", c.LibPath),
+			"wrong path to locate the library",
+		)
+	}
+
+	annotations := library.NewAnnotations(osfs.New(c.LibPath))
+	if c.Location != "" {
+		an, err := annotations.Get(borges.LocationID(c.Location))
+		check(err, "unable to read the annotation")
+
+		switch {
+		case c.Pin:
+			an.Pinned = true
+		case c.Unpin:
+			an.Pinned = false
+		}
+
+		switch {
+		case c.NoUpdate:
+			an.NoUpdate = true
+		case c.AllowUpdate:
+			an.NoUpdate = false
+		}
+
+		if c.ClearNotes {
+			an.Notes = nil
+		}
+
+		if c.Note != "" {
+			an.Notes = append(an.Notes, c.Note)
+		}
+
+		check(annotations.Set(an), "unable to annotate the location")
+		logAnnotation(an, "location annotated")
+		return nil
+	}
+
+	list, err := annotations.List()
+	check(err, "unable to list the annotations")
+	for _, an := range list {
+		logAnnotation(an, "annotated location")
+	}
+
+	return nil
+}
+
+func logAnnotation(an *library.Annotation, msg string) {
+	log.With(log.Fields{
+		"location":  an.LocationID,
+		"pinned":    an.Pinned,
+		"no_update": an.NoUpdate,
+		"notes":     strings.Join(an.Notes, "; "),
+		"updated":   an.Updated.Format(time.RFC3339),
+	}).Infof(msg)
+}
@@ -0,0 +1,68 @@
+package subcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-cli.v0"
+)
+
+// AuditCmd is the gitcollector subcommand to query the audit log of the
+// destructive operations on a library.
+type AuditCmd struct {
+	cli.Command `name:"audit" short-description:"list the deletions, purges, evictions, migrations and repacks recorded for a library"`
+
+	LibPath  string `long:"library" description:"path to the library" env:"GITCOLLECTOR_LIBRARY" required:"true"`
+	Action   string `long:"action" description:"only list the given operation" choice:"delete" choice:"restore" choice:"purge" choice:"evict" choice:"migrate" choice:"repack"`
+	Location string `long:"location" description:"only list the operations on the given location"`
+	Actor    string `long:"actor" description:"only list the operations performed by the given actor"`
+	Since    string `long:"since" description:"only list the operations performed from the given RFC 3339 time"`
+	Until    string `long:"until" description:"only list the operations performed before the given RFC 3339 time"`
+}
+
+// Execute runs the command.
+func (c *AuditCmd) Execute(args []string) error {
+	info, err := os.Stat(c.LibPath)
+	check(err, "wrong path to locate the library")
+
+	if !info.IsDir() {
+		check(
+			fmt.Errorf("%s isn't a directory", c.LibPath),
+			"wrong path to locate the library",
+		)
+	}
+
+	q := &library.AuditQuery{
+		Action:     library.AuditAction(c.Action),
+		LocationID: borges.LocationID(c.Location),
+		Actor:      c.Actor,
+	}
+
+	if c.Since != "" {
+		q.Since, err = time.Parse(time.RFC3339, c.Since)
+		check(err, "wrong --since time")
+	}
+
+	if c.Until != "" {
+		q.Until, err = time.Parse(time.RFC3339, c.Until)
+		check(err, "wrong --until time")
+	}
+
+	audit := library.NewAuditLog(osfs.New(c.LibPath), "", "")
+	entries, err := audit.Entries(q)
+	check(err, "unable to read the audit log")
+
+	// the entries are written as JSON lines, the same way they're stored,
+	// to be processed by the compliance reviews.
+	enc := json.NewEncoder(os.Stdout)
+	for _, e := range entries {
+		check(enc.Encode(e), "unable to write the audit log")
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/src-d/gitcollector/benchmark"
+	"github.com/src-d/gitcollector/simulation"
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// BenchmarkCmd is the gitcollector subcommand to measure the performance of
+// the scheduling and downloads using synthetic repositories.
+type BenchmarkCmd struct {
+	cli.Command `name:"benchmark" short-description:"measure scheduler throughput, queue latency and job rates with synthetic repositories"`
+
+	Workers   int     `long:"workers" description:"number of workers, default to GOMAXPROCS" env:"GITCOLLECTOR_WORKERS"`
+	Jobs      int     `long:"jobs" description:"number of no-op jobs of the scheduler benchmark" default:"10000"`
+	Orgs      string  `long:"orgs" description:"organizations the jobs are spread over separated by comma" default:"a,b,c,d"`
+	Repos     int     `long:"sim-repos" description:"number of synthetic repositories of each organization" default:"25"`
+	Commits   int     `long:"sim-commits" description:"maximum number of commits of the synthetic repositories" default:"20"`
+	Forks     float64 `long:"sim-forks" description:"probability of a synthetic repository to be a fork of another one" default:"0.2"`
+	Seed      int64   `long:"sim-seed" description:"seed generating the synthetic repositories" default:"1"`
+	Output    string  `long:"output" description:"file where the results are written as JSON, to be used as a baseline"`
+	Baseline  string  `long:"baseline" description:"results of a previous execution, the command fails if any measure regressed"`
+	Tolerance float64 `long:"tolerance" description:"fraction a measure can be worse than the baseline one" default:"0.1"`
+}
+
+// Execute runs the command.
+func (c *BenchmarkCmd) Execute(args []string) error {
+	results, err := benchmark.Run(context.Background(), &benchmark.Opts{
+		Workers: c.Workers,
+		Jobs:    c.Jobs,
+		Orgs:    strings.Split(c.Orgs, ","),
+		Simulation: &simulation.Opts{
+			Repos:      c.Repos,
+			MaxCommits: c.Commits,
+			Forks:      c.Forks,
+			Seed:       c.Seed,
+		},
+	})
+	check(err, "benchmark failed")
+
+	for _, r := range results {
+		fmt.Println(r)
+	}
+
+	if c.Output != "" {
+		f, err := os.Create(c.Output)
+		check(err, "unable to create the results file")
+		err = benchmark.WriteResults(f, results)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		check(err, "unable to write the results")
+	}
+
+	if c.Baseline == "" {
+		return nil
+	}
+
+	f, err := os.Open(c.Baseline)
+	check(err, "unable to open the baseline")
+	defer f.Close()
+
+	baseline, err := benchmark.ReadResults(f)
+	check(err, "wrong baseline")
+
+	regressions := benchmark.Compare(baseline, results, c.Tolerance)
+	for _, r := range regressions {
+		log.Warningf("regression: %s", r)
+	}
+
+	if len(regressions) > 0 {
+		return fmt.Errorf("%d measures regressed", len(regressions))
+	}
+
+	log.Infof("no regressions over the baseline")
+	return nil
+}
@@ -0,0 +1,121 @@
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/src-d/gitcollector"
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-log.v1"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// CampaignCmd is the gitcollector subcommand to run the phases of a campaign
+// defined in a file.
+type CampaignCmd struct {
+	cli.Command `name:"campaign" short-description:"run the ordered phases of a campaign, each one a download with its own settings"`
+
+	Config string `long:"config" description:"JSON file defining the phases of the campaign" env:"GITCOLLECTOR_CAMPAIGN" required:"true"`
+	State  string `long:"state" description:"file where the finished phases are recorded to resume the campaign, default to the config file with the .state extension" env:"GITCOLLECTOR_CAMPAIGN_STATE"`
+}
+
+// Execute runs the command.
+func (c *CampaignCmd) Execute(args []string) error {
+	campaign, err := gitcollector.LoadCampaign(c.Config)
+	check(err, "wrong campaign")
+
+	// every phase is parsed before starting, so a typo in the last one
+	// doesn't show up after days of collection.
+	for _, p := range campaign.Phases {
+		_, err := phaseCmd(campaign.Settings(p))
+		check(err, fmt.Sprintf("wrong settings of the phase %s", p.Name))
+	}
+
+	state := c.State
+	if state == "" {
+		state = c.Config + ".state"
+	}
+
+	err = gitcollector.RunCampaign(
+		interruptContext(),
+		campaign,
+		func(
+			ctx context.Context,
+			p *gitcollector.Phase,
+			s gitcollector.Settings,
+		) error {
+			cmd, err := phaseCmd(s)
+			if err != nil {
+				return err
+			}
+
+			cmd.ctx = ctx
+			return cmd.Execute(nil)
+		},
+		&gitcollector.CampaignOpts{
+			StatePath: state,
+			OnPhase: func(p *gitcollector.Phase, run int) {
+				log.With(log.Fields{
+					"campaign": campaign.Name,
+					"phase":    p.Name,
+					"run":      run,
+				}).Infof("campaign phase started")
+			},
+		},
+	)
+	check(err, "campaign failed")
+
+	log.With(log.Fields{"campaign": campaign.Name}).
+		Infof("campaign finished")
+	return nil
+}
+
+// phaseCmd builds the download of a phase, its settings are parsed as the
+// command line flags of the same name.
+func phaseCmd(s gitcollector.Settings) (*DownloadCmd, error) {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		values, ok := s[name].([]interface{})
+		if !ok {
+			values = []interface{}{s[name]}
+		}
+
+		for _, v := range values {
+			switch v := v.(type) {
+			case bool:
+				if v {
+					args = append(args, "--"+name)
+				}
+			case float64:
+				args = append(args, fmt.Sprintf(
+					"--%s=%s", name, strconv.FormatFloat(v, 'f', -1, 64),
+				))
+			default:
+				args = append(args, fmt.Sprintf("--%s=%v", name, v))
+			}
+		}
+	}
+
+	cmd := &DownloadCmd{}
+	parser := flags.NewParser(cmd, flags.None)
+	rest, err := parser.ParseArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected settings %v", rest)
+	}
+
+	return cmd, cmd.Validate()
+}
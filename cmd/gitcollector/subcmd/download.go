@@ -1,90 +1,499 @@
 package subcmd
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/admin"
+	"github.com/src-d/gitcollector/console"
 	"github.com/src-d/gitcollector/discovery"
-	"github.com/src-d/gitcollector/downloader"
+	"github.com/src-d/gitcollector/internal/signals"
 	"github.com/src-d/gitcollector/library"
 	"github.com/src-d/gitcollector/metrics"
+	"github.com/src-d/gitcollector/protocol"
+	"github.com/src-d/gitcollector/proxy"
 	"github.com/src-d/go-borges/siva"
+	"golang.org/x/oauth2"
+	"gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-billy.v4/osfs"
 	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
 	"gopkg.in/src-d/go-log.v1"
 )
 
+// Version is the gitcollector version recorded in the library runs.
+var Version string
+
 // DownloadCmd is the gitcollector subcommand to download repositories.
 type DownloadCmd struct {
 	cli.Command `name:"download" short-description:"download repositories from a github organization"`
 
-	LibPath         string `long:"library" description:"path where download to" env:"GITCOLLECTOR_LIBRARY" required:"true"`
-	LibBucket       int    `long:"bucket" description:"library bucketization level" env:"GITCOLLECTOR_LIBRARY_BUCKET" default:"2"`
-	TmpPath         string `long:"tmp" description:"directory to place generated temporal files" default:"/tmp" env:"GITCOLLECTOR_TMP"`
-	Workers         int    `long:"workers" description:"number of workers, default to GOMAXPROCS" env:"GITCOLLECTOR_WORKERS"`
-	HalfCPU         bool   `long:"half-cpu" description:"set the number of workers to half of the set workers" env:"GITCOLLECTOR_HALF_CPU"`
-	NotAllowUpdates bool   `long:"no-updates" description:"don't allow updates on already downloaded repositories" env:"GITCOLLECTOR_NO_UPDATES"`
-	Orgs            string `long:"orgs" env:"GITHUB_ORGANIZATIONS" description:"list of github organization names separated by comma" required:"true"`
-	Token           string `long:"token" env:"GITHUB_TOKEN" description:"github token"`
-	MetricsDBURI    string `long:"metrics-db" env:"GITCOLLECTOR_METRICS_DB_URI" description:"uri to a database where metrics will be sent"`
-	MetricsDBTable  string `long:"metrics-db-table" env:"GITCOLLECTOR_METRICS_DB_TABLE" default:"gitcollector_metrics" description:"table name where the metrics will be added"`
-	MetricsSync     int64  `long:"metrics-sync-timeout" env:"GITCOLLECTOR_METRICS_SYNC" default:"30" description:"timeout in seconds to send metrics"`
+	LibPath         string   `long:"library" description:"path where download to" env:"GITCOLLECTOR_LIBRARY" required:"true"`
+	LibBucket       int      `long:"bucket" description:"library bucketization level, 0 stores the siva files flat, detected from the library by default and 2 for new ones" env:"GITCOLLECTOR_LIBRARY_BUCKET" default:"-1"`
+	LibMode         string   `long:"library-mode" description:"how to handle existing libraries written by older tools, upgrading their metadata in place or keeping them untouched" env:"GITCOLLECTOR_LIBRARY_MODE" choice:"upgrade" choice:"compatible" default:"upgrade"`
+	Naming          string   `long:"naming" description:"template to name the stored repositories using {host}, {org}, {name} and {hash} placeholders" env:"GITCOLLECTOR_NAMING" default:"{host}/{org}/{name}"`
+	IDs             string   `long:"ids" description:"identify the new locations and repositories by their root commit and --naming, or by random UUIDs kept in the gitcollector.ids mapping of the library" env:"GITCOLLECTOR_IDS" choice:"hash" choice:"uuid" default:"hash"`
+	Tiers           string   `long:"tiers" description:"additional storage tiers as a list of name=path separated by comma, the libraries use the same bucketization level" env:"GITCOLLECTOR_TIERS"`
+	TierRules       string   `long:"tier-rules" description:"path to a JSON file with the rules routing the repositories to the storage tiers, the first matching rule wins" env:"GITCOLLECTOR_TIER_RULES"`
+	TmpPath         string   `long:"tmp" description:"directory to place generated temporal files" default:"/tmp" env:"GITCOLLECTOR_TMP"`
+	Queue           string   `long:"queue" description:"file where the discovered jobs are stored until they're processed successfully, so the ones interrupted by a crash are processed by the next run" env:"GITCOLLECTOR_QUEUE"`
+	HandoffOut      string   `long:"handoff-out" description:"shared directory where the discovered jobs are written instead of downloading them, to be downloaded by other machines with --handoff-in" env:"GITCOLLECTOR_HANDOFF_OUT"`
+	HandoffIn       string   `long:"handoff-in" description:"shared directory the jobs written with --handoff-out are claimed from and downloaded, waiting for new ones until it's interrupted" env:"GITCOLLECTOR_HANDOFF_IN"`
+	HandoffOwner    string   `long:"handoff-owner" description:"name the jobs claimed from --handoff-in are recorded with, unique among the machines sharing the directory, default to the host name" env:"GITCOLLECTOR_HANDOFF_OWNER"`
+	HandoffEvery    int      `long:"handoff-interval" description:"seconds between checks of --handoff-in once there are no pending jobs" env:"GITCOLLECTOR_HANDOFF_INTERVAL" default:"10"`
+	DrainTimeout    int      `long:"drain-timeout" description:"seconds the jobs being processed are waited for once an interrupt or a termination signal is received, before canceling them, the jobs not started are kept for the next run by the journal and --queue, 0 cancels them right away" env:"GITCOLLECTOR_DRAIN_TIMEOUT"`
+	Workers         int      `long:"workers" description:"number of workers, default to GOMAXPROCS" env:"GITCOLLECTOR_WORKERS"`
+	HalfCPU         bool     `long:"half-cpu" description:"set the number of workers to half of the set workers" env:"GITCOLLECTOR_HALF_CPU"`
+	JobRetries      int      `long:"job-retries" description:"times a job failing with a network, timeout or server error is retried" env:"GITCOLLECTOR_JOB_RETRIES"`
+	JobRetryDelay   int      `long:"job-retry-delay" description:"seconds waited before the first retry of a job, multiplied by --job-retry-factor on every retry" env:"GITCOLLECTOR_JOB_RETRY_DELAY" default:"30"`
+	JobRetryMax     int      `long:"job-retry-max-delay" description:"maximum seconds waited before a retry of a job, uncapped if 0" env:"GITCOLLECTOR_JOB_RETRY_MAX_DELAY" default:"600"`
+	JobRetryFactor  float64  `long:"job-retry-factor" description:"factor the wait before the retries of a job grows by, kept constant if 1" env:"GITCOLLECTOR_JOB_RETRY_FACTOR" default:"2"`
+	DownloadRetries int      `long:"download-retries" description:"times a download job failing with a network, timeout or server error is retried, default to --job-retries" env:"GITCOLLECTOR_DOWNLOAD_RETRIES"`
+	UpdateRetries   int      `long:"update-retries" description:"times an update job failing with a network, timeout or server error is retried, default to --job-retries" env:"GITCOLLECTOR_UPDATE_RETRIES"`
+	JobTimeout      int      `long:"job-timeout" description:"seconds every attempt of a job can take, unlimited by default" env:"GITCOLLECTOR_JOB_TIMEOUT"`
+	JobRate         float64  `long:"job-rate" description:"maximum number of jobs started per second by the workers, retries included, unlimited by default" env:"GITCOLLECTOR_JOB_RATE"`
+	History         bool     `long:"history" description:"keep the durations, failures and size growth of every repository in the library along the runs, to adapt the scheduling of the slow and flaky ones" env:"GITCOLLECTOR_HISTORY"`
+	HistorySlow     int      `long:"history-slow" description:"mean seconds in the history above which a repository is processed alone like the ones exceeding --worker-memory, 0 disables it" env:"GITCOLLECTOR_HISTORY_SLOW"`
+	HistoryStreak   int      `long:"history-failure-streak" description:"consecutive failures in the history after which a repository is scheduled after the rest by --size-order, 0 disables it" env:"GITCOLLECTOR_HISTORY_FAILURE_STREAK"`
+	ObjectCacheSize int      `long:"object-cache-size" description:"size in MiB of the object cache of every cloned repository, default to go-git default size" env:"GITCOLLECTOR_OBJECT_CACHE_SIZE"`
+	SharedCache     int      `long:"shared-object-cache-size" description:"size in MiB of an object cache shared among the library repositories, every repository opened by a job gets its own cache of go-git default size by default" env:"GITCOLLECTOR_SHARED_OBJECT_CACHE_SIZE"`
+	KeepDescriptors bool     `long:"keep-descriptors" description:"reuse packfile descriptors of the cloned repositories" env:"GITCOLLECTOR_KEEP_DESCRIPTORS"`
+	MaxDescriptors  int      `long:"max-open-descriptors" description:"maximum number of packfile descriptors kept open by the cloned repositories" env:"GITCOLLECTOR_MAX_OPEN_DESCRIPTORS"`
+	MemoryBudget    int      `long:"memory-budget" description:"approximate memory in MiB the in-flight jobs can use, unlimited by default" env:"GITCOLLECTOR_MEMORY_BUDGET"`
+	WorkerMemory    int      `long:"worker-memory" description:"approximate memory in MiB a job can use, bigger repositories are processed one at a time" env:"GITCOLLECTOR_WORKER_MEMORY"`
+	PostVerify      bool     `long:"post-verify" description:"verify the objects hashes of the stored locations after each job" env:"GITCOLLECTOR_POST_VERIFY"`
+	PostCommitGraph bool     `long:"post-commit-graph" description:"generate the commit-graph of the stored locations after each job" env:"GITCOLLECTOR_POST_COMMIT_GRAPH"`
+	PostRepack      bool     `long:"post-repack" description:"repack the stored locations after each job" env:"GITCOLLECTOR_POST_REPACK"`
+	PostWorkers     int      `long:"post-workers" description:"number of concurrent post-processing tasks, default to GOMAXPROCS" env:"GITCOLLECTOR_POST_WORKERS"`
+	EmptyRepos      string   `long:"empty-repos" description:"how to handle empty repositories, failing, skipping them, storing a placeholder location or retrying them like the network, timeout and server errors" env:"GITCOLLECTOR_EMPTY_REPOS" choice:"fail" choice:"skip" choice:"placeholder" choice:"retry" default:"fail"`
+	MaxForks        int      `long:"max-forks" description:"maximum number of forks stored in a rooted repository along with the original one, unlimited by default" env:"GITCOLLECTOR_MAX_FORKS"`
+	ForkSampling    string   `long:"fork-sampling" description:"forks kept once a rooted repository reaches --max-forks, the first ones found or a random sample" env:"GITCOLLECTOR_FORK_SAMPLING" choice:"first" choice:"random" default:"first"`
+	Actor           string   `long:"actor" description:"who is recorded in the audit log of the library for the evicted forks, default to user@host" env:"GITCOLLECTOR_AUDIT_ACTOR"`
+	LocRemotes      string   `long:"location-remotes" description:"how to download a repository whose rooted repository already holds the remotes of other endpoints, adding its remote, replacing the other remotes or failing" env:"GITCOLLECTOR_LOCATION_REMOTES" choice:"add" choice:"replace" choice:"fail" default:"add"`
+	PullRequests    string   `long:"pull-requests" description:"how to fetch the references of the pull and merge requests of the remotes, as any other reference, skipping them or apart in the pr namespace of the remote" env:"GITCOLLECTOR_PULL_REQUESTS" choice:"keep" choice:"skip" choice:"namespace" default:"keep"`
+	MergeLocations  bool     `long:"merge-locations" description:"merge the repositories found for the same rooted repository at the same time into a single write of the location" env:"GITCOLLECTOR_MERGE_LOCATIONS"`
+	NonRooted       bool     `long:"non-rooted" description:"store every repository in a location of its own instead of in the location of its root commit along with its forks" env:"GITCOLLECTOR_NON_ROOTED"`
+	ShareObjects    bool     `long:"share-objects" description:"keep the objects of the --non-rooted locations in a pool by root commit in the gitcollector.objects directory of the library, so the objects shared by the forks are stored once, the locations can only be read along with their pool" env:"GITCOLLECTOR_SHARE_OBJECTS"`
+	OutageThreshold int      `long:"outage-threshold" description:"consecutive connection failures or server errors that switch to probe mode until github recovers, 0 disables it" env:"GITCOLLECTOR_OUTAGE_THRESHOLD" default:"20"`
+	OutageProbe     int      `long:"outage-probe-interval" description:"seconds between probes while in probe mode" env:"GITCOLLECTOR_OUTAGE_PROBE_INTERVAL" default:"60"`
+	Probe           bool     `long:"probe" description:"check the repositories exist requesting their references before downloading them, failing the missing or private ones right away" env:"GITCOLLECTOR_PROBE"`
+	ProbeTimeout    int      `long:"probe-timeout" description:"seconds a repository probe can take before downloading the repository anyway" env:"GITCOLLECTOR_PROBE_TIMEOUT" default:"10"`
+	GitProtocol     string   `long:"git-protocol" description:"protocol version spoken with the git servers over HTTP as a list of host=version separated by comma, * for the rest of the hosts, 2 lists the references and filters the objects on the server" env:"GITCOLLECTOR_GIT_PROTOCOL"`
+	GitRefPrefixes  string   `long:"git-ref-prefixes" description:"prefixes of the references listed by the hosts speaking the protocol 2 separated by comma, all the references by default" env:"GITCOLLECTOR_GIT_REF_PREFIXES"`
+	GitServerOpts   []string `long:"git-server-option" description:"option sent to the hosts speaking the protocol 2 with every request, it can be repeated"`
+	GitFilter       string   `long:"git-filter" description:"object filter of the fetches from the hosts speaking the protocol 2, like blob:none, the filtered out objects are missing from the library" env:"GITCOLLECTOR_GIT_FILTER"`
+	DialPolicy      string   `long:"dial-policy" description:"how the git servers are dialed over HTTP, resolving the hosts on every connection and trying the addresses failed recently last or pinning every host to the first address connected to for the rest of the run, the addresses failed are logged at the end" env:"GITCOLLECTOR_DIAL_POLICY" choice:"reresolve" choice:"pin"`
+	DNSServers      []string `long:"dns-server" description:"alternate DNS server as host:port resolving the git servers when the system resolver fails and on the retries of the connections, it can be repeated"`
+	DialRetries     int      `long:"dial-retries" description:"times a git server is resolved and dialed again once all its addresses failed" env:"GITCOLLECTOR_DIAL_RETRIES" default:"2"`
+	ProxyPAC        string   `long:"proxy-pac" description:"path or http URL of a proxy auto-config file choosing the proxy of the git servers and the APIs by host, the hosts in NO_PROXY are always connected directly" env:"GITCOLLECTOR_PROXY_PAC"`
+	Negotiation     string   `long:"negotiation" description:"commits of the locations advertised by the updates as already stored, the most recent ones of every reference or a sample at growing distances reaching deeper in the history, go-git chooses them by default" env:"GITCOLLECTOR_NEGOTIATION" choice:"consecutive" choice:"skipping"`
+	NegDepth        int      `long:"negotiation-depth" description:"commits of the history of every reference walked looking for the commits to advertise, 100 by default" env:"GITCOLLECTOR_NEGOTIATION_DEPTH"`
+	NegRemoteOnly   bool     `long:"negotiation-remote-only" description:"only advertise the references of the updated repository instead of the ones of every repository of the location" env:"GITCOLLECTOR_NEGOTIATION_REMOTE_ONLY"`
+	Incremental     bool     `long:"incremental" description:"fetch the history of the big repositories in increments over successive jobs, keeping the partial clones in the .partial directory of the library until their history is complete" env:"GITCOLLECTOR_INCREMENTAL"`
+	IncrMinSize     int      `long:"incremental-min-size" description:"size in MiB reported by the discovery from which the repositories are fetched incrementally, all of them by default" env:"GITCOLLECTOR_INCREMENTAL_MIN_SIZE"`
+	IncrCommits     int      `long:"incremental-commits" description:"commits the history is deepened by on every step, 10000 by default" env:"GITCOLLECTOR_INCREMENTAL_COMMITS"`
+	IncrWindow      int      `long:"incremental-window" description:"days the history is deepened by on every step instead of a number of commits" env:"GITCOLLECTOR_INCREMENTAL_WINDOW"`
+	IncrBudget      int      `long:"incremental-budget" description:"seconds a job keeps deepening the history before leaving the rest to the next job, a single step by default" env:"GITCOLLECTOR_INCREMENTAL_BUDGET"`
+	Sandbox         bool     `long:"sandbox" description:"clone the repositories over HTTP in child processes restricted to their temporal directory and unable to execute programs, the incremental fetches and the updates aren't sandboxed" env:"GITCOLLECTOR_SANDBOX"`
+	SandboxCgroup   string   `long:"sandbox-cgroup" description:"cgroup v2 directory where a cgroup is created for every sandboxed process to limit its memory, CPUs and threads" env:"GITCOLLECTOR_SANDBOX_CGROUP"`
+	SandboxMemory   int      `long:"sandbox-memory" description:"maximum memory in MiB of every sandboxed process, unlimited by default" env:"GITCOLLECTOR_SANDBOX_MEMORY"`
+	SandboxCPUs     float64  `long:"sandbox-cpus" description:"maximum CPUs used by every sandboxed process, like 0.5, unlimited by default" env:"GITCOLLECTOR_SANDBOX_CPUS"`
+	SandboxPids     int      `long:"sandbox-pids" description:"maximum threads of every sandboxed process, unlimited by default" env:"GITCOLLECTOR_SANDBOX_PIDS"`
+	SandboxFiles    int      `long:"sandbox-files" description:"maximum files open by every sandboxed process, the limit of gitcollector by default" env:"GITCOLLECTOR_SANDBOX_FILES"`
+	SandboxFileSize int      `long:"sandbox-file-size" description:"maximum size in MiB of the files written by every sandboxed process, unlimited by default" env:"GITCOLLECTOR_SANDBOX_FILE_SIZE"`
+	Manifests       string   `long:"manifests" description:"only fetch these files from the HEAD of the repositories using the github API instead of cloning them, separated by comma" env:"GITCOLLECTOR_MANIFESTS"`
+	ManifestsPath   string   `long:"manifests-path" description:"directory where the fetched files are stored, default to the manifests directory of the library" env:"GITCOLLECTOR_MANIFESTS_PATH"`
+	Packs           string   `long:"packs" description:"store the packfiles fetched from the repositories in object storage instead of the library, streamed as they're received, like s3://bucket/prefix, gs://bucket/prefix or a local directory" env:"GITCOLLECTOR_PACKS"`
+	PacksEndpoint   string   `long:"packs-endpoint" description:"URL of the S3 API of the object storage, default to the AWS one of --packs-region, or the GCS one for gs://" env:"GITCOLLECTOR_PACKS_ENDPOINT"`
+	PacksRegion     string   `long:"packs-region" description:"region of the bucket of --packs, default to us-east-1, or auto for gs://" env:"GITCOLLECTOR_PACKS_REGION"`
+	PacksAccessKey  string   `long:"packs-access-key" description:"access key of the object storage, the HMAC keys of GCS" env:"GITCOLLECTOR_PACKS_ACCESS_KEY"`
+	PacksSecretKey  string   `long:"packs-secret-key" description:"secret key of the object storage" env:"GITCOLLECTOR_PACKS_SECRET_KEY"`
+	PacksPartSize   int      `long:"packs-part-size" description:"size in MiB of the parts the packfiles are uploaded in, the memory every worker needs" env:"GITCOLLECTOR_PACKS_PART_SIZE" default:"16"`
+	Metadata        bool     `long:"metadata" description:"capture the description and topics of the downloaded github repositories in the .metadata directory of the library" env:"GITCOLLECTOR_METADATA"`
+	MetadataReadme  bool     `long:"metadata-readme" description:"also capture the README of the repositories rendered to HTML, an API request more for every repository" env:"GITCOLLECTOR_METADATA_README"`
+	Simulate        bool     `long:"simulate" description:"download synthetic repositories generated locally instead of the github ones, to load test and benchmark without network access" env:"GITCOLLECTOR_SIMULATE"`
+	SimRepos        int      `long:"sim-repos" description:"number of synthetic repositories of each organization in simulation mode" env:"GITCOLLECTOR_SIM_REPOS" default:"100"`
+	SimCommits      int      `long:"sim-commits" description:"maximum number of commits of the synthetic repositories" env:"GITCOLLECTOR_SIM_COMMITS" default:"20"`
+	SimForks        float64  `long:"sim-forks" description:"probability of a synthetic repository to be a fork of another one" env:"GITCOLLECTOR_SIM_FORKS" default:"0.2"`
+	SimSeed         int64    `long:"sim-seed" description:"seed generating the synthetic repositories, the same seed generates the same repositories" env:"GITCOLLECTOR_SIM_SEED" default:"1"`
+	SimLatency      int      `long:"sim-latency" description:"milliseconds waited before serving each synthetic repository" env:"GITCOLLECTOR_SIM_LATENCY"`
+	SizeOrder       string   `long:"size-order" description:"schedule the downloads by the size reported by the discovery, the smallest or the largest repositories first, in the order they're discovered by default" env:"GITCOLLECTOR_SIZE_ORDER" choice:"smallest" choice:"largest"`
+	OrderedWindow   int      `long:"ordered-window" description:"process the repositories strictly in the order they're discovered, a repository isn't started until the ones this many positions before it finished, 0 disables it and shares the workers between the organizations" env:"GITCOLLECTOR_ORDERED_WINDOW"`
+	DedupWindow     int      `long:"dedup-window" description:"number of recently enqueued repositories each organization remembers to not enqueue them again when they're listed again, 0 disables it" env:"GITCOLLECTOR_DEDUP_WINDOW"`
+	RetryInterleave int      `long:"retry-interleave" description:"number of new repositories each organization enqueues between two of the ones that timed out to be enqueued, these go first if 0" env:"GITCOLLECTOR_RETRY_INTERLEAVE"`
+	CursorsFile     string   `long:"cursors-file" description:"JSON file where the position of the listing of every organization and starring user is kept, so the discovery of the next run resumes where it left off" env:"GITCOLLECTOR_CURSORS_FILE"`
+	CursorsDBURI    string   `long:"cursors-db" description:"uri to a postgres database where the positions of the listings are kept instead of --cursors-file, shared by several machines" env:"GITCOLLECTOR_CURSORS_DB_URI"`
+	CursorsDBTable  string   `long:"cursors-db-table" description:"table of the cursors database where the positions are kept" env:"GITCOLLECTOR_CURSORS_DB_TABLE" default:"gitcollector_cursors"`
+	Languages       string   `long:"languages" description:"only download the github repositories whose main language is one of these, separated by comma" env:"GITCOLLECTOR_LANGUAGES"`
+	MaxRepoSize     int      `long:"max-repo-size" description:"size in MiB reported by github above which the repositories aren't downloaded, unlimited by default" env:"GITCOLLECTOR_MAX_REPO_SIZE"`
+	SkipForks       bool     `long:"skip-forks" description:"don't download the github repositories that are forks" env:"GITCOLLECTOR_SKIP_FORKS"`
+	SkipArchived    bool     `long:"skip-archived" description:"don't download the archived github repositories" env:"GITCOLLECTOR_SKIP_ARCHIVED"`
+	OrgConcurrency  int      `long:"org-concurrency" description:"maximum number of organizations discovered at the same time, all of them by default" env:"GITCOLLECTOR_ORG_CONCURRENCY"`
+	NotAllowUpdates bool     `long:"no-updates" description:"don't allow updates on already downloaded repositories" env:"GITCOLLECTOR_NO_UPDATES"`
+	Backfill        bool     `long:"backfill" description:"check the library before scheduling every discovered repository, downloading the missing ones and updating the ones already present, the split is reported at the end" env:"GITCOLLECTOR_BACKFILL"`
+	Orgs            string   `long:"orgs" env:"GITHUB_ORGANIZATIONS" description:"list of github organization names separated by comma, * for all the organizations the token can see"`
+	Enterprise      string   `long:"enterprise" env:"GITHUB_ENTERPRISE" description:"github enterprise account slug whose organizations are collected"`
+	Starred         string   `long:"starred" env:"GITHUB_STARRED" description:"list of github users separated by comma whose starred repositories are collected along with the ones of the organizations"`
+	Token           string   `long:"token" env:"GITHUB_TOKEN" description:"github token"`
+	AppID           int64    `long:"app-id" env:"GITHUB_APP_ID" description:"id of a github App authenticating the discovery instead of --token, the clones, manifests and metadata still use --token"`
+	AppInstall      int64    `long:"app-installation" env:"GITHUB_APP_INSTALLATION" description:"id of the installation of the github App in the discovered account"`
+	AppKey          string   `long:"app-key" env:"GITHUB_APP_PRIVATE_KEY" description:"file with the PEM encoded private key of the github App"`
+	Plugin          string   `long:"provider-plugin" env:"GITCOLLECTOR_PROVIDER_PLUGIN" description:"executable of a custom discovery provider speaking the plugin protocol, its repositories are collected along with the ones of the organizations"`
+	PluginArgs      []string `long:"provider-plugin-arg" description:"argument of the provider plugin, it can be repeated"`
+	List            string   `long:"list" env:"GITCOLLECTOR_LIST" description:"file with a repository URL per line to collect along with the ones of the organizations, - for the standard input"`
+	ListFollow      bool     `long:"list-follow" env:"GITCOLLECTOR_LIST_FOLLOW" description:"keep reading the list file on SIGHUP and every --list-interval, so the lines added to it become new jobs"`
+	ListInterval    int      `long:"list-interval" env:"GITCOLLECTOR_LIST_INTERVAL" description:"seconds between reads of the list file while following it, only on SIGHUP by default"`
+	Modules         string   `long:"modules" env:"GITCOLLECTOR_MODULES" description:"file with a Go module path per line, or a go.sum file, whose repositories are collected along with the ones of the organizations, - for the standard input"`
+	KafkaBrokers    string   `long:"kafka-brokers" env:"GITCOLLECTOR_KAFKA_BROKERS" description:"list of kafka brokers as host:port separated by comma, read by --kafka-topic and written by --kafka-results-topic"`
+	KafkaTopic      string   `long:"kafka-topic" env:"GITCOLLECTOR_KAFKA_TOPIC" description:"kafka topic whose messages, a repository URL or a JSON feed record each, are collected along with the ones of the organizations"`
+	KafkaGroup      string   `long:"kafka-group" env:"GITCOLLECTOR_KAFKA_GROUP" description:"kafka consumer group the topic is read by, the collectors of the same group share its partitions" default:"gitcollector"`
+	KafkaResults    string   `long:"kafka-results-topic" env:"GITCOLLECTOR_KAFKA_RESULTS_TOPIC" description:"kafka topic where a JSON message with the outcome of every processed repository is published, tagged with the run id"`
+	APIRate         float64  `long:"api-rate" env:"GITCOLLECTOR_API_RATE" description:"sustained requests per hour to the github API made by the discovery, the manifests and the metadata, never exceeded on average, unlimited by default"`
+	APIBurst        int      `long:"api-burst" env:"GITCOLLECTOR_API_BURST" description:"requests saved while idle that can be made over --api-rate" default:"1"`
+	APIBurstRate    float64  `long:"api-burst-rate" env:"GITCOLLECTOR_API_BURST_RATE" description:"maximum requests per second to the github API while bursting, the saved requests are made at once by default"`
+	MetricsDBURI    string   `long:"metrics-db" env:"GITCOLLECTOR_METRICS_DB_URI" description:"uri to a database where metrics will be sent"`
+	MetricsDBTable  string   `long:"metrics-db-table" env:"GITCOLLECTOR_METRICS_DB_TABLE" default:"gitcollector_metrics" description:"table name where the metrics will be added"`
+	MetricsDBJobs   string   `long:"metrics-db-jobs-table" env:"GITCOLLECTOR_METRICS_DB_JOBS_TABLE" description:"table of the metrics database where a row is inserted for every processed repository with its job kind, status, start and finish times and error, tagged with the run id"`
+	MetricsSync     int64    `long:"metrics-sync-timeout" env:"GITCOLLECTOR_METRICS_SYNC" default:"30" description:"timeout in seconds to send metrics"`
+	MetricsCSV      string   `long:"metrics-csv" env:"GITCOLLECTOR_METRICS_CSV" description:"file where a row with the metrics of every processed repository is appended as CSV, tagged with the run id to compare campaigns"`
+	MetricsListen   string   `long:"metrics-listen" env:"GITCOLLECTOR_METRICS_LISTEN" description:"address where the prometheus metrics are served at /metrics, like :9090"`
+	ExitCodes       bool     `long:"exit-codes" env:"GITCOLLECTOR_EXIT_CODES" description:"exit with the code of the error catalog when the collection finished with failed jobs or providers, or it was interrupted"`
+	Features        string   `long:"features" env:"GITCOLLECTOR_FEATURES" description:"experimental features enabled in the run separated by comma, partial-clone, fork-grouping or size-scheduler, a feature prefixed by - is disabled, they're recorded with the run in the library to compare the runs with and without them"`
+	Anonymize       bool     `long:"anonymize" env:"GITCOLLECTOR_ANONYMIZE" description:"replace the endpoints, locations and organizations in the metrics and logs with keyed hashes, keeping the mapping locally"`
+	AnonymizeKey    string   `long:"anonymize-key" env:"GITCOLLECTOR_ANONYMIZE_KEY" description:"secret the identifiers are hashed with, so the hashes can't be guessed from public names"`
+	AnonymizeMap    string   `long:"anonymize-mapping" env:"GITCOLLECTOR_ANONYMIZE_MAPPING" description:"file where the hashes and their identifiers are appended as CSV, default to gitcollector.anonymized in the library"`
+	HeartbeatFile   string   `long:"heartbeat-file" env:"GITCOLLECTOR_HEARTBEAT_FILE" description:"file where the activity of every worker is written periodically as JSON, to be checked by the supervisors with the heartbeat subcommand"`
+	HeartbeatEvery  int      `long:"heartbeat-interval" env:"GITCOLLECTOR_HEARTBEAT_INTERVAL" description:"seconds between writes of the heartbeat file" default:"10"`
+	HeartbeatStuck  int      `long:"heartbeat-stuck" env:"GITCOLLECTOR_HEARTBEAT_STUCK" description:"seconds processing the same repository after which a worker is reported as stuck in the heartbeat file, 0 never reports them"`
+	AdminListen     string   `long:"admin-listen" env:"GITCOLLECTOR_ADMIN_LISTEN" description:"address where the admin API is served, reporting the queues, workers and recent failures as JSON and pausing, resuming or resizing the pool, like 127.0.0.1:9091"`
+	AdminJobs       bool     `long:"admin-jobs" env:"GITCOLLECTOR_ADMIN_JOBS" description:"accept the download jobs and, with the grpc API, the organizations to discover again submitted to the admin APIs, the collection keeps running once the rest of the providers finish until it's interrupted"`
+	GRPCListen      string   `long:"grpc-listen" env:"GITCOLLECTOR_GRPC_LISTEN" description:"address where the grpc control API is served, mirroring the admin API and streaming the job events, listing the library and discovering the organizations again, like 127.0.0.1:9092"`
+	GitListen       string   `long:"git-listen" env:"GITCOLLECTOR_GIT_LISTEN" description:"address where the repositories of the library are served read-only over the git smart HTTP protocol, to be cloned and fetched like from a mirror, like 127.0.0.1:9093"`
+	Progress        string   `long:"progress" env:"GITCOLLECTOR_PROGRESS" description:"draw the activity of the workers, the queues, the throughput and the recent failures in the terminal, when the standard output is one, always or never" choice:"auto" choice:"always" choice:"never" default:"auto"`
+
+	// ctx stops the collection, canceled on interrupt by default.
+	ctx context.Context
+	// proxy chooses the proxy of the requests, nil if there's no PAC file.
+	proxy *proxy.Proxy
 }
 
 // Execute runs the command.
 func (c *DownloadCmd) Execute(args []string) error {
 	start := time.Now()
+	features, err := library.ParseFeatures(c.Features)
+	check(err, "wrong features")
+	c.enableFeatures(features)
+	check(c.Validate(), "wrong configuration")
+	c.installProxy()
+	dialer := c.gitProtocol()
+
+	s := c.newCollection(features)
+	defer s.close()
+
+	// the source sets the queue and the handoff the setup of the jobs and
+	// the shutdown use.
+	source := c.jobSource(s)
+	wp := gitcollector.NewWorkerPool(
+		c.schedule(s, source, c.downloadFn(s)),
+		&gitcollector.WorkerPoolOpts{
+			Metrics:       c.metrics(s),
+			OrderedWindow: c.OrderedWindow,
+			Policies:      c.policies(),
+			JobTimeout:    time.Duration(c.JobTimeout) * time.Second,
+			OnShutdown:    c.shutdownFns(s),
+			Events:        s.events,
+		},
+	)
 
-	orgs := strings.Split(c.Orgs, ",")
+	if s.prom != nil {
+		s.prom.WatchPool(wp)
+	}
 
-	info, err := os.Stat(c.LibPath)
-	check(err, "wrong path to locate the library")
+	newIter := c.reposIter(s)
+	adhoc := c.serveAPIs(s, wp, newIter)
+	c.serveRepositories(s)
+	c.drawProgress(s, wp)
 
-	if !info.IsDir() {
-		check(
-			fmt.Errorf("%s isn't a directory", c.LibPath),
-			"wrong path to locate the library",
+	wp.SetWorkers(c.workers())
+	log.Debugf("number of workers in the pool %d", wp.Size())
+
+	// the providers are stopped on interrupt along with the workers, or
+	// once the workers are drained.
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = interruptContext()
+	}
+
+	finished := make(chan struct{})
+	var drained <-chan *gitcollector.ShutdownReport
+	if c.DrainTimeout > 0 {
+		drained = drainOnInterrupt(
+			ctx, wp, time.Duration(c.DrainTimeout)*time.Second, finished,
 		)
+	} else {
+		wp.RunContext(ctx)
 	}
+	log.Debugf("worker pool is running")
 
-	fs := osfs.New(c.LibPath)
+	c.writeHeartbeats(s, wp)
 
-	tmpPath, err := ioutil.TempDir(
-		c.TmpPath, "gitcollector-downloader")
-	check(err, "unable to create temporal directory")
-	defer func() {
-		if err := os.RemoveAll(tmpPath); err != nil {
+	go runGHOrgProviders(
+		ctx, s.logger, s.orgs, newIter, s.download, s.pending,
+		wp.ProviderFailed, s.watchProviders, c.discoveryOpts(s),
+		c.OrgConcurrency, c.starredIters(s), c.providers(s, adhoc),
+	)
+
+	err = wp.WaitError()
+	close(finished)
+	if err != nil {
+		log.Warningf("collection finished with errors: %s", err)
+		if runErr, ok := err.(*gitcollector.RunError); ok &&
+			runErr.Shutdown != nil {
+			logShutdown(s.logger, runErr.Shutdown)
+		}
+	} else {
+		log.Debugf("worker pool stopped successfully")
+	}
+
+	if drained != nil {
+		if report := <-drained; report != nil {
+			logShutdown(s.logger, report)
+		}
+	}
+
+	if s.backfill != nil {
+		report := s.backfill.Report()
+		s.logger.With(log.Fields{
+			"missing":   report.Missing,
+			"present":   report.Present,
+			"unchecked": report.Unchecked,
+		}).Infof("backfill finished")
+	}
+
+	s.run.APIRequests = s.usage.Requests()
+	logAPIUsage(s.logger, s.run.APIRequests)
+	if dialer != nil {
+		logDialFailures(s.logger, dialer.Stats())
+	}
+
+	if err := s.run.Finish(); err != nil {
+		log.Warningf("couldn't record the end of the run: %s", err)
+	}
+
+	elapsed := time.Since(start).String()
+	log.Infof("collection finished in %s", elapsed)
+	if c.ExitCodes && err != nil {
+		log.With(log.Fields{"exit_code": gitcollector.ExitCode(err)}).
+			Infof("exiting with the code of the collection errors")
+		return err
+	}
+
+	return nil
+}
+
+// collection is the state of a download shared by the setup of its features.
+type collection struct {
+	features   library.Features
+	fs         billy.Filesystem
+	bucket     int
+	lib        *siva.Library
+	libOpts    siva.LibraryOptions
+	storage    *library.StorageOpts
+	temp       billy.Filesystem
+	ns         *library.TempNamespace
+	run        *library.Run
+	orgs       []string
+	starred    []string
+	anonymizer *library.Anonymizer
+	logger     log.Logger
+
+	// the discovery, the manifests and the metadata share the API budget.
+	limiter *gitcollector.RateLimiter
+	usage   *gitcollector.APIUsage
+	app     oauth2.TokenSource
+	outage  *gitcollector.OutageDetector
+
+	download chan gitcollector.Job
+	journal  *library.Journal
+	pending  []*library.Job
+	history  *library.History
+	queue    *gitcollector.PersistentQueue
+	handoff  *library.Handoff
+	backfill *library.Backfill
+	cursors  discovery.CursorStore
+	events   *gitcollector.JobEventBus
+	prom     *metrics.PrometheusCollector
+	display  *console.Display
+	admin    *admin.Server
+
+	closers []func()
+}
+
+// onClose registers a function run once the collection finishes.
+func (s *collection) onClose(fn func()) {
+	s.closers = append(s.closers, fn)
+}
+
+// close runs the functions registered with onClose, the last one first.
+func (s *collection) close() {
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i]()
+	}
+}
+
+// newCollection opens the library and the state of the download shared by
+// the features.
+func (c *DownloadCmd) newCollection(features library.Features) *collection {
+	s := &collection{features: features}
+	s.limiter = gitcollector.NewRateLimiter(&gitcollector.RateLimiterOpts{
+		Sustained: c.APIRate / 3600,
+		Burst:     c.APIBurst,
+		BurstRate: c.APIBurstRate,
+	})
+
+	// the requests are counted by provider to report them at the end.
+	s.usage = gitcollector.NewAPIUsage()
+
+	// the installation tokens of the App are refreshed along the run.
+	s.app = c.appTokenSource()
+
+	s.orgs = c.organizations(s.limiter, s.usage, s.app)
+	s.fs = osfs.New(c.LibPath)
+
+	s.anonymizer = c.anonymizer()
+	s.starred = c.starredUsers()
+	s.logger = s.anonymizer.Logger(
+		log.New(nil), append(append([]string{}, s.orgs...), s.starred...)...,
+	)
+	if s.anonymizer != nil {
+		log.DefaultLogger = s.logger
+	}
+
+	layout, err := library.DetectLayout(s.fs)
+	check(err, "unable to inspect the library")
+	if layout.Legacy {
+		log.Infof("legacy library found, mode: %s", c.LibMode)
+	}
+
+	s.bucket, err = layout.Negotiate(
+		s.fs, c.libBucket(layout), library.LibraryMode(c.LibMode),
+	)
+	check(err, "incompatible library")
+
+	s.run = c.startRun(s.fs, features, s.orgs, s.starred)
+
+	s.ns = tempNamespace(c.TmpPath, s.run.ID)
+	s.onClose(func() {
+		if err := s.ns.Close(); err != nil {
 			log.Warningf(
 				"couldn't remove temporal directory %s: %s",
-				tmpPath, err.Error(),
+				s.ns.Name(), err.Error(),
 			)
 		}
-	}()
+	})
 
-	log.Debugf("temporal dir: %s", tmpPath)
-	temp := osfs.New(tmpPath)
+	s.temp = s.ns.FS()
+	s.storage = &library.StorageOpts{
+		ObjectCacheSize:    cache.FileSize(c.ObjectCacheSize) * cache.MiByte,
+		SharedCacheSize:    cache.FileSize(c.SharedCache) * cache.MiByte,
+		ExclusiveAccess:    true,
+		KeepDescriptors:    c.KeepDescriptors,
+		MaxOpenDescriptors: c.MaxDescriptors,
+	}
 
-	lib, err := siva.NewLibrary("test", fs, siva.LibraryOptions{
-		Bucket:        2,
+	// the repositories of the library only share a cache if it's sized.
+	s.libOpts = siva.LibraryOptions{
+		Bucket:        s.bucket,
 		Transactional: true,
-		TempFS:        temp,
-	})
+		TempFS:        s.temp,
+		Cache:         s.storage.SharedCache(),
+	}
+
+	s.lib, err = siva.NewLibrary("test", s.fs, s.libOpts)
 	check(err, "unable to create borges siva library")
 
-	authTokens := map[string]string{}
-	if c.Token != "" {
-		log.Debugf("acces token found")
-		for _, org := range orgs {
-			authTokens[org] = c.Token
+	s.download = make(chan gitcollector.Job, downloadQueueSize)
+
+	s.journal = library.NewJournal(s.fs, library.JournalFile)
+	pending, err := s.journal.Reconcile(context.Background(), s.lib)
+	check(err, "unable to reconcile the library journal")
+	if len(pending) > 0 {
+		log.Infof("%d interrupted jobs found in the journal",
+			len(pending))
+	}
+
+	// only the downloads are enqueued again, the locations interrupted
+	// updating are updated by the next runs.
+	for _, job := range pending {
+		if len(job.Endpoints) > 0 {
+			s.pending = append(s.pending, job)
+			continue
 		}
+
+		check(s.journal.Abort(job), "unable to write the library journal")
 	}
 
+	if c.History {
+		s.history, err = library.NewHistory(s.fs, library.HistoryFile)
+		check(err, "unable to load the history")
+		s.onClose(func() {
+			if err := s.history.Compact(); err != nil {
+				log.Warningf("couldn't compact the history: %s", err)
+			}
+		})
+	}
+
+	if c.OutageThreshold > 0 {
+		s.outage = gitcollector.NewOutageDetector(&gitcollector.OutageOpts{
+			Threshold:     c.OutageThreshold,
+			ProbeInterval: time.Duration(c.OutageProbe) * time.Second,
+			OnChange: func(down bool) {
+				if down {
+					log.Warningf("github unavailable, probe mode")
+					return
+				}
+
+				log.Infof("github recovered, leaving probe mode")
+			},
+		})
+	}
+
+	s.cursors = c.cursors(s)
+
+	// the admin and grpc APIs report the recent failures from the job
+	// events, the grpc one streams them too.
+	if c.adminAPIs() {
+		s.events = gitcollector.NewJobEventBus()
+		s.onClose(s.events.Close)
+	}
+
+	return s
+}
+
+// newLibraryBucket is the bucketization level of the new libraries when
+// --bucket isn't given.
+const newLibraryBucket = 2
+
+// libBucket returns the bucketization level requested for the library with
+// the given layout: the one of --bucket if it's given, otherwise the level
+// found in the library, or newLibraryBucket if it's empty.
+func (c *DownloadCmd) libBucket(layout *library.LibraryLayout) int {
+	if c.LibBucket < 0 && layout.Bucket < 0 {
+		return newLibraryBucket
+	}
+
+	return c.LibBucket
+}
+
+// workers returns the number of workers of the pool.
+func (c *DownloadCmd) workers() int {
 	workers := c.Workers
 	if workers == 0 {
 		workers = runtime.GOMAXPROCS(-1)
@@ -94,121 +503,297 @@ func (c *DownloadCmd) Execute(args []string) error {
 		workers = workers / 2
 	}
 
-	updateOnDownload := !c.NotAllowUpdates
-	log.Debugf("allow updates on downloads: %v", updateOnDownload)
+	return workers
+}
 
-	download := make(chan gitcollector.Job, 100)
+func (c *DownloadCmd) organizations(
+	limiter *gitcollector.RateLimiter,
+	usage *gitcollector.APIUsage,
+	app oauth2.TokenSource,
+) []string {
+	if c.Simulate && c.Orgs == "" {
+		return []string{"sim"}
+	}
 
-	schedule := library.NewDownloadJobScheduleFn(
-		lib,
-		download,
-		downloader.Download,
-		updateOnDownload,
-		authTokens,
-		log.New(nil),
-		temp,
-	)
+	if (c.Plugin != "" || c.Starred != "" || c.List != "" ||
+		c.Modules != "" || c.KafkaTopic != "" || c.AdminJobs ||
+		c.HandoffIn != "") && c.Orgs == "" && c.Enterprise == "" {
+		// only the plugin, the stars, the list, the modules, the kafka
+		// topic, the admin API or the handoff discover repositories
+		return nil
+	}
 
-	var mc gitcollector.MetricsCollector
-	if c.MetricsDBURI != "" {
-		mc = setupMetrics(
-			c.MetricsDBURI,
-			c.MetricsDBTable,
-			orgs,
-			c.MetricsSync,
-		)
+	if c.Simulate || c.Enterprise == "" && c.Orgs != discovery.AllOrgs {
+		if c.Orgs == "" {
+			check(
+				fmt.Errorf("no organizations given"),
+				"wrong organizations",
+			)
+		}
 
-		log.Debugf("metrics collection activated: sync timeout %d",
-			c.MetricsSync)
+		return strings.Split(c.Orgs, ",")
 	}
 
-	wp := gitcollector.NewWorkerPool(
-		schedule,
-		&gitcollector.WorkerPoolOpts{
-			Metrics: mc,
+	orgs, err := discovery.ListGHOrgs(
+		context.Background(),
+		&discovery.GHOrgsOpts{
+			Enterprise:  c.Enterprise,
+			AuthToken:   c.Token,
+			TokenSource: app,
+			RateLimiter: limiter,
+			APIUsage:    usage,
 		},
 	)
+	check(err, "unable to list organizations")
 
-	wp.SetWorkers(workers)
-	log.Debugf("number of workers in the pool %d", wp.Size())
+	if len(orgs) == 0 {
+		check(
+			fmt.Errorf("no organizations found"),
+			"wrong organizations",
+		)
+	}
 
-	wp.Run()
-	log.Debugf("worker pool is running")
+	log.Infof("%d organizations found", len(orgs))
+	return orgs
+}
 
-	go runGHOrgProviders(log.New(nil), orgs, c.Token, download)
+// handoffOwner returns the owner of the jobs claimed from the handoff.
+func (c *DownloadCmd) handoffOwner() string {
+	if c.HandoffOwner != "" {
+		return c.HandoffOwner
+	}
 
-	wp.Wait()
-	log.Debugf("worker pool stopped successfully")
+	host, err := os.Hostname()
+	check(err, "unable to name the handoff owner")
+	return host
+}
 
-	elapsed := time.Since(start).String()
-	log.Infof("collection finished in %s", elapsed)
-	return nil
+// starredUsers returns the users whose starred repositories are collected.
+func (c *DownloadCmd) starredUsers() []string {
+	if c.Starred == "" {
+		return nil
+	}
+
+	return strings.Split(c.Starred, ",")
 }
 
-func check(err error, message string) {
+// enableFeatures turns on the experimental subsystems gated by the features,
+// before the configuration is validated and hashed.
+func (c *DownloadCmd) enableFeatures(features library.Features) {
+	if features.Enabled(library.FeaturePartialClone) {
+		c.Incremental = true
+	}
+
+	if features.Enabled(library.FeatureForkGrouping) {
+		c.MergeLocations = true
+	}
+
+	if features.Enabled(library.FeatureSizeScheduler) && c.SizeOrder == "" {
+		c.SizeOrder = string(gitcollector.SmallestFirst)
+	}
+
+	if list := features.List(); len(list) > 0 {
+		log.Infof("experimental features enabled: %s",
+			strings.Join(list, ", "))
+	}
+}
+
+func (c *DownloadCmd) startRun(
+	fs billy.Filesystem,
+	features library.Features,
+	orgs, starred []string,
+) *library.Run {
+	cfg := *c
+	cfg.Token = ""
+	hash, err := library.ConfigHash(&cfg)
+	check(err, "unable to hash the configuration")
+
+	providers := make([]string, 0, len(orgs)+len(starred))
+	for _, org := range orgs {
+		providers = append(providers, "github:"+org)
+	}
+
+	for _, user := range starred {
+		providers = append(providers, "github:starred:"+user)
+	}
+
+	run, err := library.StartRun(
+		fs, library.RunsFile, Version, hash, features, providers...,
+	)
+	check(err, "unable to record the run in the library")
+
+	log.With(log.Fields{"run": run.ID}).Debugf("run recorded")
+	return run
+}
+
+// tempNamespace removes the temporal directories left by dead runs and creates
+// the one of the given run.
+func tempNamespace(path, runID string) *library.TempNamespace {
+	root := osfs.New(path)
+	removed, err := library.CleanOrphanNamespaces(root, nil)
 	if err != nil {
-		log.Errorf(err, message)
-		os.Exit(1)
+		log.Warningf("couldn't clean orphan temporal directories: %s", err)
+	}
+
+	for _, name := range removed {
+		log.Infof("orphan temporal directory removed: %s", name)
 	}
+
+	ns, err := library.NewTempNamespace(root, runID, nil)
+	check(err, "unable to create temporal directory")
+
+	log.Debugf("temporal dir: %s", root.Join(path, ns.Name()))
+	return ns
 }
 
-func setupMetrics(
-	uri, table string,
-	orgs []string,
-	metricSync int64,
-) gitcollector.MetricsCollector {
-	db, err := metrics.PrepareDB(uri, table, orgs)
-	check(err, "metrics database")
+// interruptContext returns a context canceled when the collection is
+// interrupted, logging the signal received.
+func interruptContext() context.Context {
+	return signals.InterruptContext(func(sig os.Signal) {
+		log.Infof("%s received, stopping the collection", sig)
+	})
+}
 
-	mcs := make(map[string]*metrics.Collector, len(orgs))
-	for _, org := range orgs {
-		mc := metrics.NewCollector(&metrics.CollectorOpts{
-			Log:      log.New(log.Fields{"org": org}),
-			Send:     metrics.SendToDB(db, table, org),
-			SyncTime: time.Duration(metricSync) * time.Second,
-		})
+// drainOnInterrupt runs the worker pool draining it once the context is done,
+// waiting for the jobs being processed up to the given timeout. The returned
+// channel gets the report of the drain, or nil if the pool finished before,
+// once finished is closed.
+func drainOnInterrupt(
+	ctx context.Context,
+	wp *gitcollector.WorkerPool,
+	timeout time.Duration,
+	finished <-chan struct{},
+) <-chan *gitcollector.ShutdownReport {
+	drained := make(chan *gitcollector.ShutdownReport, 1)
+	wp.Run()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-finished:
+			drained <- nil
+			return
+		}
 
-		mcs[org] = mc
-	}
-
-	return metrics.NewCollectorByOrg(mcs)
-}
-
-func runGHOrgProviders(
-	logger log.Logger,
-	orgs []string,
-	token string,
-	download chan gitcollector.Job,
-) {
-	var wg sync.WaitGroup
-	wg.Add(len(orgs))
-	for _, o := range orgs {
-		org := o
-		p := discovery.NewGHProvider(
-			download,
-			discovery.NewGHOrgReposIter(
-				org,
-				&discovery.GHReposIterOpts{
-					AuthToken: token,
-				},
-			),
-			&discovery.GHProviderOpts{},
-		)
+		log.Infof("draining the workers for up to %s", timeout)
+		dctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
 
-		go func() {
-			err := p.Start()
-			if err != nil &&
-				!discovery.ErrNewRepositoriesNotFound.Is(err) {
-				logger.Warningf(err.Error())
+		drained <- wp.Drain(dctx)
+	}()
+
+	return drained
+}
+
+// logShutdown logs what was abandoned stopping the collection.
+func logShutdown(logger log.Logger, report *gitcollector.ShutdownReport) {
+	logger.With(log.Fields{
+		"discarded": len(report.Discarded),
+		"canceled":  len(report.Canceled),
+	}).Infof("collection stopped")
+
+	for _, j := range report.Canceled {
+		fields := log.Fields{}
+		if job, ok := j.(*library.Job); ok {
+			fields["id"] = job.ID
+			fields["endpoints"] = strings.Join(job.Endpoints, ",")
+			if job.LocationID != "" {
+				fields["location"] = job.LocationID
 			}
+		}
+
+		logger.With(fields).Infof("job canceled")
+	}
+
+	for _, j := range report.Discarded {
+		if job, ok := j.(*library.Job); ok {
+			logger.With(log.Fields{
+				"id":        job.ID,
+				"endpoints": strings.Join(job.Endpoints, ","),
+			}).Debugf("job discarded")
+		}
+	}
+
+	for _, c := range report.Cleanups {
+		logger := logger.With(log.Fields{"cleanup": c.Name})
+		if c.Err != nil {
+			logger.Errorf(c.Err, "shutdown cleanup failed")
+			continue
+		}
+
+		logger.Infof(c.Detail)
+	}
+}
+
+// logAPIUsage logs the API requests made by every provider, along with the
+// total, once the collection finished.
+func logAPIUsage(logger log.Logger, requests []gitcollector.APIRequests) {
+	var total, failed int
+	for _, r := range requests {
+		total += r.Requests
+		failed += r.Failed
+		logger.With(log.Fields{
+			"provider": r.Provider,
+			"category": r.Category,
+			"requests": r.Requests,
+			"failed":   r.Failed,
+		}).Infof("API requests")
+	}
 
-			logger.Debugf("%s organization provider stopped", org)
-			wg.Done()
-		}()
+	logger.With(log.Fields{
+		"requests": total,
+		"failed":   failed,
+	}).Infof("API requests of the run")
+}
 
-		logger.Debugf("%s organization provider started", org)
+// logDialFailures logs the addresses of the git servers that failed to
+// connect, once the collection finished.
+func logDialFailures(logger log.Logger, stats []protocol.AddrStats) {
+	for _, s := range stats {
+		if s.Failures == 0 {
+			continue
+		}
+
+		logger.With(log.Fields{
+			"host":     s.Host,
+			"address":  s.Addr,
+			"dials":    s.Dials,
+			"failures": s.Failures,
+			"error":    s.LastError,
+		}).Warningf("git server address failed")
 	}
+}
+
+// errFailed is returned by the subcommands finishing with failures, wrapping
+// the first one so the process exits with the code of its class.
+var errFailed = errors.NewKind("%d %s failed")
 
-	wg.Wait()
-	close(download)
+// check exits with the code of the class of the error, if any.
+func check(err error, message string) {
+	if err != nil {
+		log.Errorf(err, message)
+		os.Exit(gitcollector.ExitCode(err))
+	}
+}
+
+// anonymizer returns the Anonymizer of the identifiers, nil if they're not
+// anonymized. The mapping is appended to, so the hashes of several executions
+// are found in the same file.
+func (c *DownloadCmd) anonymizer() *library.Anonymizer {
+	if !c.Anonymize {
+		return nil
+	}
+
+	path := c.AnonymizeMap
+	if path == "" {
+		path = filepath.Join(c.LibPath, library.AnonymizedFile)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	check(err, "unable to open the anonymization mapping")
+
+	log.Debugf("anonymization mapping kept in %s", path)
+	return library.NewAnonymizer(&library.AnonymizerOpts{
+		Key:     []byte(c.AnonymizeKey),
+		Mapping: f,
+	})
 }
@@ -0,0 +1,154 @@
+package subcmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/src-d/gitcollector/dedup"
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/migrate"
+	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-log.v1"
+
+	"github.com/google/uuid"
+)
+
+// DuplicatesCmd is the gitcollector subcommand to find the repositories
+// stored more than once in a library and its storage tiers.
+type DuplicatesCmd struct {
+	cli.Command `name:"duplicates" short-description:"report the repositories duplicated across organizations and libraries, merging the copies of the locations"`
+
+	LibPath   string `long:"library" description:"path to the library" env:"GITCOLLECTOR_LIBRARY" required:"true"`
+	LibBucket int    `long:"bucket" description:"library bucketization level, detected from the library by default" env:"GITCOLLECTOR_LIBRARY_BUCKET" default:"-1"`
+	Tiers     string `long:"tiers" description:"additional storage tiers as a list of name=path separated by comma" env:"GITCOLLECTOR_TIERS"`
+	TmpPath   string `long:"tmp" description:"directory to place generated temporal files" default:"/tmp" env:"GITCOLLECTOR_TMP"`
+	Report    string `long:"report" description:"file where the JSON consolidation report is written, - for the standard output" default:"-"`
+	Merge     bool   `long:"merge" description:"merge the copies of the locations stored in several libraries into the one holding more repositories, moving the rest to the trash"`
+	Actor     string `long:"actor" description:"who is recorded in the audit log of the libraries, default to user@host" env:"GITCOLLECTOR_AUDIT_ACTOR"`
+}
+
+// Execute runs the command.
+func (c *DuplicatesCmd) Execute(args []string) error {
+	start := time.Now()
+
+	ns := tempNamespace(c.TmpPath, uuid.New().String())
+	defer ns.Close()
+
+	libs := []*dedup.Library{c.library("library", c.LibPath, ns.FS())}
+	if c.Tiers != "" {
+		for _, t := range strings.Split(c.Tiers, ",") {
+			parts := strings.SplitN(t, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				check(
+					fmt.Errorf("%q isn't name=path", t),
+					"wrong storage tiers",
+				)
+			}
+
+			libs = append(libs, c.library(parts[0], parts[1], ns.FS()))
+		}
+	}
+
+	ctx := context.Background()
+	report, err := dedup.Analyze(ctx, libs, nil)
+	check(err, "analysis failed")
+
+	out := io.Writer(os.Stdout)
+	if c.Report != "-" {
+		f, err := os.Create(c.Report)
+		check(err, "unable to create the report")
+		defer f.Close()
+
+		out = f
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	check(enc.Encode(report), "unable to write the report")
+
+	var (
+		merged, failed int
+		first          error
+	)
+
+	if c.Merge {
+		for _, job := range report.MergeJobs(libs) {
+			if err := job.Process(ctx); err != nil {
+				if first == nil {
+					first = err
+				}
+
+				failed++
+				continue
+			}
+
+			merged++
+		}
+	}
+
+	log.With(log.Fields{
+		"locations":    report.Locations,
+		"repositories": report.Repositories,
+		"duplicates":   len(report.Duplicates),
+		"redundant":    report.Redundant,
+		"merged":       merged,
+		"failed":       failed,
+		"elapsed":      time.Since(start).String(),
+	}).Infof("analysis finished")
+
+	if failed > 0 {
+		return errFailed.Wrap(first, failed, "merges")
+	}
+
+	return nil
+}
+
+func (c *DuplicatesCmd) library(
+	name, path string,
+	temp billy.Filesystem,
+) *dedup.Library {
+	info, err := os.Stat(path)
+	check(err, "wrong path to locate the library")
+
+	if !info.IsDir() {
+		check(
+			fmt.Errorf("%s isn't a directory", path),
+			"wrong path to locate the library",
+		)
+	}
+
+	fs := osfs.New(path)
+	layout, err := library.DetectLayout(fs)
+	check(err, "unable to inspect the library")
+
+	bucket, err := layout.Negotiate(
+		fs, c.LibBucket, library.LibraryCompatible,
+	)
+	check(err, "incompatible library")
+
+	lib, err := siva.NewLibrary(name, fs, siva.LibraryOptions{
+		Bucket:        bucket,
+		Transactional: true,
+		TempFS:        temp,
+	})
+	check(err, "unable to open borges siva library")
+
+	return &dedup.Library{
+		Name:   name,
+		Store:  migrate.NewSivaStore(lib),
+		FS:     fs,
+		Bucket: bucket,
+		Trash: library.NewTrash(fs, &library.TrashOpts{
+			Bucket: bucket,
+			Audit:  library.NewAuditLog(fs, "", c.Actor),
+		}),
+	}
+}
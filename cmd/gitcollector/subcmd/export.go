@@ -0,0 +1,105 @@
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/src-d/gitcollector/export"
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-log.v1"
+
+	"github.com/google/uuid"
+)
+
+// ExportCmd is the gitcollector subcommand to export the metadata of the
+// repositories of a library.
+type ExportCmd struct {
+	cli.Command `name:"export" short-description:"export the metadata of the repositories of a library as a parquet file"`
+
+	LibPath      string `long:"library" description:"path to the library" env:"GITCOLLECTOR_LIBRARY" required:"true"`
+	LibBucket    int    `long:"bucket" description:"library bucketization level, detected from the library by default" env:"GITCOLLECTOR_LIBRARY_BUCKET" default:"-1"`
+	TmpPath      string `long:"tmp" description:"directory to place generated temporal files" default:"/tmp" env:"GITCOLLECTOR_TMP"`
+	Output       string `long:"output" description:"path of the parquet file to write" env:"GITCOLLECTOR_EXPORT_OUTPUT" required:"true"`
+	RowGroupSize int    `long:"row-group-size" description:"number of repositories of each row group of the parquet file" env:"GITCOLLECTOR_EXPORT_ROW_GROUP_SIZE" default:"10000"`
+}
+
+// Execute runs the command.
+func (c *ExportCmd) Execute(args []string) error {
+	start := time.Now()
+
+	info, err := os.Stat(c.LibPath)
+	check(err, "wrong path to locate the library")
+
+	if !info.IsDir() {
+		check(
+			fmt.Errorf("%s isn't a directory", c.LibPath),
+			"wrong path to locate the library",
+		)
+	}
+
+	fs := osfs.New(c.LibPath)
+	layout, err := library.DetectLayout(fs)
+	check(err, "unable to inspect the library")
+
+	bucket, err := layout.Negotiate(
+		fs, c.LibBucket, library.LibraryCompatible,
+	)
+	check(err, "incompatible library")
+
+	ns := tempNamespace(c.TmpPath, uuid.New().String())
+	defer ns.Close()
+
+	lib, err := siva.NewLibrary("export", fs, siva.LibraryOptions{
+		Bucket:        bucket,
+		Transactional: true,
+		TempFS:        ns.FS(),
+	})
+	check(err, "unable to open borges siva library")
+
+	// the file is written aside and renamed once it's complete, so a
+	// failed export doesn't leave a truncated file behind
+	tmp := c.Output + ".tmp"
+	f, err := os.Create(tmp)
+	check(err, "unable to create the output file")
+
+	w, err := export.NewParquetWriter(f, &export.ParquetOpts{
+		RowGroupSize: c.RowGroupSize,
+		CreatedBy:    "gitcollector " + Version,
+	})
+	check(err, "unable to write the output file")
+
+	count, err := export.Library(
+		context.Background(),
+		lib,
+		w,
+		&export.LibraryOpts{FS: fs, Bucket: bucket},
+	)
+
+	if err == nil {
+		err = w.Close()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		check(err, "export failed")
+	}
+
+	check(os.Rename(tmp, c.Output), "unable to write the output file")
+
+	log.With(log.Fields{
+		"repositories": count,
+		"output":       c.Output,
+		"elapsed":      time.Since(start).String(),
+	}).Infof("export finished")
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package subcmd
+
+import (
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// HeartbeatCmd is the gitcollector subcommand to check the heartbeat file of
+// a running download, meant to be used as the liveness probe of a supervisor.
+type HeartbeatCmd struct {
+	cli.Command `name:"heartbeat" short-description:"check the heartbeat file of a running download, exiting with an error if it's stale or a worker is stuck"`
+
+	File   string `long:"file" description:"heartbeat file written by the download" env:"GITCOLLECTOR_HEARTBEAT_FILE" required:"true"`
+	MaxAge int    `long:"max-age" description:"seconds since the last write after which the heartbeat is stale, 0 doesn't check it" env:"GITCOLLECTOR_HEARTBEAT_MAX_AGE" default:"60"`
+}
+
+// Execute runs the command.
+func (c *HeartbeatCmd) Execute(args []string) error {
+	report, err := gitcollector.ReadHeartbeatReport(c.File)
+	check(err, "unable to read the heartbeat file")
+
+	maxAge := time.Duration(c.MaxAge) * time.Second
+	check(report.Check(maxAge, time.Now()), "unhealthy collector")
+
+	var busy int
+	for _, hb := range report.Workers {
+		if hb.Busy {
+			busy++
+		}
+	}
+
+	log.With(log.Fields{
+		"pid":     report.PID,
+		"updated": report.Updated.Format(time.RFC3339),
+		"workers": len(report.Workers),
+		"busy":    busy,
+	}).Infof("collector alive")
+	return nil
+}
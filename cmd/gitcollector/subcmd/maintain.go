@@ -0,0 +1,146 @@
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/postprocess"
+	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-log.v1"
+
+	"github.com/google/uuid"
+)
+
+// MaintainCmd is the gitcollector subcommand to run local maintenance tasks
+// on an existing library without network access.
+type MaintainCmd struct {
+	cli.Command `name:"maintain" short-description:"verify, repack or get statistics of an existing library without network access"`
+
+	LibPath     string `long:"library" description:"path to the library" env:"GITCOLLECTOR_LIBRARY" required:"true"`
+	LibBucket   int    `long:"bucket" description:"library bucketization level, detected from the library by default" env:"GITCOLLECTOR_LIBRARY_BUCKET" default:"-1"`
+	TmpPath     string `long:"tmp" description:"directory to place generated temporal files" default:"/tmp" env:"GITCOLLECTOR_TMP"`
+	Workers     int    `long:"workers" description:"number of locations processed concurrently, default to GOMAXPROCS" env:"GITCOLLECTOR_WORKERS"`
+	Verify      bool   `long:"verify" description:"verify the objects hashes of every location" env:"GITCOLLECTOR_MAINTAIN_VERIFY"`
+	Stats       bool   `long:"stats" description:"report the number of repositories, references and objects of every location" env:"GITCOLLECTOR_MAINTAIN_STATS"`
+	Repack      bool   `long:"repack" description:"repack every location" env:"GITCOLLECTOR_MAINTAIN_REPACK"`
+	CommitGraph bool   `long:"commit-graph" description:"generate the commit-graph of every location" env:"GITCOLLECTOR_MAINTAIN_COMMIT_GRAPH"`
+	Actor       string `long:"actor" description:"who is recorded in the audit log of the library, default to user@host" env:"GITCOLLECTOR_AUDIT_ACTOR"`
+}
+
+// Execute runs the command.
+func (c *MaintainCmd) Execute(args []string) error {
+	start := time.Now()
+
+	info, err := os.Stat(c.LibPath)
+	check(err, "wrong path to locate the library")
+
+	if !info.IsDir() {
+		check(
+			fmt.Errorf("%s isn't a directory", c.LibPath),
+			"wrong path to locate the library",
+		)
+	}
+
+	fs := osfs.New(c.LibPath)
+	layout, err := library.DetectLayout(fs)
+	check(err, "unable to inspect the library")
+
+	bucket, err := layout.Negotiate(
+		fs, c.LibBucket, library.LibraryCompatible,
+	)
+	check(err, "incompatible library")
+
+	ns := tempNamespace(c.TmpPath, uuid.New().String())
+	defer ns.Close()
+
+	lib, err := siva.NewLibrary("maintain", fs, siva.LibraryOptions{
+		Bucket:        bucket,
+		Transactional: true,
+		TempFS:        ns.FS(),
+	})
+	check(err, "unable to open borges siva library")
+
+	var steps []postprocess.Step
+	if c.Verify {
+		steps = append(steps, postprocess.VerifyObjects)
+	}
+
+	if c.Repack {
+		steps = append(steps, postprocess.Repack)
+	}
+
+	if c.CommitGraph {
+		steps = append(steps, postprocess.WriteCommitGraph)
+	}
+
+	report, err := postprocess.Maintain(
+		context.Background(),
+		lib,
+		&postprocess.MaintainOpts{
+			Steps:       steps,
+			ReadOnly:    !c.Repack && !c.CommitGraph,
+			Stats:       c.Stats,
+			Workers:     c.Workers,
+			Annotations: library.NewAnnotations(fs),
+		},
+	)
+	check(err, "maintenance failed")
+
+	if c.Repack {
+		err := library.NewAuditLog(fs, "", c.Actor).Record(
+			library.AuditRepack, "", "maintenance",
+			fmt.Sprintf("%d locations, %d failed, %d skipped",
+				len(report.Locations), report.Failed, report.Skipped),
+		)
+		check(err, "unable to record the repack in the audit log")
+	}
+
+	var repos, refs, objects int
+	for _, l := range report.Locations {
+		repos += l.Repositories
+		refs += l.References
+		objects += l.Objects
+
+		if c.Stats && l.Err == nil {
+			log.With(log.Fields{
+				"location":     l.ID,
+				"repositories": l.Repositories,
+				"references":   l.References,
+				"objects":      l.Objects,
+			}).Infof("location stats")
+		}
+	}
+
+	fields := log.Fields{
+		"locations": len(report.Locations),
+		"failed":    report.Failed,
+		"skipped":   report.Skipped,
+		"elapsed":   time.Since(start).String(),
+	}
+
+	if c.Stats {
+		fields["repositories"] = repos
+		fields["references"] = refs
+		fields["objects"] = objects
+	}
+
+	log.With(fields).Infof("maintenance finished")
+	if report.Failed > 0 {
+		var first error
+		for _, l := range report.Locations {
+			if l.Err != nil {
+				first = l.Err
+				break
+			}
+		}
+
+		return errFailed.Wrap(first, report.Failed, "locations")
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package subcmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/metrics"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// kafkaBatchTimeout is the time the results are buffered before being
+// published, kept low as they're written one by one.
+const kafkaBatchTimeout = 10 * time.Millisecond
+
+// metrics returns the gitcollector.MetricsCollector of the pool chaining the
+// configured ones, nil if there are none. The prometheus collector, if any,
+// is kept in the collection to watch the pool.
+func (c *DownloadCmd) metrics(s *collection) gitcollector.MetricsCollector {
+	var mc gitcollector.MetricsCollector
+	if c.MetricsDBURI != "" {
+		mc = setupMetrics(
+			c.MetricsDBURI,
+			c.MetricsDBTable,
+			s.orgs,
+			c.MetricsSync,
+			s.anonymizer,
+		)
+
+		log.Debugf("metrics collection activated: sync timeout %d",
+			c.MetricsSync)
+	}
+
+	// the exporters tag the rows with the run, the next collector gets the
+	// same metrics.
+	export := func(w metrics.RecordWriter) {
+		mc = metrics.NewExporter(w, &metrics.ExporterOpts{
+			Run:        s.run.ID,
+			Next:       mc,
+			Anonymizer: s.anonymizer,
+		})
+	}
+
+	if c.MetricsDBURI != "" && c.MetricsDBJobs != "" {
+		db, err := metrics.PrepareJobsDB(c.MetricsDBURI, c.MetricsDBJobs)
+		check(err, "metrics jobs database")
+
+		export(metrics.NewDBWriter(db, c.MetricsDBJobs))
+		log.Debugf("jobs recorded in the metrics table %s", c.MetricsDBJobs)
+	}
+
+	if c.MetricsCSV != "" {
+		f, w := openMetricsCSV(c.MetricsCSV)
+		s.onClose(func() { f.Close() })
+
+		export(w)
+		log.Debugf("metrics exported to %s", c.MetricsCSV)
+	}
+
+	if c.progress() {
+		s.display = progressDisplay(s.download, mc)
+		mc = s.display
+	}
+
+	if c.KafkaResults != "" {
+		export(metrics.NewKafkaWriter(kafka.NewWriter(kafka.WriterConfig{
+			Brokers:      c.kafkaBrokers(),
+			Topic:        c.KafkaResults,
+			BatchTimeout: kafkaBatchTimeout,
+		})))
+
+		log.Debugf("metrics published to kafka topic %s", c.KafkaResults)
+	}
+
+	if c.MetricsListen != "" {
+		prom, err := metrics.NewPrometheusCollector(&metrics.PrometheusOpts{
+			Addr:       c.MetricsListen,
+			APIUsage:   s.usage,
+			Anonymizer: s.anonymizer,
+			Next:       mc,
+		})
+		check(err, "unable to serve the prometheus metrics")
+
+		s.prom, mc = prom, prom
+		log.Debugf("prometheus metrics served at %s/metrics", c.MetricsListen)
+	}
+
+	return mc
+}
+
+func setupMetrics(
+	uri, table string,
+	orgs []string,
+	metricSync int64,
+	anonymizer *library.Anonymizer,
+) gitcollector.MetricsCollector {
+	// the collectors are found by the organization of the endpoints, only
+	// the names sent to the database are hashed.
+	names := make([]string, len(orgs))
+	for i, org := range orgs {
+		names[i] = anonymizer.Hash(org)
+	}
+
+	db, err := metrics.PrepareDB(uri, table, names)
+	check(err, "metrics database")
+
+	mcs := make(map[string]*metrics.Collector, len(orgs))
+	for i, org := range orgs {
+		mc := metrics.NewCollector(&metrics.CollectorOpts{
+			Log:      log.New(log.Fields{"org": names[i]}),
+			Send:     metrics.SendToDB(db, table, names[i]),
+			SyncTime: time.Duration(metricSync) * time.Second,
+		})
+
+		mcs[org] = mc
+	}
+
+	return metrics.NewCollectorByOrg(mcs)
+}
+
+// openMetricsCSV opens the file to append the metrics of the repositories,
+// the header is only written to new files.
+func openMetricsCSV(path string) (*os.File, *metrics.CSVWriter) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	check(err, "unable to open the metrics file")
+
+	info, err := f.Stat()
+	check(err, "unable to open the metrics file")
+
+	return f, metrics.NewCSVWriter(f, info.Size() == 0)
+}
@@ -0,0 +1,93 @@
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/migrate"
+	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-log.v1"
+
+	"github.com/google/uuid"
+)
+
+// MigrateCmd is the gitcollector subcommand to migrate libraries between
+// storage formats.
+type MigrateCmd struct {
+	cli.Command `name:"migrate" short-description:"migrate a library to a different storage format or layout"`
+
+	From       string `long:"from" description:"path to the library to migrate" env:"GITCOLLECTOR_MIGRATE_FROM" required:"true"`
+	FromFormat string `long:"from-format" description:"storage format of the library to migrate" env:"GITCOLLECTOR_MIGRATE_FROM_FORMAT" choice:"siva" choice:"bare" default:"siva"`
+	FromBucket int    `long:"from-bucket" description:"bucketization level of the siva library to migrate" env:"GITCOLLECTOR_MIGRATE_FROM_BUCKET" default:"2"`
+	To         string `long:"to" description:"path to the migrated library" env:"GITCOLLECTOR_MIGRATE_TO" required:"true"`
+	ToFormat   string `long:"to-format" description:"storage format of the migrated library" env:"GITCOLLECTOR_MIGRATE_TO_FORMAT" choice:"siva" choice:"bare" default:"siva"`
+	ToBucket   int    `long:"to-bucket" description:"bucketization level of the migrated siva library" env:"GITCOLLECTOR_MIGRATE_TO_BUCKET" default:"2"`
+	TmpPath    string `long:"tmp" description:"directory to place generated temporal files" default:"/tmp" env:"GITCOLLECTOR_TMP"`
+	Actor      string `long:"actor" description:"who is recorded in the audit log of the migrated library, default to user@host" env:"GITCOLLECTOR_AUDIT_ACTOR"`
+}
+
+// Execute runs the command.
+func (c *MigrateCmd) Execute(args []string) error {
+	start := time.Now()
+
+	ns := tempNamespace(c.TmpPath, uuid.New().String())
+	defer ns.Close()
+
+	temp := ns.FS()
+	src := c.store(c.From, c.FromFormat, c.FromBucket, temp)
+
+	check(os.MkdirAll(c.To, 0755), "unable to create the migrated library")
+	dstFS := osfs.New(c.To)
+	dst := c.store(c.To, c.ToFormat, c.ToBucket, temp)
+
+	cp, err := migrate.LoadCheckpoint(dstFS, migrate.CheckpointFile)
+	check(err, "unable to load the migration checkpoint")
+
+	stats, err := migrate.Migrate(context.Background(), src, dst,
+		&migrate.Opts{Checkpoint: cp},
+	)
+	check(err, "migration failed")
+
+	err = library.NewAuditLog(dstFS, "", c.Actor).Record(
+		library.AuditMigrate, "", "migration",
+		fmt.Sprintf("from %s %s library: %d migrated, %d skipped, %d failed",
+			c.FromFormat, c.From,
+			stats.Migrated, stats.Skipped, stats.Failed),
+	)
+	check(err, "unable to record the migration in the audit log")
+
+	log.With(log.Fields{
+		"migrated": stats.Migrated,
+		"skipped":  stats.Skipped,
+		"failed":   stats.Failed,
+		"elapsed":  time.Since(start).String(),
+	}).Infof("migration finished")
+
+	return nil
+}
+
+func (c *MigrateCmd) store(
+	path, format string,
+	bucket int,
+	temp billy.Filesystem,
+) migrate.Store {
+	fs := osfs.New(path)
+	if format == "bare" {
+		return migrate.NewBareStore(fs)
+	}
+
+	lib, err := siva.NewLibrary("migrate", fs, siva.LibraryOptions{
+		Bucket:        bucket,
+		Transactional: true,
+		TempFS:        temp,
+	})
+	check(err, "unable to open siva library "+path)
+
+	return migrate.NewSivaStore(lib)
+}
@@ -0,0 +1,106 @@
+package subcmd
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/src-d/gitcollector/protocol"
+	"github.com/src-d/gitcollector/proxy"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// gitProtocol installs the transport speaking the protocol version configured
+// for the hosts and connecting with the dial policy, if any. The Dialer is
+// returned to report the addresses failed, nil if it isn't used.
+func (c *DownloadCmd) gitProtocol() *protocol.Dialer {
+	dialer := c.dialer()
+	if c.GitProtocol == "" && dialer == nil {
+		return nil
+	}
+
+	var prefixes []string
+	if c.GitRefPrefixes != "" {
+		prefixes = strings.Split(c.GitRefPrefixes, ",")
+	}
+
+	hosts := protocol.Hosts{}
+	if c.GitProtocol != "" {
+		for _, hv := range strings.Split(c.GitProtocol, ",") {
+			kv := strings.SplitN(hv, "=", 2)
+			host := kv[0]
+			if host == "*" {
+				host = ""
+			}
+
+			version, _ := strconv.Atoi(kv[1])
+			hosts[host] = &protocol.HostOpts{
+				Version:       version,
+				RefPrefixes:   prefixes,
+				ServerOptions: c.GitServerOpts,
+				Filter:        c.GitFilter,
+			}
+		}
+	}
+
+	var client *http.Client
+	if dialer != nil {
+		client = dialer.Client()
+	}
+
+	protocol.Install(hosts, client)
+	return dialer
+}
+
+// dialer returns the Dialer connecting to the git servers, nil if neither a
+// dial policy nor alternate DNS servers are configured.
+func (c *DownloadCmd) dialer() *protocol.Dialer {
+	if c.DialPolicy == "" && len(c.DNSServers) == 0 {
+		return nil
+	}
+
+	var policy protocol.DialPolicy
+	if c.DialPolicy == "pin" {
+		policy = protocol.NewPinPolicy(nil)
+	}
+
+	resolvers := []protocol.Resolver{net.DefaultResolver}
+	for _, server := range c.DNSServers {
+		resolvers = append(resolvers, protocol.NewNameserverResolver(server))
+	}
+
+	retries := c.DialRetries
+	if retries == 0 {
+		retries = -1
+	}
+
+	log.Debugf("dial policy %s, %d alternate DNS servers",
+		c.DialPolicy, len(c.DNSServers))
+	opts := &protocol.DialerOpts{
+		Policy:    policy,
+		Resolvers: resolvers,
+		Retries:   retries,
+	}
+
+	if c.proxy != nil {
+		opts.Proxy = c.proxy.URL
+	}
+
+	return protocol.NewDialer(opts)
+}
+
+// installProxy makes the requests through the proxies chosen by the PAC file,
+// if any. Otherwise they follow the proxy environment variables.
+func (c *DownloadCmd) installProxy() {
+	if c.ProxyPAC == "" {
+		return
+	}
+
+	p, err := proxy.New(&proxy.Opts{PAC: c.ProxyPAC})
+	check(err, "wrong proxy configuration")
+	p.Install()
+	c.proxy = p
+
+	log.Debugf("proxies chosen by the PAC file %s", c.ProxyPAC)
+}
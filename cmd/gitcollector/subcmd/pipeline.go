@@ -0,0 +1,611 @@
+package subcmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/downloader"
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/objstore"
+	"github.com/src-d/gitcollector/postprocess"
+	"github.com/src-d/gitcollector/sandbox"
+	"github.com/src-d/gitcollector/updater"
+	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// downloadFn returns the library.JobFn processing the download jobs, wrapped
+// by the features configured.
+func (c *DownloadCmd) downloadFn(s *collection) library.JobFn {
+	// the empty repositories retried are left to the retry policies.
+	empty := library.EmptyPolicy(c.EmptyRepos)
+	fn, err := library.NewEmptyRepositoryJobFn(
+		&library.EmptyRepositoryOpts{Policy: empty},
+		c.processFn(s),
+	)
+	check(err, "wrong empty repositories policy")
+
+	fn = library.NewDiskUsageJobFn(
+		&library.DiskUsageOpts{FS: s.fs, Bucket: s.bucket},
+		fn,
+	)
+
+	// the history is measured without the waits for the memory budget.
+	if s.history != nil {
+		fn = library.NewHistoryJobFn(s.history, fn)
+	}
+
+	fn = library.NewJournaledJobFn(s.journal, fn)
+	if c.MemoryBudget > 0 || c.WorkerMemory > 0 {
+		budget := library.NewMemoryBudget(&library.MemoryBudgetOpts{
+			Total:     uint64(c.MemoryBudget) << 20,
+			PerWorker: uint64(c.WorkerMemory) << 20,
+		})
+
+		fn = library.NewMemoryBudgetJobFn(budget, fn)
+	}
+
+	if c.Probe {
+		fn = library.NewProbeJobFn(&library.ProbeOpts{
+			Timeout: time.Duration(c.ProbeTimeout) * time.Second,
+		}, fn)
+	}
+
+	if s.outage != nil {
+		fn = library.NewOutageJobFn(s.outage, fn)
+	}
+
+	return c.postprocessFn(s, fn)
+}
+
+// processFn returns the library.JobFn fetching the repositories: cloning
+// them, fetching their manifests through the API, storing their packfiles in
+// object storage or backfilling the library.
+func (c *DownloadCmd) processFn(s *collection) library.JobFn {
+	fn := downloader.Download
+	if c.Manifests != "" {
+		fn = c.manifestJobFn(s.limiter, s.usage)
+	}
+
+	if c.Packs != "" {
+		fn = c.packJobFn()
+	}
+
+	// the manifests aren't stored in the library, Validate rejects them
+	// along with --backfill.
+	if c.Backfill {
+		fn = library.NewBackfillJobFn(fn, updater.Update)
+	}
+
+	if c.Metadata {
+		var err error
+		fn, err = downloader.NewMetadataJobFn(&downloader.MetadataOpts{
+			Store:       library.NewMetadataStore(s.fs),
+			Readme:      c.MetadataReadme,
+			RateLimiter: s.limiter,
+			APIUsage:    s.usage,
+		}, fn)
+		check(err, "wrong metadata configuration")
+	}
+
+	return fn
+}
+
+// postprocessFn runs the post-processing steps configured on the stored
+// locations after every job.
+func (c *DownloadCmd) postprocessFn(
+	s *collection,
+	fn library.JobFn,
+) library.JobFn {
+	var steps []postprocess.Step
+	if c.PostVerify {
+		steps = append(steps, postprocess.VerifyObjects)
+	}
+
+	if c.PostRepack {
+		steps = append(steps, postprocess.Repack)
+	}
+
+	if c.PostCommitGraph {
+		steps = append(steps, postprocess.WriteCommitGraph)
+	}
+
+	if len(steps) == 0 {
+		return fn
+	}
+
+	pool := postprocess.NewPool(&postprocess.PoolOpts{
+		Workers: c.PostWorkers,
+	})
+	s.onClose(func() { pool.Close(false) })
+
+	return postprocess.NewJobFn(pool, fn, steps...)
+}
+
+func (c *DownloadCmd) manifestJobFn(
+	limiter *gitcollector.RateLimiter,
+	usage *gitcollector.APIUsage,
+) library.JobFn {
+	path := c.ManifestsPath
+	if path == "" {
+		path = filepath.Join(c.LibPath, "manifests")
+	}
+
+	fn, err := downloader.NewManifestJobFn(&downloader.ManifestOpts{
+		Paths:       strings.Split(c.Manifests, ","),
+		FS:          osfs.New(path),
+		RateLimiter: limiter,
+		APIUsage:    usage,
+	})
+	check(err, "wrong manifest mode configuration")
+
+	log.Debugf("manifest mode, files stored in %s", path)
+	return fn
+}
+
+// packsJournal is the directory of the library where the uploads of the
+// packfiles are kept to be resumed.
+const packsJournal = ".packs"
+
+func (c *DownloadCmd) packJobFn() library.JobFn {
+	bucket, prefix, err := c.packsBucket()
+	check(err, "wrong packs bucket")
+
+	journal := osfs.New(filepath.Join(c.LibPath, packsJournal))
+	fn, err := downloader.NewPackJobFn(&downloader.PackOpts{
+		Bucket:   bucket,
+		Prefix:   prefix,
+		Journal:  objstore.NewJournal(journal),
+		PartSize: c.PacksPartSize << 20,
+	})
+	check(err, "wrong pack mode configuration")
+
+	log.Debugf("pack mode, packfiles stored in %s", c.Packs)
+	return fn
+}
+
+// packsBucket returns the objstore.Bucket of --packs along with the prefix of
+// the keys.
+func (c *DownloadCmd) packsBucket() (objstore.Bucket, string, error) {
+	u, err := url.Parse(c.Packs)
+	if err != nil || (u.Scheme != "s3" && u.Scheme != "gs") {
+		return objstore.NewFSBucket(osfs.New(c.Packs)), "", nil
+	}
+
+	endpoint, region := c.PacksEndpoint, c.PacksRegion
+	if u.Scheme == "gs" {
+		if endpoint == "" {
+			endpoint = gcsEndpoint
+		}
+
+		if region == "" {
+			region = gcsRegion
+		}
+	}
+
+	bucket, err := objstore.NewS3Bucket(&objstore.S3Opts{
+		Endpoint:  endpoint,
+		Bucket:    u.Host,
+		Region:    region,
+		AccessKey: c.PacksAccessKey,
+		SecretKey: c.PacksSecretKey,
+	})
+	return bucket, strings.Trim(u.Path, "/"), err
+}
+
+const (
+	// gcsEndpoint and gcsRegion are the ones of the interoperability API
+	// of GCS.
+	gcsEndpoint = "https://storage.googleapis.com"
+	gcsRegion   = "auto"
+)
+
+// jobSource returns the channel the workers take the discovered jobs from.
+// With a persistent queue the discovered jobs are stored before being
+// scheduled, and acknowledged once they're processed. With --handoff-out they
+// are only written for the machines downloading them instead.
+func (c *DownloadCmd) jobSource(s *collection) chan gitcollector.Job {
+	source := s.download
+	if c.Queue != "" {
+		queue, err := gitcollector.OpenPersistentQueue(
+			c.Queue,
+			library.QueueCodec{},
+			&gitcollector.PersistentQueueOpts{
+				OnDrop: func(job gitcollector.Job, attempts int) {
+					log.Warningf("%s dropped from the queue after "+
+						"%d attempts", job, attempts)
+				},
+			},
+		)
+		check(err, "unable to open the queue")
+		s.onClose(func() {
+			if err := queue.Close(); err != nil {
+				log.Warningf("couldn't close the queue: %s", err)
+			}
+		})
+
+		go func() {
+			check(queue.Feed(s.download), "unable to store the jobs")
+		}()
+
+		s.queue = queue
+		source = queue.Jobs()
+	}
+
+	// the pool finishes once all the handed off jobs are written.
+	if c.HandoffOut != "" {
+		if c.Queue != "" {
+			check(
+				fmt.Errorf("--queue can't be used with --handoff-out"),
+				"wrong handoff configuration",
+			)
+		}
+
+		out, err := library.OpenHandoff(
+			osfs.New(c.HandoffOut), c.handoffOwner(),
+		)
+		check(err, "unable to open the handoff directory")
+
+		handed := make(chan gitcollector.Job)
+		go func() {
+			check(out.Feed(s.download), "unable to hand off the jobs")
+			close(handed)
+		}()
+
+		source = handed
+		log.Debugf("discovered jobs handed off to %s", c.HandoffOut)
+	}
+
+	if c.HandoffIn != "" {
+		handoff, err := library.OpenHandoff(
+			osfs.New(c.HandoffIn), c.handoffOwner(),
+		)
+		check(err, "unable to open the handoff directory")
+
+		n, err := handoff.Recover()
+		check(err, "unable to recover the handoff jobs")
+		if n > 0 {
+			log.Infof("%d jobs claimed by a previous run released "+
+				"to the handoff", n)
+		}
+
+		s.handoff = handoff
+	}
+
+	return source
+}
+
+// schedule returns the gitcollector.JobScheduleFn of the worker pool, giving
+// the jobs of the source to the download function once they're set up.
+func (c *DownloadCmd) schedule(
+	s *collection,
+	source chan gitcollector.Job,
+	downloadFn library.JobFn,
+) gitcollector.JobScheduleFn {
+	updateOnDownload := !c.NotAllowUpdates
+	log.Debugf("allow updates on downloads: %v", updateOnDownload)
+
+	authTokens := map[string]string{}
+	if c.Token != "" {
+		log.Debugf("acces token found")
+		for _, org := range s.orgs {
+			authTokens[org] = c.Token
+		}
+	}
+
+	schedule := library.NewDownloadJobScheduleFn(
+		s.lib,
+		source,
+		downloadFn,
+		updateOnDownload,
+		authTokens,
+		s.logger,
+		s.temp,
+	)
+
+	schedule = library.WithJobSetup(schedule, c.jobSetup(s)...)
+
+	if c.SizeOrder != "" {
+		var err error
+		schedule, err = gitcollector.NewSizeScheduleFn(
+			schedule,
+			&gitcollector.SizeScheduleOpts{
+				Size:  library.JobSize,
+				Order: gitcollector.SizeOrder(c.SizeOrder),
+			},
+		)
+		check(err, "wrong size order")
+	}
+
+	// the fair scheduling reorders the jobs, the ones of each organization
+	// keep the size order.
+	if len(s.orgs) > 1 && c.OrderedWindow <= 0 {
+		schedule = gitcollector.NewFairScheduleFn(
+			schedule,
+			&gitcollector.FairScheduleOpts{Key: library.OrgJobKey},
+		)
+	}
+
+	return schedule
+}
+
+// jobSetup returns the library.JobSetupFn preparing every scheduled job.
+func (c *DownloadCmd) jobSetup(s *collection) []library.JobSetupFn {
+	naming, err := library.NewTemplateNameFn(c.Naming)
+	check(err, "wrong naming template")
+	// the annotations of --library apply to the locations of every tier.
+	setup := []library.JobSetupFn{
+		library.WithNaming(naming),
+		library.WithStorage(s.storage),
+		library.WithAnnotations(library.NewAnnotations(s.fs)),
+		library.WithAnonymizer(s.anonymizer),
+	}
+
+	if c.IDs == "uuid" {
+		ids, err := library.NewIDMapping(
+			s.fs, library.IDMappingFile, library.UUIDProvider{},
+		)
+		check(err, "unable to load the ids mapping")
+		setup = append(setup, library.WithIDProvider(ids))
+	}
+
+	if s.queue != nil {
+		setup = append(setup, library.WithPersistentQueue(s.queue))
+	}
+
+	if s.handoff != nil {
+		setup = append(setup, library.WithHandoff(s.handoff))
+	}
+
+	setup = append(setup, c.storageSetup(s)...)
+	setup = append(setup, c.fetchSetup(s)...)
+
+	// the backfill checks the library the jobs are routed to.
+	if c.Backfill {
+		s.backfill = library.NewBackfill()
+		setup = append(setup, library.WithBackfill(s.backfill))
+	}
+
+	if s.history != nil {
+		setup = append(setup, library.WithHistory(
+			s.history,
+			library.NewHistoryPolicy(&library.HistoryPolicyOpts{
+				Slow:          time.Duration(c.HistorySlow) * time.Second,
+				FailureStreak: c.HistoryStreak,
+			}),
+		))
+	}
+
+	// the retries are set once the backfill decided the type of the jobs.
+	if retries := c.retryPolicies(); retries != nil {
+		setup = append(setup, library.WithRetryPolicies(retries))
+	}
+
+	return setup
+}
+
+// storageSetup returns the setup of how the repositories are stored in the
+// locations: the forks kept, the remotes, the merges and the tiers.
+func (c *DownloadCmd) storageSetup(s *collection) []library.JobSetupFn {
+	var setup []library.JobSetupFn
+	if c.MaxForks > 0 {
+		forks, err := library.NewForkSampler(&library.ForkSamplerOpts{
+			MaxForks: c.MaxForks,
+			Sampling: library.ForkSampling(c.ForkSampling),
+			Audit:    library.NewAuditLog(s.fs, "", c.Actor),
+		})
+		check(err, "wrong fork sampling")
+
+		setup = append(setup, library.WithForkSampler(forks))
+	}
+
+	if c.LocRemotes != "" {
+		remotes, err := library.ParseRemotesPolicy(c.LocRemotes)
+		check(err, "wrong location remotes policy")
+		setup = append(setup, library.WithRemotesPolicy(remotes))
+	}
+
+	if c.MergeLocations {
+		setup = append(setup,
+			library.WithLocationMerger(library.NewLocationMerger()))
+	}
+
+	if c.NonRooted {
+		var sharing *library.ObjectSharing
+		if c.ShareObjects {
+			sharing = library.NewObjectSharing(s.fs, s.bucket)
+		}
+
+		setup = append(setup, library.WithNonRooted(sharing))
+	}
+
+	if c.TierRules != "" {
+		setup = append(setup, c.storageTiers(s.libOpts))
+	}
+
+	return setup
+}
+
+// fetchSetup returns the setup of how the repositories are fetched: the
+// negotiation, the pull requests, the increments and the sandbox.
+func (c *DownloadCmd) fetchSetup(s *collection) []library.JobSetupFn {
+	var setup []library.JobSetupFn
+	if c.Negotiation != "" || c.NegDepth > 0 || c.NegRemoteOnly {
+		negotiation, err := library.NewNegotiation(&library.NegotiationOpts{
+			Algorithm:  library.NegotiationAlgorithm(c.Negotiation),
+			Depth:      c.NegDepth,
+			RemoteOnly: c.NegRemoteOnly,
+		})
+		check(err, "wrong negotiation")
+
+		setup = append(setup, library.WithNegotiation(negotiation))
+	}
+
+	if c.PullRequests != "" {
+		prs, err := library.ParsePullRequestRefs(c.PullRequests)
+		check(err, "wrong pull request references")
+		setup = append(setup, library.WithPullRequestRefs(prs))
+	}
+
+	if c.Incremental {
+		setup = append(setup, library.WithIncrementalFetch(
+			library.NewIncrementalFetch(&library.IncrementalOpts{
+				FS:      s.fs,
+				MinSize: uint64(c.IncrMinSize) << 20,
+				Commits: c.IncrCommits,
+				Window:  time.Duration(c.IncrWindow) * 24 * time.Hour,
+				Budget:  time.Duration(c.IncrBudget) * time.Second,
+			}),
+		))
+	}
+
+	if c.Sandbox {
+		sb, err := sandbox.New(&sandbox.Opts{
+			Chroot:   true,
+			NoExec:   true,
+			Cgroup:   c.SandboxCgroup,
+			Memory:   int64(c.SandboxMemory) << 20,
+			CPU:      c.SandboxCPUs,
+			Pids:     c.SandboxPids,
+			Files:    uint64(c.SandboxFiles),
+			FileSize: uint64(c.SandboxFileSize) << 20,
+		})
+		check(err, "unable to sandbox the clones")
+
+		setup = append(setup, library.WithSandbox(sb))
+	}
+
+	return setup
+}
+
+func (c *DownloadCmd) storageTiers(
+	libOpts siva.LibraryOptions,
+) library.JobSetupFn {
+	var tiers []*library.StorageTier
+	if c.Tiers != "" {
+		for _, t := range strings.Split(c.Tiers, ",") {
+			parts := strings.SplitN(t, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				check(
+					fmt.Errorf("%q isn't name=path", t),
+					"wrong storage tiers",
+				)
+			}
+
+			name, path := parts[0], parts[1]
+			fs := osfs.New(path)
+			layout, err := library.DetectLayout(fs)
+			check(err, "unable to inspect the storage tier library")
+
+			opts := libOpts
+			opts.Bucket, err = layout.Negotiate(
+				fs, c.libBucket(layout), library.LibraryMode(c.LibMode),
+			)
+			check(err, "incompatible storage tier library")
+
+			lib, err := siva.NewLibrary(name, fs, opts)
+			check(err, "unable to create storage tier library")
+
+			tiers = append(tiers, &library.StorageTier{
+				Name: name,
+				Lib:  lib,
+			})
+		}
+	}
+
+	f, err := os.Open(c.TierRules)
+	check(err, "unable to open the storage tier rules")
+	defer f.Close()
+
+	rules, err := library.ParseTierRules(f)
+	check(err, "wrong storage tier rules")
+
+	setup, err := library.WithStorageTiers(tiers, rules)
+	check(err, "wrong storage tier rules")
+
+	log.Debugf("%d storage tiers, %d rules", len(tiers), len(rules))
+	return setup
+}
+
+// shutdownFns returns the cleanups run once the worker pool is stopped.
+func (c *DownloadCmd) shutdownFns(s *collection) []gitcollector.ShutdownFn {
+	fns := []gitcollector.ShutdownFn{
+		library.NewTempShutdownFn(s.ns),
+		library.NewJournalShutdownFn(s.journal),
+	}
+
+	if s.queue != nil {
+		fns = append(fns, gitcollector.NewQueueShutdownFn(s.queue))
+	}
+
+	if s.handoff != nil {
+		fns = append(fns, library.NewHandoffShutdownFn(s.handoff))
+	}
+
+	return fns
+}
+
+// policies returns the gitcollector.Policies applied to every job, nil if
+// there are none.
+func (c *DownloadCmd) policies() *gitcollector.Policies {
+	var policies gitcollector.Policies
+	if c.JobRetries > 0 {
+		policies.Retry = c.retryPolicy(c.JobRetries)
+	}
+
+	if c.JobRate > 0 {
+		policies.RateLimit = &gitcollector.RateLimitPolicy{
+			Limiter: gitcollector.NewRateLimiter(
+				&gitcollector.RateLimiterOpts{Sustained: c.JobRate},
+			),
+		}
+	}
+
+	if policies == (gitcollector.Policies{}) {
+		return nil
+	}
+
+	return &policies
+}
+
+// retryPolicies returns the gitcollector.RetryPolicy of the download and update
+// jobs overriding the one of --job-retries, nil if there are none.
+func (c *DownloadCmd) retryPolicies() library.RetryPolicies {
+	policies := library.RetryPolicies{}
+	if c.DownloadRetries > 0 {
+		policies[library.JobDownload] = c.retryPolicy(c.DownloadRetries)
+	}
+
+	if c.UpdateRetries > 0 {
+		policies[library.JobUpdate] = c.retryPolicy(c.UpdateRetries)
+	}
+
+	if len(policies) == 0 {
+		return nil
+	}
+
+	return policies
+}
+
+// retryPolicy returns the gitcollector.RetryPolicy retrying a job the given
+// times, the empty repositories too with --empty-repos=retry.
+func (c *DownloadCmd) retryPolicy(retries int) *gitcollector.RetryPolicy {
+	policy := &gitcollector.RetryPolicy{
+		Attempts:   retries + 1,
+		MinBackoff: time.Duration(c.JobRetryDelay) * time.Second,
+		MaxBackoff: time.Duration(c.JobRetryMax) * time.Second,
+		Factor:     c.JobRetryFactor,
+	}
+
+	if library.EmptyPolicy(c.EmptyRepos) == library.EmptyRetry {
+		policy.Retryable = library.EmptyRetryable
+	}
+
+	return policy
+}
@@ -0,0 +1,432 @@
+package subcmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/discovery"
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/simulation"
+	"golang.org/x/oauth2"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// providerOpts returns the options of the github providers.
+func (c *DownloadCmd) providerOpts() discovery.GHProviderOpts {
+	return discovery.GHProviderOpts{
+		DedupWindow:     c.DedupWindow,
+		RetryInterleave: c.RetryInterleave,
+		Filter:          c.filter(),
+	}
+}
+
+// discoveryOpts returns the options of the github providers discovering the
+// organizations and the starred repositories, resuming their listings from
+// the cursors.
+func (c *DownloadCmd) discoveryOpts(s *collection) discovery.GHProviderOpts {
+	opts := c.providerOpts()
+	opts.Cursors = s.cursors
+	return opts
+}
+
+// cursors returns the store of the positions of the listings, nil if neither
+// --cursors-file nor --cursors-db are given.
+func (c *DownloadCmd) cursors(s *collection) discovery.CursorStore {
+	switch {
+	case c.CursorsDBURI != "":
+		db, err := discovery.PrepareCursorsDB(
+			c.CursorsDBURI, c.CursorsDBTable,
+		)
+		check(err, "unable to prepare the cursors database")
+		s.onClose(func() { db.Close() })
+		return discovery.NewDBCursorStore(db, c.CursorsDBTable)
+	case c.CursorsFile != "":
+		store, err := discovery.NewFileCursorStore(c.CursorsFile)
+		check(err, "unable to load the cursors")
+		return store
+	default:
+		return nil
+	}
+}
+
+// iterOpts returns the options of the iterators of the github repositories.
+func (c *DownloadCmd) iterOpts(s *collection) *discovery.GHReposIterOpts {
+	return &discovery.GHReposIterOpts{
+		AuthToken:   c.Token,
+		TokenSource: s.app,
+		Outage:      s.outage,
+		RateLimiter: s.limiter,
+		APIUsage:    s.usage,
+	}
+}
+
+// reposIter returns the builder of the iterators discovering the repositories
+// of an organization, the synthetic ones in simulation mode.
+func (c *DownloadCmd) reposIter(
+	s *collection,
+) func(org string) discovery.GHRepositoriesIter {
+	if c.Simulate {
+		return c.simulation(s.orgs)
+	}
+
+	return func(org string) discovery.GHRepositoriesIter {
+		return discovery.NewGHOrgReposIter(org, c.iterOpts(s))
+	}
+}
+
+// starredIters returns the iterators of the repositories starred by the
+// users of --starred.
+func (c *DownloadCmd) starredIters(
+	s *collection,
+) []*discovery.GHStarredReposIter {
+	var iters []*discovery.GHStarredReposIter
+	for _, user := range s.starred {
+		iters = append(iters,
+			discovery.NewGHStarredReposIter(user, c.iterOpts(s)))
+	}
+
+	return iters
+}
+
+// providers returns the providers discovering the repositories besides the
+// github organizations and stars.
+func (c *DownloadCmd) providers(
+	s *collection,
+	adhoc *discovery.AdhocProvider,
+) []statusProvider {
+	var providers []statusProvider
+	if c.Plugin != "" {
+		providers = append(providers, discovery.NewPluginProvider(
+			c.Plugin,
+			s.download,
+			&discovery.PluginProviderOpts{
+				Args:   c.PluginArgs,
+				Stderr: os.Stderr,
+			},
+		))
+	}
+
+	if c.List != "" {
+		list := discovery.NewListProvider(
+			c.List,
+			s.download,
+			&discovery.ListProviderOpts{
+				Follow:   c.ListFollow,
+				Interval: time.Duration(c.ListInterval) * time.Second,
+			},
+		)
+
+		if c.ListFollow {
+			go reloadOnHangup(list)
+		}
+
+		providers = append(providers, list)
+	}
+
+	if c.Modules != "" {
+		providers = append(providers, discovery.NewModuleProvider(
+			c.Modules, s.download, nil,
+		))
+	}
+
+	if c.KafkaTopic != "" {
+		providers = append(providers, discovery.NewKafkaProvider(
+			c.kafkaBrokers(),
+			c.KafkaTopic,
+			s.download,
+			&discovery.KafkaProviderOpts{Group: c.KafkaGroup},
+		))
+	}
+
+	if adhoc != nil {
+		providers = append(providers, adhoc)
+	}
+
+	if s.handoff != nil {
+		providers = append(providers, discovery.NewHandoffProvider(
+			s.handoff,
+			s.download,
+			&discovery.HandoffProviderOpts{
+				Interval: time.Duration(c.HandoffEvery) * time.Second,
+			},
+		))
+	}
+
+	return providers
+}
+
+// simulation installs the synthetic repositories and returns the builder of
+// the iterators discovering them.
+func (c *DownloadCmd) simulation(
+	orgs []string,
+) func(org string) discovery.GHRepositoriesIter {
+	sim := simulation.New(&simulation.Opts{
+		Orgs:       orgs,
+		Repos:      c.SimRepos,
+		Seed:       c.SimSeed,
+		MaxCommits: c.SimCommits,
+		Forks:      c.SimForks,
+		Latency:    time.Duration(c.SimLatency) * time.Millisecond,
+	})
+
+	sim.Install()
+	log.Infof("simulation mode, %d synthetic repositories",
+		len(sim.Repositories()))
+
+	return func(org string) discovery.GHRepositoriesIter {
+		return sim.OrgIter(org)
+	}
+}
+
+// filter returns the filter of the discovered repositories, nil if all of them
+// are downloaded.
+func (c *DownloadCmd) filter() discovery.FilterFn {
+	var filters []discovery.FilterFn
+	if c.Languages != "" {
+		filters = append(filters,
+			discovery.FilterLanguages(strings.Split(c.Languages, ",")...))
+	}
+
+	if c.MaxRepoSize > 0 {
+		filters = append(filters,
+			discovery.FilterMaxSize(uint64(c.MaxRepoSize)*1024*1024))
+	}
+
+	if c.SkipForks {
+		filters = append(filters, discovery.FilterNotFork())
+	}
+
+	if c.SkipArchived {
+		filters = append(filters, discovery.FilterNotArchived())
+	}
+
+	return discovery.AllFilters(filters...)
+}
+
+// appTokenSource returns the source of the installation tokens of the github
+// App, nil if no App is given.
+func (c *DownloadCmd) appTokenSource() oauth2.TokenSource {
+	if c.AppID == 0 {
+		return nil
+	}
+
+	key, err := ioutil.ReadFile(c.AppKey)
+	check(err, "unable to read the github app private key")
+
+	ts, err := discovery.NewGHAppTokenSource(&discovery.GHAppAuth{
+		AppID:          c.AppID,
+		InstallationID: c.AppInstall,
+		PrivateKey:     key,
+	})
+	check(err, "wrong github app")
+
+	log.Debugf("github app %d found", c.AppID)
+	return ts
+}
+
+func (c *DownloadCmd) kafkaBrokers() []string {
+	if c.KafkaBrokers == "" {
+		return nil
+	}
+
+	return strings.Split(c.KafkaBrokers, ",")
+}
+
+// reloadOnHangup reads the list again every time a SIGHUP is received.
+func reloadOnHangup(list *discovery.ListProvider) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		log.Debugf("SIGHUP received, reading the list again")
+		list.Reload()
+	}
+}
+
+// statusProvider is a provider reporting its state.
+type statusProvider interface {
+	gitcollector.Provider
+	gitcollector.ProviderStatus
+}
+
+func runGHOrgProviders(
+	ctx context.Context,
+	logger log.Logger,
+	orgs []string,
+	newIter func(org string) discovery.GHRepositoriesIter,
+	download chan gitcollector.Job,
+	pending []*library.Job,
+	failed func(error),
+	watch func(...gitcollector.ProviderStatus),
+	providerOpts discovery.GHProviderOpts,
+	orgConcurrency int,
+	starred []*discovery.GHStarredReposIter,
+	others []statusProvider,
+) {
+	for _, job := range pending {
+		job.Type = library.JobDownload
+		download <- job
+	}
+
+	var (
+		wg        sync.WaitGroup
+		progress  = discovery.NewDiscoveryProgress()
+		providers []gitcollector.ProviderStatus
+	)
+
+	if len(orgs) > 0 {
+		p := discovery.NewMultiOrgProvider(
+			download, orgs, newIter,
+			&discovery.MultiOrgProviderOpts{
+				Concurrency: orgConcurrency,
+				Provider:    providerOpts,
+				Progress:    progress,
+				OnDone: func(org string, err error) {
+					if err != nil {
+						logger.Warningf(err.Error())
+						failed(err)
+					}
+
+					logger.Debugf("%s organization provider stopped", org)
+					logProgress(logger, progress)
+				},
+			},
+		)
+
+		providers = append(providers, p)
+		wg.Add(1)
+		go func() {
+			// the failures are reported by organization.
+			gitcollector.StartProvider(ctx, p)
+			wg.Done()
+		}()
+
+		logger.Debugf("provider of %d organizations started", len(orgs))
+	}
+
+	wg.Add(len(starred))
+	for _, s := range starred {
+		name := s.Status().Name
+		opts := providerOpts
+		p := discovery.NewGHProvider(
+			download,
+			progress.Iter(name, s),
+			&opts,
+		)
+
+		providers = append(providers, p)
+		go func() {
+			err := gitcollector.StartProvider(ctx, p)
+			if err != nil && ctx.Err() == nil &&
+				!discovery.ErrNewRepositoriesNotFound.Is(err) {
+				logger.Warningf(err.Error())
+				failed(err)
+			}
+
+			progress.Done(name, err)
+			logger.Debugf("%s provider stopped", name)
+			logProgress(logger, progress)
+			wg.Done()
+		}()
+
+		logger.Debugf("%s provider started", name)
+	}
+
+	wg.Add(len(others))
+	for _, o := range others {
+		p := o
+		providers = append(providers, p)
+		go func() {
+			err := gitcollector.StartProvider(ctx, p)
+			if err != nil && !gitcollector.ErrProviderStopped.Is(err) {
+				logger.Warningf(err.Error())
+				failed(err)
+			}
+
+			state := p.Status()
+			logger.With(log.Fields{
+				"discovered": state.Discovered,
+			}).Debugf("%s provider stopped", state.Name)
+			wg.Done()
+		}()
+
+		logger.Debugf("%s provider started", p.Status().Name)
+	}
+
+	watch(providers...)
+	stop := make(chan struct{})
+	go logProviders(logger, providers, stop)
+
+	wg.Wait()
+	close(stop)
+	close(download)
+}
+
+const providersLogInterval = time.Minute
+
+// logProviders logs periodically the state of the running providers.
+func logProviders(
+	logger log.Logger,
+	providers []gitcollector.ProviderStatus,
+	stop <-chan struct{},
+) {
+	ticker := time.NewTicker(providersLogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		for _, p := range providers {
+			s := p.Status()
+			if s.Done {
+				continue
+			}
+
+			fields := log.Fields{
+				"provider":   s.Name,
+				"discovered": s.Discovered,
+				"cursor":     s.Cursor,
+			}
+
+			if s.RateLimitRemaining >= 0 {
+				fields["rate_limit_remaining"] = s.RateLimitRemaining
+				fields["rate_limit_reset"] = s.RateLimitReset.
+					Format(time.RFC3339)
+			}
+
+			if s.LastError != nil {
+				fields["last_error"] = s.LastError.Error()
+				fields["last_error_time"] = s.LastErrorTime.
+					Format(time.RFC3339)
+			}
+
+			logger.With(fields).Infof("provider status")
+		}
+	}
+}
+
+func logProgress(logger log.Logger, progress *discovery.DiscoveryProgress) {
+	var done, discovered int
+	orgs := progress.Orgs()
+	for _, op := range orgs {
+		discovered += op.Discovered
+		if op.Done {
+			done++
+		}
+	}
+
+	logger.With(log.Fields{
+		"orgs":       len(orgs),
+		"done":       done,
+		"discovered": discovered,
+	}).Infof("discovery progress")
+}
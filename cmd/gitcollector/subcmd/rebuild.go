@@ -0,0 +1,117 @@
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// errUnrecoverable is returned when the rebuild leaves locations untouched
+// because none of their indexes is good.
+var errUnrecoverable = errors.NewKind("%d locations without a good index")
+
+// RebuildCmd is the gitcollector subcommand to regenerate the state of a
+// library lost or corrupted from its siva files.
+type RebuildCmd struct {
+	cli.Command `name:"rebuild" short-description:"scan an existing library from disk regenerating its metadata, checkpoints and id mapping"`
+
+	LibPath   string `long:"library" description:"path to the library" env:"GITCOLLECTOR_LIBRARY" required:"true"`
+	LibBucket int    `long:"bucket" description:"library bucketization level, detected from the library by default" env:"GITCOLLECTOR_LIBRARY_BUCKET" default:"-1"`
+	DryRun    bool   `long:"dry-run" description:"report what would be rebuilt without modifying the library"`
+	Actor     string `long:"actor" description:"who is recorded in the audit log of the library, default to user@host" env:"GITCOLLECTOR_AUDIT_ACTOR"`
+}
+
+// Execute runs the command.
+func (c *RebuildCmd) Execute(args []string) error {
+	start := time.Now()
+
+	info, err := os.Stat(c.LibPath)
+	check(err, "wrong path to locate the library")
+
+	if !info.IsDir() {
+		check(
+			fmt.Errorf("%s isn't a directory", c.LibPath),
+			"wrong path to locate the library",
+		)
+	}
+
+	// the layout isn't detected, the metadata of the library could be
+	// unreadable.
+	fs := osfs.New(c.LibPath)
+	report, err := library.Rebuild(
+		context.Background(),
+		fs,
+		&library.RebuildOpts{
+			Bucket: c.LibBucket,
+			DryRun: c.DryRun,
+			Audit:  library.NewAuditLog(fs, "", c.Actor),
+		},
+	)
+	check(err, "rebuild failed")
+
+	for _, id := range report.Checkpoints {
+		log.With(log.Fields{"location": id}).
+			Infof("unusable checkpoint removed")
+	}
+
+	for _, id := range report.Truncated {
+		log.With(log.Fields{"location": id}).
+			Warningf("partial write truncated to the last good index")
+	}
+
+	for _, id := range report.Unrecoverable {
+		log.With(log.Fields{"location": id}).
+			Warningf("no good index found, location left untouched")
+	}
+
+	for id, err := range report.Failed {
+		log.With(log.Fields{"location": id}).
+			Errorf(err, "unable to scan the repositories")
+	}
+
+	for _, err := range report.Conflicts {
+		log.Warningf("id mapping kept: %s", err)
+	}
+
+	if report.Metadata {
+		log.Infof("library metadata written")
+	}
+
+	log.With(log.Fields{
+		"dry-run":       c.DryRun,
+		"locations":     report.Locations,
+		"repositories":  report.Repositories,
+		"mappings":      report.Mappings,
+		"checkpoints":   len(report.Checkpoints),
+		"truncated":     len(report.Truncated),
+		"unrecoverable": len(report.Unrecoverable),
+		"failed":        len(report.Failed),
+		"elapsed":       time.Since(start).String(),
+	}).Infof("rebuild finished")
+
+	if len(report.Failed) > 0 {
+		ids := make([]string, 0, len(report.Failed))
+		for id := range report.Failed {
+			ids = append(ids, string(id))
+		}
+		sort.Strings(ids)
+
+		first := report.Failed[borges.LocationID(ids[0])]
+		return errFailed.Wrap(first, len(ids), "locations")
+	}
+
+	if len(report.Unrecoverable) > 0 {
+		return errUnrecoverable.New(len(report.Unrecoverable))
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package subcmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/admin"
+	"github.com/src-d/gitcollector/api"
+	"github.com/src-d/gitcollector/console"
+	"github.com/src-d/gitcollector/discovery"
+	"github.com/src-d/gitcollector/export"
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/smarthttp"
+	"golang.org/x/crypto/ssh/terminal"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// adminAPIs tells whether the admin or the grpc API is served.
+func (c *DownloadCmd) adminAPIs() bool {
+	return c.AdminListen != "" || c.GRPCListen != ""
+}
+
+// serveAPIs serves the admin and grpc APIs of the pool, if configured. The
+// AdhocProvider receiving the jobs submitted to them is returned, nil unless
+// --admin-jobs is given.
+func (c *DownloadCmd) serveAPIs(
+	s *collection,
+	wp *gitcollector.WorkerPool,
+	newIter func(org string) discovery.GHRepositoriesIter,
+) *discovery.AdhocProvider {
+	if !c.adminAPIs() {
+		return nil
+	}
+
+	var adhoc *discovery.AdhocProvider
+	opts := &admin.ServerOpts{Addr: c.AdminListen, Events: s.events}
+	if c.AdminJobs {
+		adhoc = discovery.NewAdhocProvider(
+			s.download,
+			&discovery.AdhocProviderOpts{
+				NewIter:  newIter,
+				Provider: c.providerOpts(),
+			},
+		)
+		opts.Enqueuer = adhoc
+	}
+
+	// the grpc API shares the failures and the jobs of the admin one, even
+	// if it isn't served.
+	server, err := admin.NewServer(wp, opts)
+	check(err, "unable to serve the admin api")
+	server.Start()
+	s.onClose(func() { server.Close() })
+	s.admin = server
+
+	if c.AdminListen != "" {
+		log.Debugf("admin api served at %s", c.AdminListen)
+	}
+
+	if c.GRPCListen == "" {
+		return adhoc
+	}
+
+	gopts := &api.ServerOpts{
+		Addr:    c.GRPCListen,
+		Admin:   server,
+		Events:  s.events,
+		Library: s.lib,
+		LibraryOpts: &export.LibraryOpts{
+			FS:     s.fs,
+			Bucket: s.bucket,
+		},
+	}
+
+	if adhoc != nil {
+		gopts.Discoverer = adhoc
+	}
+
+	grpcServer, err := api.NewServer(wp, gopts)
+	check(err, "unable to serve the grpc api")
+	grpcServer.Start()
+	s.onClose(func() { grpcServer.Close() })
+
+	log.Debugf("grpc api served at %s", c.GRPCListen)
+	return adhoc
+}
+
+// watchProviders reports the states of the running providers in the admin and
+// grpc APIs, if they're served.
+func (s *collection) watchProviders(
+	providers ...gitcollector.ProviderStatus,
+) {
+	if s.admin != nil {
+		s.admin.WatchProviders(providers...)
+	}
+}
+
+// serveRepositories serves the repositories of the library over the git smart
+// HTTP protocol, if configured.
+func (c *DownloadCmd) serveRepositories(s *collection) {
+	if c.GitListen == "" {
+		return
+	}
+
+	// the locations linked to an object pool by earlier runs are served
+	// even without --share-objects.
+	server, err := smarthttp.NewServer(s.lib, &smarthttp.ServerOpts{
+		Addr:    c.GitListen,
+		Sharing: library.NewObjectSharing(s.fs, s.bucket),
+	})
+	check(err, "unable to serve the repositories")
+	server.Start()
+	s.onClose(func() { server.Close() })
+
+	log.Debugf("repositories served at %s", c.GitListen)
+}
+
+// writeHeartbeats writes the activity of the workers to the heartbeat file
+// until the collection finishes, if configured.
+func (c *DownloadCmd) writeHeartbeats(
+	s *collection,
+	wp *gitcollector.WorkerPool,
+) {
+	if c.HeartbeatFile == "" {
+		return
+	}
+
+	hb := gitcollector.NewHeartbeatWriter(wp, &gitcollector.HeartbeatOpts{
+		Path:       c.HeartbeatFile,
+		Interval:   time.Duration(c.HeartbeatEvery) * time.Second,
+		StuckAfter: time.Duration(c.HeartbeatStuck) * time.Second,
+	})
+	s.onClose(hb.Stop)
+
+	go func() {
+		if err := hb.Start(); err != nil {
+			log.Errorf(err, "couldn't write the heartbeat file")
+		}
+	}()
+
+	log.Debugf("heartbeats written to %s", c.HeartbeatFile)
+}
+
+// progress tells whether the progress is drawn in the standard output.
+func (c *DownloadCmd) progress() bool {
+	switch c.Progress {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+
+	return terminal.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// progressDisplay returns the console.Display drawing the activity of the
+// pool in the standard output, sending the metrics to the given collector.
+func progressDisplay(
+	queue chan gitcollector.Job,
+	mc gitcollector.MetricsCollector,
+) *console.Display {
+	opts := &console.DisplayOpts{
+		Out:    os.Stdout,
+		Queued: func() int { return len(queue) },
+		Next:   mc,
+	}
+
+	if width, _, err := terminal.GetSize(int(os.Stdout.Fd())); err == nil {
+		opts.Width = width
+	}
+
+	return console.NewDisplay(opts)
+}
+
+// drawProgress sets the pool whose workers the progress draws, if it's drawn.
+// It's drawn along with the metrics of the pool, until the collection
+// finishes.
+func (c *DownloadCmd) drawProgress(
+	s *collection,
+	wp *gitcollector.WorkerPool,
+) {
+	if s.display != nil {
+		s.display.Watch(wp)
+	}
+}
@@ -0,0 +1,91 @@
+package subcmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// TrashCmd is the gitcollector subcommand to manage the soft deleted
+// locations of a library.
+type TrashCmd struct {
+	cli.Command `name:"trash" short-description:"list, delete, restore or purge soft deleted locations of a library"`
+
+	LibPath   string `long:"library" description:"path to the library" env:"GITCOLLECTOR_LIBRARY" required:"true"`
+	LibBucket int    `long:"bucket" description:"library bucketization level, detected from the library by default" env:"GITCOLLECTOR_LIBRARY_BUCKET" default:"-1"`
+	Delete    string `long:"delete" description:"location to move to the trash"`
+	Reason    string `long:"reason" description:"reason recorded for the deleted location" default:"manual"`
+	Restore   string `long:"restore" description:"location to restore from the trash"`
+	Purge     bool   `long:"purge" description:"permanently remove the locations deleted before the grace period"`
+	Grace     int    `long:"grace" description:"days the deleted locations are kept before being purged" env:"GITCOLLECTOR_TRASH_GRACE" default:"30"`
+	Actor     string `long:"actor" description:"who is recorded in the audit log of the library, default to user@host" env:"GITCOLLECTOR_AUDIT_ACTOR"`
+}
+
+// Execute runs the command.
+func (c *TrashCmd) Execute(args []string) error {
+	info, err := os.Stat(c.LibPath)
+	check(err, "wrong path to locate the library")
+
+	if !info.IsDir() {
+		check(
+			fmt.Errorf("%s isn't a directory", c.LibPath),
+			"wrong path to locate the library",
+		)
+	}
+
+	fs := osfs.New(c.LibPath)
+	layout, err := library.DetectLayout(fs)
+	check(err, "unable to inspect the library")
+
+	bucket, err := layout.Negotiate(
+		fs, c.LibBucket, library.LibraryCompatible,
+	)
+	check(err, "incompatible library")
+
+	trash := library.NewTrash(fs, &library.TrashOpts{
+		Bucket: bucket,
+		Grace:  time.Duration(c.Grace) * 24 * time.Hour,
+		Audit:  library.NewAuditLog(fs, "", c.Actor),
+	})
+
+	if c.Delete != "" {
+		_, err := trash.Delete(borges.LocationID(c.Delete), c.Reason)
+		check(err, "unable to delete the location")
+		log.With(log.Fields{"location": c.Delete}).
+			Infof("location moved to the trash")
+	}
+
+	if c.Restore != "" {
+		err := trash.Restore(borges.LocationID(c.Restore))
+		check(err, "unable to restore the location")
+		log.With(log.Fields{"location": c.Restore}).
+			Infof("location restored")
+	}
+
+	if c.Purge {
+		purged, err := trash.Purge()
+		check(err, "unable to purge the trash")
+		for _, ts := range purged {
+			log.With(log.Fields{"location": ts.LocationID}).
+				Infof("location purged")
+		}
+	}
+
+	list, err := trash.List()
+	check(err, "unable to list the trash")
+	for _, ts := range list {
+		log.With(log.Fields{
+			"location": ts.LocationID,
+			"reason":   ts.Reason,
+			"deleted":  ts.Deleted.Format(time.RFC3339),
+		}).Infof("deleted location")
+	}
+
+	return nil
+}
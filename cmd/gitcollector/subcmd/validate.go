@@ -0,0 +1,658 @@
+package subcmd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/discovery"
+	"github.com/src-d/gitcollector/objstore"
+)
+
+// downloadQueueSize is the capacity of the queue of the download jobs.
+const downloadQueueSize = 100
+
+// Validate checks the configuration of the download before anything starts,
+// returning a gitcollector.ConfigError with all the wrong or contradictory
+// settings found.
+func (c *DownloadCmd) Validate() error {
+	var cerr gitcollector.ConfigError
+
+	c.validatePaths(&cerr)
+	c.validateDiscovery(&cerr)
+
+	if c.Workers < 0 {
+		cerr.Add("--workers", "can't be negative, got %d", c.Workers)
+	} else if c.Workers == 1 && c.HalfCPU {
+		cerr.Add("--half-cpu", "can't halve a single worker")
+	}
+
+	if c.LibBucket < -1 {
+		cerr.Add("--bucket", "can't be lower than -1, got %d", c.LibBucket)
+	}
+
+	for _, f := range []struct {
+		name  string
+		value int
+	}{
+		{"--object-cache-size", c.ObjectCacheSize},
+		{"--shared-object-cache-size", c.SharedCache},
+		{"--max-open-descriptors", c.MaxDescriptors},
+		{"--memory-budget", c.MemoryBudget},
+		{"--worker-memory", c.WorkerMemory},
+		{"--post-workers", c.PostWorkers},
+		{"--max-forks", c.MaxForks},
+		{"--outage-threshold", c.OutageThreshold},
+		{"--ordered-window", c.OrderedWindow},
+		{"--dedup-window", c.DedupWindow},
+		{"--retry-interleave", c.RetryInterleave},
+		{"--org-concurrency", c.OrgConcurrency},
+		{"--max-repo-size", c.MaxRepoSize},
+		{"--negotiation-depth", c.NegDepth},
+		{"--incremental-min-size", c.IncrMinSize},
+		{"--incremental-commits", c.IncrCommits},
+		{"--incremental-window", c.IncrWindow},
+		{"--incremental-budget", c.IncrBudget},
+		{"--list-interval", c.ListInterval},
+		{"--dial-retries", c.DialRetries},
+		{"--job-retries", c.JobRetries},
+		{"--job-retry-delay", c.JobRetryDelay},
+		{"--job-retry-max-delay", c.JobRetryMax},
+		{"--download-retries", c.DownloadRetries},
+		{"--update-retries", c.UpdateRetries},
+		{"--history-slow", c.HistorySlow},
+		{"--history-failure-streak", c.HistoryStreak},
+		{"--job-timeout", c.JobTimeout},
+		{"--drain-timeout", c.DrainTimeout},
+		{"--sandbox-memory", c.SandboxMemory},
+		{"--sandbox-pids", c.SandboxPids},
+		{"--sandbox-files", c.SandboxFiles},
+		{"--sandbox-file-size", c.SandboxFileSize},
+	} {
+		if f.value < 0 {
+			cerr.Add(f.name, "can't be negative, got %d", f.value)
+		}
+	}
+
+	if c.MemoryBudget > 0 && c.WorkerMemory > c.MemoryBudget {
+		cerr.Add("--worker-memory",
+			"%d MiB is bigger than the --memory-budget of %d MiB",
+			c.WorkerMemory, c.MemoryBudget)
+	}
+
+	if c.EmptyRepos == "retry" && c.JobRetries <= 0 && c.DownloadRetries <= 0 {
+		cerr.Add("--empty-repos",
+			"retry requires --job-retries or --download-retries")
+	}
+
+	if c.ForkSampling == "random" && c.MaxForks == 0 {
+		cerr.Add("--fork-sampling",
+			"forks are only sampled with --max-forks")
+	}
+
+	if c.SkipForks && c.MaxForks > 0 {
+		cerr.Add("--max-forks", "the forks are skipped by --skip-forks")
+	}
+
+	if c.SizeOrder != "" && c.OrderedWindow > 0 {
+		cerr.Add("--size-order",
+			"can't reorder the repositories with --ordered-window")
+	}
+
+	negotiation := c.Negotiation != "" || c.NegDepth > 0 || c.NegRemoteOnly
+	if negotiation && c.NotAllowUpdates {
+		cerr.Add("--negotiation",
+			"only applies to the updates, disabled by --no-updates")
+	}
+
+	if c.OutageThreshold > 0 && c.OutageProbe <= 0 {
+		cerr.Add("--outage-probe-interval",
+			"must be positive when the outage detection is enabled")
+	}
+
+	if c.Probe && c.ProbeTimeout <= 0 {
+		cerr.Add("--probe-timeout", "must be positive to probe")
+	}
+
+	postprocess := c.PostVerify || c.PostRepack || c.PostCommitGraph
+	if c.Manifests != "" && postprocess {
+		cerr.Add("--manifests",
+			"doesn't store repositories, they can't be post-processed")
+	}
+
+	if c.Manifests != "" && c.MergeLocations {
+		cerr.Add("--manifests",
+			"doesn't store repositories, they can't be merged")
+	}
+
+	if c.NonRooted {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"--max-forks", c.MaxForks > 0},
+			{"--merge-locations", c.MergeLocations},
+		} {
+			if f.set {
+				cerr.Add(f.name, "the forks aren't stored in the "+
+					"same location with --non-rooted")
+			}
+		}
+	}
+
+	if c.ShareObjects {
+		if !c.NonRooted {
+			cerr.Add("--share-objects", "requires --non-rooted")
+		}
+
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"--tier-rules", c.TierRules != ""},
+			{"--post-verify", c.PostVerify},
+			{"--post-repack", c.PostRepack},
+			{"--post-commit-graph", c.PostCommitGraph},
+		} {
+			if f.set {
+				cerr.Add(f.name,
+					"can't be used along with --share-objects")
+			}
+		}
+	}
+
+	if c.ManifestsPath != "" && c.Manifests == "" {
+		cerr.Add("--manifests-path", "requires --manifests")
+	}
+
+	if c.Packs != "" {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"--manifests", c.Manifests != ""},
+			{"--post-verify", c.PostVerify},
+			{"--post-repack", c.PostRepack},
+			{"--post-commit-graph", c.PostCommitGraph},
+			{"--merge-locations", c.MergeLocations},
+			{"--non-rooted", c.NonRooted},
+			{"--share-objects", c.ShareObjects},
+			{"--tier-rules", c.TierRules != ""},
+			{"--incremental", c.Incremental},
+			{"--backfill", c.Backfill},
+			{"--sandbox", c.Sandbox},
+		} {
+			if f.set {
+				cerr.Add(f.name, "can't be used along with --packs, "+
+					"the repositories aren't stored in the library")
+			}
+		}
+
+		if c.PacksPartSize<<20 < objstore.MinPartSize {
+			cerr.Add("--packs-part-size",
+				"must be at least 5 MiB, the smallest part accepted by S3")
+		}
+	} else {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"--packs-endpoint", c.PacksEndpoint != ""},
+			{"--packs-region", c.PacksRegion != ""},
+			{"--packs-access-key", c.PacksAccessKey != ""},
+			{"--packs-secret-key", c.PacksSecretKey != ""},
+		} {
+			if f.set {
+				cerr.Add(f.name, "requires --packs")
+			}
+		}
+	}
+
+	if c.Incremental {
+		if c.IncrCommits > 0 && c.IncrWindow > 0 {
+			cerr.Add("--incremental-window",
+				"can't be used along with --incremental-commits")
+		}
+
+		if c.Manifests != "" {
+			cerr.Add("--incremental",
+				"--manifests doesn't fetch the history")
+		}
+
+		if c.Simulate {
+			cerr.Add("--incremental",
+				"the synthetic repositories can't be fetched shallow")
+		}
+	} else {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"--incremental-min-size", c.IncrMinSize != 0},
+			{"--incremental-commits", c.IncrCommits != 0},
+			{"--incremental-window", c.IncrWindow != 0},
+			{"--incremental-budget", c.IncrBudget != 0},
+		} {
+			if f.set {
+				cerr.Add(f.name, "requires --incremental")
+			}
+		}
+	}
+
+	if c.Anonymize && c.AnonymizeKey == "" {
+		cerr.Add("--anonymize-key",
+			"required to anonymize, the hashes of public names could be guessed")
+	}
+
+	if !c.Anonymize && c.AnonymizeMap != "" {
+		cerr.Add("--anonymize-mapping", "requires --anonymize")
+	}
+
+	if c.Backfill {
+		if c.NotAllowUpdates {
+			cerr.Add("--backfill",
+				"can't be used along with --no-updates")
+		}
+
+		if c.Manifests != "" {
+			cerr.Add("--backfill",
+				"--manifests doesn't store the repositories")
+		}
+	}
+
+	if c.MetadataReadme && !c.Metadata {
+		cerr.Add("--metadata-readme", "requires --metadata")
+	}
+
+	if c.Simulate {
+		if c.SimRepos <= 0 {
+			cerr.Add("--sim-repos", "must be positive")
+		}
+
+		if c.SimCommits <= 0 {
+			cerr.Add("--sim-commits", "must be positive")
+		}
+
+		if c.SimForks < 0 || c.SimForks > 1 {
+			cerr.Add("--sim-forks",
+				"must be a probability between 0 and 1, got %v",
+				c.SimForks)
+		}
+
+		if c.SimLatency < 0 {
+			cerr.Add("--sim-latency", "can't be negative")
+		}
+	}
+
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"--history-slow", c.HistorySlow > 0},
+		{"--history-failure-streak", c.HistoryStreak > 0},
+	} {
+		if f.set && !c.History {
+			cerr.Add(f.name, "requires --history")
+		}
+	}
+
+	if c.HistorySlow > 0 && c.MemoryBudget == 0 && c.WorkerMemory == 0 {
+		cerr.Add("--history-slow",
+			"requires --memory-budget or --worker-memory")
+	}
+
+	if c.HistoryStreak > 0 && c.SizeOrder == "" {
+		cerr.Add("--history-failure-streak", "requires --size-order")
+	}
+
+	if c.IDs == "uuid" && c.Naming != "{host}/{org}/{name}" {
+		cerr.Add("--naming", "can't be used along with --ids=uuid")
+	}
+
+	if c.JobRetryFactor < 1 {
+		cerr.Add("--job-retry-factor", "can't be smaller than 1")
+	}
+
+	if c.JobRetryMax > 0 && c.JobRetryMax < c.JobRetryDelay {
+		cerr.Add("--job-retry-max-delay",
+			"%d seconds is shorter than the --job-retry-delay",
+			c.JobRetryMax)
+	}
+
+	if c.JobRate < 0 {
+		cerr.Add("--job-rate", "can't be negative")
+	}
+
+	if c.APIRate < 0 {
+		cerr.Add("--api-rate", "can't be negative")
+	}
+
+	if c.APIBurst <= 0 {
+		cerr.Add("--api-burst", "must be positive")
+	}
+
+	if c.APIBurstRate < 0 {
+		cerr.Add("--api-burst-rate", "can't be negative")
+	} else if c.APIBurstRate > 0 && c.APIRate == 0 {
+		cerr.Add("--api-burst-rate", "requires --api-rate")
+	} else if c.APIBurstRate > 0 && c.APIBurstRate < c.APIRate/3600 {
+		cerr.Add("--api-burst-rate",
+			"%v requests per second is slower than the --api-rate",
+			c.APIBurstRate)
+	}
+
+	if c.HeartbeatFile != "" && c.HeartbeatEvery <= 0 {
+		cerr.Add("--heartbeat-interval",
+			"must be positive to write the heartbeat file")
+	}
+
+	if c.MetricsDBURI != "" && c.MetricsSync <= 0 {
+		cerr.Add("--metrics-sync-timeout",
+			"must be positive to send metrics")
+	}
+
+	return cerr.Err()
+}
+
+func (c *DownloadCmd) validatePaths(cerr *gitcollector.ConfigError) {
+	lib := checkDir(cerr, "--library", c.LibPath)
+
+	// the temporal directory is created if it doesn't exist
+	tmp, err := filepath.Abs(c.TmpPath)
+	if info, serr := os.Stat(c.TmpPath); serr == nil && !info.IsDir() {
+		cerr.Add("--tmp", "%s isn't a directory", c.TmpPath)
+	}
+
+	if lib != "" && err == nil && isSubpath(lib, tmp) {
+		cerr.Add("--tmp",
+			"%s is inside the library, the temporal files would be "+
+				"mixed with the siva files", c.TmpPath)
+	}
+
+	if c.Tiers != "" {
+		for _, tier := range strings.Split(c.Tiers, ",") {
+			kv := strings.SplitN(tier, "=", 2)
+			if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+				cerr.Add("--tiers",
+					"%q isn't in name=path format", tier)
+				continue
+			}
+
+			checkDir(cerr, "--tiers", kv[1])
+		}
+	}
+
+	if c.Plugin != "" {
+		info, err := os.Stat(c.Plugin)
+		if err != nil {
+			cerr.Add("--provider-plugin", "%s", err)
+		} else if info.IsDir() || info.Mode()&0111 == 0 {
+			cerr.Add("--provider-plugin", "%s isn't executable", c.Plugin)
+		}
+	} else if len(c.PluginArgs) > 0 {
+		cerr.Add("--provider-plugin-arg", "requires --provider-plugin")
+	}
+
+	switch {
+	case c.List != "" && c.List != discovery.StdinList:
+		if _, err := os.Stat(c.List); err != nil {
+			cerr.Add("--list", "%s", err)
+		}
+	case c.List == "" && c.ListFollow:
+		cerr.Add("--list-follow", "requires --list")
+	}
+
+	if c.ListFollow && c.List == discovery.StdinList {
+		cerr.Add("--list-follow", "the standard input can't be read again")
+	}
+
+	if c.ListInterval != 0 && !c.ListFollow {
+		cerr.Add("--list-interval", "requires --list-follow")
+	}
+
+	if c.Modules != "" && c.Modules != discovery.StdinList {
+		if _, err := os.Stat(c.Modules); err != nil {
+			cerr.Add("--modules", "%s", err)
+		}
+	}
+
+	if c.Modules == discovery.StdinList && c.List == discovery.StdinList {
+		cerr.Add("--modules", "the standard input is already read by --list")
+	}
+
+	if c.KafkaBrokers == "" {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"--kafka-topic", c.KafkaTopic != ""},
+			{"--kafka-results-topic", c.KafkaResults != ""},
+		} {
+			if f.set {
+				cerr.Add(f.name, "requires --kafka-brokers")
+			}
+		}
+	} else if c.KafkaTopic == "" && c.KafkaResults == "" {
+		cerr.Add("--kafka-brokers",
+			"requires --kafka-topic or --kafka-results-topic")
+	}
+
+	for _, broker := range c.kafkaBrokers() {
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			cerr.Add("--kafka-brokers", "%q isn't in host:port format", broker)
+		}
+	}
+
+	v2 := false
+	if c.GitProtocol != "" {
+		for _, hv := range strings.Split(c.GitProtocol, ",") {
+			kv := strings.SplitN(hv, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				cerr.Add("--git-protocol",
+					"%q isn't in host=version format", hv)
+				continue
+			}
+
+			switch kv[1] {
+			case "0", "1":
+			case "2":
+				v2 = true
+			default:
+				cerr.Add("--git-protocol",
+					"version of %s must be 0, 1 or 2, got %q", kv[0], kv[1])
+			}
+		}
+	}
+
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"--git-ref-prefixes", c.GitRefPrefixes != ""},
+		{"--git-server-option", len(c.GitServerOpts) > 0},
+		{"--git-filter", c.GitFilter != ""},
+	} {
+		if f.set && !v2 {
+			cerr.Add(f.name,
+				"requires a host speaking the protocol 2 in --git-protocol")
+		}
+	}
+
+	if c.SandboxCPUs < 0 {
+		cerr.Add("--sandbox-cpus", "can't be negative")
+	}
+
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"--sandbox-memory", c.SandboxMemory > 0},
+		{"--sandbox-cpus", c.SandboxCPUs > 0},
+		{"--sandbox-pids", c.SandboxPids > 0},
+	} {
+		if f.set && c.SandboxCgroup == "" {
+			cerr.Add(f.name, "requires --sandbox-cgroup")
+		}
+	}
+
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"--sandbox-cgroup", c.SandboxCgroup != ""},
+		{"--sandbox-files", c.SandboxFiles > 0},
+		{"--sandbox-file-size", c.SandboxFileSize > 0},
+	} {
+		if f.set && !c.Sandbox {
+			cerr.Add(f.name, "requires --sandbox")
+		}
+	}
+
+	if c.Sandbox && c.Simulate {
+		cerr.Add("--sandbox", "can't be used along with --simulate")
+	}
+
+	for _, server := range c.DNSServers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			cerr.Add("--dns-server", "%q isn't in host:port format", server)
+		}
+	}
+
+	if c.TierRules != "" {
+		if _, err := os.Stat(c.TierRules); err != nil {
+			cerr.Add("--tier-rules", "%s", err)
+		}
+	}
+
+	for _, f := range []struct {
+		name string
+		path string
+	}{
+		{"--metrics-csv", c.MetricsCSV},
+		{"--heartbeat-file", c.HeartbeatFile},
+	} {
+		if f.path == "" {
+			continue
+		}
+
+		dir := filepath.Dir(f.path)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			cerr.Add(f.name, "directory %s doesn't exist", dir)
+		}
+	}
+}
+
+func (c *DownloadCmd) validateDiscovery(cerr *gitcollector.ConfigError) {
+	if c.Simulate {
+		if c.Starred != "" {
+			cerr.Add("--starred",
+				"can't be used along with --simulate")
+		}
+
+		if c.List != "" {
+			cerr.Add("--list", "can't be used along with --simulate")
+		}
+
+		if c.Modules != "" {
+			cerr.Add("--modules", "can't be used along with --simulate")
+		}
+
+		if c.KafkaTopic != "" {
+			cerr.Add("--kafka-topic", "can't be used along with --simulate")
+		}
+
+		return
+	}
+
+	if c.Orgs == "" && c.Enterprise == "" && c.Plugin == "" &&
+		c.Starred == "" && c.List == "" && c.Modules == "" &&
+		c.KafkaTopic == "" {
+		cerr.Add("--orgs", "no organizations given")
+	}
+
+	if c.CursorsFile != "" && c.CursorsDBURI != "" {
+		cerr.Add("--cursors-file", "can't be used along with --cursors-db")
+	}
+
+	if c.Orgs != "" && c.Orgs != discovery.AllOrgs && c.Enterprise != "" {
+		cerr.Add("--enterprise", "can't be used along with --orgs")
+	}
+
+	if c.Token == "" {
+		if c.Enterprise != "" && c.AppID == 0 {
+			cerr.Add("--token",
+				"required to list the enterprise organizations")
+		}
+
+		if c.Orgs == discovery.AllOrgs {
+			cerr.Add("--token",
+				"required to list the organizations the token can see")
+		}
+	}
+
+	if c.AppID == 0 && c.AppInstall == 0 && c.AppKey == "" {
+		return
+	}
+
+	switch {
+	case c.AppID == 0:
+		cerr.Add("--app-id",
+			"required along with --app-installation and --app-key")
+	case c.AppID < 0:
+		cerr.Add("--app-id", "must be positive, got %d", c.AppID)
+	}
+
+	switch {
+	case c.AppInstall == 0:
+		cerr.Add("--app-installation", "required along with --app-id")
+	case c.AppInstall < 0:
+		cerr.Add("--app-installation",
+			"must be positive, got %d", c.AppInstall)
+	}
+
+	if c.AppKey == "" {
+		cerr.Add("--app-key", "required along with --app-id")
+	} else if _, err := os.Stat(c.AppKey); err != nil {
+		cerr.Add("--app-key", "%s", err)
+	}
+}
+
+// checkDir records a problem if the path isn't an existing directory and
+// returns its absolute path, empty if it's wrong.
+func checkDir(
+	cerr *gitcollector.ConfigError,
+	field, path string,
+) string {
+	if path == "" {
+		cerr.Add(field, "no path given")
+		return ""
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		cerr.Add(field, "%s", err)
+		return ""
+	}
+
+	if !info.IsDir() {
+		cerr.Add(field, "%s isn't a directory", path)
+		return ""
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		cerr.Add(field, "%s", err)
+		return ""
+	}
+
+	return abs
+}
+
+// isSubpath returns whether the path is the base directory or inside it.
+func isSubpath(base, path string) bool {
+	rel, err := filepath.Rel(base, path)
+	return err == nil && rel != ".." &&
+		!strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
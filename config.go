@@ -0,0 +1,53 @@
+package gitcollector
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConfigProblem is a wrong or contradictory setting found validating a
+// configuration.
+type ConfigProblem struct {
+	// Field is the name of the setting, like a command line flag.
+	Field string
+	// Reason describes what's wrong with the setting.
+	Reason string
+}
+
+// ConfigError aggregates all the problems found validating a configuration,
+// so they can be fixed at once instead of one per execution.
+type ConfigError struct {
+	Problems []ConfigProblem
+}
+
+var _ error = (*ConfigError)(nil)
+
+// Add records a problem of the given field.
+func (e *ConfigError) Add(field, format string, args ...interface{}) {
+	e.Problems = append(e.Problems, ConfigProblem{
+		Field:  field,
+		Reason: fmt.Sprintf(format, args...),
+	})
+}
+
+// Err returns the ConfigError if it has any problem, nil otherwise.
+func (e *ConfigError) Err() error {
+	if len(e.Problems) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// Error implements the error interface.
+func (e *ConfigError) Error() string {
+	parts := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		parts[i] = p.Field + ": " + p.Reason
+	}
+
+	return fmt.Sprintf(
+		"%d configuration problems: %s",
+		len(e.Problems), strings.Join(parts, "; "),
+	)
+}
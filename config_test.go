@@ -0,0 +1,32 @@
+package gitcollector
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigError(t *testing.T) {
+	var require = require.New(t)
+
+	var cerr ConfigError
+	require.NoError(cerr.Err())
+
+	cerr.Add("--workers", "must be positive, got %d", -1)
+	cerr.Add("--tmp", "%s", fmt.Errorf("not found"))
+	cerr.Add("MaxJobBuffer", "smaller than the queue")
+
+	err := cerr.Err()
+	require.Error(err)
+	require.Equal([]ConfigProblem{
+		{Field: "--workers", Reason: "must be positive, got -1"},
+		{Field: "--tmp", Reason: "not found"},
+		{Field: "MaxJobBuffer", Reason: "smaller than the queue"},
+	}, err.(*ConfigError).Problems)
+	require.Equal(
+		"3 configuration problems: --workers: must be positive, got -1; "+
+			"--tmp: not found; MaxJobBuffer: smaller than the queue",
+		err.Error(),
+	)
+}
@@ -0,0 +1,371 @@
+// Package console renders the activity of a running gitcollector.WorkerPool
+// in a terminal: what every worker is processing, the depth of its queues,
+// the throughput and the recent failures, redrawn in place like the progress
+// of a docker pull.
+package console
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/src-d/gitcollector"
+)
+
+// DisplayOpts represents configuration options for a Display.
+type DisplayOpts struct {
+	// Out is the terminal the Display is drawn in, default to os.Stdout.
+	Out io.Writer
+	// Interval is the time between redraws, default to a second.
+	Interval time.Duration
+	// Queued returns the number of Jobs waiting to be processed, nil
+	// means the queues aren't reported.
+	Queued func() int
+	// Next is the gitcollector.MetricsCollector the metrics are also
+	// sent to, nil means none.
+	Next gitcollector.MetricsCollector
+	// MaxFailures is the number of recent failures shown, default to 5.
+	MaxFailures int
+	// Width is the number of columns the lines are cut at, default to 80.
+	Width int
+}
+
+const (
+	interval    = time.Second
+	maxFailures = 5
+	width       = 80
+	// rateWindow is the time the throughput is averaged over.
+	rateWindow = 10 * time.Second
+)
+
+const (
+	// cursorUp moves the cursor up the given number of lines.
+	cursorUp = "\x1b[%dA"
+	// clearLine clears the rest of the line.
+	clearLine = "\x1b[K"
+	// clearScreen clears the rest of the screen.
+	clearScreen = "\x1b[J"
+)
+
+func (o *DisplayOpts) defaults() *DisplayOpts {
+	opts := &DisplayOpts{}
+	if o != nil {
+		*opts = *o
+	}
+
+	if opts.Out == nil {
+		opts.Out = os.Stdout
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = interval
+	}
+
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = maxFailures
+	}
+
+	if opts.Width <= 0 {
+		opts.Width = width
+	}
+
+	return opts
+}
+
+// sample is the number of finished Jobs at a time.
+type sample struct {
+	time     time.Time
+	finished int
+}
+
+// failure is a failed Job shown by the Display.
+type failure struct {
+	job   string
+	class gitcollector.ErrorClass
+	err   string
+}
+
+// Display is an implementation of gitcollector.MetricsCollector drawing the
+// activity of a gitcollector.WorkerPool in a terminal while the pool runs,
+// from the time it's started until it's stopped.
+type Display struct {
+	wp    *gitcollector.WorkerPool
+	opts  *DisplayOpts
+	start time.Time
+
+	mu        sync.Mutex
+	succeeded int
+	failed    int
+	failures  []failure
+	samples   []sample
+	lines     int
+	stopped   bool
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+var (
+	_ gitcollector.ErrorMetricsCollector   = (*Display)(nil)
+	_ gitcollector.LatencyMetricsCollector = (*Display)(nil)
+)
+
+// NewDisplay builds a new Display, it must be set as the
+// gitcollector.MetricsCollector of the pool it's watching.
+func NewDisplay(opts *DisplayOpts) *Display {
+	return &Display{
+		opts:  opts.defaults(),
+		start: time.Now(),
+		stop:  make(chan struct{}),
+	}
+}
+
+// Watch sets the pool whose workers are drawn, it must be called before the
+// pool runs.
+func (d *Display) Watch(wp *gitcollector.WorkerPool) {
+	d.wp = wp
+}
+
+// Start implements the gitcollector.MetricsCollector interface. The Display
+// is drawn every Interval until it's stopped.
+func (d *Display) Start() {
+	d.mu.Lock()
+	if !d.stopped {
+		d.wg.Add(1)
+		go d.draw()
+	}
+	d.mu.Unlock()
+
+	if d.opts.Next != nil {
+		d.opts.Next.Start()
+	}
+}
+
+func (d *Display) draw() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		d.Draw(time.Now())
+		select {
+		case <-ticker.C:
+		case <-d.stop:
+			d.Draw(time.Now())
+			return
+		}
+	}
+}
+
+// Stop implements the gitcollector.MetricsCollector interface. The last
+// frame is drawn once the next MetricsCollector is stopped, and it's left
+// in the terminal.
+func (d *Display) Stop(immediate bool) {
+	if d.opts.Next != nil {
+		d.opts.Next.Stop(immediate)
+	}
+
+	d.mu.Lock()
+	if !d.stopped {
+		d.stopped = true
+		close(d.stop)
+	}
+	d.mu.Unlock()
+
+	d.wg.Wait()
+}
+
+// Success implements the gitcollector.MetricsCollector interface.
+func (d *Display) Success(job gitcollector.Job) {
+	d.mu.Lock()
+	d.succeeded++
+	d.mu.Unlock()
+
+	if d.opts.Next != nil {
+		d.opts.Next.Success(job)
+	}
+}
+
+// Fail implements the gitcollector.MetricsCollector interface.
+func (d *Display) Fail(job gitcollector.Job) {
+	d.addFailure(job, gitcollector.ErrorClassUnknown, nil)
+	if d.opts.Next != nil {
+		d.opts.Next.Fail(job)
+	}
+}
+
+// FailWithError implements the gitcollector.ErrorMetricsCollector interface.
+func (d *Display) FailWithError(
+	job gitcollector.Job,
+	f *gitcollector.JobFailure,
+) {
+	d.addFailure(job, f.Class, f.Err)
+	if d.opts.Next == nil {
+		return
+	}
+
+	if mc, ok := d.opts.Next.(gitcollector.ErrorMetricsCollector); ok {
+		mc.FailWithError(job, f)
+		return
+	}
+
+	d.opts.Next.Fail(job)
+}
+
+// Discover implements the gitcollector.MetricsCollector interface.
+func (d *Display) Discover(job gitcollector.Job) {
+	if d.opts.Next != nil {
+		d.opts.Next.Discover(job)
+	}
+}
+
+// Latency implements the gitcollector.LatencyMetricsCollector interface.
+func (d *Display) Latency(job gitcollector.Job, elapsed time.Duration) {
+	if mc, ok := d.opts.Next.(gitcollector.LatencyMetricsCollector); ok {
+		mc.Latency(job, elapsed)
+	}
+}
+
+// addFailure keeps the last MaxFailures failures, the newest first.
+func (d *Display) addFailure(
+	job gitcollector.Job,
+	class gitcollector.ErrorClass,
+	err error,
+) {
+	f := failure{job: fmt.Sprint(job), class: class}
+	if err != nil {
+		f.err = err.Error()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.failed++
+	d.failures = append([]failure{f}, d.failures...)
+	if len(d.failures) > d.opts.MaxFailures {
+		d.failures = d.failures[:d.opts.MaxFailures]
+	}
+}
+
+// Draw draws the frame of the given time over the previous one.
+func (d *Display) Draw(now time.Time) {
+	lines := d.Frame(now)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var b strings.Builder
+	if d.lines > 0 {
+		fmt.Fprintf(&b, cursorUp, d.lines)
+	}
+
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteString(clearLine)
+		b.WriteByte('\n')
+	}
+
+	b.WriteString(clearScreen)
+	d.lines = len(lines)
+	// a failed write to the terminal is drawn again in the next frame.
+	io.WriteString(d.opts.Out, b.String())
+}
+
+// Frame returns the lines of the frame of the given time, without the
+// control sequences redrawing it.
+func (d *Display) Frame(now time.Time) []string {
+	// the heartbeats don't wait for an ongoing resize, unlike Size.
+	var beats []gitcollector.Heartbeat
+	if d.wp != nil {
+		beats = d.wp.Heartbeats()
+	}
+
+	var busy int
+	for _, hb := range beats {
+		if hb.Busy {
+			busy++
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status := fmt.Sprintf("%s  workers %d/%d",
+		now.Sub(d.start).Round(time.Second), busy, len(beats))
+	if d.opts.Queued != nil {
+		status += fmt.Sprintf("  queued %d", d.opts.Queued())
+	}
+
+	lines := []string{
+		d.cut(status),
+		d.cut(fmt.Sprintf("succeeded %d  failed %d  %.2f jobs/s",
+			d.succeeded, d.failed, d.rate(now))),
+		"",
+	}
+
+	for _, hb := range beats {
+		lines = append(lines, d.cut(worker(hb, now)))
+	}
+
+	if len(d.failures) == 0 {
+		return lines
+	}
+
+	lines = append(lines, "", "recent failures")
+	for _, f := range d.failures {
+		lines = append(lines, d.cut(fmt.Sprintf(
+			"  %s  %s  %s", f.job, f.class, f.err,
+		)))
+	}
+
+	return lines
+}
+
+// rate returns the Jobs finished per second since the newest sample older
+// than rateWindow, keeping the sample of the given time.
+func (d *Display) rate(now time.Time) float64 {
+	finished := d.succeeded + d.failed
+	d.samples = append(d.samples, sample{time: now, finished: finished})
+
+	var i int
+	for i < len(d.samples)-1 && now.Sub(d.samples[i+1].time) >= rateWindow {
+		i++
+	}
+	d.samples = d.samples[i:]
+
+	first := d.samples[0]
+	elapsed := now.Sub(first.time).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(finished-first.finished) / elapsed
+}
+
+func worker(hb gitcollector.Heartbeat, now time.Time) string {
+	if !hb.Busy {
+		return fmt.Sprintf("  %s  idle", hb.Worker)
+	}
+
+	var elapsed time.Duration
+	if hb.JobStarted != nil {
+		elapsed = now.Sub(*hb.JobStarted).Round(time.Second)
+	}
+
+	return fmt.Sprintf("  %s  %s  %s", hb.Worker, elapsed, hb.Job)
+}
+
+// cut cuts the line at the Width of the terminal, so it isn't wrapped and
+// every line of the frame is redrawn.
+func (d *Display) cut(line string) string {
+	runes := []rune(line)
+	if len(runes) <= d.opts.Width {
+		return line
+	}
+
+	return string(runes[:d.opts.Width-1]) + "…"
+}
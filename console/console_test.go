@@ -0,0 +1,165 @@
+package console
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testJob struct {
+	id      string
+	process func(context.Context) error
+}
+
+func (j *testJob) Process(ctx context.Context) error {
+	return j.process(ctx)
+}
+
+func (j *testJob) String() string {
+	return j.id
+}
+
+// syncBuffer is a bytes.Buffer the Display can write to while it's read.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestDisplay(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan gitcollector.Job, 5)
+	out := &syncBuffer{}
+	d := NewDisplay(&DisplayOpts{
+		Out:         out,
+		Interval:    10 * time.Millisecond,
+		Queued:      func() int { return len(queue) },
+		MaxFailures: 2,
+		Width:       40,
+	})
+
+	wp := gitcollector.NewWorkerPool(
+		func(ctx context.Context) (gitcollector.Job, error) {
+			select {
+			case job, ok := <-queue:
+				if !ok {
+					return nil, gitcollector.ErrJobSource.New()
+				}
+
+				return job, nil
+			case <-ctx.Done():
+				return nil, gitcollector.ErrNewJobsNotFound.New()
+			}
+		},
+		&gitcollector.WorkerPoolOpts{
+			Metrics:        d,
+			WaitJobTimeout: 50 * time.Millisecond,
+		},
+	)
+
+	d.Watch(wp)
+	wp.SetWorkers(1)
+	wp.Run()
+
+	for i := 0; i < 3; i++ {
+		queue <- &testJob{
+			id: fmt.Sprintf("job-%d", i),
+			process: func(context.Context) error {
+				return fmt.Errorf("foo")
+			},
+		}
+	}
+
+	queue <- &testJob{id: "ok", process: func(context.Context) error {
+		return nil
+	}}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	queue <- &testJob{id: "blocked", process: func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}}
+
+	<-started
+	var frame []string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		frame = d.Frame(time.Now())
+		if strings.HasPrefix(frame[1], "succeeded 1  failed 3") {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	require.Contains(frame[0], "workers 1/1  queued 0")
+	require.True(strings.HasPrefix(
+		frame[1], "succeeded 1  failed 3"), frame[1])
+	require.Equal("", frame[2])
+	require.Contains(frame[3], "blocked")
+	require.Equal("", frame[4])
+	require.Equal("recent failures", frame[5])
+
+	// only the newest failures are kept, cut at the width.
+	require.Len(frame, 8)
+	require.Equal("  job-2  unknown  foo", frame[6])
+	require.Equal("  job-1  unknown  foo", frame[7])
+
+	d.Draw(time.Now())
+	close(release)
+	close(queue)
+	wp.Wait()
+
+	// every frame is drawn over the previous one, the last one once the
+	// pool is stopped.
+	drawn := out.String()
+	require.True(strings.HasSuffix(drawn, clearScreen))
+	require.Contains(drawn, fmt.Sprintf(cursorUp, 8))
+	require.Contains(drawn, "succeeded 2  failed 3")
+	require.Contains(drawn, "  job-2  unknown  foo"+clearLine+"\n")
+}
+
+func TestDisplayFrame(t *testing.T) {
+	var require = require.New(t)
+
+	d := NewDisplay(&DisplayOpts{Width: 10})
+	now := d.start.Add(90 * time.Second)
+	require.Equal([]string{"1m30s  wo…", "succeeded…", ""}, d.Frame(now))
+	require.Equal("0123456789", d.cut("0123456789"))
+	require.Equal("012345678…", d.cut("0123456789a"))
+
+	// the throughput is averaged over the last samples.
+	d.samples = nil
+	d.succeeded = 10
+	require.Equal(0.0, d.rate(now))
+	d.succeeded, d.failed = 20, 10
+	require.Equal(4.0, d.rate(now.Add(5*time.Second)))
+	d.succeeded = 50
+	require.Equal(2.0, d.rate(now.Add(20*time.Second)))
+	require.Len(d.samples, 2)
+
+	// a Display never started is stopped right away.
+	d.Stop(false)
+}
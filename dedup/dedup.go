@@ -0,0 +1,433 @@
+// Package dedup finds the repositories stored more than once in the libraries
+// of a collection, like the mirrors of a project kept by several
+// organizations, and consolidates the copies of the locations stored in more
+// than one library.
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/migrate"
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// Library is one of the libraries analyzed, like the main library of a
+// collection or one of its storage tiers.
+type Library struct {
+	// Name identifies the library in the Report.
+	Name string
+	// Store reads and writes the locations of the library.
+	Store migrate.Store
+	// FS is the filesystem of a siva library, used along with Bucket to
+	// measure its locations. The sizes aren't reported if it's nil.
+	FS     billy.Filesystem
+	Bucket int
+	// Trash receives the copies of the locations merged into another
+	// library, if it's nil they're kept.
+	Trash *library.Trash
+}
+
+func (l *Library) size(id borges.LocationID) int64 {
+	if l.FS == nil {
+		return 0
+	}
+
+	info, err := l.FS.Stat(library.LocationFile(id, l.Bucket))
+	if err != nil {
+		return 0
+	}
+
+	return info.Size()
+}
+
+// Repository is a repository stored in a location.
+type Repository struct {
+	// ID is the repository, it's also the name of its remote.
+	ID       string `json:"id"`
+	Endpoint string `json:"endpoint,omitempty"`
+	Org      string `json:"org,omitempty"`
+	// References is the number of references of the repository.
+	References int `json:"references"`
+
+	refs map[string]plumbing.Hash
+}
+
+// Copy is a location as stored in one of the libraries.
+type Copy struct {
+	Library      string        `json:"library"`
+	Size         int64         `json:"size,omitempty"`
+	Repositories []*Repository `json:"repositories"`
+}
+
+// Containment is a repository whose references point to commits also pointed
+// by the references of another repository, like a stale mirror.
+type Containment struct {
+	ID string `json:"id"`
+	In string `json:"in"`
+}
+
+// Duplicate is a location holding repositories of several organizations,
+// mirrors of the same repository or stored in more than one library. The
+// repositories of a location share their root commit.
+type Duplicate struct {
+	Location borges.LocationID `json:"location"`
+	Orgs     []string          `json:"orgs"`
+	Copies   []*Copy           `json:"copies"`
+	// Mirrors are the sets of repositories with the same references.
+	Mirrors [][]string `json:"mirrors,omitempty"`
+	// Contained are the repositories whose references are included in
+	// the ones of another repository.
+	Contained []Containment `json:"contained,omitempty"`
+	// Keep is the library the copies are consolidated into, the one
+	// holding more repositories of the location, when there are several
+	// copies.
+	Keep string `json:"keep,omitempty"`
+	// Redundant is the size of the copies besides the one kept.
+	Redundant int64 `json:"redundant,omitempty"`
+}
+
+// Report is the consolidation report of the analyzed libraries.
+type Report struct {
+	Locations    int          `json:"locations"`
+	Repositories int          `json:"repositories"`
+	Duplicates   []*Duplicate `json:"duplicates"`
+	// Redundant is the size of the copies of the locations stored in more
+	// than one library that can be reclaimed merging them.
+	Redundant int64 `json:"redundant"`
+}
+
+// Opts represents configuration options for an analysis.
+type Opts struct {
+	// Logger is the logger used, default to log.New(nil).
+	Logger log.Logger
+}
+
+// Analyze reads every location of the given libraries looking for
+// duplicates. It doesn't modify the libraries, the MergeJobs of the report do.
+// A location that can't be read is logged and skipped.
+func Analyze(
+	ctx context.Context,
+	libs []*Library,
+	opts *Opts,
+) (*Report, error) {
+	if opts == nil {
+		opts = &Opts{}
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(nil)
+	}
+
+	var (
+		report = &Report{Duplicates: []*Duplicate{}}
+		found  = map[borges.LocationID]*Duplicate{}
+	)
+
+	for _, lib := range libs {
+		ids, err := lib.Store.Locations()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range ids {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			c, err := readCopy(lib, id)
+			if err != nil {
+				logger.New(log.Fields{
+					"library":  lib.Name,
+					"location": id,
+				}).Errorf(err, "couldn't read the location")
+				continue
+			}
+
+			d, ok := found[id]
+			if !ok {
+				d = &Duplicate{Location: id}
+				found[id] = d
+				report.Locations++
+			}
+
+			d.Copies = append(d.Copies, c)
+		}
+	}
+
+	for _, d := range found {
+		report.Repositories += d.analyze()
+		if len(d.Orgs) > 1 || len(d.Copies) > 1 || len(d.Mirrors) > 0 {
+			report.Duplicates = append(report.Duplicates, d)
+			report.Redundant += d.Redundant
+		}
+	}
+
+	sort.Slice(report.Duplicates, func(i, j int) bool {
+		return report.Duplicates[i].Location < report.Duplicates[j].Location
+	})
+
+	return report, nil
+}
+
+func readCopy(lib *Library, id borges.LocationID) (*Copy, error) {
+	repo, err := lib.Store.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	defer repo.Close()
+
+	cfg, err := repo.R().Config()
+	if err != nil {
+		return nil, err
+	}
+
+	repos := map[string]*Repository{}
+	for name, remote := range cfg.Remotes {
+		r := &Repository{ID: name, refs: map[string]plumbing.Hash{}}
+		if len(remote.URLs) > 0 {
+			r.Endpoint = remote.URLs[0]
+			r.Org = library.GetOrgFromEndpoint(r.Endpoint)
+		}
+
+		repos[name] = r
+	}
+
+	refs, err := repo.R().References()
+	if err != nil {
+		return nil, err
+	}
+
+	// the references of every remote of a rooted repository are kept as
+	// refs/remotes/<remote>/<name>.
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		name := strings.TrimPrefix(ref.Name().String(), "refs/remotes/")
+		for id, r := range repos {
+			if strings.HasPrefix(name, id+"/") {
+				r.refs[strings.TrimPrefix(name, id+"/")] = ref.Hash()
+				r.References++
+				break
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Copy{Library: lib.Name, Size: lib.size(id)}
+	for _, r := range repos {
+		c.Repositories = append(c.Repositories, r)
+	}
+
+	sort.Slice(c.Repositories, func(i, j int) bool {
+		return c.Repositories[i].ID < c.Repositories[j].ID
+	})
+
+	return c, nil
+}
+
+// analyze fills the duplicate with the relations between its repositories and
+// returns the number of different repositories found.
+func (d *Duplicate) analyze() int {
+	var (
+		repos []*Repository
+		seen  = map[string]bool{}
+		orgs  = map[string]bool{}
+		keep  *Copy
+	)
+
+	for _, c := range d.Copies {
+		if keep == nil || len(c.Repositories) > len(keep.Repositories) {
+			keep = c
+		}
+
+		for _, r := range c.Repositories {
+			if r.Org != "" {
+				orgs[r.Org] = true
+			}
+
+			if !seen[r.ID] {
+				seen[r.ID] = true
+				repos = append(repos, r)
+			}
+		}
+	}
+
+	for org := range orgs {
+		d.Orgs = append(d.Orgs, org)
+	}
+
+	sort.Strings(d.Orgs)
+	sort.Slice(repos, func(i, j int) bool { return repos[i].ID < repos[j].ID })
+
+	mirrored := map[string]bool{}
+	for i, a := range repos {
+		if mirrored[a.ID] || len(a.refs) == 0 {
+			continue
+		}
+
+		mirrors := []string{a.ID}
+		for _, b := range repos[i+1:] {
+			if !mirrored[b.ID] && sameRefs(a.refs, b.refs) {
+				mirrors = append(mirrors, b.ID)
+				mirrored[b.ID] = true
+			}
+		}
+
+		if len(mirrors) > 1 {
+			mirrored[a.ID] = true
+			d.Mirrors = append(d.Mirrors, mirrors)
+		}
+	}
+
+	for _, a := range repos {
+		if mirrored[a.ID] || len(a.refs) == 0 {
+			continue
+		}
+
+		for _, b := range repos {
+			if a != b && len(b.refs) > len(a.refs) && containsRefs(b.refs, a.refs) {
+				d.Contained = append(d.Contained, Containment{
+					ID: a.ID,
+					In: b.ID,
+				})
+				break
+			}
+		}
+	}
+
+	if len(d.Copies) > 1 {
+		d.Keep = keep.Library
+		for _, c := range d.Copies {
+			if c != keep {
+				d.Redundant += c.Size
+			}
+		}
+	}
+
+	return len(repos)
+}
+
+func sameRefs(a, b map[string]plumbing.Hash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for name, h := range a {
+		if b[name] != h {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsRefs returns whether every commit pointed by the references of b is
+// also pointed by a reference of a.
+func containsRefs(a, b map[string]plumbing.Hash) bool {
+	hashes := map[plumbing.Hash]bool{}
+	for _, h := range a {
+		hashes[h] = true
+	}
+
+	for _, h := range b {
+		if !hashes[h] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MergeJob is a gitcollector.Job consolidating the copies of a location
+// stored in several libraries into one of them. The repositories of every
+// copy are merged into the kept one and, once it's verified, the copies are
+// moved to the trash of their libraries.
+type MergeJob struct {
+	Location borges.LocationID
+	To       *Library
+	From     []*Library
+	Logger   log.Logger
+}
+
+var _ gitcollector.Job = (*MergeJob)(nil)
+
+// MergeJobs returns the Jobs consolidating the locations of the report stored
+// in more than one of the given libraries, the ones analyzed.
+func (r *Report) MergeJobs(libs []*Library) []*MergeJob {
+	byName := map[string]*Library{}
+	for _, l := range libs {
+		byName[l.Name] = l
+	}
+
+	var jobs []*MergeJob
+	for _, d := range r.Duplicates {
+		if d.Keep == "" {
+			continue
+		}
+
+		job := &MergeJob{Location: d.Location, To: byName[d.Keep]}
+		for _, c := range d.Copies {
+			if c.Library != d.Keep {
+				job.From = append(job.From, byName[c.Library])
+			}
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs
+}
+
+// String implements the fmt.Stringer interface.
+func (j *MergeJob) String() string {
+	return fmt.Sprintf("merge %s into %s", j.Location, j.To.Name)
+}
+
+// Process implements the gitcollector.Job interface.
+func (j *MergeJob) Process(ctx context.Context) error {
+	logger := j.Logger
+	if logger == nil {
+		logger = log.New(nil)
+	}
+
+	for _, from := range j.From {
+		l := logger.New(log.Fields{
+			"location": j.Location,
+			"from":     from.Name,
+			"to":       j.To.Name,
+		})
+
+		err := migrate.Location(ctx, from.Store, j.To.Store, j.Location)
+		if err != nil {
+			l.Errorf(err, "merge failed")
+			return err
+		}
+
+		if from.Trash != nil {
+			reason := "duplicate of " + j.To.Name
+			if _, err := from.Trash.Delete(j.Location, reason); err != nil {
+				l.Errorf(err, "couldn't move the copy to the trash")
+				return err
+			}
+		}
+
+		l.Infof("merged")
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package dedup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector/migrate"
+	"github.com/src-d/go-borges"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func TestAnalyze(t *testing.T) {
+	var require = require.New(t)
+
+	commits := history(t, 3)
+	main := &Library{Name: "main", Store: migrate.NewBareStore(memfs.New())}
+	cold := &Library{Name: "cold", Store: migrate.NewBareStore(memfs.New())}
+
+	// the same project mirrored by two organizations, a stale fork of a
+	// third one and a location stored in both libraries.
+	store(t, main.Store, "root", commits, map[string]map[string]int{
+		"github.com/a/p":  {"master": 2, "v1": 1},
+		"github.com/b/p":  {"master": 2, "v1": 1},
+		"github.com/c/p":  {"master": 1},
+		"github.com/a/p2": {"dev": 0},
+	})
+	store(t, cold.Store, "root", commits, map[string]map[string]int{
+		"github.com/d/p": {"master": 2},
+	})
+	store(t, main.Store, "single", commits, map[string]map[string]int{
+		"github.com/a/single": {"master": 2},
+	})
+
+	libs := []*Library{main, cold}
+	report, err := Analyze(context.Background(), libs, nil)
+	require.NoError(err)
+	require.Equal(2, report.Locations)
+	require.Equal(6, report.Repositories)
+	require.Len(report.Duplicates, 1)
+
+	d := report.Duplicates[0]
+	require.Equal(borges.LocationID("root"), d.Location)
+	require.Equal([]string{"a", "b", "c", "d"}, d.Orgs)
+	require.Equal([][]string{{"github.com/a/p", "github.com/b/p"}}, d.Mirrors)
+	require.Equal([]Containment{
+		{ID: "github.com/c/p", In: "github.com/a/p"},
+		{ID: "github.com/d/p", In: "github.com/a/p"},
+	}, d.Contained)
+	require.Equal("main", d.Keep)
+	require.Len(d.Copies, 2)
+
+	jobs := report.MergeJobs(libs)
+	require.Len(jobs, 1)
+	require.Equal("merge root into main", jobs[0].String())
+	require.NoError(jobs[0].Process(context.Background()))
+
+	report, err = Analyze(context.Background(), libs, nil)
+	require.NoError(err)
+	d = report.Duplicates[0]
+	require.Len(d.Copies, 2)
+	require.Len(d.Copies[0].Repositories, 5)
+}
+
+// history returns a memory repository with a linear history of n commits.
+func history(t *testing.T, n int) *git.Repository {
+	t.Helper()
+	var require = require.New(t)
+
+	wt := memfs.New()
+	repo, err := git.Init(memory.NewStorage(), wt)
+	require.NoError(err)
+
+	w, err := repo.Worktree()
+	require.NoError(err)
+
+	for i := 0; i < n; i++ {
+		content := []byte{byte('a' + i)}
+		require.NoError(util.WriteFile(wt, "file", content, 0644))
+		_, err = w.Add("file")
+		require.NoError(err)
+
+		_, err = w.Commit(string(content), &git.CommitOptions{
+			Author: &object.Signature{
+				Name:  "foo",
+				Email: "foo@bar.com",
+				When:  time.Now(),
+			},
+		})
+		require.NoError(err)
+	}
+
+	return repo
+}
+
+// store writes a location with the given remotes, each of them with its
+// references pointing to the commit at the given distance from the root.
+func store(
+	t *testing.T,
+	s migrate.Store,
+	id borges.LocationID,
+	src *git.Repository,
+	remotes map[string]map[string]int,
+) {
+	t.Helper()
+	var require = require.New(t)
+
+	head, err := src.Head()
+	require.NoError(err)
+
+	iter, err := src.Log(&git.LogOptions{From: head.Hash()})
+	require.NoError(err)
+
+	var commits []plumbing.Hash
+	require.NoError(iter.ForEach(func(c *object.Commit) error {
+		commits = append([]plumbing.Hash{c.Hash}, commits...)
+		return nil
+	}))
+
+	repo, err := s.Write(id)
+	require.NoError(err)
+
+	objects, err := src.Storer.IterEncodedObjects(plumbing.AnyObject)
+	require.NoError(err)
+	require.NoError(objects.ForEach(func(obj plumbing.EncodedObject) error {
+		_, err := repo.R().Storer.SetEncodedObject(obj)
+		return err
+	}))
+
+	for name, refs := range remotes {
+		_, err := repo.R().CreateRemote(&config.RemoteConfig{
+			Name: name,
+			URLs: []string{"https://" + name},
+		})
+		require.NoError(err)
+
+		for ref, i := range refs {
+			require.NoError(repo.R().Storer.SetReference(
+				plumbing.NewHashReference(plumbing.ReferenceName(
+					"refs/remotes/"+name+"/"+ref,
+				), commits[i]),
+			))
+		}
+	}
+
+	require.NoError(repo.Commit())
+}
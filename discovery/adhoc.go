@@ -0,0 +1,212 @@
+package discovery
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrDiscoveryDisabled is returned when an organization is discovered
+	// by an AdhocProvider without NewIter.
+	ErrDiscoveryDisabled = errors.NewKind(
+		"ad-hoc discovery of organizations is disabled")
+
+	// ErrDiscoveryRunning is returned when an organization is discovered
+	// by an AdhocProvider while its previous discovery is running.
+	ErrDiscoveryRunning = errors.NewKind("%s is already being discovered")
+)
+
+// AdhocProviderOpts represents configuration options for an AdhocProvider.
+type AdhocProviderOpts struct {
+	// NewIter builds the iterators of the organizations given to
+	// Discover, nil means they're rejected.
+	NewIter func(org string) GHRepositoriesIter
+	// Provider are the options of the GHProvider of every organization.
+	Provider GHProviderOpts
+}
+
+// AdhocProvider is a gitcollector.Provider implementation producing a download
+// Job for every repository URL given to Enqueue, like the ones submitted to an
+// admin API, and discovering the organizations given to Discover once again.
+// Unlike the rest of the providers it doesn't have a source to exhaust, it
+// keeps running until it's stopped.
+type AdhocProvider struct {
+	queue  chan<- gitcollector.Job
+	opts   *AdhocProviderOpts
+	cancel chan struct{}
+	status providerStatus
+	// wg waits for the organizations being discovered.
+	wg sync.WaitGroup
+
+	mu      sync.Mutex
+	stopped bool
+	orgs    map[string]*GHProvider
+}
+
+var (
+	_ gitcollector.Provider       = (*AdhocProvider)(nil)
+	_ gitcollector.ProviderStatus = (*AdhocProvider)(nil)
+)
+
+// NewAdhocProvider builds a new AdhocProvider sending the Jobs to the given
+// queue.
+func NewAdhocProvider(
+	queue chan<- gitcollector.Job,
+	opts *AdhocProviderOpts,
+) *AdhocProvider {
+	if opts == nil {
+		opts = &AdhocProviderOpts{}
+	}
+
+	if opts.Provider.StopTimeout <= 0 {
+		opts.Provider.StopTimeout = stopTimeout
+	}
+
+	return &AdhocProvider{
+		queue:  queue,
+		opts:   opts,
+		cancel: make(chan struct{}),
+		orgs:   map[string]*GHProvider{},
+	}
+}
+
+// Start implements the gitcollector.Provider interface. It blocks until the
+// provider is stopped and the organizations being discovered are stopped.
+func (p *AdhocProvider) Start() error {
+	<-p.cancel
+	p.wg.Wait()
+	err := gitcollector.ErrProviderStopped.New()
+	p.status.done(err)
+	return err
+}
+
+// Enqueue sends a download Job of the given repository URL to the queue,
+// waiting for room until the context is done. It returns
+// ErrEndpointsNotFound if the URL is empty and gitcollector.ErrProviderStopped
+// once the provider is stopped.
+func (p *AdhocProvider) Enqueue(ctx context.Context, endpoint string) error {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		return ErrEndpointsNotFound.New("ad-hoc job")
+	}
+
+	job := &library.Job{
+		Type:      library.JobDownload,
+		Endpoints: []string{endpoint},
+	}
+
+	// the queue is closed once the providers are stopped, so the
+	// provider can't be stopped while sending.
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return gitcollector.ErrProviderStopped.New()
+	}
+
+	select {
+	case p.queue <- job:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	p.status.produced()
+	return nil
+}
+
+// Discover starts the discovery of the repositories of the given organization
+// in the background, sending them to the queue like the rest of the Jobs. It
+// returns ErrDiscoveryDisabled if the provider doesn't have NewIter,
+// ErrDiscoveryRunning if the organization is still being discovered and
+// gitcollector.ErrProviderStopped once the provider is stopped. The failures
+// of the discovery are reported by Status.
+func (p *AdhocProvider) Discover(org string) error {
+	org = strings.TrimSpace(org)
+	if p.opts.NewIter == nil {
+		return ErrDiscoveryDisabled.New()
+	}
+
+	if org == "" {
+		return ErrEndpointsNotFound.New("ad-hoc organization")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return gitcollector.ErrProviderStopped.New()
+	}
+
+	if _, ok := p.orgs[org]; ok {
+		return ErrDiscoveryRunning.New(org)
+	}
+
+	opts := p.opts.Provider
+	provider := NewGHProvider(p.queue, p.opts.NewIter(org), &opts)
+	p.orgs[org] = provider
+	p.wg.Add(1)
+
+	go func() {
+		defer p.wg.Done()
+		err := provider.Start()
+		p.status.fail(err)
+
+		p.mu.Lock()
+		delete(p.orgs, org)
+		p.mu.Unlock()
+	}()
+
+	return nil
+}
+
+// Discovering returns the organizations being discovered.
+func (p *AdhocProvider) Discovering() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	orgs := make([]string, 0, len(p.orgs))
+	for org := range p.orgs {
+		orgs = append(orgs, org)
+	}
+
+	sort.Strings(orgs)
+	return orgs
+}
+
+// Status implements the gitcollector.ProviderStatus interface.
+func (p *AdhocProvider) Status() gitcollector.ProviderState {
+	state := p.status.state(nil)
+	state.Name = "ad-hoc"
+	return state
+}
+
+// Stop implements the gitcollector.Provider interface. It waits for the Job
+// being enqueued, if any, and stops the organizations being discovered.
+func (p *AdhocProvider) Stop() error {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return nil
+	}
+
+	p.stopped = true
+	close(p.cancel)
+	providers := make([]*GHProvider, 0, len(p.orgs))
+	for _, provider := range p.orgs {
+		providers = append(providers, provider)
+	}
+	p.mu.Unlock()
+
+	// the discoveries remove themselves from orgs once they're stopped.
+	for _, provider := range providers {
+		if err := provider.Stop(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdhocProvider(t *testing.T) {
+	var req = require.New(t)
+
+	queue := make(chan gitcollector.Job, 1)
+	provider := NewAdhocProvider(queue, nil)
+	done := make(chan error)
+	go func() { done <- provider.Start() }()
+
+	ctx := context.Background()
+	req.NoError(provider.Enqueue(ctx, " https://github.com/src-d/a\n"))
+	job := (<-queue).(*library.Job)
+	req.True(job.Type == library.JobDownload)
+	req.Equal([]string{"https://github.com/src-d/a"}, job.Endpoints)
+
+	err := provider.Enqueue(ctx, " ")
+	req.True(ErrEndpointsNotFound.Is(err))
+
+	// a full queue blocks until the context is done
+	req.NoError(provider.Enqueue(ctx, "https://github.com/src-d/b"))
+	canceled, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err = provider.Enqueue(canceled, "https://github.com/src-d/c")
+	req.Equal(context.DeadlineExceeded, err)
+
+	state := provider.Status()
+	req.Equal("ad-hoc", state.Name)
+	req.Equal(2, state.Discovered)
+	req.False(state.Done)
+
+	req.NoError(provider.Stop())
+	select {
+	case err := <-done:
+		req.True(gitcollector.ErrProviderStopped.Is(err))
+	case <-time.After(5 * time.Second):
+		req.FailNow("provider not stopped")
+	}
+
+	err = provider.Enqueue(ctx, "https://github.com/src-d/d")
+	req.True(gitcollector.ErrProviderStopped.Is(err))
+	req.True(provider.Status().Done)
+}
+
+type blockingReposIter struct{}
+
+func (blockingReposIter) Next(
+	ctx context.Context,
+) (*github.Repository, time.Duration, error) {
+	<-ctx.Done()
+	return nil, 0, ctx.Err()
+}
+
+func TestAdhocProviderDiscover(t *testing.T) {
+	var req = require.New(t)
+
+	queue := make(chan gitcollector.Job, 10)
+	err := NewAdhocProvider(queue, nil).Discover("src-d")
+	req.True(ErrDiscoveryDisabled.Is(err))
+
+	provider := NewAdhocProvider(queue, &AdhocProviderOpts{
+		NewIter: func(org string) GHRepositoriesIter {
+			if org == "slow" {
+				return blockingReposIter{}
+			}
+
+			var repos []*github.Repository
+			for i := 0; i < 2; i++ {
+				url := fmt.Sprintf("https://github.com/%s/%d", org, i)
+				repos = append(repos, &github.Repository{HTMLURL: &url})
+			}
+
+			return &sliceReposIter{repos: repos}
+		},
+	})
+
+	done := make(chan error)
+	go func() { done <- provider.Start() }()
+
+	req.NoError(provider.Discover("src-d"))
+	for i := 0; i < 2; i++ {
+		job := (<-queue).(*library.Job)
+		req.Equal(fmt.Sprintf("https://github.com/src-d/%d", i),
+			job.Endpoints[0])
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(provider.Discovering()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	req.Empty(provider.Discovering())
+
+	// the organizations can be discovered again once they finish
+	req.NoError(provider.Discover("src-d"))
+	<-queue
+	<-queue
+
+	err = provider.Discover(" ")
+	req.True(ErrEndpointsNotFound.Is(err))
+
+	req.NoError(provider.Discover("slow"))
+	err = provider.Discover("slow")
+	req.True(ErrDiscoveryRunning.Is(err))
+	req.Contains(provider.Discovering(), "slow")
+
+	// the running discoveries are stopped with the provider
+	req.NoError(provider.Stop())
+	select {
+	case err := <-done:
+		req.True(gitcollector.ErrProviderStopped.Is(err))
+	case <-time.After(5 * time.Second):
+		req.FailNow("provider not stopped")
+	}
+
+	req.Empty(provider.Discovering())
+	err = provider.Discover("src-d")
+	req.True(gitcollector.ErrProviderStopped.Is(err))
+	req.NoError(provider.Status().LastError)
+}
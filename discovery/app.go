@@ -0,0 +1,194 @@
+package discovery
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrAppKey is returned when the private key of a github App can't be
+	// parsed.
+	ErrAppKey = errors.NewKind("invalid github app private key: %s")
+
+	// ErrAppToken is returned when an installation token of a github App
+	// couldn't be requested.
+	ErrAppToken = errors.NewKind(
+		"couldn't get a github app installation token: %s")
+)
+
+// GHAppAuth represents the credentials of a github App installation.
+type GHAppAuth struct {
+	// AppID is the ID of the App.
+	AppID int64
+	// InstallationID is the ID of the installation of the App in the
+	// account whose repositories are discovered.
+	InstallationID int64
+	// PrivateKey is the PEM encoded RSA private key of the App.
+	PrivateKey []byte
+	// BaseURL is the URL of the github API, default to the github.com one.
+	BaseURL string
+	// HTTPTimeout is the timeout of the token requests.
+	HTTPTimeout time.Duration
+}
+
+const (
+	appBaseURL = "https://api.github.com/"
+	// the API rejects the tokens signed for more than 10 minutes and
+	// tolerates a small clock drift.
+	appJWTExpiry = 9 * time.Minute
+	appJWTDrift  = 30 * time.Second
+)
+
+// NewGHAppTokenSource builds an oauth2.TokenSource of installation tokens of a
+// github App to authenticate the API requests. The installation tokens expire
+// after an hour, a new one is requested once the previous one expires, so the
+// iterators using it keep working across long runs. It's safe to be shared by
+// several iterators.
+func NewGHAppTokenSource(auth *GHAppAuth) (oauth2.TokenSource, error) {
+	key, err := parseAppKey(auth.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := auth.BaseURL
+	if baseURL == "" {
+		baseURL = appBaseURL
+	}
+
+	timeout := auth.HTTPTimeout
+	if timeout <= 0 {
+		timeout = httpTimeout
+	}
+
+	return oauth2.ReuseTokenSource(nil, &appTokenSource{
+		auth:    auth,
+		key:     key,
+		baseURL: strings.TrimSuffix(baseURL, "/") + "/",
+		client:  &http.Client{Timeout: timeout},
+	}), nil
+}
+
+func parseAppKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrAppKey.New("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, ErrAppKey.New(err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrAppKey.New("not an RSA key")
+	}
+
+	return rsaKey, nil
+}
+
+type appTokenSource struct {
+	auth    *GHAppAuth
+	key     *rsa.PrivateKey
+	baseURL string
+	client  *http.Client
+}
+
+// Token implements the oauth2.TokenSource interface.
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	jwt, err := s.jwt(time.Now())
+	if err != nil {
+		return nil, ErrAppToken.New(err)
+	}
+
+	url := fmt.Sprintf(
+		"%sapp/installations/%d/access_tokens",
+		s.baseURL, s.auth.InstallationID,
+	)
+
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return nil, ErrAppToken.New(err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.machine-man-preview+json")
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.client.Timeout)
+	defer cancel()
+
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, ErrAppToken.New(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		return nil, ErrAppToken.New(res.Status)
+	}
+
+	var token struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return nil, ErrAppToken.New(err)
+	}
+
+	return &oauth2.Token{
+		AccessToken: token.Token,
+		TokenType:   "token",
+		Expiry:      token.ExpiresAt,
+	}, nil
+}
+
+// jwt returns the JSON Web Token authenticating as the App, signed with its
+// private key.
+func (s *appTokenSource) jwt(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-appJWTDrift).Unix(),
+		"exp": now.Add(appJWTExpiry).Unix(),
+		"iss": s.auth.AppID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
@@ -0,0 +1,117 @@
+package discovery
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGHAppTokenSource(t *testing.T) {
+	var req = require.New(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	req.NoError(err)
+
+	var (
+		mu       sync.Mutex
+		requests int
+		expiry   = time.Now().Add(-time.Minute)
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/app/installations/7/access_tokens" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			// the JWT is signed by the App
+			jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			parts := strings.Split(jwt, ".")
+			if len(parts) != 3 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+			hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			if err != nil || rsa.VerifyPKCS1v15(
+				&key.PublicKey, crypto.SHA256, hash[:], sig,
+			) != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+			var c struct{ Iss int64 }
+			if err != nil || json.Unmarshal(claims, &c) != nil || c.Iss != 42 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			mu.Lock()
+			requests++
+			n := requests
+			mu.Unlock()
+
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"token":"token-%d","expires_at":%q}`,
+				n, expiry.Format(time.RFC3339))
+		},
+	))
+	defer server.Close()
+
+	pemKey := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+
+	ts, err := NewGHAppTokenSource(&GHAppAuth{
+		AppID:          42,
+		InstallationID: 7,
+		PrivateKey:     pemKey,
+		BaseURL:        server.URL,
+	})
+	req.NoError(err)
+
+	// the expired tokens are requested again
+	token, err := ts.Token()
+	req.NoError(err)
+	req.Equal("token-1", token.AccessToken)
+
+	expiry = time.Now().Add(time.Hour)
+	token, err = ts.Token()
+	req.NoError(err)
+	req.Equal("token-2", token.AccessToken)
+
+	token, err = ts.Token()
+	req.NoError(err)
+	req.Equal("token-2", token.AccessToken)
+
+	ts, err = NewGHAppTokenSource(&GHAppAuth{
+		AppID:          42,
+		InstallationID: 8,
+		PrivateKey:     pemKey,
+		BaseURL:        server.URL,
+	})
+	req.NoError(err)
+	_, err = ts.Token()
+	req.True(ErrAppToken.Is(err))
+
+	_, err = NewGHAppTokenSource(&GHAppAuth{PrivateKey: []byte("foo")})
+	req.True(ErrAppKey.Is(err))
+}
@@ -0,0 +1,116 @@
+package discovery
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrCursor is returned when the cursor of a provider can't be loaded or
+// saved.
+var ErrCursor = errors.NewKind("unable to %s the discovery cursor of %s")
+
+// Cursor is the position of the listing of a ResumableIter.
+type Cursor struct {
+	// Page is the page of the listing the next repository is in.
+	Page int `json:"page"`
+	// Offset is the number of repositories of the page already returned.
+	Offset int `json:"offset"`
+}
+
+// ResumableIter is a GHRepositoriesIter whose position can be saved to
+// resume the listing later.
+type ResumableIter interface {
+	GHRepositoriesIter
+	// Cursor returns the position after the last returned repository.
+	Cursor() Cursor
+	// Resume makes the listing continue from the given position.
+	Resume(Cursor)
+}
+
+// CursorStore persists the Cursors of the providers by name, so the discovery
+// resumes where it left off when the collector is restarted.
+type CursorStore interface {
+	// Load returns the Cursor saved with the given name, false if there
+	// is none.
+	Load(name string) (Cursor, bool, error)
+	// Save saves the Cursor with the given name.
+	Save(name string, c Cursor) error
+}
+
+// FileCursorStore is a CursorStore keeping the Cursors in a JSON file.
+type FileCursorStore struct {
+	path string
+
+	mu      sync.Mutex
+	cursors map[string]Cursor
+}
+
+var _ CursorStore = (*FileCursorStore)(nil)
+
+// NewFileCursorStore builds a FileCursorStore reading the Cursors saved in
+// the file at the given path, if it exists.
+func NewFileCursorStore(path string) (*FileCursorStore, error) {
+	s := &FileCursorStore{path: path, cursors: map[string]Cursor{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+
+	if err == nil {
+		err = json.Unmarshal(data, &s.cursors)
+	}
+
+	if err != nil {
+		return nil, ErrCursor.Wrap(err, "load", path)
+	}
+
+	return s, nil
+}
+
+// Load implements the CursorStore interface.
+func (s *FileCursorStore) Load(name string) (Cursor, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.cursors[name]
+	return c, ok, nil
+}
+
+// Save implements the CursorStore interface. The file is written aside and
+// renamed, so it's never left truncated.
+func (s *FileCursorStore) Save(name string, c Cursor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cursors[name] = c
+	data, err := json.Marshal(s.cursors)
+	if err != nil {
+		return ErrCursor.Wrap(err, "save", name)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".cursors")
+	if err != nil {
+		return ErrCursor.Wrap(err, "save", name)
+	}
+
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return ErrCursor.Wrap(err, "save", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package discovery
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	// postgres database driver
+	_ "github.com/lib/pq"
+)
+
+// cursorTimeout is the time a Cursor can take to be loaded or saved.
+const cursorTimeout = 30 * time.Second
+
+const (
+	createCursors = `CREATE TABLE IF NOT EXISTS %s (
+		name TEXT PRIMARY KEY,
+		page INTEGER NOT NULL,
+		page_offset INTEGER NOT NULL,
+		updated TIMESTAMP WITH TIME ZONE NOT NULL
+	)`
+
+	selectCursor = `SELECT page, page_offset FROM %s WHERE name = $1`
+
+	upsertCursor = `INSERT INTO %s(name, page, page_offset, updated)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (name) DO UPDATE
+	SET page = EXCLUDED.page,
+		page_offset = EXCLUDED.page_offset,
+		updated = EXCLUDED.updated`
+)
+
+// PrepareCursorsDB opens the postgres database of the given uri and creates
+// the table where a DBCursorStore keeps the Cursors if it doesn't exist yet.
+func PrepareCursorsDB(uri string, table string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", uri)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cursorTimeout)
+	defer cancel()
+
+	if _, err := db.ExecContext(
+		ctx, fmt.Sprintf(createCursors, table),
+	); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// DBCursorStore is a CursorStore keeping the Cursors in a table of a postgres
+// database prepared with PrepareCursorsDB, so several machines can share
+// them.
+type DBCursorStore struct {
+	db         *sql.DB
+	load, save string
+	now        func() time.Time
+}
+
+var _ CursorStore = (*DBCursorStore)(nil)
+
+// NewDBCursorStore builds a new DBCursorStore using the given table.
+func NewDBCursorStore(db *sql.DB, table string) *DBCursorStore {
+	return &DBCursorStore{
+		db:   db,
+		load: fmt.Sprintf(selectCursor, table),
+		save: fmt.Sprintf(upsertCursor, table),
+		now:  time.Now,
+	}
+}
+
+// Load implements the CursorStore interface.
+func (s *DBCursorStore) Load(name string) (Cursor, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cursorTimeout)
+	defer cancel()
+
+	var c Cursor
+	err := s.db.QueryRowContext(ctx, s.load, name).
+		Scan(&c.Page, &c.Offset)
+	switch {
+	case err == sql.ErrNoRows:
+		return Cursor{}, false, nil
+	case err != nil:
+		return Cursor{}, false, ErrCursor.Wrap(err, "load", name)
+	}
+
+	return c, true, nil
+}
+
+// Save implements the CursorStore interface.
+func (s *DBCursorStore) Save(name string, c Cursor) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cursorTimeout)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(
+		ctx, s.save, name, c.Page, c.Offset, s.now().UTC(),
+	); err != nil {
+		return ErrCursor.Wrap(err, "save", name)
+	}
+
+	return nil
+}
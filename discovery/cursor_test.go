@@ -0,0 +1,175 @@
+package discovery
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCursorStore(t *testing.T) {
+	var req = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector-cursors")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cursors.json")
+	store, err := NewFileCursorStore(path)
+	req.NoError(err)
+
+	_, ok, err := store.Load("github:src-d")
+	req.NoError(err)
+	req.False(ok)
+
+	req.NoError(store.Save("github:src-d", Cursor{Page: 3, Offset: 20}))
+	req.NoError(store.Save("github:bblfsh", Cursor{Page: 1}))
+	req.NoError(store.Save("github:src-d", Cursor{Page: 4, Offset: 2}))
+
+	store, err = NewFileCursorStore(path)
+	req.NoError(err)
+
+	c, ok, err := store.Load("github:src-d")
+	req.NoError(err)
+	req.True(ok)
+	req.Equal(Cursor{Page: 4, Offset: 2}, c)
+
+	c, ok, err = store.Load("github:bblfsh")
+	req.NoError(err)
+	req.True(ok)
+	req.Equal(Cursor{Page: 1}, c)
+
+	// only the cursors file is left in the directory
+	files, err := ioutil.ReadDir(dir)
+	req.NoError(err)
+	req.Len(files, 1)
+
+	req.NoError(ioutil.WriteFile(path, []byte("{"), 0644))
+	_, err = NewFileCursorStore(path)
+	req.True(ErrCursor.Is(err))
+}
+
+func TestDBCursorStore(t *testing.T) {
+	var req = require.New(t)
+
+	db, err := sql.Open("cursors", "")
+	req.NoError(err)
+	defer db.Close()
+
+	store := NewDBCursorStore(db, "cursors")
+	_, ok, err := store.Load("github:src-d")
+	req.NoError(err)
+	req.False(ok)
+
+	req.NoError(store.Save("github:src-d", Cursor{Page: 3, Offset: 20}))
+	req.NoError(store.Save("github:src-d", Cursor{Page: 4, Offset: 2}))
+
+	c, ok, err := store.Load("github:src-d")
+	req.NoError(err)
+	req.True(ok)
+	req.Equal(Cursor{Page: 4, Offset: 2}, c)
+
+	failCursorsDB(true)
+	defer failCursorsDB(false)
+
+	_, _, err = store.Load("github:src-d")
+	req.True(ErrCursor.Is(err))
+	req.True(ErrCursor.Is(store.Save("github:src-d", Cursor{})))
+}
+
+func failCursorsDB(fail bool) {
+	cursorsDB.Lock()
+	cursorsDB.fail = fail
+	cursorsDB.Unlock()
+}
+
+func init() {
+	sql.Register("cursors", cursorsDriver{})
+}
+
+// cursorsDB is the table of the cursors driver, the queries of a
+// DBCursorStore are told apart by their first word.
+var cursorsDB = struct {
+	sync.Mutex
+	rows map[string][2]int64
+	fail bool
+}{rows: map[string][2]int64{}}
+
+type cursorsDriver struct{}
+
+func (cursorsDriver) Open(string) (driver.Conn, error) {
+	return cursorsConn{}, nil
+}
+
+type cursorsConn struct{}
+
+func (cursorsConn) Prepare(query string) (driver.Stmt, error) {
+	return cursorsStmt(strings.Fields(query)[0]), nil
+}
+
+func (cursorsConn) Close() error { return nil }
+
+func (cursorsConn) Begin() (driver.Tx, error) {
+	return nil, driver.ErrSkip
+}
+
+type cursorsStmt string
+
+func (cursorsStmt) Close() error  { return nil }
+func (cursorsStmt) NumInput() int { return -1 }
+
+func (s cursorsStmt) Exec(args []driver.Value) (driver.Result, error) {
+	cursorsDB.Lock()
+	defer cursorsDB.Unlock()
+	if cursorsDB.fail || s != "INSERT" {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	cursorsDB.rows[args[0].(string)] = [2]int64{
+		args[1].(int64), args[2].(int64),
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s cursorsStmt) Query(args []driver.Value) (driver.Rows, error) {
+	cursorsDB.Lock()
+	defer cursorsDB.Unlock()
+	if cursorsDB.fail || s != "SELECT" {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	rows := &cursorsRows{}
+	if row, ok := cursorsDB.rows[args[0].(string)]; ok {
+		rows.rows = [][2]int64{row}
+	}
+
+	return rows, nil
+}
+
+type cursorsRows struct {
+	rows [][2]int64
+}
+
+func (*cursorsRows) Columns() []string {
+	return []string{"page", "page_offset"}
+}
+
+func (*cursorsRows) Close() error { return nil }
+
+func (r *cursorsRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	dest[0], dest[1] = r.rows[0][0], r.rows[0][1]
+	r.rows = r.rows[1:]
+	return nil
+}
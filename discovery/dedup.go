@@ -0,0 +1,57 @@
+package discovery
+
+import (
+	"container/list"
+	"sync"
+)
+
+// recentEndpoints is a LRU of the endpoints recently enqueued by a provider,
+// so the repositories reported again by the iterator, like the ones listed on
+// every polling cycle of WaitNewRepos, aren't enqueued twice while the
+// pipeline is still processing them.
+type recentEndpoints struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	index map[string]*list.Element
+}
+
+// newRecentEndpoints builds a recentEndpoints remembering the given number of
+// endpoints, it returns nil when the size is not positive.
+func newRecentEndpoints(size int) *recentEndpoints {
+	if size <= 0 {
+		return nil
+	}
+
+	return &recentEndpoints{
+		size:  size,
+		order: list.New(),
+		index: map[string]*list.Element{},
+	}
+}
+
+// admit reports whether the endpoint wasn't recently enqueued and records it.
+// A suppressed endpoint is refreshed, so it's kept while the iterator keeps
+// reporting it. A nil recentEndpoints admits all the endpoints.
+func (r *recentEndpoints) admit(endpoint string) bool {
+	if r == nil {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.index[endpoint]; ok {
+		r.order.MoveToFront(e)
+		return false
+	}
+
+	r.index[endpoint] = r.order.PushFront(endpoint)
+	if r.order.Len() > r.size {
+		last := r.order.Back()
+		r.order.Remove(last)
+		delete(r.index, last.Value.(string))
+	}
+
+	return true
+}
@@ -0,0 +1,82 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentEndpoints(t *testing.T) {
+	var req = require.New(t)
+
+	var recent *recentEndpoints
+	req.Nil(newRecentEndpoints(0))
+	req.True(recent.admit("a"))
+	req.True(recent.admit("a"))
+
+	recent = newRecentEndpoints(2)
+	req.True(recent.admit("a"))
+	req.True(recent.admit("b"))
+	req.False(recent.admit("a"))
+
+	// b is the least recently seen, it's evicted by c
+	req.True(recent.admit("c"))
+	req.False(recent.admit("a"))
+	req.True(recent.admit("b"))
+	req.False(recent.admit("b"))
+}
+
+func TestGHPullProviderDedupWindow(t *testing.T) {
+	var req = require.New(t)
+
+	var (
+		a = "https://github.com/src-d/a"
+		b = "https://github.com/src-d/b"
+	)
+
+	// a polling iterator reporting the same repositories again
+	repos := []*github.Repository{
+		{HTMLURL: &a}, {HTMLURL: &b}, {HTMLURL: &a}, {HTMLURL: &b},
+	}
+
+	provider := NewGHPullProvider(
+		&sliceReposIter{repos: repos},
+		&GHProviderOpts{DedupWindow: 10},
+	)
+
+	var endpoints []string
+	ctx := context.Background()
+	for {
+		job, err := provider.Next(ctx)
+		if err != nil {
+			req.True(gitcollector.ErrProviderStopped.Is(err))
+			break
+		}
+
+		endpoints = append(endpoints, job.(*library.Job).Endpoints...)
+	}
+
+	req.Equal([]string{a, b}, endpoints)
+	req.Equal(2, provider.Status().Discovered)
+
+	provider = NewGHPullProvider(
+		&sliceReposIter{repos: repos},
+		&GHProviderOpts{},
+	)
+
+	var count int
+	for {
+		if _, err := provider.Next(ctx); err != nil {
+			break
+		}
+
+		count++
+	}
+
+	req.Equal(len(repos), count)
+}
@@ -0,0 +1,296 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrWrongFeedRecord is returned when a line of the feed can't be
+	// decoded as a FeedRecord.
+	ErrWrongFeedRecord = errors.NewKind("wrong feed record at offset %d")
+)
+
+// FeedRecord is an entry of a repository feed. A feed is a newline-delimited
+// stream of JSON encoded FeedRecords, each one of them turned into a
+// library.Job by the FeedProvider.
+type FeedRecord struct {
+	// Type is the kind of job to produce, "download" or "update".
+	// Download is assumed if empty.
+	Type string `json:"type,omitempty"`
+	// Endpoints of the repository.
+	Endpoints []string `json:"endpoints,omitempty"`
+	// LocationID is the location to update for update records.
+	LocationID string `json:"location,omitempty"`
+}
+
+// Job builds the library.Job represented by the record.
+func (r *FeedRecord) Job() (*library.Job, error) {
+	switch r.Type {
+	case "", "download":
+		if len(r.Endpoints) == 0 {
+			return nil, ErrEndpointsNotFound.New("feed record")
+		}
+
+		return &library.Job{
+			Type:      library.JobDownload,
+			Endpoints: r.Endpoints,
+		}, nil
+	case "update":
+		return &library.Job{
+			Type:       library.JobUpdate,
+			Endpoints:  r.Endpoints,
+			LocationID: borges.LocationID(r.LocationID),
+		}, nil
+	default:
+		return nil, errWrongRecordType.New(r.Type)
+	}
+}
+
+var errWrongRecordType = errors.NewKind("wrong feed record type %q")
+
+// OffsetStore persists the offset of the last consumed record of a feed.
+type OffsetStore interface {
+	// Load retrieves the last saved offset, 0 if none.
+	Load() (int64, error)
+	// Save persists the given offset.
+	Save(int64) error
+}
+
+// FileOffsetStore is an OffsetStore keeping the offset in a local file.
+type FileOffsetStore struct {
+	path string
+}
+
+var _ OffsetStore = (*FileOffsetStore)(nil)
+
+// NewFileOffsetStore builds a new FileOffsetStore.
+func NewFileOffsetStore(path string) *FileOffsetStore {
+	return &FileOffsetStore{path: path}
+}
+
+// Load implements the OffsetStore interface.
+func (s *FileOffsetStore) Load() (int64, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// Save implements the OffsetStore interface.
+func (s *FileOffsetStore) Save(offset int64) error {
+	tmp := s.path + ".tmp"
+	data := []byte(strconv.FormatInt(offset, 10))
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+type memOffsetStore struct {
+	offset int64
+}
+
+func (s *memOffsetStore) Load() (int64, error)    { return s.offset, nil }
+func (s *memOffsetStore) Save(offset int64) error { s.offset = offset; return nil }
+
+// FeedProviderOpts represents configuration options for a FeedProvider.
+type FeedProviderOpts struct {
+	// Follow keeps reading the feed waiting for new records once the end
+	// is reached.
+	Follow bool
+	// PollInterval is the time waited for new records when following.
+	PollInterval time.Duration
+	// SkipWrongRecords ignores records that can't be decoded instead of
+	// stopping the provider.
+	SkipWrongRecords bool
+	// Offsets keeps track of the consumed records. The offset is saved
+	// right after the job is enqueued, not once it's processed, so the
+	// jobs enqueued but not yet processed when the collector stops
+	// abruptly are lost. The records are only delivered at least once
+	// if the queue is stored by a gitcollector.PersistentQueue, like with
+	// --queue. If nil the offsets are kept in memory.
+	Offsets OffsetStore
+	// StopTimeout is the time the service waits to be stopped after a
+	// Stop call is performed.
+	StopTimeout time.Duration
+}
+
+// FeedProvider is a gitcollector.Provider implementation. It tails a
+// repository feed file producing a gitcollector.Job for each of its records.
+type FeedProvider struct {
+	path   string
+	queue  chan<- gitcollector.Job
+	cancel chan struct{}
+	opts   *FeedProviderOpts
+}
+
+var _ gitcollector.Provider = (*FeedProvider)(nil)
+
+const pollInterval = 5 * time.Second
+
+// NewFeedProvider builds a new FeedProvider reading the feed in the given path.
+func NewFeedProvider(
+	path string,
+	queue chan<- gitcollector.Job,
+	opts *FeedProviderOpts,
+) *FeedProvider {
+	if opts == nil {
+		opts = &FeedProviderOpts{}
+	}
+
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = pollInterval
+	}
+
+	if opts.StopTimeout <= 0 {
+		opts.StopTimeout = stopTimeout
+	}
+
+	if opts.Offsets == nil {
+		opts.Offsets = &memOffsetStore{}
+	}
+
+	return &FeedProvider{
+		path:   path,
+		queue:  queue,
+		cancel: make(chan struct{}),
+		opts:   opts,
+	}
+}
+
+// Start implements the gitcollector.Provider interface.
+func (p *FeedProvider) Start() error {
+	offset, err := p.opts.Offsets.Load()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	var (
+		r       = bufio.NewReader(f)
+		pending []byte
+	)
+
+	for {
+		select {
+		case <-p.cancel:
+			return gitcollector.ErrProviderStopped.New()
+		default:
+		}
+
+		line, err := r.ReadBytes('\n')
+		pending = append(pending, line...)
+		if err != nil {
+			if err != io.EOF {
+				return err
+			}
+
+			if !p.opts.Follow {
+				// a trailing record without a newline is
+				// considered complete when not following.
+				if len(bytes.TrimSpace(pending)) > 0 {
+					if _, err := p.consume(
+						pending, offset,
+					); err != nil {
+						return err
+					}
+				}
+
+				return gitcollector.ErrProviderStopped.New()
+			}
+
+			select {
+			case <-p.cancel:
+				return gitcollector.ErrProviderStopped.New()
+			case <-time.After(p.opts.PollInterval):
+			}
+
+			continue
+		}
+
+		offset, err = p.consume(pending, offset)
+		if err != nil {
+			return err
+		}
+
+		pending = nil
+	}
+}
+
+func (p *FeedProvider) consume(line []byte, offset int64) (int64, error) {
+	next := offset + int64(len(line))
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return next, nil
+	}
+
+	job, err := p.decode(line, offset)
+	if err != nil {
+		if !p.opts.SkipWrongRecords {
+			return offset, err
+		}
+
+		return next, p.opts.Offsets.Save(next)
+	}
+
+	select {
+	case p.queue <- job:
+	case <-p.cancel:
+		return offset, gitcollector.ErrProviderStopped.New()
+	}
+
+	return next, p.opts.Offsets.Save(next)
+}
+
+func (p *FeedProvider) decode(line []byte, offset int64) (*library.Job, error) {
+	var record FeedRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return nil, ErrWrongFeedRecord.Wrap(err, offset)
+	}
+
+	job, err := record.Job()
+	if err != nil {
+		return nil, ErrWrongFeedRecord.Wrap(err, offset)
+	}
+
+	return job, nil
+}
+
+// Stop implements the gitcollector.Provider interface.
+func (p *FeedProvider) Stop() error {
+	select {
+	case p.cancel <- struct{}{}:
+		return nil
+	case <-time.After(p.opts.StopTimeout):
+		return gitcollector.ErrProviderStop.New()
+	}
+}
@@ -0,0 +1,113 @@
+package discovery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedProvider(t *testing.T) {
+	var req = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector-feed")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	feed := filepath.Join(dir, "feed.jsonl")
+	req.NoError(ioutil.WriteFile(feed, []byte(
+		`{"endpoints":["https://github.com/src-d/a"]}
+{"type":"update","location":"foo"}
+
+{"endpoints":["https://github.com/src-d/b"]}
+`), 0644))
+
+	offsets := NewFileOffsetStore(filepath.Join(dir, "offset"))
+	queue := make(chan gitcollector.Job, 10)
+	provider := NewFeedProvider(feed, queue, &FeedProviderOpts{
+		Offsets: offsets,
+	})
+
+	err = provider.Start()
+	req.True(gitcollector.ErrProviderStopped.Is(err))
+	req.Len(queue, 3)
+
+	job := (<-queue).(*library.Job)
+	req.True(job.Type == library.JobDownload)
+	req.Equal([]string{"https://github.com/src-d/a"}, job.Endpoints)
+
+	job = (<-queue).(*library.Job)
+	req.True(job.Type == library.JobUpdate)
+	req.EqualValues("foo", job.LocationID)
+
+	job = (<-queue).(*library.Job)
+	req.Equal([]string{"https://github.com/src-d/b"}, job.Endpoints)
+
+	f, err := os.OpenFile(feed, os.O_APPEND|os.O_WRONLY, 0644)
+	req.NoError(err)
+	_, err = f.WriteString(`{"endpoints":["https://github.com/src-d/c"]}`)
+	req.NoError(err)
+	req.NoError(f.Close())
+
+	// a new provider resumes from the checkpointed offset
+	provider = NewFeedProvider(feed, queue, &FeedProviderOpts{
+		Offsets: offsets,
+	})
+
+	err = provider.Start()
+	req.True(gitcollector.ErrProviderStopped.Is(err))
+	req.Len(queue, 1)
+
+	job = (<-queue).(*library.Job)
+	req.Equal([]string{"https://github.com/src-d/c"}, job.Endpoints)
+}
+
+func TestFeedProviderFollow(t *testing.T) {
+	var req = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector-feed")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	feed := filepath.Join(dir, "feed.jsonl")
+	req.NoError(ioutil.WriteFile(feed, nil, 0644))
+
+	queue := make(chan gitcollector.Job, 10)
+	provider := NewFeedProvider(feed, queue, &FeedProviderOpts{
+		Follow:       true,
+		PollInterval: 10 * time.Millisecond,
+	})
+
+	done := make(chan error)
+	go func() { done <- provider.Start() }()
+
+	f, err := os.OpenFile(feed, os.O_APPEND|os.O_WRONLY, 0644)
+	req.NoError(err)
+	defer f.Close()
+
+	// a partial record is not consumed until its newline arrives
+	_, err = f.WriteString(`{"endpoints":["https://github.com/`)
+	req.NoError(err)
+	time.Sleep(50 * time.Millisecond)
+	req.Len(queue, 0)
+
+	_, err = f.WriteString("src-d/a\"]}\n")
+	req.NoError(err)
+
+	select {
+	case j := <-queue:
+		job := j.(*library.Job)
+		req.Equal([]string{"https://github.com/src-d/a"}, job.Endpoints)
+	case <-time.After(time.Second):
+		req.FailNow("record not consumed")
+	}
+
+	req.NoError(provider.Stop())
+	req.True(gitcollector.ErrProviderStopped.Is(<-done))
+}
@@ -0,0 +1,72 @@
+package discovery
+
+import (
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// FilterFn decides whether a discovered repository is downloaded, the ones it
+// returns false for are skipped before building their Jobs.
+type FilterFn func(*github.Repository) bool
+
+// FilterLanguages keeps the repositories whose main language, as detected by
+// github, is one of the given ones regardless of the case. The repositories
+// without a detected language are skipped.
+func FilterLanguages(langs ...string) FilterFn {
+	set := map[string]bool{}
+	for _, lang := range langs {
+		set[strings.ToLower(lang)] = true
+	}
+
+	return func(r *github.Repository) bool {
+		return set[strings.ToLower(r.GetLanguage())]
+	}
+}
+
+// FilterMaxSize keeps the repositories up to the given size in bytes.
+func FilterMaxSize(size uint64) FilterFn {
+	return func(r *github.Repository) bool {
+		// the API reports the size in kilobytes.
+		return uint64(r.GetSize())*1024 <= size
+	}
+}
+
+// FilterNotFork skips the forks.
+func FilterNotFork() FilterFn {
+	return func(r *github.Repository) bool {
+		return !r.GetFork()
+	}
+}
+
+// FilterNotArchived skips the archived repositories.
+func FilterNotArchived() FilterFn {
+	return func(r *github.Repository) bool {
+		return !r.GetArchived()
+	}
+}
+
+// AllFilters keeps the repositories kept by every one of the given filters,
+// the nil ones are ignored. It returns nil if there isn't any filter.
+func AllFilters(filters ...FilterFn) FilterFn {
+	var fns []FilterFn
+	for _, fn := range filters {
+		if fn != nil {
+			fns = append(fns, fn)
+		}
+	}
+
+	if len(fns) == 0 {
+		return nil
+	}
+
+	return func(r *github.Repository) bool {
+		for _, fn := range fns {
+			if !fn(r) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
@@ -0,0 +1,65 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilters(t *testing.T) {
+	var req = require.New(t)
+
+	repo := func(lang string, size int, fork, archived bool) *github.Repository {
+		return &github.Repository{
+			Language: &lang,
+			Size:     &size,
+			Fork:     &fork,
+			Archived: &archived,
+		}
+	}
+
+	langs := FilterLanguages("Go", "python")
+	req.True(langs(repo("go", 0, false, false)))
+	req.True(langs(repo("Python", 0, false, false)))
+	req.False(langs(repo("Rust", 0, false, false)))
+	req.False(langs(&github.Repository{}))
+
+	size := FilterMaxSize(2048)
+	req.True(size(repo("", 2, false, false)))
+	req.False(size(repo("", 3, false, false)))
+
+	req.False(FilterNotFork()(repo("", 0, true, false)))
+	req.True(FilterNotFork()(repo("", 0, false, true)))
+	req.False(FilterNotArchived()(repo("", 0, false, true)))
+	req.True(FilterNotArchived()(repo("", 0, true, false)))
+
+	req.Nil(AllFilters(nil, nil))
+	all := AllFilters(langs, nil, FilterNotFork())
+	req.True(all(repo("Go", 0, false, false)))
+	req.False(all(repo("Go", 0, true, false)))
+	req.False(all(repo("Rust", 0, false, false)))
+
+	// the filtered out repositories aren't enqueued
+	url := "https://github.com/src-d/gitcollector"
+	fork := repo("Go", 0, true, false)
+	fork.HTMLURL = &url
+	kept := repo("Go", 0, false, false)
+	kept.HTMLURL = &url
+
+	queue := make(chan gitcollector.Job, 2)
+	provider := NewGHProvider(
+		queue,
+		&sliceReposIter{repos: []*github.Repository{fork, kept}},
+		&GHProviderOpts{Filter: FilterNotFork()},
+	)
+
+	err := provider.StartContext(context.Background())
+	req.True(gitcollector.ErrProviderStopped.Is(err))
+	req.Len(queue, 1)
+	req.Equal(url, (<-queue).(*library.Job).Endpoints[0])
+}
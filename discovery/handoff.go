@@ -0,0 +1,123 @@
+package discovery
+
+import (
+	"sync"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+)
+
+// HandoffProviderOpts represents configuration options for a HandoffProvider.
+type HandoffProviderOpts struct {
+	// Interval is the time between checks of the handoff directory once
+	// there are no pending jobs, default to 10 seconds.
+	Interval time.Duration
+}
+
+const handoffInterval = 10 * time.Second
+
+// HandoffProvider is a gitcollector.Provider implementation producing the Jobs
+// claimed from a library.Handoff written by a discovery-only machine. It
+// keeps checking the directory for new Jobs until it's stopped.
+type HandoffProvider struct {
+	handoff *library.Handoff
+	queue   chan<- gitcollector.Job
+	cancel  chan struct{}
+	opts    *HandoffProviderOpts
+	status  providerStatus
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+var (
+	_ gitcollector.Provider       = (*HandoffProvider)(nil)
+	_ gitcollector.ProviderStatus = (*HandoffProvider)(nil)
+)
+
+// NewHandoffProvider builds a new HandoffProvider claiming the Jobs of the
+// given library.Handoff.
+func NewHandoffProvider(
+	h *library.Handoff,
+	queue chan<- gitcollector.Job,
+	opts *HandoffProviderOpts,
+) *HandoffProvider {
+	if opts == nil {
+		opts = &HandoffProviderOpts{}
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = handoffInterval
+	}
+
+	return &HandoffProvider{
+		handoff: h,
+		queue:   queue,
+		cancel:  make(chan struct{}),
+		opts:    opts,
+	}
+}
+
+// Start implements the gitcollector.Provider interface.
+func (p *HandoffProvider) Start() error {
+	err := p.start()
+	p.status.done(err)
+	return err
+}
+
+func (p *HandoffProvider) start() error {
+	for {
+		select {
+		case <-p.cancel:
+			return gitcollector.ErrProviderStopped.New()
+		default:
+		}
+
+		job, err := p.handoff.Claim()
+		if err != nil {
+			if !library.ErrHandoffEmpty.Is(err) {
+				p.status.fail(err)
+			}
+
+			select {
+			case <-p.cancel:
+				return gitcollector.ErrProviderStopped.New()
+			case <-time.After(p.opts.Interval):
+			}
+
+			continue
+		}
+
+		select {
+		case p.queue <- job:
+			p.status.produced()
+		case <-p.cancel:
+			// it's left for the rest of the machines.
+			if err := p.handoff.Release(job); err != nil {
+				return err
+			}
+
+			return gitcollector.ErrProviderStopped.New()
+		}
+	}
+}
+
+// Status implements the gitcollector.ProviderStatus interface.
+func (p *HandoffProvider) Status() gitcollector.ProviderState {
+	state := p.status.state(nil)
+	state.Name = "handoff"
+	return state
+}
+
+// Stop implements the gitcollector.Provider interface.
+func (p *HandoffProvider) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.cancel)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package discovery
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+)
+
+func TestHandoffProvider(t *testing.T) {
+	var req = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector-handoff")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fs := osfs.New(dir)
+	out, err := library.OpenHandoff(fs, "discovery")
+	req.NoError(err)
+	req.NoError(out.Put(&library.Job{
+		Type:      library.JobDownload,
+		Endpoints: []string{"https://github.com/src-d/a"},
+	}))
+
+	in, err := library.OpenHandoff(fs, "worker")
+	req.NoError(err)
+
+	queue := make(chan gitcollector.Job)
+	provider := NewHandoffProvider(in, queue, &HandoffProviderOpts{
+		Interval: 10 * time.Millisecond,
+	})
+
+	done := make(chan error)
+	go func() { done <- provider.Start() }()
+
+	next := func() *library.Job {
+		select {
+		case j := <-queue:
+			return j.(*library.Job)
+		case <-time.After(5 * time.Second):
+			req.FailNow("job not claimed")
+			return nil
+		}
+	}
+
+	req.Equal([]string{"https://github.com/src-d/a"}, next().Endpoints)
+
+	// the jobs written later are claimed too
+	req.NoError(out.Put(&library.Job{
+		Type:      library.JobDownload,
+		Endpoints: []string{"https://github.com/src-d/b"},
+	}))
+	req.Equal([]string{"https://github.com/src-d/b"}, next().Endpoints)
+	req.Equal(2, provider.Status().Discovered)
+
+	// the job claimed while stopping is released
+	req.NoError(out.Put(&library.Job{
+		Type:      library.JobDownload,
+		Endpoints: []string{"https://github.com/src-d/c"},
+	}))
+	time.Sleep(50 * time.Millisecond)
+	req.NoError(provider.Stop())
+
+	select {
+	case err := <-done:
+		req.True(gitcollector.ErrProviderStopped.Is(err))
+	case <-time.After(5 * time.Second):
+		req.FailNow("provider not stopped")
+	}
+
+	job, err := out.Claim()
+	req.NoError(err)
+	req.Equal([]string{"https://github.com/src-d/c"}, job.Endpoints)
+	req.True(provider.Status().Done)
+}
@@ -2,9 +2,13 @@ package discovery
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/src-d/gitcollector"
+
 	"github.com/google/go-github/github"
 	"golang.org/x/oauth2"
 )
@@ -20,28 +24,93 @@ type GHReposIterOpts struct {
 	ResultsPerPage int
 	TimeNewRepos   time.Duration
 	AuthToken      string
+	// TokenSource authenticates the API requests instead of AuthToken if
+	// set, like the one of a github App built by NewGHAppTokenSource.
+	TokenSource oauth2.TokenSource
+	// MaxRateLimitWait is the maximum time to wait for the rate limit
+	// reset, default to 1 hour.
+	MaxRateLimitWait time.Duration
+	// LocalClock makes the time to the rate limit reset to be computed
+	// with the local clock instead of the Date header of the API
+	// responses. The reset time is given by the server, so a skewed local
+	// clock leads to wrong waits.
+	LocalClock bool
+	// Outage detects the unavailability of the API, so the requests are
+	// throttled while it lasts.
+	Outage *gitcollector.OutageDetector
+	// RateLimiter limits the API requests, it can be shared by several
+	// iterators to keep all of them under the same budget.
+	RateLimiter *gitcollector.RateLimiter
+	// APIUsage counts the API requests as made by the provider of the
+	// iterator.
+	APIUsage *gitcollector.APIUsage
 }
 
 const (
 	httpTimeout    = 30 * time.Second
 	resultsPerPage = 100
 	waitNewRepos   = 24 * time.Hour
+	rateLimitWait  = time.Hour
 )
 
 // GHOrgReposIter is a GHRepositoriesIter by organization name.
 type GHOrgReposIter struct {
-	org          string
-	client       *github.Client
-	repos        []*github.Repository
-	checkpoint   int
-	opts         *github.RepositoryListByOrgOptions
-	waitNewRepos time.Duration
+	*ghReposPager
+	org string
 }
 
-var _ GHRepositoriesIter = (*GHOrgReposIter)(nil)
+var (
+	_ GHRepositoriesIter          = (*GHOrgReposIter)(nil)
+	_ ResumableIter               = (*GHOrgReposIter)(nil)
+	_ gitcollector.ProviderStatus = (*GHOrgReposIter)(nil)
+)
 
 // NewGHOrgReposIter builds a new GHOrgReposIter.
 func NewGHOrgReposIter(org string, opts *GHReposIterOpts) *GHOrgReposIter {
+	p := newGHReposPager("github:"+org, opts)
+	p.list = func(
+		ctx context.Context,
+		page *github.ListOptions,
+	) ([]*github.Repository, *github.Response, error) {
+		return p.client.Repositories.ListByOrg(
+			ctx,
+			org,
+			&github.RepositoryListByOrgOptions{ListOptions: *page},
+		)
+	}
+
+	return &GHOrgReposIter{ghReposPager: p, org: org}
+}
+
+// ghReposPager requests the pages of a github repositories listing, keeping
+// the position in the last page so the repositories added to it are returned
+// once the listing is requested again.
+type ghReposPager struct {
+	client     *github.Client
+	list       ghReposListFn
+	repos      []*github.Repository
+	checkpoint int
+	page       *github.ListOptions
+	// cursor is the position of the next repository of repos.
+	cursor       Cursor
+	waitNewRepos time.Duration
+	maxWait      time.Duration
+	localClock   bool
+	outage       *gitcollector.OutageDetector
+	limiter      *gitcollector.RateLimiter
+
+	mu    sync.Mutex
+	state gitcollector.ProviderState
+}
+
+// ghReposListFn requests a page of a repositories listing. The new
+// repositories must be appended at the end of the listing.
+type ghReposListFn func(
+	ctx context.Context,
+	page *github.ListOptions,
+) ([]*github.Repository, *github.Response, error)
+
+func newGHReposPager(name string, opts *GHReposIterOpts) *ghReposPager {
 	if opts == nil {
 		opts = &GHReposIterOpts{}
 	}
@@ -61,38 +130,94 @@ func NewGHOrgReposIter(org string, opts *GHReposIterOpts) *GHOrgReposIter {
 		wnr = waitNewRepos
 	}
 
-	return &GHOrgReposIter{
-		org:    org,
-		client: newGithubClient(opts.AuthToken, to),
-		opts: &github.RepositoryListByOrgOptions{
-			ListOptions: github.ListOptions{PerPage: rpp},
-		},
+	mw := opts.MaxRateLimitWait
+	if mw <= 0 {
+		mw = rateLimitWait
+	}
+
+	client := newGithubClient(
+		tokenSource(opts.AuthToken, opts.TokenSource),
+		to, opts.APIUsage, name,
+	)
+	return &ghReposPager{
+		client:       client,
+		page:         &github.ListOptions{PerPage: rpp},
 		waitNewRepos: wnr,
+		maxWait:      mw,
+		localClock:   opts.LocalClock,
+		outage:       opts.Outage,
+		limiter:      opts.RateLimiter,
+		state: gitcollector.ProviderState{
+			Name:               name,
+			Cursor:             "page 0",
+			RateLimitRemaining: -1,
+		},
 	}
 }
 
-func newGithubClient(token string, timeout time.Duration) *github.Client {
-	var client *http.Client
+// Status implements the gitcollector.ProviderStatus interface. Discovered is
+// the number of repositories returned by the iterator.
+func (p *ghReposPager) Status() gitcollector.ProviderState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+func (p *ghReposPager) updateState(res *github.Response, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if res != nil {
+		p.state.RateLimitRemaining = res.Rate.Remaining
+		p.state.RateLimitReset = res.Rate.Reset.Time
+	}
+
+	if err != nil && !ErrNewRepositoriesNotFound.Is(err) {
+		p.state.LastError = err
+		p.state.LastErrorTime = time.Now()
+	}
+
+	p.state.Cursor = fmt.Sprintf("page %d", p.page.Page)
+}
+
+// tokenSource returns the source of the tokens authenticating the API
+// requests, nil for anonymous requests.
+func tokenSource(token string, ts oauth2.TokenSource) oauth2.TokenSource {
+	if ts != nil {
+		return ts
+	}
+
 	if token == "" {
+		return nil
+	}
+
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+}
+
+func newGithubClient(
+	ts oauth2.TokenSource,
+	timeout time.Duration,
+	usage *gitcollector.APIUsage,
+	provider string,
+) *github.Client {
+	var client *http.Client
+	if ts == nil {
 		client = &http.Client{}
 	} else {
-		client = oauth2.NewClient(
-			context.Background(),
-			oauth2.StaticTokenSource(
-				&oauth2.Token{AccessToken: token},
-			),
-		)
+		client = oauth2.NewClient(context.Background(), ts)
 	}
 
 	client.Timeout = timeout
+	client.Transport = usage.Transport(provider, client.Transport)
 	return github.NewClient(client)
 }
 
 // Next implements the GHRepositoriesIter interface.
-func (p *GHOrgReposIter) Next(
+func (p *ghReposPager) Next(
 	ctx context.Context,
 ) (*github.Repository, time.Duration, error) {
-	if len(p.repos) == 0 {
+	// a page resumed once all its repositories were returned is empty.
+	for len(p.repos) == 0 {
 		retry, err := p.requestRepos(ctx)
 		if err != nil && len(p.repos) == 0 {
 			return nil, retry, err
@@ -101,24 +226,60 @@ func (p *GHOrgReposIter) Next(
 
 	var next *github.Repository
 	next, p.repos = p.repos[0], p.repos[1:]
+	p.cursor.Offset++
+
+	p.mu.Lock()
+	p.state.Discovered++
+	p.mu.Unlock()
 	return next, 0, nil
 }
 
-func (p *GHOrgReposIter) requestRepos(
+// Cursor implements the ResumableIter interface.
+func (p *ghReposPager) Cursor() Cursor {
+	return p.cursor
+}
+
+// Resume implements the ResumableIter interface. It must be called before
+// the first repository is requested.
+func (p *ghReposPager) Resume(c Cursor) {
+	p.page.Page = c.Page
+	p.checkpoint = c.Offset
+	p.cursor = c
+	p.repos = nil
+}
+
+func (p *ghReposPager) requestRepos(
 	ctx context.Context,
 ) (time.Duration, error) {
-	repos, res, err := p.client.Repositories.ListByOrg(
-		ctx,
-		p.org,
-		p.opts,
+	var (
+		repos []*github.Repository
+		res   *github.Response
 	)
 
+	err := p.outage.Do(ctx, func(ctx context.Context) error {
+		if err := p.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		var err error
+		repos, res, err = p.list(ctx, p.page)
+		return apiError(err)
+	})
+
+	p.updateState(res, err)
 	if err != nil {
 		if _, ok := err.(*github.RateLimitError); !ok {
 			return -1, err
 		}
 
-		return timeToRetry(res), ErrRateLimitExceeded.Wrap(err)
+		wait := timeToRetry(res, p.maxWait, p.localClock)
+		return wait, ErrRateLimitExceeded.Wrap(err)
+	}
+
+	// the first page is requested as page 0 too.
+	p.cursor = Cursor{Page: p.page.Page, Offset: 0}
+	if p.cursor.Page == 0 {
+		p.cursor.Page = 1
 	}
 
 	bufRepos := repos
@@ -130,39 +291,89 @@ func (p *GHOrgReposIter) requestRepos(
 		}
 
 		bufRepos = repos[i:]
+		p.cursor.Offset = i
 	}
 
-	if len(repos) < p.opts.PerPage {
+	p.checkpoint = 0
+	if len(repos) < p.page.PerPage {
 		p.checkpoint = len(repos)
 	}
 
 	err = nil
 	if res.NextPage == 0 {
-		if len(repos) == p.opts.PerPage {
-			p.opts.Page++
+		if len(repos) == p.page.PerPage {
+			p.page.Page = p.cursor.Page + 1
 		}
 
 		err = ErrNewRepositoriesNotFound.New()
 	} else {
-		p.opts.Page = res.NextPage
+		p.page.Page = res.NextPage
 	}
 
 	p.repos = bufRepos
+	p.updateState(nil, nil)
 	return p.waitNewRepos, err
 }
 
-func timeToRetry(res *github.Response) time.Duration {
-	now := time.Now().UTC().Unix()
-	resetTime := res.Rate.Reset.UTC().Unix()
-	timeToReset := time.Duration(resetTime-now) * time.Second
+// serverError gives the API 5xx responses a status code, so they're
+// classified as gitcollector.ErrorClassServer.
+type serverError struct {
+	*github.ErrorResponse
+}
+
+// StatusCode returns the status code of the response.
+func (e *serverError) StatusCode() int {
+	return e.Response.StatusCode
+}
+
+func apiError(err error) error {
+	e, ok := err.(*github.ErrorResponse)
+	if !ok || e.Response == nil || e.Response.StatusCode < 500 {
+		return err
+	}
+
+	return &serverError{e}
+}
+
+// minRateLimitWait is the time waited when the rate limit should already be
+// reset. It also covers the second resolution of the Date header.
+const minRateLimitWait = time.Second
+
+// timeToRetry computes the time to wait before the next request spreading the
+// remaining requests until the rate limit reset. The current time is taken
+// from the Date header of the response unless localClock is set, so the
+// computation doesn't depend on the local clock being in sync with the
+// server one.
+func timeToRetry(
+	res *github.Response,
+	maxWait time.Duration,
+	localClock bool,
+) time.Duration {
+	if res == nil {
+		return maxWait
+	}
+
+	now := time.Now()
+	if !localClock && res.Response != nil {
+		date, err := http.ParseTime(res.Header.Get("Date"))
+		if err == nil {
+			now = date
+		}
+	}
+
+	timeToReset := res.Rate.Reset.Time.Sub(now)
 	remaining := res.Rate.Remaining
-	if timeToReset < 0 || timeToReset > 1*time.Hour {
-		// If this happens, the system clock is probably wrong, so we
+	if timeToReset < 0 {
+		return minRateLimitWait
+	}
+
+	if timeToReset > maxWait {
+		// If this happens, the clock used is probably wrong, so we
 		// assume we are at the beginning of the window and consider
-		// only total requests per hour.
-		timeToReset = 1 * time.Hour
+		// only total requests per window.
+		timeToReset = maxWait
 		remaining = res.Rate.Limit
 	}
 
-	return timeToReset / time.Duration(remaining+1)
+	return (timeToReset + minRateLimitWait) / time.Duration(remaining+1)
 }
@@ -0,0 +1,107 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeToRetry(t *testing.T) {
+	var req = require.New(t)
+
+	// server clock is two hours behind the local one.
+	server := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	response := func(reset time.Duration, remaining int) *github.Response {
+		header := http.Header{}
+		header.Set("Date", server.UTC().Format(http.TimeFormat))
+		return &github.Response{
+			Response: &http.Response{Header: header},
+			Rate: github.Rate{
+				Limit:     5000,
+				Remaining: remaining,
+				Reset:     github.Timestamp{Time: server.Add(reset)},
+			},
+		}
+	}
+
+	res := response(10*time.Minute, 0)
+	req.Equal(10*time.Minute+time.Second, timeToRetry(res, time.Hour, false))
+
+	// the local clock considers the reset already passed
+	req.Equal(minRateLimitWait, timeToRetry(res, time.Hour, true))
+
+	res = response(10*time.Minute, 9)
+	req.Equal(time.Minute+100*time.Millisecond,
+		timeToRetry(res, time.Hour, false))
+
+	res = response(-time.Minute, 0)
+	req.Equal(minRateLimitWait, timeToRetry(res, time.Hour, false))
+
+	res = response(3*time.Hour, 0)
+	req.Equal((time.Hour+time.Second)/5001,
+		timeToRetry(res, time.Hour, false))
+
+	req.Equal(time.Hour, timeToRetry(nil, time.Hour, false))
+}
+
+func TestGHOrgReposIterStatus(t *testing.T) {
+	var require = require.New(t)
+
+	var fail bool
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", "42")
+			w.Header().Set("X-RateLimit-Reset",
+				strconv.FormatInt(reset.Unix(), 10))
+
+			if fail {
+				w.WriteHeader(http.StatusBadGateway)
+				w.Write([]byte(`{"message": "bad gateway"}`))
+				return
+			}
+
+			w.Write([]byte(`[{"name": "foo"}, {"name": "bar"}]`))
+		},
+	))
+	defer server.Close()
+
+	iter := NewGHOrgReposIter("src-d", nil)
+	iter.client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	status := iter.Status()
+	require.Equal("github:src-d", status.Name)
+	require.Equal(-1, status.RateLimitRemaining)
+
+	ctx := context.Background()
+	_, _, err := iter.Next(ctx)
+	require.NoError(err)
+	_, _, err = iter.Next(ctx)
+	require.NoError(err)
+
+	status = iter.Status()
+	require.Equal(2, status.Discovered)
+	require.Equal(42, status.RateLimitRemaining)
+	require.True(reset.Equal(status.RateLimitReset))
+	require.NoError(status.LastError)
+
+	fail = true
+	_, _, err = iter.Next(ctx)
+	require.Error(err)
+	require.Equal(gitcollector.ErrorClassServer, gitcollector.ClassifyError(err))
+
+	status = iter.Status()
+	require.Equal(2, status.Discovered)
+	require.Equal(err, status.LastError)
+	require.False(status.LastErrorTime.IsZero())
+}
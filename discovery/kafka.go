@@ -0,0 +1,233 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// ErrWrongKafkaMessage is returned when a message of the topic can't be
+// turned into a Job.
+var ErrWrongKafkaMessage = errors.NewKind(
+	"wrong kafka message at partition %d offset %d")
+
+// KafkaReader reads the messages of a topic committing the consumed ones,
+// like the kafka.Reader of a consumer group.
+type KafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+var _ KafkaReader = (*kafka.Reader)(nil)
+
+// KafkaProviderOpts represents configuration options for a KafkaProvider.
+type KafkaProviderOpts struct {
+	// Group is the consumer group the topic is read by, default to
+	// gitcollector. The messages are committed once their Jobs are
+	// enqueued, so every message is delivered at least once.
+	Group string
+	// SkipWrongMessages ignores the messages that can't be turned into a
+	// Job instead of stopping the provider.
+	SkipWrongMessages bool
+	// Reader reads the topic instead of a kafka.Reader of the brokers.
+	Reader KafkaReader
+}
+
+const kafkaGroup = "gitcollector"
+
+// KafkaProvider is a gitcollector.Provider implementation. It consumes a
+// Kafka topic producing a Job for every message, either the URL of a
+// repository to download or a JSON encoded FeedRecord.
+type KafkaProvider struct {
+	topic  string
+	reader KafkaReader
+	queue  chan<- gitcollector.Job
+	cancel chan struct{}
+	opts   *KafkaProviderOpts
+	status providerStatus
+
+	mu       sync.Mutex
+	stopped  bool
+	messages int
+	wrong    int
+}
+
+var (
+	_ gitcollector.Provider       = (*KafkaProvider)(nil)
+	_ gitcollector.ProviderStatus = (*KafkaProvider)(nil)
+)
+
+// NewKafkaProvider builds a new KafkaProvider consuming the given topic from
+// the brokers, as host:port.
+func NewKafkaProvider(
+	brokers []string,
+	topic string,
+	queue chan<- gitcollector.Job,
+	opts *KafkaProviderOpts,
+) *KafkaProvider {
+	if opts == nil {
+		opts = &KafkaProviderOpts{}
+	}
+
+	if opts.Group == "" {
+		opts.Group = kafkaGroup
+	}
+
+	reader := opts.Reader
+	if reader == nil {
+		reader = kafka.NewReader(kafka.ReaderConfig{
+			Brokers: brokers,
+			Topic:   topic,
+			GroupID: opts.Group,
+		})
+	}
+
+	return &KafkaProvider{
+		topic:  topic,
+		reader: reader,
+		queue:  queue,
+		cancel: make(chan struct{}),
+		opts:   opts,
+	}
+}
+
+// Start implements the gitcollector.Provider interface. The reader is closed
+// once the provider stops.
+func (p *KafkaProvider) Start() error {
+	err := p.start()
+	if cerr := p.reader.Close(); err == nil {
+		err = cerr
+	}
+
+	p.status.done(err)
+	return err
+}
+
+func (p *KafkaProvider) start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-p.cancel:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		msg, err := p.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return gitcollector.ErrProviderStopped.New()
+			}
+
+			return err
+		}
+
+		if err := p.consume(ctx, msg); err != nil {
+			return err
+		}
+
+		if err := p.reader.CommitMessages(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return gitcollector.ErrProviderStopped.New()
+			}
+
+			return err
+		}
+	}
+}
+
+func (p *KafkaProvider) consume(ctx context.Context, msg kafka.Message) error {
+	p.mu.Lock()
+	p.messages++
+	p.mu.Unlock()
+
+	job, err := kafkaJob(msg)
+	if err != nil {
+		if !p.opts.SkipWrongMessages {
+			return err
+		}
+
+		p.mu.Lock()
+		p.wrong++
+		p.mu.Unlock()
+
+		p.status.fail(err)
+		log.Warningf("kafka message skipped: %s", err)
+		return nil
+	}
+
+	if job == nil {
+		return nil
+	}
+
+	select {
+	case p.queue <- job:
+	case <-ctx.Done():
+		return gitcollector.ErrProviderStopped.New()
+	}
+
+	p.status.produced()
+	return nil
+}
+
+// kafkaJob returns the Job of a message, nil if it's empty.
+func kafkaJob(msg kafka.Message) (*library.Job, error) {
+	value := bytes.TrimSpace(msg.Value)
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	record := &FeedRecord{Endpoints: []string{string(value)}}
+	if value[0] == '{' {
+		record = &FeedRecord{}
+		if err := json.Unmarshal(value, record); err != nil {
+			return nil, ErrWrongKafkaMessage.Wrap(
+				err, msg.Partition, msg.Offset,
+			)
+		}
+	}
+
+	job, err := record.Job()
+	if err != nil {
+		return nil, ErrWrongKafkaMessage.Wrap(err, msg.Partition, msg.Offset)
+	}
+
+	return job, nil
+}
+
+// Status implements the gitcollector.ProviderStatus interface.
+func (p *KafkaProvider) Status() gitcollector.ProviderState {
+	state := p.status.state(nil)
+	state.Name = "kafka " + p.topic
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state.Cursor = fmt.Sprintf(
+		"%d messages read, %d wrong", p.messages, p.wrong,
+	)
+
+	return state
+}
+
+// Stop implements the gitcollector.Provider interface.
+func (p *KafkaProvider) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.cancel)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testKafkaReader struct {
+	mu        sync.Mutex
+	messages  []kafka.Message
+	committed []int64
+	closed    bool
+}
+
+func (r *testKafkaReader) FetchMessage(
+	ctx context.Context,
+) (kafka.Message, error) {
+	r.mu.Lock()
+	if len(r.messages) > 0 {
+		msg := r.messages[0]
+		r.messages = r.messages[1:]
+		r.mu.Unlock()
+		return msg, nil
+	}
+
+	r.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *testKafkaReader) CommitMessages(
+	_ context.Context,
+	msgs ...kafka.Message,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, msg := range msgs {
+		r.committed = append(r.committed, msg.Offset)
+	}
+
+	return nil
+}
+
+func (r *testKafkaReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+func TestKafkaProvider(t *testing.T) {
+	var req = require.New(t)
+
+	reader := &testKafkaReader{messages: []kafka.Message{
+		{Offset: 0, Value: []byte("https://github.com/src-d/a\n")},
+		{Offset: 1, Value: []byte(`{"type":"update","location":"foo"}`)},
+		{Offset: 2},
+		{Offset: 3, Value: []byte(`{"type":"update"`)},
+		{Offset: 4, Value: []byte("https://github.com/src-d/b")},
+	}}
+
+	queue := make(chan gitcollector.Job, 10)
+	provider := NewKafkaProvider(nil, "repos", queue, &KafkaProviderOpts{
+		SkipWrongMessages: true,
+		Reader:            reader,
+	})
+
+	done := make(chan error)
+	go func() { done <- provider.Start() }()
+
+	job := (<-queue).(*library.Job)
+	req.True(job.Type == library.JobDownload)
+	req.Equal([]string{"https://github.com/src-d/a"}, job.Endpoints)
+
+	job = (<-queue).(*library.Job)
+	req.True(job.Type == library.JobUpdate)
+	req.EqualValues("foo", job.LocationID)
+
+	job = (<-queue).(*library.Job)
+	req.Equal([]string{"https://github.com/src-d/b"}, job.Endpoints)
+
+	req.NoError(provider.Stop())
+	req.True(gitcollector.ErrProviderStopped.Is(<-done))
+
+	req.Equal([]int64{0, 1, 2, 3, 4}, reader.committed)
+	req.True(reader.closed)
+
+	status := provider.Status()
+	req.Equal("kafka repos", status.Name)
+	req.Equal("5 messages read, 1 wrong", status.Cursor)
+	req.Equal(3, status.Discovered)
+	req.True(status.Done)
+
+	// wrong messages stop the provider unless they're skipped
+	reader = &testKafkaReader{messages: []kafka.Message{
+		{Partition: 1, Offset: 7, Value: []byte("{")},
+	}}
+
+	provider = NewKafkaProvider(nil, "repos", queue, &KafkaProviderOpts{
+		Reader: reader,
+	})
+
+	err := provider.Start()
+	req.True(ErrWrongKafkaMessage.Is(err))
+	req.Empty(reader.committed)
+	req.True(reader.closed)
+}
@@ -0,0 +1,207 @@
+package discovery
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+)
+
+// StdinList is the path of a ListProvider reading the list from the standard
+// input.
+const StdinList = "-"
+
+// ListProviderOpts represents configuration options for a ListProvider.
+type ListProviderOpts struct {
+	// Follow keeps the provider running once the list is read, reading it
+	// again on every Reload call and Interval, so the lines added to it
+	// become new Jobs.
+	Follow bool
+	// Interval is the time between reads of the list while following, 0
+	// only reads it again on Reload.
+	Interval time.Duration
+	// Stdin is read when the path is StdinList, default to os.Stdin. It's
+	// read until its end, it can't be read again.
+	Stdin io.Reader
+}
+
+// ListProvider is a gitcollector.Provider implementation. It reads a
+// newline-delimited list of repository URLs producing a download Job for every
+// one of them. Empty lines and lines starting with # are skipped, as well as
+// the URLs already produced, so the list can be read again or rewritten
+// without duplicating the Jobs.
+type ListProvider struct {
+	path   string
+	queue  chan<- gitcollector.Job
+	cancel chan struct{}
+	reload chan struct{}
+	opts   *ListProviderOpts
+	status providerStatus
+	seen   map[string]bool
+
+	mu      sync.Mutex
+	stopped bool
+	reads   int
+}
+
+var (
+	_ gitcollector.Provider       = (*ListProvider)(nil)
+	_ gitcollector.ProviderStatus = (*ListProvider)(nil)
+)
+
+// NewListProvider builds a new ListProvider reading the list in the given
+// path, StdinList for the standard input.
+func NewListProvider(
+	path string,
+	queue chan<- gitcollector.Job,
+	opts *ListProviderOpts,
+) *ListProvider {
+	if opts == nil {
+		opts = &ListProviderOpts{}
+	}
+
+	if opts.Stdin == nil {
+		opts.Stdin = os.Stdin
+	}
+
+	return &ListProvider{
+		path:   path,
+		queue:  queue,
+		cancel: make(chan struct{}),
+		reload: make(chan struct{}, 1),
+		opts:   opts,
+		seen:   map[string]bool{},
+	}
+}
+
+// Start implements the gitcollector.Provider interface.
+func (p *ListProvider) Start() error {
+	err := p.start()
+	p.status.done(err)
+	return err
+}
+
+func (p *ListProvider) start() error {
+	var tick <-chan time.Time
+	if p.opts.Follow && p.opts.Interval > 0 {
+		ticker := time.NewTicker(p.opts.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		if err := p.read(); err != nil {
+			return err
+		}
+
+		if !p.opts.Follow || p.path == StdinList {
+			return gitcollector.ErrProviderStopped.New()
+		}
+
+		select {
+		case <-p.cancel:
+			return gitcollector.ErrProviderStopped.New()
+		case <-p.reload:
+		case <-tick:
+		}
+	}
+}
+
+func (p *ListProvider) read() error {
+	r := p.opts.Stdin
+	if p.path != StdinList {
+		f, err := os.Open(p.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		// a trailing line without a newline may still be being written
+		// while following, it's read complete the next time.
+		if err == io.EOF && p.opts.Follow && p.path != StdinList {
+			break
+		}
+
+		if err := p.enqueue(strings.TrimSpace(line)); err != nil {
+			return err
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	p.mu.Lock()
+	p.reads++
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *ListProvider) enqueue(line string) error {
+	if line == "" || strings.HasPrefix(line, "#") || p.seen[line] {
+		return nil
+	}
+
+	job := &library.Job{
+		Type:      library.JobDownload,
+		Endpoints: []string{line},
+	}
+
+	select {
+	case p.queue <- job:
+	case <-p.cancel:
+		return gitcollector.ErrProviderStopped.New()
+	}
+
+	p.seen[line] = true
+	p.status.produced()
+	return nil
+}
+
+// Reload makes a following provider read the list again right away.
+func (p *ListProvider) Reload() {
+	select {
+	case p.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Status implements the gitcollector.ProviderStatus interface.
+func (p *ListProvider) Status() gitcollector.ProviderState {
+	state := p.status.state(nil)
+	state.Name = "list " + p.path
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state.Cursor = fmt.Sprintf("read %d times", p.reads)
+	return state
+}
+
+// Stop implements the gitcollector.Provider interface. A read of the standard
+// input in progress isn't interrupted until its next line.
+func (p *ListProvider) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.cancel)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package discovery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListProvider(t *testing.T) {
+	var req = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector-list")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	list := filepath.Join(dir, "repos.txt")
+	req.NoError(ioutil.WriteFile(list, []byte(
+		`https://github.com/src-d/a
+# comment
+
+https://github.com/src-d/b
+https://github.com/src-d/a
+https://github.com/src-d/c`), 0644))
+
+	next := func(queue chan gitcollector.Job) string {
+		select {
+		case j := <-queue:
+			job := j.(*library.Job)
+			req.True(job.Type == library.JobDownload)
+			return job.Endpoints[0]
+		case <-time.After(5 * time.Second):
+			req.FailNow("job not enqueued")
+			return ""
+		}
+	}
+
+	// the trailing line isn't complete while following
+	queue := make(chan gitcollector.Job, 10)
+	provider := NewListProvider(list, queue, &ListProviderOpts{Follow: true})
+	done := make(chan error)
+	go func() { done <- provider.Start() }()
+
+	req.Equal("https://github.com/src-d/a", next(queue))
+	req.Equal("https://github.com/src-d/b", next(queue))
+
+	f, err := os.OpenFile(list, os.O_APPEND|os.O_WRONLY, 0644)
+	req.NoError(err)
+	_, err = f.WriteString("\nhttps://github.com/src-d/b\nhttps://github.com/src-d/d\n")
+	req.NoError(err)
+	req.NoError(f.Close())
+
+	provider.Reload()
+	req.Equal("https://github.com/src-d/c", next(queue))
+	req.Equal("https://github.com/src-d/d", next(queue))
+
+	req.NoError(provider.Stop())
+	err = <-done
+	req.True(gitcollector.ErrProviderStopped.Is(err))
+	req.Len(queue, 0)
+
+	status := provider.Status()
+	req.Equal("list "+list, status.Name)
+	req.Equal(4, status.Discovered)
+	req.True(status.Done)
+
+	// the standard input is read until its end
+	queue = make(chan gitcollector.Job, 10)
+	provider = NewListProvider(StdinList, queue, &ListProviderOpts{
+		Follow: true,
+		Stdin:  strings.NewReader("https://github.com/src-d/a\nhttps://github.com/src-d/b"),
+	})
+
+	err = provider.Start()
+	req.True(gitcollector.ErrProviderStopped.Is(err))
+	req.Equal("https://github.com/src-d/a", next(queue))
+	req.Equal("https://github.com/src-d/b", next(queue))
+
+	provider = NewListProvider(filepath.Join(dir, "missing"), queue, nil)
+	req.True(os.IsNotExist(provider.Start()))
+}
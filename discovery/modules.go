@@ -0,0 +1,416 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+var (
+	// ErrModuleNotResolved is returned when the repository of a Go module
+	// can't be found.
+	ErrModuleNotResolved = errors.NewKind("module %s not resolved: %s")
+
+	// ErrModuleNotGit is returned when a Go module is hosted in a version
+	// control system other than git.
+	ErrModuleNotGit = errors.NewKind("module %s is hosted in %s, not git")
+)
+
+// ModuleProviderOpts represents configuration options for a ModuleProvider.
+type ModuleProviderOpts struct {
+	// Client resolves the vanity import paths, default to an http.Client
+	// with a 30 seconds timeout.
+	Client *http.Client
+	// Stdin is read when the path is StdinList, default to os.Stdin.
+	Stdin io.Reader
+}
+
+const moduleTimeout = 30 * time.Second
+
+// ModuleProvider is a gitcollector.Provider implementation. It reads a
+// newline-delimited list of Go module paths, or a go.sum file, resolving every
+// module to the repository hosting it and producing a download Job for each
+// repository. The modules of the well known hosts like github are resolved
+// from their path, the vanity import paths are resolved with the go-import
+// meta tag served on ?go-get=1 like the go command does. A module that can't
+// be resolved is skipped.
+type ModuleProvider struct {
+	path     string
+	queue    chan<- gitcollector.Job
+	cancel   chan struct{}
+	opts     *ModuleProviderOpts
+	status   providerStatus
+	resolver *moduleResolver
+
+	mu       sync.Mutex
+	stopped  bool
+	modules  int
+	failures int
+}
+
+var (
+	_ gitcollector.Provider       = (*ModuleProvider)(nil)
+	_ gitcollector.ProviderStatus = (*ModuleProvider)(nil)
+)
+
+// NewModuleProvider builds a new ModuleProvider reading the modules in the
+// given path, StdinList for the standard input.
+func NewModuleProvider(
+	path string,
+	queue chan<- gitcollector.Job,
+	opts *ModuleProviderOpts,
+) *ModuleProvider {
+	if opts == nil {
+		opts = &ModuleProviderOpts{}
+	}
+
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: moduleTimeout}
+	}
+
+	if opts.Stdin == nil {
+		opts.Stdin = os.Stdin
+	}
+
+	return &ModuleProvider{
+		path:     path,
+		queue:    queue,
+		cancel:   make(chan struct{}),
+		opts:     opts,
+		resolver: newModuleResolver(opts.Client),
+	}
+}
+
+// Start implements the gitcollector.Provider interface.
+func (p *ModuleProvider) Start() error {
+	err := p.start()
+	p.status.done(err)
+	return err
+}
+
+func (p *ModuleProvider) start() error {
+	r := p.opts.Stdin
+	if p.path != StdinList {
+		f, err := os.Open(p.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-p.cancel:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		module := modulePath(scanner.Text())
+		if module == "" || seen[module] {
+			continue
+		}
+
+		seen[module] = true
+		if err := p.enqueue(ctx, module); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return gitcollector.ErrProviderStopped.New()
+}
+
+// modulePath returns the module of a line of a list or a go.sum file, the
+// ones in go.sum are followed by their version and checksum.
+func modulePath(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ""
+	}
+
+	module := strings.Fields(line)[0]
+	if i := strings.Index(module, "@"); i >= 0 {
+		module = module[:i]
+	}
+
+	return module
+}
+
+func (p *ModuleProvider) enqueue(ctx context.Context, module string) error {
+	p.mu.Lock()
+	p.modules++
+	p.mu.Unlock()
+
+	endpoint, fresh, err := p.resolver.resolve(ctx, module)
+	if err != nil {
+		select {
+		case <-p.cancel:
+			return gitcollector.ErrProviderStopped.New()
+		default:
+		}
+
+		p.mu.Lock()
+		p.failures++
+		p.mu.Unlock()
+
+		p.status.fail(err)
+		log.With(log.Fields{"module": module}).Warningf(
+			"module skipped: %s", err,
+		)
+
+		return nil
+	}
+
+	// the modules in the same repository produce a single Job.
+	if !fresh {
+		return nil
+	}
+
+	job := &library.Job{
+		Type:      library.JobDownload,
+		Endpoints: []string{endpoint},
+	}
+
+	select {
+	case p.queue <- job:
+	case <-p.cancel:
+		return gitcollector.ErrProviderStopped.New()
+	}
+
+	p.status.produced()
+	return nil
+}
+
+// Status implements the gitcollector.ProviderStatus interface.
+func (p *ModuleProvider) Status() gitcollector.ProviderState {
+	state := p.status.state(nil)
+	state.Name = "modules " + p.path
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state.Cursor = fmt.Sprintf(
+		"%d modules read, %d not resolved", p.modules, p.failures,
+	)
+
+	return state
+}
+
+// Stop implements the gitcollector.Provider interface.
+func (p *ModuleProvider) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.cancel)
+	}
+
+	return nil
+}
+
+// moduleHosts are the hosts whose repositories are the first two elements of
+// the module path after the host.
+var moduleHosts = map[string]bool{
+	"github.com":    true,
+	"gitlab.com":    true,
+	"bitbucket.org": true,
+}
+
+// moduleResolver finds the repositories of the modules, remembering the
+// import prefixes already resolved and the repositories already found.
+type moduleResolver struct {
+	client   *http.Client
+	prefixes map[string]string
+	repos    map[string]bool
+}
+
+func newModuleResolver(client *http.Client) *moduleResolver {
+	return &moduleResolver{
+		client:   client,
+		prefixes: map[string]string{},
+		repos:    map[string]bool{},
+	}
+}
+
+// resolve returns the URL of the repository of the module and whether it
+// wasn't returned before.
+func (r *moduleResolver) resolve(
+	ctx context.Context,
+	module string,
+) (string, bool, error) {
+	repo, err := r.repository(ctx, module)
+	if err != nil {
+		return "", false, err
+	}
+
+	if r.repos[repo] {
+		return repo, false, nil
+	}
+
+	r.repos[repo] = true
+	return repo, true, nil
+}
+
+func (r *moduleResolver) repository(
+	ctx context.Context,
+	module string,
+) (string, error) {
+	elems := strings.Split(module, "/")
+	if moduleHosts[elems[0]] {
+		if len(elems) < 3 {
+			return "", ErrModuleNotResolved.New(
+				module, "missing repository name",
+			)
+		}
+
+		return "https://" + strings.Join(elems[:3], "/"), nil
+	}
+
+	// the paths naming the repository with a .git element, like
+	// example.com/repo.git/pkg, don't need a lookup.
+	for i, elem := range elems {
+		if i > 0 && strings.HasSuffix(elem, ".git") {
+			return "https://" + strings.Join(elems[:i+1], "/"), nil
+		}
+	}
+
+	for prefix, repo := range r.prefixes {
+		if module == prefix || strings.HasPrefix(module, prefix+"/") {
+			return repo, nil
+		}
+	}
+
+	imports, err := r.goImports(ctx, module)
+	if err != nil {
+		return "", ErrModuleNotResolved.New(module, err)
+	}
+
+	for _, imp := range imports {
+		if imp.prefix != module && !strings.HasPrefix(module, imp.prefix+"/") {
+			continue
+		}
+
+		// the module proxies are listed along with the repository.
+		if imp.vcs == "mod" {
+			continue
+		}
+
+		if imp.vcs != "git" {
+			return "", ErrModuleNotGit.New(module, imp.vcs)
+		}
+
+		r.prefixes[imp.prefix] = imp.repo
+		return imp.repo, nil
+	}
+
+	return "", ErrModuleNotResolved.New(module, "go-import meta tag not found")
+}
+
+func (r *moduleResolver) goImports(
+	ctx context.Context,
+	module string,
+) ([]goImport, error) {
+	req, err := http.NewRequest(
+		http.MethodGet, "https://"+module+"?go-get=1", nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	// the meta tags can be served along with an error status, the go
+	// command reads them anyway.
+	imports, err := parseGoImports(res.Body)
+	if err != nil && res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return imports, err
+}
+
+type goImport struct {
+	prefix, vcs, repo string
+}
+
+// parseGoImports reads the go-import meta tags of an HTML document, stopping
+// at the end of its head like the go command does.
+func parseGoImports(r io.Reader) ([]goImport, error) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	var imports []goImport
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			if err == io.EOF || len(imports) > 0 {
+				return imports, nil
+			}
+
+			return nil, err
+		}
+
+		if e, ok := t.(xml.StartElement); ok &&
+			strings.EqualFold(e.Name.Local, "body") {
+			return imports, nil
+		}
+
+		if e, ok := t.(xml.EndElement); ok &&
+			strings.EqualFold(e.Name.Local, "head") {
+			return imports, nil
+		}
+
+		e, ok := t.(xml.StartElement)
+		if !ok || !strings.EqualFold(e.Name.Local, "meta") ||
+			attrValue(e.Attr, "name") != "go-import" {
+			continue
+		}
+
+		f := strings.Fields(attrValue(e.Attr, "content"))
+		if len(f) == 3 {
+			imports = append(imports, goImport{
+				prefix: f[0],
+				vcs:    f[1],
+				repo:   f[2],
+			})
+		}
+	}
+}
+
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,140 @@
+package discovery
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestModuleProvider(t *testing.T) {
+	var req = require.New(t)
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			req.Equal("1", r.URL.Query().Get("go-get"))
+
+			var meta string
+			switch {
+			case strings.HasPrefix(r.URL.Path, "/x/"):
+				name := strings.Split(r.URL.Path, "/")[2]
+				meta = fmt.Sprintf(
+					`<meta name="go-import" content="golang.org/x/%s mod https://proxy.golang.org">
+<meta name="go-import" content="golang.org/x/%s git https://go.googlesource.com/%s">`,
+					name, name, name,
+				)
+			case r.URL.Path == "/hg":
+				meta = `<meta name="go-import" content="example.com/hg hg https://example.com/hg">`
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+
+			fmt.Fprintf(w, "<html><head>%s</head><body></body></html>", meta)
+		},
+	))
+	defer server.Close()
+
+	target, err := url.Parse(server.URL)
+	req.NoError(err)
+
+	client := &http.Client{Transport: roundTripFn(
+		func(r *http.Request) (*http.Response, error) {
+			r.URL.Scheme = target.Scheme
+			r.URL.Host = target.Host
+			return http.DefaultTransport.RoundTrip(r)
+		},
+	)}
+
+	stdin := strings.NewReader(`# dependencies
+github.com/src-d/go-git v4.7.0+incompatible h1:IYDSsjJ2Zpn3wQoFb3ya7qwD7YavPyx4E8Zp7xgj+PI=
+github.com/src-d/go-git v4.7.0+incompatible/go.mod h1:1bQciz+hn0jzPQNsYj0hDFZHLJBdV7gXE2mWhC8EkMI=
+github.com/src-d/go-git/plumbing v0.0.1 h1:aaa=
+golang.org/x/net v0.0.0-20190619014844-b5b0513f8c1b h1:bbb=
+golang.org/x/net/html v0.0.1 h1:ccc=
+golang.org/x/text@v0.3.2
+example.com/repo.git/pkg
+example.com/hg
+example.com/missing
+gitlab.com/foo
+bitbucket.org/foo/bar
+`)
+
+	queue := make(chan gitcollector.Job, 10)
+	provider := NewModuleProvider(StdinList, queue, &ModuleProviderOpts{
+		Client: client,
+		Stdin:  stdin,
+	})
+
+	done := make(chan error)
+	go func() { done <- provider.Start() }()
+
+	select {
+	case err := <-done:
+		req.True(gitcollector.ErrProviderStopped.Is(err))
+	case <-time.After(5 * time.Second):
+		req.FailNow("provider didn't finish")
+	}
+
+	close(queue)
+	var endpoints []string
+	for j := range queue {
+		job := j.(*library.Job)
+		req.True(job.Type == library.JobDownload)
+		endpoints = append(endpoints, job.Endpoints[0])
+	}
+
+	req.Equal([]string{
+		"https://github.com/src-d/go-git",
+		"https://go.googlesource.com/net",
+		"https://go.googlesource.com/text",
+		"https://example.com/repo.git",
+		"https://bitbucket.org/foo/bar",
+	}, endpoints)
+
+	// golang.org/x/net/html reuses the resolved prefix
+	req.Equal(4, requests)
+
+	state := provider.Status()
+	req.Equal(5, state.Discovered)
+	req.Equal("10 modules read, 3 not resolved", state.Cursor)
+	req.True(ErrModuleNotResolved.Is(state.LastError))
+	req.True(state.Done)
+}
+
+type roundTripFn func(*http.Request) (*http.Response, error)
+
+func (fn roundTripFn) RoundTrip(r *http.Request) (*http.Response, error) {
+	return fn(r)
+}
+
+func TestParseGoImports(t *testing.T) {
+	var req = require.New(t)
+
+	imports, err := parseGoImports(strings.NewReader(`<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>
+<meta content="gopkg.in/yaml.v2 git https://gopkg.in/yaml.v2" name="go-import">
+<meta name="go-source" content="gopkg.in/yaml.v2 _ _ _">
+</head>
+<body>
+<meta name="go-import" content="gopkg.in/other git https://gopkg.in/other">
+</body>
+</html>`))
+	req.NoError(err)
+	req.Equal([]goImport{{
+		prefix: "gopkg.in/yaml.v2",
+		vcs:    "git",
+		repo:   "https://gopkg.in/yaml.v2",
+	}}, imports)
+}
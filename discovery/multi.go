@@ -0,0 +1,244 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrOrgsFailed is returned by a MultiOrgProvider when the discovery of some
+// of its organizations failed.
+var ErrOrgsFailed = errors.NewKind(
+	"discovery of %d of %d organizations failed")
+
+// MultiOrgProviderOpts represents configuration options for a
+// MultiOrgProvider.
+type MultiOrgProviderOpts struct {
+	// Concurrency is the maximum number of organizations discovered at the
+	// same time, all of them by default.
+	Concurrency int
+	// Provider are the options of the GHProvider of every organization.
+	Provider GHProviderOpts
+	// Progress tracks the repositories discovered by organization, if set.
+	Progress *DiscoveryProgress
+	// OnDone is called once the discovery of an organization finishes,
+	// with its error if it failed, if set.
+	OnDone func(org string, err error)
+}
+
+// MultiOrgProvider is a gitcollector.Provider implementation discovering the
+// repositories of several github organizations with a GHProvider each, all of
+// them enqueueing to the same queue. At most Concurrency organizations are
+// discovered at the same time, the rest wait for a free slot in order.
+type MultiOrgProvider struct {
+	orgs    []string
+	queue   chan<- gitcollector.Job
+	newIter func(org string) GHRepositoriesIter
+	opts    *MultiOrgProviderOpts
+
+	mu        sync.Mutex
+	providers []*GHProvider
+	finished  int
+	failed    int
+	stopped   bool
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+var (
+	_ gitcollector.Provider        = (*MultiOrgProvider)(nil)
+	_ gitcollector.ContextProvider = (*MultiOrgProvider)(nil)
+	_ gitcollector.ProviderStatus  = (*MultiOrgProvider)(nil)
+)
+
+// NewMultiOrgProvider builds a new MultiOrgProvider discovering the given
+// organizations with the iterators built by newIter.
+func NewMultiOrgProvider(
+	queue chan<- gitcollector.Job,
+	orgs []string,
+	newIter func(org string) GHRepositoriesIter,
+	opts *MultiOrgProviderOpts,
+) *MultiOrgProvider {
+	if opts == nil {
+		opts = &MultiOrgProviderOpts{}
+	}
+
+	if opts.Concurrency <= 0 || opts.Concurrency > len(orgs) {
+		opts.Concurrency = len(orgs)
+	}
+
+	if opts.Provider.StopTimeout <= 0 {
+		opts.Provider.StopTimeout = stopTimeout
+	}
+
+	return &MultiOrgProvider{
+		orgs:    orgs,
+		queue:   queue,
+		newIter: newIter,
+		opts:    opts,
+	}
+}
+
+// Start implements the gitcollector.Provider interface.
+func (p *MultiOrgProvider) Start() error {
+	return p.StartContext(context.Background())
+}
+
+// StartContext implements the gitcollector.ContextProvider interface. It
+// returns once every organization is discovered, ErrOrgsFailed if the
+// discovery of any of them failed.
+func (p *MultiOrgProvider) StartContext(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return gitcollector.ErrProviderStopped.New()
+	}
+
+	p.cancel, p.done = cancel, done
+	p.mu.Unlock()
+
+	var (
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, p.opts.Concurrency)
+	)
+
+	for _, org := range p.orgs {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		provider := p.provider(org)
+		wg.Add(1)
+		go func(org string) {
+			defer wg.Done()
+			err := provider.StartContext(ctx)
+			p.finish(ctx, org, err)
+			<-slots
+		}(org)
+	}
+
+	wg.Wait()
+
+	p.mu.Lock()
+	failed := p.failed
+	p.mu.Unlock()
+
+	if ctx.Err() == nil && failed > 0 {
+		return ErrOrgsFailed.New(failed, len(p.orgs))
+	}
+
+	return gitcollector.ErrProviderStopped.New()
+}
+
+func (p *MultiOrgProvider) provider(org string) *GHProvider {
+	iter := p.newIter(org)
+	if p.opts.Progress != nil {
+		iter = p.opts.Progress.Iter(org, iter)
+	}
+
+	// every provider sets its own defaults on the options.
+	opts := p.opts.Provider
+	provider := NewGHProvider(p.queue, iter, &opts)
+
+	p.mu.Lock()
+	p.providers = append(p.providers, provider)
+	p.mu.Unlock()
+
+	return provider
+}
+
+func (p *MultiOrgProvider) finish(ctx context.Context, org string, err error) {
+	// the organizations run out of repositories stop, which isn't a
+	// failure, and so do the ones stopped along with the provider.
+	if ctx.Err() != nil ||
+		ErrNewRepositoriesNotFound.Is(err) ||
+		gitcollector.ErrProviderStopped.Is(err) {
+		err = nil
+	}
+
+	p.mu.Lock()
+	p.finished++
+	if err != nil {
+		p.failed++
+	}
+	p.mu.Unlock()
+
+	if p.opts.Progress != nil {
+		p.opts.Progress.Done(org, err)
+	}
+
+	if p.opts.OnDone != nil {
+		p.opts.OnDone(org, err)
+	}
+}
+
+// Status implements the gitcollector.ProviderStatus interface. The state is
+// the sum of the organizations discovered until now, the rate limit reported
+// is the lowest one.
+func (p *MultiOrgProvider) Status() gitcollector.ProviderState {
+	p.mu.Lock()
+	providers := append([]*GHProvider{}, p.providers...)
+	finished := p.finished
+	p.mu.Unlock()
+
+	state := gitcollector.ProviderState{
+		Name: fmt.Sprintf("github:%d organizations", len(p.orgs)),
+		Cursor: fmt.Sprintf("%d finished, %d running",
+			finished, len(providers)-finished),
+		RateLimitRemaining: -1,
+		Done:               finished == len(p.orgs),
+	}
+
+	for _, provider := range providers {
+		s := provider.Status()
+		state.Discovered += s.Discovered
+		if s.LastError != nil && s.LastErrorTime.After(state.LastErrorTime) {
+			state.LastError = s.LastError
+			state.LastErrorTime = s.LastErrorTime
+		}
+
+		if s.RateLimitRemaining >= 0 && (state.RateLimitRemaining < 0 ||
+			s.RateLimitRemaining < state.RateLimitRemaining) {
+			state.RateLimitRemaining = s.RateLimitRemaining
+			state.RateLimitReset = s.RateLimitReset
+		}
+	}
+
+	return state
+}
+
+// Stop implements the gitcollector.Provider interface. It cancels the
+// discovery of every organization and waits for them to return.
+func (p *MultiOrgProvider) Stop() error {
+	p.mu.Lock()
+	p.stopped = true
+	cancel, done := p.cancel, p.done
+	p.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(p.opts.Provider.StopTimeout):
+		return gitcollector.ErrProviderStop.New()
+	}
+}
@@ -0,0 +1,113 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+type failingReposIter struct{}
+
+func (failingReposIter) Next(
+	context.Context,
+) (*github.Repository, time.Duration, error) {
+	return nil, 0, fmt.Errorf("server error")
+}
+
+func TestMultiOrgProvider(t *testing.T) {
+	var req = require.New(t)
+
+	newIter := func(org string) GHRepositoriesIter {
+		if org == "broken" {
+			return failingReposIter{}
+		}
+
+		var repos []*github.Repository
+		for i := 0; i < 2; i++ {
+			url := fmt.Sprintf("https://github.com/%s/%d", org, i)
+			repos = append(repos, &github.Repository{HTMLURL: &url})
+		}
+
+		return &sliceReposIter{repos: repos}
+	}
+
+	// a single organization is discovered at a time, in order
+	queue := make(chan gitcollector.Job, 10)
+	progress := NewDiscoveryProgress()
+	var done []string
+	provider := NewMultiOrgProvider(
+		queue, []string{"a", "b", "c"}, newIter,
+		&MultiOrgProviderOpts{
+			Concurrency: 1,
+			Progress:    progress,
+			OnDone: func(org string, err error) {
+				req.NoError(err)
+				done = append(done, org)
+			},
+		},
+	)
+
+	err := provider.Start()
+	req.True(gitcollector.ErrProviderStopped.Is(err))
+	req.Equal([]string{"a", "b", "c"}, done)
+
+	close(queue)
+	var endpoints []string
+	for j := range queue {
+		endpoints = append(endpoints, j.(*library.Job).Endpoints[0])
+	}
+
+	req.Equal([]string{
+		"https://github.com/a/0", "https://github.com/a/1",
+		"https://github.com/b/0", "https://github.com/b/1",
+		"https://github.com/c/0", "https://github.com/c/1",
+	}, endpoints)
+
+	status := provider.Status()
+	req.Equal(6, status.Discovered)
+	req.True(status.Done)
+	for _, op := range progress.Orgs() {
+		req.Equal(2, op.Discovered)
+		req.True(op.Done)
+	}
+
+	// the failures are reported once every organization finishes
+	queue = make(chan gitcollector.Job, 10)
+	provider = NewMultiOrgProvider(
+		queue, []string{"a", "broken"}, newIter, nil,
+	)
+
+	err = provider.Start()
+	req.True(ErrOrgsFailed.Is(err))
+	req.Len(queue, 2)
+
+	status = provider.Status()
+	req.Error(status.LastError)
+	req.True(status.Done)
+
+	// a stopped provider doesn't discover more organizations
+	provider = NewMultiOrgProvider(make(chan gitcollector.Job), []string{"a"},
+		func(string) GHRepositoriesIter {
+			return &blockingIter{
+				started:  make(chan struct{}),
+				canceled: make(chan error, 1),
+			}
+		}, nil,
+	)
+
+	stopped := make(chan error)
+	go func() { stopped <- provider.Start() }()
+	for provider.Status().Cursor != "0 finished, 1 running" {
+		time.Sleep(time.Millisecond)
+	}
+
+	req.NoError(provider.Stop())
+	req.True(gitcollector.ErrProviderStopped.Is(<-stopped))
+}
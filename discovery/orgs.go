@@ -0,0 +1,355 @@
+package discovery
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/src-d/gitcollector"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrOrgsNotListed is returned when the organizations couldn't be
+	// listed.
+	ErrOrgsNotListed = errors.NewKind("couldn't list organizations: %s")
+)
+
+// AllOrgs is the organization name matching every organization the token
+// can see.
+const AllOrgs = "*"
+
+// GHOrgsOpts represents configuration options to list github organizations.
+type GHOrgsOpts struct {
+	// Enterprise is the slug of the enterprise account whose organizations
+	// are listed. If empty, the organizations the token can see are
+	// listed.
+	Enterprise string
+	AuthToken  string
+	// TokenSource authenticates the API requests instead of AuthToken if
+	// set.
+	TokenSource    oauth2.TokenSource
+	HTTPTimeout    time.Duration
+	ResultsPerPage int
+	// BaseURL is the github API URL, default to the public github API.
+	BaseURL string
+	// RateLimiter limits the API requests.
+	RateLimiter *gitcollector.RateLimiter
+	// APIUsage counts the API requests as made by the github:orgs
+	// provider.
+	APIUsage *gitcollector.APIUsage
+}
+
+// OrgsProvider is the provider the API requests listing the organizations are
+// counted for.
+const OrgsProvider = "github:orgs"
+
+// ListGHOrgs returns the names of the organizations of an enterprise account
+// or, if no enterprise is given, the ones the token can see.
+func ListGHOrgs(ctx context.Context, opts *GHOrgsOpts) ([]string, error) {
+	if opts == nil {
+		opts = &GHOrgsOpts{}
+	}
+
+	to := opts.HTTPTimeout
+	if to <= 0 {
+		to = httpTimeout
+	}
+
+	rpp := opts.ResultsPerPage
+	if rpp <= 0 || rpp > 100 {
+		rpp = resultsPerPage
+	}
+
+	client := newGithubClient(
+		tokenSource(opts.AuthToken, opts.TokenSource),
+		to, opts.APIUsage, OrgsProvider,
+	)
+	if opts.BaseURL != "" {
+		u, err := url.Parse(strings.TrimSuffix(opts.BaseURL, "/") + "/")
+		if err != nil {
+			return nil, err
+		}
+
+		client.BaseURL = u
+	}
+
+	var (
+		orgs []string
+		err  error
+	)
+
+	if opts.Enterprise != "" {
+		orgs, err = listEnterpriseOrgs(
+			ctx, client, opts.RateLimiter, opts.Enterprise, rpp,
+		)
+	} else {
+		if opts.AuthToken == "" {
+			return nil, ErrOrgsNotListed.New("an auth token is needed")
+		}
+
+		orgs, err = listUserOrgs(ctx, client, opts.RateLimiter, rpp)
+	}
+
+	if err != nil {
+		if !ErrOrgsNotListed.Is(err) {
+			err = ErrOrgsNotListed.Wrap(err, err.Error())
+		}
+
+		return nil, err
+	}
+
+	sort.Strings(orgs)
+	return orgs, nil
+}
+
+func listUserOrgs(
+	ctx context.Context,
+	client *github.Client,
+	limiter *gitcollector.RateLimiter,
+	rpp int,
+) ([]string, error) {
+	var (
+		orgs []string
+		opts = &github.ListOptions{PerPage: rpp}
+	)
+
+	for {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		page, res, err := client.Organizations.List(ctx, "", opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, o := range page {
+			orgs = append(orgs, o.GetLogin())
+		}
+
+		if res.NextPage == 0 {
+			return orgs, nil
+		}
+
+		opts.Page = res.NextPage
+	}
+}
+
+const enterpriseOrgsQuery = `query($slug: String!, $first: Int!, $cursor: String) {
+  enterprise(slug: $slug) {
+    organizations(first: $first, after: $cursor) {
+      nodes { login }
+      pageInfo { hasNextPage endCursor }
+    }
+  }
+}`
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type enterpriseOrgsResponse struct {
+	Data struct {
+		Enterprise *struct {
+			Organizations struct {
+				Nodes []struct {
+					Login string `json:"login"`
+				} `json:"nodes"`
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+			} `json:"organizations"`
+		} `json:"enterprise"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// listEnterpriseOrgs uses the GraphQL API since the REST API doesn't expose
+// the organizations of an enterprise account.
+func listEnterpriseOrgs(
+	ctx context.Context,
+	client *github.Client,
+	limiter *gitcollector.RateLimiter,
+	enterprise string,
+	rpp int,
+) ([]string, error) {
+	var (
+		orgs   []string
+		cursor interface{}
+	)
+
+	for {
+		req, err := client.NewRequest("POST", "graphql", &graphQLRequest{
+			Query: enterpriseOrgsQuery,
+			Variables: map[string]interface{}{
+				"slug":   enterprise,
+				"first":  rpp,
+				"cursor": cursor,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		var res enterpriseOrgsResponse
+		if _, err := client.Do(ctx, req, &res); err != nil {
+			return nil, err
+		}
+
+		if len(res.Errors) > 0 {
+			return nil, ErrOrgsNotListed.New(res.Errors[0].Message)
+		}
+
+		if res.Data.Enterprise == nil {
+			return nil, ErrOrgsNotListed.New(
+				"enterprise " + enterprise + " not found")
+		}
+
+		page := res.Data.Enterprise.Organizations
+		for _, n := range page.Nodes {
+			orgs = append(orgs, n.Login)
+		}
+
+		if !page.PageInfo.HasNextPage {
+			return orgs, nil
+		}
+
+		cursor = page.PageInfo.EndCursor
+	}
+}
+
+// OrgProgress is the discovery progress of an organization.
+type OrgProgress struct {
+	Org        string
+	Discovered int
+	Done       bool
+	Err        error
+}
+
+// DiscoveryProgress tracks the repositories discovered by organization.
+type DiscoveryProgress struct {
+	mu   sync.Mutex
+	orgs map[string]*OrgProgress
+}
+
+// NewDiscoveryProgress builds a new DiscoveryProgress.
+func NewDiscoveryProgress() *DiscoveryProgress {
+	return &DiscoveryProgress{orgs: map[string]*OrgProgress{}}
+}
+
+// Iter wraps the given GHRepositoriesIter counting the repositories it
+// returns for the organization. The wrapper is a ResumableIter if the given
+// iterator is.
+func (p *DiscoveryProgress) Iter(
+	org string,
+	iter GHRepositoriesIter,
+) GHRepositoriesIter {
+	p.mu.Lock()
+	if _, ok := p.orgs[org]; !ok {
+		p.orgs[org] = &OrgProgress{Org: org}
+	}
+	p.mu.Unlock()
+
+	pi := &progressIter{org: org, iter: iter, progress: p}
+	if r, ok := iter.(ResumableIter); ok {
+		return &resumableProgressIter{progressIter: pi, resumable: r}
+	}
+
+	return pi
+}
+
+// Done marks the discovery of the organization as finished with the given
+// error, if any.
+func (p *DiscoveryProgress) Done(org string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	op, ok := p.orgs[org]
+	if !ok {
+		op = &OrgProgress{Org: org}
+		p.orgs[org] = op
+	}
+
+	op.Done = true
+	op.Err = err
+}
+
+// Orgs returns a snapshot of the progress of every organization sorted by
+// name.
+func (p *DiscoveryProgress) Orgs() []OrgProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	orgs := make([]OrgProgress, 0, len(p.orgs))
+	for _, op := range p.orgs {
+		orgs = append(orgs, *op)
+	}
+
+	sort.Slice(orgs, func(i, j int) bool {
+		return orgs[i].Org < orgs[j].Org
+	})
+
+	return orgs
+}
+
+type progressIter struct {
+	org      string
+	iter     GHRepositoriesIter
+	progress *DiscoveryProgress
+}
+
+// Status implements the gitcollector.ProviderStatus interface if the wrapped
+// iterator implements it.
+func (i *progressIter) Status() gitcollector.ProviderState {
+	if s, ok := i.iter.(gitcollector.ProviderStatus); ok {
+		return s.Status()
+	}
+
+	return gitcollector.ProviderState{
+		Name:               "github:" + i.org,
+		RateLimitRemaining: -1,
+	}
+}
+
+func (i *progressIter) Next(
+	ctx context.Context,
+) (*github.Repository, time.Duration, error) {
+	repo, retry, err := i.iter.Next(ctx)
+	if err == nil && repo != nil {
+		i.progress.mu.Lock()
+		i.progress.orgs[i.org].Discovered++
+		i.progress.mu.Unlock()
+	}
+
+	return repo, retry, err
+}
+
+type resumableProgressIter struct {
+	*progressIter
+	resumable ResumableIter
+}
+
+var _ ResumableIter = (*resumableProgressIter)(nil)
+
+func (i *resumableProgressIter) Cursor() Cursor {
+	return i.resumable.Cursor()
+}
+
+func (i *resumableProgressIter) Resume(c Cursor) {
+	i.resumable.Resume(c)
+}
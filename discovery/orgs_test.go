@@ -0,0 +1,139 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListGHOrgs(t *testing.T) {
+	var req = require.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user/orgs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "" {
+			w.Header().Set("Link", fmt.Sprintf(
+				`<%s/user/orgs?page=2>; rel="next"`,
+				"http://"+r.Host,
+			))
+			fmt.Fprint(w, `[{"login":"src-d"},{"login":"bblfsh"}]`)
+			return
+		}
+
+		fmt.Fprint(w, `[{"login":"git"}]`)
+	})
+
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var body graphQLRequest
+		req.NoError(json.NewDecoder(r.Body).Decode(&body))
+
+		if body.Variables["slug"] != "acme" {
+			fmt.Fprint(w, `{"data":{"enterprise":null}}`)
+			return
+		}
+
+		if body.Variables["cursor"] == nil {
+			fmt.Fprint(w, `{"data":{"enterprise":{"organizations":{
+				"nodes":[{"login":"foo"}],
+				"pageInfo":{"hasNextPage":true,"endCursor":"c1"}}}}}`)
+			return
+		}
+
+		fmt.Fprint(w, `{"data":{"enterprise":{"organizations":{
+			"nodes":[{"login":"bar"}],
+			"pageInfo":{"hasNextPage":false,"endCursor":"c2"}}}}}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx := context.Background()
+
+	_, err := ListGHOrgs(ctx, &GHOrgsOpts{BaseURL: server.URL})
+	req.True(ErrOrgsNotListed.Is(err))
+
+	orgs, err := ListGHOrgs(ctx, &GHOrgsOpts{
+		BaseURL:   server.URL,
+		AuthToken: "token",
+	})
+	req.NoError(err)
+	req.Equal([]string{"bblfsh", "git", "src-d"}, orgs)
+
+	orgs, err = ListGHOrgs(ctx, &GHOrgsOpts{
+		BaseURL:    server.URL,
+		AuthToken:  "token",
+		Enterprise: "acme",
+	})
+	req.NoError(err)
+	req.Equal([]string{"bar", "foo"}, orgs)
+
+	_, err = ListGHOrgs(ctx, &GHOrgsOpts{
+		BaseURL:    server.URL,
+		Enterprise: "unknown",
+	})
+	req.True(ErrOrgsNotListed.Is(err))
+}
+
+type sliceReposIter struct {
+	repos []*github.Repository
+}
+
+func (i *sliceReposIter) Next(
+	context.Context,
+) (*github.Repository, time.Duration, error) {
+	if len(i.repos) == 0 {
+		return nil, 0, ErrNewRepositoriesNotFound.New()
+	}
+
+	var next *github.Repository
+	next, i.repos = i.repos[0], i.repos[1:]
+	return next, 0, nil
+}
+
+func TestDiscoveryProgress(t *testing.T) {
+	var req = require.New(t)
+
+	progress := NewDiscoveryProgress()
+	iter := progress.Iter("src-d", &sliceReposIter{
+		repos: []*github.Repository{{}, {}},
+	})
+
+	progress.Iter("bblfsh", &sliceReposIter{})
+
+	ctx := context.Background()
+	for {
+		_, _, err := iter.Next(ctx)
+		if err != nil {
+			progress.Done("src-d", nil)
+			break
+		}
+	}
+
+	req.Equal([]OrgProgress{
+		{Org: "bblfsh"},
+		{Org: "src-d", Discovered: 2, Done: true},
+	}, progress.Orgs())
+}
+
+func TestDiscoveryProgressResumable(t *testing.T) {
+	var req = require.New(t)
+
+	progress := NewDiscoveryProgress()
+	_, ok := progress.Iter("bblfsh", &sliceReposIter{}).(ResumableIter)
+	req.False(ok)
+
+	pager := newGHReposPager("github:src-d", &GHReposIterOpts{})
+	iter, ok := progress.Iter("src-d", pager).(ResumableIter)
+	req.True(ok)
+
+	iter.Resume(Cursor{Page: 3, Offset: 2})
+	req.Equal(Cursor{Page: 3, Offset: 2}, iter.Cursor())
+	req.Equal(Cursor{Page: 3, Offset: 2}, pager.Cursor())
+}
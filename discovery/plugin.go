@@ -0,0 +1,436 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// Custom providers can be written out of tree, in any language, as plugins
+// run by a PluginProvider. The plugin is an executable speaking a line based
+// protocol of JSON messages over its standard input and output:
+//
+//  1. The plugin is started with the PluginCookieKey environment variable set
+//     to PluginCookieValue, so it can refuse to run when it's not started by
+//     gitcollector, and PluginProtocolKey set to the protocol version.
+//  2. The plugin writes the handshake line, PluginHandshake followed by the
+//     protocol version it speaks, like "gitcollector-plugin|1".
+//  3. For every Job needed, gitcollector writes a {"method": "next"} request
+//     and the plugin answers with one PluginResponse line: a FeedRecord in
+//     "record", a number of seconds to ask again in "wait" when there isn't
+//     any repository available yet, "done" once there won't be more
+//     repositories or "error" if it failed.
+//  4. A {"method": "stop"} request is written and its standard input closed
+//     when the provider is stopped, it must exit then.
+//
+// The standard error of the plugin is left for its logs.
+const (
+	// PluginProtocolVersion is the version of the plugin protocol.
+	PluginProtocolVersion = 1
+	// PluginHandshake is the prefix of the handshake line.
+	PluginHandshake = "gitcollector-plugin"
+	// PluginCookieKey is the environment variable holding the cookie.
+	PluginCookieKey = "GITCOLLECTOR_PLUGIN_COOKIE"
+	// PluginCookieValue is the value of the cookie.
+	PluginCookieValue = "6b1f8d2a4c0e4f7a9d3b5e8c1a2f4d6e"
+	// PluginProtocolKey is the environment variable holding the protocol
+	// version.
+	PluginProtocolKey = "GITCOLLECTOR_PLUGIN_PROTOCOL"
+)
+
+var (
+	// ErrPluginHandshake is returned when a plugin doesn't write a valid
+	// handshake line in time.
+	ErrPluginHandshake = errors.NewKind("plugin %s handshake failed")
+
+	// ErrPluginFailed is returned when a plugin answers with an error.
+	ErrPluginFailed = errors.NewKind("plugin %s failed: %s")
+
+	// ErrPluginExited is returned when a plugin exits before it's
+	// stopped.
+	ErrPluginExited = errors.NewKind("plugin %s exited")
+)
+
+// PluginRequest is a request written to a plugin.
+type PluginRequest struct {
+	Method string `json:"method"`
+}
+
+// PluginResponse is the answer of a plugin to a next request.
+type PluginResponse struct {
+	Record *FeedRecord `json:"record,omitempty"`
+	// Wait is the number of seconds to wait to request a Job again.
+	Wait  float64 `json:"wait,omitempty"`
+	Done  bool    `json:"done,omitempty"`
+	Error string  `json:"error,omitempty"`
+}
+
+// PluginProviderOpts represents configuration options for a PluginProvider.
+type PluginProviderOpts struct {
+	// Args are the arguments the plugin is run with.
+	Args []string
+	// Env are the environment variables added to the ones of the current
+	// process, in key=value format.
+	Env []string
+	// Stderr receives the standard error of the plugin, it's discarded
+	// if nil.
+	Stderr io.Writer
+	// HandshakeTimeout is the time the plugin has to write its handshake,
+	// default to 10 seconds.
+	HandshakeTimeout time.Duration
+	// StopTimeout is the time the plugin has to exit once stopped before
+	// being killed, default to 10 seconds.
+	StopTimeout time.Duration
+}
+
+const handshakeTimeout = 10 * time.Second
+
+// PluginProvider is a gitcollector.Provider and gitcollector.PullProvider
+// implementation requesting the Jobs to a plugin process.
+type PluginProvider struct {
+	path   string
+	queue  chan<- gitcollector.Job
+	cancel chan struct{}
+	opts   *PluginProviderOpts
+	status providerStatus
+
+	mu          sync.Mutex
+	cmd         *exec.Cmd
+	stdin       io.WriteCloser
+	responses   chan *PluginResponse
+	exited      chan struct{}
+	exitErr     error
+	outstanding bool
+	stopped     bool
+}
+
+var (
+	_ gitcollector.Provider       = (*PluginProvider)(nil)
+	_ gitcollector.PullProvider   = (*PluginProvider)(nil)
+	_ gitcollector.ProviderStatus = (*PluginProvider)(nil)
+)
+
+// NewPluginProvider builds a new PluginProvider running the plugin in the
+// given path. The queue is only used by Start, it can be nil if the provider
+// is only used as a gitcollector.PullProvider.
+func NewPluginProvider(
+	path string,
+	queue chan<- gitcollector.Job,
+	opts *PluginProviderOpts,
+) *PluginProvider {
+	if opts == nil {
+		opts = &PluginProviderOpts{}
+	}
+
+	if opts.HandshakeTimeout <= 0 {
+		opts.HandshakeTimeout = handshakeTimeout
+	}
+
+	if opts.StopTimeout <= 0 {
+		opts.StopTimeout = stopTimeout
+	}
+
+	if opts.Stderr == nil {
+		opts.Stderr = ioutil.Discard
+	}
+
+	return &PluginProvider{
+		path:   path,
+		queue:  queue,
+		cancel: make(chan struct{}),
+		opts:   opts,
+	}
+}
+
+// Start implements the gitcollector.Provider interface. It enqueues the Jobs
+// of the plugin until it's done or the provider is stopped, the plugin is
+// stopped when it returns.
+func (p *PluginProvider) Start() error {
+	err := p.start()
+	p.status.done(err)
+	return err
+}
+
+func (p *PluginProvider) start() error {
+	defer p.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-p.cancel:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		job, err := p.Next(ctx)
+		if err != nil {
+			if gitcollector.ErrNewJobsNotFound.Is(err) && ctx.Err() == nil {
+				continue
+			}
+
+			if ctx.Err() != nil {
+				return gitcollector.ErrProviderStopped.New()
+			}
+
+			return err
+		}
+
+		select {
+		case p.queue <- job:
+		case <-ctx.Done():
+			return gitcollector.ErrProviderStopped.New()
+		}
+	}
+}
+
+// Status implements the gitcollector.ProviderStatus interface.
+func (p *PluginProvider) Status() gitcollector.ProviderState {
+	state := p.status.state(nil)
+	state.Name = "plugin " + p.path
+	return state
+}
+
+// Next implements the gitcollector.PullProvider interface.
+func (p *PluginProvider) Next(ctx context.Context) (gitcollector.Job, error) {
+	for {
+		resp, err := p.request(ctx)
+		if err != nil {
+			if !gitcollector.ErrNewJobsNotFound.Is(err) {
+				p.status.fail(err)
+			}
+
+			return nil, err
+		}
+
+		switch {
+		case resp.Error != "":
+			err := ErrPluginFailed.New(p.path, resp.Error)
+			p.status.fail(err)
+			return nil, err
+		case resp.Done:
+			err := gitcollector.ErrProviderStopped.New()
+			p.status.done(err)
+			return nil, err
+		case resp.Record != nil:
+			job, err := resp.Record.Job()
+			if err != nil {
+				// a wrong record doesn't stop the plugin
+				p.status.fail(ErrPluginFailed.New(p.path, err))
+				continue
+			}
+
+			p.status.produced()
+			return job, nil
+		}
+
+		select {
+		case <-time.After(time.Duration(resp.Wait * float64(time.Second))):
+		case <-ctx.Done():
+			return nil, gitcollector.ErrNewJobsNotFound.New()
+		}
+	}
+}
+
+// request asks the plugin for the next Job, starting it the first time. A
+// request whose answer wasn't received before the context was done is kept
+// outstanding, so its answer is taken by the next call instead of sending a
+// new one.
+func (p *PluginProvider) request(ctx context.Context) (*PluginResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped {
+		return nil, gitcollector.ErrProviderStopped.New()
+	}
+
+	if p.cmd == nil {
+		if err := p.run(); err != nil {
+			return nil, err
+		}
+	}
+
+	if !p.outstanding {
+		if err := p.write("next"); err != nil {
+			return nil, p.exitError(err)
+		}
+
+		p.outstanding = true
+	}
+
+	select {
+	case resp, ok := <-p.responses:
+		if !ok {
+			return nil, p.exitError(nil)
+		}
+
+		p.outstanding = false
+		return resp, nil
+	case <-p.cancel:
+		return nil, gitcollector.ErrProviderStopped.New()
+	case <-ctx.Done():
+		return nil, gitcollector.ErrNewJobsNotFound.New()
+	}
+}
+
+// run starts the plugin and waits for its handshake.
+func (p *PluginProvider) run() error {
+	cmd := exec.Command(p.path, p.opts.Args...)
+	cmd.Env = append(os.Environ(), p.opts.Env...)
+	cmd.Env = append(cmd.Env,
+		PluginCookieKey+"="+PluginCookieValue,
+		fmt.Sprintf("%s=%d", PluginProtocolKey, PluginProtocolVersion),
+	)
+	cmd.Stderr = p.opts.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	p.cmd = cmd
+	p.stdin = stdin
+	p.responses = make(chan *PluginResponse)
+	p.exited = make(chan struct{})
+
+	handshake := make(chan error, 1)
+	go p.read(stdout, handshake)
+
+	select {
+	case err = <-handshake:
+		if err == nil {
+			return nil
+		}
+	case <-time.After(p.opts.HandshakeTimeout):
+		err = fmt.Errorf("timeout after %s", p.opts.HandshakeTimeout)
+	}
+
+	// the plugin is run again on the next request
+	cmd.Process.Kill()
+	<-p.exited
+	p.cmd = nil
+	return ErrPluginHandshake.Wrap(err, p.path)
+}
+
+// read checks the handshake of the plugin and decodes its responses until it
+// exits.
+func (p *PluginProvider) read(stdout io.Reader, handshake chan<- error) {
+	defer func() {
+		p.exitErr = p.cmd.Wait()
+		close(p.exited)
+		close(p.responses)
+	}()
+
+	scanner := bufio.NewScanner(stdout)
+	if !scanner.Scan() {
+		handshake <- fmt.Errorf("no handshake line")
+		return
+	}
+
+	expected := fmt.Sprintf("%s|%d", PluginHandshake, PluginProtocolVersion)
+	if line := strings.TrimSpace(scanner.Text()); line != expected {
+		handshake <- fmt.Errorf("expected %q, got %q", expected, line)
+		return
+	}
+
+	handshake <- nil
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var resp PluginResponse
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			resp = PluginResponse{Error: fmt.Sprintf(
+				"wrong response %q: %s", line, err,
+			)}
+		}
+
+		// the output is drained once stopped so the plugin doesn't
+		// block writing it.
+		select {
+		case p.responses <- &resp:
+		case <-p.cancel:
+		}
+	}
+}
+
+func (p *PluginProvider) write(method string) error {
+	data, err := json.Marshal(&PluginRequest{Method: method})
+	if err != nil {
+		return err
+	}
+
+	_, err = p.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (p *PluginProvider) exitError(err error) error {
+	<-p.exited
+	if p.exitErr != nil {
+		err = p.exitErr
+	}
+
+	if err == nil {
+		return ErrPluginExited.New(p.path)
+	}
+
+	return ErrPluginExited.Wrap(err, p.path)
+}
+
+// Stop implements the gitcollector.Provider interface. The plugin is asked to
+// stop and killed if it doesn't exit before the StopTimeout.
+func (p *PluginProvider) Stop() error {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return nil
+	}
+
+	p.stopped = true
+	close(p.cancel)
+	p.mu.Unlock()
+
+	// an ongoing request returns once the cancel is closed.
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cmd == nil {
+		return nil
+	}
+
+	p.write("stop")
+	p.stdin.Close()
+
+	select {
+	case <-p.exited:
+		return nil
+	case <-time.After(p.opts.StopTimeout):
+		p.cmd.Process.Kill()
+		<-p.exited
+		return gitcollector.ErrProviderStop.New()
+	}
+}
@@ -0,0 +1,149 @@
+package discovery
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writePlugin(t *testing.T, dir, name, answers string) string {
+	t.Helper()
+
+	script := `#!/bin/sh
+[ "$` + PluginCookieKey + `" = "` + PluginCookieValue + `" ] || exit 1
+echo "gitcollector-plugin|$` + PluginProtocolKey + `"
+n=0
+while read req; do
+	case "$req" in *stop*) exit 0;; esac
+	n=$((n+1))
+	case $n in
+` + answers + `
+	*) echo '{"done":true}';;
+	esac
+done
+`
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(script), 0755))
+	return path
+}
+
+func TestPluginProvider(t *testing.T) {
+	var req = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector-plugin")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := writePlugin(t, dir, "plugin", `
+	1) echo '{"record":{"endpoints":["https://github.com/src-d/a"]}}';;
+	2) echo '{"wait":0.01}';;
+	3) echo '{"record":{"type":"bogus"}}';;
+	4) echo '{"record":{"type":"update","location":"foo"}}';;`)
+
+	queue := make(chan gitcollector.Job, 10)
+	provider := NewPluginProvider(path, queue, nil)
+
+	err = provider.Start()
+	req.True(gitcollector.ErrProviderStopped.Is(err))
+	req.Len(queue, 2)
+
+	job := (<-queue).(*library.Job)
+	req.Equal(library.JobDownload, int(job.Type))
+	req.Equal([]string{"https://github.com/src-d/a"}, job.Endpoints)
+
+	job = (<-queue).(*library.Job)
+	req.Equal(library.JobUpdate, int(job.Type))
+	req.Equal("foo", string(job.LocationID))
+
+	status := provider.Status()
+	req.Equal("plugin "+path, status.Name)
+	req.Equal(2, status.Discovered)
+	req.True(status.Done)
+	req.True(ErrPluginFailed.Is(status.LastError))
+}
+
+func TestPluginProviderErrors(t *testing.T) {
+	var req = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector-plugin")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	queue := make(chan gitcollector.Job, 10)
+
+	path := writePlugin(t, dir, "failing", `
+	1) echo '{"error":"forge unavailable"}';;`)
+	err = NewPluginProvider(path, queue, nil).Start()
+	req.True(ErrPluginFailed.Is(err))
+	req.Contains(err.Error(), "forge unavailable")
+
+	path = writePlugin(t, dir, "exiting", `
+	1) exit 3;;`)
+	err = NewPluginProvider(path, queue, nil).Start()
+	req.True(ErrPluginExited.Is(err))
+
+	path = filepath.Join(dir, "wrong")
+	req.NoError(ioutil.WriteFile(
+		path, []byte("#!/bin/sh\necho hello\n"), 0755,
+	))
+	err = NewPluginProvider(path, queue, nil).Start()
+	req.True(ErrPluginHandshake.Is(err))
+
+	path = filepath.Join(dir, "silent")
+	req.NoError(ioutil.WriteFile(
+		path, []byte("#!/bin/sh\nexec sleep 10\n"), 0755,
+	))
+	err = NewPluginProvider(path, queue, &PluginProviderOpts{
+		HandshakeTimeout: 50 * time.Millisecond,
+	}).Start()
+	req.True(ErrPluginHandshake.Is(err))
+	req.Len(queue, 0)
+}
+
+func TestPluginProviderNext(t *testing.T) {
+	var req = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector-plugin")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := writePlugin(t, dir, "slow", `
+	1) sleep 0.2; echo '{"record":{"endpoints":["https://github.com/src-d/a"]}}';;
+	2) echo '{"record":{"endpoints":["https://github.com/src-d/b"]}}';;`)
+
+	provider := NewPluginProvider(path, nil, nil)
+	defer provider.Stop()
+
+	// the answer of a canceled request is returned by the next one
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = provider.Next(ctx)
+	req.True(gitcollector.ErrNewJobsNotFound.Is(err))
+
+	job, err := provider.Next(context.Background())
+	req.NoError(err)
+	req.Equal(
+		[]string{"https://github.com/src-d/a"},
+		job.(*library.Job).Endpoints,
+	)
+
+	job, err = provider.Next(context.Background())
+	req.NoError(err)
+	req.Equal(
+		[]string{"https://github.com/src-d/b"},
+		job.(*library.Job).Endpoints,
+	)
+
+	req.NoError(provider.Stop())
+	_, err = provider.Next(context.Background())
+	req.True(gitcollector.ErrProviderStopped.Is(err))
+}
@@ -2,11 +2,14 @@ package discovery
 
 import (
 	"context"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/src-d/gitcollector"
 	"github.com/src-d/gitcollector/library"
 	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
 
 	"github.com/google/go-github/github"
 	"github.com/jpillora/backoff"
@@ -30,9 +33,34 @@ var (
 type GHProviderOpts struct {
 	WaitNewRepos    bool
 	WaitOnRateLimit bool
-	StopTimeout     time.Duration
-	EnqueueTimeout  time.Duration
-	MaxJobBuffer    int
+	// StopTimeout is the time Stop waits for the running provider to
+	// return once its context is canceled.
+	StopTimeout    time.Duration
+	EnqueueTimeout time.Duration
+	MaxJobBuffer   int
+	// RetryInterleave is the number of new Jobs enqueued between two of
+	// the Jobs buffered after timing out to be enqueued, so a burst of them
+	// doesn't hold back the discovery of the rest. The buffered Jobs are
+	// enqueued first if 0.
+	RetryInterleave int
+	// DedupWindow is the number of recently enqueued endpoints remembered
+	// to not enqueue them again if the iterator reports them again, like
+	// on every polling cycle of WaitNewRepos. 0 disables it.
+	DedupWindow int
+	// Filter skips the repositories it returns false for, all of them
+	// are downloaded if nil.
+	Filter FilterFn
+	// Cursors keeps the position of the iterator, when it's a
+	// ResumableIter, so a provider started again resumes the listing where
+	// it left off. It's saved once the Jobs before it are enqueued, never
+	// while there are Jobs waiting to be enqueued again.
+	Cursors CursorStore
+	// CursorName is the name the position is kept with, default to the
+	// name in the status of the iterator.
+	CursorName string
+	// Policies are set on the produced Jobs, overriding the ones of the
+	// gitcollector.WorkerPool.
+	Policies *gitcollector.Policies
 }
 
 // GHProvider is a gitcollector.Provider implementation. It will retrieve the
@@ -42,12 +70,30 @@ type GHProvider struct {
 	iter      GHRepositoriesIter
 	retryJobs []*library.Job
 	queue     chan<- gitcollector.Job
-	cancel    chan struct{}
 	backoff   *backoff.Backoff
 	opts      *GHProviderOpts
+	status    providerStatus
+	recent    *recentEndpoints
+
+	// fresh counts the new Jobs enqueued since the last retried one, and
+	// iterErr is the error of the iterator returned once the retried Jobs
+	// are enqueued. resumed is set once the position of the iterator is
+	// restored.
+	fresh   int
+	iterErr error
+	resumed bool
+
+	mu      sync.Mutex
+	stopped bool
+	cancel  context.CancelFunc
+	done    chan struct{}
 }
 
-var _ gitcollector.Provider = (*GHProvider)(nil)
+var (
+	_ gitcollector.Provider        = (*GHProvider)(nil)
+	_ gitcollector.ContextProvider = (*GHProvider)(nil)
+	_ gitcollector.ProviderStatus  = (*GHProvider)(nil)
+)
 
 const (
 	stopTimeout    = 10 * time.Second
@@ -79,10 +125,43 @@ func NewGHProvider(
 	return &GHProvider{
 		iter:    iter,
 		queue:   queue,
-		cancel:  make(chan struct{}),
 		backoff: newBackoff(),
 		opts:    opts,
+		recent:  newRecentEndpoints(opts.DedupWindow),
+	}
+}
+
+// Validate checks the options of a GHProvider enqueueing to a queue with the
+// given capacity, returning a gitcollector.ConfigError with all the problems
+// found.
+func (o *GHProviderOpts) Validate(queueCap int) error {
+	var cerr gitcollector.ConfigError
+	if o.StopTimeout < 0 {
+		cerr.Add("StopTimeout", "can't be negative")
+	}
+
+	if o.EnqueueTimeout < 0 {
+		cerr.Add("EnqueueTimeout", "can't be negative")
+	}
+
+	if o.MaxJobBuffer < 0 {
+		cerr.Add("MaxJobBuffer", "can't be negative")
+	} else if o.MaxJobBuffer > 0 && o.MaxJobBuffer < queueCap {
+		cerr.Add("MaxJobBuffer",
+			"%d is smaller than the queue capacity %d, jobs would be "+
+				"dropped while the queue is full",
+			o.MaxJobBuffer, queueCap)
+	}
+
+	if o.DedupWindow < 0 {
+		cerr.Add("DedupWindow", "can't be negative")
+	}
+
+	if o.RetryInterleave < 0 {
+		cerr.Add("RetryInterleave", "can't be negative")
 	}
+
+	return cerr.Err()
 }
 
 func newBackoff() *backoff.Backoff {
@@ -102,89 +181,322 @@ func newBackoff() *backoff.Backoff {
 
 // Start implements the gitcollector.Provider interface.
 func (p *GHProvider) Start() error {
-	ctx, cancel := context.WithCancel(context.Background())
+	return p.StartContext(context.Background())
+}
+
+// StartContext implements the gitcollector.ContextProvider interface. The API
+// requests in flight are canceled once the context is done or the provider is
+// stopped.
+func (p *GHProvider) StartContext(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		err := gitcollector.ErrProviderStopped.New()
+		p.status.done(err)
+		return err
+	}
+
+	p.cancel, p.done = cancel, done
+	p.mu.Unlock()
+
+	if err := p.resume(); err != nil {
+		p.status.done(err)
+		return err
+	}
+
+	err := p.start(ctx)
+	p.status.done(err)
+	return err
+}
+
+func (p *GHProvider) start(ctx context.Context) error {
 	for {
-		done := make(chan struct{})
-		var err error
-		go func() {
-			err = p.enqueueJob(ctx)
-			close(done)
-		}()
-
-		select {
-		case <-done:
-			if err != nil {
-				return err
-			}
-		case <-p.cancel:
+		err := p.enqueueJob(ctx)
+		if ctx.Err() != nil {
 			return gitcollector.ErrProviderStopped.New()
 		}
+
+		if err != nil {
+			return err
+		}
 	}
 }
 
-func (p *GHProvider) enqueueJob(ctx context.Context) error {
-	var (
-		job     *library.Job
-		retried bool
-	)
+// Status implements the gitcollector.ProviderStatus interface.
+func (p *GHProvider) Status() gitcollector.ProviderState {
+	return p.status.state(p.iter)
+}
 
-	if len(p.retryJobs) > 0 {
-		job = p.retryJobs[0]
-		p.retryJobs = p.retryJobs[1:]
-		retried = true
-	} else {
-		repo, retry, err := p.iter.Next(ctx)
-		if err != nil {
-			if ErrNewRepositoriesNotFound.Is(err) &&
-				!p.opts.WaitNewRepos {
-				return gitcollector.
-					ErrProviderStopped.
-					Wrap(err)
-			}
-
-			if ErrRateLimitExceeded.Is(err) &&
-				!p.opts.WaitOnRateLimit {
-				return gitcollector.
-					ErrProviderStopped.
-					Wrap(err)
-			}
-
-			if retry <= 0 {
-				return err
-			}
-
-			time.Sleep(retry)
-			return nil
-		}
+// providerStatus tracks the Jobs produced by a provider and how it finished,
+// the rest of the state is taken from the iterator.
+type providerStatus struct {
+	mu         sync.Mutex
+	discovered int
+	finished   bool
+	err        error
+	errTime    time.Time
+}
 
-		endpoint, err := getEndpoint(repo)
-		if err != nil {
-			return nil
-		}
+func (s *providerStatus) produced() {
+	s.mu.Lock()
+	s.discovered++
+	s.mu.Unlock()
+}
 
-		job = &library.Job{
-			Type:      library.JobDownload,
-			Endpoints: []string{endpoint},
-		}
+func (s *providerStatus) done(err error) {
+	s.mu.Lock()
+	s.finished = true
+	s.mu.Unlock()
+
+	s.fail(err)
+}
+
+func (s *providerStatus) fail(err error) {
+	if err == nil ||
+		gitcollector.ErrProviderStopped.Is(err) ||
+		ErrNewRepositoriesNotFound.Is(err) {
+		return
+	}
+
+	s.mu.Lock()
+	s.err = err
+	s.errTime = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *providerStatus) state(
+	iter GHRepositoriesIter,
+) gitcollector.ProviderState {
+	state := gitcollector.ProviderState{RateLimitRemaining: -1}
+	if is, ok := iter.(gitcollector.ProviderStatus); ok {
+		state = is.Status()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state.Discovered = s.discovered
+	state.Done = s.finished
+	if s.err != nil && s.errTime.After(state.LastErrorTime) {
+		state.LastError = s.err
+		state.LastErrorTime = s.errTime
+	}
+
+	return state
+}
+
+func (p *GHProvider) enqueueJob(ctx context.Context) error {
+	job, retried, err := p.nextJob(ctx)
+	if err != nil || job == nil {
+		return err
 	}
 
 	select {
 	case p.queue <- job:
 		if retried {
 			p.backoff.Reset()
+		} else {
+			p.fresh++
+			p.status.produced()
+			p.saveCursor()
 		}
 	case <-time.After(p.opts.EnqueueTimeout):
 		if len(p.retryJobs) < p.opts.MaxJobBuffer {
 			p.retryJobs = append(p.retryJobs, job)
 		}
 
-		time.Sleep(p.backoff.Duration())
+		sleep(ctx, p.backoff.Duration())
+	case <-ctx.Done():
 	}
 
 	return nil
 }
 
+// resume moves the iterator to the position kept in the CursorStore the first
+// time the provider is started.
+func (p *GHProvider) resume() error {
+	iter, ok := p.iter.(ResumableIter)
+	name := p.cursorName()
+	if !ok || p.opts.Cursors == nil || name == "" || p.resumed {
+		return nil
+	}
+
+	p.resumed = true
+	c, found, err := p.opts.Cursors.Load(name)
+	if err != nil || !found {
+		return err
+	}
+
+	iter.Resume(c)
+	return nil
+}
+
+// saveCursor keeps the position of the iterator in the CursorStore, unless
+// there are Jobs to enqueue again before it.
+func (p *GHProvider) saveCursor() {
+	iter, ok := p.iter.(ResumableIter)
+	name := p.cursorName()
+	if !ok || p.opts.Cursors == nil || name == "" || len(p.retryJobs) > 0 {
+		return
+	}
+
+	if err := p.opts.Cursors.Save(name, iter.Cursor()); err != nil {
+		log.Warningf("%s", err)
+	}
+}
+
+func (p *GHProvider) cursorName() string {
+	if p.opts.CursorName != "" {
+		return p.opts.CursorName
+	}
+
+	if s, ok := p.iter.(gitcollector.ProviderStatus); ok {
+		return s.Status().Name
+	}
+
+	return ""
+}
+
+// nextJob returns the next Job to enqueue, a retried one every
+// RetryInterleave new ones, or while the iterator has none to give. A nil Job
+// without error is returned when there's nothing to enqueue yet.
+func (p *GHProvider) nextJob(
+	ctx context.Context,
+) (*library.Job, bool, error) {
+	if len(p.retryJobs) > 0 &&
+		(p.fresh >= p.opts.RetryInterleave || p.iterErr != nil) {
+		return p.popRetry(), true, nil
+	}
+
+	if p.iterErr != nil {
+		return nil, false, p.iterErr
+	}
+
+	job, retry, err := nextJob(ctx, p.iter, p.opts)
+	switch {
+	case err != nil && len(p.retryJobs) > 0:
+		p.iterErr = err
+		return p.popRetry(), true, nil
+	case err != nil:
+		return nil, false, err
+	case job == nil && retry > 0 && len(p.retryJobs) > 0:
+		return p.popRetry(), true, nil
+	case job == nil:
+		sleep(ctx, retry)
+		return nil, false, nil
+	case !p.recent.admit(job.Endpoints[0]):
+		return nil, false, nil
+	}
+
+	return job, false, nil
+}
+
+func (p *GHProvider) popRetry() *library.Job {
+	job := p.retryJobs[0]
+	p.retryJobs = p.retryJobs[1:]
+	p.fresh = 0
+	return job
+}
+
+// sleep waits for the given duration or until the context is done.
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// nextJob builds a download Job for the next repository of the iterator. A
+// nil Job without error is returned when the repository must be skipped or
+// the iterator asks to wait for the returned duration.
+func nextJob(
+	ctx context.Context,
+	iter GHRepositoriesIter,
+	opts *GHProviderOpts,
+) (*library.Job, time.Duration, error) {
+	repo, retry, err := iter.Next(ctx)
+	if err != nil {
+		if ErrNewRepositoriesNotFound.Is(err) && !opts.WaitNewRepos {
+			return nil, 0, gitcollector.ErrProviderStopped.Wrap(err)
+		}
+
+		if ErrRateLimitExceeded.Is(err) && !opts.WaitOnRateLimit {
+			return nil, 0, gitcollector.ErrProviderStopped.Wrap(err)
+		}
+
+		if retry <= 0 {
+			return nil, 0, err
+		}
+
+		return nil, retry, nil
+	}
+
+	if opts.Filter != nil && !opts.Filter(repo) {
+		return nil, 0, nil
+	}
+
+	endpoint, err := getEndpoint(repo)
+	if err != nil {
+		return nil, 0, nil
+	}
+
+	return &library.Job{
+		Type:      library.JobDownload,
+		Endpoints: []string{endpoint},
+		// the API reports the size in kilobytes.
+		SizeHint: uint64(repo.GetSize()) * 1024,
+		Labels:   repositoryLabels(repo),
+		Metadata: repositoryMetadata(repo),
+		Policies: opts.Policies,
+	}, 0, nil
+}
+
+func repositoryLabels(r *github.Repository) map[string]string {
+	labels := map[string]string{}
+	if len(r.Topics) > 0 {
+		labels[library.LabelTopics] = strings.Join(r.Topics, ",")
+	}
+
+	if lang := r.GetLanguage(); lang != "" {
+		labels[library.LabelLanguage] = lang
+	}
+
+	if pushed := r.GetPushedAt(); !pushed.IsZero() {
+		labels[library.LabelPushedAt] = pushed.UTC().Format(time.RFC3339)
+	}
+
+	return labels
+}
+
+func repositoryMetadata(r *github.Repository) map[string]interface{} {
+	metadata := map[string]interface{}{
+		library.MetadataStars: r.GetStargazersCount(),
+		library.MetadataFork:  r.GetFork(),
+	}
+
+	if len(r.Topics) > 0 {
+		metadata[library.MetadataTopics] = r.Topics
+	}
+
+	if branch := r.GetDefaultBranch(); branch != "" {
+		metadata[library.MetadataDefaultBranch] = branch
+	}
+
+	if license := r.GetLicense().GetKey(); license != "" {
+		metadata[library.MetadataLicense] = license
+	}
+
+	return metadata
+}
+
 func getEndpoint(r *github.Repository) (string, error) {
 	var endpoint string
 	getURLs := []func() string{
@@ -208,10 +520,22 @@ func getEndpoint(r *github.Repository) (string, error) {
 	return endpoint, nil
 }
 
-// Stop implements the gitcollector.Provider interface
+// Stop implements the gitcollector.Provider interface. It cancels the context
+// of the running provider and waits for it to return, a provider stopped
+// before starting returns right away once started.
 func (p *GHProvider) Stop() error {
+	p.mu.Lock()
+	p.stopped = true
+	cancel, done := p.cancel, p.done
+	p.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
 	select {
-	case p.cancel <- struct{}{}:
+	case <-done:
 		return nil
 	case <-time.After(p.opts.StopTimeout):
 		return gitcollector.ErrProviderStop.New()
@@ -1,6 +1,16 @@
 package discovery
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -8,6 +18,7 @@ import (
 	"github.com/src-d/gitcollector"
 	"github.com/src-d/gitcollector/library"
 
+	"github.com/google/go-github/github"
 	"github.com/stretchr/testify/require"
 )
 
@@ -72,3 +83,211 @@ func TestGHProvider(t *testing.T) {
 		req.True(strings.Contains(job.Endpoints[0], org))
 	}
 }
+
+// blockingIter blocks in Next until its context is canceled, like an API
+// request in flight.
+type blockingIter struct {
+	started  chan struct{}
+	canceled chan error
+}
+
+func (i *blockingIter) Next(
+	ctx context.Context,
+) (*github.Repository, time.Duration, error) {
+	close(i.started)
+	<-ctx.Done()
+	i.canceled <- ctx.Err()
+	return nil, 0, ctx.Err()
+}
+
+func TestGHProviderContext(t *testing.T) {
+	var req = require.New(t)
+
+	newIter := func() *blockingIter {
+		return &blockingIter{
+			started:  make(chan struct{}),
+			canceled: make(chan error, 1),
+		}
+	}
+
+	// the context cancels the requests in flight
+	iter := newIter()
+	provider := NewGHProvider(make(chan gitcollector.Job), iter, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- gitcollector.StartProvider(ctx, provider) }()
+
+	<-iter.started
+	cancel()
+	req.True(gitcollector.ErrProviderStopped.Is(<-done))
+	req.Equal(context.Canceled, <-iter.canceled)
+	req.True(provider.Status().Done)
+
+	// so does Stop
+	iter = newIter()
+	provider = NewGHProvider(make(chan gitcollector.Job), iter, nil)
+	go func() { done <- provider.StartContext(context.Background()) }()
+
+	<-iter.started
+	req.NoError(provider.Stop())
+	req.True(gitcollector.ErrProviderStopped.Is(<-done))
+	req.Equal(context.Canceled, <-iter.canceled)
+
+	// a provider stopped before starting doesn't start
+	provider = NewGHProvider(make(chan gitcollector.Job), newIter(), nil)
+	req.NoError(provider.Stop())
+	req.True(gitcollector.ErrProviderStopped.Is(provider.Start()))
+}
+
+func TestGHProviderRetryInterleave(t *testing.T) {
+	var req = require.New(t)
+
+	enqueued := func(interleave int) []string {
+		var repos []*github.Repository
+		for _, name := range []string{"n1", "n2", "n3", "n4", "n5"} {
+			repos = append(repos, &github.Repository{
+				HTMLURL: github.String(name),
+			})
+		}
+
+		queue := make(chan gitcollector.Job, 10)
+		provider := NewGHProvider(
+			queue,
+			&sliceReposIter{repos: repos},
+			&GHProviderOpts{RetryInterleave: interleave},
+		)
+
+		// the jobs timed out to be enqueued before
+		for _, name := range []string{"r1", "r2", "r3"} {
+			provider.retryJobs = append(provider.retryJobs, &library.Job{
+				Type:      library.JobDownload,
+				Endpoints: []string{name},
+			})
+		}
+
+		err := provider.Start()
+		req.True(gitcollector.ErrProviderStopped.Is(err))
+		req.True(ErrNewRepositoriesNotFound.Is(err))
+
+		close(queue)
+		var endpoints []string
+		for job := range queue {
+			endpoints = append(endpoints, job.(*library.Job).Endpoints[0])
+		}
+
+		return endpoints
+	}
+
+	req.Equal(
+		[]string{"r1", "r2", "r3", "n1", "n2", "n3", "n4", "n5"},
+		enqueued(0),
+	)
+
+	// the retried jobs left once the iterator finishes are enqueued too
+	req.Equal(
+		[]string{"n1", "n2", "r1", "n3", "n4", "r2", "n5", "r3"},
+		enqueued(2),
+	)
+}
+
+func TestGHProviderCursor(t *testing.T) {
+	var req = require.New(t)
+
+	var repos []string
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			if page == 0 {
+				page = 1
+			}
+
+			perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+			from, to := (page-1)*perPage, page*perPage
+			if to < len(repos) {
+				w.Header().Set("Link", fmt.Sprintf(
+					`<%s%s?page=%d&per_page=%d>; rel="next"`,
+					"http://"+r.Host, r.URL.Path, page+1, perPage,
+				))
+			} else {
+				to = len(repos)
+			}
+
+			var list []*github.Repository
+			for _, name := range repos[from:to] {
+				list = append(list, &github.Repository{
+					HTMLURL: github.String(name),
+				})
+			}
+
+			json.NewEncoder(w).Encode(list)
+		},
+	))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "gitcollector-cursors")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cursors.json")
+	enqueued := func() []string {
+		cursors, err := NewFileCursorStore(path)
+		req.NoError(err)
+
+		iter := NewGHOrgReposIter("src-d", &GHReposIterOpts{
+			ResultsPerPage: 2,
+		})
+		iter.client.BaseURL, _ = url.Parse(server.URL + "/")
+
+		queue := make(chan gitcollector.Job, 10)
+		err = NewGHProvider(queue, iter, &GHProviderOpts{
+			Cursors: cursors,
+		}).Start()
+		req.True(ErrNewRepositoriesNotFound.Is(err))
+
+		close(queue)
+		var endpoints []string
+		for job := range queue {
+			endpoints = append(endpoints, job.(*library.Job).Endpoints[0])
+		}
+
+		return endpoints
+	}
+
+	repos = []string{"r1", "r2", "r3"}
+	req.Equal([]string{"r1", "r2", "r3"}, enqueued())
+
+	// the listing is resumed after the last enqueued repository
+	repos = append(repos, "r4", "r5")
+	req.Equal([]string{"r4", "r5"}, enqueued())
+
+	cursors, err := NewFileCursorStore(path)
+	req.NoError(err)
+	c, ok, err := cursors.Load("github:src-d")
+	req.NoError(err)
+	req.True(ok)
+	req.Equal(Cursor{Page: 3, Offset: 1}, c)
+}
+
+func TestGHProviderOptsValidate(t *testing.T) {
+	var req = require.New(t)
+
+	req.NoError((&GHProviderOpts{}).Validate(100))
+	req.NoError((&GHProviderOpts{MaxJobBuffer: 200}).Validate(100))
+
+	err := (&GHProviderOpts{
+		StopTimeout:     -time.Second,
+		MaxJobBuffer:    50,
+		DedupWindow:     -1,
+		RetryInterleave: -1,
+	}).Validate(100)
+	req.Error(err)
+
+	var fields []string
+	for _, p := range err.(*gitcollector.ConfigError).Problems {
+		fields = append(fields, p.Field)
+	}
+
+	req.Equal([]string{
+		"StopTimeout", "MaxJobBuffer", "DedupWindow", "RetryInterleave",
+	}, fields)
+}
@@ -0,0 +1,84 @@
+package discovery
+
+import (
+	"context"
+	"time"
+
+	"github.com/src-d/gitcollector"
+)
+
+// GHPullProvider is a gitcollector.PullProvider implementation retrieving the
+// repositories of a GHRepositoriesIter only when the scheduler requests a new
+// Job.
+type GHPullProvider struct {
+	iter   GHRepositoriesIter
+	opts   *GHProviderOpts
+	status providerStatus
+	recent *recentEndpoints
+}
+
+var (
+	_ gitcollector.PullProvider   = (*GHPullProvider)(nil)
+	_ gitcollector.ProviderStatus = (*GHPullProvider)(nil)
+)
+
+// NewGHPullProvider builds a new GHPullProvider. The options related to the
+// queue, EnqueueTimeout and MaxJobBuffer, are ignored.
+func NewGHPullProvider(
+	iter GHRepositoriesIter,
+	opts *GHProviderOpts,
+) *GHPullProvider {
+	if opts == nil {
+		opts = &GHProviderOpts{}
+	}
+
+	return &GHPullProvider{
+		iter:   iter,
+		opts:   opts,
+		recent: newRecentEndpoints(opts.DedupWindow),
+	}
+}
+
+// Status implements the gitcollector.ProviderStatus interface.
+func (p *GHPullProvider) Status() gitcollector.ProviderState {
+	return p.status.state(p.iter)
+}
+
+// Next implements the gitcollector.PullProvider interface.
+func (p *GHPullProvider) Next(ctx context.Context) (gitcollector.Job, error) {
+	for {
+		job, retry, err := nextJob(ctx, p.iter, p.opts)
+		if job != nil {
+			if !p.recent.admit(job.Endpoints[0]) {
+				continue
+			}
+
+			p.status.produced()
+			return job, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, gitcollector.ErrNewJobsNotFound.New()
+		}
+
+		if err != nil {
+			if gitcollector.ErrProviderStopped.Is(err) {
+				p.status.done(err)
+			} else {
+				p.status.fail(err)
+			}
+
+			return nil, err
+		}
+
+		if retry <= 0 {
+			continue
+		}
+
+		select {
+		case <-time.After(retry):
+		case <-ctx.Done():
+			return nil, gitcollector.ErrNewJobsNotFound.New()
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+)
+
+type retryReposIter struct {
+	retries int
+	iter    GHRepositoriesIter
+}
+
+func (i *retryReposIter) Next(
+	ctx context.Context,
+) (*github.Repository, time.Duration, error) {
+	if i.retries > 0 {
+		i.retries--
+		return nil, time.Millisecond, ErrRateLimitExceeded.New()
+	}
+
+	return i.iter.Next(ctx)
+}
+
+func TestGHPullProvider(t *testing.T) {
+	var req = require.New(t)
+
+	var (
+		url     = "https://github.com/src-d/gitcollector"
+		lang    = "Go"
+		stars   = 42
+		branch  = "main"
+		license = "mit"
+	)
+
+	provider := NewGHPullProvider(
+		&retryReposIter{
+			retries: 2,
+			iter: &sliceReposIter{repos: []*github.Repository{
+				{
+					HTMLURL:         &url,
+					Language:        &lang,
+					Topics:          []string{"git", "collector"},
+					StargazersCount: &stars,
+					DefaultBranch:   &branch,
+					License:         &github.License{Key: &license},
+				},
+				{},
+			}},
+		},
+		&GHProviderOpts{WaitOnRateLimit: true},
+	)
+
+	ctx := context.Background()
+	job, err := provider.Next(ctx)
+	req.NoError(err)
+	req.Equal([]string{url}, job.(*library.Job).Endpoints)
+	req.Equal(map[string]string{
+		library.LabelTopics:   "git,collector",
+		library.LabelLanguage: "Go",
+	}, job.(*library.Job).Labels)
+	req.Equal(map[string]interface{}{
+		library.MetadataStars:         42,
+		library.MetadataFork:          false,
+		library.MetadataTopics:        []string{"git", "collector"},
+		library.MetadataDefaultBranch: "main",
+		library.MetadataLicense:       "mit",
+	}, job.(*library.Job).Metadata)
+
+	status := provider.Status()
+	req.Equal(1, status.Discovered)
+	req.Equal(-1, status.RateLimitRemaining)
+	req.False(status.Done)
+
+	// repositories without endpoints are skipped
+	_, err = provider.Next(ctx)
+	req.True(gitcollector.ErrProviderStopped.Is(err))
+
+	status = provider.Status()
+	req.Equal(1, status.Discovered)
+	req.True(status.Done)
+	req.NoError(status.LastError)
+
+	provider = NewGHPullProvider(
+		&retryReposIter{retries: 1, iter: &sliceReposIter{}},
+		&GHProviderOpts{WaitOnRateLimit: true},
+	)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = provider.Next(cctx)
+	req.True(gitcollector.ErrNewJobsNotFound.Is(err))
+}
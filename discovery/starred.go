@@ -0,0 +1,65 @@
+package discovery
+
+import (
+	"context"
+
+	"github.com/src-d/gitcollector"
+
+	"github.com/google/go-github/github"
+)
+
+// GHStarredReposIter is a GHRepositoriesIter of the repositories starred by a
+// github user.
+type GHStarredReposIter struct {
+	*ghReposPager
+	user string
+}
+
+var (
+	_ GHRepositoriesIter          = (*GHStarredReposIter)(nil)
+	_ gitcollector.ProviderStatus = (*GHStarredReposIter)(nil)
+)
+
+// NewGHStarredReposIter builds a new GHStarredReposIter. An empty user lists
+// the repositories starred by the owner of the auth token.
+func NewGHStarredReposIter(
+	user string,
+	opts *GHReposIterOpts,
+) *GHStarredReposIter {
+	name := "github:starred"
+	if user != "" {
+		name += ":" + user
+	}
+
+	p := newGHReposPager(name, opts)
+	p.list = func(
+		ctx context.Context,
+		page *github.ListOptions,
+	) ([]*github.Repository, *github.Response, error) {
+		// sorted by the time they were starred, so the new stars are
+		// found at the end of the listing.
+		starred, res, err := p.client.Activity.ListStarred(
+			ctx,
+			user,
+			&github.ActivityListStarredOptions{
+				Sort:        "created",
+				Direction:   "asc",
+				ListOptions: *page,
+			},
+		)
+		if err != nil {
+			return nil, res, err
+		}
+
+		repos := make([]*github.Repository, 0, len(starred))
+		for _, s := range starred {
+			if s.Repository != nil {
+				repos = append(repos, s.Repository)
+			}
+		}
+
+		return repos, res, nil
+	}
+
+	return &GHStarredReposIter{ghReposPager: p, user: user}
+}
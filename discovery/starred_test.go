@@ -0,0 +1,84 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGHStarredReposIter(t *testing.T) {
+	var req = require.New(t)
+
+	var (
+		paths []string
+		stars = `{"repo": {"name": "go-git", "html_url": "https://github.com/src-d/go-git"}}`
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.Path)
+			req.Equal("created", r.URL.Query().Get("sort"))
+			req.Equal("asc", r.URL.Query().Get("direction"))
+
+			if r.URL.Query().Get("page") == "" {
+				w.Header().Set("Link", fmt.Sprintf(
+					`<http://%s%s?page=2>; rel="next"`,
+					r.Host, r.URL.Path,
+				))
+				fmt.Fprint(w, `[{"repo": {"name": "borges"}}, {"repo": {"name": "gitbase"}}]`)
+				return
+			}
+
+			fmt.Fprintf(w, `[%s]`, stars)
+		},
+	))
+	defer server.Close()
+
+	iter := NewGHStarredReposIter("jfontan", &GHReposIterOpts{
+		ResultsPerPage: 2,
+	})
+	iter.client.BaseURL, _ = url.Parse(server.URL + "/")
+	req.Equal("github:starred:jfontan", iter.Status().Name)
+
+	ctx := context.Background()
+	repo, _, err := iter.Next(ctx)
+	req.NoError(err)
+	req.Equal("borges", repo.GetName())
+
+	repo, _, err = iter.Next(ctx)
+	req.NoError(err)
+	req.Equal("gitbase", repo.GetName())
+
+	repo, _, err = iter.Next(ctx)
+	req.NoError(err)
+	req.Equal("go-git", repo.GetName())
+
+	_, retry, err := iter.Next(ctx)
+	req.True(ErrNewRepositoriesNotFound.Is(err))
+	req.Equal(waitNewRepos, retry)
+
+	// a new star is appended to the last page
+	stars += `, {"repo": {"name": "gitcollector"}}`
+	repo, _, err = iter.Next(ctx)
+	req.NoError(err)
+	req.Equal("gitcollector", repo.GetName())
+	req.Equal(4, iter.Status().Discovered)
+
+	for _, p := range paths {
+		req.Equal("/users/jfontan/starred", p)
+	}
+
+	paths = nil
+	iter = NewGHStarredReposIter("", nil)
+	iter.client.BaseURL, _ = url.Parse(server.URL + "/")
+	req.Equal("github:starred", iter.Status().Name)
+
+	_, _, err = iter.Next(ctx)
+	req.NoError(err)
+	req.Equal([]string{"/user/starred"}, paths)
+}
@@ -0,0 +1,311 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/sideband"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+var (
+	// ErrHistoryIncomplete is returned when the history of a repository
+	// fetched incrementally isn't complete yet, it's resumed by the next
+	// Job of the repository.
+	ErrHistoryIncomplete = errors.NewKind(
+		"history of %s incomplete after %d steps")
+
+	// ErrDeepenSinceNotSupported is returned when a repository is fetched
+	// incrementally by date from a server not supporting it.
+	ErrDeepenSinceNotSupported = errors.NewKind(
+		"%s doesn't support fetching the history by date")
+)
+
+// fetchIncremental deepens the partial clone of the repository until its
+// history is complete or the budget of the IncrementalFetch is spent. The
+// partial clone is returned along with its path in the IncrementalFetch FS
+// once complete, ErrHistoryIncomplete otherwise.
+func fetchIncremental(
+	ctx context.Context,
+	logger log.Logger,
+	incremental *library.IncrementalFetch,
+	id borges.RepositoryID,
+	endpoint string,
+	auth transport.AuthMethod,
+	storage *library.StorageOpts,
+) (*git.Repository, string, error) {
+	state, err := incremental.State(id, endpoint)
+	if err != nil {
+		return nil, "", err
+	}
+
+	path := incremental.Path(id)
+	repo, err := openPartialClone(
+		incremental.FS(), path, endpoint, id.String(), storage,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	start := time.Now()
+	for {
+		next := incremental.Next(state, time.Now())
+		complete, err := deepen(ctx, repo, id.String(), endpoint, auth, next)
+		if err != nil {
+			closeStorer(repo)
+			return nil, "", err
+		}
+
+		if err := incremental.Save(next); err != nil {
+			closeStorer(repo)
+			return nil, "", err
+		}
+
+		state = next
+		logger.With(log.Fields{
+			"step":  state.Steps,
+			"depth": state.Depth,
+		}).Debugf("history deepened")
+
+		if complete {
+			return repo, path, nil
+		}
+
+		if budget := incremental.Budget(); budget <= 0 ||
+			time.Since(start) >= budget {
+			closeStorer(repo)
+			return nil, "", ErrHistoryIncomplete.New(id, state.Steps)
+		}
+	}
+}
+
+func openPartialClone(
+	fs billy.Filesystem,
+	path, endpoint, id string,
+	storage *library.StorageOpts,
+) (*git.Repository, error) {
+	repoFS, err := fs.Chroot(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sto := storage.NewStorage(repoFS)
+	repo, err := git.Open(sto, nil)
+	if err == git.ErrRepositoryNotExists {
+		repo, err = git.Init(sto, nil)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := createRemote(repo, id, endpoint, ""); err != nil {
+		closeStorer(repo)
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// deepen fetches the HEAD of the remote into the partial clone up to the depth
+// or date of the given progress, returning whether its history is complete.
+// go-git only deepens by a number of commits and doesn't update the shallow
+// commits left behind, so the upload-pack request is made here.
+func deepen(
+	ctx context.Context,
+	repo *git.Repository,
+	id, endpoint string,
+	auth transport.AuthMethod,
+	state *library.PartialClone,
+) (bool, error) {
+	ep, err := transport.NewEndpoint(endpoint)
+	if err != nil {
+		return false, err
+	}
+
+	c, err := client.NewClient(ep)
+	if err != nil {
+		return false, err
+	}
+
+	s, err := c.NewUploadPackSession(ep, auth)
+	if err != nil {
+		return false, err
+	}
+	defer s.Close()
+
+	ar, err := s.AdvertisedReferences()
+	if err != nil {
+		return false, err
+	}
+
+	refs, err := ar.AllReferences()
+	if err != nil {
+		return false, err
+	}
+
+	head, err := storer.ResolveReference(refs, plumbing.HEAD)
+	if err != nil {
+		return false, err
+	}
+
+	req := packp.NewUploadPackRequestFromCapabilities(ar.Capabilities)
+	if err := req.Capabilities.Set(capability.Shallow); err != nil {
+		return false, err
+	}
+
+	if state.Since != nil {
+		if !ar.Capabilities.Supports(capability.DeepenSince) {
+			return false, ErrDeepenSinceNotSupported.New(endpoint)
+		}
+
+		if err := req.Capabilities.Set(capability.DeepenSince); err != nil {
+			return false, err
+		}
+
+		req.Depth = packp.DepthSince(*state.Since)
+	} else {
+		req.Depth = packp.DepthCommits(state.Depth)
+	}
+
+	if ar.Capabilities.Supports(capability.NoProgress) {
+		if err := req.Capabilities.Set(capability.NoProgress); err != nil {
+			return false, err
+		}
+	}
+
+	shallows, err := repo.Storer.Shallow()
+	if err != nil {
+		return false, err
+	}
+
+	req.Shallows = shallows
+	req.Wants = []plumbing.Hash{head.Hash()}
+	req.Haves, err = deepenHaves(repo, id, head.Hash())
+	if err != nil {
+		return false, err
+	}
+
+	res, err := s.UploadPack(ctx, req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Close()
+
+	if err := packfile.UpdateObjectStorage(
+		repo.Storer, sidebandReader(req.Capabilities, res),
+	); err != nil {
+		return false, err
+	}
+
+	shallows = updateShallows(shallows, &res.ShallowUpdate)
+	if err := repo.Storer.SetShallow(shallows); err != nil {
+		return false, err
+	}
+
+	ref := plumbing.NewHashReference(
+		plumbing.NewRemoteHEADReferenceName(id), head.Hash(),
+	)
+	if err := repo.Storer.SetReference(ref); err != nil {
+		return false, err
+	}
+
+	return len(shallows) == 0, nil
+}
+
+// deepenHaves returns the commits of the partial clone the server doesn't
+// need to send. go-git refuses requests whose wants are all haves, so the
+// parents of the HEAD are sent instead when it didn't change, costing only
+// the objects of its last commit.
+func deepenHaves(
+	repo *git.Repository,
+	id string,
+	want plumbing.Hash,
+) ([]plumbing.Hash, error) {
+	ref, err := repo.Storer.Reference(plumbing.NewRemoteHEADReferenceName(id))
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ref.Hash() != want {
+		return []plumbing.Hash{ref.Hash()}, nil
+	}
+
+	commit, err := repo.CommitObject(want)
+	if err != nil {
+		return nil, err
+	}
+
+	var haves []plumbing.Hash
+	for _, p := range commit.ParentHashes {
+		if _, err := repo.Storer.EncodedObject(plumbing.CommitObject, p); err == nil {
+			haves = append(haves, p)
+		}
+	}
+
+	return haves, nil
+}
+
+// updateShallows replaces the shallow commits deepened by the server with the
+// new ones.
+func updateShallows(
+	shallows []plumbing.Hash,
+	update *packp.ShallowUpdate,
+) []plumbing.Hash {
+	unshallow := make(map[plumbing.Hash]bool, len(update.Unshallows))
+	for _, h := range update.Unshallows {
+		unshallow[h] = true
+	}
+
+	seen := make(map[plumbing.Hash]bool)
+	var result []plumbing.Hash
+	for _, h := range append(shallows, update.Shallows...) {
+		if unshallow[h] || seen[h] {
+			continue
+		}
+
+		seen[h] = true
+		result = append(result, h)
+	}
+
+	return result
+}
+
+// sidebandReader demultiplexes the packfile of the response when the sideband
+// is used.
+func sidebandReader(l *capability.List, res io.Reader) io.Reader {
+	var t sideband.Type
+	switch {
+	case l.Supports(capability.Sideband64k):
+		t = sideband.Sideband64k
+	case l.Supports(capability.Sideband):
+		t = sideband.Sideband
+	default:
+		return res
+	}
+
+	return sideband.NewDemuxer(t, res)
+}
+
+func closeStorer(repo *git.Repository) {
+	if c, ok := repo.Storer.(io.Closer); ok {
+		c.Close()
+	}
+}
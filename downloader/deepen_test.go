@@ -0,0 +1,129 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-log.v1"
+
+	"github.com/stretchr/testify/require"
+)
+
+// historyRepo creates a repository with a commit per day ending today.
+func historyRepo(t *testing.T, path string, commits int) {
+	t.Helper()
+
+	repo, err := git.PlainInit(path, false)
+	require.NoError(t, err)
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+
+	now := time.Now()
+	for i := commits - 1; i >= 0; i-- {
+		name := filepath.Join(path, "file")
+		content := []byte(now.Add(-time.Duration(i) * 24 * time.Hour).String())
+		require.NoError(t, ioutil.WriteFile(name, content, 0644))
+		_, err = wt.Add("file")
+		require.NoError(t, err)
+
+		when := now.Add(-time.Duration(i) * 24 * time.Hour)
+		_, err = wt.Commit("commit", &git.CommitOptions{
+			Author: &object.Signature{Name: "a", Email: "a@a", When: when},
+		})
+		require.NoError(t, err)
+	}
+}
+
+func TestFetchIncremental(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	var req = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	endpoint := filepath.Join(dir, "remote")
+	historyRepo(t, endpoint, 10)
+
+	id := borges.RepositoryID("github.com/src-d/history")
+	logger := log.New(nil)
+	incremental := library.NewIncrementalFetch(&library.IncrementalOpts{
+		FS:      osfs.New(filepath.Join(dir, "lib")),
+		Commits: 4,
+	})
+	req.True(incremental.Applies(id, 0))
+
+	ctx := context.Background()
+	for i := 1; i <= 2; i++ {
+		_, _, err = fetchIncremental(
+			ctx, logger, incremental, id, endpoint, nil, nil,
+		)
+		req.True(ErrHistoryIncomplete.Is(err), "%v", err)
+
+		state, err := incremental.State(id, endpoint)
+		req.NoError(err)
+		req.Equal(i, state.Steps)
+		req.Equal(4*i, state.Depth)
+	}
+
+	repo, _, err := fetchIncremental(
+		ctx, logger, incremental, id, endpoint, nil, nil,
+	)
+	req.NoError(err)
+
+	head, err := headCommit(repo, id.String())
+	req.NoError(err)
+	commits, err := repo.Log(&git.LogOptions{From: head.Hash})
+	req.NoError(err)
+	var n int
+	req.NoError(commits.ForEach(func(*object.Commit) error {
+		n++
+		return nil
+	}))
+	req.Equal(10, n)
+
+	shallows, err := repo.Storer.Shallow()
+	req.NoError(err)
+	req.Empty(shallows)
+	closeStorer(repo)
+
+	req.NoError(incremental.Remove(id))
+	state, err := incremental.State(id, endpoint)
+	req.NoError(err)
+	req.Zero(state.Steps)
+	req.True(incremental.Applies(id, 0))
+
+	// by date window, in a single job with the budget
+	incremental = library.NewIncrementalFetch(&library.IncrementalOpts{
+		FS:      osfs.New(filepath.Join(dir, "window")),
+		MinSize: 1 << 20,
+		Window:  3 * 24 * time.Hour,
+		Budget:  time.Minute,
+	})
+	req.False(incremental.Applies(id, 1024))
+	req.True(incremental.Applies(id, 2<<20))
+
+	repo, _, err = fetchIncremental(
+		ctx, logger, incremental, id, endpoint, nil, nil,
+	)
+	req.NoError(err)
+	closeStorer(repo)
+
+	state, err = incremental.State(id, endpoint)
+	req.NoError(err)
+	req.True(state.Steps > 1)
+	req.NotNil(state.Since)
+}
@@ -6,9 +6,12 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/sandbox"
 	"github.com/src-d/gitcollector/updater"
 
 	"github.com/src-d/go-borges"
@@ -17,7 +20,7 @@ import (
 	"gopkg.in/src-d/go-billy.v4/util"
 	"gopkg.in/src-d/go-errors.v1"
 	"gopkg.in/src-d/go-git.v4"
-	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-log.v1"
 )
 
@@ -28,6 +31,10 @@ var (
 	// ErrRepoAlreadyExists is returned if there is an attempt to
 	// retrieve an already downloaded git repository.
 	ErrRepoAlreadyExists = errors.NewKind("%s already downloaded")
+
+	// ErrForkNotAdmitted is returned when a repository isn't added to its
+	// location because the location already holds too many forks.
+	ErrForkNotAdmitted = errors.NewKind("fork not admitted in location %s")
 )
 
 // Download is a library.JobFn function to download a git repository and store
@@ -53,7 +60,7 @@ func Download(ctx context.Context, job *library.Job) error {
 	endpoint := job.Endpoints[0]
 	logger = logger.New(log.Fields{"url": endpoint})
 
-	repoID, err := library.NewRepositoryID(endpoint)
+	repoID, err := job.RepositoryID(endpoint)
 	if err != nil {
 		logger.Errorf(err, "wrong repository endpoint %s", endpoint)
 		return err
@@ -61,7 +68,7 @@ func Download(ctx context.Context, job *library.Job) error {
 
 	ok, locID, err := libHas(ctx, lib, repoID)
 	if err != nil {
-		logger.Errorf(err, "failed")
+		logger.With(library.ErrorFields(err)).Errorf(err, "failed")
 		return err
 	}
 
@@ -69,6 +76,7 @@ func Download(ctx context.Context, job *library.Job) error {
 		if job.AllowUpdate {
 			job.Type = library.JobUpdate
 			job.LocationID = locID
+			job.WritesTo(locID)
 			return updater.Update(ctx, job)
 		}
 
@@ -79,19 +87,62 @@ func Download(ctx context.Context, job *library.Job) error {
 
 	logger.Infof("started")
 	start := time.Now()
-	if err := downloadRepository(
+	job.Transfer = &library.Transfer{}
+	locID, err = downloadRepository(
 		ctx,
 		logger,
 		lib,
 		job.TempFS,
 		repoID,
 		endpoint,
-		job.AuthToken,
-	); err != nil {
-		logger.Errorf(err, "failed")
+		job.FetchAuth,
+		job.Storage,
+		job.Transfer,
+		job.Sandbox,
+		job.Forks,
+		job.Merger,
+		job.Remotes,
+		job.PullRequests,
+		job.Annotations,
+		job.Incremental,
+		job.SizeHint,
+		job.Sharing,
+		func(root string) (borges.LocationID, error) {
+			return job.LocationIDFor(job.LocationKey(repoID, root))
+		},
+		job.WritesTo,
+	)
+	if err != nil {
+		if ErrHistoryIncomplete.Is(err) {
+			logger.Infof("history partially fetched, " +
+				"resumed by the next job of the repository")
+			return nil
+		}
+
+		if ErrForkNotAdmitted.Is(err) {
+			logger.With(log.Fields{"location": locID}).
+				Infof("skipped, too many forks in the location")
+			job.LocationID = locID
+			return nil
+		}
+
+		if library.ErrLocationNoUpdate.Is(err) {
+			logger.With(log.Fields{"location": locID}).
+				Infof("skipped, location marked as do-not-update")
+			job.LocationID = locID
+			return nil
+		}
+
+		if library.ErrLocationRemotes.Is(err) {
+			job.LocationID = locID
+		}
+
+		logger.With(library.ErrorFields(err)).Errorf(err, "failed")
 		return err
 	}
 
+	job.LocationID = locID
+
 	elapsed := time.Since(start).String()
 	logger.With(log.Fields{"elapsed": elapsed}).Infof("finished")
 	return nil
@@ -131,28 +182,76 @@ func downloadRepository(
 	tmp billy.Filesystem,
 	id borges.RepositoryID,
 	endpoint string,
-	authToken library.AuthTokenFn,
-) error {
+	fetchAuth library.AuthFn,
+	storage *library.StorageOpts,
+	transfer *library.Transfer,
+	sb *sandbox.Sandbox,
+	forks *library.ForkSampler,
+	merger *library.LocationMerger,
+	remotes library.RemotesPolicy,
+	prs library.PullRequestRefs,
+	annotations *library.Annotations,
+	incremental *library.IncrementalFetch,
+	sizeHint uint64,
+	sharing *library.ObjectSharing,
+	locationID func(root string) (borges.LocationID, error),
+	onLocation func(borges.LocationID),
+) (_ borges.LocationID, err error) {
 	clonePath := filepath.Join(
 		cloneRootPath,
 		fmt.Sprintf("%s_%d", id, time.Now().UnixNano()),
 	)
 
-	token := authToken(endpoint)
+	auth, err := fetchAuth(ctx, endpoint)
+	if err != nil {
+		return "", err
+	}
 
 	start := time.Now()
-	repo, err := cloneRepo(
-		ctx, tmp, clonePath, endpoint, id.String(), token,
-	)
+	var repo *git.Repository
+	partial := incremental.Applies(id, sizeHint)
+	if partial {
+		repo, clonePath, err = fetchIncremental(
+			ctx, logger, incremental, id, endpoint, auth, storage,
+		)
+		tmp = incremental.FS()
+	} else if sb != nil {
+		repo, err = cloneInSandbox(
+			ctx, sb, tmp, clonePath, endpoint, id.String(), auth, storage,
+		)
+	} else {
+		repo, err = cloneRepo(
+			ctx, tmp, clonePath, endpoint, id.String(), auth, storage,
+			transfer,
+		)
+	}
 
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	elapsed := time.Since(start).String()
 	logger.With(log.Fields{"elapsed": elapsed}).Debugf("cloned")
 
 	defer func() {
+		if c, ok := repo.Storer.(io.Closer); ok {
+			c.Close()
+		}
+
+		// the partial clones are kept until the repository is stored,
+		// so a failed Job doesn't fetch the whole history again.
+		if partial {
+			if err == nil || ErrForkNotAdmitted.Is(err) ||
+				library.ErrLocationNoUpdate.Is(err) ||
+				library.ErrLocationRemotes.Is(err) {
+				if err := incremental.Remove(id); err != nil {
+					logger.Warningf("couldn't remove %s", clonePath)
+				}
+			}
+
+			return
+		}
+
 		if err := util.RemoveAll(tmp, clonePath); err != nil {
 			logger.Warningf("couldn't remove %s", clonePath)
 		}
@@ -160,7 +259,7 @@ func downloadRepository(
 
 	commit, err := headCommit(repo, id.String())
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	logger.With(log.Fields{
@@ -170,7 +269,7 @@ func downloadRepository(
 	start = time.Now()
 	root, err := rootCommit(repo, commit)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	elapsed = time.Since(start).String()
@@ -179,11 +278,75 @@ func downloadRepository(
 		"root":    root.Hash.String(),
 	}).Debugf("root commit found")
 
-	var (
-		locID = borges.LocationID(root.Hash.String())
-		r     borges.Repository
+	locID, err := locationID(root.Hash.String())
+	if err != nil {
+		return "", err
+	}
+
+	if annotations.NoUpdate(locID) {
+		return locID, library.ErrLocationNoUpdate.New(locID)
+	}
+
+	pool, err := sharing.Pool(root.Hash.String())
+	if err != nil {
+		return locID, err
+	}
+
+	onLocation(locID)
+	if merger == nil {
+		return locID, storeRepository(
+			ctx, logger, lib, locID, id, endpoint, tmp, clonePath,
+			fetchAuth, transfer, forks, remotes, prs, pool, nil,
+		)
+	}
+
+	write, err := merger.Claim(ctx, lib.ID(), locID, &library.MergedRemote{
+		ID:           id,
+		Endpoint:     endpoint,
+		Auth:         fetchAuth,
+		PullRequests: prs,
+	})
+	if err != nil {
+		return locID, err
+	}
+
+	if write == nil {
+		logger.With(log.Fields{"location": locID}).
+			Debugf("merged into the write of another job")
+		return locID, nil
+	}
+
+	err = storeRepository(
+		ctx, logger, lib, locID, id, endpoint, tmp, clonePath,
+		fetchAuth, transfer, forks, remotes, prs, pool, write,
 	)
 
+	write.Done(err)
+	return locID, err
+}
+
+// storeRepository adds the cloned repository to its location and fetches it.
+// The repositories merged into the write, if any, are fetched too before
+// committing the location. The objects are stored in the ObjectPool instead,
+// if there's one.
+func storeRepository(
+	ctx context.Context,
+	logger log.Logger,
+	lib *siva.Library,
+	locID borges.LocationID,
+	id borges.RepositoryID,
+	endpoint string,
+	tmp billy.Filesystem,
+	clonePath string,
+	fetchAuth library.AuthFn,
+	transfer *library.Transfer,
+	forks *library.ForkSampler,
+	remotes library.RemotesPolicy,
+	prs library.PullRequestRefs,
+	pool *library.ObjectPool,
+	write *library.LocationWrite,
+) error {
+	var r borges.Repository
 	loc, err := lib.AddLocation(locID)
 	if err != nil {
 		if !siva.ErrLocationExists.Is(err) {
@@ -202,20 +365,40 @@ func downloadRepository(
 				return err
 			}
 		}
+
+		err = applyRemotesPolicy(logger, r, id, locID, remotes)
+		if err == nil {
+			err = admitFork(logger, r, locID, forks)
+		}
+
+		if err != nil {
+			if err := r.Close(); err != nil {
+				logger.Warningf("couldn't close repository")
+			}
+
+			return err
+		}
 	}
 
 	if r == nil {
-		start = time.Now()
-		r, err = createRootedRepo(ctx, loc, id, tmp, clonePath)
+		start := time.Now()
+		if pool == nil {
+			r, err = createRootedRepo(ctx, loc, id, tmp, clonePath)
+		} else {
+			r, err = createSharedRepo(ctx, loc, id, tmp, clonePath, pool)
+		}
+
 		if err != nil {
 			return err
 		}
 
-		elapsed = time.Since(start).String()
+		elapsed := time.Since(start).String()
 		logger.With(log.Fields{"elapsed": elapsed}).Debugf("copied")
 	}
 
-	if _, err := createRemote(r.R(), id.String(), endpoint); err != nil {
+	if err := fetchRemote(
+		ctx, logger, r, id, endpoint, fetchAuth, prs, pool, transfer,
+	); err != nil {
 		if err := r.Close(); err != nil {
 			logger.Warningf("couldn't close repository")
 		}
@@ -223,38 +406,241 @@ func downloadRepository(
 		return err
 	}
 
-	opts := &git.FetchOptions{
-		RemoteName: id.String(),
+	if write != nil {
+		mergeRemotes(ctx, logger, r, id, locID, forks, pool, write)
 	}
 
-	if token != "" {
-		opts.Auth = &http.BasicAuth{
-			Username: "gitcollector",
-			Password: token,
+	if pool != nil {
+		if err := pool.Link(r); err != nil {
+			if err := r.Close(); err != nil {
+				logger.Warningf("couldn't close repository")
+			}
+
+			return err
 		}
 	}
 
-	start = time.Now()
-	if err := r.R().FetchContext(
+	start := time.Now()
+	if err := r.Commit(); err != nil {
+		return err
+	}
+
+	elapsed := time.Since(start).String()
+	logger.With(log.Fields{"elapsed": elapsed}).Debugf("commited")
+	return nil
+}
+
+// fetchRemote creates the remote of the repository with the refspecs of the
+// given PullRequestRefs and fetches it, counting the packfiles in the transfer
+// if any. The objects are fetched into the ObjectPool if it isn't nil.
+func fetchRemote(
+	ctx context.Context,
+	logger log.Logger,
+	r borges.Repository,
+	id borges.RepositoryID,
+	endpoint string,
+	fetchAuth library.AuthFn,
+	prs library.PullRequestRefs,
+	pool *library.ObjectPool,
+	transfer *library.Transfer,
+) error {
+	remote, err := createRemote(r.R(), id.String(), endpoint, prs)
+	if err != nil {
+		return err
+	}
+
+	// the credentials are requested again, they could be short lived.
+	auth, err := fetchAuth(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+
+	opts := &git.FetchOptions{
+		RemoteName: id.String(),
+		Auth:       auth,
+	}
+
+	start := time.Now()
+	sto := transfer.Storer(pool.FetchStorer(r.R().Storer))
+	if err := git.NewRemote(sto, remote.Config()).FetchContext(
 		ctx, opts,
 	); err != nil && err != git.NoErrAlreadyUpToDate {
-		if err := r.Close(); err != nil {
-			logger.Warningf("couldn't close repository")
+		return err
+	}
+
+	elapsed := time.Since(start).String()
+	logger.With(log.Fields{"elapsed": elapsed}).Debugf("fetched")
+	return nil
+}
+
+// mergeRemotes fetches the repositories merged into the write of the location
+// until there are no more of them. The failures are reported to their Jobs.
+func mergeRemotes(
+	ctx context.Context,
+	logger log.Logger,
+	r borges.Repository,
+	id borges.RepositoryID,
+	locID borges.LocationID,
+	forks *library.ForkSampler,
+	pool *library.ObjectPool,
+	write *library.LocationWrite,
+) {
+	for merged := write.Pending(); len(merged) > 0; merged = write.Pending() {
+		for _, m := range merged {
+			// the same repository found through another endpoint.
+			if m.ID == id {
+				continue
+			}
+
+			logger := logger.New(log.Fields{"merged": m.Endpoint})
+			if err := admitFork(logger, r, locID, forks); err != nil {
+				m.Fail(err)
+				continue
+			}
+
+			err := fetchRemote(
+				ctx, logger, r, m.ID, m.Endpoint, m.Auth,
+				m.PullRequests, pool, nil,
+			)
+			if err != nil {
+				logger.Warningf("couldn't merge repository: %s", err)
+				if err := removeRemote(r.R(), m.ID.String()); err != nil {
+					logger.Warningf("couldn't remove remote")
+				}
+
+				m.Fail(err)
+				continue
+			}
+
+			logger.Debugf("repository merged")
 		}
+	}
+}
 
+// applyRemotesPolicy checks the remotes other than the one of the repository
+// already held by the location, removing them or failing depending on the
+// RemotesPolicy.
+func applyRemotesPolicy(
+	logger log.Logger,
+	r borges.Repository,
+	id borges.RepositoryID,
+	locID borges.LocationID,
+	policy library.RemotesPolicy,
+) error {
+	if policy == "" || policy == library.RemotesAdd {
+		return nil
+	}
+
+	cfg, err := r.R().Config()
+	if err != nil {
 		return err
 	}
 
-	elapsed = time.Since(start).String()
-	logger.With(log.Fields{"elapsed": elapsed}).Debugf("fetched")
+	var others []string
+	for name := range cfg.Remotes {
+		if name != id.String() {
+			others = append(others, name)
+		}
+	}
 
-	start = time.Now()
-	if err := r.Commit(); err != nil {
+	if len(others) == 0 {
+		return nil
+	}
+
+	sort.Strings(others)
+	switch policy {
+	case library.RemotesFail:
+		return library.ErrLocationRemotes.New(
+			locID, strings.Join(others, ", "))
+	case library.RemotesReplace:
+		for _, name := range others {
+			if err := removeRemote(r.R(), name); err != nil {
+				return err
+			}
+		}
+
+		logger.With(log.Fields{"replaced": len(others)}).
+			Debugf("remotes of the location replaced")
+		return nil
+	default:
+		return library.ErrUnknownRemotesPolicy.New(policy)
+	}
+}
+
+func admitFork(
+	logger log.Logger,
+	r borges.Repository,
+	locID borges.LocationID,
+	forks *library.ForkSampler,
+) error {
+	if forks == nil {
+		return nil
+	}
+
+	cfg, err := r.R().Config()
+	if err != nil {
 		return err
 	}
 
-	elapsed = time.Since(start).String()
-	logger.With(log.Fields{"elapsed": elapsed}).Debugf("commited")
+	remotes := make([]string, 0, len(cfg.Remotes))
+	for name := range cfg.Remotes {
+		remotes = append(remotes, name)
+	}
+
+	ok, evict := forks.Admit(locID, remotes)
+	if !ok {
+		return ErrForkNotAdmitted.New(locID)
+	}
+
+	if evict == "" {
+		return nil
+	}
+
+	if err := removeRemote(r.R(), evict); err != nil {
+		return err
+	}
+
+	if err := forks.Evicted(locID, evict); err != nil {
+		logger.Warningf("couldn't record the evicted fork: %s", err)
+	}
+
+	logger.With(log.Fields{"evicted": evict}).
+		Debugf("fork replaced in the location")
+	return nil
+}
+
+// removeRemote deletes the remote and its references. The objects only
+// reachable from them are kept until the location is repacked.
+func removeRemote(repo *git.Repository, name string) error {
+	if err := repo.DeleteRemote(name); err != nil {
+		return err
+	}
+
+	refs, err := repo.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	prefix := "refs/remotes/" + name + "/"
+	var names []plumbing.ReferenceName
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if strings.HasPrefix(ref.Name().String(), prefix) {
+			names = append(names, ref.Name())
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, n := range names {
+		if err := repo.Storer.RemoveReference(n); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -291,6 +677,63 @@ func createRootedRepo(
 	return repo, err
 }
 
+// createSharedRepo initializes the repository in the location and copies the
+// cloned repository into it but its objects, which are added to the
+// ObjectPool instead.
+func createSharedRepo(
+	ctx context.Context,
+	loc borges.Location,
+	repoID borges.RepositoryID,
+	clonedFS billy.Filesystem,
+	clonedPath string,
+	pool *library.ObjectPool,
+) (borges.Repository, error) {
+	cloned, err := clonedFS.Chroot(clonedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := loc.Init(repoID)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err = pool.Add(cloned); err != nil {
+			return
+		}
+
+		var files []os.FileInfo
+		files, err = cloned.ReadDir("/")
+		for _, file := range files {
+			if err != nil {
+				return
+			}
+
+			if file.Name() == "objects" {
+				continue
+			}
+
+			err = recursiveCopy(
+				file.Name(), repo.FS(),
+				file.Name(), cloned,
+			)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		repo.Close()
+		repo = nil
+	}
+
+	return repo, err
+}
+
 func recursiveCopy(
 	dst string,
 	dstFS billy.Filesystem,
@@ -8,11 +8,17 @@ import (
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/simulation"
 	"github.com/src-d/go-borges"
 	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-billy.v4/memfs"
 	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"gopkg.in/src-d/go-log.v1"
 
 	"github.com/stretchr/testify/require"
@@ -157,3 +163,234 @@ func TestDownload(t *testing.T) {
 		})
 	}
 }
+
+func TestDownloadMergeLocation(t *testing.T) {
+	var require = require.New(t)
+
+	// every repository but the first one is a fork, so all of them are
+	// stored in the same location at the same time.
+	sim := simulation.New(&simulation.Opts{
+		Repos:   6,
+		Seed:    3,
+		Forks:   1,
+		Latency: 10 * time.Millisecond,
+	})
+	sim.Install()
+	defer simulation.Uninstall()
+
+	lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+	})
+	require.NoError(err)
+
+	var (
+		merger = library.NewLocationMerger()
+		wg     sync.WaitGroup
+		errs   = make(chan error, len(sim.Repositories()))
+	)
+
+	for _, r := range sim.Repositories() {
+		job := &library.Job{
+			Lib:       lib,
+			Type:      library.JobDownload,
+			Endpoints: []string{r.Endpoint()},
+			TempFS:    memfs.New(),
+			AuthToken: func(string) string { return "" },
+			Logger:    log.New(nil),
+			Merger:    merger,
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- Download(context.Background(), job)
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(err)
+	}
+
+	var locID borges.LocationID
+	for _, r := range sim.Repositories() {
+		id, err := library.NewRepositoryID(r.Endpoint())
+		require.NoError(err)
+
+		ok, _, loc, err := lib.Has(id)
+		require.NoError(err)
+		require.True(ok, r.FullName())
+
+		if locID == "" {
+			locID = loc
+		}
+
+		require.Equal(locID, loc)
+	}
+}
+
+func TestDownloadSharedObjects(t *testing.T) {
+	var require = require.New(t)
+
+	// every repository but the first one is a fork, so all of them share
+	// the pool of the first one.
+	sim := simulation.New(&simulation.Opts{Repos: 4, Seed: 3, Forks: 1})
+	sim.Install()
+	defer simulation.Uninstall()
+
+	fs := memfs.New()
+	lib, err := siva.NewLibrary("test", fs, siva.LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+	})
+	require.NoError(err)
+
+	sharing := library.NewObjectSharing(fs, 2)
+	download := func(endpoint string) *library.Job {
+		job := &library.Job{
+			Lib:         lib,
+			Type:        library.JobDownload,
+			Endpoints:   []string{endpoint},
+			TempFS:      memfs.New(),
+			AllowUpdate: true,
+			AuthToken:   func(string) string { return "" },
+			Logger:      log.New(nil),
+		}
+
+		require.NoError(library.WithNonRooted(sharing)(job))
+		require.NoError(Download(context.Background(), job), endpoint)
+		return job
+	}
+
+	locations := make(map[borges.LocationID]bool)
+	for _, r := range sim.Repositories() {
+		job := download(r.Endpoint())
+		require.False(locations[job.LocationID], r.FullName())
+		locations[job.LocationID] = true
+	}
+
+	pools, err := fs.ReadDir(library.ObjectPoolsDir)
+	require.NoError(err)
+	require.Len(pools, 1)
+
+	for _, r := range sim.Repositories() {
+		// the second download of every repository updates it.
+		download(r.Endpoint())
+
+		id, err := library.NewRepositoryID(r.Endpoint())
+		require.NoError(err)
+
+		ok, _, locID, err := lib.Has(id)
+		require.NoError(err)
+		require.True(ok, r.FullName())
+
+		loc, err := lib.Location(locID)
+		require.NoError(err)
+
+		repo, err := loc.Get(id, borges.ReadOnlyMode)
+		require.NoError(err)
+
+		packs, err := repo.FS().ReadDir("objects/pack")
+		if err == nil {
+			require.Empty(packs, r.FullName())
+		}
+
+		_, err = (*library.ObjectSharing)(nil).Linked(repo)
+		require.True(library.ErrObjectPoolRequired.Is(err))
+
+		pool, err := sharing.Linked(repo)
+		require.NoError(err)
+		require.NotNil(pool)
+
+		gr, err := pool.Open(repo)
+		require.NoError(err)
+
+		ref, err := gr.Reference(plumbing.ReferenceName(
+			"refs/remotes/"+id.String()+"/HEAD"), true)
+		require.NoError(err, r.FullName())
+
+		commits, err := gr.Log(&git.LogOptions{From: ref.Hash()})
+		require.NoError(err)
+
+		var n int
+		require.NoError(commits.ForEach(func(c *object.Commit) error {
+			files, err := c.Files()
+			if err == nil {
+				err = files.ForEach(func(*object.File) error {
+					n++
+					return nil
+				})
+			}
+
+			return err
+		}))
+		require.NotZero(n, r.FullName())
+		require.NoError(repo.Close())
+	}
+}
+
+func TestDownloadRemotesPolicy(t *testing.T) {
+	// every repository but the first one is a fork, so all of them are
+	// stored in the location of the first one.
+	sim := simulation.New(&simulation.Opts{Repos: 3, Seed: 3, Forks: 1})
+	sim.Install()
+	defer simulation.Uninstall()
+
+	repos := sim.Repositories()
+	for _, policy := range []library.RemotesPolicy{
+		library.RemotesAdd,
+		library.RemotesReplace,
+		library.RemotesFail,
+	} {
+		t.Run(string(policy), func(t *testing.T) {
+			var require = require.New(t)
+
+			lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+				Bucket:        2,
+				Transactional: true,
+			})
+			require.NoError(err)
+
+			for i, r := range repos {
+				err := Download(context.Background(), &library.Job{
+					Lib:       lib,
+					Type:      library.JobDownload,
+					Endpoints: []string{r.Endpoint()},
+					TempFS:    memfs.New(),
+					AuthToken: func(string) string { return "" },
+					Logger:    log.New(nil),
+					Remotes:   policy,
+				})
+
+				if policy == library.RemotesFail && i > 0 {
+					require.True(library.ErrLocationRemotes.Is(err), r.FullName())
+					continue
+				}
+
+				require.NoError(err, r.FullName())
+			}
+
+			for i, r := range repos {
+				id, err := library.NewRepositoryID(r.Endpoint())
+				require.NoError(err)
+
+				ok, _, _, err := lib.Has(id)
+				require.NoError(err)
+
+				var expected bool
+				switch policy {
+				case library.RemotesAdd:
+					expected = true
+				case library.RemotesReplace:
+					expected = i == len(repos)-1
+				case library.RemotesFail:
+					expected = i == 0
+				}
+
+				require.Equal(expected, ok, r.FullName())
+			}
+		})
+	}
+}
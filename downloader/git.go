@@ -4,16 +4,15 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/src-d/gitcollector/library"
 	"gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-billy.v4/util"
 	"gopkg.in/src-d/go-errors.v1"
 	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
-	"gopkg.in/src-d/go-git.v4/plumbing/cache"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
-	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
-	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
 )
 
 var (
@@ -24,31 +23,54 @@ var (
 )
 
 const (
-	cloneRootPath   = "local_repos"
-	fetchHEADStr    = "+HEAD:refs/remotes/%s/HEAD"
-	fetchRefSpecStr = "+refs/*:refs/remotes/%s/*"
+	cloneRootPath = "local_repos"
+	fetchHEADStr  = "+HEAD:refs/remotes/%s/HEAD"
 )
 
 func cloneRepo(
 	ctx context.Context,
 	fs billy.Filesystem,
-	path, endpoint, id, token string,
+	path, endpoint, id string,
+	auth transport.AuthMethod,
+	storage *library.StorageOpts,
+	transfer *library.Transfer,
 ) (*git.Repository, error) {
 	repoFS, err := fs.Chroot(path)
 	if err != nil {
 		return nil, err
 	}
 
-	sto := filesystem.NewStorage(repoFS, cache.NewObjectLRUDefault())
-	repo, err := git.Init(sto, nil)
+	repo, err := fetchRepo(
+		ctx, repoFS, endpoint, id, auth, storage, transfer,
+	)
 	if err != nil {
 		util.RemoveAll(fs, path)
 		return nil, err
 	}
 
-	remote, err := createRemote(repo, id, endpoint)
+	return repo, nil
+}
+
+// fetchRepo initializes a repository on the given filesystem and fetches the
+// HEAD of the endpoint into it, counting the packfile in the transfer if any.
+func fetchRepo(
+	ctx context.Context,
+	repoFS billy.Filesystem,
+	endpoint, id string,
+	auth transport.AuthMethod,
+	storage *library.StorageOpts,
+	transfer *library.Transfer,
+) (*git.Repository, error) {
+	sto := storage.NewStorage(repoFS)
+	repo, err := git.Init(sto, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the HEAD is fetched here, the refspecs of the pull requests are
+	// set once the repository is stored in its location.
+	remote, err := createRemote(repo, id, endpoint, "")
 	if err != nil {
-		util.RemoveAll(fs, path)
 		return nil, err
 	}
 
@@ -58,39 +80,33 @@ func cloneRepo(
 		},
 		Force: true,
 		Tags:  git.NoTags,
+		Auth:  auth,
 	}
 
-	if token != "" {
-		opts.Auth = &http.BasicAuth{
-			Username: "gitcollector",
-			Password: token,
-		}
-	}
-
+	remote = git.NewRemote(transfer.Storer(repo.Storer), remote.Config())
 	if err = remote.FetchContext(ctx, opts); err != nil {
-		util.RemoveAll(fs, path)
 		return nil, err
 	}
 
 	return repo, nil
 }
 
-func createRemote(r *git.Repository, id, endpoint string) (*git.Remote, error) {
+// createRemote creates or replaces the remote of the repository, fetching the
+// references of the pull requests as told by the given PullRequestRefs and
+// recording their mapping in the config.
+func createRemote(
+	r *git.Repository,
+	id, endpoint string,
+	prs library.PullRequestRefs,
+) (*git.Remote, error) {
 	rc := &config.RemoteConfig{
-		Name: id,
-		URLs: []string{endpoint},
-		Fetch: []config.RefSpec{
-			config.RefSpec(fmt.Sprintf(fetchHEADStr, id)),
-			config.RefSpec(fmt.Sprintf(fetchRefSpecStr, id)),
-		}}
-
-	remote, err := r.Remote(id)
-	if err != nil {
-		return r.CreateRemote(rc)
+		Name:  id,
+		URLs:  []string{endpoint},
+		Fetch: prs.RefSpecs(id),
 	}
 
-	if remote.Config() == rc {
-		return remote, nil
+	if err := rc.Validate(); err != nil {
+		return nil, err
 	}
 
 	cfg, err := r.Config()
@@ -99,6 +115,7 @@ func createRemote(r *git.Repository, id, endpoint string) (*git.Remote, error) {
 	}
 
 	cfg.Remotes[id] = rc
+	library.SetPullRequestMapping(cfg, id, prs)
 	if err := r.Storer.SetConfig(cfg); err != nil {
 		return nil, err
 	}
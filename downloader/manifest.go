@@ -0,0 +1,206 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// ErrNotGitHubEndpoint is returned when the manifests of a repository not
+// hosted in github are requested.
+var ErrNotGitHubEndpoint = errors.NewKind("not a github endpoint: %s")
+
+// DefaultManifests are the files fetched by default in manifest mode.
+var DefaultManifests = []string{"go.mod", "package.json", "LICENSE"}
+
+// ManifestOpts represents configuration options for the manifest mode.
+type ManifestOpts struct {
+	// Paths are the files fetched from the HEAD of every repository,
+	// default to DefaultManifests.
+	Paths []string
+	// FS is where the files are stored, under the repository ID of their
+	// repository.
+	FS billy.Filesystem
+	// HTTPTimeout is the timeout of the API requests, default to 30
+	// seconds.
+	HTTPTimeout time.Duration
+	// BaseURL overrides the github API URL.
+	BaseURL string
+	// RateLimiter limits the API requests, it can be the one used by the
+	// discovery to share the same budget.
+	RateLimiter *gitcollector.RateLimiter
+	// APIUsage counts the API requests as made by the ManifestsProvider.
+	APIUsage *gitcollector.APIUsage
+}
+
+// ManifestsProvider is the provider the API requests fetching the manifests
+// are counted for.
+const ManifestsProvider = "manifests"
+
+const manifestHTTPTimeout = 30 * time.Second
+
+// NewManifestJobFn builds a library.JobFn that only fetches some files, like
+// the dependency manifests, from the HEAD of the repositories using the github
+// API instead of cloning them. Missing files are skipped.
+func NewManifestJobFn(opts *ManifestOpts) (library.JobFn, error) {
+	if opts == nil {
+		opts = &ManifestOpts{}
+	}
+
+	if len(opts.Paths) == 0 {
+		opts.Paths = DefaultManifests
+	}
+
+	if opts.HTTPTimeout <= 0 {
+		opts.HTTPTimeout = manifestHTTPTimeout
+	}
+
+	var baseURL *url.URL
+	if opts.BaseURL != "" {
+		u, err := url.Parse(strings.TrimSuffix(opts.BaseURL, "/") + "/")
+		if err != nil {
+			return nil, err
+		}
+
+		baseURL = u
+	}
+
+	return func(ctx context.Context, job *library.Job) error {
+		logger := job.Logger.New(log.Fields{"job": "manifest", "id": job.ID})
+		if job.Type != library.JobDownload || len(job.Endpoints) == 0 {
+			err := ErrNotDownloadJob.New()
+			logger.Errorf(err, "wrong job")
+			return err
+		}
+
+		for _, endpoint := range job.Endpoints {
+			var token string
+			if job.AuthToken != nil {
+				token = job.AuthToken(endpoint)
+			}
+
+			client := manifestClient(
+				token, opts.HTTPTimeout, opts.APIUsage, ManifestsProvider,
+			)
+			if baseURL != nil {
+				client.BaseURL = baseURL
+			}
+
+			l := logger.New(log.Fields{"url": endpoint})
+			n, err := fetchManifests(ctx, client, job, endpoint, opts)
+			if err != nil {
+				l.Errorf(err, "failed")
+				return err
+			}
+
+			l.With(log.Fields{"files": n}).Infof("manifests fetched")
+		}
+
+		return nil
+	}, nil
+}
+
+func manifestClient(
+	token string,
+	timeout time.Duration,
+	usage *gitcollector.APIUsage,
+	provider string,
+) *github.Client {
+	client := &http.Client{}
+	if token != "" {
+		client = oauth2.NewClient(
+			context.Background(),
+			oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}),
+		)
+	}
+
+	client.Timeout = timeout
+	client.Transport = usage.Transport(provider, client.Transport)
+	return github.NewClient(client)
+}
+
+func fetchManifests(
+	ctx context.Context,
+	client *github.Client,
+	job *library.Job,
+	endpoint string,
+	opts *ManifestOpts,
+) (int, error) {
+	owner, name, err := githubRepository(endpoint)
+	if err != nil {
+		return 0, err
+	}
+
+	// the manifests are kept under the name the repository is stored with.
+	id, err := job.RepositoryID(endpoint)
+	if err != nil {
+		return 0, err
+	}
+
+	var fetched int
+	for _, p := range opts.Paths {
+		if err := opts.RateLimiter.Wait(ctx); err != nil {
+			return fetched, err
+		}
+
+		file, _, res, err := client.Repositories.GetContents(
+			ctx, owner, name, p, nil,
+		)
+		if err != nil {
+			if res != nil && res.StatusCode == http.StatusNotFound {
+				continue
+			}
+
+			return fetched, err
+		}
+
+		if file == nil {
+			// it's a directory
+			continue
+		}
+
+		content, err := file.GetContent()
+		if err != nil {
+			return fetched, err
+		}
+
+		dst := path.Join(id.String(), p)
+		err = util.WriteFile(opts.FS, dst, []byte(content), 0644)
+		if err != nil {
+			return fetched, err
+		}
+
+		fetched++
+	}
+
+	return fetched, nil
+}
+
+// githubRepository returns the owner and name of the repository of the
+// endpoint in github.
+func githubRepository(endpoint string) (string, string, error) {
+	id, err := library.NewRepositoryID(endpoint)
+	if err != nil {
+		return "", "", err
+	}
+
+	parts := strings.Split(id.String(), "/")
+	if len(parts) != 3 || parts[0] != "github.com" {
+		return "", "", ErrNotGitHubEndpoint.New(endpoint)
+	}
+
+	return parts[1], parts[2], nil
+}
@@ -0,0 +1,85 @@
+package downloader
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+func TestManifestJobFn(t *testing.T) {
+	var require = require.New(t)
+
+	files := map[string]string{
+		"/repos/src-d/gitcollector/contents/go.mod": "module foo\n",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			content, ok := files[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"message": "Not Found"}`))
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"type":     "file",
+				"encoding": "base64",
+				"content": base64.StdEncoding.EncodeToString(
+					[]byte(content)),
+			})
+		},
+	))
+	defer server.Close()
+
+	fs := memfs.New()
+	fn, err := NewManifestJobFn(&ManifestOpts{
+		Paths:   []string{"go.mod", "package.json"},
+		FS:      fs,
+		BaseURL: server.URL,
+	})
+	require.NoError(err)
+
+	job := &library.Job{
+		Type:      library.JobDownload,
+		Endpoints: []string{"https://github.com/src-d/gitcollector"},
+		Logger:    log.New(nil),
+	}
+
+	require.NoError(fn(context.Background(), job))
+
+	f, err := fs.Open("github.com/src-d/gitcollector/go.mod")
+	require.NoError(err)
+	data, err := ioutil.ReadAll(f)
+	require.NoError(err)
+	require.NoError(f.Close())
+	require.Equal("module foo\n", string(data))
+
+	_, err = fs.Stat("github.com/src-d/gitcollector/package.json")
+	require.Error(err)
+
+	// the files are kept under the name the repository is stored with
+	job.Naming, err = library.NewTemplateNameFn(library.NamingOrgName)
+	require.NoError(err)
+	require.NoError(fn(context.Background(), job))
+
+	_, err = fs.Stat("src-d/gitcollector/go.mod")
+	require.NoError(err)
+
+	job.Endpoints = []string{"https://gitlab.com/src-d/gitcollector"}
+	err = fn(context.Background(), job)
+	require.True(ErrNotGitHubEndpoint.Is(err))
+
+	job.Type = library.JobUpdate
+	err = fn(context.Background(), job)
+	require.True(ErrNotDownloadJob.Is(err))
+}
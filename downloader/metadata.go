@@ -0,0 +1,198 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// MetadataOpts represents configuration options for the metadata capture.
+type MetadataOpts struct {
+	// Store is where the metadata of the repositories is stored.
+	Store *library.MetadataStore
+	// Readme also captures the README of the repositories rendered to
+	// HTML, it costs an API request more for every repository.
+	Readme bool
+	// HTTPTimeout is the timeout of the API requests, default to 30
+	// seconds.
+	HTTPTimeout time.Duration
+	// BaseURL overrides the github API URL.
+	BaseURL string
+	// RateLimiter limits the API requests, it can be the one used by the
+	// discovery to share the same budget.
+	RateLimiter *gitcollector.RateLimiter
+	// APIUsage counts the API requests as made by the MetadataProvider.
+	APIUsage *gitcollector.APIUsage
+}
+
+// MetadataProvider is the provider the API requests capturing the metadata are
+// counted for.
+const MetadataProvider = "metadata"
+
+const readmeHTMLMediaType = "application/vnd.github.v3.html"
+
+// NewMetadataJobFn builds a library.JobFn capturing the description, topics
+// and, optionally, the rendered README of the github repositories once the
+// given JobFn downloads them. The metadata is optional, failing to capture it
+// is logged but doesn't fail the Job.
+func NewMetadataJobFn(
+	opts *MetadataOpts,
+	fn library.JobFn,
+) (library.JobFn, error) {
+	if opts == nil {
+		opts = &MetadataOpts{}
+	}
+
+	if opts.HTTPTimeout <= 0 {
+		opts.HTTPTimeout = manifestHTTPTimeout
+	}
+
+	var baseURL *url.URL
+	if opts.BaseURL != "" {
+		u, err := url.Parse(strings.TrimSuffix(opts.BaseURL, "/") + "/")
+		if err != nil {
+			return nil, err
+		}
+
+		baseURL = u
+	}
+
+	return func(ctx context.Context, job *library.Job) error {
+		if err := fn(ctx, job); err != nil {
+			return err
+		}
+
+		if job.Type != library.JobDownload {
+			return nil
+		}
+
+		logger := job.Logger.New(log.Fields{"job": "metadata", "id": job.ID})
+		for _, endpoint := range job.Endpoints {
+			var token string
+			if job.AuthToken != nil {
+				token = job.AuthToken(endpoint)
+			}
+
+			client := manifestClient(
+				token, opts.HTTPTimeout, opts.APIUsage, MetadataProvider,
+			)
+			if baseURL != nil {
+				client.BaseURL = baseURL
+			}
+
+			l := logger.New(log.Fields{"url": endpoint})
+			m, err := captureMetadata(ctx, client, job, endpoint, opts)
+			if err != nil {
+				if ErrNotGitHubEndpoint.Is(err) {
+					l.Debugf("metadata not captured: %s", err.Error())
+					continue
+				}
+
+				l.Warningf("couldn't capture metadata: %s", err.Error())
+				continue
+			}
+
+			if err := opts.Store.Set(m); err != nil {
+				l.Warningf("couldn't store metadata: %s", err.Error())
+				continue
+			}
+
+			l.Debugf("metadata captured")
+		}
+
+		return nil
+	}, nil
+}
+
+func captureMetadata(
+	ctx context.Context,
+	client *github.Client,
+	job *library.Job,
+	endpoint string,
+	opts *MetadataOpts,
+) (*library.RepositoryMetadata, error) {
+	owner, name, err := githubRepository(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// the metadata is stored along with the repository, so it's found
+	// by the ID given by the naming of the Job.
+	id, err := job.RepositoryID(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := opts.RateLimiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	repo, _, err := client.Repositories.Get(ctx, owner, name)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &library.RepositoryMetadata{
+		Repository:  id,
+		Endpoint:    endpoint,
+		Description: repo.GetDescription(),
+		Homepage:    repo.GetHomepage(),
+		Topics:      repo.Topics,
+		Language:    repo.GetLanguage(),
+	}
+
+	if opts.Readme {
+		html, err := fetchReadmeHTML(ctx, client, owner, name, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		m.ReadmeHTML = html
+	}
+
+	return m, nil
+}
+
+// fetchReadmeHTML returns the README of the repository rendered by github,
+// empty if it has none.
+func fetchReadmeHTML(
+	ctx context.Context,
+	client *github.Client,
+	owner, name string,
+	opts *MetadataOpts,
+) (string, error) {
+	if err := opts.RateLimiter.Wait(ctx); err != nil {
+		return "", err
+	}
+
+	req, err := client.NewRequest(
+		"GET", fmt.Sprintf("repos/%s/%s/readme", owner, name), nil,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Accept", readmeHTMLMediaType)
+
+	var buf bytes.Buffer
+	res, err := client.Do(ctx, req, &buf)
+	if err != nil {
+		if res != nil && res.StatusCode == http.StatusNotFound {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	return buf.String(), nil
+}
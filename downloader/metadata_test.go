@@ -0,0 +1,101 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/go-borges"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+func TestMetadataJobFn(t *testing.T) {
+	var require = require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/repos/src-d/gitcollector":
+				w.Write([]byte(`{
+					"description": "collector of git repositories",
+					"topics": ["git", "go"],
+					"language": "Go"
+				}`))
+			case "/repos/src-d/gitcollector/readme":
+				require.Equal(readmeHTMLMediaType, r.Header.Get("Accept"))
+				w.Write([]byte("<h1>gitcollector</h1>"))
+			case "/repos/src-d/empty":
+				w.Write([]byte(`{}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"message": "Not Found"}`))
+			}
+		},
+	))
+	defer server.Close()
+
+	var processed int
+	fn := func(context.Context, *library.Job) error {
+		processed++
+		return nil
+	}
+
+	store := library.NewMetadataStore(memfs.New())
+	metadataFn, err := NewMetadataJobFn(&MetadataOpts{
+		Store:   store,
+		Readme:  true,
+		BaseURL: server.URL,
+	}, fn)
+	require.NoError(err)
+
+	job := &library.Job{
+		Type: library.JobDownload,
+		Endpoints: []string{
+			"https://github.com/src-d/gitcollector",
+			"https://github.com/src-d/empty",
+			"https://github.com/src-d/missing",
+			"https://gitlab.com/src-d/gitcollector",
+		},
+		Logger: log.New(nil),
+	}
+
+	require.NoError(metadataFn(context.Background(), job))
+	require.Equal(1, processed)
+
+	m, err := store.Get("github.com/src-d/gitcollector")
+	require.NoError(err)
+	require.Equal("collector of git repositories", m.Description)
+	require.Equal([]string{"git", "go"}, m.Topics)
+	require.Equal("Go", m.Language)
+	require.Equal("<h1>gitcollector</h1>", m.ReadmeHTML)
+
+	// a repository without README is stored without it
+	m, err = store.Get("github.com/src-d/empty")
+	require.NoError(err)
+	require.NotNil(m)
+	require.Empty(m.ReadmeHTML)
+
+	for _, id := range []string{
+		"github.com/src-d/missing",
+		"gitlab.com/src-d/gitcollector",
+	} {
+		m, err = store.Get(borges.RepositoryID(id))
+		require.NoError(err)
+		require.Nil(m)
+	}
+
+	// failed jobs don't capture the metadata
+	failing, err := NewMetadataJobFn(&MetadataOpts{
+		Store:   store,
+		BaseURL: server.URL,
+	}, func(context.Context, *library.Job) error {
+		return fmt.Errorf("failed")
+	})
+	require.NoError(err)
+	require.Error(failing(context.Background(), job))
+}
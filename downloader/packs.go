@@ -0,0 +1,341 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/objstore"
+
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// ErrNoBucket is returned when the pack mode has no bucket to store the
+// packfiles in.
+var ErrNoBucket = errors.NewKind("no bucket to store the packfiles")
+
+// PackedRepositoryFile is the name of the object describing a repository
+// stored in pack mode, under its repository ID.
+const PackedRepositoryFile = "repository.json"
+
+// PackedRepository describes a repository stored in pack mode: the
+// references fetched the last time and the packfiles holding the objects
+// reachable from them, the oldest first.
+type PackedRepository struct {
+	Endpoint   string            `json:"endpoint"`
+	References map[string]string `json:"references"`
+	// Packfiles are the names of the packfiles, stored along with the
+	// PackedRepositoryFile.
+	Packfiles []string  `json:"packfiles"`
+	Updated   time.Time `json:"updated"`
+}
+
+// PackOpts represents configuration options for the pack mode.
+type PackOpts struct {
+	// Bucket is where the packfiles are stored, under the repository ID
+	// of their repository.
+	Bucket objstore.Bucket
+	// Prefix is prepended to the keys of the objects.
+	Prefix string
+	// Journal keeps the uploads of the failed jobs so their retries
+	// resume them, nil means they're started again.
+	Journal *objstore.Journal
+	// PartSize is the size of the parts the packfiles are uploaded in,
+	// the memory every job needs, default to objstore.DefaultPartSize.
+	PartSize int
+	// Retries is the number of times a failed request to the Bucket is
+	// retried, default to 3.
+	Retries int
+}
+
+// NewPackJobFn builds a library.JobFn that stores the packfiles fetched from
+// the repositories in a Bucket of object storage instead of a library. The
+// packfiles are streamed from the transport to the Bucket as they're
+// received, so they're never kept whole on disk or in memory. Every job only
+// fetches the objects missing since the packfiles stored by the previous one.
+func NewPackJobFn(opts *PackOpts) (library.JobFn, error) {
+	if opts == nil || opts.Bucket == nil {
+		return nil, ErrNoBucket.New()
+	}
+
+	return func(ctx context.Context, job *library.Job) error {
+		logger := job.Logger.New(log.Fields{"job": "packs", "id": job.ID})
+		if job.Type != library.JobDownload || len(job.Endpoints) == 0 {
+			err := ErrNotDownloadJob.New()
+			logger.Errorf(err, "wrong job")
+			return err
+		}
+
+		job.Transfer = &library.Transfer{}
+		for _, endpoint := range job.Endpoints {
+			l := logger.New(log.Fields{"url": endpoint})
+			start := time.Now()
+			key, err := storePackfile(ctx, job, endpoint, opts)
+			if err != nil {
+				l.Errorf(err, "failed")
+				return err
+			}
+
+			if key == "" {
+				l.Infof("up to date")
+				continue
+			}
+
+			l.With(log.Fields{
+				"key":     key,
+				"bytes":   job.Transfer.Bytes,
+				"elapsed": time.Since(start).String(),
+			}).Infof("packfile stored")
+		}
+
+		return nil
+	}, nil
+}
+
+// storePackfile stores the packfile with the objects of the endpoint missing
+// in the Bucket, returning its key, empty if there were none.
+func storePackfile(
+	ctx context.Context,
+	job *library.Job,
+	endpoint string,
+	opts *PackOpts,
+) (string, error) {
+	id, err := job.RepositoryID(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	dir := path.Join(opts.Prefix, id.String())
+	repo, err := loadPackedRepository(ctx, opts.Bucket, dir)
+	if err != nil {
+		return "", err
+	}
+
+	auth, err := job.FetchAuth(ctx, endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	ep, err := transport.NewEndpoint(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	c, err := client.NewClient(ep)
+	if err != nil {
+		return "", err
+	}
+
+	s, err := c.NewUploadPackSession(ep, auth)
+	if err != nil {
+		return "", err
+	}
+	defer s.Close()
+
+	ar, err := s.AdvertisedReferences()
+	if err != nil {
+		return "", err
+	}
+
+	refs, err := ar.AllReferences()
+	if err != nil {
+		return "", err
+	}
+
+	// the objects reachable from the stored references are in the stored
+	// packfiles.
+	stored := make(map[plumbing.Hash]bool, len(repo.References))
+	var haves []plumbing.Hash
+	for _, h := range repo.References {
+		hash := plumbing.NewHash(h)
+		if !stored[hash] {
+			stored[hash] = true
+			haves = append(haves, hash)
+		}
+	}
+
+	current := make(map[string]string, len(refs))
+	var wants []plumbing.Hash
+	for name, ref := range refs {
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+
+		current[name.String()] = ref.Hash().String()
+		if !stored[ref.Hash()] {
+			stored[ref.Hash()] = true
+			wants = append(wants, ref.Hash())
+		}
+	}
+
+	if len(wants) == 0 {
+		return "", updateReferences(
+			ctx, opts.Bucket, dir, repo, endpoint, current,
+		)
+	}
+
+	req := packp.NewUploadPackRequestFromCapabilities(ar.Capabilities)
+	// the packfiles are stored alone, they can't have deltas against
+	// objects they don't have.
+	req.Capabilities.Delete(capability.ThinPack)
+	if ar.Capabilities.Supports(capability.NoProgress) {
+		if err := req.Capabilities.Set(capability.NoProgress); err != nil {
+			return "", err
+		}
+	}
+
+	req.Wants = sortHashes(wants)
+	req.Haves = sortHashes(haves)
+
+	res, err := s.UploadPack(ctx, req)
+	if err == transport.ErrEmptyUploadPackRequest {
+		return "", updateReferences(
+			ctx, opts.Bucket, dir, repo, endpoint, current,
+		)
+	}
+
+	if err != nil {
+		return "", err
+	}
+	defer res.Close()
+
+	// the same request gets the same packfile, so its key is kept by the
+	// retries of a failed job resuming its upload.
+	name := packfileName(req)
+	key := path.Join(dir, name)
+	upload, err := objstore.NewUpload(ctx, opts.Bucket, key,
+		&objstore.UploadOpts{
+			PartSize: opts.PartSize,
+			Retries:  opts.Retries,
+			Journal:  opts.Journal,
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	w := job.Transfer.Writer(upload)
+	_, err = io.Copy(w, sidebandReader(req.Capabilities, res))
+	if err != nil {
+		return "", err
+	}
+
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	repo.Packfiles = appendPackfile(repo.Packfiles, name)
+	return key, updateReferences(
+		ctx, opts.Bucket, dir, repo, endpoint, current,
+	)
+}
+
+// loadPackedRepository returns the PackedRepository stored in the given
+// directory of the Bucket, an empty one if there's none.
+func loadPackedRepository(
+	ctx context.Context,
+	b objstore.Bucket,
+	dir string,
+) (*PackedRepository, error) {
+	rc, err := b.Get(ctx, path.Join(dir, PackedRepositoryFile))
+	if objstore.ErrObjectNotFound.Is(err) {
+		return &PackedRepository{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var repo PackedRepository
+	if err := json.NewDecoder(rc).Decode(&repo); err != nil {
+		return nil, err
+	}
+
+	return &repo, nil
+}
+
+// updateReferences stores the PackedRepository with the given endpoint and
+// references, unless it's already stored with them.
+func updateReferences(
+	ctx context.Context,
+	b objstore.Bucket,
+	dir string,
+	repo *PackedRepository,
+	endpoint string,
+	refs map[string]string,
+) error {
+	if !repo.Updated.IsZero() &&
+		repo.Endpoint == endpoint &&
+		sameReferences(repo.References, refs) {
+		return nil
+	}
+
+	repo.Endpoint = endpoint
+	repo.References = refs
+	repo.Updated = time.Now()
+	data, err := json.Marshal(repo)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(ctx, path.Join(dir, PackedRepositoryFile), data)
+}
+
+func sameReferences(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for name, h := range a {
+		if b[name] != h {
+			return false
+		}
+	}
+
+	return true
+}
+
+// packfileName names the packfile by the hash of the request fetching it.
+func packfileName(req *packp.UploadPackRequest) string {
+	h := sha1.New()
+	for _, want := range req.Wants {
+		h.Write([]byte("want " + want.String() + "\n"))
+	}
+
+	for _, have := range req.Haves {
+		h.Write([]byte("have " + have.String() + "\n"))
+	}
+
+	return "pack-" + hex.EncodeToString(h.Sum(nil)) + ".pack"
+}
+
+func appendPackfile(packfiles []string, name string) []string {
+	for _, p := range packfiles {
+		if p == name {
+			return packfiles
+		}
+	}
+
+	return append(packfiles, name)
+}
+
+func sortHashes(hashes []plumbing.Hash) []plumbing.Hash {
+	sort.Slice(hashes, func(i, j int) bool {
+		return hashes[i].String() < hashes[j].String()
+	})
+
+	return hashes
+}
@@ -0,0 +1,142 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/objstore"
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+	"gopkg.in/src-d/go-log.v1"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackJobFn(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	var req = require.New(t)
+	ctx := context.Background()
+
+	_, err := NewPackJobFn(nil)
+	req.True(ErrNoBucket.Is(err))
+
+	dir, err := ioutil.TempDir("", "gitcollector")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	endpoint := filepath.Join(dir, "remote")
+	historyRepo(t, endpoint, 10)
+
+	bucket := objstore.NewFSBucket(memfs.New())
+	journal := memfs.New()
+	fn, err := NewPackJobFn(&PackOpts{
+		Bucket:   bucket,
+		Prefix:   "packs",
+		Journal:  objstore.NewJournal(journal),
+		PartSize: 512,
+	})
+	req.NoError(err)
+
+	job := &library.Job{
+		Type:      library.JobDownload,
+		Endpoints: []string{endpoint},
+		Logger:    log.New(nil),
+		Naming: func(string) (borges.RepositoryID, error) {
+			return "foo/bar", nil
+		},
+	}
+
+	// a commit, a tree and a blob per commit.
+	req.NoError(fn(ctx, job))
+	req.Equal(1, job.Transfer.Packfiles)
+	req.Equal(uint64(30), job.Transfer.Objects)
+
+	repo := packedRepository(t, bucket)
+	req.Equal(endpoint, repo.Endpoint)
+	req.Len(repo.Packfiles, 1)
+	req.Len(repo.References, 1)
+
+	// the packfiles are uploaded in parts, leaving nothing to resume.
+	req.True(job.Transfer.Bytes > 512)
+	files, err := journal.ReadDir("")
+	req.NoError(err)
+	req.Len(files, 0)
+
+	// only the new objects are fetched.
+	remote, err := git.PlainOpen(endpoint)
+	req.NoError(err)
+	wt, err := remote.Worktree()
+	req.NoError(err)
+	for i := 0; i < 2; i++ {
+		_, err = wt.Commit("empty", &git.CommitOptions{
+			Author: &object.Signature{
+				Name: "a", Email: "a@a", When: time.Now(),
+			},
+		})
+		req.NoError(err)
+	}
+
+	req.NoError(fn(ctx, job))
+	req.Equal(1, job.Transfer.Packfiles)
+	req.Equal(uint64(2), job.Transfer.Objects)
+
+	repo = packedRepository(t, bucket)
+	req.Len(repo.Packfiles, 2)
+
+	// the packfiles hold the whole history.
+	sto := memory.NewStorage()
+	for _, name := range repo.Packfiles {
+		rc, err := bucket.Get(ctx, path.Join("packs/foo/bar", name))
+		req.NoError(err)
+		req.NoError(packfile.UpdateObjectStorage(sto, rc))
+		req.NoError(rc.Close())
+	}
+
+	head, err := remote.Head()
+	req.NoError(err)
+	req.Equal(head.Hash().String(), repo.References["refs/heads/master"])
+	commit, err := object.GetCommit(sto, head.Hash())
+	req.NoError(err)
+
+	var commits int
+	iter := object.NewCommitPreorderIter(commit, nil, nil)
+	req.NoError(iter.ForEach(func(*object.Commit) error {
+		commits++
+		return nil
+	}))
+	req.Equal(12, commits)
+
+	req.NoError(fn(ctx, job))
+	req.Equal(0, job.Transfer.Packfiles)
+	req.Len(packedRepository(t, bucket).Packfiles, 2)
+
+	job.Type = library.JobUpdate
+	req.True(ErrNotDownloadJob.Is(fn(ctx, job)))
+}
+
+func packedRepository(t *testing.T, b objstore.Bucket) *PackedRepository {
+	t.Helper()
+
+	rc, err := b.Get(context.Background(), "packs/foo/bar/"+PackedRepositoryFile)
+	require.NoError(t, err)
+	defer rc.Close()
+
+	var repo PackedRepository
+	require.NoError(t, json.NewDecoder(rc).Decode(&repo))
+	return &repo
+}
@@ -0,0 +1,149 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/gitcollector/sandbox"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+// ErrNotSandboxed is returned when a repository can't be cloned in the
+// sandbox, like the ones fetched over ssh.
+var ErrNotSandboxed = errors.NewKind("%s can't be cloned in the sandbox: %s")
+
+const cloneTask = "clone"
+
+func init() {
+	sandbox.Register(cloneTask, sandboxedClone,
+		transport.ErrRepositoryNotFound,
+		transport.ErrEmptyRemoteRepository,
+		transport.ErrAuthenticationRequired,
+		transport.ErrAuthorizationFailed,
+		transport.ErrInvalidAuthMethod,
+	)
+}
+
+// cloneArgs are the arguments of the clones run in the sandbox.
+type cloneArgs struct {
+	Endpoint string `json:"endpoint"`
+	ID       string `json:"id"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+func (a *cloneArgs) auth() transport.AuthMethod {
+	switch {
+	case a.Token != "":
+		return &http.TokenAuth{Token: a.Token}
+	case a.Username != "" || a.Password != "":
+		return &http.BasicAuth{Username: a.Username, Password: a.Password}
+	default:
+		return nil
+	}
+}
+
+// cloneInSandbox clones the repository as cloneRepo does, fetching it in a
+// sandboxed process. The repository is opened by this process once it's
+// fetched.
+func cloneInSandbox(
+	ctx context.Context,
+	sb *sandbox.Sandbox,
+	fs billy.Filesystem,
+	path, endpoint, id string,
+	auth transport.AuthMethod,
+	storage *library.StorageOpts,
+) (*git.Repository, error) {
+	ep, err := transport.NewEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if ep.Protocol != "http" && ep.Protocol != "https" {
+		return nil, ErrNotSandboxed.New(endpoint, ep.Protocol)
+	}
+
+	args := &cloneArgs{Endpoint: endpoint, ID: id}
+	switch a := auth.(type) {
+	case nil:
+	case *http.BasicAuth:
+		args.Username, args.Password = a.Username, a.Password
+	case *http.TokenAuth:
+		args.Token = a.Token
+	default:
+		return nil, ErrNotSandboxed.New(endpoint, auth.Name())
+	}
+
+	if err := fs.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+
+	// the process is restricted to the directory of the clone, the
+	// temporal filesystem must be in the host one.
+	root, err := filepath.Abs(fs.Join(fs.Root(), path))
+	if err == nil {
+		_, err = os.Stat(root)
+	}
+
+	if err == nil {
+		err = sb.Run(ctx, &sandbox.Task{
+			Name:  cloneTask,
+			Root:  root,
+			Args:  args,
+			Hosts: []string{ep.Host},
+		})
+	}
+
+	var repo *git.Repository
+	if err == nil {
+		var repoFS billy.Filesystem
+		repoFS, err = fs.Chroot(path)
+		if err == nil {
+			repo, err = git.Open(storage.NewStorage(repoFS), nil)
+		}
+	}
+
+	if err != nil {
+		util.RemoveAll(fs, path)
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// sandboxedClone is the sandbox.TaskFn fetching a repository into the root
+// of the sandboxed process.
+func sandboxedClone(
+	ctx context.Context,
+	root string,
+	data json.RawMessage,
+) error {
+	var args cloneArgs
+	if err := json.Unmarshal(data, &args); err != nil {
+		return err
+	}
+
+	repo, err := fetchRepo(
+		ctx, osfs.New(root), args.Endpoint, args.ID, args.auth(), nil, nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	if c, ok := repo.Storer.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/src-d/gitcollector/sandbox"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	sandbox.Init()
+	os.Exit(m.Run())
+}
+
+func TestCloneInSandbox(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sandbox only supported on linux")
+	}
+
+	out, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		t.Skip("git not found")
+	}
+
+	backend := filepath.Join(strings.TrimSpace(string(out)), "git-http-backend")
+	if _, err := os.Stat(backend); err != nil {
+		t.Skip("git http-backend not found")
+	}
+
+	var req = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	historyRepo(t, filepath.Join(dir, "remote"), 3)
+	server := httptest.NewServer(&cgi.Handler{
+		Path: backend,
+		Env:  []string{"GIT_PROJECT_ROOT=" + dir, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	defer server.Close()
+
+	sb, err := sandbox.New(&sandbox.Opts{Chroot: true, NoExec: true})
+	req.NoError(err)
+
+	temp := osfs.New(filepath.Join(dir, "temp"))
+	repo, err := cloneInSandbox(
+		context.Background(), sb, temp, "clone",
+		server.URL+"/remote", "remote", nil, nil,
+	)
+	req.NoError(err)
+
+	commit, err := headCommit(repo, "remote")
+	req.NoError(err)
+	_, err = rootCommit(repo, commit)
+	req.NoError(err)
+
+	// the errors of the clone are returned and the clone is removed
+	_, err = cloneInSandbox(
+		context.Background(), sb, temp, "missing",
+		server.URL+"/missing", "missing", nil, nil,
+	)
+	req.Equal(transport.ErrRepositoryNotFound, err)
+
+	_, err = temp.Stat("missing")
+	req.True(os.IsNotExist(err))
+
+	_, err = cloneInSandbox(
+		context.Background(), sb, temp, "ssh",
+		"git@github.com:src-d/gitcollector.git", "ssh", nil, nil,
+	)
+	req.True(ErrNotSandboxed.Is(err))
+}
@@ -0,0 +1,174 @@
+package gitcollector
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/idxfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+// ErrorClass is the category of the error a Job failed with.
+type ErrorClass string
+
+const (
+	// ErrorClassUnknown is used for errors that couldn't be classified.
+	ErrorClassUnknown ErrorClass = "unknown"
+	// ErrorClassCanceled is used when the job context was canceled.
+	ErrorClassCanceled ErrorClass = "canceled"
+	// ErrorClassTimeout is used when an operation timed out.
+	ErrorClassTimeout ErrorClass = "timeout"
+	// ErrorClassNetwork is used for connection and DNS failures.
+	ErrorClassNetwork ErrorClass = "network"
+	// ErrorClassAuth is used for authentication and authorization failures.
+	ErrorClassAuth ErrorClass = "auth"
+	// ErrorClassNotFound is used when the remote repository doesn't exist.
+	ErrorClassNotFound ErrorClass = "not_found"
+	// ErrorClassEmpty is used when the remote repository is empty.
+	ErrorClassEmpty ErrorClass = "empty"
+	// ErrorClassServer is used for 5xx responses from the remote.
+	ErrorClassServer ErrorClass = "server"
+	// ErrorClassStorage is used for local filesystem failures.
+	ErrorClassStorage ErrorClass = "storage"
+	// ErrorClassStorageFull is used when the local filesystem ran out of
+	// space or quota.
+	ErrorClassStorageFull ErrorClass = "storage_full"
+	// ErrorClassRateLimit is used when the remote or its API rejected the
+	// requests for exceeding their rate limit.
+	ErrorClassRateLimit ErrorClass = "rate_limit"
+	// ErrorClassCorrupt is used when the packfiles or indexes of a
+	// repository couldn't be decoded.
+	ErrorClassCorrupt ErrorClass = "corrupt"
+)
+
+// JobFailure holds the information about a failed processed Job.
+type JobFailure struct {
+	// Err is the error returned by the Job.
+	Err error
+	// Class is the category of Err.
+	Class ErrorClass
+	// Code is the stable code of Class.
+	Code ErrorCode
+	// Elapsed is the time spent processing the Job.
+	Elapsed time.Duration
+}
+
+// NewJobFailure builds a JobFailure classifying the given error.
+func NewJobFailure(err error, elapsed time.Duration) *JobFailure {
+	class := ClassifyError(err)
+	return &JobFailure{
+		Err:     err,
+		Class:   class,
+		Code:    class.Code(),
+		Elapsed: elapsed,
+	}
+}
+
+type causer interface {
+	Cause() error
+}
+
+// statusCoder is implemented by the errors of HTTP responses.
+type statusCoder interface {
+	StatusCode() int
+}
+
+// ClassifyError returns the ErrorClass for the given error. Errors wrapped
+// with gopkg.in/src-d/go-errors.v1 are unwrapped to find their cause.
+func ClassifyError(err error) ErrorClass {
+	for err != nil {
+		if class, ok := classify(err); ok {
+			return class
+		}
+
+		c, ok := err.(causer)
+		if !ok {
+			break
+		}
+
+		err = c.Cause()
+	}
+
+	return ErrorClassUnknown
+}
+
+func classify(err error) (ErrorClass, bool) {
+	if ErrJobTimeout.Is(err) {
+		return ErrorClassTimeout, true
+	}
+
+	switch err {
+	case context.Canceled:
+		return ErrorClassCanceled, true
+	case context.DeadlineExceeded:
+		return ErrorClassTimeout, true
+	case transport.ErrAuthenticationRequired,
+		transport.ErrAuthorizationFailed,
+		transport.ErrInvalidAuthMethod:
+		return ErrorClassAuth, true
+	case transport.ErrRepositoryNotFound:
+		return ErrorClassNotFound, true
+	case transport.ErrEmptyRemoteRepository:
+		return ErrorClassEmpty, true
+	case idxfile.ErrMalformedIdxFile,
+		packfile.ErrInvalidDelta,
+		packfile.ErrDeltaCmd,
+		packfile.ErrReferenceDeltaNotFound:
+		return ErrorClassCorrupt, true
+	}
+
+	switch e := err.(type) {
+	case *github.RateLimitError, *github.AbuseRateLimitError:
+		return ErrorClassRateLimit, true
+	case *packfile.Error:
+		return ErrorClassCorrupt, true
+	case *http.Err:
+		if e.Response != nil {
+			return statusClass(e.StatusCode())
+		}
+	case statusCoder:
+		return statusClass(e.StatusCode())
+	case net.Error:
+		if e.Timeout() {
+			return ErrorClassTimeout, true
+		}
+
+		return ErrorClassNetwork, true
+	case *os.PathError:
+		return storageClass(e.Err), true
+	case *os.LinkError:
+		return storageClass(e.Err), true
+	}
+
+	if strings.Contains(err.Error(), "no space left on device") {
+		return ErrorClassStorageFull, true
+	}
+
+	return "", false
+}
+
+func statusClass(code int) (ErrorClass, bool) {
+	switch {
+	case code == 429:
+		return ErrorClassRateLimit, true
+	case code >= 500:
+		return ErrorClassServer, true
+	default:
+		return "", false
+	}
+}
+
+func storageClass(err error) ErrorClass {
+	if err == syscall.ENOSPC || err == syscall.EDQUOT {
+		return ErrorClassStorageFull
+	}
+
+	return ErrorClassStorage
+}
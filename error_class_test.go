@@ -0,0 +1,57 @@
+package gitcollector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/idxfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+func TestClassifyError(t *testing.T) {
+	kind := errors.NewKind("wrapped")
+	tests := []struct {
+		err   error
+		class ErrorClass
+	}{
+		{context.Canceled, ErrorClassCanceled},
+		{context.DeadlineExceeded, ErrorClassTimeout},
+		{transport.ErrAuthenticationRequired, ErrorClassAuth},
+		{transport.ErrRepositoryNotFound, ErrorClassNotFound},
+		{kind.Wrap(transport.ErrEmptyRemoteRepository), ErrorClassEmpty},
+		{kind.Wrap(kind.Wrap(context.Canceled)), ErrorClassCanceled},
+		{ErrJobTimeout.Wrap(fmt.Errorf("foo"), time.Second), ErrorClassTimeout},
+		{&statusError{503}, ErrorClassServer},
+		{&statusError{404}, ErrorClassUnknown},
+		{&statusError{429}, ErrorClassRateLimit},
+		{kind.Wrap(&github.RateLimitError{Response: &http.Response{
+			Request: httptest.NewRequest("GET", "/orgs/src-d/repos", nil),
+		}}), ErrorClassRateLimit},
+		{packfile.ErrZLib.AddDetails("foo"), ErrorClassCorrupt},
+		{idxfile.ErrMalformedIdxFile, ErrorClassCorrupt},
+		{&os.PathError{Err: syscall.ENOSPC}, ErrorClassStorageFull},
+		{&os.PathError{Err: syscall.EACCES}, ErrorClassStorage},
+		{fmt.Errorf("foo"), ErrorClassUnknown},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.class, ClassifyError(test.err), test.err)
+	}
+}
+
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string   { return fmt.Sprintf("status %d", e.code) }
+func (e *statusError) StatusCode() int { return e.code }
@@ -0,0 +1,116 @@
+package gitcollector
+
+import "sort"
+
+// ErrorCode is the stable numeric code of an ErrorClass, so the failures can
+// be told apart without parsing their messages. They're the exit codes of the
+// processes too, the codes of the catalog never change their meaning.
+type ErrorCode int
+
+const (
+	// ErrorCodeOK is used when there was no error.
+	ErrorCodeOK ErrorCode = 0
+	// ErrorCodeUnknown is used for ErrorClassUnknown, it's the exit code
+	// of the failures not related to the jobs too.
+	ErrorCodeUnknown ErrorCode = 1
+	// ErrorCodeCanceled is used for ErrorClassCanceled.
+	ErrorCodeCanceled ErrorCode = 10
+	// ErrorCodeTimeout is used for ErrorClassTimeout.
+	ErrorCodeTimeout ErrorCode = 11
+	// ErrorCodeNetwork is used for ErrorClassNetwork.
+	ErrorCodeNetwork ErrorCode = 12
+	// ErrorCodeAuth is used for ErrorClassAuth.
+	ErrorCodeAuth ErrorCode = 13
+	// ErrorCodeNotFound is used for ErrorClassNotFound.
+	ErrorCodeNotFound ErrorCode = 14
+	// ErrorCodeEmpty is used for ErrorClassEmpty.
+	ErrorCodeEmpty ErrorCode = 15
+	// ErrorCodeServer is used for ErrorClassServer.
+	ErrorCodeServer ErrorCode = 16
+	// ErrorCodeStorage is used for ErrorClassStorage.
+	ErrorCodeStorage ErrorCode = 17
+	// ErrorCodeStorageFull is used for ErrorClassStorageFull.
+	ErrorCodeStorageFull ErrorCode = 18
+	// ErrorCodeRateLimit is used for ErrorClassRateLimit.
+	ErrorCodeRateLimit ErrorCode = 19
+	// ErrorCodeCorrupt is used for ErrorClassCorrupt.
+	ErrorCodeCorrupt ErrorCode = 20
+)
+
+var errorCodes = map[ErrorClass]ErrorCode{
+	ErrorClassUnknown:     ErrorCodeUnknown,
+	ErrorClassCanceled:    ErrorCodeCanceled,
+	ErrorClassTimeout:     ErrorCodeTimeout,
+	ErrorClassNetwork:     ErrorCodeNetwork,
+	ErrorClassAuth:        ErrorCodeAuth,
+	ErrorClassNotFound:    ErrorCodeNotFound,
+	ErrorClassEmpty:       ErrorCodeEmpty,
+	ErrorClassServer:      ErrorCodeServer,
+	ErrorClassStorage:     ErrorCodeStorage,
+	ErrorClassStorageFull: ErrorCodeStorageFull,
+	ErrorClassRateLimit:   ErrorCodeRateLimit,
+	ErrorClassCorrupt:     ErrorCodeCorrupt,
+}
+
+// Code returns the ErrorCode of the class, ErrorCodeUnknown for the classes
+// not in the catalog.
+func (c ErrorClass) Code() ErrorCode {
+	if code, ok := errorCodes[c]; ok {
+		return code
+	}
+
+	return ErrorCodeUnknown
+}
+
+// ErrorCatalogEntry describes an ErrorCode of the catalog.
+type ErrorCatalogEntry struct {
+	Code  ErrorCode
+	Class ErrorClass
+}
+
+// ErrorCatalog returns the codes of all the ErrorClasses sorted by code.
+func ErrorCatalog() []ErrorCatalogEntry {
+	catalog := make([]ErrorCatalogEntry, 0, len(errorCodes))
+	for class, code := range errorCodes {
+		catalog = append(catalog, ErrorCatalogEntry{Code: code, Class: class})
+	}
+
+	sort.Slice(catalog, func(i, j int) bool {
+		return catalog[i].Code < catalog[j].Code
+	})
+
+	return catalog
+}
+
+// ErrorCodeOf returns the ErrorCode the given error is classified with,
+// ErrorCodeOK for a nil error.
+func ErrorCodeOf(err error) ErrorCode {
+	if err == nil {
+		return ErrorCodeOK
+	}
+
+	return ClassifyError(err).Code()
+}
+
+// ExitCode returns the exit code of a process finished with the given error.
+// For a RunError the cancellation of its context goes first, then the
+// failures of the providers and then the first error of the failed jobs.
+func ExitCode(err error) int {
+	runErr, ok := err.(*RunError)
+	if !ok {
+		return int(ErrorCodeOf(err))
+	}
+
+	switch {
+	case runErr.Context != nil:
+		return int(ErrorCodeOf(runErr.Context))
+	case len(runErr.Providers) > 0:
+		return int(ErrorCodeOf(runErr.Providers[0]))
+	case len(runErr.Jobs) > 0:
+		return int(ErrorCodeOf(runErr.Jobs[0]))
+	case runErr.Failed > 0:
+		return int(ErrorCodeUnknown)
+	default:
+		return int(ErrorCodeOK)
+	}
+}
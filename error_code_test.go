@@ -0,0 +1,63 @@
+package gitcollector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+func TestErrorCatalog(t *testing.T) {
+	var require = require.New(t)
+
+	catalog := ErrorCatalog()
+	require.Len(catalog, len(errorCodes))
+	require.Equal(ErrorCatalogEntry{
+		Code:  ErrorCodeUnknown,
+		Class: ErrorClassUnknown,
+	}, catalog[0])
+
+	codes := map[ErrorCode]bool{}
+	for i, entry := range catalog {
+		require.False(codes[entry.Code], entry.Class)
+		codes[entry.Code] = true
+		require.Equal(entry.Code, entry.Class.Code())
+		if i > 0 {
+			require.True(catalog[i-1].Code < entry.Code)
+		}
+	}
+
+	require.Equal(ErrorCodeUnknown, ErrorClass("foo").Code())
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{nil, 0},
+		{fmt.Errorf("foo"), 1},
+		{transport.ErrAuthenticationRequired, 13},
+		{&RunError{}, 0},
+		{&RunError{Failed: 2}, 1},
+		{&RunError{
+			Failed: 1,
+			Jobs:   []error{transport.ErrRepositoryNotFound},
+		}, 14},
+		{&RunError{
+			Providers: []error{&statusError{429}},
+			Failed:    1,
+			Jobs:      []error{transport.ErrRepositoryNotFound},
+		}, 19},
+		{&RunError{
+			Context:   context.Canceled,
+			Providers: []error{&statusError{429}},
+		}, 10},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.code, ExitCode(test.err), test.err)
+	}
+}
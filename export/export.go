@@ -0,0 +1,181 @@
+// Package export writes the metadata of the repositories stored in a library
+// in formats suitable for data warehouses, like Apache Parquet.
+package export
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// Repository is the metadata of a repository stored in a library.
+type Repository struct {
+	// Location is the location the repository is stored in.
+	Location string
+	// ID is the identifier of the repository in its location.
+	ID        string
+	Endpoints []string
+	// References is the number of references of the repository.
+	References int64
+	// Size is the size in bytes of the siva file of the location, shared
+	// by all its repositories.
+	Size int64
+	// Updated is the last modification time of the location.
+	Updated time.Time
+}
+
+// RepositoryWriter writes the exported Repositories.
+type RepositoryWriter interface {
+	// Write writes a Repository.
+	Write(*Repository) error
+	// Close writes the pending Repositories.
+	Close() error
+}
+
+// LibraryOpts represents configuration options for the export of a library.
+type LibraryOpts struct {
+	// FS is the filesystem of the siva library, used to get the size and
+	// modification time of the locations. They're left empty when it's
+	// nil.
+	FS billy.Filesystem
+	// Bucket is the bucketization level of the library.
+	Bucket int
+}
+
+// Library writes a Repository for every repository of the library and
+// returns how many were written. The RepositoryWriter isn't closed.
+func Library(
+	ctx context.Context,
+	lib borges.Library,
+	w RepositoryWriter,
+	opts *LibraryOpts,
+) (int, error) {
+	if opts == nil {
+		opts = &LibraryOpts{}
+	}
+
+	iter, err := lib.Locations()
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = iter.ForEach(func(loc borges.Location) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := exportLocation(loc, w, opts)
+		count += n
+		return err
+	})
+
+	return count, err
+}
+
+func exportLocation(
+	loc borges.Location,
+	w RepositoryWriter,
+	opts *LibraryOpts,
+) (int, error) {
+	var (
+		size    int64
+		updated time.Time
+	)
+
+	if opts.FS != nil {
+		info, err := opts.FS.Stat(library.LocationFile(loc.ID(), opts.Bucket))
+		if err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+
+		if err == nil {
+			size, updated = info.Size(), info.ModTime()
+		}
+	}
+
+	repo, err := loc.Get("", borges.ReadOnlyMode)
+	if err != nil {
+		return 0, err
+	}
+	defer repo.Close()
+
+	repos, err := repositories(repo.R())
+	if err != nil {
+		return 0, err
+	}
+
+	for _, r := range repos {
+		r.Location = string(loc.ID())
+		r.Size, r.Updated = size, updated
+		if err := w.Write(r); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(repos), nil
+}
+
+// repositories returns the repositories of a location with their references
+// counted. The references of a repository are stored in the location under
+// refs/remotes/<id>/.
+func repositories(repo *git.Repository) ([]*Repository, error) {
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []*Repository
+	for name, remote := range cfg.Remotes {
+		repos = append(repos, &Repository{
+			ID:        name,
+			Endpoints: remote.URLs,
+		})
+	}
+
+	// longer ids first so a reference is counted in the most specific
+	// repository
+	sort.Slice(repos, func(i, j int) bool {
+		return len(repos[i].ID) > len(repos[j].ID)
+	})
+
+	refs, err := repo.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		// siva files keep some placeholder references without hash
+		if ref.Type() != plumbing.HashReference || ref.Hash().IsZero() {
+			return nil
+		}
+
+		for _, r := range repos {
+			prefix := "refs/remotes/" + r.ID + "/"
+			if strings.HasPrefix(ref.Name().String(), prefix) {
+				r.References++
+				break
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].ID < repos[j].ID
+	})
+
+	return repos, nil
+}
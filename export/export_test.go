@@ -0,0 +1,95 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+type repositoryList []*Repository
+
+func (r *repositoryList) Write(repo *Repository) error {
+	*r = append(*r, repo)
+	return nil
+}
+
+func (r *repositoryList) Close() error { return nil }
+
+func TestLibrary(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	lib, err := siva.NewLibrary("test", fs, siva.LibraryOptions{
+		Transactional: true,
+		TempFS:        memfs.New(),
+	})
+	require.NoError(err)
+
+	loc, err := lib.AddLocation("foo")
+	require.NoError(err)
+
+	for i, name := range []string{"foo", "bar"} {
+		id := borges.RepositoryID("github.com/src-d/" + name)
+		r, err := loc.Init(id)
+		require.NoError(err)
+
+		sto := r.R().Storer
+		obj := sto.NewEncodedObject()
+		obj.SetType(plumbing.BlobObject)
+		w, err := obj.Writer()
+		require.NoError(err)
+		_, err = fmt.Fprintf(w, "%s", name)
+		require.NoError(err)
+		require.NoError(w.Close())
+
+		h, err := sto.SetEncodedObject(obj)
+		require.NoError(err)
+
+		for j := 0; j <= i; j++ {
+			require.NoError(sto.SetReference(plumbing.NewHashReference(
+				plumbing.ReferenceName(fmt.Sprintf(
+					"refs/remotes/%s/heads/%d", id, j,
+				)),
+				h,
+			)))
+		}
+
+		require.NoError(r.Commit())
+	}
+
+	_, err = lib.AddLocation("empty")
+	require.NoError(err)
+
+	var res repositoryList
+	n, err := Library(context.Background(), lib, &res, &LibraryOpts{FS: fs})
+	require.NoError(err)
+	require.Equal(2, n)
+
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+
+	info, err := fs.Stat(library.LocationFile("foo", 0))
+	require.NoError(err)
+
+	bar, foo := res[0], res[1]
+	require.Equal("foo", bar.Location)
+	require.Equal("github.com/src-d/bar", bar.ID)
+	require.Equal(
+		[]string{"git://github.com/src-d/bar.git"},
+		bar.Endpoints,
+	)
+	require.Equal(int64(2), bar.References)
+	require.Equal(info.Size(), bar.Size)
+	require.False(bar.Updated.IsZero())
+
+	require.Equal("github.com/src-d/foo", foo.ID)
+	require.Equal(int64(1), foo.References)
+	require.Equal(info.Size(), foo.Size)
+}
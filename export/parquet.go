@@ -0,0 +1,139 @@
+package export
+
+import (
+	"io"
+	"time"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrParquetSource is returned when the Parquet library tries to read or open
+// the file being written.
+var ErrParquetSource = errors.NewKind("unsupported operation on the parquet output: %s")
+
+const (
+	defaultRowGroupSize     = 10000
+	defaultParquetCreatedBy = "gitcollector"
+)
+
+// ParquetOpts represents configuration options for a ParquetWriter.
+type ParquetOpts struct {
+	// RowGroupSize is the number of rows kept in memory before writing
+	// them as a row group, default to 10000.
+	RowGroupSize int
+	// CreatedBy is the application recorded in the file metadata,
+	// default to gitcollector.
+	CreatedBy string
+}
+
+// ParquetWriter is a RepositoryWriter producing an Apache Parquet file with
+// a row per repository. The columns are compressed with snappy, the
+// endpoints are a repeated column.
+type ParquetWriter struct {
+	pw   *writer.ParquetWriter
+	opts *ParquetOpts
+	rows int
+}
+
+var _ RepositoryWriter = (*ParquetWriter)(nil)
+
+// parquetRow is the schema of the exported Parquet files.
+type parquetRow struct {
+	Location   string   `parquet:"name=location, type=UTF8"`
+	Repository string   `parquet:"name=repository, type=UTF8"`
+	Endpoints  []string `parquet:"name=endpoints, type=UTF8, repetitiontype=REPEATED"`
+	References int64    `parquet:"name=references, type=INT64"`
+	Size       int64    `parquet:"name=location_size, type=INT64"`
+	Updated    int64    `parquet:"name=updated, type=TIMESTAMP_MILLIS"`
+}
+
+// NewParquetWriter builds a new ParquetWriter. Close must be called to write
+// the metadata of the file.
+func NewParquetWriter(w io.Writer, opts *ParquetOpts) (*ParquetWriter, error) {
+	if opts == nil {
+		opts = &ParquetOpts{}
+	}
+
+	if opts.RowGroupSize <= 0 {
+		opts.RowGroupSize = defaultRowGroupSize
+	}
+
+	if opts.CreatedBy == "" {
+		opts.CreatedBy = defaultParquetCreatedBy
+	}
+
+	pw, err := writer.NewParquetWriter(&parquetFile{w}, new(parquetRow), 1)
+	if err != nil {
+		return nil, err
+	}
+
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	pw.Footer.CreatedBy = &opts.CreatedBy
+	return &ParquetWriter{pw: pw, opts: opts}, nil
+}
+
+// Write implements the RepositoryWriter interface.
+func (w *ParquetWriter) Write(r *Repository) error {
+	var updated int64
+	if !r.Updated.IsZero() {
+		updated = r.Updated.UnixNano() / int64(time.Millisecond)
+	}
+
+	if err := w.pw.Write(&parquetRow{
+		Location:   r.Location,
+		Repository: r.ID,
+		Endpoints:  r.Endpoints,
+		References: r.References,
+		Size:       r.Size,
+		Updated:    updated,
+	}); err != nil {
+		return err
+	}
+
+	// the row groups of the Parquet library are sized in bytes, they're
+	// written by number of rows instead.
+	w.rows++
+	if w.rows < w.opts.RowGroupSize {
+		return nil
+	}
+
+	w.rows = 0
+	return w.pw.Flush(true)
+}
+
+// Close implements the RepositoryWriter interface. It writes the pending rows
+// and the metadata of the file, it doesn't close the underlying writer.
+func (w *ParquetWriter) Close() error {
+	return w.pw.WriteStop()
+}
+
+// parquetFile is the source.ParquetFile of the Parquet library writing to an
+// io.Writer, it's only written sequentially.
+type parquetFile struct {
+	io.Writer
+}
+
+var _ source.ParquetFile = (*parquetFile)(nil)
+
+func (f *parquetFile) Read([]byte) (int, error) {
+	return 0, ErrParquetSource.New("read")
+}
+
+func (f *parquetFile) Seek(int64, int) (int64, error) {
+	return 0, ErrParquetSource.New("seek")
+}
+
+func (f *parquetFile) Open(string) (source.ParquetFile, error) {
+	return nil, ErrParquetSource.New("open")
+}
+
+func (f *parquetFile) Create(string) (source.ParquetFile, error) {
+	return nil, ErrParquetSource.New("create")
+}
+
+func (f *parquetFile) Close() error {
+	return nil
+}
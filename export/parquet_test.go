@@ -0,0 +1,159 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+func TestParquetWriter(t *testing.T) {
+	var require = require.New(t)
+
+	updated := time.Date(2019, 10, 14, 12, 0, 0, 0, time.UTC)
+	repos := []*Repository{
+		{
+			Location:   "loc-a",
+			ID:         "github.com/a/a",
+			Endpoints:  []string{"https://github.com/a/a"},
+			References: 3,
+			Size:       1024,
+			Updated:    updated,
+		},
+		{
+			Location: "loc-a",
+			ID:       "github.com/b/a",
+			Endpoints: []string{
+				"https://github.com/b/a",
+				"git://github.com/b/a",
+			},
+			References: 1,
+			Size:       1024,
+			Updated:    updated,
+		},
+		{
+			Location: "loc-b",
+			ID:       "github.com/c/c",
+		},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewParquetWriter(&buf, &ParquetOpts{RowGroupSize: 2})
+	require.NoError(err)
+	for _, r := range repos {
+		require.NoError(w.Write(r))
+	}
+
+	require.NoError(w.Close())
+
+	// the reader renames the columns of the metadata, the names of the
+	// file are kept by its schema handler.
+	meta, err := reader.NewParquetReader(newMemFile(buf.Bytes()), nil, 1)
+	require.NoError(err)
+	defer meta.ReadStop()
+
+	require.Equal("gitcollector", meta.Footer.GetCreatedBy())
+	require.Len(meta.Footer.RowGroups, 2)
+
+	var names []string
+	for i := 1; i < len(meta.Footer.Schema); i++ {
+		names = append(names, meta.SchemaHandler.GetExName(i))
+	}
+
+	require.Equal([]string{
+		"location", "repository", "endpoints",
+		"references", "location_size", "updated",
+	}, names)
+	require.Equal(
+		parquet.FieldRepetitionType_REPEATED,
+		meta.Footer.Schema[3].GetRepetitionType(),
+	)
+	require.Equal(
+		parquet.ConvertedType_TIMESTAMP_MILLIS,
+		meta.Footer.Schema[6].GetConvertedType(),
+	)
+
+	pr, err := reader.NewParquetReader(
+		newMemFile(buf.Bytes()), new(parquetRow), 1,
+	)
+	require.NoError(err)
+	defer pr.ReadStop()
+
+	rows := make([]parquetRow, pr.GetNumRows())
+	require.NoError(pr.Read(&rows))
+
+	ms := updated.UnixNano() / int64(time.Millisecond)
+	require.Equal([]parquetRow{
+		{
+			Location:   "loc-a",
+			Repository: "github.com/a/a",
+			Endpoints:  []string{"https://github.com/a/a"},
+			References: 3,
+			Size:       1024,
+			Updated:    ms,
+		},
+		{
+			Location:   "loc-a",
+			Repository: "github.com/b/a",
+			Endpoints: []string{
+				"https://github.com/b/a",
+				"git://github.com/b/a",
+			},
+			References: 1,
+			Size:       1024,
+			Updated:    ms,
+		},
+		{
+			Location:   "loc-b",
+			Repository: "github.com/c/c",
+		},
+	}, rows)
+}
+
+func TestParquetWriterEmpty(t *testing.T) {
+	var require = require.New(t)
+
+	var buf bytes.Buffer
+	w, err := NewParquetWriter(&buf, nil)
+	require.NoError(err)
+	require.NoError(w.Close())
+
+	pr, err := reader.NewParquetReader(
+		newMemFile(buf.Bytes()), new(parquetRow), 1,
+	)
+	require.NoError(err)
+	defer pr.ReadStop()
+
+	require.Equal(int64(0), pr.GetNumRows())
+	require.Empty(pr.Footer.RowGroups)
+}
+
+// memFile is a source.ParquetFile reading a file in memory.
+type memFile struct {
+	*bytes.Reader
+	data []byte
+}
+
+func newMemFile(data []byte) *memFile {
+	return &memFile{Reader: bytes.NewReader(data), data: data}
+}
+
+func (f *memFile) Write([]byte) (int, error) {
+	return 0, ErrParquetSource.New("write")
+}
+
+func (f *memFile) Open(string) (source.ParquetFile, error) {
+	return newMemFile(f.data), nil
+}
+
+func (f *memFile) Create(string) (source.ParquetFile, error) {
+	return nil, ErrParquetSource.New("create")
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
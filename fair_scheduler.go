@@ -0,0 +1,191 @@
+package gitcollector
+
+import (
+	"context"
+	"time"
+)
+
+// JobKeyFn returns the key used to group Jobs, i.e. the organization they
+// belong to.
+type JobKeyFn func(Job) string
+
+// FairScheduleOpts are configuration options for a fair JobScheduleFn.
+type FairScheduleOpts struct {
+	// Key groups the Jobs. Jobs with the same key share a turn.
+	Key JobKeyFn
+	// Quantum is the number of Jobs scheduled for a key before giving the
+	// turn to the next one.
+	Quantum int
+	// Buffer is the maximum number of Jobs retrieved in advance from the
+	// wrapped JobScheduleFn to be able to choose among different keys.
+	Buffer int
+	// FillTimeout is the time waited for new Jobs to fill the buffer when
+	// there are Jobs already buffered.
+	FillTimeout time.Duration
+}
+
+const (
+	fairQuantum     = 1
+	fairBuffer      = 1000
+	fairFillTimeout = 10 * time.Millisecond
+)
+
+type fairScheduler struct {
+	schedule JobScheduleFn
+	opts     *FairScheduleOpts
+	queues   map[string][]Job
+	// urgent holds the Jobs with a priority higher than PriorityNormal,
+	// they're scheduled before the rest regardless of their key.
+	urgent   []Job
+	order    []string
+	current  int
+	served   int
+	buffered int
+	closed   bool
+}
+
+// NewFairScheduleFn wraps the given JobScheduleFn to share the workers
+// between the different keys of the Jobs in a round-robin fashion, so a key
+// producing a huge amount of Jobs can't delay the rest of them until it is
+// exhausted. The Jobs with a higher priority than PriorityNormal skip the
+// turns.
+func NewFairScheduleFn(
+	schedule JobScheduleFn,
+	opts *FairScheduleOpts,
+) JobScheduleFn {
+	if opts == nil {
+		opts = &FairScheduleOpts{}
+	}
+
+	if opts.Key == nil {
+		opts.Key = func(Job) string { return "" }
+	}
+
+	if opts.Quantum <= 0 {
+		opts.Quantum = fairQuantum
+	}
+
+	if opts.Buffer <= 0 {
+		opts.Buffer = fairBuffer
+	}
+
+	if opts.FillTimeout <= 0 {
+		opts.FillTimeout = fairFillTimeout
+	}
+
+	s := &fairScheduler{
+		schedule: schedule,
+		opts:     opts,
+		queues:   map[string][]Job{},
+	}
+
+	return s.next
+}
+
+func (s *fairScheduler) next(ctx context.Context) (Job, error) {
+	if err := s.fill(ctx); err != nil {
+		return nil, err
+	}
+
+	if s.buffered == 0 {
+		if s.closed {
+			return nil, ErrJobSource.New()
+		}
+
+		return nil, ErrNewJobsNotFound.New()
+	}
+
+	return s.pop(), nil
+}
+
+func (s *fairScheduler) fill(ctx context.Context) error {
+	for !s.closed && s.buffered < s.opts.Buffer {
+		var (
+			job Job
+			err error
+		)
+
+		if s.buffered == 0 {
+			job, err = s.schedule(ctx)
+		} else {
+			fillCtx, cancel := context.WithTimeout(
+				ctx, s.opts.FillTimeout,
+			)
+
+			job, err = s.schedule(fillCtx)
+			cancel()
+		}
+
+		if err != nil {
+			if ErrJobSource.Is(err) {
+				s.closed = true
+				return nil
+			}
+
+			if s.buffered == 0 && !ErrNewJobsNotFound.Is(err) {
+				return err
+			}
+
+			return nil
+		}
+
+		s.push(job)
+	}
+
+	return nil
+}
+
+func (s *fairScheduler) push(job Job) {
+	if JobPriority(job) > PriorityNormal {
+		s.urgent = append(s.urgent, job)
+		s.buffered++
+		return
+	}
+
+	key := s.opts.Key(job)
+	queue, ok := s.queues[key]
+	if !ok {
+		s.order = append(s.order, key)
+	}
+
+	s.queues[key] = append(queue, job)
+	s.buffered++
+}
+
+func (s *fairScheduler) pop() Job {
+	if len(s.urgent) > 0 {
+		job := s.urgent[0]
+		s.urgent[0] = nil
+		s.urgent = s.urgent[1:]
+		s.buffered--
+		return job
+	}
+
+	if s.served >= s.opts.Quantum {
+		s.current++
+		s.served = 0
+	}
+
+	if s.current >= len(s.order) {
+		s.current = 0
+	}
+
+	key := s.order[s.current]
+	queue := s.queues[key]
+	job := queue[0]
+	queue[0] = nil
+	queue = queue[1:]
+	s.buffered--
+	s.served++
+
+	if len(queue) > 0 {
+		s.queues[key] = queue
+		return job
+	}
+
+	// the key has no more jobs, it loses its turn.
+	delete(s.queues, key)
+	s.order = append(s.order[:s.current], s.order[s.current+1:]...)
+	s.served = 0
+	return job
+}
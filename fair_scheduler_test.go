@@ -0,0 +1,45 @@
+package gitcollector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFairScheduleFn(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 20)
+	for i := 0; i < 8; i++ {
+		queue <- &testJob{id: "big"}
+	}
+
+	queue <- &testJob{id: "small"}
+	queue <- &testJob{id: "small"}
+	queue <- &testJob{id: "tiny"}
+	close(queue)
+
+	schedule := NewFairScheduleFn(testScheduleFn(queue), &FairScheduleOpts{
+		Key:         func(j Job) string { return j.(*testJob).id },
+		Quantum:     2,
+		FillTimeout: 5 * time.Millisecond,
+	})
+
+	var got []string
+	for {
+		job, err := schedule(context.Background())
+		if err != nil {
+			require.True(ErrJobSource.Is(err))
+			break
+		}
+
+		got = append(got, job.(*testJob).id)
+	}
+
+	require.Equal([]string{
+		"big", "big", "small", "small", "tiny",
+		"big", "big", "big", "big", "big", "big",
+	}, got)
+}
@@ -0,0 +1,283 @@
+package gitcollector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrHeartbeatStale is returned when a heartbeat report wasn't updated
+	// in time, the collector is dead or blocked.
+	ErrHeartbeatStale = errors.NewKind("heartbeat not updated for %s")
+
+	// ErrWorkerStuck is returned when a heartbeat report has a worker
+	// processing the same Job for too long.
+	ErrWorkerStuck = errors.NewKind("worker %s stuck processing %s for %s")
+)
+
+// Heartbeat is the activity of a worker.
+type Heartbeat struct {
+	Worker string `json:"worker"`
+	// Busy is set while the worker is processing a Job.
+	Busy bool `json:"busy"`
+	// Job describes the Job being processed, its String method is used if
+	// it implements fmt.Stringer.
+	Job string `json:"job,omitempty"`
+	// JobStarted is when the worker started processing the Job.
+	JobStarted *time.Time `json:"job_started,omitempty"`
+	// LastActivity is when the worker started or finished its last Job.
+	LastActivity time.Time `json:"last_activity"`
+	// Stuck is set when the worker has been processing the same Job for
+	// longer than the HeartbeatOpts StuckAfter.
+	Stuck bool `json:"stuck,omitempty"`
+}
+
+// HeartbeatReport is the content of the file written by a HeartbeatWriter.
+type HeartbeatReport struct {
+	// Updated is when the report was written.
+	Updated time.Time `json:"updated"`
+	PID     int       `json:"pid"`
+	// Healthy is false when any of the workers is stuck.
+	Healthy bool        `json:"healthy"`
+	Workers []Heartbeat `json:"workers"`
+}
+
+// ReadHeartbeatReport reads the HeartbeatReport written to the given file.
+func ReadHeartbeatReport(path string) (*HeartbeatReport, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var report HeartbeatReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// Check returns ErrHeartbeatStale if the report is older than maxAge, or
+// ErrWorkerStuck if any of its workers is stuck. A zero maxAge doesn't check
+// the age of the report.
+func (r *HeartbeatReport) Check(maxAge time.Duration, now time.Time) error {
+	if age := now.Sub(r.Updated); maxAge > 0 && age > maxAge {
+		return ErrHeartbeatStale.New(age.Round(time.Second))
+	}
+
+	for _, hb := range r.Workers {
+		if hb.Stuck && hb.JobStarted != nil {
+			return ErrWorkerStuck.New(
+				hb.Worker,
+				hb.Job,
+				r.Updated.Sub(*hb.JobStarted).Round(time.Second),
+			)
+		}
+	}
+
+	return nil
+}
+
+// HeartbeatOpts represents configuration options for a HeartbeatWriter.
+type HeartbeatOpts struct {
+	// Path is the file the HeartbeatReport is written to.
+	Path string
+	// Interval is the time between writes, default to 10 seconds.
+	Interval time.Duration
+	// StuckAfter is the time processing the same Job after which a worker
+	// is reported as stuck, 0 never reports them.
+	StuckAfter time.Duration
+}
+
+const heartbeatInterval = 10 * time.Second
+
+// HeartbeatWriter writes periodically the Heartbeats of the workers of a
+// WorkerPool to a JSON file, so the supervisors can tell a stuck collector
+// from an idle one. The file is replaced atomically on every write.
+type HeartbeatWriter struct {
+	wp   *WorkerPool
+	opts *HeartbeatOpts
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+	now  func() time.Time
+}
+
+// NewHeartbeatWriter builds a new HeartbeatWriter.
+func NewHeartbeatWriter(wp *WorkerPool, opts *HeartbeatOpts) *HeartbeatWriter {
+	if opts.Interval <= 0 {
+		opts.Interval = heartbeatInterval
+	}
+
+	return &HeartbeatWriter{
+		wp:   wp,
+		opts: opts,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+		now:  time.Now,
+	}
+}
+
+// Start writes the report right away and then every Interval until Stop is
+// called. It returns the first error writing the report, so the file stops
+// being updated and the supervisor notices it.
+func (w *HeartbeatWriter) Start() error {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := w.write(w.Report()); err != nil {
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-w.stop:
+			return nil
+		}
+	}
+}
+
+// Stop stops writing the report and waits for Start to return.
+func (w *HeartbeatWriter) Stop() {
+	w.once.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+// Report returns the current HeartbeatReport.
+func (w *HeartbeatWriter) Report() *HeartbeatReport {
+	now := w.now()
+	report := &HeartbeatReport{
+		Updated: now,
+		PID:     os.Getpid(),
+		Healthy: true,
+		Workers: w.wp.Heartbeats(),
+	}
+
+	for i, hb := range report.Workers {
+		if w.opts.StuckAfter > 0 && hb.Busy &&
+			now.Sub(*hb.JobStarted) > w.opts.StuckAfter {
+			report.Workers[i].Stuck = true
+			report.Healthy = false
+		}
+	}
+
+	return report
+}
+
+func (w *HeartbeatWriter) write(report *HeartbeatReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := w.opts.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, w.opts.Path)
+}
+
+// workerBeat holds the Heartbeat of a worker.
+type workerBeat struct {
+	n  int
+	mu sync.Mutex
+	hb Heartbeat
+}
+
+func newWorkerBeat(n int, now time.Time) *workerBeat {
+	return &workerBeat{
+		n:  n,
+		hb: Heartbeat{Worker: strconv.Itoa(n), LastActivity: now},
+	}
+}
+
+func (b *workerBeat) busy(job Job, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.hb.Busy = true
+	b.hb.Job = jobDescription(job)
+	b.hb.JobStarted = &now
+	b.hb.LastActivity = now
+}
+
+func (b *workerBeat) idle(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.hb.Busy = false
+	b.hb.Job = ""
+	b.hb.JobStarted = nil
+	b.hb.LastActivity = now
+}
+
+func (b *workerBeat) get() Heartbeat {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.hb
+}
+
+func jobDescription(job Job) string {
+	if s, ok := job.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return fmt.Sprintf("%T", job)
+}
+
+// heartbeats is the registry of the workerBeats of the running workers.
+type heartbeats struct {
+	mu    sync.Mutex
+	beats map[string]*workerBeat
+}
+
+func newHeartbeats() *heartbeats {
+	return &heartbeats{beats: make(map[string]*workerBeat)}
+}
+
+func (h *heartbeats) add(b *workerBeat) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.beats[b.hb.Worker] = b
+}
+
+func (h *heartbeats) remove(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.beats, id)
+}
+
+func (h *heartbeats) list() []Heartbeat {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	beats := make([]*workerBeat, 0, len(h.beats))
+	for _, b := range h.beats {
+		beats = append(beats, b)
+	}
+
+	sort.Slice(beats, func(i, j int) bool {
+		return beats[i].n < beats[j].n
+	})
+
+	list := make([]Heartbeat, len(beats))
+	for i, b := range beats {
+		list[i] = b.get()
+	}
+
+	return list
+}
@@ -0,0 +1,131 @@
+package gitcollector
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeartbeats(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 5)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{})
+	wp.SetWorkers(2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wp.RunContext(ctx)
+
+	beats := wp.Heartbeats()
+	require.Len(beats, 2)
+	require.Equal("1", beats[0].Worker)
+	require.Equal("2", beats[1].Worker)
+	require.False(beats[0].Busy || beats[1].Busy)
+
+	started := make(chan struct{})
+	queue <- &testBlockingJob{started: started}
+	<-started
+
+	var busy []Heartbeat
+	for _, hb := range wp.Heartbeats() {
+		if hb.Busy {
+			busy = append(busy, hb)
+		}
+	}
+
+	require.Len(busy, 1)
+	require.Equal("*gitcollector.testBlockingJob", busy[0].Job)
+	require.NotNil(busy[0].JobStarted)
+
+	dir, err := ioutil.TempDir("", "gitcollector")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "heartbeat.json")
+	w := NewHeartbeatWriter(wp, &HeartbeatOpts{
+		Path:       path,
+		StuckAfter: time.Hour,
+	})
+
+	require.NoError(w.write(w.Report()))
+	report, err := ReadHeartbeatReport(path)
+	require.NoError(err)
+	require.True(report.Healthy)
+	require.Len(report.Workers, 2)
+	require.NoError(report.Check(time.Minute, time.Now()))
+	require.True(ErrHeartbeatStale.Is(
+		report.Check(time.Minute, time.Now().Add(2*time.Minute)),
+	))
+
+	// the blocked job is reported as stuck
+	w.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	require.NoError(w.write(w.Report()))
+	report, err = ReadHeartbeatReport(path)
+	require.NoError(err)
+	require.False(report.Healthy)
+	require.True(ErrWorkerStuck.Is(report.Check(0, time.Now())))
+
+	cancel()
+	wp.WaitError()
+	require.Len(wp.Heartbeats(), 0)
+}
+
+func TestHeartbeatWriter(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{})
+	wp.SetWorkers(1)
+	wp.Run()
+
+	dir, err := ioutil.TempDir("", "gitcollector")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "heartbeat.json")
+	w := NewHeartbeatWriter(wp, &HeartbeatOpts{
+		Path:     path,
+		Interval: 5 * time.Millisecond,
+	})
+
+	done := make(chan error)
+	go func() { done <- w.Start() }()
+
+	// the report is written again after the interval
+	var first, last time.Time
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) && !last.After(first) {
+		time.Sleep(time.Millisecond)
+		report, err := ReadHeartbeatReport(path)
+		if err != nil {
+			continue
+		}
+
+		if first.IsZero() {
+			first = report.Updated
+		}
+
+		last = report.Updated
+	}
+
+	require.True(last.After(first))
+
+	w.Stop()
+	w.Stop()
+	require.NoError(<-done)
+
+	close(queue)
+	wp.Wait()
+
+	// the writer fails when the file can't be written
+	w = NewHeartbeatWriter(wp, &HeartbeatOpts{
+		Path: filepath.Join(dir, "missing", "heartbeat.json"),
+	})
+
+	require.Error(w.Start())
+}
@@ -0,0 +1,29 @@
+// Package signals handles the signals the gitcollector commands stop on.
+package signals
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// InterruptContext returns a context canceled when the process receives an
+// interrupt or a termination signal. The given function, if any, is called
+// with the signal before the context is canceled.
+func InterruptContext(onSignal func(os.Signal)) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-received
+		signal.Stop(received)
+		if onSignal != nil {
+			onSignal(sig)
+		}
+
+		cancel()
+	}()
+
+	return ctx
+}
@@ -2,6 +2,7 @@ package gitcollector
 
 import (
 	"context"
+	"time"
 
 	"gopkg.in/src-d/go-errors.v1"
 )
@@ -12,6 +13,88 @@ type Job interface {
 	Process(context.Context) error
 }
 
+// Priority is the urgency of a Job, the Jobs with a higher priority are
+// processed before the rest.
+type Priority int
+
+const (
+	// PriorityNormal is the priority of the Jobs by default.
+	PriorityNormal Priority = iota
+	// PriorityHigh is the priority of the urgent Jobs, like the updates
+	// requested by a push notification, they jump ahead of the bulk
+	// downloads.
+	PriorityHigh
+)
+
+// PriorityLow is the priority of the Jobs deferred after the rest by the
+// schedulers ordering the Jobs, like the ones of the repositories failing
+// repeatedly.
+const PriorityLow Priority = -1
+
+// PriorityJob is an optional interface a Job can implement to be processed
+// before the Jobs with a lower priority.
+type PriorityJob interface {
+	Job
+	JobPriority() Priority
+}
+
+// JobPriority returns the priority of the Job, PriorityNormal unless it
+// implements PriorityJob.
+func JobPriority(job Job) Priority {
+	job, _ = unwrapJob(job)
+	if j, ok := job.(PriorityJob); ok {
+		return j.JobPriority()
+	}
+
+	return PriorityNormal
+}
+
+// DelayedJob is an optional interface a Job can implement to be processed not
+// before a given time, like a polite retry or an update spread over the day.
+// The scheduler holds it until then without blocking any worker.
+type DelayedJob interface {
+	Job
+	JobNotBefore() time.Time
+}
+
+// JobNotBefore returns the time the Job can be processed from, the zero time
+// unless it implements DelayedJob.
+func JobNotBefore(job Job) time.Time {
+	job, _ = unwrapJob(job)
+	if j, ok := job.(DelayedJob); ok {
+		return j.JobNotBefore()
+	}
+
+	return time.Time{}
+}
+
+// TransferStats are the measures of the data fetched from the remotes by a
+// processed Job.
+type TransferStats struct {
+	// BytesFetched is the size of the packfiles fetched.
+	BytesFetched uint64
+	// ObjectsPacked is the number of objects in the packfiles fetched.
+	ObjectsPacked uint64
+}
+
+// TransferJob is an optional interface a Job can implement to report the data
+// it fetched once it's processed.
+type TransferJob interface {
+	Job
+	JobTransfer() TransferStats
+}
+
+// JobTransfer returns the data fetched by the processed Job, zero unless it
+// implements TransferJob.
+func JobTransfer(job Job) TransferStats {
+	job, _ = unwrapJob(job)
+	if j, ok := job.(TransferJob); ok {
+		return j.JobTransfer()
+	}
+
+	return TransferStats{}
+}
+
 // MetricsCollector represents a component in charge to collect jobs metrics.
 type MetricsCollector interface {
 	// Start starts collecting metrics.
@@ -26,6 +109,34 @@ type MetricsCollector interface {
 	Discover(Job)
 }
 
+// ErrorMetricsCollector is an optional interface a MetricsCollector can
+// implement to receive the classified error and the processing time of the
+// failed Jobs. FailWithError is called instead of Fail when it's implemented.
+type ErrorMetricsCollector interface {
+	MetricsCollector
+	// FailWithError registers metrics about a failed processed Job.
+	FailWithError(Job, *JobFailure)
+}
+
+// LatencyMetricsCollector is an optional interface a MetricsCollector can
+// implement to receive the processing time of every Job, successful or not.
+type LatencyMetricsCollector interface {
+	MetricsCollector
+	// Latency registers the time spent processing a Job.
+	Latency(Job, time.Duration)
+}
+
+// ResultMetricsCollector is an optional interface a MetricsCollector can
+// implement to receive the JobResult of every processed Job. Processed is
+// called instead of Latency, Success, Fail and FailWithError when it's
+// implemented.
+type ResultMetricsCollector interface {
+	MetricsCollector
+	// Processed registers metrics about a processed Job, successful or
+	// not.
+	Processed(Job, *JobResult)
+}
+
 var (
 	// ErrProviderStopped is returned when a provider has been stopped.
 	ErrProviderStopped = errors.NewKind("provider stopped")
@@ -39,3 +150,53 @@ type Provider interface {
 	Start() error
 	Stop() error
 }
+
+// ContextProvider is an optional interface a Provider can implement to run
+// bound to a context, so it can be wired into an errgroup or any other
+// cancellation tree. StartContext returns ErrProviderStopped once the context
+// is done or Stop is called, canceling the requests in flight.
+type ContextProvider interface {
+	Provider
+	StartContext(context.Context) error
+}
+
+// ProviderState is a snapshot of the health and progress of a provider.
+type ProviderState struct {
+	// Name identifies the provider and its source.
+	Name string
+	// Discovered is the number of Jobs produced.
+	Discovered int
+	// Cursor is the position of the provider in its source, like the page
+	// or the cursor of the next API request.
+	Cursor string
+	// LastError is the last error found by the provider, if any.
+	LastError error
+	// LastErrorTime is when LastError happened.
+	LastErrorTime time.Time
+	// RateLimitRemaining is the number of requests left until the rate
+	// limit reset, -1 if unknown.
+	RateLimitRemaining int
+	// RateLimitReset is when the rate limit will be reset.
+	RateLimitReset time.Time
+	// Done is set once the provider won't produce more Jobs.
+	Done bool
+}
+
+// ProviderStatus is an optional interface the providers, push or pull based,
+// can implement to report their health and progress.
+type ProviderStatus interface {
+	// Status returns the current state of the provider. It's safe to be
+	// called concurrently with the provider running.
+	Status() ProviderState
+}
+
+// PullProvider is an alternative to Provider where the Jobs are requested by
+// the scheduler when there's capacity to process them instead of being pushed
+// into a queue, so the backpressure is explicit and the provider doesn't need
+// to buffer the Jobs it couldn't enqueue.
+type PullProvider interface {
+	// Next returns the next Job, blocking until there is one available.
+	// It must return ErrNewJobsNotFound if the context is done before
+	// finding a Job and ErrProviderStopped once there won't be more Jobs.
+	Next(context.Context) (Job, error)
+}
@@ -0,0 +1,185 @@
+package gitcollector
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// JobEventType is the step of the lifecycle of a Job an event reports.
+type JobEventType string
+
+const (
+	// JobEnqueued is published once a Job is sent to the workers.
+	JobEnqueued JobEventType = "enqueued"
+	// JobStarted is published when a worker starts processing a Job.
+	JobStarted JobEventType = "started"
+	// JobRetried is published when a failed attempt of a Job is going to
+	// be retried following its RetryPolicy.
+	JobRetried JobEventType = "retried"
+	// JobSucceeded is published once a Job is processed without error.
+	JobSucceeded JobEventType = "succeeded"
+	// JobFailed is published once a Job failed and won't be retried.
+	JobFailed JobEventType = "failed"
+)
+
+// JobEvent is a step of the lifecycle of a Job in a WorkerPool.
+type JobEvent struct {
+	Type JobEventType
+	Job  Job
+	// Worker is the worker processing the Job, empty for JobEnqueued.
+	Worker string
+	// Attempt is the number of the attempt, starting at 1. It's the one
+	// about to start for JobRetried and the last one for JobSucceeded and
+	// JobFailed, 0 for JobEnqueued.
+	Attempt int
+	Time    time.Time
+	// Err is the error of the failed attempt of a JobRetried.
+	Err error
+	// Backoff is the time waited before the next attempt of a JobRetried.
+	Backoff time.Duration
+	// Result is the JobResult of a JobSucceeded or a JobFailed.
+	Result *JobResult
+}
+
+// JobSubscription receives the events published in a JobEventBus.
+type JobSubscription struct {
+	events chan *JobEvent
+	done   chan struct{}
+	once   sync.Once
+	bus    *JobEventBus
+}
+
+// Events returns the channel where the events are received. It's closed once
+// the subscription or the JobEventBus are closed.
+func (s *JobSubscription) Events() <-chan *JobEvent {
+	return s.events
+}
+
+// Close stops receiving events.
+func (s *JobSubscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+func (s *JobSubscription) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// JobEventBus delivers the JobEvents of a WorkerPool to all its subscribers,
+// so the metrics, dead-letter sinks or notifications can be built on top of
+// the lifecycle of the Jobs. Publishing blocks until every subscriber has room
+// for the event, so a slow subscriber slows down the pool instead of missing
+// events. Closing the bus is up to its owner, once the pool is stopped.
+type JobEventBus struct {
+	mu     sync.RWMutex
+	subs   map[*JobSubscription]struct{}
+	closed bool
+}
+
+// NewJobEventBus builds a new JobEventBus.
+func NewJobEventBus() *JobEventBus {
+	return &JobEventBus{subs: map[*JobSubscription]struct{}{}}
+}
+
+// Subscribe returns a new JobSubscription buffering up to the given number of
+// events.
+func (b *JobEventBus) Subscribe(buffer int) *JobSubscription {
+	sub := &JobSubscription{
+		events: make(chan *JobEvent, buffer),
+		done:   make(chan struct{}),
+		bus:    b,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(sub.events)
+		sub.close()
+		return sub
+	}
+
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+func (b *JobEventBus) unsubscribe(sub *JobSubscription) {
+	sub.close()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Publish sends the event to every subscriber. A nil JobEventBus discards it.
+func (b *JobEventBus) Publish(ctx context.Context, event *JobEvent) error {
+	if !b.publish(ctx.Done(), event) {
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+// publish sends the event to every subscriber until done is closed, it
+// returns false then.
+func (b *JobEventBus) publish(done <-chan struct{}, event *JobEvent) bool {
+	if b == nil {
+		return true
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		select {
+		case sub.events <- event:
+		case <-sub.done:
+		case <-done:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Close closes all the subscriptions.
+func (b *JobEventBus) Close() {
+	b.mu.Lock()
+	subs := b.subs
+	b.subs = map[*JobSubscription]struct{}{}
+	b.closed = true
+	b.mu.Unlock()
+
+	for sub := range subs {
+		sub.close()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range subs {
+		close(sub.events)
+	}
+}
+
+// CollectJobEvents registers the events received by the given subscription in
+// the MetricsCollector until the subscription is closed: the enqueued Jobs are
+// discovered and the JobResults of the finished ones are processed. It lets a
+// MetricsCollector be fed by a JobEventBus instead of the WorkerPool, starting
+// and stopping it is up to the caller.
+func CollectJobEvents(sub *JobSubscription, mc MetricsCollector) {
+	rc := AdaptMetricsCollector(mc)
+	for event := range sub.Events() {
+		switch event.Type {
+		case JobEnqueued:
+			rc.Discover(event.Job)
+		case JobSucceeded, JobFailed:
+			rc.Processed(event.Job, event.Result)
+		}
+	}
+}
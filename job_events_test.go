@@ -0,0 +1,124 @@
+package gitcollector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPoolEvents(t *testing.T) {
+	var require = require.New(t)
+
+	bus := NewJobEventBus()
+	sub := bus.Subscribe(100)
+	mc := &testErrorMetrics{}
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		CollectJobEvents(bus.Subscribe(100), mc)
+	}()
+
+	queue := make(chan Job, 5)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{
+		Policies: &Policies{Retry: &RetryPolicy{Attempts: 3}},
+		Events:   bus,
+	})
+
+	wp.SetWorkers(1)
+	wp.Run()
+
+	var attempts int
+	queue <- &testJob{id: "ok"}
+	queue <- &testJob{id: "retry", process: func(string) error {
+		attempts++
+		if attempts < 2 {
+			return testTimeoutError{}
+		}
+
+		return nil
+	}}
+	queue <- &testJob{id: "fail", process: func(string) error {
+		return fmt.Errorf("foo")
+	}}
+	close(queue)
+
+	wp.Wait()
+	bus.Close()
+	<-collected
+
+	events := map[string][]JobEventType{}
+	for event := range sub.Events() {
+		id := event.Job.(*testJob).id
+		events[id] = append(events[id], event.Type)
+		require.False(event.Time.IsZero())
+
+		switch event.Type {
+		case JobEnqueued:
+			require.Empty(event.Worker)
+			require.Zero(event.Attempt)
+		case JobRetried:
+			require.Equal("retry", id)
+			require.Equal(2, event.Attempt)
+			require.Equal(testTimeoutError{}, event.Err)
+			require.NotEmpty(event.Worker)
+		case JobSucceeded:
+			require.Nil(event.Result.Failure)
+		case JobFailed:
+			require.Equal("fail", id)
+			require.Equal(1, event.Attempt)
+			require.Equal(ErrorClassUnknown, event.Result.Failure.Class)
+		}
+	}
+
+	require.Equal(map[string][]JobEventType{
+		"ok": {JobEnqueued, JobStarted, JobSucceeded},
+		"retry": {
+			JobEnqueued, JobStarted, JobRetried, JobSucceeded,
+		},
+		"fail": {JobEnqueued, JobStarted, JobFailed},
+	}, events)
+
+	// the events feed the MetricsCollectors too
+	mc.Lock()
+	defer mc.Unlock()
+	require.Equal(2, mc.success)
+	require.Len(mc.failures, 1)
+}
+
+func TestJobEventBus(t *testing.T) {
+	var require = require.New(t)
+
+	ctx := context.Background()
+	require.NoError((*JobEventBus)(nil).Publish(ctx, &JobEvent{}))
+
+	bus := NewJobEventBus()
+	sub := bus.Subscribe(0)
+	blocked := bus.Subscribe(0)
+
+	// a subscriber without room blocks the publishing until the context
+	// is done
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	err := bus.Publish(canceled, &JobEvent{Type: JobStarted})
+	require.Equal(context.Canceled, err)
+
+	// closed subscriptions don't block publishing
+	blocked.Close()
+	_, ok := <-blocked.Events()
+	require.False(ok)
+
+	go func() {
+		require.NoError(bus.Publish(ctx, &JobEvent{Type: JobEnqueued}))
+	}()
+
+	event := <-sub.Events()
+	require.Equal(JobEnqueued, event.Type)
+
+	bus.Close()
+	_, ok = <-sub.Events()
+	require.False(ok)
+	_, ok = <-bus.Subscribe(1).Events()
+	require.False(ok)
+}
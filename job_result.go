@@ -0,0 +1,65 @@
+package gitcollector
+
+import "time"
+
+// JobResult holds the information about a processed Job.
+type JobResult struct {
+	// Elapsed is the time spent processing the Job.
+	Elapsed time.Duration
+	// TransferStats is the data fetched by the Job, zero if it doesn't
+	// implement TransferJob.
+	TransferStats
+	// Failure is the classified error of a failed Job, nil if it
+	// succeeded.
+	Failure *JobFailure
+}
+
+// NewJobResult builds the JobResult of the given Job classifying its error,
+// if any.
+func NewJobResult(job Job, err error, elapsed time.Duration) *JobResult {
+	r := &JobResult{
+		Elapsed:       elapsed,
+		TransferStats: JobTransfer(job),
+	}
+
+	if err != nil {
+		r.Failure = NewJobFailure(err, elapsed)
+	}
+
+	return r
+}
+
+// AdaptMetricsCollector returns the given MetricsCollector as a
+// ResultMetricsCollector, so the ones written before it existed can be used
+// wherever a JobResult is reported. The JobResults are sent to the collectors
+// not implementing it through Latency and Success, FailWithError or Fail.
+func AdaptMetricsCollector(mc MetricsCollector) ResultMetricsCollector {
+	if rc, ok := mc.(ResultMetricsCollector); ok {
+		return rc
+	}
+
+	return &metricsAdapter{mc}
+}
+
+type metricsAdapter struct {
+	MetricsCollector
+}
+
+// Processed implements the ResultMetricsCollector interface.
+func (a *metricsAdapter) Processed(job Job, r *JobResult) {
+	if mc, ok := a.MetricsCollector.(LatencyMetricsCollector); ok {
+		mc.Latency(job, r.Elapsed)
+	}
+
+	if r.Failure == nil {
+		a.Success(job)
+		return
+	}
+
+	if mc, ok := a.MetricsCollector.(ErrorMetricsCollector); ok {
+		mc.FailWithError(job, r.Failure)
+		return
+	}
+
+	a.Fail(job)
+}
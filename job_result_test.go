@@ -0,0 +1,96 @@
+package gitcollector
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testTransferJob struct {
+	testJob
+	transfer TransferStats
+}
+
+func (j *testTransferJob) JobTransfer() TransferStats { return j.transfer }
+
+type testResultMetrics struct {
+	hollowMetricsCollector
+	sync.Mutex
+	results map[string]*JobResult
+}
+
+var _ ResultMetricsCollector = (*testResultMetrics)(nil)
+
+func (mc *testResultMetrics) Processed(job Job, r *JobResult) {
+	mc.Lock()
+	defer mc.Unlock()
+	mc.results[job.(*testTransferJob).id] = r
+}
+
+func TestWorkerPoolResultMetrics(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 5)
+	mc := &testResultMetrics{results: map[string]*JobResult{}}
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{
+		Metrics: mc,
+	})
+
+	wp.SetWorkers(2)
+	wp.Run()
+
+	transfer := TransferStats{BytesFetched: 1024, ObjectsPacked: 12}
+	queue <- &testTransferJob{
+		testJob:  testJob{id: "ok"},
+		transfer: transfer,
+	}
+	queue <- &testTransferJob{testJob: testJob{
+		id: "failed",
+		process: func(string) error {
+			return context.DeadlineExceeded
+		},
+	}}
+	close(queue)
+
+	wp.Wait()
+
+	mc.Lock()
+	defer mc.Unlock()
+	require.Len(mc.results, 2)
+	require.Equal(transfer, mc.results["ok"].TransferStats)
+	require.Nil(mc.results["ok"].Failure)
+	require.Zero(mc.results["failed"].BytesFetched)
+	require.Equal(ErrorClassTimeout, mc.results["failed"].Failure.Class)
+	require.Equal(ErrorCodeTimeout, mc.results["failed"].Failure.Code)
+}
+
+type testLatencyMetrics struct {
+	testErrorMetrics
+	latencies []time.Duration
+}
+
+func (mc *testLatencyMetrics) Latency(_ Job, elapsed time.Duration) {
+	mc.latencies = append(mc.latencies, elapsed)
+}
+
+func TestAdaptMetricsCollector(t *testing.T) {
+	var require = require.New(t)
+
+	rc := &testResultMetrics{}
+	require.True(AdaptMetricsCollector(rc) == rc)
+
+	mc := &testLatencyMetrics{}
+	adapted := AdaptMetricsCollector(mc)
+	job := &testJob{}
+	adapted.Processed(job, NewJobResult(job, nil, time.Second))
+	adapted.Processed(job, NewJobResult(job, context.Canceled, 2*time.Second))
+
+	require.Equal([]time.Duration{time.Second, 2 * time.Second}, mc.latencies)
+	require.Equal(1, mc.success)
+	require.Len(mc.failures, 1)
+	require.Equal(ErrorClassCanceled, mc.failures[0].Class)
+	require.Equal(2*time.Second, mc.failures[0].Elapsed)
+}
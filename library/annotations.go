@@ -0,0 +1,176 @@
+package library
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrLocationPinned is returned when a pinned location is deleted.
+	ErrLocationPinned = errors.NewKind("location %s is pinned")
+
+	// ErrLocationNoUpdate is returned when a repository is added to a
+	// location marked as do-not-update.
+	ErrLocationNoUpdate = errors.NewKind(
+		"location %s is marked as do-not-update")
+)
+
+// AnnotationsDir is the directory of the library where the annotations of
+// the locations are stored.
+const AnnotationsDir = ".annotations"
+
+const annotationExt = ".json"
+
+// Annotation holds the metadata set by the operators on a location to manage
+// its exceptions.
+type Annotation struct {
+	LocationID borges.LocationID `json:"location"`
+	// Pinned locations can't be deleted.
+	Pinned bool `json:"pinned,omitempty"`
+	// NoUpdate locations aren't fetched again, no repositories are added
+	// to them and the maintenance tasks don't modify them.
+	NoUpdate bool `json:"no_update,omitempty"`
+	// Notes are free-form comments about the location.
+	Notes   []string  `json:"notes,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+func (a *Annotation) empty() bool {
+	return !a.Pinned && !a.NoUpdate && len(a.Notes) == 0
+}
+
+// Annotations stores the Annotations of the locations of a library in its
+// AnnotationsDir. They're read every time they're checked, so the changes
+// made by the operators are seen by the running processes.
+type Annotations struct {
+	fs billy.Filesystem
+}
+
+// NewAnnotations builds a new Annotations for the library stored in the given
+// filesystem.
+func NewAnnotations(fs billy.Filesystem) *Annotations {
+	return &Annotations{fs: fs}
+}
+
+// Get returns the Annotation of the location, an empty one if it has none.
+func (a *Annotations) Get(id borges.LocationID) (*Annotation, error) {
+	f, err := a.fs.Open(a.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Annotation{LocationID: id}, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	an := &Annotation{}
+	if err := json.Unmarshal(data, an); err != nil {
+		return nil, err
+	}
+
+	return an, nil
+}
+
+// Set stores the Annotation of its location, an empty Annotation removes it.
+func (a *Annotations) Set(an *Annotation) error {
+	if an.empty() {
+		err := a.fs.Remove(a.path(an.LocationID))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	if err := a.fs.MkdirAll(AnnotationsDir, 0755); err != nil {
+		return err
+	}
+
+	an.Updated = time.Now().UTC()
+	data, err := json.Marshal(an)
+	if err != nil {
+		return err
+	}
+
+	// the annotation is written to a temporal file and renamed so it's
+	// never read half written.
+	tmp := a.path(an.LocationID) + ".tmp"
+	if err := util.WriteFile(a.fs, tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return a.fs.Rename(tmp, a.path(an.LocationID))
+}
+
+// List returns the Annotations of the library sorted by location.
+func (a *Annotations) List() ([]*Annotation, error) {
+	files, err := a.fs.ReadDir(AnnotationsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var list []*Annotation
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, annotationExt) {
+			continue
+		}
+
+		id := borges.LocationID(strings.TrimSuffix(name, annotationExt))
+		an, err := a.Get(id)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, an)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LocationID < list[j].LocationID
+	})
+
+	return list, nil
+}
+
+// NoUpdate returns whether the location is marked as do-not-update. The
+// locations whose annotation can't be read are considered marked, so they're
+// not modified by mistake. It's false for a nil Annotations.
+func (a *Annotations) NoUpdate(id borges.LocationID) bool {
+	if a == nil || id == "" {
+		return false
+	}
+
+	an, err := a.Get(id)
+	return err != nil || an.NoUpdate
+}
+
+func (a *Annotations) path(id borges.LocationID) string {
+	return a.fs.Join(AnnotationsDir, string(id)+annotationExt)
+}
+
+// WithAnnotations is a JobSetupFn setting the Annotations of the Jobs.
+func WithAnnotations(a *Annotations) JobSetupFn {
+	return func(job *Job) error {
+		job.Annotations = a
+		return nil
+	}
+}
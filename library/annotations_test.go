@@ -0,0 +1,61 @@
+package library
+
+import (
+	"testing"
+
+	"github.com/src-d/go-borges"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+func TestAnnotations(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	annotations := NewAnnotations(fs)
+
+	list, err := annotations.List()
+	require.NoError(err)
+	require.Empty(list)
+
+	an, err := annotations.Get("foo")
+	require.NoError(err)
+	require.Equal(&Annotation{LocationID: "foo"}, an)
+	require.False(annotations.NoUpdate("foo"))
+
+	an.NoUpdate = true
+	an.Notes = []string{"license under review"}
+	require.NoError(annotations.Set(an))
+	require.NoError(annotations.Set(&Annotation{
+		LocationID: "bar",
+		Pinned:     true,
+	}))
+	require.True(annotations.NoUpdate("foo"))
+	require.False(annotations.NoUpdate("bar"))
+
+	list, err = annotations.List()
+	require.NoError(err)
+	require.Len(list, 2)
+	require.Equal(borges.LocationID("bar"), list[0].LocationID)
+	require.True(list[0].Pinned)
+	require.Equal(borges.LocationID("foo"), list[1].LocationID)
+	require.Equal([]string{"license under review"}, list[1].Notes)
+	require.False(list[1].Updated.IsZero())
+
+	// an empty annotation removes it.
+	require.NoError(annotations.Set(&Annotation{LocationID: "foo"}))
+	require.False(annotations.NoUpdate("foo"))
+	list, err = annotations.List()
+	require.NoError(err)
+	require.Len(list, 1)
+
+	// unreadable annotations are considered do-not-update.
+	require.NoError(util.WriteFile(
+		fs, annotations.path("baz"), []byte("{"), 0644,
+	))
+	require.True(annotations.NoUpdate("baz"))
+
+	var nilAnnotations *Annotations
+	require.False(nilAnnotations.NoUpdate("baz"))
+}
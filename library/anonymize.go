@@ -0,0 +1,291 @@
+package library
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// AnonymizedPrefix is the prefix of the hashes given by an Anonymizer.
+const AnonymizedPrefix = "anon-"
+
+// AnonymizedFile is the default name of the file where the mapping of the
+// hashes to their identifiers is kept.
+const AnonymizedFile = "gitcollector.anonymized"
+
+// AnonymizedFields are the log fields whose values are always replaced by
+// their hashes, the rest are only scrubbed of the known identifiers.
+var AnonymizedFields = []string{
+	"url", "endpoint", "endpoints", "merged",
+	"repository", "location", "root", "head",
+	"org", "organization",
+}
+
+// AnonymizerOpts represents configuration options for an Anonymizer.
+type AnonymizerOpts struct {
+	// Key is the secret the identifiers are hashed with, so they can't be
+	// guessed hashing the names of public repositories.
+	Key []byte
+	// Mapping receives a CSV row with the hash and the identifier the
+	// first time every identifier is hashed, nil keeps none.
+	Mapping io.Writer
+}
+
+// Anonymizer replaces the identifiers of the repositories, like endpoints,
+// locations or organizations, with keyed hashes in the metrics and logs, so
+// they can be shipped to third-party monitoring while collecting private code.
+// The same identifier always has the same hash, and the mapping between them
+// is only kept locally. A nil Anonymizer leaves the identifiers untouched.
+type Anonymizer struct {
+	opts *AnonymizerOpts
+
+	mu      sync.Mutex
+	mapping *csv.Writer
+	seen    map[string]bool
+	err     error
+}
+
+// NewAnonymizer builds a new Anonymizer.
+func NewAnonymizer(opts *AnonymizerOpts) *Anonymizer {
+	a := &Anonymizer{opts: opts, seen: map[string]bool{}}
+	if opts.Mapping != nil {
+		a.mapping = csv.NewWriter(opts.Mapping)
+	}
+
+	return a
+}
+
+// Hash returns the hash of the identifier, recording it in the mapping the
+// first time. Empty identifiers are kept.
+func (a *Anonymizer) Hash(value string) string {
+	if a == nil || value == "" {
+		return value
+	}
+
+	mac := hmac.New(sha256.New, a.opts.Key)
+	mac.Write([]byte(value))
+	hash := AnonymizedPrefix + hex.EncodeToString(mac.Sum(nil)[:8])
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.mapping != nil && !a.seen[hash] && a.err == nil {
+		a.seen[hash] = true
+		if err := a.mapping.Write([]string{hash, value}); err != nil {
+			a.err = err
+		} else {
+			a.mapping.Flush()
+			a.err = a.mapping.Error()
+		}
+	}
+
+	return hash
+}
+
+// Err returns the first error writing the mapping, the identifiers hashed from
+// then on aren't recorded.
+func (a *Anonymizer) Err() error {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// Logger wraps the given logger replacing the values of the AnonymizedFields
+// with their hashes and the given identifiers with theirs wherever they're
+// found in the messages, errors and the rest of fields. The repository IDs of
+// the endpoints are replaced too.
+func (a *Anonymizer) Logger(l log.Logger, identifiers ...string) log.Logger {
+	if a == nil {
+		return l
+	}
+
+	return (&anonymizedLogger{a: a, l: l}).with(identifiers)
+}
+
+// JobLogger returns the logger of the Job replacing its identifiers.
+func (a *Anonymizer) JobLogger(job *Job) log.Logger {
+	logger := job.Logger
+	if logger == nil {
+		logger = log.New(nil)
+	}
+
+	identifiers := append([]string{}, job.Endpoints...)
+	if job.LocationID != "" {
+		identifiers = append(identifiers, string(job.LocationID))
+	}
+
+	// an anonymized logger isn't wrapped again, it also replaces the
+	// identifiers of the Job.
+	if l, ok := logger.(*anonymizedLogger); ok {
+		return l.with(identifiers)
+	}
+
+	return a.Logger(logger, identifiers...)
+}
+
+// WithAnonymizer is a JobSetupFn replacing the logger of the Jobs with one
+// replacing their identifiers.
+func WithAnonymizer(a *Anonymizer) JobSetupFn {
+	return func(job *Job) error {
+		if a != nil {
+			job.Logger = a.JobLogger(job)
+		}
+
+		return nil
+	}
+}
+
+type anonymizedLogger struct {
+	a           *Anonymizer
+	l           log.Logger
+	identifiers []string
+	replacer    *strings.Replacer
+}
+
+var _ log.Logger = (*anonymizedLogger)(nil)
+
+// with returns a copy of the logger also replacing the given identifiers.
+func (l *anonymizedLogger) with(identifiers []string) *anonymizedLogger {
+	all := append([]string{}, l.identifiers...)
+	for _, id := range identifiers {
+		all = append(all, id)
+		if repo, err := NewRepositoryID(id); err == nil {
+			all = append(all, repo.String())
+		}
+	}
+
+	all = dedup(all)
+
+	// the longest identifiers are replaced first, so a repository ID
+	// doesn't break its endpoint.
+	sort.Slice(all, func(i, j int) bool {
+		return len(all[i]) > len(all[j])
+	})
+
+	var pairs []string
+	for _, id := range all {
+		pairs = append(pairs, id, l.a.Hash(id))
+	}
+
+	return &anonymizedLogger{
+		a:           l.a,
+		l:           l.l,
+		identifiers: all,
+		replacer:    strings.NewReplacer(pairs...),
+	}
+}
+
+func (l *anonymizedLogger) scrub(s string) string {
+	return l.replacer.Replace(s)
+}
+
+func (l *anonymizedLogger) fields(f log.Fields) log.Fields {
+	anonymized := make(log.Fields, len(f))
+	for k, v := range f {
+		anonymized[k] = l.value(k, v)
+	}
+
+	return anonymized
+}
+
+func (l *anonymizedLogger) value(key string, v interface{}) interface{} {
+	hash := l.scrub
+	for _, f := range AnonymizedFields {
+		if f == key {
+			hash = l.a.Hash
+			break
+		}
+	}
+
+	switch v := v.(type) {
+	case []string:
+		values := make([]string, len(v))
+		for i, s := range v {
+			values[i] = hash(s)
+		}
+
+		return values
+	case string:
+		return hash(v)
+	case fmt.Stringer:
+		return hash(v.String())
+	case error:
+		return l.scrub(v.Error())
+	}
+
+	// like borges.LocationID
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.String {
+		return hash(rv.String())
+	}
+
+	return v
+}
+
+func (l *anonymizedLogger) New(f log.Fields) log.Logger {
+	var identifiers []string
+	for k, v := range f {
+		if k == "url" || k == "endpoint" || k == "merged" {
+			identifiers = append(identifiers, fmt.Sprint(v))
+		}
+	}
+
+	next := l.with(identifiers)
+	next.l = l.l.New(l.fields(f))
+	return next
+}
+
+func (l *anonymizedLogger) With(f log.Fields) log.Logger {
+	return l.New(f)
+}
+
+func (l *anonymizedLogger) Debugf(format string, args ...interface{}) {
+	l.l.Debugf("%s", l.scrub(fmt.Sprintf(format, args...)))
+}
+
+func (l *anonymizedLogger) Infof(format string, args ...interface{}) {
+	l.l.Infof("%s", l.scrub(fmt.Sprintf(format, args...)))
+}
+
+func (l *anonymizedLogger) Warningf(format string, args ...interface{}) {
+	l.l.Warningf("%s", l.scrub(fmt.Sprintf(format, args...)))
+}
+
+func (l *anonymizedLogger) Errorf(
+	err error,
+	format string,
+	args ...interface{},
+) {
+	if err != nil {
+		err = errors.New(l.scrub(err.Error()))
+	}
+
+	l.l.Errorf(err, "%s", l.scrub(fmt.Sprintf(format, args...)))
+}
+
+func dedup(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var result []string
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+
+		seen[v] = true
+		result = append(result, v)
+	}
+
+	return result
+}
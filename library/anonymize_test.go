@@ -0,0 +1,113 @@
+package library
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/src-d/go-borges"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// recordLogger is a log.Logger keeping the messages and fields logged.
+type recordLogger struct {
+	fields log.Fields
+	lines  *[]string
+}
+
+func (l *recordLogger) New(f log.Fields) log.Logger {
+	fields := log.Fields{}
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+
+	for k, v := range f {
+		fields[k] = v
+	}
+
+	return &recordLogger{fields: fields, lines: l.lines}
+}
+
+func (l *recordLogger) With(f log.Fields) log.Logger { return l.New(f) }
+
+func (l *recordLogger) log(msg string) {
+	*l.lines = append(*l.lines, fmt.Sprintf("%s %v", msg, l.fields))
+}
+
+func (l *recordLogger) Debugf(format string, args ...interface{}) {
+	l.log(fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Infof(format string, args ...interface{}) {
+	l.log(fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Warningf(format string, args ...interface{}) {
+	l.log(fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Errorf(err error, format string, args ...interface{}) {
+	l.log(fmt.Sprintf(format, args...) + ": " + err.Error())
+}
+
+func TestAnonymizer(t *testing.T) {
+	var require = require.New(t)
+
+	var mapping bytes.Buffer
+	a := NewAnonymizer(&AnonymizerOpts{
+		Key:     []byte("secret"),
+		Mapping: &mapping,
+	})
+
+	endpoint := "https://github.com/src-d/gitcollector"
+	hash := a.Hash(endpoint)
+	require.True(strings.HasPrefix(hash, AnonymizedPrefix))
+	require.Equal(hash, a.Hash(endpoint))
+	require.NotEqual(hash, NewAnonymizer(&AnonymizerOpts{
+		Key: []byte("other"),
+	}).Hash(endpoint))
+	require.Empty(a.Hash(""))
+
+	rows, err := csv.NewReader(&mapping).ReadAll()
+	require.NoError(err)
+	require.Equal([][]string{{hash, endpoint}}, rows)
+	require.NoError(a.Err())
+
+	var nilAnonymizer *Anonymizer
+	require.Equal(endpoint, nilAnonymizer.Hash(endpoint))
+
+	var lines []string
+	job := &Job{
+		ID:        "1",
+		Endpoints: []string{endpoint},
+		Logger:    &recordLogger{lines: &lines},
+	}
+
+	require.NoError(WithAnonymizer(a)(job))
+	logger := job.Logger.New(log.Fields{
+		"id":       job.ID,
+		"location": borges.LocationID("f00"),
+		"url":      "https://github.com/src-d/borges",
+	})
+
+	logger.Infof("repository %s already exists", "github.com/src-d/gitcollector")
+	logger.Errorf(
+		fmt.Errorf("couldn't fetch https://github.com/src-d/borges"),
+		"failed",
+	)
+
+	// rescheduled jobs aren't anonymized twice
+	require.NoError(WithAnonymizer(a)(job))
+	job.Logger.Warningf("retrying %s", endpoint)
+
+	out := strings.Join(lines, "\n")
+	require.NotContains(out, "src-d")
+	require.Contains(out, a.Hash("github.com/src-d/gitcollector"))
+	require.Contains(out, a.Hash("https://github.com/src-d/borges"))
+	require.Contains(out, a.Hash("f00"))
+	require.Contains(out, "id:1")
+	require.Contains(lines[2], hash)
+}
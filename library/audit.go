@@ -0,0 +1,194 @@
+package library
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+// AuditFile is the default name of the file where the destructive operations
+// on a library are recorded.
+const AuditFile = "gitcollector.audit"
+
+// AuditAction is a destructive operation on a library.
+type AuditAction string
+
+const (
+	// AuditDelete is a location moved to the trash, a takedown among
+	// others depending on its reason.
+	AuditDelete AuditAction = "delete"
+	// AuditRestore is a location restored from the trash over the library.
+	AuditRestore AuditAction = "restore"
+	// AuditPurge is a location permanently removed from the trash.
+	AuditPurge AuditAction = "purge"
+	// AuditEvict is a fork removed from a location to store another one.
+	AuditEvict AuditAction = "evict"
+	// AuditMigrate is a migration writing into the library.
+	AuditMigrate AuditAction = "migrate"
+	// AuditRepack is a repack rewriting the packfiles of the library.
+	AuditRepack AuditAction = "repack"
+	// AuditRebuild is a siva file truncated to its last good index by a
+	// rebuild of the library.
+	AuditRebuild AuditAction = "rebuild"
+)
+
+// AuditEntry is a destructive operation recorded in an AuditLog.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Actor is who performed the operation.
+	Actor  string      `json:"actor"`
+	Action AuditAction `json:"action"`
+	// LocationID is the location modified, empty for the operations on
+	// the whole library.
+	LocationID borges.LocationID `json:"location,omitempty"`
+	// Reason is why the operation was performed.
+	Reason string `json:"reason,omitempty"`
+	// Detail describes the outcome of the operation.
+	Detail string `json:"detail,omitempty"`
+}
+
+// AuditQuery selects the entries of an AuditLog, the empty fields match any
+// entry.
+type AuditQuery struct {
+	Action     AuditAction
+	LocationID borges.LocationID
+	Actor      string
+	Since      time.Time
+	Until      time.Time
+}
+
+func (q *AuditQuery) match(e *AuditEntry) bool {
+	if q == nil {
+		return true
+	}
+
+	return (q.Action == "" || q.Action == e.Action) &&
+		(q.LocationID == "" || q.LocationID == e.LocationID) &&
+		(q.Actor == "" || q.Actor == e.Actor) &&
+		(q.Since.IsZero() || !e.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || e.Time.Before(q.Until))
+}
+
+// AuditLog records who performed the destructive operations on a library,
+// when and why, for the compliance reviews of the archive. The entries are
+// only appended to the file, one JSON object per line, and never rewritten.
+// A nil AuditLog doesn't record anything.
+type AuditLog struct {
+	mu    sync.Mutex
+	fs    billy.Filesystem
+	path  string
+	actor string
+}
+
+// NewAuditLog builds a new AuditLog recorded in the given path of the library
+// filesystem, AuditFile by default, for the operations performed by the given
+// actor, DefaultActor by default.
+func NewAuditLog(fs billy.Filesystem, path, actor string) *AuditLog {
+	if path == "" {
+		path = AuditFile
+	}
+
+	if actor == "" {
+		actor = DefaultActor()
+	}
+
+	return &AuditLog{fs: fs, path: path, actor: actor}
+}
+
+// DefaultActor returns the user running the process and its host, as
+// user@host.
+func DefaultActor() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s@%s", name, host)
+}
+
+// Record appends an entry for the given operation performed now.
+func (l *AuditLog) Record(
+	action AuditAction,
+	id borges.LocationID,
+	reason, detail string,
+) error {
+	if l == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(&AuditEntry{
+		Time:       time.Now().UTC(),
+		Actor:      l.actor,
+		Action:     action,
+		LocationID: id,
+		Reason:     reason,
+		Detail:     detail,
+	})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := l.fs.OpenFile(
+		l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644,
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Entries returns the recorded entries matching the query, the oldest first.
+func (l *AuditLog) Entries(q *AuditQuery) ([]*AuditEntry, error) {
+	if l == nil {
+		return nil, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := l.fs.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := &AuditEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, err
+		}
+
+		if q.match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, scanner.Err()
+}
@@ -0,0 +1,69 @@
+package library
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestAuditLog(t *testing.T) {
+	var require = require.New(t)
+
+	var none *AuditLog
+	require.NoError(none.Record(AuditDelete, "foo", "gc", ""))
+	entries, err := none.Entries(nil)
+	require.NoError(err)
+	require.Empty(entries)
+
+	fs := memfs.New()
+	audit := NewAuditLog(fs, "", "alice")
+	entries, err = audit.Entries(nil)
+	require.NoError(err)
+	require.Empty(entries)
+
+	start := time.Now().UTC()
+	require.NoError(audit.Record(AuditDelete, "foo", "takedown", ""))
+	require.NoError(audit.Record(AuditEvict, "bar", "fork sampling", "x"))
+
+	// other actors append to the same log
+	require.NoError(NewAuditLog(fs, "", "bob").Record(AuditRepack, "", "", ""))
+
+	f, err := fs.Open(AuditFile)
+	require.NoError(err)
+	data, err := ioutil.ReadAll(f)
+	require.NoError(err)
+	require.NoError(f.Close())
+	require.Contains(string(data), `"reason":"takedown"`)
+
+	entries, err = audit.Entries(nil)
+	require.NoError(err)
+	require.Len(entries, 3)
+	require.Equal("alice", entries[0].Actor)
+	require.Equal(AuditDelete, entries[0].Action)
+	require.EqualValues("foo", entries[0].LocationID)
+	require.Equal("takedown", entries[0].Reason)
+	require.False(entries[0].Time.Before(start.Truncate(time.Second)))
+	require.Equal("bob", entries[2].Actor)
+
+	entries, err = audit.Entries(&AuditQuery{Action: AuditEvict})
+	require.NoError(err)
+	require.Len(entries, 1)
+	require.Equal("x", entries[0].Detail)
+
+	entries, err = audit.Entries(&AuditQuery{Actor: "alice", LocationID: "foo"})
+	require.NoError(err)
+	require.Len(entries, 1)
+
+	entries, err = audit.Entries(&AuditQuery{Until: start.Add(-time.Hour)})
+	require.NoError(err)
+	require.Empty(entries)
+
+	entries, err = audit.Entries(&AuditQuery{Since: start.Add(-time.Hour)})
+	require.NoError(err)
+	require.Len(entries, 3)
+
+	require.NotEmpty(NewAuditLog(fs, "", "").actor)
+}
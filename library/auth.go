@@ -0,0 +1,78 @@
+package library
+
+import (
+	"context"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+// AuthProvider produces the authentication used to fetch from an endpoint.
+// It's called before every fetch, so short lived credentials like signatures
+// or access tokens can be renewed.
+type AuthProvider interface {
+	Auth(ctx context.Context, endpoint string) (transport.AuthMethod, error)
+}
+
+// AuthFn is an AuthProvider as a function.
+type AuthFn func(ctx context.Context, endpoint string) (transport.AuthMethod, error)
+
+var (
+	_ AuthProvider = AuthFn(nil)
+	_ AuthProvider = TokenAuth(nil)
+)
+
+// Auth implements the AuthProvider interface.
+func (fn AuthFn) Auth(
+	ctx context.Context,
+	endpoint string,
+) (transport.AuthMethod, error) {
+	return fn(ctx, endpoint)
+}
+
+// TokenAuth is an AuthProvider authenticating with the tokens of an
+// AuthTokenFn using HTTP basic authentication. Endpoints without a token are
+// fetched without authentication.
+type TokenAuth AuthTokenFn
+
+// Auth implements the AuthProvider interface.
+func (fn TokenAuth) Auth(
+	_ context.Context,
+	endpoint string,
+) (transport.AuthMethod, error) {
+	if fn == nil {
+		return nil, nil
+	}
+
+	token := fn(endpoint)
+	if token == "" {
+		return nil, nil
+	}
+
+	return &http.BasicAuth{
+		Username: "gitcollector",
+		Password: token,
+	}, nil
+}
+
+// FetchAuth returns the authentication to fetch from the given endpoint using
+// the Auth of the Job, or its AuthToken if it's not set. It has to be called
+// before every fetch.
+func (j *Job) FetchAuth(
+	ctx context.Context,
+	endpoint string,
+) (transport.AuthMethod, error) {
+	if j.Auth != nil {
+		return j.Auth.Auth(ctx, endpoint)
+	}
+
+	return TokenAuth(j.AuthToken).Auth(ctx, endpoint)
+}
+
+// WithAuthProvider is a JobSetupFn setting the AuthProvider of the Jobs.
+func WithAuthProvider(provider AuthProvider) JobSetupFn {
+	return func(job *Job) error {
+		job.Auth = provider
+		return nil
+	}
+}
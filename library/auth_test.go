@@ -0,0 +1,58 @@
+package library
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+func TestJobFetchAuth(t *testing.T) {
+	var require = require.New(t)
+
+	job := &Job{AuthToken: getAuthTokenByOrg(map[string]string{
+		"src-d": "token",
+	})}
+
+	auth, err := job.FetchAuth(
+		context.Background(), "https://github.com/src-d/gitcollector",
+	)
+	require.NoError(err)
+	require.Equal(&http.BasicAuth{
+		Username: "gitcollector",
+		Password: "token",
+	}, auth)
+
+	auth, err = job.FetchAuth(
+		context.Background(), "https://github.com/bblfsh/sdk",
+	)
+	require.NoError(err)
+	require.Nil(auth)
+
+	var calls int
+	require.NoError(WithAuthProvider(AuthFn(func(
+		_ context.Context,
+		endpoint string,
+	) (transport.AuthMethod, error) {
+		calls++
+		return &http.TokenAuth{Token: endpoint}, nil
+	}))(job))
+
+	for i := 0; i < 2; i++ {
+		auth, err = job.FetchAuth(
+			context.Background(), "https://github.com/bblfsh/sdk",
+		)
+		require.NoError(err)
+		require.Equal(&http.TokenAuth{
+			Token: "https://github.com/bblfsh/sdk",
+		}, auth)
+	}
+
+	require.Equal(2, calls)
+
+	auth, err = (&Job{}).FetchAuth(context.Background(), "a")
+	require.NoError(err)
+	require.Nil(auth)
+}
@@ -0,0 +1,110 @@
+package library
+
+import (
+	"context"
+	"sync"
+
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// BackfillReport is the split of the repositories checked by a Backfill.
+type BackfillReport struct {
+	// Missing is the number of repositories not found in the library,
+	// they're downloaded.
+	Missing int
+	// Present is the number of repositories already in the library, their
+	// Jobs are converted to updates.
+	Present int
+	// Unchecked is the number of repositories that couldn't be looked up
+	// in the library, they're downloaded and the download updates them if
+	// they're found then.
+	Unchecked int
+}
+
+// Backfill checks the library before every download Job is scheduled, so the
+// missing repositories are downloaded and the ones already present updated
+// from a single discovery, instead of coordinating two schedulers configured
+// separately for a new and an existing library.
+type Backfill struct {
+	mu     sync.Mutex
+	report BackfillReport
+}
+
+// NewBackfill builds a new Backfill.
+func NewBackfill() *Backfill {
+	return &Backfill{}
+}
+
+// Report returns the split of the repositories checked until now.
+func (b *Backfill) Report() BackfillReport {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.report
+}
+
+func (b *Backfill) check(job *Job) {
+	if job.Type != JobDownload || len(job.Endpoints) == 0 || job.Lib == nil {
+		return
+	}
+
+	logger := job.Logger
+	if logger == nil {
+		logger = log.New(nil)
+	}
+
+	endpoint := job.Endpoints[0]
+	logger = logger.New(log.Fields{"url": endpoint})
+
+	id, err := job.RepositoryID(endpoint)
+	if err != nil {
+		b.count(&b.report.Unchecked)
+		return
+	}
+
+	ok, _, locID, err := job.Lib.Has(id)
+	if err != nil {
+		b.count(&b.report.Unchecked)
+		logger.Warningf("couldn't check the library: %s", err.Error())
+		return
+	}
+
+	if !ok {
+		b.count(&b.report.Missing)
+		return
+	}
+
+	job.Type = JobUpdate
+	job.LocationID = locID
+	b.count(&b.report.Present)
+	logger.With(log.Fields{"location": locID}).
+		Debugf("already in the library, scheduled as update")
+}
+
+func (b *Backfill) count(n *int) {
+	b.mu.Lock()
+	*n++
+	b.mu.Unlock()
+}
+
+// WithBackfill is a JobSetupFn converting the download Jobs of the
+// repositories already in the library of the Job to updates of their
+// location. It must be applied once the library of the Jobs is set, by
+// WithStorageTiers among others.
+func WithBackfill(b *Backfill) JobSetupFn {
+	return func(job *Job) error {
+		b.check(job)
+		return nil
+	}
+}
+
+// NewBackfillJobFn builds a JobFn processing the Jobs converted to updates by a
+// Backfill with the update JobFn and the rest with the download one.
+func NewBackfillJobFn(download, update JobFn) JobFn {
+	return func(ctx context.Context, job *Job) error {
+		if job.Type == JobUpdate {
+			return update(ctx, job)
+		}
+
+		return download(ctx, job)
+	}
+}
@@ -0,0 +1,86 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestBackfill(t *testing.T) {
+	var require = require.New(t)
+
+	lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+		Transactional: true,
+		TempFS:        memfs.New(),
+	})
+	require.NoError(err)
+
+	loc, err := lib.AddLocation("foo")
+	require.NoError(err)
+	r, err := loc.Init("github.com/src-d/foo")
+	require.NoError(err)
+	require.NoError(r.Commit())
+
+	backfill := NewBackfill()
+	setup := WithBackfill(backfill)
+
+	present := &Job{
+		Type:      JobDownload,
+		Lib:       lib,
+		Endpoints: []string{"https://github.com/src-d/foo"},
+	}
+	require.NoError(setup(present))
+	require.EqualValues(JobUpdate, present.Type)
+	require.Equal(borges.LocationID("foo"), present.LocationID)
+
+	missing := &Job{
+		Type:      JobDownload,
+		Lib:       lib,
+		Endpoints: []string{"https://github.com/src-d/bar"},
+	}
+	require.NoError(setup(missing))
+	require.EqualValues(JobDownload, missing.Type)
+
+	wrong := &Job{
+		Type:      JobDownload,
+		Lib:       lib,
+		Endpoints: []string{"https://github.com/src-d/foo"},
+		Naming: func(string) (borges.RepositoryID, error) {
+			return "", fmt.Errorf("wrong naming")
+		},
+	}
+	require.NoError(setup(wrong))
+	require.EqualValues(JobDownload, wrong.Type)
+
+	// the updates aren't checked
+	update := &Job{Type: JobUpdate, Lib: lib, LocationID: "bar"}
+	require.NoError(setup(update))
+
+	require.Equal(BackfillReport{
+		Missing:   1,
+		Present:   1,
+		Unchecked: 1,
+	}, backfill.Report())
+
+	var processed []JobType
+	fn := NewBackfillJobFn(
+		func(_ context.Context, j *Job) error {
+			processed = append(processed, JobDownload)
+			return nil
+		},
+		func(_ context.Context, j *Job) error {
+			processed = append(processed, JobUpdate)
+			return nil
+		},
+	)
+
+	ctx := context.Background()
+	require.NoError(fn(ctx, present))
+	require.NoError(fn(ctx, missing))
+	require.Equal([]JobType{JobUpdate, JobDownload}, processed)
+}
@@ -0,0 +1,255 @@
+package library
+
+import (
+	"context"
+	"sync"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// ErrDependencyFailed is returned when a Job is discarded because a Job it
+// depends on failed.
+var ErrDependencyFailed = errors.NewKind("job %s discarded: dependency %s failed")
+
+type jobState uint8
+
+const (
+	jobRunning jobState = iota + 1
+	jobSucceeded
+	jobFailed
+)
+
+type dependencies struct {
+	mu        sync.Mutex
+	schedule  gitcollector.JobScheduleFn
+	states    map[string]jobState
+	running   map[string]borges.LocationID
+	locations map[borges.LocationID]int
+	held      []*Job
+	changed   chan struct{}
+	closed    bool
+}
+
+// NewDependencyScheduleFn wraps the given JobScheduleFn holding back the Jobs
+// until the Jobs in their After field succeed and, for the ones with
+// AfterLocation, until there are no in-flight Jobs on their location. Jobs
+// depending on a failed Job are discarded. It must wrap the rest of the
+// JobScheduleFns since it needs to observe the result of the scheduled Jobs.
+func NewDependencyScheduleFn(
+	schedule gitcollector.JobScheduleFn,
+) gitcollector.JobScheduleFn {
+	d := &dependencies{
+		schedule:  schedule,
+		states:    map[string]jobState{},
+		running:   map[string]borges.LocationID{},
+		locations: map[borges.LocationID]int{},
+		changed:   make(chan struct{}),
+	}
+
+	return d.next
+}
+
+func (d *dependencies) next(ctx context.Context) (gitcollector.Job, error) {
+	for {
+		d.mu.Lock()
+		if job := d.ready(); job != nil {
+			d.start(job)
+			d.mu.Unlock()
+			return job, nil
+		}
+
+		changed := d.changed
+		if d.closed {
+			if len(d.running) == 0 {
+				d.discard(d.held...)
+				d.held = nil
+			}
+
+			empty := len(d.held) == 0
+			d.mu.Unlock()
+			if empty {
+				return nil, gitcollector.ErrJobSource.New()
+			}
+
+			if err := wait(ctx, changed); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		d.mu.Unlock()
+
+		j, err := d.schedule(ctx)
+		if err != nil {
+			if gitcollector.ErrJobSource.Is(err) {
+				d.mu.Lock()
+				d.closed = true
+				d.mu.Unlock()
+				continue
+			}
+
+			if gitcollector.ErrNewJobsNotFound.Is(err) && d.holding() {
+				if err := wait(ctx, changed); err != nil {
+					return nil, err
+				}
+
+				continue
+			}
+
+			return nil, err
+		}
+
+		job, ok := j.(*Job)
+		if !ok {
+			return j, nil
+		}
+
+		d.mu.Lock()
+		ready, failed := d.check(job)
+		switch {
+		case failed != "":
+			d.discard(job)
+		case ready:
+			d.start(job)
+			d.mu.Unlock()
+			return job, nil
+		default:
+			d.held = append(d.held, job)
+		}
+
+		d.mu.Unlock()
+	}
+}
+
+func wait(ctx context.Context, changed chan struct{}) error {
+	select {
+	case <-changed:
+		return nil
+	case <-ctx.Done():
+		return gitcollector.ErrNewJobsNotFound.New()
+	}
+}
+
+func (d *dependencies) holding() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.held) > 0
+}
+
+// ready returns the first held Job whose dependencies are satisfied,
+// discarding the ones with failed dependencies.
+func (d *dependencies) ready() *Job {
+	for i := 0; i < len(d.held); i++ {
+		job := d.held[i]
+		ready, failed := d.check(job)
+		if !ready && failed == "" {
+			continue
+		}
+
+		d.held = append(d.held[:i], d.held[i+1:]...)
+		if failed != "" {
+			d.discard(job)
+			i--
+			continue
+		}
+
+		return job
+	}
+
+	return nil
+}
+
+func (d *dependencies) check(job *Job) (bool, string) {
+	ready := true
+	for _, id := range job.After {
+		switch d.states[id] {
+		case jobSucceeded:
+		case jobFailed:
+			return false, id
+		default:
+			ready = false
+		}
+	}
+
+	if job.AfterLocation && job.LocationID != "" &&
+		d.locations[job.LocationID] > 0 {
+		ready = false
+	}
+
+	return ready, ""
+}
+
+func (d *dependencies) start(job *Job) {
+	d.states[job.ID] = jobRunning
+	d.running[job.ID] = job.LocationID
+	if job.LocationID != "" {
+		d.locations[job.LocationID]++
+	}
+
+	fn := job.ProcessFn
+	job.ProcessFn = func(ctx context.Context, job *Job) error {
+		var err error
+		if fn == nil {
+			err = ErrJobFnNotFound.New()
+		} else {
+			err = fn(ctx, job)
+		}
+
+		d.finish(job.ID, err == nil)
+		return err
+	}
+}
+
+func (d *dependencies) finish(id string, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if ok {
+		d.states[id] = jobSucceeded
+	} else {
+		d.states[id] = jobFailed
+	}
+
+	if loc, ok := d.running[id]; ok {
+		delete(d.running, id)
+		if loc != "" {
+			d.locations[loc]--
+			if d.locations[loc] <= 0 {
+				delete(d.locations, loc)
+			}
+		}
+	}
+
+	d.notify()
+}
+
+func (d *dependencies) discard(jobs ...*Job) {
+	for _, job := range jobs {
+		_, failed := d.check(job)
+		err := ErrDependencyFailed.New(job.ID, failed)
+		if failed == "" {
+			err = ErrDependencyFailed.New(job.ID, "never finished")
+		}
+
+		logger := job.Logger
+		if logger == nil {
+			logger = log.New(nil)
+		}
+
+		logger.Warningf(err.Error())
+		d.states[job.ID] = jobFailed
+	}
+
+	if len(jobs) > 0 {
+		d.notify()
+	}
+}
+
+func (d *dependencies) notify() {
+	close(d.changed)
+	d.changed = make(chan struct{})
+}
@@ -0,0 +1,95 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDependencyScheduleFn(t *testing.T) {
+	var require = require.New(t)
+
+	var (
+		queue = make(chan gitcollector.Job, 10)
+		done  []string
+	)
+
+	process := func(_ context.Context, j *Job) error {
+		done = append(done, j.ID)
+		if j.ID == "fail" {
+			return fmt.Errorf("failed")
+		}
+
+		return nil
+	}
+
+	schedule := NewDependencyScheduleFn(NewUpdateJobScheduleFn(
+		nil, queue, process, nil, nil,
+	))
+
+	jobs := []*Job{
+		{ID: "update", Type: JobUpdate, After: []string{"download"}},
+		{ID: "chained", Type: JobUpdate, After: []string{"update"}},
+		{ID: "dependent", Type: JobUpdate, After: []string{"fail"}},
+		{ID: "download", Type: JobUpdate, LocationID: "foo"},
+		{ID: "fail", Type: JobUpdate},
+		{ID: "location", Type: JobUpdate, LocationID: "foo",
+			AfterLocation: true},
+	}
+
+	for _, j := range jobs {
+		queue <- j
+	}
+
+	close(queue)
+
+	next := func() *Job {
+		ctx, cancel := context.WithTimeout(
+			context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		j, err := schedule(ctx)
+		require.NoError(err)
+		return j.(*Job)
+	}
+
+	ctx := context.Background()
+
+	download := next()
+	require.Equal("download", download.ID)
+
+	fail := next()
+	require.Equal("fail", fail.ID)
+
+	// location job is held while download is in-flight
+	ctx2, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	_, err := schedule(ctx2)
+	cancel()
+	require.True(gitcollector.ErrNewJobsNotFound.Is(err))
+
+	require.Error(fail.Process(ctx))
+	require.NoError(download.Process(ctx))
+
+	update := next()
+	require.Equal("update", update.ID)
+
+	location := next()
+	require.Equal("location", location.ID)
+	require.NoError(location.Process(ctx))
+
+	require.NoError(update.Process(ctx))
+	chained := next()
+	require.Equal("chained", chained.ID)
+	require.NoError(chained.Process(ctx))
+
+	_, err = schedule(ctx)
+	require.True(gitcollector.ErrJobSource.Is(err))
+
+	require.Equal([]string{
+		"fail", "download", "location", "update", "chained",
+	}, done)
+}
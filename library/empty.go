@@ -0,0 +1,175 @@
+package library
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// ErrUnknownEmptyPolicy is returned when an EmptyPolicy isn't supported.
+var ErrUnknownEmptyPolicy = errors.NewKind("unknown empty repository policy %q")
+
+// EmptyPolicy is the way repositories found empty on fetch are handled.
+type EmptyPolicy string
+
+const (
+	// EmptyFail makes the Job fail, the default.
+	EmptyFail EmptyPolicy = "fail"
+	// EmptySkip finishes the Job successfully without storing anything.
+	EmptySkip EmptyPolicy = "skip"
+	// EmptyPlaceholder stores the repository in a placeholder location
+	// so it's known by the library and updated later on.
+	EmptyPlaceholder EmptyPolicy = "placeholder"
+	// EmptyRetry makes the Job fail like EmptyFail, but the error can be
+	// retried by the gitcollector.RetryPolicy of the Job when its
+	// Retryable is EmptyRetryable.
+	EmptyRetry EmptyPolicy = "retry"
+)
+
+// PlaceholderPrefix is the prefix of the placeholder location IDs.
+const PlaceholderPrefix = "empty-"
+
+// EmptyRepositoryOpts represents configuration options for the handling of
+// empty repositories.
+type EmptyRepositoryOpts struct {
+	// Policy is the EmptyPolicy applied, default to EmptyFail.
+	Policy EmptyPolicy
+}
+
+// IsEmptyRepository returns whether the error was caused by an empty remote
+// repository.
+func IsEmptyRepository(err error) bool {
+	return gitcollector.ClassifyError(err) == gitcollector.ErrorClassEmpty
+}
+
+// EmptyRetryable reports whether a Job failed with the given error can be
+// retried with EmptyRetry: the empty repositories, which may be pushed to
+// later, along with the gitcollector.TransientError ones. It's meant to be
+// the Retryable of the gitcollector.RetryPolicy of the Jobs.
+func EmptyRetryable(err error) bool {
+	return IsEmptyRepository(err) || gitcollector.TransientError(err)
+}
+
+// PlaceholderLocationID returns the ID of the placeholder location for the
+// given repository.
+func PlaceholderLocationID(id borges.RepositoryID) borges.LocationID {
+	sum := sha1.Sum([]byte(id.String()))
+	return borges.LocationID(PlaceholderPrefix + hex.EncodeToString(sum[:]))
+}
+
+// NewEmptyRepositoryJobFn wraps the given JobFn applying the configured
+// EmptyPolicy to the Jobs failing because their repository is empty.
+func NewEmptyRepositoryJobFn(opts *EmptyRepositoryOpts, fn JobFn) (JobFn, error) {
+	if opts == nil {
+		opts = &EmptyRepositoryOpts{}
+	}
+
+	if opts.Policy == "" {
+		opts.Policy = EmptyFail
+	}
+
+	switch opts.Policy {
+	case EmptyFail, EmptyRetry:
+		return fn, nil
+	case EmptySkip, EmptyPlaceholder:
+	default:
+		return nil, ErrUnknownEmptyPolicy.New(opts.Policy)
+	}
+
+	return func(ctx context.Context, job *Job) error {
+		err := fn(ctx, job)
+		if err == nil || !IsEmptyRepository(err) {
+			return err
+		}
+
+		logger := jobLogger(job)
+		if opts.Policy == EmptySkip {
+			logger.Infof("empty repository skipped")
+			return nil
+		}
+
+		if err := createPlaceholder(job); err != nil {
+			return err
+		}
+
+		logger.With(log.Fields{"location": job.LocationID}).
+			Infof("empty repository stored as placeholder")
+		return nil
+	}, nil
+}
+
+func jobLogger(job *Job) log.Logger {
+	logger := job.Logger
+	if logger == nil {
+		logger = log.New(nil)
+	}
+
+	return logger.New(log.Fields{"id": job.ID, "endpoints": job.Endpoints})
+}
+
+func createPlaceholder(job *Job) error {
+	if len(job.Endpoints) == 0 {
+		return nil
+	}
+
+	lib, ok := job.Lib.(*siva.Library)
+	if !ok {
+		return ErrNotSivaLibrary.New()
+	}
+
+	endpoint := job.Endpoints[0]
+	id, err := job.RepositoryID(endpoint)
+	if err != nil {
+		return err
+	}
+
+	locID := PlaceholderLocationID(id)
+	loc, err := lib.AddLocation(locID)
+	if err != nil {
+		if !siva.ErrLocationExists.Is(err) {
+			return err
+		}
+
+		loc, err = lib.Location(locID)
+		if err != nil {
+			return err
+		}
+	}
+
+	repo, err := loc.Init(id)
+	if err != nil {
+		if borges.ErrRepositoryExists.Is(err) {
+			job.LocationID = locID
+			return nil
+		}
+
+		return err
+	}
+
+	cfg, err := repo.R().Config()
+	if err != nil {
+		repo.Close()
+		return err
+	}
+
+	if remote, ok := cfg.Remotes[id.String()]; ok {
+		remote.URLs = []string{endpoint}
+		if err := repo.R().Storer.SetConfig(cfg); err != nil {
+			repo.Close()
+			return err
+		}
+	}
+
+	if err := repo.Commit(); err != nil {
+		return err
+	}
+
+	job.LocationID = locID
+	return nil
+}
@@ -0,0 +1,100 @@
+package library
+
+import (
+	"context"
+	"testing"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+func TestEmptyRepositoryJobFn(t *testing.T) {
+	var require = require.New(t)
+
+	lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+		Transactional: true,
+		TempFS:        memfs.New(),
+	})
+	require.NoError(err)
+
+	var calls int
+	empty := func(context.Context, *Job) error {
+		calls++
+		return transport.ErrEmptyRemoteRepository
+	}
+
+	const endpoint = "git://github.com/src-d/gitcollector"
+	newJob := func() *Job {
+		return &Job{
+			Type:      JobDownload,
+			Lib:       lib,
+			Endpoints: []string{endpoint},
+		}
+	}
+
+	ctx := context.Background()
+
+	_, err = NewEmptyRepositoryJobFn(
+		&EmptyRepositoryOpts{Policy: "foo"}, empty)
+	require.True(ErrUnknownEmptyPolicy.Is(err))
+
+	fn, err := NewEmptyRepositoryJobFn(nil, empty)
+	require.NoError(err)
+	require.Equal(transport.ErrEmptyRemoteRepository, fn(ctx, newJob()))
+
+	fn, err = NewEmptyRepositoryJobFn(
+		&EmptyRepositoryOpts{Policy: EmptySkip}, empty)
+	require.NoError(err)
+	require.NoError(fn(ctx, newJob()))
+
+	// the retries are left to the retry policy of the job
+	fn, err = NewEmptyRepositoryJobFn(
+		&EmptyRepositoryOpts{Policy: EmptyRetry}, empty)
+	require.NoError(err)
+
+	policies := &gitcollector.Policies{Retry: &gitcollector.RetryPolicy{
+		Attempts:  3,
+		Retryable: EmptyRetryable,
+	}}
+
+	calls = 0
+	err = policies.Run(ctx, func(ctx context.Context) error {
+		return fn(ctx, newJob())
+	})
+	require.Equal(transport.ErrEmptyRemoteRepository, err)
+	require.Equal(3, calls)
+
+	fn, err = NewEmptyRepositoryJobFn(
+		&EmptyRepositoryOpts{Policy: EmptyPlaceholder}, empty)
+	require.NoError(err)
+
+	for i := 0; i < 2; i++ {
+		job := newJob()
+		require.NoError(fn(ctx, job))
+
+		id, err := NewRepositoryID(endpoint)
+		require.NoError(err)
+		require.Equal(PlaceholderLocationID(id), job.LocationID)
+
+		ok, _, locID, err := lib.Has(id)
+		require.NoError(err)
+		require.True(ok)
+		require.Equal(job.LocationID, locID)
+	}
+
+	loc, err := lib.Location(PlaceholderLocationID(
+		"github.com/src-d/gitcollector"))
+	require.NoError(err)
+
+	repo, err := loc.Get("github.com/src-d/gitcollector", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer repo.Close()
+
+	remote, err := repo.R().Remote("github.com/src-d/gitcollector")
+	require.NoError(err)
+	require.Equal([]string{endpoint}, remote.Config().URLs)
+}
@@ -0,0 +1,315 @@
+package library
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// RefChangeType is the kind of modification performed on a reference.
+type RefChangeType string
+
+const (
+	// RefCreated is a reference that didn't exist before the Job.
+	RefCreated RefChangeType = "created"
+	// RefUpdated is a reference pointing to a different hash after the Job.
+	RefUpdated RefChangeType = "updated"
+	// RefDeleted is a reference removed by the Job.
+	RefDeleted RefChangeType = "deleted"
+)
+
+// RefChange is a reference modified by a Job.
+type RefChange struct {
+	Name plumbing.ReferenceName
+	Type RefChangeType
+	Old  plumbing.Hash
+	New  plumbing.Hash
+}
+
+// LocationEvent is published after a Job successfully modified a location.
+type LocationEvent struct {
+	JobID      string
+	Type       JobType
+	LocationID borges.LocationID
+	Endpoints  []string
+	Changes    []*RefChange
+}
+
+// Subscription receives the events published in an EventBus.
+type Subscription struct {
+	events chan *LocationEvent
+	done   chan struct{}
+	once   sync.Once
+	bus    *EventBus
+}
+
+// Events returns the channel where the events are received. It's closed once
+// the subscription or the EventBus are closed.
+func (s *Subscription) Events() <-chan *LocationEvent {
+	return s.events
+}
+
+// Close stops receiving events.
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+func (s *Subscription) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// EventBus delivers LocationEvents to all its subscribers. Publishing blocks
+// until every subscriber has room for the event, so a slow subscriber slows
+// down the Jobs instead of missing changes.
+type EventBus struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewEventBus builds a new EventBus.
+func NewEventBus() *EventBus {
+	return &EventBus{subs: map[*Subscription]struct{}{}}
+}
+
+// Subscribe returns a new Subscription buffering up to the given number of
+// events.
+func (b *EventBus) Subscribe(buffer int) *Subscription {
+	sub := &Subscription{
+		events: make(chan *LocationEvent, buffer),
+		done:   make(chan struct{}),
+		bus:    b,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(sub.events)
+		sub.close()
+		return sub
+	}
+
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+func (b *EventBus) unsubscribe(sub *Subscription) {
+	sub.close()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Publish sends the event to every subscriber.
+func (b *EventBus) Publish(ctx context.Context, event *LocationEvent) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		select {
+		case sub.events <- event:
+		case <-sub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// Close closes all the subscriptions.
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	subs := b.subs
+	b.subs = map[*Subscription]struct{}{}
+	b.closed = true
+	b.mu.Unlock()
+
+	for sub := range subs {
+		sub.close()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range subs {
+		close(sub.events)
+	}
+}
+
+// NewEventsJobFn wraps the given JobFn publishing a LocationEvent with the
+// reference changes of every successful Job.
+func NewEventsJobFn(bus *EventBus, fn JobFn) JobFn {
+	return func(ctx context.Context, job *Job) error {
+		locID := job.LocationID
+		if locID == "" {
+			locID = locationByEndpoints(job)
+		}
+
+		var before map[plumbing.ReferenceName]plumbing.Hash
+		if locID != "" {
+			refs, err := locationRefs(job.Lib, locID)
+			if err == nil {
+				before = refs
+			}
+		}
+
+		if err := fn(ctx, job); err != nil {
+			return err
+		}
+
+		if job.LocationID == "" {
+			return nil
+		}
+
+		after, err := locationRefs(job.Lib, job.LocationID)
+		if err != nil {
+			return err
+		}
+
+		event := &LocationEvent{
+			JobID:      job.ID,
+			Type:       job.Type,
+			LocationID: job.LocationID,
+			Endpoints:  job.Endpoints,
+		}
+
+		if before == nil {
+			// The repositories didn't exist so the location may be
+			// shared with other repositories whose references must
+			// not be reported.
+			filterRefs(job, after)
+		}
+
+		event.Changes = DiffRefs(before, after)
+		if len(event.Changes) == 0 {
+			return nil
+		}
+
+		return bus.Publish(ctx, event)
+	}
+}
+
+func locationByEndpoints(job *Job) borges.LocationID {
+	if job.Lib == nil {
+		return ""
+	}
+
+	for _, ep := range job.Endpoints {
+		id, err := job.RepositoryID(ep)
+		if err != nil {
+			continue
+		}
+
+		ok, _, locID, err := job.Lib.Has(id)
+		if err == nil && ok {
+			return locID
+		}
+	}
+
+	return ""
+}
+
+func filterRefs(job *Job, refs map[plumbing.ReferenceName]plumbing.Hash) {
+	if len(job.Endpoints) == 0 {
+		return
+	}
+
+	var prefixes []string
+	for _, ep := range job.Endpoints {
+		id, err := job.RepositoryID(ep)
+		if err != nil {
+			continue
+		}
+
+		prefixes = append(prefixes, "refs/remotes/"+id.String()+"/")
+	}
+
+	for name := range refs {
+		var keep bool
+		for _, p := range prefixes {
+			if strings.HasPrefix(name.String(), p) {
+				keep = true
+				break
+			}
+		}
+
+		if !keep {
+			delete(refs, name)
+		}
+	}
+}
+
+func locationRefs(
+	lib borges.Library,
+	id borges.LocationID,
+) (map[plumbing.ReferenceName]plumbing.Hash, error) {
+	loc, err := lib.Location(id)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := loc.Get("", borges.ReadOnlyMode)
+	if err != nil {
+		return nil, err
+	}
+	defer repo.Close()
+
+	iter, err := repo.R().Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	refs := map[plumbing.ReferenceName]plumbing.Hash{}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			refs[ref.Name()] = ref.Hash()
+		}
+
+		return nil
+	})
+
+	return refs, err
+}
+
+// DiffRefs returns the changes needed to go from the references in before to
+// the ones in after, sorted by reference name.
+func DiffRefs(
+	before, after map[plumbing.ReferenceName]plumbing.Hash,
+) []*RefChange {
+	var changes []*RefChange
+	for name, h := range after {
+		old, ok := before[name]
+		switch {
+		case !ok:
+			changes = append(changes, &RefChange{
+				Name: name, Type: RefCreated, New: h,
+			})
+		case old != h:
+			changes = append(changes, &RefChange{
+				Name: name, Type: RefUpdated, Old: old, New: h,
+			})
+		}
+	}
+
+	for name, h := range before {
+		if _, ok := after[name]; !ok {
+			changes = append(changes, &RefChange{
+				Name: name, Type: RefDeleted, Old: h,
+			})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+
+	return changes
+}
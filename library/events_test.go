@@ -0,0 +1,138 @@
+package library
+
+import (
+	"context"
+	"testing"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func TestEventsJobFn(t *testing.T) {
+	var require = require.New(t)
+
+	lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+		Transactional: true,
+		TempFS:        memfs.New(),
+	})
+	require.NoError(err)
+
+	var (
+		h1 = plumbing.NewHash("1111111111111111111111111111111111111111")
+		h2 = plumbing.NewHash("2222222222222222222222222222222222222222")
+		ep = "git://github.com/src-d/gitcollector"
+	)
+
+	const (
+		master  = "refs/remotes/github.com/src-d/gitcollector/master"
+		dev     = "refs/remotes/github.com/src-d/gitcollector/dev"
+		feature = "refs/remotes/github.com/src-d/gitcollector/feature"
+		other   = "refs/remotes/github.com/src-d/go-borges/master"
+	)
+
+	setRefs := func(refs map[string]plumbing.Hash, remove ...string) {
+		loc, err := lib.Location("foo")
+		if borges.ErrLocationNotExists.Is(err) {
+			loc, err = lib.AddLocation("foo")
+		}
+		require.NoError(err)
+
+		r, err := loc.Get("", borges.RWMode)
+		require.NoError(err)
+
+		for name, h := range refs {
+			require.NoError(r.R().Storer.SetReference(
+				plumbing.NewHashReference(
+					plumbing.ReferenceName(name), h,
+				),
+			))
+		}
+
+		for _, name := range remove {
+			require.NoError(r.R().Storer.RemoveReference(
+				plumbing.ReferenceName(name),
+			))
+		}
+
+		require.NoError(r.Commit())
+	}
+
+	bus := NewEventBus()
+	sub := bus.Subscribe(10)
+
+	var modify func()
+	fn := NewEventsJobFn(bus, func(_ context.Context, job *Job) error {
+		modify()
+		job.LocationID = "foo"
+		return nil
+	})
+
+	ctx := context.Background()
+
+	// download to a location shared with other repository
+	setRefs(map[string]plumbing.Hash{other: h1})
+	modify = func() {
+		setRefs(map[string]plumbing.Hash{master: h1, dev: h1})
+	}
+
+	require.NoError(fn(ctx, &Job{
+		ID: "1", Type: JobDownload, Lib: lib, Endpoints: []string{ep},
+	}))
+
+	event := <-sub.Events()
+	require.Equal("1", event.JobID)
+	require.Equal(borges.LocationID("foo"), event.LocationID)
+	require.Equal([]*RefChange{
+		{Name: dev, Type: RefCreated, New: h1},
+		{Name: master, Type: RefCreated, New: h1},
+	}, event.Changes)
+
+	// update of the whole location
+	modify = func() {
+		setRefs(map[string]plumbing.Hash{master: h2, feature: h2}, dev)
+	}
+
+	require.NoError(fn(ctx, &Job{
+		ID: "2", Type: JobUpdate, Lib: lib, LocationID: "foo",
+	}))
+
+	event = <-sub.Events()
+	require.Equal("2", event.JobID)
+	require.Equal([]*RefChange{
+		{Name: dev, Type: RefDeleted, Old: h1},
+		{Name: feature, Type: RefCreated, New: h2},
+		{Name: master, Type: RefUpdated, Old: h1, New: h2},
+	}, event.Changes)
+
+	// nothing changed, no event is published
+	modify = func() {}
+	require.NoError(fn(ctx, &Job{
+		ID: "3", Type: JobUpdate, Lib: lib, LocationID: "foo",
+	}))
+
+	select {
+	case e := <-sub.Events():
+		require.Failf("unexpected event", "%v", e)
+	default:
+	}
+
+	sub.Close()
+	_, ok := <-sub.Events()
+	require.False(ok)
+
+	// closed subscriptions don't block publishing
+	modify = func() {
+		setRefs(map[string]plumbing.Hash{master: h1})
+	}
+
+	require.NoError(fn(ctx, &Job{
+		ID: "4", Type: JobUpdate, Lib: lib, LocationID: "foo",
+	}))
+
+	bus.Close()
+	_, ok = <-bus.Subscribe(1).Events()
+	require.False(ok)
+}
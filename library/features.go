@@ -0,0 +1,88 @@
+package library
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrUnknownFeature is returned when a Feature isn't supported.
+var ErrUnknownFeature = errors.NewKind("unknown feature %q")
+
+// Feature names an experimental behavior that can be enabled for a single
+// Run, so it can be adopted by the large collections progressively and the
+// outcome of the Runs with and without it compared.
+type Feature string
+
+const (
+	// FeaturePartialClone fetches the history of the big repositories in
+	// increments, keeping the partial clones until they're complete.
+	FeaturePartialClone Feature = "partial-clone"
+	// FeatureForkGrouping merges the repositories found for the same
+	// rooted repository at the same time into a single write.
+	FeatureForkGrouping Feature = "fork-grouping"
+	// FeatureSizeScheduler schedules the downloads by the size reported
+	// by the discovery, the smallest repositories first.
+	FeatureSizeScheduler Feature = "size-scheduler"
+)
+
+// KnownFeatures are the Features supported.
+var KnownFeatures = []Feature{
+	FeaturePartialClone,
+	FeatureForkGrouping,
+	FeatureSizeScheduler,
+}
+
+// Features is the set of Features enabled in a Run.
+type Features map[Feature]bool
+
+// ParseFeatures parses a list of Features separated by comma. A Feature
+// prefixed by - is disabled, the last appearance of every Feature wins.
+func ParseFeatures(list string) (Features, error) {
+	features := Features{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		enabled := !strings.HasPrefix(name, "-")
+		feature := Feature(strings.TrimPrefix(name, "-"))
+		if !knownFeature(feature) {
+			return nil, ErrUnknownFeature.New(feature)
+		}
+
+		features[feature] = enabled
+	}
+
+	return features, nil
+}
+
+func knownFeature(feature Feature) bool {
+	for _, f := range KnownFeatures {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Enabled reports whether the Feature is enabled.
+func (f Features) Enabled(feature Feature) bool {
+	return f[feature]
+}
+
+// List returns the names of the Features enabled, sorted.
+func (f Features) List() []string {
+	var list []string
+	for feature, enabled := range f {
+		if enabled {
+			list = append(list, string(feature))
+		}
+	}
+
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,32 @@
+package library
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFeatures(t *testing.T) {
+	var require = require.New(t)
+
+	features, err := ParseFeatures("")
+	require.NoError(err)
+	require.Empty(features.List())
+	require.False(features.Enabled(FeaturePartialClone))
+
+	features, err = ParseFeatures(
+		"size-scheduler, partial-clone,fork-grouping,-partial-clone",
+	)
+	require.NoError(err)
+	require.True(features.Enabled(FeatureSizeScheduler))
+	require.True(features.Enabled(FeatureForkGrouping))
+	require.False(features.Enabled(FeaturePartialClone))
+	require.Equal([]string{"fork-grouping", "size-scheduler"}, features.List())
+
+	_, err = ParseFeatures("partial-clone,foo")
+	require.True(ErrUnknownFeature.Is(err))
+
+	var none Features
+	require.False(none.Enabled(FeatureForkGrouping))
+	require.Empty(none.List())
+}
@@ -0,0 +1,143 @@
+package library
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrUnknownForkSampling is returned when a ForkSampling isn't supported.
+var ErrUnknownForkSampling = errors.NewKind("unknown fork sampling %q")
+
+// ForkSampling is the way the repositories sharing a location are chosen once
+// the location reaches its capacity.
+type ForkSampling string
+
+const (
+	// ForkSamplingFirst keeps the first repositories added to the location,
+	// the default.
+	ForkSamplingFirst ForkSampling = "first"
+	// ForkSamplingRandom keeps a uniform random sample of all the
+	// repositories found for the location, replacing a stored repository
+	// when a new one is chosen.
+	ForkSamplingRandom ForkSampling = "random"
+)
+
+// ForkSamplerOpts represents configuration options for a ForkSampler.
+type ForkSamplerOpts struct {
+	// MaxForks is the maximum number of forks stored in a location along
+	// with the original repository. 0 means unlimited.
+	MaxForks int
+	// Sampling is the ForkSampling strategy, default to ForkSamplingFirst.
+	Sampling ForkSampling
+	// Seed initializes the random sampling, default to the current time.
+	Seed int64
+	// Audit records the forks evicted from the locations, none by default.
+	Audit *AuditLog
+}
+
+// ForkSampler caps the number of repositories stored in a rooted repository,
+// since fork networks with thousands of forks create huge locations that are
+// very expensive to update.
+type ForkSampler struct {
+	mu   sync.Mutex
+	seen map[borges.LocationID]int
+	rnd  *rand.Rand
+	opts *ForkSamplerOpts
+}
+
+// NewForkSampler builds a new ForkSampler.
+func NewForkSampler(opts *ForkSamplerOpts) (*ForkSampler, error) {
+	if opts == nil {
+		opts = &ForkSamplerOpts{}
+	}
+
+	if opts.Sampling == "" {
+		opts.Sampling = ForkSamplingFirst
+	}
+
+	switch opts.Sampling {
+	case ForkSamplingFirst, ForkSamplingRandom:
+	default:
+		return nil, ErrUnknownForkSampling.New(opts.Sampling)
+	}
+
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+
+	return &ForkSampler{
+		seen: map[borges.LocationID]int{},
+		rnd:  rand.New(rand.NewSource(opts.Seed)),
+		opts: opts,
+	}, nil
+}
+
+// Admit decides whether a new repository is added to the location already
+// storing the given remotes. When it's admitted replacing a stored repository
+// the name of the remote to remove is returned in evict.
+func (s *ForkSampler) Admit(
+	loc borges.LocationID,
+	remotes []string,
+) (ok bool, evict string) {
+	if s == nil || s.opts.MaxForks <= 0 {
+		return true, ""
+	}
+
+	capacity := s.opts.MaxForks + 1
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen, found := s.seen[loc]
+	if !found || seen < len(remotes) {
+		seen = len(remotes)
+	}
+
+	seen++
+	s.seen[loc] = seen
+
+	if len(remotes) < capacity {
+		return true, ""
+	}
+
+	if s.opts.Sampling == ForkSamplingFirst {
+		return false, ""
+	}
+
+	// reservoir sampling: the new repository is kept with probability
+	// capacity/seen replacing a random one.
+	i := s.rnd.Intn(seen)
+	if i >= capacity {
+		return false, ""
+	}
+
+	sorted := append([]string(nil), remotes...)
+	sort.Strings(sorted)
+	return true, sorted[i%len(sorted)]
+}
+
+// Evicted records the removal of the evict remote returned by Admit.
+func (s *ForkSampler) Evicted(loc borges.LocationID, remote string) error {
+	if s == nil {
+		return nil
+	}
+
+	return s.opts.Audit.Record(
+		AuditEvict, loc,
+		"fork sampling "+string(s.opts.Sampling),
+		"removed remote "+remote,
+	)
+}
+
+// WithForkSampler is a JobSetupFn setting the ForkSampler of the Job.
+func WithForkSampler(s *ForkSampler) JobSetupFn {
+	return func(job *Job) error {
+		job.Forks = s
+		return nil
+	}
+}
@@ -0,0 +1,53 @@
+package library
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestForkSampler(t *testing.T) {
+	var require = require.New(t)
+
+	_, err := NewForkSampler(&ForkSamplerOpts{Sampling: "foo"})
+	require.True(ErrUnknownForkSampling.Is(err))
+
+	var unlimited *ForkSampler
+	ok, evict := unlimited.Admit("loc", make([]string, 100))
+	require.True(ok)
+	require.Empty(evict)
+
+	first, err := NewForkSampler(&ForkSamplerOpts{MaxForks: 2})
+	require.NoError(err)
+
+	ok, _ = first.Admit("loc", []string{"a", "b"})
+	require.True(ok)
+	ok, _ = first.Admit("loc", []string{"a", "b", "c"})
+	require.False(ok)
+	ok, _ = first.Admit("other", []string{"a"})
+	require.True(ok)
+
+	random, err := NewForkSampler(&ForkSamplerOpts{
+		MaxForks: 2,
+		Sampling: ForkSamplingRandom,
+		Seed:     42,
+	})
+	require.NoError(err)
+
+	remotes := []string{"c", "a", "b"}
+	var admitted int
+	for i := 0; i < 1000; i++ {
+		ok, evict := random.Admit("loc", remotes)
+		if !ok {
+			require.Empty(evict)
+			continue
+		}
+
+		admitted++
+		require.Contains(remotes, evict)
+	}
+
+	// the probability of being admitted decreases with the repositories
+	// seen, 3/n for the n-th one.
+	require.True(admitted > 5 && admitted < 50, "admitted %d", admitted)
+}
@@ -0,0 +1,506 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/src-d/gitcollector"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrHandoffVersion is returned when a handoff directory or one of its
+	// jobs was written with a version of the format not supported.
+	ErrHandoffVersion = errors.NewKind(
+		"unsupported handoff version %d, up to %d is supported")
+
+	// ErrHandoffOwner is returned when the owner of a Handoff can't be
+	// used as the name of a directory.
+	ErrHandoffOwner = errors.NewKind("wrong handoff owner %q")
+
+	// ErrHandoffEmpty is returned by Claim when there are no pending jobs.
+	ErrHandoffEmpty = errors.NewKind("no pending jobs in the handoff")
+)
+
+const (
+	// HandoffVersion is the version of the format of the handoff
+	// directories and jobs written.
+	HandoffVersion = 1
+	// HandoffFile is the file describing a handoff directory.
+	HandoffFile = "handoff.json"
+	// HandoffPending is the directory of the jobs ready to be claimed.
+	HandoffPending = "pending"
+	// HandoffClaimed is the directory of the jobs claimed, in a directory
+	// named after their owner.
+	HandoffClaimed = "claimed"
+	// HandoffFailed is the directory of the jobs that failed, along with
+	// their error.
+	HandoffFailed = "failed"
+
+	handoffTmp = "tmp"
+	handoffExt = ".json"
+)
+
+type handoffHeader struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+}
+
+// HandoffRecord is the content of the file of a job in a handoff directory.
+// The job is encoded like in a QueueCodec, with only what the discovery sets.
+type HandoffRecord struct {
+	Version int             `json:"version"`
+	Created time.Time       `json:"created"`
+	Job     json.RawMessage `json:"job"`
+	// Owner is the last one claiming the job, if any.
+	Owner string `json:"owner,omitempty"`
+	// Attempts is the number of times the job was processed.
+	Attempts int `json:"attempts,omitempty"`
+	// Error is the error of the last attempt of a failed job.
+	Error string `json:"error,omitempty"`
+}
+
+// Handoff passes Jobs between processes through a directory of a shared
+// filesystem, so a discovery-only machine can produce the Jobs processed by
+// the download machines without a message broker. Every Job is a JSON file:
+//
+//	handoff.json                 the version of the format of the directory
+//	tmp/                         the jobs being written
+//	pending/<name>.json          the jobs ready to be claimed, by name order
+//	claimed/<owner>/<name>.json  the jobs claimed by every owner
+//	failed/<name>.json           the jobs failed, with their error
+//
+// The Jobs are written to tmp and renamed to pending once complete, and they
+// are claimed renaming them to the directory of their owner, so only one of
+// the processes claiming the same Job at the same time succeeds. A processed
+// Job is removed, and a failed one is moved to failed where it can be
+// inspected or moved back to pending by hand. The names start with the time
+// they were written, so they're claimed in the same order.
+type Handoff struct {
+	fs    billy.Filesystem
+	owner string
+	codec QueueCodec
+
+	mu sync.Mutex
+	// claims holds the path of the Jobs claimed by this Handoff.
+	claims map[*Job]string
+}
+
+// OpenHandoff opens the handoff directory in the given filesystem, creating it
+// if it's empty, to put and claim Jobs as the given owner. The owner must be
+// unique among the processes claiming Jobs from it, like the host name.
+func OpenHandoff(fs billy.Filesystem, owner string) (*Handoff, error) {
+	if owner == "" || strings.ContainsAny(owner, `/\`) ||
+		owner == "." || owner == ".." {
+		return nil, ErrHandoffOwner.New(owner)
+	}
+
+	h := &Handoff{fs: fs, owner: owner, claims: map[*Job]string{}}
+	header := &handoffHeader{}
+	err := h.read(HandoffFile, header)
+	if os.IsNotExist(err) {
+		header = &handoffHeader{
+			Version: HandoffVersion,
+			Created: time.Now().UTC(),
+		}
+
+		err = h.write(HandoffFile, header)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Version > HandoffVersion {
+		return nil, ErrHandoffVersion.New(header.Version, HandoffVersion)
+	}
+
+	return h, nil
+}
+
+// Put writes the given Job as pending.
+func (h *Handoff) Put(job *Job) error {
+	data, err := h.codec.Encode(job)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	name := fmt.Sprintf(
+		"%020d-%s%s", now.UnixNano(), uuid.New(), handoffExt,
+	)
+	return h.write(path.Join(HandoffPending, name), &HandoffRecord{
+		Version: HandoffVersion,
+		Created: now,
+		Job:     data,
+	})
+}
+
+// Feed puts the Jobs received from the given channel until it's closed.
+func (h *Handoff) Feed(jobs <-chan gitcollector.Job) error {
+	for j := range jobs {
+		job, ok := j.(*Job)
+		if !ok {
+			return errWrongJob.New()
+		}
+
+		if err := h.Put(job); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Claim takes the oldest pending Job, ErrHandoffEmpty is returned if there
+// isn't any. The Jobs that can't be read, or written with a newer version of
+// the format, are moved to failed.
+func (h *Handoff) Claim() (*Job, error) {
+	files, err := h.fs.ReadDir(HandoffPending)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), handoffExt) {
+			names = append(names, f.Name())
+		}
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		claimed := path.Join(HandoffClaimed, h.owner, name)
+		if err := h.fs.MkdirAll(path.Dir(claimed), 0755); err != nil {
+			return nil, err
+		}
+
+		// another process claimed it first.
+		err := h.fs.Rename(path.Join(HandoffPending, name), claimed)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// the content of the unreadable ones is kept as it is.
+		job, record, err := h.decode(claimed)
+		if err != nil {
+			failed := path.Join(HandoffFailed, name)
+			if err := h.fs.Rename(claimed, failed); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		record.Owner = h.owner
+		if err := h.write(claimed, record); err != nil {
+			return nil, err
+		}
+
+		h.mu.Lock()
+		h.claims[job] = claimed
+		h.mu.Unlock()
+		return job, nil
+	}
+
+	return nil, ErrHandoffEmpty.New()
+}
+
+func (h *Handoff) decode(p string) (*Job, *HandoffRecord, error) {
+	record := &HandoffRecord{}
+	if err := h.read(p, record); err != nil {
+		return nil, record, err
+	}
+
+	if record.Version > HandoffVersion {
+		return nil, record, ErrHandoffVersion.New(
+			record.Version, HandoffVersion)
+	}
+
+	job, err := h.codec.Decode(record.Job)
+	if err != nil {
+		return nil, record, err
+	}
+
+	return job.(*Job), record, nil
+}
+
+// Begin records an attempt to process the given Job, claimed by Claim. A Job
+// failed before is claimed again.
+func (h *Handoff) Begin(job *Job) error {
+	return h.update(job, func(p string, r *HandoffRecord) (string, error) {
+		r.Attempts++
+		r.Error = ""
+		dir := path.Join(HandoffClaimed, h.owner)
+		if path.Dir(p) == dir {
+			return p, h.write(p, r)
+		}
+
+		return h.move(p, dir, r)
+	})
+}
+
+// Done removes the given Job, claimed by Claim, once it's processed.
+func (h *Handoff) Done(job *Job) error {
+	h.mu.Lock()
+	p, ok := h.claims[job]
+	delete(h.claims, job)
+	h.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	return h.fs.Remove(p)
+}
+
+// Fail moves the given Job, claimed by Claim, to failed with its error.
+func (h *Handoff) Fail(job *Job, err error) error {
+	return h.update(job, func(p string, r *HandoffRecord) (string, error) {
+		r.Error = err.Error()
+		return h.move(p, HandoffFailed, r)
+	})
+}
+
+// Release moves the given Job, claimed by Claim, back to pending so it can be
+// claimed again, like the Jobs abandoned on shutdown.
+func (h *Handoff) Release(job *Job) error {
+	if err := h.update(job, func(
+		p string,
+		r *HandoffRecord,
+	) (string, error) {
+		r.Owner = ""
+		return h.move(p, HandoffPending, r)
+	}); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	delete(h.claims, job)
+	h.mu.Unlock()
+	return nil
+}
+
+// Recover moves back to pending the Jobs claimed by the owner and not claimed
+// by this Handoff, the ones left by a previous process stopped abruptly. It
+// returns the number of Jobs recovered.
+func (h *Handoff) Recover() (int, error) {
+	dir := path.Join(HandoffClaimed, h.owner)
+	files, err := h.fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	h.mu.Lock()
+	claimed := map[string]bool{}
+	for _, p := range h.claims {
+		claimed[p] = true
+	}
+	h.mu.Unlock()
+
+	var n int
+	for _, f := range files {
+		p := path.Join(dir, f.Name())
+		if f.IsDir() || claimed[p] {
+			continue
+		}
+
+		if err := h.fs.Rename(p, path.Join(HandoffPending, f.Name())); err != nil {
+			return n, err
+		}
+
+		n++
+	}
+
+	return n, nil
+}
+
+// update calls fn with the current path and record of a claimed Job, fn
+// returns the path of the Job once written.
+func (h *Handoff) update(
+	job *Job,
+	fn func(p string, r *HandoffRecord) (string, error),
+) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p, ok := h.claims[job]
+	if !ok {
+		return nil
+	}
+
+	record := &HandoffRecord{}
+	if err := h.read(p, record); err != nil {
+		return err
+	}
+
+	p, err := fn(p, record)
+	if err != nil {
+		return err
+	}
+
+	h.claims[job] = p
+	return nil
+}
+
+// move writes the record to the given directory removing the file at p, it
+// returns the new path.
+func (h *Handoff) move(p, dir string, r *HandoffRecord) (string, error) {
+	moved := path.Join(dir, path.Base(p))
+	if err := h.write(moved, r); err != nil {
+		return "", err
+	}
+
+	return moved, h.fs.Remove(p)
+}
+
+func (h *Handoff) read(p string, v interface{}) error {
+	f, err := h.fs.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// write replaces the file atomically so it's never read half written.
+func (h *Handoff) write(p string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if err := h.fs.MkdirAll(handoffTmp, 0755); err != nil {
+		return err
+	}
+
+	if err := h.fs.MkdirAll(path.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	f, err := util.TempFile(h.fs, handoffTmp, path.Base(p))
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if s, ok := f.(syncer); ok {
+		if err := s.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return h.fs.Rename(f.Name(), p)
+}
+
+// WithHandoff is a JobSetupFn recording the attempts of the Jobs claimed from
+// the given Handoff, removing them once they're processed successfully and
+// moving them to failed otherwise, so a retry claims them again.
+func WithHandoff(h *Handoff) JobSetupFn {
+	return func(job *Job) error {
+		fn := job.ProcessFn
+		job.ProcessFn = func(ctx context.Context, j *Job) error {
+			if err := h.Begin(job); err != nil {
+				return err
+			}
+
+			if fn == nil {
+				return ErrJobFnNotFound.New()
+			}
+
+			if err := fn(ctx, j); err != nil {
+				if ferr := h.Fail(job, err); ferr != nil {
+					return ferr
+				}
+
+				return err
+			}
+
+			return h.Done(job)
+		}
+
+		return nil
+	}
+}
+
+// NewHandoffJobFn returns a JobFn putting every Job in the given Handoff
+// instead of processing it, for the machines only discovering Jobs.
+func NewHandoffJobFn(h *Handoff) JobFn {
+	return func(_ context.Context, job *Job) error {
+		return h.Put(job)
+	}
+}
+
+// NewHandoffShutdownFn returns a gitcollector.ShutdownFn releasing the Jobs
+// claimed from the Handoff that were abandoned, discarded or canceled, so
+// they're claimed again by any process.
+func NewHandoffShutdownFn(h *Handoff) gitcollector.ShutdownFn {
+	return func(
+		report *gitcollector.ShutdownReport,
+	) gitcollector.ShutdownCleanup {
+		cleanup := gitcollector.ShutdownCleanup{Name: "handoff release"}
+
+		var released int
+		abandoned := append(
+			append([]gitcollector.Job(nil), report.Canceled...),
+			report.Discarded...,
+		)
+		for _, j := range abandoned {
+			job, ok := j.(*Job)
+			if !ok || !h.claimed(job) {
+				continue
+			}
+
+			if err := h.Release(job); err != nil {
+				cleanup.Err = err
+				break
+			}
+
+			released++
+		}
+
+		cleanup.Detail = fmt.Sprintf("%d jobs released", released)
+		return cleanup
+	}
+}
+
+func (h *Handoff) claimed(job *Job) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, ok := h.claims[job]
+	return ok
+}
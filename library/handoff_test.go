@@ -0,0 +1,225 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/src-d/gitcollector"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+func TestHandoff(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	out, err := OpenHandoff(fs, "discovery")
+	require.NoError(err)
+
+	jobs := make(chan gitcollector.Job, 3)
+	for _, ep := range []string{"a", "b", "c"} {
+		jobs <- &Job{
+			Type:      JobDownload,
+			Endpoints: []string{"https://github.com/src-d/" + ep},
+			Labels:    map[string]string{"org": "src-d"},
+		}
+	}
+	close(jobs)
+	require.NoError(out.Feed(jobs))
+	require.Len(files(t, fs, HandoffPending), 3)
+	require.Empty(files(t, fs, "tmp"))
+
+	in, err := OpenHandoff(fs, "worker-1")
+	require.NoError(err)
+
+	// the jobs are claimed in the order they were written
+	a, err := in.Claim()
+	require.NoError(err)
+	require.Equal([]string{"https://github.com/src-d/a"}, a.Endpoints)
+	require.Equal(map[string]string{"org": "src-d"}, a.Labels)
+	b, err := in.Claim()
+	require.NoError(err)
+	require.Equal([]string{"https://github.com/src-d/b"}, b.Endpoints)
+	require.Len(files(t, fs, path.Join(HandoffClaimed, "worker-1")), 2)
+
+	// a failed job is retried from the failed ones
+	var fail = true
+	setup := WithHandoff(in)
+	for _, job := range []*Job{a, b} {
+		job.ProcessFn = func(_ context.Context, j *Job) error {
+			if j == b && fail {
+				return fmt.Errorf("foo")
+			}
+
+			return nil
+		}
+
+		require.NoError(setup(job))
+	}
+
+	require.NoError(a.Process(context.Background()))
+	require.Error(b.Process(context.Background()))
+	failed := files(t, fs, HandoffFailed)
+	require.Len(failed, 1)
+	record := &HandoffRecord{}
+	require.NoError(in.read(path.Join(HandoffFailed, failed[0]), record))
+	require.Equal("foo", record.Error)
+	require.Equal(1, record.Attempts)
+	require.Equal("worker-1", record.Owner)
+	require.Equal(HandoffVersion, record.Version)
+
+	fail = false
+	require.NoError(b.Process(context.Background()))
+	require.Empty(files(t, fs, HandoffFailed))
+	require.Empty(files(t, fs, path.Join(HandoffClaimed, "worker-1")))
+
+	// the claims of a process stopped abruptly are recovered by the next
+	// one of the same owner
+	c, err := in.Claim()
+	require.NoError(err)
+	_, err = in.Claim()
+	require.True(ErrHandoffEmpty.Is(err))
+
+	other, err := OpenHandoff(fs, "worker-2")
+	require.NoError(err)
+	n, err := other.Recover()
+	require.NoError(err)
+	require.Zero(n)
+	n, err = in.Recover()
+	require.NoError(err)
+	require.Zero(n)
+
+	next, err := OpenHandoff(fs, "worker-1")
+	require.NoError(err)
+	n, err = next.Recover()
+	require.NoError(err)
+	require.Equal(1, n)
+
+	// the abandoned jobs are released on shutdown
+	c, err = next.Claim()
+	require.NoError(err)
+	require.Equal([]string{"https://github.com/src-d/c"}, c.Endpoints)
+	cleanup := NewHandoffShutdownFn(next)(&gitcollector.ShutdownReport{
+		Discarded: []gitcollector.Job{c, &Job{}},
+	})
+	require.NoError(cleanup.Err)
+	require.Equal("1 jobs released", cleanup.Detail)
+	require.Len(files(t, fs, HandoffPending), 1)
+
+	// the unreadable jobs are moved to failed
+	require.NoError(util.WriteFile(
+		fs, path.Join(HandoffPending, "0.json"), []byte("{"), 0644,
+	))
+	require.NoError(util.WriteFile(
+		fs, path.Join(HandoffPending, "00.json"),
+		[]byte(`{"version": 2, "job": {}}`), 0644,
+	))
+	c, err = next.Claim()
+	require.NoError(err)
+	require.Equal([]string{"https://github.com/src-d/c"}, c.Endpoints)
+	require.Equal([]string{"0.json", "00.json"}, files(t, fs, HandoffFailed))
+}
+
+func TestOpenHandoff(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	for _, owner := range []string{"", "foo/bar", "..", `foo\bar`} {
+		_, err := OpenHandoff(fs, owner)
+		require.True(ErrHandoffOwner.Is(err), owner)
+	}
+
+	_, err := OpenHandoff(fs, "foo")
+	require.NoError(err)
+	_, err = OpenHandoff(fs, "foo")
+	require.NoError(err)
+
+	require.NoError(util.WriteFile(
+		fs, HandoffFile, []byte(`{"version": 2}`), 0644,
+	))
+	_, err = OpenHandoff(fs, "foo")
+	require.True(ErrHandoffVersion.Is(err))
+}
+
+func TestHandoffConcurrentClaims(t *testing.T) {
+	var require = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector-handoff")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fs := osfs.New(dir)
+	out, err := OpenHandoff(fs, "discovery")
+	require.NoError(err)
+
+	const total = 50
+	for i := 0; i < total; i++ {
+		require.NoError(out.Put(&Job{
+			Type:      JobDownload,
+			Endpoints: []string{fmt.Sprint(i)},
+		}))
+	}
+
+	// every job is claimed by only one of the owners
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed = map[string]int{}
+	)
+
+	for i := 0; i < 4; i++ {
+		h, err := OpenHandoff(fs, fmt.Sprintf("worker-%d", i))
+		require.NoError(err)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := h.Claim()
+				if ErrHandoffEmpty.Is(err) {
+					return
+				}
+
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				mu.Lock()
+				claimed[job.Endpoints[0]]++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	require.Len(claimed, total)
+	for ep, n := range claimed {
+		require.Equal(1, n, ep)
+	}
+}
+
+func files(t *testing.T, fs billy.Filesystem, dir string) []string {
+	infos, err := fs.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	require.NoError(t, err)
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+
+	sort.Strings(names)
+	return names
+}
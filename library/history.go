@@ -0,0 +1,306 @@
+package library
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// HistoryFile is the default name of the file of the History.
+const HistoryFile = "gitcollector.history"
+
+// historyDurations is the number of durations kept by endpoint.
+const historyDurations = 10
+
+// EndpointHistory holds the statistics of the past Jobs of an endpoint.
+type EndpointHistory struct {
+	Endpoint string `json:"endpoint"`
+	// Durations are the durations of the last Jobs, the latest one last.
+	Durations []time.Duration `json:"durations,omitempty"`
+	Successes int             `json:"successes,omitempty"`
+	Failures  int             `json:"failures,omitempty"`
+	// FailureStreak is the number of Jobs failed since the last success.
+	FailureStreak int `json:"failure_streak,omitempty"`
+	// SizeGrowth is the growth in bytes of the location of the endpoint
+	// over all its measured Jobs.
+	SizeGrowth int64 `json:"size_growth,omitempty"`
+	// LastGrowth is the growth in bytes of the location of the endpoint
+	// on its last measured Job.
+	LastGrowth int64     `json:"last_growth,omitempty"`
+	Updated    time.Time `json:"updated"`
+}
+
+// MeanDuration returns the mean of the durations kept, 0 if there are none.
+func (h *EndpointHistory) MeanDuration() time.Duration {
+	if h == nil || len(h.Durations) == 0 {
+		return 0
+	}
+
+	var total time.Duration
+	for _, d := range h.Durations {
+		total += d
+	}
+
+	return total / time.Duration(len(h.Durations))
+}
+
+// History keeps the EndpointHistory of the endpoints processed by the Jobs.
+// Every change is appended to its file, so it survives crashes, and the file
+// is rewritten with only the latest state of every endpoint by Compact.
+type History struct {
+	mu        sync.Mutex
+	fs        billy.Filesystem
+	path      string
+	endpoints map[string]*EndpointHistory
+	now       func() time.Time
+}
+
+// NewHistory builds a new History stored at the given path in the filesystem,
+// loading the EndpointHistory already stored.
+func NewHistory(fs billy.Filesystem, path string) (*History, error) {
+	if path == "" {
+		path = HistoryFile
+	}
+
+	h := &History{
+		fs:        fs,
+		path:      path,
+		endpoints: map[string]*EndpointHistory{},
+		now:       time.Now,
+	}
+
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (h *History) load() error {
+	f, err := h.fs.Open(h.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var eh EndpointHistory
+		if err := json.Unmarshal(scanner.Bytes(), &eh); err != nil {
+			// the last line may be half written by a crash.
+			continue
+		}
+
+		h.endpoints[eh.Endpoint] = &eh
+	}
+
+	return scanner.Err()
+}
+
+// Get returns a copy of the EndpointHistory of the endpoint, nil if it
+// hasn't been processed.
+func (h *History) Get(endpoint string) *EndpointHistory {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	eh, ok := h.endpoints[endpoint]
+	if !ok {
+		return nil
+	}
+
+	return eh.copy()
+}
+
+func (h *EndpointHistory) copy() *EndpointHistory {
+	c := *h
+	c.Durations = append([]time.Duration(nil), h.Durations...)
+	return &c
+}
+
+// Record updates the EndpointHistory of the endpoints of a Job processed in
+// the given time, err is the error it failed with, if any.
+func (h *History) Record(job *Job, elapsed time.Duration, err error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, ferr := h.fs.OpenFile(
+		h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644,
+	)
+	if ferr != nil {
+		return ferr
+	}
+
+	now := h.now().UTC()
+	w := bufio.NewWriter(f)
+	for _, ep := range job.Endpoints {
+		eh, ok := h.endpoints[ep]
+		if !ok {
+			eh = &EndpointHistory{Endpoint: ep}
+			h.endpoints[ep] = eh
+		}
+
+		eh.Durations = append(eh.Durations, elapsed)
+		if len(eh.Durations) > historyDurations {
+			eh.Durations = eh.Durations[len(eh.Durations)-historyDurations:]
+		}
+
+		if err != nil {
+			eh.Failures++
+			eh.FailureStreak++
+		} else {
+			eh.Successes++
+			eh.FailureStreak = 0
+		}
+
+		if job.DiskUsage != nil {
+			eh.LastGrowth = job.DiskUsage.Final
+			eh.SizeGrowth += job.DiskUsage.Final
+		}
+
+		eh.Updated = now
+		data, merr := json.Marshal(eh)
+		if merr != nil {
+			f.Close()
+			return merr
+		}
+
+		w.Write(append(data, '\n'))
+	}
+
+	if werr := w.Flush(); werr != nil {
+		f.Close()
+		return werr
+	}
+
+	return f.Close()
+}
+
+// Compact rewrites the file of the History with the latest state of every
+// endpoint.
+func (h *History) Compact() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	endpoints := make([]string, 0, len(h.endpoints))
+	for ep := range h.endpoints {
+		endpoints = append(endpoints, ep)
+	}
+
+	sort.Strings(endpoints)
+
+	var data []byte
+	for _, ep := range endpoints {
+		line, err := json.Marshal(h.endpoints[ep])
+		if err != nil {
+			return err
+		}
+
+		data = append(append(data, line...), '\n')
+	}
+
+	// the history is written to a temporal file and renamed so it's never
+	// read half written.
+	tmp := h.path + ".tmp"
+	if err := util.WriteFile(h.fs, tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return h.fs.Rename(tmp, h.path)
+}
+
+// NewHistoryJobFn wraps the given JobFn recording the outcome of every Job
+// in the History. The outcomes that can't be recorded are logged.
+func NewHistoryJobFn(h *History, fn JobFn) JobFn {
+	return func(ctx context.Context, job *Job) error {
+		start := time.Now()
+		err := fn(ctx, job)
+		if ctx.Err() != nil {
+			// the canceled Jobs say nothing about their endpoints.
+			return err
+		}
+
+		if rerr := h.Record(job, time.Since(start), err); rerr != nil {
+			logger := job.Logger
+			if logger == nil {
+				logger = log.New(nil)
+			}
+
+			logger.Warningf("couldn't record the history: %s", rerr)
+		}
+
+		return err
+	}
+}
+
+// HistoryPolicyFn adapts a Job to the history of its endpoints before it's
+// scheduled. The EndpointHistory of the endpoints never processed are nil.
+type HistoryPolicyFn func(job *Job, history []*EndpointHistory)
+
+// HistoryPolicyOpts represents configuration options for NewHistoryPolicy.
+type HistoryPolicyOpts struct {
+	// Slow is the mean duration above which the Jobs of an endpoint are
+	// processed as Large, 0 disables it.
+	Slow time.Duration
+	// FailureStreak is the number of consecutive failures of an endpoint
+	// after which its Jobs get gitcollector.PriorityLow, 0 disables it.
+	FailureStreak int
+}
+
+// NewHistoryPolicy builds a HistoryPolicyFn routing the Jobs of the
+// chronically slow endpoints to be processed as Large and deprioritizing the
+// ones of the flaky endpoints. The urgent Jobs keep their priority.
+func NewHistoryPolicy(opts *HistoryPolicyOpts) HistoryPolicyFn {
+	if opts == nil {
+		opts = &HistoryPolicyOpts{}
+	}
+
+	return func(job *Job, history []*EndpointHistory) {
+		for _, eh := range history {
+			if eh == nil {
+				continue
+			}
+
+			if opts.Slow > 0 && eh.MeanDuration() > opts.Slow {
+				job.Large = true
+			}
+
+			if opts.FailureStreak > 0 &&
+				eh.FailureStreak >= opts.FailureStreak &&
+				job.Priority == gitcollector.PriorityNormal {
+				job.Priority = gitcollector.PriorityLow
+			}
+		}
+	}
+}
+
+// WithHistory is a JobSetupFn applying the HistoryPolicyFn to the Jobs with
+// the EndpointHistory of their endpoints.
+func WithHistory(h *History, policy HistoryPolicyFn) JobSetupFn {
+	return func(job *Job) error {
+		history := make([]*EndpointHistory, 0, len(job.Endpoints))
+		for _, ep := range job.Endpoints {
+			history = append(history, h.Get(ep))
+		}
+
+		policy(job, history)
+		return nil
+	}
+}
@@ -0,0 +1,148 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestHistory(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	h, err := NewHistory(fs, "")
+	require.NoError(err)
+	require.Nil(h.Get("a"))
+
+	job := &Job{
+		Endpoints: []string{"a", "b"},
+		DiskUsage: &DiskUsage{Final: 100},
+	}
+
+	require.NoError(h.Record(job, time.Second, nil))
+	require.NoError(h.Record(job, 3*time.Second, fmt.Errorf("foo")))
+	require.NoError(h.Record(
+		&Job{Endpoints: []string{"a"}}, 5*time.Second, fmt.Errorf("foo"),
+	))
+
+	a := h.Get("a")
+	require.Equal(
+		[]time.Duration{time.Second, 3 * time.Second, 5 * time.Second},
+		a.Durations,
+	)
+	require.Equal(3*time.Second, a.MeanDuration())
+	require.Equal(1, a.Successes)
+	require.Equal(2, a.Failures)
+	require.Equal(2, a.FailureStreak)
+	require.EqualValues(200, a.SizeGrowth)
+	require.EqualValues(100, a.LastGrowth)
+
+	require.NoError(h.Record(&Job{Endpoints: []string{"b"}}, 0, nil))
+	require.Equal(0, h.Get("b").FailureStreak)
+
+	// the history is loaded from its file, before and after compacting it
+	for i := 0; i < 2; i++ {
+		loaded, err := NewHistory(fs, "")
+		require.NoError(err)
+		require.Equal(a, loaded.Get("a"))
+		require.Equal(h.Get("b"), loaded.Get("b"))
+		require.NoError(h.Compact())
+	}
+
+	f, err := fs.Open(HistoryFile)
+	require.NoError(err)
+	data, err := ioutil.ReadAll(f)
+	require.NoError(err)
+	require.NoError(f.Close())
+	require.Len(strings.Split(strings.TrimSpace(string(data)), "\n"), 2)
+
+	// only the last durations are kept
+	for i := 0; i < historyDurations+5; i++ {
+		require.NoError(h.Record(
+			&Job{Endpoints: []string{"c"}}, time.Duration(i), nil,
+		))
+	}
+
+	require.Len(h.Get("c").Durations, historyDurations)
+	require.Equal(time.Duration(historyDurations+4),
+		h.Get("c").Durations[historyDurations-1])
+}
+
+func TestHistoryJobFn(t *testing.T) {
+	var require = require.New(t)
+
+	h, err := NewHistory(memfs.New(), "")
+	require.NoError(err)
+
+	fn := NewHistoryJobFn(h, func(ctx context.Context, job *Job) error {
+		if job.ID == "fail" {
+			return fmt.Errorf("foo")
+		}
+
+		return ctx.Err()
+	})
+
+	ctx := context.Background()
+	require.NoError(fn(ctx, &Job{Endpoints: []string{"a"}}))
+	require.Error(fn(ctx, &Job{ID: "fail", Endpoints: []string{"a"}}))
+
+	a := h.Get("a")
+	require.Equal(1, a.Successes)
+	require.Equal(1, a.Failures)
+
+	// the canceled jobs aren't recorded
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.Error(fn(canceled, &Job{Endpoints: []string{"b"}}))
+	require.Nil(h.Get("b"))
+}
+
+func TestWithHistory(t *testing.T) {
+	var require = require.New(t)
+
+	h, err := NewHistory(memfs.New(), "")
+	require.NoError(err)
+
+	slow := &Job{Endpoints: []string{"slow"}}
+	require.NoError(h.Record(slow, time.Hour, nil))
+
+	flaky := &Job{Endpoints: []string{"flaky"}}
+	for i := 0; i < 3; i++ {
+		require.NoError(h.Record(flaky, time.Second, fmt.Errorf("foo")))
+	}
+
+	setup := WithHistory(h, NewHistoryPolicy(&HistoryPolicyOpts{
+		Slow:          time.Minute,
+		FailureStreak: 3,
+	}))
+
+	job := &Job{Endpoints: []string{"slow", "new"}}
+	require.NoError(setup(job))
+	require.True(job.Large)
+	require.Equal(gitcollector.PriorityNormal, job.Priority)
+
+	job = &Job{Endpoints: []string{"flaky"}}
+	require.NoError(setup(job))
+	require.False(job.Large)
+	require.Equal(gitcollector.PriorityLow, job.Priority)
+
+	// the urgent jobs keep their priority
+	job = &Job{
+		Endpoints: []string{"flaky"},
+		Priority:  gitcollector.PriorityHigh,
+	}
+	require.NoError(setup(job))
+	require.Equal(gitcollector.PriorityHigh, job.Priority)
+
+	job = &Job{Endpoints: []string{"new"}}
+	require.NoError(setup(job))
+	require.False(job.Large)
+	require.Equal(gitcollector.PriorityNormal, job.Priority)
+}
@@ -0,0 +1,317 @@
+package library
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrWrongID is returned when an IDProvider supplies an ID the library can't
+// store.
+var ErrWrongID = errors.NewKind("wrong %s id %q for %s: %s")
+
+// IDProvider supplies the identifiers the locations and the repositories are
+// stored with, like the ones of an external catalog, instead of the root
+// commit hashes and the names built from the endpoints.
+type IDProvider interface {
+	// LocationID returns the ID of the location of the repositories whose
+	// root commit has the given hash.
+	LocationID(root string) (borges.LocationID, error)
+	// RepositoryID returns the ID the repository of the endpoint is
+	// stored with in its location.
+	RepositoryID(endpoint string) (borges.RepositoryID, error)
+}
+
+// UUIDProvider is an IDProvider supplying random UUIDs. It's meant to be
+// wrapped by an IDMapping, so the same root commit and endpoint always get
+// the same UUID.
+type UUIDProvider struct{}
+
+var _ IDProvider = UUIDProvider{}
+
+// LocationID implements the IDProvider interface.
+func (UUIDProvider) LocationID(string) (borges.LocationID, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+
+	return borges.LocationID(id.String()), nil
+}
+
+// RepositoryID implements the IDProvider interface.
+func (UUIDProvider) RepositoryID(string) (borges.RepositoryID, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+
+	return borges.RepositoryID(id.String()), nil
+}
+
+// IDMappingFile is the default name of the file of an IDMapping.
+const IDMappingFile = "gitcollector.ids"
+
+const (
+	locationKind   = "location"
+	repositoryKind = "repository"
+)
+
+// idMapping is a line of the file of an IDMapping.
+type idMapping struct {
+	Kind string `json:"kind"`
+	Key  string `json:"key"`
+	ID   string `json:"id"`
+}
+
+// IDMapping is an IDProvider persisting the IDs supplied by another one, so
+// every root commit and endpoint keeps its ID along the runs and the wrapped
+// IDProvider is asked only once for each of them. The endpoints are mapped by
+// their default repository ID, so the variants of the same URL share it. The
+// mappings are appended to its file as JSON lines, to be imported by the
+// catalog.
+type IDMapping struct {
+	mu       sync.Mutex
+	fs       billy.Filesystem
+	path     string
+	provider IDProvider
+	ids      map[string]map[string]string
+	taken    map[string]map[string]string
+}
+
+var _ IDProvider = (*IDMapping)(nil)
+
+// NewIDMapping builds a new IDMapping stored at the given path in the
+// filesystem, loading the mappings already stored.
+func NewIDMapping(
+	fs billy.Filesystem,
+	path string,
+	provider IDProvider,
+) (*IDMapping, error) {
+	if path == "" {
+		path = IDMappingFile
+	}
+
+	m := &IDMapping{
+		fs:       fs,
+		path:     path,
+		provider: provider,
+		ids:      map[string]map[string]string{},
+		taken:    map[string]map[string]string{},
+	}
+
+	for _, kind := range []string{locationKind, repositoryKind} {
+		m.ids[kind] = map[string]string{}
+		m.taken[kind] = map[string]string{}
+	}
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *IDMapping) load() error {
+	f, err := m.fs.Open(m.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var mapping idMapping
+		if err := json.Unmarshal(scanner.Bytes(), &mapping); err != nil {
+			// the last line may be half written by a crash.
+			continue
+		}
+
+		if ids, ok := m.ids[mapping.Kind]; ok {
+			ids[mapping.Key] = mapping.ID
+			m.taken[mapping.Kind][mapping.ID] = mapping.Key
+		}
+	}
+
+	return scanner.Err()
+}
+
+// LocationID implements the IDProvider interface.
+func (m *IDMapping) LocationID(root string) (borges.LocationID, error) {
+	id, err := m.id(locationKind, root, func() (string, error) {
+		id, err := m.provider.LocationID(root)
+		return string(id), err
+	})
+
+	return borges.LocationID(id), err
+}
+
+// RepositoryID implements the IDProvider interface.
+func (m *IDMapping) RepositoryID(
+	endpoint string,
+) (borges.RepositoryID, error) {
+	key, err := NewRepositoryID(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := m.id(repositoryKind, key.String(), func() (string, error) {
+		id, err := m.provider.RepositoryID(endpoint)
+		return string(id), err
+	})
+
+	return borges.RepositoryID(id), err
+}
+
+// id returns the ID mapped to the key, asking for a new one to supply if
+// there's none.
+func (m *IDMapping) id(
+	kind, key string,
+	supply func() (string, error),
+) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id, ok := m.ids[kind][key]; ok {
+		return id, nil
+	}
+
+	id, err := supply()
+	if err != nil {
+		return "", err
+	}
+
+	if err := m.add(kind, key, id); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// restore maps the key to the given ID if it isn't mapped yet, returning the
+// ID it's mapped to and whether it was added. Nothing is written when dry is
+// true.
+func (m *IDMapping) restore(
+	kind, key, id string,
+	dry bool,
+) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mapped, ok := m.ids[kind][key]; ok {
+		return mapped, false, nil
+	}
+
+	if dry {
+		if other, ok := m.taken[kind][id]; ok {
+			return "", false, ErrWrongID.New(
+				kind, id, key, "already used by "+other)
+		}
+
+		return id, true, nil
+	}
+
+	if err := m.add(kind, key, id); err != nil {
+		return "", false, err
+	}
+
+	return id, true, nil
+}
+
+// add appends the mapping of the key to its file, it must be called holding
+// the lock.
+func (m *IDMapping) add(kind, key, id string) error {
+	if err := checkID(kind, key, id); err != nil {
+		return err
+	}
+
+	if other, ok := m.taken[kind][id]; ok {
+		return ErrWrongID.New(kind, id, key, "already used by "+other)
+	}
+
+	data, err := json.Marshal(&idMapping{Kind: kind, Key: key, ID: id})
+	if err != nil {
+		return err
+	}
+
+	f, err := m.fs.OpenFile(
+		m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644,
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	if s, ok := f.(syncer); ok {
+		if err := s.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	m.ids[kind][key] = id
+	m.taken[kind][id] = key
+	return nil
+}
+
+// checkID validates the IDs supplied, the location IDs name the files of the
+// library.
+func checkID(kind, key, id string) error {
+	switch {
+	case id == "":
+		return ErrWrongID.New(kind, id, key, "empty id")
+	case kind == locationKind && strings.ContainsAny(id, `/\`):
+		return ErrWrongID.New(kind, id, key, "it contains a path separator")
+	default:
+		return nil
+	}
+}
+
+// LocationIDFor returns the borges.LocationID of the repositories whose root
+// commit has the given hash, the hash itself unless the Job has an
+// IDProvider.
+func (j *Job) LocationIDFor(root string) (borges.LocationID, error) {
+	if j.IDs == nil {
+		return borges.LocationID(root), nil
+	}
+
+	id, err := j.IDs.LocationID(root)
+	if err != nil {
+		return "", err
+	}
+
+	if err := checkID(locationKind, root, string(id)); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// WithIDProvider is a JobSetupFn storing the locations and the repositories
+// of the Jobs with the IDs of the given IDProvider, replacing their naming.
+func WithIDProvider(p IDProvider) JobSetupFn {
+	return func(job *Job) error {
+		job.IDs = p
+		job.Naming = p.RepositoryID
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+package library
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/src-d/go-borges"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+type testIDProvider struct {
+	calls int
+	ids   []string
+}
+
+func (p *testIDProvider) next() (string, error) {
+	p.calls++
+	if len(p.ids) == 0 {
+		return "", fmt.Errorf("no more ids")
+	}
+
+	id := p.ids[0]
+	p.ids = p.ids[1:]
+	return id, nil
+}
+
+func (p *testIDProvider) LocationID(string) (borges.LocationID, error) {
+	id, err := p.next()
+	return borges.LocationID(id), err
+}
+
+func (p *testIDProvider) RepositoryID(string) (borges.RepositoryID, error) {
+	id, err := p.next()
+	return borges.RepositoryID(id), err
+}
+
+func TestIDMapping(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	provider := &testIDProvider{ids: []string{"loc-1", "repo-1", "loc-1"}}
+	m, err := NewIDMapping(fs, "", provider)
+	require.NoError(err)
+
+	loc, err := m.LocationID("root")
+	require.NoError(err)
+	require.EqualValues("loc-1", loc)
+
+	repo, err := m.RepositoryID("https://github.com/src-d/gitcollector")
+	require.NoError(err)
+	require.EqualValues("repo-1", repo)
+
+	// the ids are supplied once, the variants of an endpoint share it
+	loc, err = m.LocationID("root")
+	require.NoError(err)
+	require.EqualValues("loc-1", loc)
+
+	repo, err = m.RepositoryID("git://github.com/src-d/gitcollector.git")
+	require.NoError(err)
+	require.EqualValues("repo-1", repo)
+	require.Equal(2, provider.calls)
+
+	// an id can't be mapped twice
+	_, err = m.LocationID("other")
+	require.True(ErrWrongID.Is(err))
+
+	// the mappings are loaded by the next run
+	provider = &testIDProvider{}
+	m, err = NewIDMapping(fs, "", provider)
+	require.NoError(err)
+
+	loc, err = m.LocationID("root")
+	require.NoError(err)
+	require.EqualValues("loc-1", loc)
+
+	repo, err = m.RepositoryID("https://github.com/src-d/gitcollector")
+	require.NoError(err)
+	require.EqualValues("repo-1", repo)
+	require.Equal(0, provider.calls)
+
+	// the wrong ids aren't mapped
+	for _, id := range []string{"", "a/b"} {
+		provider.ids = []string{id}
+		_, err = m.LocationID("wrong")
+		require.True(ErrWrongID.Is(err), id)
+	}
+}
+
+func TestWithIDProvider(t *testing.T) {
+	var require = require.New(t)
+
+	job := &Job{}
+	loc, err := job.LocationIDFor("root")
+	require.NoError(err)
+	require.EqualValues("root", loc)
+
+	m, err := NewIDMapping(memfs.New(), "", UUIDProvider{})
+	require.NoError(err)
+	require.NoError(WithIDProvider(m)(job))
+
+	loc, err = job.LocationIDFor("root")
+	require.NoError(err)
+	require.NotEqual("root", string(loc))
+
+	again, err := job.LocationIDFor("root")
+	require.NoError(err)
+	require.Equal(loc, again)
+
+	repo, err := job.RepositoryID("https://github.com/src-d/gitcollector")
+	require.NoError(err)
+	require.NotEqual("github.com/src-d/gitcollector", string(repo))
+
+	job.IDs = &testIDProvider{ids: []string{"a/b"}}
+	_, err = job.LocationIDFor("root")
+	require.True(ErrWrongID.Is(err))
+}
@@ -0,0 +1,203 @@
+package library
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+// PartialDir is the directory of the library where the partial clones of the
+// repositories fetched incrementally are kept between Jobs, along with a JSON
+// file with the progress of each one.
+const PartialDir = ".partial"
+
+const partialStateExt = ".json"
+
+// IncrementalOpts represents configuration options for an IncrementalFetch.
+type IncrementalOpts struct {
+	// FS is where the partial clones are kept, under PartialDir.
+	FS billy.Filesystem
+	// MinSize is the size in bytes from which the repositories are
+	// fetched incrementally. Repositories with unknown size are only
+	// fetched incrementally when it's 0.
+	MinSize uint64
+	// Commits is the number of commits the history is deepened on every
+	// step, default to 10000 when there's no Window.
+	Commits int
+	// Window deepens the history on every step by this period of time
+	// instead of a number of commits.
+	Window time.Duration
+	// Budget is the time a Job keeps deepening the history before leaving
+	// the rest to the next Job of the repository, 0 makes a single step
+	// on every Job.
+	Budget time.Duration
+}
+
+const incrementalCommits = 10000
+
+// PartialClone is the progress of a repository fetched incrementally.
+type PartialClone struct {
+	Repository borges.RepositoryID `json:"repository"`
+	Endpoint   string              `json:"endpoint"`
+	// Depth is the number of commits fetched from the HEAD.
+	Depth int `json:"depth,omitempty"`
+	// Since is the date of the oldest commits fetched.
+	Since *time.Time `json:"since,omitempty"`
+	// Steps is the number of times the history was deepened.
+	Steps   int       `json:"steps"`
+	Started time.Time `json:"started"`
+	Updated time.Time `json:"updated"`
+}
+
+// IncrementalFetch fetches the history of enormous repositories in shallow
+// increments spread over successive Jobs, so no single Job has to transfer the
+// entire history at once. The partial clones and their progress are kept in
+// the PartialDir until the history is complete and the repository is stored.
+type IncrementalFetch struct {
+	opts *IncrementalOpts
+}
+
+// NewIncrementalFetch builds a new IncrementalFetch.
+func NewIncrementalFetch(opts *IncrementalOpts) *IncrementalFetch {
+	if opts.Commits <= 0 && opts.Window <= 0 {
+		opts.Commits = incrementalCommits
+	}
+
+	return &IncrementalFetch{opts: opts}
+}
+
+// Applies returns whether the repository is fetched incrementally: its size
+// hint is big enough or it was already partially fetched. It's false for a nil
+// IncrementalFetch.
+func (f *IncrementalFetch) Applies(id borges.RepositoryID, sizeHint uint64) bool {
+	if f == nil {
+		return false
+	}
+
+	if _, err := f.opts.FS.Stat(f.statePath(id)); err == nil {
+		return true
+	}
+
+	if f.opts.MinSize == 0 {
+		return true
+	}
+
+	return sizeHint >= f.opts.MinSize
+}
+
+// FS returns the filesystem where the partial clones are kept.
+func (f *IncrementalFetch) FS() billy.Filesystem {
+	return f.opts.FS
+}
+
+// Path returns the path of the partial clone of the repository in the FS.
+func (f *IncrementalFetch) Path(id borges.RepositoryID) string {
+	return f.opts.FS.Join(PartialDir, id.String())
+}
+
+// Budget returns the time a Job keeps deepening the history.
+func (f *IncrementalFetch) Budget() time.Duration {
+	return f.opts.Budget
+}
+
+// State returns the progress of the partial clone of the repository, a new
+// one if it has none.
+func (f *IncrementalFetch) State(
+	id borges.RepositoryID,
+	endpoint string,
+) (*PartialClone, error) {
+	file, err := f.opts.FS.Open(f.statePath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &PartialClone{
+				Repository: id,
+				Endpoint:   endpoint,
+				Started:    time.Now().UTC(),
+			}, nil
+		}
+
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &PartialClone{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// Next returns the progress of the partial clone once deepened one more
+// step, it's stored with Save once the step is fetched.
+func (f *IncrementalFetch) Next(state *PartialClone, now time.Time) *PartialClone {
+	next := *state
+	next.Steps++
+	if f.opts.Window > 0 {
+		since := now
+		if state.Since != nil {
+			since = *state.Since
+		}
+
+		since = since.Add(-f.opts.Window).UTC()
+		next.Since = &since
+		return &next
+	}
+
+	next.Depth += f.opts.Commits
+	return &next
+}
+
+// Save stores the progress of the partial clone.
+func (f *IncrementalFetch) Save(state *PartialClone) error {
+	state.Updated = time.Now().UTC()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	path := f.statePath(state.Repository)
+	tmp := path + ".tmp"
+	if err := util.WriteFile(f.opts.FS, tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return f.opts.FS.Rename(tmp, path)
+}
+
+// Remove deletes the partial clone of the repository and its progress.
+func (f *IncrementalFetch) Remove(id borges.RepositoryID) error {
+	if err := util.RemoveAll(f.opts.FS, f.Path(id)); err != nil {
+		return err
+	}
+
+	err := f.opts.FS.Remove(f.statePath(id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (f *IncrementalFetch) statePath(id borges.RepositoryID) string {
+	return f.Path(id) + partialStateExt
+}
+
+// WithIncrementalFetch is a JobSetupFn setting the IncrementalFetch of the
+// Jobs.
+func WithIncrementalFetch(f *IncrementalFetch) JobSetupFn {
+	return func(job *Job) error {
+		job.Incremental = f
+		return nil
+	}
+}
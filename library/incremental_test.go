@@ -0,0 +1,56 @@
+package library
+
+import (
+	"testing"
+	"time"
+
+	"github.com/src-d/go-borges"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestIncrementalFetch(t *testing.T) {
+	var require = require.New(t)
+
+	id := borges.RepositoryID("github.com/src-d/gitcollector")
+	f := NewIncrementalFetch(&IncrementalOpts{
+		FS:      memfs.New(),
+		MinSize: 100,
+	})
+	require.False(f.Applies(id, 0))
+	require.False(f.Applies(id, 99))
+	require.True(f.Applies(id, 100))
+
+	state, err := f.State(id, "https://github.com/src-d/gitcollector")
+	require.NoError(err)
+	require.Zero(state.Steps)
+
+	next := f.Next(state, time.Now())
+	require.Equal(1, next.Steps)
+	require.Equal(incrementalCommits, next.Depth)
+	require.Zero(state.Steps)
+
+	// the repositories partially fetched keep being fetched incrementally
+	require.NoError(f.Save(next))
+	require.True(f.Applies(id, 0))
+
+	state, err = f.State(id, "")
+	require.NoError(err)
+	require.Equal(1, state.Steps)
+	require.Equal("https://github.com/src-d/gitcollector", state.Endpoint)
+
+	require.NoError(f.Remove(id))
+	require.False(f.Applies(id, 0))
+
+	now := time.Date(2019, 6, 10, 0, 0, 0, 0, time.UTC)
+	f = NewIncrementalFetch(&IncrementalOpts{
+		FS:     memfs.New(),
+		Window: 24 * time.Hour,
+	})
+
+	next = f.Next(&PartialClone{}, now)
+	require.Equal(now.Add(-24*time.Hour), *next.Since)
+	next = f.Next(next, now)
+	require.Equal(now.Add(-48*time.Hour), *next.Since)
+	require.Zero(next.Depth)
+}
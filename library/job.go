@@ -2,8 +2,11 @@ package library
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/sandbox"
 	"github.com/src-d/go-borges"
 	"gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-errors.v1"
@@ -39,15 +42,153 @@ type Job struct {
 	LocationID  borges.LocationID
 	AllowUpdate bool
 	AuthToken   AuthTokenFn
-	ProcessFn   JobFn
-	Logger      log.Logger
+	// Auth produces the authentication of every fetch, when it's nil
+	// the tokens of AuthToken are used.
+	Auth      AuthProvider
+	ProcessFn JobFn
+	Logger    log.Logger
+	Naming    RepositoryNameFn
+	// IDs supplies the IDs of the locations and the repositories, nil
+	// means the locations are named by their root commit and the
+	// repositories by Naming.
+	IDs     IDProvider
+	Storage *StorageOpts
+	// Forks caps the number of repositories stored in the same location,
+	// nil means unlimited.
+	Forks *ForkSampler
+	// Merger merges the repositories added to the same location at the
+	// same time, nil means they're written independently.
+	Merger *LocationMerger
+	// NonRooted stores the repository in a location of its own, named by
+	// the hash of its repository ID, instead of in the location of its
+	// root commit along with its forks.
+	NonRooted bool
+	// Sharing keeps the objects of the NonRooted locations in the
+	// ObjectPool of their root commit, nil means every location keeps its
+	// own objects.
+	Sharing *ObjectSharing
+	// Remotes is the RemotesPolicy of a download whose location already
+	// holds other remotes, empty means RemotesAdd.
+	Remotes RemotesPolicy
+	// PullRequests is the way the references of the pull and merge
+	// requests of the downloaded remotes are fetched, empty means
+	// PullRequestsKeep.
+	PullRequests PullRequestRefs
+	// Annotations makes the update jobs leave untouched the locations
+	// marked as do-not-update, nil means all of them can be updated.
+	Annotations *Annotations
+	// Incremental fetches the history of the big repositories in
+	// increments over successive Jobs, nil means they're cloned at once.
+	Incremental *IncrementalFetch
+	// Negotiation chooses the haves advertised by the updates, nil means
+	// the go-git negotiation is used.
+	Negotiation *Negotiation
+	// Sandbox runs the clones of the downloads in restricted processes,
+	// nil means they're cloned by the collection process.
+	Sandbox *sandbox.Sandbox
+	// Policies are applied to the processing of the Job, overriding the
+	// ones of the gitcollector.WorkerPool.
+	Policies *gitcollector.Policies
+	// Large makes the Job be processed as a repository too big to share
+	// the MemoryBudget, even if its size isn't known to be.
+	Large bool
+	// SizeHint is the estimated size in bytes of the repository, 0 if
+	// unknown.
+	SizeHint uint64
+	// Priority makes the Job jump ahead of the ones with a lower
+	// priority, like the urgent updates ahead of the bulk downloads.
+	Priority gitcollector.Priority
+	// NotBefore holds the Job in the scheduler until the given time, like
+	// a retry delayed politely, the zero time means it's processed as soon
+	// as possible.
+	NotBefore time.Time
+	// Labels holds the metadata of the repository reported by the
+	// discovery, like its topics or the time of its last push.
+	Labels map[string]string
+	// Metadata holds the details of the repository reported by the
+	// discovery with their own types, like its stars or its license, to
+	// be used by the schedule and process functions and the metrics.
+	// Unlike Labels they aren't used to route the Job.
+	Metadata map[string]interface{}
+	// After holds the IDs of the Jobs that must succeed before this one
+	// is processed.
+	After []string
+	// AfterLocation makes the Job wait for the in-flight Jobs on the same
+	// location.
+	AfterLocation bool
+	// OnLocation is called through WritesTo once the location the Job
+	// writes to is known.
+	OnLocation func(borges.LocationID)
+	// DiskUsage is the disk space written by the Job, set once it's
+	// processed if it's measured.
+	DiskUsage *DiskUsage
+	// Transfer is the data fetched by the Job, set once it's processed if
+	// it's measured. The clones made in a Sandbox or incrementally aren't.
+	Transfer *Transfer
+	// Unchanged holds the endpoints of an update Job whose remote
+	// references already matched the stored ones, so they weren't
+	// fetched.
+	Unchanged []string
 }
 
-var _ gitcollector.Job = (*Job)(nil)
+var (
+	_ gitcollector.Job         = (*Job)(nil)
+	_ gitcollector.PriorityJob = (*Job)(nil)
+	_ gitcollector.DelayedJob  = (*Job)(nil)
+	_ gitcollector.PolicyJob   = (*Job)(nil)
+	_ gitcollector.TransferJob = (*Job)(nil)
+)
+
+// Metadata set by the github discovery on the Jobs.
+const (
+	// MetadataStars holds the number of stars of the repository as an int.
+	MetadataStars = "stars"
+	// MetadataTopics holds the topics of the repository as a []string.
+	MetadataTopics = "topics"
+	// MetadataDefaultBranch holds the name of the default branch of the
+	// repository as a string.
+	MetadataDefaultBranch = "default_branch"
+	// MetadataLicense holds the key of the license detected by github,
+	// like mit, as a string.
+	MetadataLicense = "license"
+	// MetadataFork holds whether the repository is a fork as a bool.
+	MetadataFork = "fork"
+)
 
 // JobFn represents the task to be performed by a Job.
 type JobFn func(context.Context, *Job) error
 
+// String returns the ID of the Job with its first endpoint, or its location
+// if it has none, to identify it in the heartbeats of the workers.
+func (j *Job) String() string {
+	switch {
+	case len(j.Endpoints) > 1:
+		return fmt.Sprintf("%s %s (+%d)",
+			j.ID, j.Endpoints[0], len(j.Endpoints)-1)
+	case len(j.Endpoints) == 1:
+		return j.ID + " " + j.Endpoints[0]
+	case j.LocationID != "":
+		return j.ID + " " + string(j.LocationID)
+	default:
+		return j.ID
+	}
+}
+
+// JobPriority implements the gitcollector.PriorityJob interface.
+func (j *Job) JobPriority() gitcollector.Priority {
+	return j.Priority
+}
+
+// JobNotBefore implements the gitcollector.DelayedJob interface.
+func (j *Job) JobNotBefore() time.Time {
+	return j.NotBefore
+}
+
+// JobPolicies implements the gitcollector.PolicyJob interface.
+func (j *Job) JobPolicies() *gitcollector.Policies {
+	return j.Policies
+}
+
 // Process implements the Job interface.
 func (j *Job) Process(ctx context.Context) error {
 	if j.ProcessFn == nil {
@@ -57,6 +198,63 @@ func (j *Job) Process(ctx context.Context) error {
 	return j.ProcessFn(ctx, j)
 }
 
+// ErrorFields returns the log fields with the gitcollector.ErrorClass and
+// gitcollector.ErrorCode of the error a Job failed with, so the logs can be
+// filtered by them.
+func ErrorFields(err error) log.Fields {
+	class := gitcollector.ClassifyError(err)
+	return log.Fields{
+		"error_class": class,
+		"error_code":  class.Code(),
+	}
+}
+
+// JobSetupFn configures a Job before it's scheduled.
+type JobSetupFn func(*Job) error
+
+// WithJobSetup wraps the given gitcollector.JobScheduleFn applying the setup
+// functions to every scheduled Job.
+func WithJobSetup(
+	schedule gitcollector.JobScheduleFn,
+	setup ...JobSetupFn,
+) gitcollector.JobScheduleFn {
+	return func(ctx context.Context) (gitcollector.Job, error) {
+		j, err := schedule(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		job, ok := j.(*Job)
+		if !ok {
+			return j, nil
+		}
+
+		for _, fn := range setup {
+			if err := fn(job); err != nil {
+				return nil, err
+			}
+		}
+
+		return job, nil
+	}
+}
+
+// WithPriority is a JobSetupFn setting the Priority of the Job.
+func WithPriority(p gitcollector.Priority) JobSetupFn {
+	return func(job *Job) error {
+		job.Priority = p
+		return nil
+	}
+}
+
+// WithSandbox is a JobSetupFn setting the Sandbox of the Job.
+func WithSandbox(s *sandbox.Sandbox) JobSetupFn {
+	return func(job *Job) error {
+		job.Sandbox = s
+		return nil
+	}
+}
+
 // AuthTokenFn retrieve and authentication token if any for the given endpoint.
 type AuthTokenFn func(endpoint string) string
 
@@ -71,6 +269,27 @@ func getAuthTokenByOrg(tokens map[string]string) AuthTokenFn {
 	}
 }
 
+// OrgJobKey is a gitcollector.JobKeyFn grouping the Jobs by the organization
+// of their first endpoint.
+func OrgJobKey(j gitcollector.Job) string {
+	job, ok := j.(*Job)
+	if !ok || len(job.Endpoints) == 0 {
+		return ""
+	}
+
+	return GetOrgFromEndpoint(job.Endpoints[0])
+}
+
+// JobSize is a gitcollector.JobSizeFn returning the SizeHint of the Jobs.
+func JobSize(j gitcollector.Job) uint64 {
+	job, ok := j.(*Job)
+	if !ok {
+		return 0
+	}
+
+	return job.SizeHint
+}
+
 var (
 	errWrongJob   = errors.NewKind("wrong job found")
 	errNotJobID   = errors.NewKind("couldn't assign an ID to a job")
@@ -146,26 +365,14 @@ func NewJobScheduleFn(
 	jobLogger log.Logger,
 	temp billy.Filesystem,
 ) gitcollector.JobScheduleFn {
-	setupJob := func(job *Job) error {
-		if job.Lib == nil {
-			job.Lib = lib
-		}
-
-		switch job.Type {
-		case JobDownload:
-			job.TempFS = temp
-			job.AllowUpdate = updateOnDownload
-			job.ProcessFn = downloadFn
-		case JobUpdate:
-			job.ProcessFn = updateFn
-		default:
-			return errWrongJob.New()
-		}
-
-		job.AuthToken = getAuthTokenByOrg(authTokens)
-		job.Logger = jobLogger
-		return nil
-	}
+	setupJob := NewJobSetupFn(
+		lib,
+		downloadFn, updateFn,
+		updateOnDownload,
+		authTokens,
+		jobLogger,
+		temp,
+	)
 
 	return func(ctx context.Context) (gitcollector.Job, error) {
 		if download == nil && update == nil {
@@ -226,6 +433,73 @@ func NewJobScheduleFn(
 	}
 }
 
+// NewPolicyJobScheduleFn builds a new gitcollector.ScheduleFn that schedules
+// download and update jobs in different queues like NewJobScheduleFn, sharing
+// the workers between them as the SchedulePolicy of the options decides.
+func NewPolicyJobScheduleFn(
+	lib borges.Library,
+	download, update chan gitcollector.Job,
+	downloadFn, updateFn JobFn,
+	updateOnDownload bool,
+	authTokens map[string]string,
+	jobLogger log.Logger,
+	temp billy.Filesystem,
+	opts *JobSchedulerOpts,
+) (gitcollector.JobScheduleFn, error) {
+	setupJob := NewJobSetupFn(
+		lib,
+		downloadFn, updateFn,
+		updateOnDownload,
+		authTokens,
+		jobLogger,
+		temp,
+	)
+
+	s, err := newQueueScheduler(download, update, setupJob, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.next, nil
+}
+
+// NewJobSetupFn builds a JobSetupFn configuring the download and update Jobs
+// the same way NewJobScheduleFn does. It allows to schedule Jobs coming from
+// other sources, like the gitcollector.PullProviders.
+func NewJobSetupFn(
+	lib borges.Library,
+	downloadFn, updateFn JobFn,
+	updateOnDownload bool,
+	authTokens map[string]string,
+	jobLogger log.Logger,
+	temp billy.Filesystem,
+) JobSetupFn {
+	return func(job *Job) error {
+		if err := assignID(job); err != nil {
+			return err
+		}
+
+		if job.Lib == nil {
+			job.Lib = lib
+		}
+
+		switch job.Type {
+		case JobDownload:
+			job.TempFS = temp
+			job.AllowUpdate = updateOnDownload
+			job.ProcessFn = downloadFn
+		case JobUpdate:
+			job.ProcessFn = updateFn
+		default:
+			return errWrongJob.New()
+		}
+
+		job.AuthToken = getAuthTokenByOrg(authTokens)
+		job.Logger = jobLogger
+		return nil
+	}
+}
+
 func jobFrom(ctx context.Context, queue chan gitcollector.Job) (*Job, error) {
 	if queue == nil {
 		return nil, errClosedChan.New()
@@ -242,14 +516,28 @@ func jobFrom(ctx context.Context, queue chan gitcollector.Job) (*Job, error) {
 			return nil, errWrongJob.New()
 		}
 
-		id, err := uuid.NewRandom()
-		if err != nil {
-			return nil, errNotJobID.Wrap(err)
+		if err := assignID(job); err != nil {
+			return nil, err
 		}
 
-		job.ID = id.String()
 		return job, nil
 	case <-ctx.Done():
 		return nil, gitcollector.ErrNewJobsNotFound.New()
 	}
 }
+
+// assignID gives the Job a new random ID unless it already has one, so Jobs
+// can be referenced by others before being scheduled.
+func assignID(job *Job) error {
+	if job.ID != "" {
+		return nil
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return errNotJobID.Wrap(err)
+	}
+
+	job.ID = id.String()
+	return nil
+}
@@ -141,3 +141,10 @@ func testScheduleFn(
 	wp.Wait()
 	return expected
 }
+
+func TestErrorFields(t *testing.T) {
+	require.Equal(t, log.Fields{
+		"error_class": gitcollector.ErrorClassCanceled,
+		"error_code":  gitcollector.ErrorCodeCanceled,
+	}, ErrorFields(context.Canceled))
+}
@@ -0,0 +1,375 @@
+package library
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// ErrJournal is returned when a journal entry can't be written.
+var ErrJournal = errors.NewKind("couldn't write journal entry for job %s")
+
+// JournalState represents the state of a Job registered in a Journal.
+type JournalState string
+
+const (
+	// JournalBegin marks a Job which started to modify the library.
+	JournalBegin JournalState = "begin"
+	// JournalCommit marks a Job whose changes were committed to the
+	// library.
+	JournalCommit JournalState = "commit"
+	// JournalAbort marks a Job which failed and didn't commit any change.
+	JournalAbort JournalState = "abort"
+)
+
+// JournalEntry is a record of the Journal.
+type JournalEntry struct {
+	ID         string            `json:"id"`
+	State      JournalState      `json:"state"`
+	Type       JobType           `json:"type,omitempty"`
+	Endpoints  []string          `json:"endpoints,omitempty"`
+	LocationID borges.LocationID `json:"location,omitempty"`
+	// Repositories are the IDs the endpoints are stored with, following
+	// the naming of the Job.
+	Repositories []borges.RepositoryID `json:"repositories,omitempty"`
+}
+
+// Job rebuilds the Job registered by the entry. It keeps the ID of the entry,
+// so running it again closes the entry.
+func (e *JournalEntry) Job() *Job {
+	return &Job{
+		ID:         e.ID,
+		Type:       e.Type,
+		Endpoints:  e.Endpoints,
+		LocationID: e.LocationID,
+		Naming:     e.naming(),
+	}
+}
+
+// naming returns the RepositoryNameFn giving the endpoints the IDs recorded,
+// nil for the entries written without them.
+func (e *JournalEntry) naming() RepositoryNameFn {
+	if len(e.Repositories) != len(e.Endpoints) || len(e.Endpoints) == 0 {
+		return nil
+	}
+
+	ids := make(map[string]borges.RepositoryID, len(e.Endpoints))
+	for i, ep := range e.Endpoints {
+		ids[ep] = e.Repositories[i]
+	}
+
+	return func(endpoint string) (borges.RepositoryID, error) {
+		if id, ok := ids[endpoint]; ok {
+			return id, nil
+		}
+
+		return NewRepositoryID(endpoint)
+	}
+}
+
+// Journal is a write-ahead log of the Jobs modifying a library. A Job is
+// registered before it starts modifying the library and after its changes are
+// committed, so Jobs interrupted by a crash can be detected and reconciled
+// on the next start.
+type Journal struct {
+	mu   sync.Mutex
+	fs   billy.Filesystem
+	path string
+}
+
+// JournalFile is the default name of the journal file.
+const JournalFile = "gitcollector.journal"
+
+// NewJournal builds a new Journal stored at the given path in the filesystem.
+func NewJournal(fs billy.Filesystem, path string) *Journal {
+	if path == "" {
+		path = JournalFile
+	}
+
+	return &Journal{fs: fs, path: path}
+}
+
+type syncer interface {
+	Sync() error
+}
+
+func (j *Journal) write(entry *JournalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := j.fs.OpenFile(
+		j.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644,
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	if s, ok := f.(syncer); ok {
+		if err := s.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	return f.Close()
+}
+
+// Begin registers the given Job as started.
+func (j *Journal) Begin(job *Job) error {
+	entry, err := beginEntry(job)
+	if err != nil {
+		return err
+	}
+
+	return j.write(entry)
+}
+
+func beginEntry(job *Job) (*JournalEntry, error) {
+	var ids []borges.RepositoryID
+	for _, ep := range job.Endpoints {
+		id, err := job.RepositoryID(ep)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return &JournalEntry{
+		ID:           job.ID,
+		State:        JournalBegin,
+		Type:         job.Type,
+		Endpoints:    job.Endpoints,
+		LocationID:   job.LocationID,
+		Repositories: ids,
+	}, nil
+}
+
+// Commit registers the given Job as committed.
+func (j *Journal) Commit(job *Job) error {
+	return j.write(&JournalEntry{ID: job.ID, State: JournalCommit})
+}
+
+// Abort registers the given Job as failed.
+func (j *Journal) Abort(job *Job) error {
+	return j.write(&JournalEntry{ID: job.ID, State: JournalAbort})
+}
+
+// Pending returns the entries of the Jobs which began but never committed
+// nor aborted.
+func (j *Journal) Pending() ([]*JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := j.fs.Open(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		pending = map[string]*JournalEntry{}
+		order   []string
+		scanner = bufio.NewScanner(f)
+	)
+
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// a torn write of the last entry when crashing.
+			continue
+		}
+
+		switch entry.State {
+		case JournalBegin:
+			if _, ok := pending[entry.ID]; !ok {
+				order = append(order, entry.ID)
+			}
+
+			e := entry
+			pending[entry.ID] = &e
+		default:
+			delete(pending, entry.ID)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var entries []*JournalEntry
+	for _, id := range order {
+		if e, ok := pending[id]; ok {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, nil
+}
+
+// Reconcile checks the pending entries of the Journal against the given
+// library. Download Jobs whose repositories are already stored in the library
+// are considered committed. The rest of the pending Jobs are returned so they
+// can be enqueued again. The journal is compacted afterwards to the entries of
+// the returned Jobs, which stay pending until they're run again, so a crash
+// before that finds them on the next start.
+func (j *Journal) Reconcile(
+	ctx context.Context,
+	lib borges.Library,
+) ([]*Job, error) {
+	pending, err := j.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*Job
+	for _, entry := range pending {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if entry.Type == JobDownload && lib != nil {
+			done, err := libHasAll(lib, entry.Job())
+			if err != nil {
+				return nil, err
+			}
+
+			if done {
+				continue
+			}
+		}
+
+		jobs = append(jobs, entry.Job())
+	}
+
+	if err := j.compact(jobs); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// compact replaces the journal with the begin entries of the given Jobs.
+func (j *Journal) compact(jobs []*Job) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(jobs) == 0 {
+		if err := j.fs.Remove(j.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	tmp := j.path + ".tmp"
+	f, err := j.fs.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		entry, err := beginEntry(job)
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if s, ok := f.(syncer); ok {
+		if err := s.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return j.fs.Rename(tmp, j.path)
+}
+
+func libHasAll(lib borges.Library, job *Job) (bool, error) {
+	if len(job.Endpoints) == 0 {
+		return false, nil
+	}
+
+	for _, ep := range job.Endpoints {
+		id, err := job.RepositoryID(ep)
+		if err != nil {
+			return false, err
+		}
+
+		ok, _, _, err := lib.Has(id)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// NewJournaledJobFn wraps the given JobFn registering in the Journal the start
+// and the end of each Job.
+func NewJournaledJobFn(journal *Journal, fn JobFn) JobFn {
+	return func(ctx context.Context, job *Job) error {
+		if err := journal.Begin(job); err != nil {
+			return ErrJournal.Wrap(err, job.ID)
+		}
+
+		if err := fn(ctx, job); err != nil {
+			// the failure of the job is returned, the entry left
+			// pending reruns it on the next start.
+			if aerr := journal.Abort(job); aerr != nil {
+				logger := job.Logger
+				if logger == nil {
+					logger = log.New(nil)
+				}
+
+				logger.Warningf("couldn't abort the job in the "+
+					"journal: %s", aerr)
+			}
+
+			return err
+		}
+
+		if err := journal.Commit(job); err != nil {
+			return ErrJournal.Wrap(err, job.ID)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,131 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestJournal(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+		TempFS: memfs.New(),
+	})
+	require.NoError(err)
+
+	journal := NewJournal(fs, "")
+	fn := NewJournaledJobFn(journal, func(_ context.Context, j *Job) error {
+		if j.ID == "fail" {
+			return fmt.Errorf("failed")
+		}
+
+		return nil
+	})
+
+	ctx := context.Background()
+	require.NoError(fn(ctx, &Job{ID: "ok", Type: JobDownload}))
+	require.Error(fn(ctx, &Job{ID: "fail", Type: JobDownload}))
+
+	// simulate crashed jobs
+	crashed := []*Job{
+		{
+			ID:        "crashed-1",
+			Type:      JobDownload,
+			Endpoints: []string{"git://github.com/src-d/gitcollector"},
+		},
+		{
+			ID:         "crashed-2",
+			Type:       JobUpdate,
+			LocationID: "foo",
+		},
+	}
+
+	for _, job := range crashed {
+		require.NoError(journal.Begin(job))
+	}
+
+	pending, err := journal.Pending()
+	require.NoError(err)
+	require.Len(pending, 2)
+	require.Equal("crashed-1", pending[0].ID)
+	require.Equal("crashed-2", pending[1].ID)
+
+	jobs, err := journal.Reconcile(ctx, lib)
+	require.NoError(err)
+	require.Len(jobs, 2)
+	require.Equal(crashed[0].Endpoints, jobs[0].Endpoints)
+	require.EqualValues(JobUpdate, jobs[1].Type)
+	require.EqualValues("foo", jobs[1].LocationID)
+
+	// the entries are kept until the jobs run again
+	pending, err = journal.Pending()
+	require.NoError(err)
+	require.Len(pending, 2)
+	require.Equal("crashed-1", pending[0].ID)
+	require.Equal("crashed-2", pending[1].ID)
+
+	jobs, err = journal.Reconcile(ctx, lib)
+	require.NoError(err)
+	require.Len(jobs, 2)
+
+	for _, job := range jobs {
+		require.NoError(fn(ctx, job))
+	}
+
+	pending, err = journal.Pending()
+	require.NoError(err)
+	require.Len(pending, 0)
+}
+
+func TestJournalNaming(t *testing.T) {
+	var require = require.New(t)
+
+	lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+		Transactional: true,
+		TempFS:        memfs.New(),
+	})
+	require.NoError(err)
+
+	naming, err := NewTemplateNameFn(NamingFlat)
+	require.NoError(err)
+
+	loc, err := lib.AddLocation("foo")
+	require.NoError(err)
+	r, err := loc.Init("github.com_src-d_foo")
+	require.NoError(err)
+	require.NoError(r.Commit())
+
+	journal := NewJournal(memfs.New(), "")
+	for _, job := range []*Job{
+		{
+			ID:        "stored",
+			Type:      JobDownload,
+			Endpoints: []string{"https://github.com/src-d/foo"},
+			Naming:    naming,
+		},
+		{
+			ID:        "missing",
+			Type:      JobDownload,
+			Endpoints: []string{"https://github.com/src-d/bar"},
+			Naming:    naming,
+		},
+	} {
+		require.NoError(journal.Begin(job))
+	}
+
+	// the repositories are looked for with the naming of the jobs
+	jobs, err := journal.Reconcile(context.Background(), lib)
+	require.NoError(err)
+	require.Len(jobs, 1)
+	require.Equal("missing", jobs[0].ID)
+
+	id, err := jobs[0].RepositoryID("https://github.com/src-d/bar")
+	require.NoError(err)
+	require.EqualValues("github.com_src-d_bar", id)
+}
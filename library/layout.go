@@ -0,0 +1,147 @@
+package library
+
+import (
+	"os"
+	"strings"
+
+	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrUnsupportedLibraryVersion is returned when the library was written
+	// with a newer metadata version than the supported one.
+	ErrUnsupportedLibraryVersion = errors.NewKind(
+		"library version %d not supported, latest supported version %d")
+
+	// ErrBucketMismatch is returned when the configured bucket level
+	// doesn't match the one found in an existing library.
+	ErrBucketMismatch = errors.NewKind(
+		"library bucket level is %d but %d was requested")
+)
+
+// LibraryVersion is the latest library metadata version supported.
+const LibraryVersion = 0
+
+// LibraryMode is the way an existing library is handled.
+type LibraryMode string
+
+const (
+	// LibraryUpgrade upgrades the metadata of legacy libraries in place.
+	LibraryUpgrade LibraryMode = "upgrade"
+	// LibraryCompatible keeps legacy libraries untouched, the metadata is
+	// never written.
+	LibraryCompatible LibraryMode = "compatible"
+)
+
+// LibraryLayout describes how an existing siva library is laid out.
+type LibraryLayout struct {
+	// Bucket is the bucketization level of the siva files, -1 if it
+	// couldn't be detected because the library is empty.
+	Bucket int
+	// Version is the metadata version, -1 if there is no metadata.
+	Version int
+	// Legacy is true when the library has siva files but no metadata,
+	// as written by older tools like borges.
+	Legacy bool
+}
+
+// DetectLayout inspects the given filesystem looking for an existing siva
+// library.
+func DetectLayout(fs billy.Filesystem) (*LibraryLayout, error) {
+	layout := &LibraryLayout{Bucket: -1, Version: -1}
+	lib, err := siva.NewLibrary("detect", fs, siva.LibraryOptions{
+		TempFS: memfs.New(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	layout.Version = lib.Version()
+	bucket, err := detectBucket(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	layout.Bucket = bucket
+	layout.Legacy = bucket >= 0 && layout.Version < 0
+	return layout, nil
+}
+
+// detectBucket looks for siva files in the root of the filesystem or in the
+// bucket directories, named with the first characters of the location ids.
+func detectBucket(fs billy.Filesystem) (int, error) {
+	files, err := fs.ReadDir("")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return -1, nil
+		}
+
+		return -1, err
+	}
+
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".siva") {
+			return 0, nil
+		}
+	}
+
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+
+		sivas, err := fs.ReadDir(f.Name())
+		if err != nil {
+			return -1, err
+		}
+
+		for _, s := range sivas {
+			if !s.IsDir() && strings.HasSuffix(s.Name(), ".siva") {
+				return len([]rune(f.Name())), nil
+			}
+		}
+	}
+
+	return -1, nil
+}
+
+// Negotiate checks the layout against the supported version and the
+// requested bucket level, returning the bucket level to use. Legacy libraries
+// are upgraded writing their metadata when mode is LibraryUpgrade.
+func (l *LibraryLayout) Negotiate(
+	fs billy.Filesystem,
+	bucket int,
+	mode LibraryMode,
+) (int, error) {
+	if l.Version > LibraryVersion {
+		return 0, ErrUnsupportedLibraryVersion.New(
+			l.Version, LibraryVersion)
+	}
+
+	if l.Bucket >= 0 && l.Bucket != bucket {
+		if bucket >= 0 {
+			return 0, ErrBucketMismatch.New(l.Bucket, bucket)
+		}
+
+		bucket = l.Bucket
+	}
+
+	if bucket < 0 {
+		bucket = 0
+	}
+
+	if !l.Legacy || mode != LibraryUpgrade {
+		return bucket, nil
+	}
+
+	if err := siva.NewLibraryMetadata(LibraryVersion).Save(fs); err != nil {
+		return 0, err
+	}
+
+	l.Version = LibraryVersion
+	l.Legacy = false
+	return bucket, nil
+}
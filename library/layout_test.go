@@ -0,0 +1,57 @@
+package library
+
+import (
+	"testing"
+
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+func TestDetectLayout(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	layout, err := DetectLayout(fs)
+	require.NoError(err)
+	require.Equal(&LibraryLayout{Bucket: -1, Version: -1}, layout)
+
+	bucket, err := layout.Negotiate(fs, 2, LibraryUpgrade)
+	require.NoError(err)
+	require.Equal(2, bucket)
+
+	require.NoError(util.WriteFile(fs, "ab/abcdef.siva", nil, 0644))
+	layout, err = DetectLayout(fs)
+	require.NoError(err)
+	require.Equal(
+		&LibraryLayout{Bucket: 2, Version: -1, Legacy: true},
+		layout,
+	)
+
+	_, err = layout.Negotiate(fs, 0, LibraryUpgrade)
+	require.True(ErrBucketMismatch.Is(err))
+
+	bucket, err = layout.Negotiate(fs, 2, LibraryCompatible)
+	require.NoError(err)
+	require.Equal(2, bucket)
+	_, err = fs.Stat(siva.LibraryMetadataFile)
+	require.Error(err)
+
+	bucket, err = layout.Negotiate(fs, -1, LibraryUpgrade)
+	require.NoError(err)
+	require.Equal(2, bucket)
+
+	layout, err = DetectLayout(fs)
+	require.NoError(err)
+	require.Equal(
+		&LibraryLayout{Bucket: 2, Version: LibraryVersion},
+		layout,
+	)
+
+	require.NoError(siva.NewLibraryMetadata(LibraryVersion + 1).Save(fs))
+	layout, err = DetectLayout(fs)
+	require.NoError(err)
+	_, err = layout.Negotiate(fs, 2, LibraryUpgrade)
+	require.True(ErrUnsupportedLibraryVersion.Is(err))
+}
@@ -0,0 +1,159 @@
+package library
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBudgetOpts represents configuration options for a MemoryBudget.
+type MemoryBudgetOpts struct {
+	// Total is the memory in bytes that all the in-flight Jobs can use.
+	Total uint64
+	// PerWorker is the memory in bytes a single Job is expected to use at
+	// most. Jobs predicted to exceed it are processed one at a time.
+	PerWorker uint64
+	// Factor is the ratio between the memory needed to process a
+	// repository and its size.
+	Factor float64
+	// Default is the memory in bytes assumed for a Job whose repository
+	// size is unknown.
+	Default uint64
+}
+
+const (
+	memoryFactor  = 1.5
+	memoryDefault = 64 << 20
+)
+
+// MemoryBudget tracks the approximate memory used by the in-flight Jobs.
+type MemoryBudget struct {
+	mu      sync.Mutex
+	inUse   uint64
+	large   bool
+	changed chan struct{}
+	opts    *MemoryBudgetOpts
+}
+
+// NewMemoryBudget builds a new MemoryBudget.
+func NewMemoryBudget(opts *MemoryBudgetOpts) *MemoryBudget {
+	if opts == nil {
+		opts = &MemoryBudgetOpts{}
+	}
+
+	if opts.Factor <= 0 {
+		opts.Factor = memoryFactor
+	}
+
+	if opts.Default == 0 {
+		opts.Default = memoryDefault
+	}
+
+	return &MemoryBudget{
+		changed: make(chan struct{}),
+		opts:    opts,
+	}
+}
+
+// Estimate returns the memory predicted to process the given Job.
+func (b *MemoryBudget) Estimate(job *Job) uint64 {
+	if job.SizeHint == 0 {
+		return b.opts.Default
+	}
+
+	return uint64(float64(job.SizeHint) * b.opts.Factor)
+}
+
+// IsLarge returns whether the given estimation exceeds the per worker budget.
+func (b *MemoryBudget) IsLarge(n uint64) bool {
+	return b.opts.PerWorker > 0 && n > b.opts.PerWorker
+}
+
+// InUse returns the memory currently reserved by the in-flight Jobs.
+func (b *MemoryBudget) InUse() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.inUse
+}
+
+// Acquire reserves n bytes from the budget blocking until they're available
+// or the context is done. A reservation bigger than the whole budget is
+// granted when nothing else is in use.
+func (b *MemoryBudget) Acquire(ctx context.Context, n uint64) error {
+	return b.acquire(ctx, n, b.IsLarge(n))
+}
+
+// acquire reserves n bytes, the large reservations are granted one at a
+// time.
+func (b *MemoryBudget) acquire(
+	ctx context.Context,
+	n uint64,
+	large bool,
+) error {
+	for {
+		b.mu.Lock()
+		if b.fits(n, large) {
+			b.inUse += n
+			if large {
+				b.large = true
+			}
+
+			b.mu.Unlock()
+			return nil
+		}
+
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (b *MemoryBudget) fits(n uint64, large bool) bool {
+	if large && b.large {
+		return false
+	}
+
+	return b.inUse == 0 || b.opts.Total == 0 || b.inUse+n <= b.opts.Total
+}
+
+// Release returns n bytes to the budget.
+func (b *MemoryBudget) Release(n uint64) {
+	b.release(n, b.IsLarge(n))
+}
+
+func (b *MemoryBudget) release(n uint64, large bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if large {
+		b.large = false
+	}
+
+	if n > b.inUse {
+		n = b.inUse
+	}
+
+	b.inUse -= n
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// NewMemoryBudgetJobFn wraps the given JobFn so each Job reserves its
+// estimated memory from the budget before being processed. The Large Jobs are
+// processed one at a time like the ones exceeding the per worker budget.
+func NewMemoryBudgetJobFn(budget *MemoryBudget, fn JobFn) JobFn {
+	return func(ctx context.Context, job *Job) error {
+		n := budget.Estimate(job)
+		large := job.Large || budget.IsLarge(n)
+		if err := budget.acquire(ctx, n, large); err != nil {
+			return err
+		}
+
+		defer budget.release(n, large)
+		return fn(ctx, job)
+	}
+}
@@ -0,0 +1,86 @@
+package library
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	var require = require.New(t)
+
+	budget := NewMemoryBudget(&MemoryBudgetOpts{
+		Total:     100,
+		PerWorker: 40,
+		Factor:    1,
+		Default:   10,
+	})
+
+	require.EqualValues(10, budget.Estimate(&Job{}))
+	require.EqualValues(50, budget.Estimate(&Job{SizeHint: 50}))
+
+	var (
+		mu      sync.Mutex
+		running int
+		maxRun  int
+		wg      sync.WaitGroup
+	)
+
+	fn := NewMemoryBudgetJobFn(budget, func(context.Context, *Job) error {
+		mu.Lock()
+		running++
+		if running > maxRun {
+			maxRun = running
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+
+	// large repositories are serialized
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(fn(context.Background(), &Job{SizeHint: 45}))
+		}()
+	}
+
+	wg.Wait()
+	require.Equal(1, maxRun)
+	require.EqualValues(0, budget.InUse())
+
+	// and so are the ones marked as large
+	maxRun = 0
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(fn(context.Background(), &Job{Large: true}))
+		}()
+	}
+
+	wg.Wait()
+	require.Equal(1, maxRun)
+	require.EqualValues(0, budget.InUse())
+
+	// a job bigger than the budget gets it when nothing else is running
+	require.NoError(budget.Acquire(context.Background(), 200))
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 10*time.Millisecond,
+	)
+	defer cancel()
+	require.Error(budget.Acquire(ctx, 10))
+
+	budget.Release(200)
+	require.NoError(budget.Acquire(context.Background(), 10))
+}
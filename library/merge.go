@@ -0,0 +1,174 @@
+package library
+
+import (
+	"context"
+	"sync"
+
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// errMergeAborted is sent to the repositories waiting to be merged into a
+// write which finished without merging them, they claim the location again.
+var errMergeAborted = errors.NewKind("location write finished before merging")
+
+// LocationMerger coordinates the Jobs adding repositories to the same location
+// at the same time. The first Job claiming a location owns its write and the
+// repositories of the Jobs claiming it afterwards are merged into it, so the
+// location is committed once with all their remotes instead of racing
+// transactions where the last commit loses the remotes of the others.
+type LocationMerger struct {
+	mu     sync.Mutex
+	writes map[locationKey]*LocationWrite
+}
+
+// locationKey identifies a location, the same location can be found in the
+// libraries of different storage tiers.
+type locationKey struct {
+	lib borges.LibraryID
+	loc borges.LocationID
+}
+
+// NewLocationMerger builds a new LocationMerger.
+func NewLocationMerger() *LocationMerger {
+	return &LocationMerger{writes: map[locationKey]*LocationWrite{}}
+}
+
+// MergedRemote is a repository merged into the write of another Job.
+type MergedRemote struct {
+	// ID is the repository, it's also the name of its remote.
+	ID borges.RepositoryID
+	// Endpoint is the URL the repository is fetched from.
+	Endpoint string
+	// Auth produces the authentication to fetch the endpoint.
+	Auth AuthFn
+	// PullRequests is the way the references of its pull requests are
+	// fetched.
+	PullRequests PullRequestRefs
+
+	err    error
+	result chan error
+}
+
+// Fail records the error found merging the repository, it's reported to its
+// Job instead of the result of the write.
+func (r *MergedRemote) Fail(err error) {
+	r.err = err
+}
+
+// LocationWrite is the ownership of the write of a location.
+type LocationWrite struct {
+	merger  *LocationMerger
+	key     locationKey
+	pending []*MergedRemote
+	merged  []*MergedRemote
+	closed  bool
+	done    chan struct{}
+}
+
+// Claim claims the write of the location of the library for the given
+// repository. The caller
+// owns the write if a LocationWrite is returned, and it must call Done once
+// it's finished. Otherwise the repository is merged into the write of another
+// Job and Claim blocks until it's finished, returning the result of the merge.
+func (m *LocationMerger) Claim(
+	ctx context.Context,
+	lib borges.LibraryID,
+	id borges.LocationID,
+	remote *MergedRemote,
+) (*LocationWrite, error) {
+	key := locationKey{lib: lib, loc: id}
+	for {
+		m.mu.Lock()
+		w, ok := m.writes[key]
+		if !ok {
+			w = &LocationWrite{merger: m, key: key, done: make(chan struct{})}
+			m.writes[key] = w
+			m.mu.Unlock()
+			return w, nil
+		}
+
+		if w.closed {
+			// the write doesn't admit more merges, the location is
+			// claimed again once it finishes.
+			done := w.done
+			m.mu.Unlock()
+
+			select {
+			case <-done:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		remote.err = nil
+		remote.result = make(chan error, 1)
+		w.pending = append(w.pending, remote)
+		m.mu.Unlock()
+
+		// the owner could still merge the repository once the context
+		// is done, the result is buffered so it doesn't block.
+		select {
+		case err := <-remote.result:
+			if errMergeAborted.Is(err) {
+				continue
+			}
+
+			return nil, err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Pending returns the repositories to merge into the write since the last
+// call. Once it returns none the write doesn't admit more merges, so it must
+// be called until then right before committing the location.
+func (w *LocationWrite) Pending() []*MergedRemote {
+	w.merger.mu.Lock()
+	defer w.merger.mu.Unlock()
+
+	pending := w.pending
+	w.pending = nil
+	if len(pending) == 0 {
+		w.closed = true
+	}
+
+	w.merged = append(w.merged, pending...)
+	return pending
+}
+
+// Done finishes the write with the given error, the result of the merged
+// repositories. The ones waiting to be merged claim the location again.
+func (w *LocationWrite) Done(err error) {
+	w.merger.mu.Lock()
+	delete(w.merger.writes, w.key)
+	pending := w.pending
+	w.pending = nil
+	w.closed = true
+	w.merger.mu.Unlock()
+
+	for _, r := range w.merged {
+		result := r.err
+		if result == nil {
+			result = err
+		}
+
+		r.result <- result
+	}
+
+	for _, r := range pending {
+		r.result <- errMergeAborted.New()
+	}
+
+	close(w.done)
+}
+
+// WithLocationMerger is a JobSetupFn setting the LocationMerger of the Jobs.
+func WithLocationMerger(m *LocationMerger) JobSetupFn {
+	return func(job *Job) error {
+		job.Merger = m
+		return nil
+	}
+}
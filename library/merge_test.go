@@ -0,0 +1,110 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type claimResult struct {
+	write *LocationWrite
+	err   error
+}
+
+func testClaim(m *LocationMerger, r *MergedRemote) chan claimResult {
+	res := make(chan claimResult, 1)
+	go func() {
+		w, err := m.Claim(context.Background(), "lib", "loc", r)
+		res <- claimResult{w, err}
+	}()
+
+	return res
+}
+
+func waitPending(t *testing.T, m *LocationMerger, n int) {
+	for i := 0; i < 100; i++ {
+		m.mu.Lock()
+		w := m.writes[locationKey{lib: "lib", loc: "loc"}]
+		pending := w != nil && len(w.pending) == n
+		m.mu.Unlock()
+		if pending {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("%d claims not pending", n)
+}
+
+func TestLocationMerger(t *testing.T) {
+	var require = require.New(t)
+
+	m := NewLocationMerger()
+	w, err := m.Claim(context.Background(), "lib", "loc", &MergedRemote{ID: "a"})
+	require.NoError(err)
+	require.NotNil(w)
+
+	b, c := &MergedRemote{ID: "b"}, &MergedRemote{ID: "c"}
+	resB := testClaim(m, b)
+	waitPending(t, m, 1)
+	resC := testClaim(m, c)
+	waitPending(t, m, 2)
+
+	pending := w.Pending()
+	require.Equal([]*MergedRemote{b, c}, pending)
+	c.Fail(fmt.Errorf("fetch failed"))
+	require.Empty(w.Pending())
+
+	// the write is closed, the new claims wait for it.
+	resD := testClaim(m, &MergedRemote{ID: "d"})
+	time.Sleep(50 * time.Millisecond)
+	require.Len(resD, 0)
+
+	w.Done(nil)
+
+	res := <-resB
+	require.Nil(res.write)
+	require.NoError(res.err)
+
+	res = <-resC
+	require.Nil(res.write)
+	require.EqualError(res.err, "fetch failed")
+
+	res = <-resD
+	require.NoError(res.err)
+	require.NotNil(res.write)
+	res.write.Done(nil)
+}
+
+func TestLocationMergerAborted(t *testing.T) {
+	var require = require.New(t)
+
+	m := NewLocationMerger()
+	w, err := m.Claim(context.Background(), "lib", "loc", &MergedRemote{ID: "a"})
+	require.NoError(err)
+
+	resB := testClaim(m, &MergedRemote{ID: "b"})
+	waitPending(t, m, 1)
+
+	// the owner failed before merging, the waiting claim owns the
+	// location now.
+	w.Done(fmt.Errorf("clone failed"))
+
+	res := <-resB
+	require.NoError(res.err)
+	require.NotNil(res.write)
+	res.write.Done(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err = m.Claim(ctx, "lib", "loc", &MergedRemote{ID: "a"})
+	require.NoError(err)
+
+	cancel()
+	_, err = m.Claim(ctx, "lib", "loc", &MergedRemote{ID: "b"})
+	require.Equal(context.Canceled, err)
+	w.Done(nil)
+}
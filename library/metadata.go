@@ -0,0 +1,97 @@
+package library
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+// MetadataDir is the directory of the library where the metadata of the
+// repositories is stored.
+const MetadataDir = ".metadata"
+
+const metadataExt = ".json"
+
+// RepositoryMetadata is the context of a repository given by its hosting
+// service at collection time, like its description or README, kept for the
+// search and catalog tools.
+type RepositoryMetadata struct {
+	Repository  borges.RepositoryID `json:"repository"`
+	Endpoint    string              `json:"endpoint"`
+	Description string              `json:"description,omitempty"`
+	Homepage    string              `json:"homepage,omitempty"`
+	Topics      []string            `json:"topics,omitempty"`
+	Language    string              `json:"language,omitempty"`
+	// ReadmeHTML is the README of the repository rendered to HTML, empty
+	// if it has none or it wasn't captured.
+	ReadmeHTML string    `json:"readme_html,omitempty"`
+	Captured   time.Time `json:"captured"`
+}
+
+// MetadataStore stores the RepositoryMetadata of a library in its
+// MetadataDir, a JSON file for every repository.
+type MetadataStore struct {
+	fs billy.Filesystem
+}
+
+// NewMetadataStore builds a new MetadataStore for the library stored in the
+// given filesystem.
+func NewMetadataStore(fs billy.Filesystem) *MetadataStore {
+	return &MetadataStore{fs: fs}
+}
+
+// Get returns the RepositoryMetadata of the repository, nil if it has none.
+func (s *MetadataStore) Get(id borges.RepositoryID) (*RepositoryMetadata, error) {
+	f, err := s.fs.Open(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &RepositoryMetadata{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Set stores the RepositoryMetadata replacing the previous one of the
+// repository.
+func (s *MetadataStore) Set(m *RepositoryMetadata) error {
+	if m.Captured.IsZero() {
+		m.Captured = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	// the metadata is written to a temporal file and renamed so it's
+	// never read half written.
+	tmp := s.path(m.Repository) + ".tmp"
+	if err := util.WriteFile(s.fs, tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return s.fs.Rename(tmp, s.path(m.Repository))
+}
+
+func (s *MetadataStore) path(id borges.RepositoryID) string {
+	return s.fs.Join(MetadataDir, string(id)+metadataExt)
+}
@@ -0,0 +1,42 @@
+package library
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestMetadataStore(t *testing.T) {
+	var require = require.New(t)
+
+	store := NewMetadataStore(memfs.New())
+
+	m, err := store.Get("github.com/src-d/gitcollector")
+	require.NoError(err)
+	require.Nil(m)
+
+	require.NoError(store.Set(&RepositoryMetadata{
+		Repository:  "github.com/src-d/gitcollector",
+		Endpoint:    "https://github.com/src-d/gitcollector",
+		Description: "collector of git repositories",
+		Topics:      []string{"git", "go"},
+	}))
+
+	m, err = store.Get("github.com/src-d/gitcollector")
+	require.NoError(err)
+	require.Equal("collector of git repositories", m.Description)
+	require.Equal([]string{"git", "go"}, m.Topics)
+	require.False(m.Captured.IsZero())
+
+	// a new capture replaces the previous one.
+	require.NoError(store.Set(&RepositoryMetadata{
+		Repository: "github.com/src-d/gitcollector",
+		ReadmeHTML: "<h1>gitcollector</h1>",
+	}))
+
+	m, err = store.Get("github.com/src-d/gitcollector")
+	require.NoError(err)
+	require.Empty(m.Description)
+	require.Equal("<h1>gitcollector</h1>", m.ReadmeHTML)
+}
@@ -0,0 +1,96 @@
+package library
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrWrongNamingTemplate is returned when a naming template uses an unknown
+// placeholder.
+var ErrWrongNamingTemplate = errors.NewKind("wrong naming template %q: %s")
+
+// Naming templates for the stored repositories. The placeholders {host},
+// {org} and {name} are replaced by the pieces of the repository endpoint and
+// {hash} by the SHA-1 of the default repository ID.
+const (
+	// NamingHostOrgName names repositories as host/org/name, the default.
+	NamingHostOrgName = "{host}/{org}/{name}"
+	// NamingOrgName names repositories as org/name.
+	NamingOrgName = "{org}/{name}"
+	// NamingFlat names repositories as host_org_name.
+	NamingFlat = "{host}_{org}_{name}"
+	// NamingHash names repositories by the hash of their ID.
+	NamingHash = "{hash}"
+)
+
+// RepositoryNameFn builds the borges.RepositoryID a repository will be stored
+// with from its endpoint.
+type RepositoryNameFn func(endpoint string) (borges.RepositoryID, error)
+
+var placeholders = []string{"{host}", "{org}", "{name}", "{hash}"}
+
+// NewTemplateNameFn builds a RepositoryNameFn from the given naming template.
+func NewTemplateNameFn(template string) (RepositoryNameFn, error) {
+	if template == "" || template == NamingHostOrgName {
+		return NewRepositoryID, nil
+	}
+
+	rest := template
+	for _, p := range placeholders {
+		rest = strings.Replace(rest, p, "", -1)
+	}
+
+	if strings.ContainsAny(rest, "{}") {
+		return nil, ErrWrongNamingTemplate.New(
+			template, "unknown placeholder")
+	}
+
+	if rest == template {
+		return nil, ErrWrongNamingTemplate.New(
+			template, "no placeholders found")
+	}
+
+	return func(endpoint string) (borges.RepositoryID, error) {
+		id, err := NewRepositoryID(endpoint)
+		if err != nil {
+			return "", err
+		}
+
+		parts := strings.SplitN(id.String(), "/", 3)
+		for len(parts) < 3 {
+			parts = append(parts, "")
+		}
+
+		sum := sha1.Sum([]byte(id.String()))
+		r := strings.NewReplacer(
+			"{host}", parts[0],
+			"{org}", parts[1],
+			"{name}", parts[2],
+			"{hash}", hex.EncodeToString(sum[:]),
+		)
+
+		return borges.RepositoryID(r.Replace(template)), nil
+	}, nil
+}
+
+// RepositoryID returns the borges.RepositoryID for the given endpoint using
+// the naming of the Job.
+func (j *Job) RepositoryID(endpoint string) (borges.RepositoryID, error) {
+	if j.Naming == nil {
+		return NewRepositoryID(endpoint)
+	}
+
+	return j.Naming(endpoint)
+}
+
+// WithNaming is a JobSetupFn setting the naming of the stored repositories.
+func WithNaming(naming RepositoryNameFn) JobSetupFn {
+	return func(job *Job) error {
+		job.Naming = naming
+		return nil
+	}
+}
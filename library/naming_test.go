@@ -0,0 +1,35 @@
+package library
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateNameFn(t *testing.T) {
+	var require = require.New(t)
+
+	const endpoint = "https://github.com/src-d/gitcollector.git"
+	tests := map[string]string{
+		"":                "github.com/src-d/gitcollector",
+		NamingHostOrgName: "github.com/src-d/gitcollector",
+		NamingOrgName:     "src-d/gitcollector",
+		NamingFlat:        "github.com_src-d_gitcollector",
+		NamingHash:        "80e87941bac9308be903bff68846bcafa4c740fe",
+	}
+
+	for template, expected := range tests {
+		fn, err := NewTemplateNameFn(template)
+		require.NoError(err)
+
+		id, err := fn(endpoint)
+		require.NoError(err)
+		require.Equal(expected, id.String(), template)
+	}
+
+	_, err := NewTemplateNameFn("{host}/{repo}")
+	require.True(ErrWrongNamingTemplate.Is(err))
+
+	_, err = NewTemplateNameFn("static")
+	require.True(ErrWrongNamingTemplate.Is(err))
+}
@@ -0,0 +1,98 @@
+package library
+
+import "gopkg.in/src-d/go-errors.v1"
+
+// ErrUnknownNegotiation is returned when a NegotiationAlgorithm isn't
+// supported.
+var ErrUnknownNegotiation = errors.NewKind("unknown negotiation algorithm %q")
+
+// NegotiationAlgorithm is the way the commits of a location advertised as
+// haves to the server are chosen.
+type NegotiationAlgorithm string
+
+const (
+	// NegotiationConsecutive advertises the most recent commits of every
+	// reference, the default.
+	NegotiationConsecutive NegotiationAlgorithm = "consecutive"
+	// NegotiationSkipping advertises the commits of every reference at
+	// exponentially growing distances from its tip, covering a deeper
+	// history with fewer haves.
+	NegotiationSkipping NegotiationAlgorithm = "skipping"
+)
+
+// NegotiationOpts represents configuration options for a Negotiation.
+type NegotiationOpts struct {
+	// Algorithm is the NegotiationAlgorithm, default to
+	// NegotiationConsecutive.
+	Algorithm NegotiationAlgorithm
+	// Depth is the number of commits of the history of every reference
+	// walked looking for haves, default to 100 like go-git.
+	Depth int
+	// RemoteOnly only advertises the references of the remote being
+	// fetched instead of the ones of every repository of the location.
+	RemoteOnly bool
+}
+
+const negotiationDepth = 100
+
+// Negotiation chooses the haves advertised by the fetches updating the
+// locations. go-git advertises up to 100 commits of every reference of the
+// location, so the updates of rooted repositories with many remotes spend
+// most of their time negotiating instead of transferring objects.
+type Negotiation struct {
+	opts *NegotiationOpts
+}
+
+// NewNegotiation builds a new Negotiation.
+func NewNegotiation(opts *NegotiationOpts) (*Negotiation, error) {
+	if opts == nil {
+		opts = &NegotiationOpts{}
+	}
+
+	if opts.Algorithm == "" {
+		opts.Algorithm = NegotiationConsecutive
+	}
+
+	switch opts.Algorithm {
+	case NegotiationConsecutive, NegotiationSkipping:
+	default:
+		return nil, ErrUnknownNegotiation.New(opts.Algorithm)
+	}
+
+	if opts.Depth <= 0 {
+		opts.Depth = negotiationDepth
+	}
+
+	return &Negotiation{opts: opts}, nil
+}
+
+// RemoteOnly returns whether only the references of the fetched remote are
+// advertised.
+func (n *Negotiation) RemoteOnly() bool {
+	return n.opts.RemoteOnly
+}
+
+// Visit returns whether the history of a reference is walked further once the
+// given number of its commits were visited.
+func (n *Negotiation) Visit(visited int) bool {
+	return visited < n.opts.Depth
+}
+
+// Advertise returns whether the commit at the given position of the walk of a
+// reference, starting at 0 for its tip, is advertised.
+func (n *Negotiation) Advertise(i int) bool {
+	if n.opts.Algorithm == NegotiationSkipping {
+		// 0, 1, 3, 7, 15...
+		return (i+1)&i == 0
+	}
+
+	return true
+}
+
+// WithNegotiation is a JobSetupFn setting the Negotiation of the Job.
+func WithNegotiation(n *Negotiation) JobSetupFn {
+	return func(job *Job) error {
+		job.Negotiation = n
+		return nil
+	}
+}
@@ -0,0 +1,18 @@
+package library
+
+import (
+	"context"
+
+	"github.com/src-d/gitcollector"
+)
+
+// NewOutageJobFn wraps the given JobFn to run it through the
+// gitcollector.OutageDetector, so the Jobs wait for the forge to recover
+// instead of failing while it's unavailable.
+func NewOutageJobFn(d *gitcollector.OutageDetector, fn JobFn) JobFn {
+	return func(ctx context.Context, job *Job) error {
+		return d.Do(ctx, func(ctx context.Context) error {
+			return fn(ctx, job)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package library
+
+import (
+	"context"
+
+	"github.com/src-d/gitcollector"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrUnknownPolicy is returned when a SchedulePolicy isn't supported.
+var ErrUnknownPolicy = errors.NewKind("unknown schedule policy %q")
+
+// SchedulePolicy decides which queue of a NewPolicyJobScheduleFn gets the workers
+// when both the download and the update queues have Jobs.
+type SchedulePolicy string
+
+const (
+	// PolicyDownloadFirst takes the updates only while there aren't
+	// downloads, the default.
+	PolicyDownloadFirst SchedulePolicy = "download-first"
+	// PolicyUpdateFirst takes the downloads only while there aren't
+	// updates.
+	PolicyUpdateFirst SchedulePolicy = "update-first"
+	// PolicyRoundRobin alternates the queues.
+	PolicyRoundRobin SchedulePolicy = "round-robin"
+	// PolicyWeighted takes in turn as many Jobs from each queue as its
+	// weight.
+	PolicyWeighted SchedulePolicy = "weighted"
+)
+
+// JobSchedulerOpts represents configuration options for NewPolicyJobScheduleFn.
+type JobSchedulerOpts struct {
+	// Policy is the SchedulePolicy, default to PolicyDownloadFirst.
+	Policy SchedulePolicy
+	// DownloadWeight is the number of downloads taken in a row with
+	// PolicyWeighted, default to 1.
+	DownloadWeight int
+	// UpdateWeight is the number of updates taken in a row with
+	// PolicyWeighted, default to 1.
+	UpdateWeight int
+}
+
+const (
+	downloadQueue = 0
+	updateQueue   = 1
+)
+
+// queueScheduler takes the Jobs of the download and update queues following a
+// SchedulePolicy. The queue whose turn it is is served first, the other one
+// only if it's empty, so the workers are never kept waiting for a queue while
+// the other one has Jobs.
+type queueScheduler struct {
+	queues [2]chan gitcollector.Job
+	setup  JobSetupFn
+	// weights are the Jobs served in a row from each queue, nil for the
+	// policies always preferring the same queue.
+	weights []int
+	turn    int
+	served  int
+}
+
+func newQueueScheduler(
+	download, update chan gitcollector.Job,
+	setup JobSetupFn,
+	opts *JobSchedulerOpts,
+) (*queueScheduler, error) {
+	if opts == nil {
+		opts = &JobSchedulerOpts{}
+	}
+
+	s := &queueScheduler{
+		queues: [2]chan gitcollector.Job{download, update},
+		setup:  setup,
+	}
+
+	switch opts.Policy {
+	case "", PolicyDownloadFirst:
+		s.turn = downloadQueue
+	case PolicyUpdateFirst:
+		s.turn = updateQueue
+	case PolicyRoundRobin:
+		s.weights = []int{1, 1}
+	case PolicyWeighted:
+		s.weights = []int{opts.DownloadWeight, opts.UpdateWeight}
+		for i, w := range s.weights {
+			if w <= 0 {
+				s.weights[i] = 1
+			}
+		}
+	default:
+		return nil, ErrUnknownPolicy.New(opts.Policy)
+	}
+
+	return s, nil
+}
+
+func (s *queueScheduler) next(ctx context.Context) (gitcollector.Job, error) {
+	for {
+		if s.queues[downloadQueue] == nil && s.queues[updateQueue] == nil {
+			return nil, gitcollector.ErrJobSource.New()
+		}
+
+		i, j, ok, err := s.poll(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			// the queue is closed.
+			s.queues[i] = nil
+			continue
+		}
+
+		job, isJob := j.(*Job)
+		if !isJob {
+			return nil, errWrongJob.New()
+		}
+
+		s.take(i)
+		if err := s.setup(job); err != nil {
+			return nil, gitcollector.ErrNewJobsNotFound.New()
+		}
+
+		return job, nil
+	}
+}
+
+// poll returns the next Job of the queue whose turn it is, or of the other
+// one if it's empty, waiting for any of them until the context is done.
+func (s *queueScheduler) poll(
+	ctx context.Context,
+) (int, gitcollector.Job, bool, error) {
+	for _, i := range []int{s.turn, 1 - s.turn} {
+		// the nil queues are skipped by the select.
+		select {
+		case j, ok := <-s.queues[i]:
+			return i, j, ok, nil
+		default:
+		}
+	}
+
+	select {
+	case j, ok := <-s.queues[downloadQueue]:
+		return downloadQueue, j, ok, nil
+	case j, ok := <-s.queues[updateQueue]:
+		return updateQueue, j, ok, nil
+	case <-ctx.Done():
+		return 0, nil, false, gitcollector.ErrNewJobsNotFound.New()
+	}
+}
+
+// take accounts a Job served from the given queue, passing the turn to the
+// other queue once it took as many Jobs in a row as its weight.
+func (s *queueScheduler) take(i int) {
+	if s.weights == nil {
+		return
+	}
+
+	if i != s.turn {
+		s.turn, s.served = i, 0
+	}
+
+	s.served++
+	if s.served >= s.weights[i] {
+		s.turn, s.served = 1-i, 0
+	}
+}
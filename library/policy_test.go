@@ -0,0 +1,101 @@
+package library
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+func TestJobSchedulePolicy(t *testing.T) {
+	var require = require.New(t)
+
+	_, err := NewPolicyJobScheduleFn(
+		nil, nil, nil, nil, nil, false, nil, log.New(nil), nil,
+		&JobSchedulerOpts{Policy: "foo"},
+	)
+	require.True(ErrUnknownPolicy.Is(err))
+
+	run := func(opts *JobSchedulerOpts) string {
+		download := make(chan gitcollector.Job, 10)
+		update := make(chan gitcollector.Job, 10)
+		for _, e := range []string{"a", "b", "c", "d"} {
+			download <- &Job{Type: JobDownload, Endpoints: []string{e}}
+		}
+
+		for _, e := range []string{"1", "2", "3"} {
+			update <- &Job{Type: JobUpdate, Endpoints: []string{e}}
+		}
+
+		close(download)
+		close(update)
+
+		sched, err := NewPolicyJobScheduleFn(
+			nil, download, update, nil, nil, false, nil,
+			log.New(nil), nil, opts,
+		)
+		require.NoError(err)
+
+		var got []string
+		for {
+			ctx, cancel := context.WithTimeout(
+				context.Background(), time.Second,
+			)
+
+			job, err := sched(ctx)
+			cancel()
+			if err != nil {
+				require.True(gitcollector.ErrJobSource.Is(err))
+				break
+			}
+
+			got = append(got, job.(*Job).Endpoints[0])
+		}
+
+		return strings.Join(got, "")
+	}
+
+	require.Equal("abcd123", run(nil))
+	require.Equal("123abcd", run(&JobSchedulerOpts{Policy: PolicyUpdateFirst}))
+	require.Equal("a1b2c3d", run(&JobSchedulerOpts{Policy: PolicyRoundRobin}))
+	require.Equal("abc12d3", run(&JobSchedulerOpts{
+		Policy:         PolicyWeighted,
+		DownloadWeight: 3,
+		UpdateWeight:   2,
+	}))
+}
+
+func TestJobScheduleWaitsBothQueues(t *testing.T) {
+	var require = require.New(t)
+
+	download := make(chan gitcollector.Job)
+	update := make(chan gitcollector.Job, 1)
+	sched, err := NewPolicyJobScheduleFn(
+		nil, download, update, nil, nil, false, nil,
+		log.New(nil), nil, nil,
+	)
+	require.NoError(err)
+
+	// the updates aren't held back while waiting for downloads
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		update <- &Job{Type: JobUpdate, Endpoints: []string{"1"}}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, err := sched(ctx)
+	require.NoError(err)
+	require.Equal("1", job.(*Job).Endpoints[0])
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = sched(ctx)
+	require.True(gitcollector.ErrNewJobsNotFound.Is(err))
+}
@@ -0,0 +1,115 @@
+package library
+
+import (
+	"context"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// ErrRepositoryUnavailable is returned when the probe of a repository finds
+// it doesn't exist or it isn't accessible anymore.
+var ErrRepositoryUnavailable = errors.NewKind("repository %s not available")
+
+// ProbeOpts represents configuration options for the repository probes.
+type ProbeOpts struct {
+	// Timeout is the maximum time a probe can take, the Job is processed
+	// normally if it's exceeded. Default to 10 seconds.
+	Timeout time.Duration
+}
+
+const probeTimeout = 10 * time.Second
+
+// NewProbeJobFn wraps the given JobFn checking the repository of the download
+// Jobs exists before processing them, only requesting its references. Jobs
+// whose repository isn't found or requires authentication fail immediately
+// with ErrRepositoryUnavailable instead of attempting a full clone. Any other
+// probe failure is left to the JobFn.
+func NewProbeJobFn(opts *ProbeOpts, fn JobFn) JobFn {
+	if opts == nil {
+		opts = &ProbeOpts{}
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = probeTimeout
+	}
+
+	return func(ctx context.Context, job *Job) error {
+		if job.Type != JobDownload || len(job.Endpoints) != 1 {
+			return fn(ctx, job)
+		}
+
+		endpoint := job.Endpoints[0]
+		err := probe(ctx, job, endpoint, timeout)
+		switch gitcollector.ClassifyError(err) {
+		case gitcollector.ErrorClassNotFound, gitcollector.ErrorClassAuth:
+			jobLogger(job).With(log.Fields{"error": err}).
+				Infof("repository not available")
+			return ErrRepositoryUnavailable.Wrap(err, endpoint)
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return fn(ctx, job)
+	}
+}
+
+// probe requests the references of the repository. The request can't be
+// canceled so it's abandoned once the timeout is reached.
+func probe(
+	ctx context.Context,
+	job *Job,
+	endpoint string,
+	timeout time.Duration,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	auth, err := job.FetchAuth(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- advertisedReferences(endpoint, auth)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func advertisedReferences(endpoint string, auth transport.AuthMethod) error {
+	ep, err := transport.NewEndpoint(endpoint)
+	if err != nil {
+		return err
+	}
+
+	c, err := client.NewClient(ep)
+	if err != nil {
+		return err
+	}
+
+	s, err := c.NewUploadPackSession(ep, auth)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.AdvertisedReferences()
+	if cerr := s.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,71 @@
+package library
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func TestProbeJobFn(t *testing.T) {
+	var require = require.New(t)
+
+	sto := memory.NewStorage()
+	repo, err := git.Init(sto, memfs.New())
+	require.NoError(err)
+
+	wt, err := repo.Worktree()
+	require.NoError(err)
+
+	_, err = wt.Commit("initial", &git.CommitOptions{
+		Author: &object.Signature{Name: "a", When: time.Now()},
+	})
+	require.NoError(err)
+
+	client.InstallProtocol("probe", server.NewClient(server.MapLoader{
+		"probe://host/org/exists": sto,
+	}))
+	defer client.InstallProtocol("probe", nil)
+
+	var processed int
+	fn := NewProbeJobFn(nil, func(context.Context, *Job) error {
+		processed++
+		return nil
+	})
+
+	job := &Job{
+		Type:      JobDownload,
+		Endpoints: []string{"probe://host/org/exists"},
+	}
+	require.NoError(fn(context.Background(), job))
+	require.Equal(1, processed)
+
+	job.Endpoints = []string{"probe://host/org/missing"}
+	err = fn(context.Background(), job)
+	require.True(ErrRepositoryUnavailable.Is(err))
+	require.Equal(
+		gitcollector.ErrorClassNotFound,
+		gitcollector.ClassifyError(err),
+	)
+	require.Equal(1, processed)
+
+	job.Type = JobUpdate
+	require.NoError(fn(context.Background(), job))
+	require.Equal(2, processed)
+
+	job = &Job{
+		Type:      JobDownload,
+		Endpoints: []string{"unknown://host/org/repo"},
+	}
+	require.NoError(fn(context.Background(), job))
+	require.Equal(3, processed)
+}
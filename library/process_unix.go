@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package library
+
+import "syscall"
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
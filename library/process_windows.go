@@ -0,0 +1,7 @@
+package library
+
+// processAlive can't tell on windows, the namespaces are only considered
+// orphans once their lease expires.
+func processAlive(int) bool {
+	return true
+}
@@ -0,0 +1,189 @@
+package library
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// ErrUnknownPullRequestRefs is returned when a PullRequestRefs isn't
+// supported.
+var ErrUnknownPullRequestRefs = errors.NewKind(
+	"unknown pull request references %q")
+
+// PullRequestRefs is the way the references of the pull and merge requests
+// advertised by the remotes are fetched.
+type PullRequestRefs string
+
+const (
+	// PullRequestsKeep fetches them as any other reference of the remote,
+	// at refs/remotes/{remote}/pull/{n}/head, the default.
+	PullRequestsKeep PullRequestRefs = "keep"
+	// PullRequestsSkip only fetches the branches and the tags of the
+	// remote.
+	PullRequestsSkip PullRequestRefs = "skip"
+	// PullRequestsNamespace fetches the branches and the tags of the
+	// remote and the heads of its pull and merge requests apart, at
+	// refs/remotes/{remote}/pr/{n}, recording the mapping in the config
+	// of the repository.
+	PullRequestsNamespace PullRequestRefs = "namespace"
+)
+
+// PullRequestsSection is the section of the git config of the locations
+// where the PullRequestMapping of every remote fetched with
+// PullRequestsNamespace is recorded, in the subsection of the remote.
+const PullRequestsSection = "gitcollector-pullrequests"
+
+const (
+	pullRequestsNamespace = "pr"
+	namespaceKey          = "namespace"
+	sourceKey             = "source"
+)
+
+// pullRequestSources are the references the hosting services advertise the
+// heads of the pull and merge requests with.
+var pullRequestSources = []string{
+	"refs/pull/*/head",
+	"refs/merge-requests/*/head",
+}
+
+// ParsePullRequestRefs returns the PullRequestRefs of the given name,
+// PullRequestsKeep if it's empty.
+func ParsePullRequestRefs(name string) (PullRequestRefs, error) {
+	switch p := PullRequestRefs(name); p {
+	case "":
+		return PullRequestsKeep, nil
+	case PullRequestsKeep, PullRequestsSkip, PullRequestsNamespace:
+		return p, nil
+	default:
+		return "", ErrUnknownPullRequestRefs.New(name)
+	}
+}
+
+// RefSpecs returns the refspecs the given remote is fetched with. Every one
+// of them has the HEAD of the remote too.
+func (p PullRequestRefs) RefSpecs(remote string) []config.RefSpec {
+	prefix := "refs/remotes/" + remote
+	specs := []config.RefSpec{
+		config.RefSpec(fmt.Sprintf("+HEAD:%s/HEAD", prefix)),
+	}
+
+	if p != PullRequestsSkip && p != PullRequestsNamespace {
+		return append(specs,
+			config.RefSpec(fmt.Sprintf("+refs/*:%s/*", prefix)))
+	}
+
+	specs = append(specs,
+		config.RefSpec(fmt.Sprintf("+refs/heads/*:%s/heads/*", prefix)),
+		config.RefSpec(fmt.Sprintf("+refs/tags/*:%s/tags/*", prefix)),
+	)
+
+	if p == PullRequestsNamespace {
+		for _, src := range pullRequestSources {
+			specs = append(specs, config.RefSpec(fmt.Sprintf(
+				"+%s:%s/%s/*", src, prefix, pullRequestsNamespace,
+			)))
+		}
+	}
+
+	return specs
+}
+
+// WithPullRequestRefs is a JobSetupFn setting the PullRequestRefs of the Job.
+func WithPullRequestRefs(p PullRequestRefs) JobSetupFn {
+	return func(job *Job) error {
+		job.PullRequests = p
+		return nil
+	}
+}
+
+// PullRequestMapping is the mapping of the references of the pull and merge
+// requests of a remote fetched with PullRequestsNamespace.
+type PullRequestMapping struct {
+	// Namespace is the prefix of the references the heads of the pull
+	// requests are stored at, followed by their number.
+	Namespace string
+	// Sources are the patterns of the references of the remote they're
+	// fetched from, the number replacing the wildcard.
+	Sources []string
+}
+
+// SetPullRequestMapping records in the config the PullRequestMapping of the
+// remote if it's fetched with PullRequestsNamespace, removing it otherwise.
+func SetPullRequestMapping(
+	cfg *config.Config,
+	remote string,
+	p PullRequestRefs,
+) {
+	if p != PullRequestsNamespace {
+		cfg.Raw.RemoveSubsection(PullRequestsSection, remote)
+		return
+	}
+
+	cfg.Raw.Section(PullRequestsSection).Subsection(remote).
+		SetOption(namespaceKey, string(pullRequestPrefix(remote))).
+		SetOption(sourceKey, pullRequestSources...)
+}
+
+// GetPullRequestMapping returns the PullRequestMapping of the remote recorded
+// in the config, nil if it isn't fetched with PullRequestsNamespace.
+func GetPullRequestMapping(
+	cfg *config.Config,
+	remote string,
+) *PullRequestMapping {
+	for _, s := range cfg.Raw.Sections {
+		if !s.IsName(PullRequestsSection) || !s.HasSubsection(remote) {
+			continue
+		}
+
+		ss := s.Subsection(remote)
+		return &PullRequestMapping{
+			Namespace: ss.Option(namespaceKey),
+			Sources:   ss.Options.GetAll(sourceKey),
+		}
+	}
+
+	return nil
+}
+
+// PullRequestRef returns the reference the head of the pull request n of the
+// remote is stored at with PullRequestsNamespace.
+func PullRequestRef(remote string, n int) plumbing.ReferenceName {
+	return plumbing.ReferenceName(
+		string(pullRequestPrefix(remote)) + strconv.Itoa(n))
+}
+
+// ParsePullRequestRef returns the remote and the number of the pull request
+// of a reference stored with PullRequestsNamespace, false if it isn't one.
+func ParsePullRequestRef(ref plumbing.ReferenceName) (string, int, bool) {
+	const prefix = "refs/remotes/"
+	name := ref.String()
+	if !strings.HasPrefix(name, prefix) {
+		return "", 0, false
+	}
+
+	name = name[len(prefix):]
+	sep := "/" + pullRequestsNamespace + "/"
+	i := strings.LastIndex(name, sep)
+	if i <= 0 {
+		return "", 0, false
+	}
+
+	n, err := strconv.Atoi(name[i+len(sep):])
+	if err != nil || n < 0 {
+		return "", 0, false
+	}
+
+	remote := name[:i]
+	return remote, n, true
+}
+
+func pullRequestPrefix(remote string) plumbing.ReferenceName {
+	return plumbing.ReferenceName(fmt.Sprintf(
+		"refs/remotes/%s/%s/", remote, pullRequestsNamespace,
+	))
+}
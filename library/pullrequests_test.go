@@ -0,0 +1,165 @@
+package library
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func TestParsePullRequestRefs(t *testing.T) {
+	var require = require.New(t)
+
+	for name, expected := range map[string]PullRequestRefs{
+		"":          PullRequestsKeep,
+		"keep":      PullRequestsKeep,
+		"skip":      PullRequestsSkip,
+		"namespace": PullRequestsNamespace,
+	} {
+		p, err := ParsePullRequestRefs(name)
+		require.NoError(err, name)
+		require.Equal(expected, p, name)
+	}
+
+	_, err := ParsePullRequestRefs("fetch")
+	require.True(ErrUnknownPullRequestRefs.Is(err))
+}
+
+func TestPullRequestRefSpecs(t *testing.T) {
+	var require = require.New(t)
+
+	remote := "github.com/foo/bar"
+	require.Equal([]config.RefSpec{
+		"+HEAD:refs/remotes/github.com/foo/bar/HEAD",
+		"+refs/*:refs/remotes/github.com/foo/bar/*",
+	}, PullRequestRefs("").RefSpecs(remote))
+	require.Equal(
+		PullRequestRefs("").RefSpecs(remote),
+		PullRequestsKeep.RefSpecs(remote),
+	)
+
+	require.Equal([]config.RefSpec{
+		"+HEAD:refs/remotes/github.com/foo/bar/HEAD",
+		"+refs/heads/*:refs/remotes/github.com/foo/bar/heads/*",
+		"+refs/tags/*:refs/remotes/github.com/foo/bar/tags/*",
+	}, PullRequestsSkip.RefSpecs(remote))
+
+	require.Equal([]config.RefSpec{
+		"+HEAD:refs/remotes/github.com/foo/bar/HEAD",
+		"+refs/heads/*:refs/remotes/github.com/foo/bar/heads/*",
+		"+refs/tags/*:refs/remotes/github.com/foo/bar/tags/*",
+		"+refs/pull/*/head:refs/remotes/github.com/foo/bar/pr/*",
+		"+refs/merge-requests/*/head:refs/remotes/github.com/foo/bar/pr/*",
+	}, PullRequestsNamespace.RefSpecs(remote))
+}
+
+func TestPullRequestMapping(t *testing.T) {
+	var require = require.New(t)
+
+	cfg := config.NewConfig()
+	remote := "github.com/foo/bar"
+	require.Nil(GetPullRequestMapping(cfg, remote))
+
+	SetPullRequestMapping(cfg, remote, PullRequestsKeep)
+	require.Nil(GetPullRequestMapping(cfg, remote))
+
+	SetPullRequestMapping(cfg, remote, PullRequestsNamespace)
+	SetPullRequestMapping(cfg, "github.com/foo/baz", PullRequestsNamespace)
+	expected := &PullRequestMapping{
+		Namespace: "refs/remotes/github.com/foo/bar/pr/",
+		Sources:   []string{"refs/pull/*/head", "refs/merge-requests/*/head"},
+	}
+	require.Equal(expected, GetPullRequestMapping(cfg, remote))
+
+	// the mapping survives the serialization of the config
+	data, err := cfg.Marshal()
+	require.NoError(err)
+	cfg = config.NewConfig()
+	require.NoError(cfg.Unmarshal(data))
+	require.Equal(expected, GetPullRequestMapping(cfg, remote))
+
+	SetPullRequestMapping(cfg, remote, PullRequestsSkip)
+	require.Nil(GetPullRequestMapping(cfg, remote))
+	require.NotNil(GetPullRequestMapping(cfg, "github.com/foo/baz"))
+}
+
+func TestParsePullRequestRef(t *testing.T) {
+	var require = require.New(t)
+
+	ref := PullRequestRef("github.com/foo/bar", 42)
+	require.Equal(
+		plumbing.ReferenceName("refs/remotes/github.com/foo/bar/pr/42"),
+		ref,
+	)
+
+	remote, n, ok := ParsePullRequestRef(ref)
+	require.True(ok)
+	require.Equal("github.com/foo/bar", remote)
+	require.Equal(42, n)
+
+	for _, name := range []string{
+		"refs/heads/pr/1",
+		"refs/remotes/github.com/foo/bar/heads/master",
+		"refs/remotes/github.com/foo/bar/pr/head",
+		"refs/remotes/github.com/foo/bar/pr/-1",
+		"refs/remotes/pr/1",
+	} {
+		_, _, ok := ParsePullRequestRef(plumbing.ReferenceName(name))
+		require.False(ok, name)
+	}
+}
+
+func TestPullRequestsNamespaceFetch(t *testing.T) {
+	var require = require.New(t)
+
+	remoteDir, err := ioutil.TempDir("", "gitcollector")
+	require.NoError(err)
+	defer os.RemoveAll(remoteDir)
+
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", remoteDir}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		require.NoError(err, string(out))
+	}
+
+	run("init", "-q")
+	run("commit", "-q", "--allow-empty", "-m", "master")
+	run("commit", "-q", "--allow-empty", "-m", "pull request")
+	run("update-ref", "refs/pull/7/head", "HEAD")
+	run("update-ref", "refs/merge-requests/9/head", "HEAD")
+	run("reset", "-q", "--hard", "HEAD~1")
+
+	remote := "example.com/foo/bar"
+	for _, p := range []PullRequestRefs{
+		PullRequestsKeep, PullRequestsSkip, PullRequestsNamespace,
+	} {
+		repo, err := git.Init(memory.NewStorage(), nil)
+		require.NoError(err)
+
+		r, err := repo.CreateRemote(&config.RemoteConfig{
+			Name:  remote,
+			URLs:  []string{"file://" + remoteDir},
+			Fetch: p.RefSpecs(remote),
+		})
+		require.NoError(err)
+		require.NoError(r.Fetch(&git.FetchOptions{}))
+
+		_, err = repo.Reference(PullRequestRef(remote, 7), false)
+		require.Equal(p == PullRequestsNamespace, err == nil, string(p))
+		_, err = repo.Reference(PullRequestRef(remote, 9), false)
+		require.Equal(p == PullRequestsNamespace, err == nil, string(p))
+		_, err = repo.Reference(plumbing.ReferenceName(
+			"refs/remotes/"+remote+"/pull/7/head"), false)
+		require.Equal(p == PullRequestsKeep, err == nil, string(p))
+	}
+}
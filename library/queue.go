@@ -0,0 +1,127 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/go-borges"
+)
+
+// QueueCodec is a gitcollector.JobCodec storing the Jobs in a
+// gitcollector.PersistentQueue. Only what the discovery sets on the Jobs is
+// stored, the rest is configured again when they're scheduled.
+type QueueCodec struct{}
+
+var _ gitcollector.JobCodec = QueueCodec{}
+
+type queueRecord struct {
+	ID         string                 `json:"id,omitempty"`
+	Type       JobType                `json:"type"`
+	Endpoints  []string               `json:"endpoints,omitempty"`
+	LocationID borges.LocationID      `json:"location,omitempty"`
+	SizeHint   uint64                 `json:"size,omitempty"`
+	Priority   gitcollector.Priority  `json:"priority,omitempty"`
+	NotBefore  *time.Time             `json:"not_before,omitempty"`
+	Labels     map[string]string      `json:"labels,omitempty"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	After      []string               `json:"after,omitempty"`
+	AfterLoc   bool                   `json:"after_location,omitempty"`
+}
+
+// Encode implements the gitcollector.JobCodec interface.
+func (QueueCodec) Encode(j gitcollector.Job) ([]byte, error) {
+	job, ok := j.(*Job)
+	if !ok {
+		return nil, errWrongJob.New()
+	}
+
+	var notBefore *time.Time
+	if !job.NotBefore.IsZero() {
+		notBefore = &job.NotBefore
+	}
+
+	return json.Marshal(&queueRecord{
+		ID:         job.ID,
+		Type:       job.Type,
+		Endpoints:  job.Endpoints,
+		LocationID: job.LocationID,
+		SizeHint:   job.SizeHint,
+		Priority:   job.Priority,
+		NotBefore:  notBefore,
+		Labels:     job.Labels,
+		Metadata:   job.Metadata,
+		After:      job.After,
+		AfterLoc:   job.AfterLocation,
+	})
+}
+
+// Decode implements the gitcollector.JobCodec interface.
+func (QueueCodec) Decode(data []byte) (gitcollector.Job, error) {
+	var r queueRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+
+	// the numbers and lists are decoded with the generic JSON types.
+	if stars, ok := r.Metadata[MetadataStars].(float64); ok {
+		r.Metadata[MetadataStars] = int(stars)
+	}
+
+	if topics, ok := r.Metadata[MetadataTopics].([]interface{}); ok {
+		list := make([]string, 0, len(topics))
+		for _, t := range topics {
+			if s, ok := t.(string); ok {
+				list = append(list, s)
+			}
+		}
+
+		r.Metadata[MetadataTopics] = list
+	}
+
+	var notBefore time.Time
+	if r.NotBefore != nil {
+		notBefore = *r.NotBefore
+	}
+
+	return &Job{
+		ID:            r.ID,
+		Type:          r.Type,
+		Endpoints:     r.Endpoints,
+		LocationID:    r.LocationID,
+		SizeHint:      r.SizeHint,
+		Priority:      r.Priority,
+		NotBefore:     notBefore,
+		Labels:        r.Labels,
+		Metadata:      r.Metadata,
+		After:         r.After,
+		AfterLocation: r.AfterLoc,
+	}, nil
+}
+
+// WithPersistentQueue is a JobSetupFn acknowledging the Jobs delivered by the
+// given gitcollector.PersistentQueue once they're processed successfully, so
+// the ones interrupted are delivered again by the next run.
+func WithPersistentQueue(q *gitcollector.PersistentQueue) JobSetupFn {
+	return func(job *Job) error {
+		fn := job.ProcessFn
+		job.ProcessFn = func(ctx context.Context, j *Job) error {
+			if err := q.Begin(job); err != nil {
+				return err
+			}
+
+			if fn == nil {
+				return ErrJobFnNotFound.New()
+			}
+
+			if err := fn(ctx, j); err != nil {
+				return err
+			}
+
+			return q.Ack(job)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,85 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueCodec(t *testing.T) {
+	var require = require.New(t)
+
+	job := &Job{
+		ID:         "id",
+		Type:       JobUpdate,
+		Endpoints:  []string{"https://github.com/src-d/gitcollector"},
+		LocationID: "loc",
+		SizeHint:   1024,
+		Priority:   gitcollector.PriorityHigh,
+		NotBefore:  time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC),
+		Labels:     map[string]string{"org": "src-d"},
+		Metadata: map[string]interface{}{
+			MetadataStars:  42,
+			MetadataTopics: []string{"git"},
+			MetadataFork:   true,
+		},
+		After:         []string{"other"},
+		AfterLocation: true,
+	}
+
+	data, err := QueueCodec{}.Encode(job)
+	require.NoError(err)
+
+	decoded, err := QueueCodec{}.Decode(data)
+	require.NoError(err)
+	require.Equal(job, decoded)
+
+	_, err = QueueCodec{}.Encode(nil)
+	require.True(errWrongJob.Is(err))
+}
+
+func TestWithPersistentQueue(t *testing.T) {
+	var require = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector-queue")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	q, err := gitcollector.OpenPersistentQueue(
+		filepath.Join(dir, "queue.db"), QueueCodec{}, nil,
+	)
+	require.NoError(err)
+	defer q.Close()
+
+	for _, e := range []string{"ok", "fail"} {
+		require.NoError(q.Push(&Job{Type: JobDownload, Endpoints: []string{e}}))
+	}
+
+	setup := WithPersistentQueue(q)
+	jobs := q.Jobs()
+	for i := 0; i < 2; i++ {
+		job := (<-jobs).(*Job)
+		job.ProcessFn = func(_ context.Context, j *Job) error {
+			if j.Endpoints[0] == "fail" {
+				return fmt.Errorf("failed")
+			}
+
+			return nil
+		}
+
+		require.NoError(setup(job))
+		job.Process(context.Background())
+	}
+
+	// only the failed job is kept
+	n, err := q.Len()
+	require.NoError(err)
+	require.Equal(1, n)
+}
@@ -0,0 +1,602 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	gosiva "gopkg.in/src-d/go-siva.v1"
+)
+
+const (
+	// sivaFooterLen is the size of the footer closing every block of a
+	// siva file: its number of entries, index size, block size and CRC32.
+	sivaFooterLen = 24
+	// sivaEntryLen is the size of an entry of a siva index without its
+	// name: its mode, time, start, size, CRC32 and flags.
+	sivaEntryLen = 36
+	// sivaMaxName bounds the names of the entries looked for while
+	// recovering a siva file, so the data is never taken for an index.
+	sivaMaxName = 4096
+	// sivaChunk is the size of the chunks a siva file is scanned by.
+	sivaChunk = 1 << 20
+)
+
+// sivaIndexStart is the signature and version every siva index starts with.
+var sivaIndexStart = append(
+	append([]byte{}, gosiva.IndexSignature...), gosiva.IndexVersion,
+)
+
+// RebuildOpts represents configuration options for Rebuild.
+type RebuildOpts struct {
+	// Bucket is the bucketization level of the library, detected from the
+	// library if it's negative.
+	Bucket int
+	// IDMapping is the path of the IDMapping of the library, default to
+	// IDMappingFile.
+	IDMapping string
+	// DryRun reports what would be rebuilt without writing anything.
+	DryRun bool
+	// Audit records the siva files truncated, nil means none.
+	Audit *AuditLog
+}
+
+// RebuildReport is the state of the library found by Rebuild.
+type RebuildReport struct {
+	// Metadata is true if the metadata of the library was missing or
+	// unreadable and it was written again.
+	Metadata bool
+	// Checkpoints are the locations whose unusable checkpoint was removed.
+	Checkpoints []borges.LocationID
+	// Truncated are the locations whose siva file ended with a partial
+	// write, they were truncated to their last good index.
+	Truncated []borges.LocationID
+	// Unrecoverable are the locations without any good index, they're
+	// left untouched.
+	Unrecoverable []borges.LocationID
+	// Locations is the number of locations scanned for their IDs.
+	Locations int
+	// Repositories is the number of repositories scanned for their IDs.
+	Repositories int
+	// Mappings is the number of IDs missing from the IDMapping and added.
+	Mappings int
+	// Conflicts are the IDs found in the library that the IDMapping maps
+	// to something else, they're left as they are.
+	Conflicts []error
+	// Failed are the locations whose repositories couldn't be scanned.
+	Failed map[borges.LocationID]error
+}
+
+// Rebuild scans an existing library from disk and regenerates the state kept
+// beside its repositories when it was lost or corrupted: the checkpoints of
+// the siva files, the metadata of the library and the IDMapping of the
+// locations and repositories not identified by their root commit and
+// endpoint. The history, the journal and the metadata of the hosting
+// services can't be derived from the repositories, they aren't rebuilt.
+func Rebuild(
+	ctx context.Context,
+	fs billy.Filesystem,
+	opts *RebuildOpts,
+) (*RebuildReport, error) {
+	if opts == nil {
+		opts = &RebuildOpts{Bucket: -1}
+	}
+
+	bucket := opts.Bucket
+	if bucket < 0 {
+		var err error
+		if bucket, err = detectBucket(fs); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &RebuildReport{Failed: map[borges.LocationID]error{}}
+	if bucket < 0 {
+		return report, nil
+	}
+
+	if err := rebuildSivas(fs, bucket, opts, report); err != nil {
+		return nil, err
+	}
+
+	lib, err := rebuildMetadata(fs, bucket, opts, report)
+	if err != nil {
+		return nil, err
+	}
+
+	if lib == nil {
+		return report, nil
+	}
+
+	if err := rebuildIDs(ctx, fs, lib, opts, report); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// rebuildSivas checks the siva file and the checkpoint of every location.
+func rebuildSivas(
+	fs billy.Filesystem,
+	bucket int,
+	opts *RebuildOpts,
+	report *RebuildReport,
+) error {
+	paths, err := sivaFiles(fs, bucket)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		id := borges.LocationID(strings.TrimSuffix(path.Base(p), ".siva"))
+		state, err := rebuildSiva(fs, p, opts.DryRun)
+		if err != nil {
+			return err
+		}
+
+		switch state {
+		case sivaCheckpoint:
+			report.Checkpoints = append(report.Checkpoints, id)
+		case sivaTruncated:
+			report.Truncated = append(report.Truncated, id)
+			if opts.DryRun {
+				continue
+			}
+
+			err := opts.Audit.Record(
+				AuditRebuild, id, "rebuild",
+				"truncated to its last good index",
+			)
+			if err != nil {
+				return err
+			}
+		case sivaUnrecoverable:
+			report.Unrecoverable = append(report.Unrecoverable, id)
+		}
+	}
+
+	return nil
+}
+
+// sivaFiles returns the paths of the siva files of the library, the
+// directories starting with a dot hold the state of gitcollector.
+func sivaFiles(fs billy.Filesystem, bucket int) ([]string, error) {
+	dirs := []string{""}
+	if bucket > 0 {
+		files, err := fs.ReadDir("")
+		if err != nil {
+			return nil, err
+		}
+
+		dirs = dirs[:0]
+		for _, f := range files {
+			if f.IsDir() && !strings.HasPrefix(f.Name(), ".") {
+				dirs = append(dirs, f.Name())
+			}
+		}
+	}
+
+	var paths []string
+	for _, dir := range dirs {
+		files, err := fs.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			if !f.IsDir() && strings.HasSuffix(f.Name(), ".siva") {
+				paths = append(paths, path.Join(dir, f.Name()))
+			}
+		}
+	}
+
+	return paths, nil
+}
+
+type sivaState int
+
+const (
+	sivaOK sivaState = iota
+	sivaCheckpoint
+	sivaTruncated
+	sivaUnrecoverable
+)
+
+// rebuildSiva checks the index of a siva file and its checkpoint. An unusable
+// checkpoint of a good siva file is removed, a siva file ending with a partial
+// write is truncated to the offset of its checkpoint, or to its last good
+// index if the checkpoint is unusable too, as go-borges would roll it back.
+func rebuildSiva(
+	fs billy.Filesystem,
+	path string,
+	dry bool,
+) (sivaState, error) {
+	info, err := fs.Stat(path)
+	if err != nil {
+		return sivaOK, err
+	}
+
+	size := info.Size()
+	if size == 0 {
+		return sivaOK, nil
+	}
+
+	f, err := fs.Open(path)
+	if err != nil {
+		return sivaOK, err
+	}
+	defer f.Close()
+
+	cpPath := path + ".checkpoint"
+	offset, cpExists, err := readCheckpoint(fs, cpPath)
+	if err != nil {
+		return sivaOK, err
+	}
+
+	cpGood := offset > 0 && offset <= size && sivaIndexAt(f, offset)
+	if sivaIndexAt(f, size) {
+		if !cpExists || cpGood {
+			return sivaOK, nil
+		}
+
+		if dry {
+			return sivaCheckpoint, nil
+		}
+
+		return sivaCheckpoint, fs.Remove(cpPath)
+	}
+
+	if !cpGood {
+		if offset, err = lastSivaIndex(f, size); err != nil {
+			return sivaOK, err
+		}
+
+		if offset <= 0 {
+			return sivaUnrecoverable, nil
+		}
+	}
+
+	if dry {
+		return sivaTruncated, nil
+	}
+
+	w, err := fs.OpenFile(path, os.O_RDWR, 0664)
+	if err != nil {
+		return sivaOK, err
+	}
+
+	if err := w.Truncate(offset); err != nil {
+		w.Close()
+		return sivaOK, err
+	}
+
+	if err := w.Close(); err != nil {
+		return sivaOK, err
+	}
+
+	if err := fs.Remove(cpPath); err != nil && !os.IsNotExist(err) {
+		return sivaOK, err
+	}
+
+	return sivaTruncated, nil
+}
+
+// readCheckpoint returns the offset kept by a checkpoint, -1 if it can't be
+// parsed.
+func readCheckpoint(fs billy.Filesystem, path string) (int64, bool, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return -1, false, nil
+		}
+
+		return -1, false, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return -1, true, err
+	}
+
+	var offset int64
+	for _, c := range bytes.TrimSpace(data) {
+		if c < '0' || c > '9' || offset > (1<<62)/10 {
+			return -1, true, nil
+		}
+
+		offset = offset*10 + int64(c-'0')
+	}
+
+	return offset, true, nil
+}
+
+// sivaIndexAt returns whether a good index of the siva file, and of all the
+// blocks before it, ends at the given offset.
+func sivaIndexAt(r io.ReadSeeker, offset int64) bool {
+	if offset < sivaFooterLen {
+		return false
+	}
+
+	_, err := gosiva.NewReaderWithOffset(r, uint64(offset)).Index()
+	return err == nil
+}
+
+// lastSivaIndex returns the offset where the last good index of the siva
+// file ends, 0 if there's none. The signatures of the indexes are looked for
+// from the end of the file and their entries parsed until the footer of the
+// index is found.
+func lastSivaIndex(f billy.File, size int64) (int64, error) {
+	var starts []int64
+	buf := make([]byte, sivaChunk+len(sivaIndexStart)-1)
+	for pos := int64(0); pos < size; pos += sivaChunk {
+		n, err := f.ReadAt(buf, pos)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		for i := 0; ; {
+			j := bytes.Index(buf[i:n], sivaIndexStart)
+			if j < 0 {
+				break
+			}
+
+			starts = append(starts, pos+int64(i+j))
+			i += j + 1
+		}
+	}
+
+	for i := len(starts) - 1; i >= 0; i-- {
+		end := sivaIndexEnd(f, starts[i], size)
+		if end > 0 && sivaIndexAt(f, end) {
+			return end, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// sivaIndexEnd parses the entries of the index starting at the given
+// position, returning where the index ends once a footer matching the entries
+// parsed is found, 0 if it isn't an index.
+func sivaIndexEnd(r io.ReaderAt, start, size int64) int64 {
+	footer := make([]byte, sivaFooterLen)
+	pos := start + int64(len(sivaIndexStart))
+	for entries := uint32(0); pos+sivaFooterLen <= size; entries++ {
+		if _, err := r.ReadAt(footer, pos); err != nil {
+			return 0
+		}
+
+		count := binary.BigEndian.Uint32(footer)
+		indexSize := binary.BigEndian.Uint64(footer[4:])
+		if count == entries && indexSize == uint64(pos-start) {
+			return pos + sivaFooterLen
+		}
+
+		// otherwise an entry starts there, with the length of its name.
+		name := count
+		if name == 0 || name > sivaMaxName {
+			return 0
+		}
+
+		pos += 4 + int64(name) + sivaEntryLen
+	}
+
+	return 0
+}
+
+// rebuildMetadata writes the metadata of the library again if it's missing or
+// unreadable, returning the library opened with it. The library isn't
+// returned on a dry run with unreadable metadata.
+func rebuildMetadata(
+	fs billy.Filesystem,
+	bucket int,
+	opts *RebuildOpts,
+	report *RebuildReport,
+) (*siva.Library, error) {
+	open := func() (*siva.Library, error) {
+		return siva.NewLibrary("rebuild", fs, siva.LibraryOptions{
+			Bucket:        bucket,
+			Transactional: true,
+			TempFS:        memfs.New(),
+		})
+	}
+
+	lib, err := open()
+	if err == nil && lib.Version() >= 0 {
+		return lib, nil
+	}
+
+	if _, serr := fs.Stat(siva.LibraryMetadataFile); err != nil && serr != nil {
+		return nil, err
+	}
+
+	report.Metadata = true
+	if opts.DryRun {
+		return lib, nil
+	}
+
+	if err := siva.NewLibraryMetadata(LibraryVersion).Save(fs); err != nil {
+		return nil, err
+	}
+
+	return open()
+}
+
+// rebuildIDs adds to the IDMapping the IDs of the locations and repositories
+// found in the library that aren't the hash of their root commit and the
+// default ID of their endpoint.
+func rebuildIDs(
+	ctx context.Context,
+	fs billy.Filesystem,
+	lib borges.Library,
+	opts *RebuildOpts,
+	report *RebuildReport,
+) error {
+	ids, err := NewIDMapping(fs, opts.IDMapping, nil)
+	if err != nil {
+		return err
+	}
+
+	restore := func(kind, key, id string) error {
+		mapped, added, err := ids.restore(kind, key, id, opts.DryRun)
+		switch {
+		case ErrWrongID.Is(err):
+			report.Conflicts = append(report.Conflicts, err)
+		case err != nil:
+			return err
+		case mapped != id:
+			report.Conflicts = append(report.Conflicts, ErrWrongID.New(
+				kind, id, key, "mapped to "+mapped))
+		case added:
+			report.Mappings++
+		}
+
+		return nil
+	}
+
+	// the siva files without a good index can't be read, neither the
+	// ones left with a partial write on a dry run.
+	skip := map[borges.LocationID]bool{}
+	for _, id := range report.Unrecoverable {
+		skip[id] = true
+	}
+
+	if opts.DryRun {
+		for _, id := range report.Truncated {
+			skip[id] = true
+		}
+	}
+
+	iter, err := lib.Locations()
+	if err != nil {
+		return err
+	}
+
+	return iter.ForEach(func(loc borges.Location) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if skip[loc.ID()] {
+			return nil
+		}
+
+		report.Locations++
+		repos, root, err := scanLocation(loc)
+		if err != nil {
+			report.Failed[loc.ID()] = err
+			return nil
+		}
+
+		report.Repositories += len(repos)
+		if root != "" && root != string(loc.ID()) {
+			if err := restore(locationKind, root, string(loc.ID())); err != nil {
+				return err
+			}
+		}
+
+		for id, endpoint := range repos {
+			key, err := NewRepositoryID(endpoint)
+			if err != nil || key == id {
+				continue
+			}
+
+			if err := restore(repositoryKind, key.String(), id.String()); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// scanLocation returns the endpoints of the repositories of the location by
+// their ID, and the hash of the root commit of the first repository with a
+// HEAD.
+func scanLocation(
+	loc borges.Location,
+) (map[borges.RepositoryID]string, string, error) {
+	iter, err := loc.Repositories(borges.ReadOnlyMode)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var root string
+	repos := map[borges.RepositoryID]string{}
+	err = iter.ForEach(func(r borges.Repository) error {
+		defer r.Close()
+
+		remote, err := r.R().Remote(r.ID().String())
+		if err == git.ErrRemoteNotFound {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if urls := remote.Config().URLs; len(urls) > 0 {
+			repos[r.ID()] = urls[0]
+		}
+
+		if root == "" {
+			root, err = rootHash(r.R(), r.ID().String())
+		}
+
+		return err
+	})
+
+	return repos, root, err
+}
+
+// rootHash returns the hash of the root commit of the HEAD of the remote
+// following the first parents, empty if the remote has no HEAD.
+func rootHash(repo *git.Repository, remote string) (string, error) {
+	ref, err := repo.Reference(
+		plumbing.NewRemoteHEADReferenceName(remote), true,
+	)
+	if err == plumbing.ErrReferenceNotFound {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	obj, err := repo.Object(plumbing.AnyObject, ref.Hash())
+	if err != nil {
+		return "", err
+	}
+
+	if tag, ok := obj.(*object.Tag); ok {
+		if obj, err = tag.Object(); err != nil {
+			return "", err
+		}
+	}
+
+	commit, ok := obj.(*object.Commit)
+	if !ok {
+		return "", nil
+	}
+
+	for len(commit.ParentHashes) > 0 {
+		if commit, err = commit.Parent(0); err != nil {
+			return "", err
+		}
+	}
+
+	return commit.Hash.String(), nil
+}
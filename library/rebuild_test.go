@@ -0,0 +1,203 @@
+package library
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func TestRebuild(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	lib, err := siva.NewLibrary("test", fs, siva.LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+		TempFS:        memfs.New(),
+	})
+	require.NoError(err)
+
+	// a location stored with the IDs of an IDProvider
+	loc, err := lib.AddLocation("loc-1")
+	require.NoError(err)
+	r, err := loc.Init("uuid-1")
+	require.NoError(err)
+
+	cfg, err := r.R().Config()
+	require.NoError(err)
+	cfg.Remotes["uuid-1"].URLs = []string{"https://github.com/src-d/foo"}
+	require.NoError(r.R().Storer.SetConfig(cfg))
+
+	sig := object.Signature{Name: "test", When: time.Unix(0, 0)}
+	obj := r.R().Storer.NewEncodedObject()
+	require.NoError((&object.Commit{
+		Author:    sig,
+		Committer: sig,
+		Message:   "root",
+		TreeHash:  plumbing.ZeroHash,
+	}).Encode(obj))
+	root, err := r.R().Storer.SetEncodedObject(obj)
+	require.NoError(err)
+	require.NoError(r.R().Storer.SetReference(plumbing.NewHashReference(
+		plumbing.NewRemoteHEADReferenceName("uuid-1"), root,
+	)))
+	require.NoError(r.Commit())
+
+	// two blocks of a location identified by the default IDs
+	for _, id := range []borges.RepositoryID{
+		"github.com/src-d/bar", "github.com/src-d/baz",
+	} {
+		loc, err := lib.AddLocation("bar")
+		if siva.ErrLocationExists.Is(err) {
+			loc, err = lib.Location("bar")
+		}
+		require.NoError(err)
+
+		r, err := loc.Init(id)
+		require.NoError(err)
+		require.NoError(r.Commit())
+	}
+
+	loc, err = lib.AddLocation("baz")
+	require.NoError(err)
+	r, err = loc.Init("github.com/src-d/baz")
+	require.NoError(err)
+	require.NoError(r.Commit())
+
+	barSize := size(t, fs, "ba/bar.siva")
+	appendFile(t, fs, "ba/bar.siva", "a partial write")
+	require.NoError(util.WriteFile(fs, "ba/baz.siva.checkpoint", []byte("x"), 0644))
+	require.NoError(util.WriteFile(fs, "qu/qux.siva", []byte("no index"), 0644))
+	require.NoError(util.WriteFile(fs, siva.LibraryMetadataFile, []byte("{"), 0644))
+
+	report, err := Rebuild(context.Background(), fs, &RebuildOpts{
+		Bucket: -1,
+		DryRun: true,
+	})
+	require.NoError(err)
+	require.True(report.Metadata)
+	require.Equal([]borges.LocationID{"bar"}, report.Truncated)
+	require.Equal([]borges.LocationID{"baz"}, report.Checkpoints)
+	require.Equal([]borges.LocationID{"qux"}, report.Unrecoverable)
+	require.Zero(report.Locations)
+	require.Equal(barSize+int64(len("a partial write")), size(t, fs, "ba/bar.siva"))
+	require.True(exists(fs, "ba/baz.siva.checkpoint"))
+
+	audit := NewAuditLog(fs, "", "alice")
+	report, err = Rebuild(context.Background(), fs, &RebuildOpts{
+		Bucket: 2,
+		Audit:  audit,
+	})
+	require.NoError(err)
+	require.True(report.Metadata)
+	require.Equal([]borges.LocationID{"bar"}, report.Truncated)
+	require.Equal([]borges.LocationID{"baz"}, report.Checkpoints)
+	require.Equal([]borges.LocationID{"qux"}, report.Unrecoverable)
+	require.Equal(barSize, size(t, fs, "ba/bar.siva"))
+	require.False(exists(fs, "ba/baz.siva.checkpoint"))
+
+	require.Equal(3, report.Locations)
+	require.Equal(4, report.Repositories)
+	require.Equal(2, report.Mappings)
+	require.Empty(report.Conflicts)
+	require.Empty(report.Failed)
+
+	entries, err := audit.Entries(nil)
+	require.NoError(err)
+	require.Len(entries, 1)
+	require.Equal(AuditRebuild, entries[0].Action)
+	require.EqualValues("bar", entries[0].LocationID)
+
+	ids, err := NewIDMapping(fs, "", nil)
+	require.NoError(err)
+	locID, err := ids.LocationID(root.String())
+	require.NoError(err)
+	require.EqualValues("loc-1", locID)
+	repoID, err := ids.RepositoryID("https://github.com/src-d/foo")
+	require.NoError(err)
+	require.EqualValues("uuid-1", repoID)
+
+	lib, err = siva.NewLibrary("test", fs, siva.LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+		TempFS:        memfs.New(),
+	})
+	require.NoError(err)
+	require.Equal(LibraryVersion, lib.Version())
+	for _, id := range []borges.RepositoryID{
+		"uuid-1", "github.com/src-d/bar", "github.com/src-d/baz",
+	} {
+		ok, _, _, err := lib.Has(id)
+		require.NoError(err)
+		require.True(ok, id.String())
+	}
+
+	// a rebuilt library is left as it is
+	report, err = Rebuild(context.Background(), fs, nil)
+	require.NoError(err)
+	require.False(report.Metadata)
+	require.Empty(report.Truncated)
+	require.Empty(report.Checkpoints)
+	require.Zero(report.Mappings)
+	require.Empty(report.Conflicts)
+
+	// the mappings aren't replaced by the IDs found in the library
+	require.NoError(fs.Remove(IDMappingFile))
+	ids, err = NewIDMapping(fs, "", UUIDProvider{})
+	require.NoError(err)
+	_, err = ids.RepositoryID("https://github.com/src-d/foo")
+	require.NoError(err)
+
+	report, err = Rebuild(context.Background(), fs, nil)
+	require.NoError(err)
+	require.Equal(1, report.Mappings)
+	require.Len(report.Conflicts, 1)
+	require.True(ErrWrongID.Is(report.Conflicts[0]))
+}
+
+func TestLastSivaIndex(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	require.NoError(util.WriteFile(fs, "foo.siva", nil, 0644))
+	f, err := fs.Open("foo.siva")
+	require.NoError(err)
+	offset, err := lastSivaIndex(f, 0)
+	require.NoError(err)
+	require.Zero(offset)
+	require.NoError(f.Close())
+
+	// the data looking like an index isn't taken for one
+	data := append(append([]byte{}, sivaIndexStart...), make([]byte, 64)...)
+	require.NoError(util.WriteFile(fs, "foo.siva", data, 0644))
+	f, err = fs.Open("foo.siva")
+	require.NoError(err)
+	defer f.Close()
+	offset, err = lastSivaIndex(f, int64(len(data)))
+	require.NoError(err)
+	require.Zero(offset)
+}
+
+func size(t *testing.T, fs billy.Filesystem, path string) int64 {
+	info, err := fs.Stat(path)
+	require.NoError(t, err)
+	return info.Size()
+}
+
+func appendFile(t *testing.T, fs billy.Filesystem, path, data string) {
+	f, err := fs.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
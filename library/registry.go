@@ -0,0 +1,284 @@
+package library
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+var (
+	// ErrJobTypeExists is returned when a Job type is registered twice.
+	ErrJobTypeExists = errors.NewKind("job type %q already registered")
+
+	// ErrJobTypeNotFound is returned when a Job type isn't registered.
+	ErrJobTypeNotFound = errors.NewKind("job type %d not registered")
+
+	// ErrJobTypesExhausted is returned when there are no Job types left to
+	// be registered.
+	ErrJobTypesExhausted = errors.NewKind("no job types left")
+)
+
+// JobTypeOpts represents the configuration of a registered Job type.
+type JobTypeOpts struct {
+	// Name identifies the Job type.
+	Name string
+	// Queue is where the Jobs of this type are enqueued.
+	Queue chan gitcollector.Job
+	// ProcessFn processes the Jobs of this type.
+	ProcessFn JobFn
+	// Setup configures the Jobs of this type before they're scheduled.
+	Setup []JobSetupFn
+}
+
+// JobRegistry keeps the Job types an application can schedule, each of them
+// with its own queue and process function. The built-in types JobDownload and
+// JobUpdate can be registered with Add, the custom ones with Register.
+type JobRegistry struct {
+	mu    sync.RWMutex
+	types map[JobType]*JobTypeOpts
+	order []JobType
+	next  JobType
+}
+
+// NewJobRegistry builds a new JobRegistry.
+func NewJobRegistry() *JobRegistry {
+	return &JobRegistry{
+		types: map[JobType]*JobTypeOpts{},
+		next:  JobUpdate << 1,
+	}
+}
+
+// Add registers the given Job type. The types registered first have priority
+// when scheduling.
+func (r *JobRegistry) Add(t JobType, opts *JobTypeOpts) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.add(t, opts)
+}
+
+func (r *JobRegistry) add(t JobType, opts *JobTypeOpts) error {
+	if _, ok := r.types[t]; ok {
+		return ErrJobTypeExists.New(opts.Name)
+	}
+
+	for _, o := range r.types {
+		if o.Name == opts.Name {
+			return ErrJobTypeExists.New(opts.Name)
+		}
+	}
+
+	r.types[t] = opts
+	r.order = append(r.order, t)
+	return nil
+}
+
+// Register registers a new custom Job type returning the JobType assigned.
+func (r *JobRegistry) Register(opts *JobTypeOpts) (JobType, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for {
+		if r.next == 0 {
+			return 0, ErrJobTypesExhausted.New()
+		}
+
+		t := r.next
+		r.next++
+		if _, ok := r.types[t]; ok {
+			continue
+		}
+
+		if err := r.add(t, opts); err != nil {
+			return 0, err
+		}
+
+		return t, nil
+	}
+}
+
+// Type returns the configuration of the given Job type.
+func (r *JobRegistry) Type(t JobType) (*JobTypeOpts, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	opts, ok := r.types[t]
+	return opts, ok
+}
+
+// Name returns the name of the given Job type, empty if it isn't registered.
+func (r *JobRegistry) Name(t JobType) string {
+	opts, ok := r.Type(t)
+	if !ok {
+		return ""
+	}
+
+	return opts.Name
+}
+
+// Enqueue sends the Job to the queue of its type.
+func (r *JobRegistry) Enqueue(ctx context.Context, job *Job) error {
+	opts, ok := r.Type(job.Type)
+	if !ok {
+		return ErrJobTypeNotFound.New(job.Type)
+	}
+
+	select {
+	case opts.Queue <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *JobRegistry) queues() ([]JobType, []*JobTypeOpts) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]JobType, len(r.order))
+	opts := make([]*JobTypeOpts, len(r.order))
+	for i, t := range r.order {
+		types[i] = t
+		opts[i] = r.types[t]
+	}
+
+	return types, opts
+}
+
+// NewRegistryJobScheduleFn builds a new gitcollector.JobScheduleFn that
+// schedules the Jobs of all the types in the registry. When several queues
+// have Jobs waiting, the types registered first are scheduled first.
+func NewRegistryJobScheduleFn(
+	lib borges.Library,
+	registry *JobRegistry,
+	authTokens map[string]string,
+	jobLogger log.Logger,
+	temp billy.Filesystem,
+) gitcollector.JobScheduleFn {
+	closed := map[JobType]bool{}
+	return func(ctx context.Context) (gitcollector.Job, error) {
+		var (
+			t       JobType
+			j       gitcollector.Job
+			ok      bool
+			pending int
+		)
+
+		types, opts := registry.queues()
+		for i, o := range opts {
+			if closed[types[i]] {
+				continue
+			}
+
+			pending++
+			select {
+			case j, ok = <-o.Queue:
+				if !ok {
+					closed[types[i]] = true
+					pending--
+					continue
+				}
+
+				t = types[i]
+			default:
+				continue
+			}
+
+			break
+		}
+
+		if j == nil {
+			if pending == 0 {
+				return nil, gitcollector.ErrJobSource.New()
+			}
+
+			var err error
+			t, j, err = waitJob(ctx, types, opts, closed)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		job, ok := j.(*Job)
+		if !ok {
+			return nil, errWrongJob.New()
+		}
+
+		if err := assignID(job); err != nil {
+			return nil, err
+		}
+
+		if job.Type == 0 {
+			job.Type = t
+		}
+
+		if job.Lib == nil {
+			job.Lib = lib
+		}
+
+		if job.TempFS == nil {
+			job.TempFS = temp
+		}
+
+		o, _ := registry.Type(job.Type)
+		if o == nil {
+			return nil, ErrJobTypeNotFound.New(job.Type)
+		}
+
+		if job.ProcessFn == nil {
+			job.ProcessFn = o.ProcessFn
+		}
+
+		job.AuthToken = getAuthTokenByOrg(authTokens)
+		job.Logger = jobLogger
+		for _, setup := range o.Setup {
+			if err := setup(job); err != nil {
+				return nil, err
+			}
+		}
+
+		return job, nil
+	}
+}
+
+func waitJob(
+	ctx context.Context,
+	types []JobType,
+	opts []*JobTypeOpts,
+	closed map[JobType]bool,
+) (JobType, gitcollector.Job, error) {
+	cases := []reflect.SelectCase{{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(ctx.Done()),
+	}}
+
+	var open []JobType
+	for i, o := range opts {
+		if closed[types[i]] {
+			continue
+		}
+
+		open = append(open, types[i])
+		cases = append(cases, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(o.Queue),
+		})
+	}
+
+	chosen, v, ok := reflect.Select(cases)
+	if chosen == 0 {
+		return 0, nil, gitcollector.ErrNewJobsNotFound.New()
+	}
+
+	t := open[chosen-1]
+	if !ok {
+		closed[t] = true
+		return 0, nil, gitcollector.ErrNewJobsNotFound.New()
+	}
+
+	return t, v.Interface().(gitcollector.Job), nil
+}
@@ -0,0 +1,92 @@
+package library
+
+import (
+	"context"
+	"testing"
+
+	"github.com/src-d/gitcollector"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobRegistry(t *testing.T) {
+	var require = require.New(t)
+
+	var (
+		download = make(chan gitcollector.Job, 10)
+		analyze  = make(chan gitcollector.Job, 10)
+		export   = make(chan gitcollector.Job, 10)
+		done     []string
+	)
+
+	processFn := func(name string) JobFn {
+		return func(_ context.Context, j *Job) error {
+			done = append(done, name)
+			return nil
+		}
+	}
+
+	registry := NewJobRegistry()
+	require.NoError(registry.Add(JobDownload, &JobTypeOpts{
+		Name:      "download",
+		Queue:     download,
+		ProcessFn: processFn("download"),
+	}))
+
+	analyzeType, err := registry.Register(&JobTypeOpts{
+		Name:      "analyze",
+		Queue:     analyze,
+		ProcessFn: processFn("analyze"),
+		Setup: []JobSetupFn{func(j *Job) error {
+			j.AllowUpdate = true
+			return nil
+		}},
+	})
+	require.NoError(err)
+	require.NotEqual(JobType(JobDownload), analyzeType)
+	require.NotEqual(JobType(JobUpdate), analyzeType)
+
+	exportType, err := registry.Register(&JobTypeOpts{
+		Name:      "export",
+		Queue:     export,
+		ProcessFn: processFn("export"),
+	})
+	require.NoError(err)
+	require.NotEqual(analyzeType, exportType)
+	require.Equal("export", registry.Name(exportType))
+
+	_, err = registry.Register(&JobTypeOpts{Name: "export"})
+	require.True(ErrJobTypeExists.Is(err))
+
+	ctx := context.Background()
+	require.True(ErrJobTypeNotFound.Is(
+		registry.Enqueue(ctx, &Job{Type: JobUpdate}),
+	))
+
+	require.NoError(registry.Enqueue(ctx, &Job{Type: exportType}))
+	require.NoError(registry.Enqueue(ctx, &Job{Type: analyzeType}))
+	require.NoError(registry.Enqueue(ctx, &Job{Type: JobDownload}))
+
+	schedule := NewRegistryJobScheduleFn(nil, registry, nil, nil, nil)
+	for i := 0; i < 3; i++ {
+		j, err := schedule(ctx)
+		require.NoError(err)
+		require.NoError(j.Process(ctx))
+
+		job := j.(*Job)
+		require.NotEmpty(job.ID)
+		require.Equal(job.Type == analyzeType, job.AllowUpdate)
+	}
+
+	require.Equal([]string{"download", "analyze", "export"}, done)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = schedule(cctx)
+	require.True(gitcollector.ErrNewJobsNotFound.Is(err))
+
+	close(download)
+	close(analyze)
+	close(export)
+	_, err = schedule(ctx)
+	require.True(gitcollector.ErrJobSource.Is(err))
+}
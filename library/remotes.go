@@ -0,0 +1,56 @@
+package library
+
+import (
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrUnknownRemotesPolicy is returned when a RemotesPolicy isn't
+	// supported.
+	ErrUnknownRemotesPolicy = errors.NewKind("unknown remotes policy %q")
+
+	// ErrLocationRemotes is returned when a repository isn't added to an
+	// existing location because it already holds the remotes of other
+	// endpoints and the RemotesPolicy is RemotesFail.
+	ErrLocationRemotes = errors.NewKind(
+		"location %s already holds other remotes: %s")
+)
+
+// RemotesPolicy is the way a download is stored when its location already
+// exists with the remotes of other endpoints, like the forks found by another
+// discovery source.
+type RemotesPolicy string
+
+const (
+	// RemotesAdd adds the remote of the download to the ones of the
+	// location and fetches it, the default.
+	RemotesAdd RemotesPolicy = "add"
+	// RemotesReplace removes the other remotes of the location before
+	// fetching the one of the download, so the location only keeps the
+	// last repository found for it.
+	RemotesReplace RemotesPolicy = "replace"
+	// RemotesFail fails the download with ErrLocationRemotes, leaving the
+	// location untouched.
+	RemotesFail RemotesPolicy = "fail"
+)
+
+// ParseRemotesPolicy returns the RemotesPolicy of the given name, RemotesAdd
+// if it's empty.
+func ParseRemotesPolicy(name string) (RemotesPolicy, error) {
+	switch p := RemotesPolicy(name); p {
+	case "":
+		return RemotesAdd, nil
+	case RemotesAdd, RemotesReplace, RemotesFail:
+		return p, nil
+	default:
+		return "", ErrUnknownRemotesPolicy.New(name)
+	}
+}
+
+// WithRemotesPolicy is a JobSetupFn setting the RemotesPolicy of the Job.
+func WithRemotesPolicy(p RemotesPolicy) JobSetupFn {
+	return func(job *Job) error {
+		job.Remotes = p
+		return nil
+	}
+}
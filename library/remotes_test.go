@@ -0,0 +1,32 @@
+package library
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRemotesPolicy(t *testing.T) {
+	var require = require.New(t)
+
+	p, err := ParseRemotesPolicy("")
+	require.NoError(err)
+	require.Equal(RemotesAdd, p)
+
+	for _, name := range []string{"add", "replace", "fail"} {
+		p, err := ParseRemotesPolicy(name)
+		require.NoError(err)
+		require.Equal(RemotesPolicy(name), p)
+	}
+
+	_, err = ParseRemotesPolicy("merge")
+	require.True(ErrUnknownRemotesPolicy.Is(err))
+}
+
+func TestWithRemotesPolicy(t *testing.T) {
+	var require = require.New(t)
+
+	job := &Job{}
+	require.NoError(WithRemotesPolicy(RemotesReplace)(job))
+	require.Equal(RemotesReplace, job.Remotes)
+}
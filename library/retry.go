@@ -0,0 +1,24 @@
+package library
+
+import "github.com/src-d/gitcollector"
+
+// RetryPolicies holds the gitcollector.RetryPolicy of every JobType, so the
+// downloads, that clone the repositories from scratch, and the updates can be
+// retried differently.
+type RetryPolicies map[JobType]*gitcollector.RetryPolicy
+
+// WithRetryPolicies is a JobSetupFn setting the RetryPolicy of the type of
+// the Jobs, overriding the one of the gitcollector.WorkerPool. The Jobs
+// already carrying a RetryPolicy keep it.
+func WithRetryPolicies(policies RetryPolicies) JobSetupFn {
+	return func(job *Job) error {
+		retry, ok := policies[job.Type]
+		if !ok || job.Policies != nil && job.Policies.Retry != nil {
+			return nil
+		}
+
+		job.Policies = (&gitcollector.Policies{Retry: retry}).
+			Merge(job.Policies)
+		return nil
+	}
+}
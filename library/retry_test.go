@@ -0,0 +1,41 @@
+package library
+
+import (
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRetryPolicies(t *testing.T) {
+	var require = require.New(t)
+
+	download := &gitcollector.RetryPolicy{Attempts: 5}
+	setup := WithRetryPolicies(RetryPolicies{JobDownload: download})
+
+	timeout := &gitcollector.TimeoutPolicy{Timeout: time.Minute}
+	job := &Job{
+		Type:     JobDownload,
+		Policies: &gitcollector.Policies{Timeout: timeout},
+	}
+
+	require.NoError(setup(job))
+	require.True(job.Policies.Retry == download)
+	require.True(job.Policies.Timeout == timeout)
+
+	// the jobs keep their own retry policy
+	own := &gitcollector.RetryPolicy{Attempts: 1}
+	job = &Job{
+		Type:     JobDownload,
+		Policies: &gitcollector.Policies{Retry: own},
+	}
+
+	require.NoError(setup(job))
+	require.True(job.Policies.Retry == own)
+
+	// the types without a policy get the one of the worker pool
+	job = &Job{Type: JobUpdate}
+	require.NoError(setup(job))
+	require.Nil(job.Policies)
+}
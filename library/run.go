@@ -0,0 +1,159 @@
+package library
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/src-d/gitcollector"
+
+	"github.com/google/uuid"
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+// RunsFile is the default name of the file where the runs are recorded.
+const RunsFile = "gitcollector.runs"
+
+// Run holds the metadata of a gitcollector execution writing into a library,
+// so it can be known later how and when the data was collected.
+type Run struct {
+	ID string `json:"id"`
+	// Version is the version of the collector.
+	Version string `json:"version"`
+	// ConfigHash is the SHA-256 of the configuration used.
+	ConfigHash string `json:"config_hash"`
+	// Providers are the sources of the collected repositories.
+	Providers []string `json:"providers,omitempty"`
+	// Features are the experimental Features enabled in the Run, so the
+	// Runs with and without them can be compared.
+	Features []string   `json:"features,omitempty"`
+	Start    time.Time  `json:"start"`
+	End      *time.Time `json:"end,omitempty"`
+	// APIRequests are the API requests made by every provider, they're
+	// recorded when the Run finishes.
+	APIRequests []gitcollector.APIRequests `json:"api_requests,omitempty"`
+
+	mu   sync.Mutex
+	fs   billy.Filesystem
+	path string
+}
+
+// ConfigHash returns the SHA-256 of the JSON representation of the given
+// configuration.
+func ConfigHash(config interface{}) (string, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// StartRun records a new Run in the given path of the library filesystem
+// with the Features enabled.
+func StartRun(
+	fs billy.Filesystem,
+	path, version, configHash string,
+	features Features,
+	providers ...string,
+) (*Run, error) {
+	if path == "" {
+		path = RunsFile
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	run := &Run{
+		ID:         id.String(),
+		Version:    version,
+		ConfigHash: configHash,
+		Providers:  providers,
+		Features:   features.List(),
+		Start:      time.Now().UTC(),
+		fs:         fs,
+		path:       path,
+	}
+
+	return run, run.write()
+}
+
+// Finish records the end of the Run.
+func (r *Run) Finish() error {
+	end := time.Now().UTC()
+	r.End = &end
+	return r.write()
+}
+
+func (r *Run) write() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	f, err := r.fs.OpenFile(
+		r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644,
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Runs returns the Runs recorded in the given path of the filesystem, the
+// oldest first. Runs without End didn't finish or are still running.
+func Runs(fs billy.Filesystem, path string) ([]*Run, error) {
+	if path == "" {
+		path = RunsFile
+	}
+
+	f, err := fs.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		runs []*Run
+		byID = map[string]*Run{}
+	)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		run := &Run{}
+		if err := json.Unmarshal(scanner.Bytes(), run); err != nil {
+			return nil, err
+		}
+
+		if prev, ok := byID[run.ID]; ok {
+			prev.End = run.End
+			prev.APIRequests = run.APIRequests
+			continue
+		}
+
+		byID[run.ID] = run
+		runs = append(runs, run)
+	}
+
+	return runs, scanner.Err()
+}
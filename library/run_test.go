@@ -0,0 +1,54 @@
+package library
+
+import (
+	"testing"
+
+	"github.com/src-d/gitcollector"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestRuns(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	runs, err := Runs(fs, "")
+	require.NoError(err)
+	require.Empty(runs)
+
+	hash, err := ConfigHash(map[string]string{"orgs": "src-d"})
+	require.NoError(err)
+	require.Len(hash, 64)
+
+	other, err := ConfigHash(map[string]string{"orgs": "bblfsh"})
+	require.NoError(err)
+	require.NotEqual(hash, other)
+
+	features := Features{FeatureSizeScheduler: true, FeaturePartialClone: true}
+	first, err := StartRun(fs, "", "v1.0.0", hash, features, "github:src-d")
+	require.NoError(err)
+	second, err := StartRun(fs, "", "v1.1.0", other, nil)
+	require.NoError(err)
+	first.APIRequests = []gitcollector.APIRequests{
+		{Provider: "github:src-d", Category: "repos", Requests: 3},
+	}
+	require.NoError(first.Finish())
+
+	runs, err = Runs(fs, "")
+	require.NoError(err)
+	require.Len(runs, 2)
+
+	require.Equal(first.ID, runs[0].ID)
+	require.Equal("v1.0.0", runs[0].Version)
+	require.Equal(hash, runs[0].ConfigHash)
+	require.Equal([]string{"github:src-d"}, runs[0].Providers)
+	require.Equal([]string{"partial-clone", "size-scheduler"}, runs[0].Features)
+	require.NotNil(runs[0].End)
+	require.False(runs[0].End.Before(runs[0].Start))
+	require.Equal(first.APIRequests, runs[0].APIRequests)
+
+	require.Equal(second.ID, runs[1].ID)
+	require.Nil(runs[1].End)
+	require.Empty(runs[1].Features)
+}
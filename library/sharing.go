@@ -0,0 +1,509 @@
+package library
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+var (
+	// ErrObjectSharing is returned when the objects of a location can't
+	// be shared through its ObjectPool.
+	ErrObjectSharing = errors.NewKind("unable to share the objects of %s")
+
+	// ErrObjectPoolRequired is returned when a location keeping its
+	// objects in an ObjectPool is written without the ObjectSharing.
+	ErrObjectPoolRequired = errors.NewKind(
+		"location %s keeps its objects in the pool %s, " +
+			"it requires the object sharing")
+)
+
+const (
+	// ObjectPoolsDir is the directory of the library where the
+	// ObjectPools are kept.
+	ObjectPoolsDir = "gitcollector.objects"
+	// ObjectPoolLink is the file of the repository of a location naming
+	// the ObjectPool its objects are kept in.
+	ObjectPoolLink = "gitcollector.pool"
+
+	poolRefsPrefix = "refs/pool/"
+	poolPacksDir   = "objects/pack"
+	poolPackWindow = 10
+)
+
+// LocationKey returns the key the location of the repository with the given
+// ID and root commit is identified by: the hash of the root commit, or the
+// hash of the repository ID if the Job stores every repository in a location
+// of its own.
+func (j *Job) LocationKey(id borges.RepositoryID, root string) string {
+	if !j.NonRooted {
+		return root
+	}
+
+	sum := sha1.Sum([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// WithNonRooted is a JobSetupFn storing every repository in a location of its
+// own instead of in the location of its root commit along with its forks. The
+// objects are kept in the pools of the given ObjectSharing, if it isn't nil.
+func WithNonRooted(sharing *ObjectSharing) JobSetupFn {
+	return func(job *Job) error {
+		job.NonRooted = true
+		job.Sharing = sharing
+		return nil
+	}
+}
+
+// ObjectSharing keeps the objects of the repositories stored in locations of
+// their own in an ObjectPool by root commit, so the objects shared by the
+// forks are stored once. The locations only keep their references and the
+// objects fetched by their updates that weren't in the pool.
+type ObjectSharing struct {
+	fs     billy.Filesystem
+	bucket int
+}
+
+// NewObjectSharing builds an ObjectSharing keeping the ObjectPools in the
+// ObjectPoolsDir of the library in the given filesystem, bucketized like its
+// siva files.
+func NewObjectSharing(fs billy.Filesystem, bucket int) *ObjectSharing {
+	return &ObjectSharing{fs: fs, bucket: bucket}
+}
+
+// Pool returns the ObjectPool of the repositories with the given root commit,
+// nil if the ObjectSharing is nil.
+func (s *ObjectSharing) Pool(root string) (*ObjectPool, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	dir := path.Join(ObjectPoolsDir, sivaPath(borges.LocationID(root), s.bucket))
+	fs, err := s.fs.Chroot(dir)
+	if err != nil {
+		return nil, ErrObjectSharing.Wrap(err, root)
+	}
+
+	return &ObjectPool{
+		root: root,
+		fs:   fs,
+		sto:  filesystem.NewStorage(fs, cache.NewObjectLRUDefault()),
+	}, nil
+}
+
+// Linked returns the ObjectPool the objects of the given repository are kept
+// in, nil if the location keeps its own objects. It fails if the location
+// uses a pool and the ObjectSharing is nil, so its objects aren't written
+// apart from the rest.
+func (s *ObjectSharing) Linked(r borges.Repository) (*ObjectPool, error) {
+	root, err := readPoolLink(r.FS())
+	if err != nil {
+		return nil, ErrObjectSharing.Wrap(err, r.LocationID())
+	}
+
+	if root == "" {
+		return nil, nil
+	}
+
+	if s == nil {
+		return nil, ErrObjectPoolRequired.New(r.LocationID(), root)
+	}
+
+	return s.Pool(root)
+}
+
+func readPoolLink(fs billy.Filesystem) (string, error) {
+	f, err := fs.Open(ObjectPoolLink)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// ObjectPool is a content-addressed store of the objects of the repositories
+// with the same root commit, written by several Jobs at the same time. Every
+// write is a new packfile renamed into place once complete. The references
+// of the linked locations are kept in the refs/pool namespace, so the fetches
+// advertise the objects of the forks as already stored.
+type ObjectPool struct {
+	root string
+	fs   billy.Filesystem
+	sto  *filesystem.Storage
+}
+
+// Root returns the root commit of the repositories of the ObjectPool.
+func (p *ObjectPool) Root() string {
+	return p.root
+}
+
+// Add stores the objects of the repository in the given filesystem missing in
+// the ObjectPool. The packfiles of the repository are copied as they are into
+// an empty ObjectPool.
+func (p *ObjectPool) Add(repoFS billy.Filesystem) error {
+	packs, err := p.fs.ReadDir(poolPacksDir)
+	if err != nil && !os.IsNotExist(err) {
+		return ErrObjectSharing.Wrap(err, p.root)
+	}
+
+	if len(packs) == 0 {
+		err = p.copyPacks(repoFS)
+	} else {
+		err = p.addMissing(
+			filesystem.NewStorage(repoFS, cache.NewObjectLRUDefault()),
+		)
+	}
+
+	if err != nil {
+		return ErrObjectSharing.Wrap(err, p.root)
+	}
+
+	return nil
+}
+
+// copyPacks copies the packfiles of the repository into the ObjectPool, the
+// indexes first so no packfile is found without its index. The loose objects
+// of the repository, if any, are added apart.
+func (p *ObjectPool) copyPacks(repoFS billy.Filesystem) error {
+	files, err := repoFS.ReadDir(poolPacksDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := p.fs.MkdirAll(poolPacksDir, 0755); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".pack") {
+			continue
+		}
+
+		pack := path.Join(poolPacksDir, strings.TrimSuffix(f.Name(), ".pack"))
+		for _, ext := range []string{".idx", ".pack"} {
+			err := copyFile(repoFS, pack+ext, p.fs, pack+ext)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	loose, err := hasLooseObjects(repoFS)
+	if err != nil || !loose {
+		return err
+	}
+
+	return p.addMissing(
+		filesystem.NewStorage(repoFS, cache.NewObjectLRUDefault()),
+	)
+}
+
+// hasLooseObjects tells whether the repository has objects out of its
+// packfiles, in the directories of the objects named by their first byte.
+func hasLooseObjects(repoFS billy.Filesystem) (bool, error) {
+	dirs, err := repoFS.ReadDir("objects")
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+
+		if _, err := hex.DecodeString(dir.Name()); err != nil {
+			continue
+		}
+
+		files, err := repoFS.ReadDir(path.Join("objects", dir.Name()))
+		if err != nil {
+			return false, err
+		}
+
+		if len(files) > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// addMissing writes the objects of the storage missing in the ObjectPool as a
+// new packfile.
+func (p *ObjectPool) addMissing(src *filesystem.Storage) error {
+	iter, err := src.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return err
+	}
+
+	var missing []plumbing.Hash
+	err = iter.ForEach(func(obj plumbing.EncodedObject) error {
+		err := p.sto.HasEncodedObject(obj.Hash())
+		if err == plumbing.ErrObjectNotFound {
+			missing = append(missing, obj.Hash())
+			return nil
+		}
+
+		return err
+	})
+	if err != nil || len(missing) == 0 {
+		return err
+	}
+
+	w, err := p.sto.PackfileWriter()
+	if err != nil {
+		return err
+	}
+
+	_, err = packfile.NewEncoder(w, src, false).Encode(missing, poolPackWindow)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// copyFile copies a file between filesystems writing it aside and renaming
+// it, so it's never found incomplete.
+func copyFile(
+	srcFS billy.Filesystem, src string,
+	dstFS billy.Filesystem, dst string,
+) error {
+	in, err := srcFS.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := util.TempFile(dstFS, path.Dir(dst), ".tmp_")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tmp, in)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = dstFS.Rename(tmp.Name(), dst)
+	}
+
+	if err != nil {
+		dstFS.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+// Link records in the given repository of a location that its objects are
+// kept in the ObjectPool, and keeps its references in the pool to be
+// advertised by the next fetches of the other locations.
+func (p *ObjectPool) Link(r borges.Repository) error {
+	if err := util.WriteFile(
+		r.FS(), ObjectPoolLink, []byte(p.root+"\n"), 0644,
+	); err != nil {
+		return ErrObjectSharing.Wrap(err, r.LocationID())
+	}
+
+	if err := p.keepRefs(r); err != nil {
+		return ErrObjectSharing.Wrap(err, r.LocationID())
+	}
+
+	return nil
+}
+
+// keepRefs mirrors the references of the repository in its namespace of the
+// refs/pool references of the ObjectPool.
+func (p *ObjectPool) keepRefs(r borges.Repository) error {
+	prefix := poolRefsPrefix + string(r.LocationID()) + "/"
+	refs, err := r.R().Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	kept := make(map[plumbing.ReferenceName]bool)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		name := plumbing.ReferenceName(prefix + ref.Name().String())
+		kept[name] = true
+		return p.sto.SetReference(
+			plumbing.NewHashReference(name, ref.Hash()),
+		)
+	})
+	if err != nil {
+		return err
+	}
+
+	old, err := p.sto.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	return old.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name()
+		if !strings.HasPrefix(name.String(), prefix) || kept[name] {
+			return nil
+		}
+
+		return p.sto.RemoveReference(name)
+	})
+}
+
+// Storer wraps the given storage of a location reading the objects missing in
+// it from the ObjectPool and writing the new ones into the pool. It's
+// returned as is if the ObjectPool is nil.
+func (p *ObjectPool) Storer(s storage.Storer) storage.Storer {
+	if p == nil {
+		return s
+	}
+
+	return &pooledStorer{Storer: s, pool: p.sto}
+}
+
+// FetchStorer is like Storer, listing the references of the other locations
+// kept in the ObjectPool along with the ones of the location, so the fetches
+// into it advertise their objects as already stored.
+func (p *ObjectPool) FetchStorer(s storage.Storer) storage.Storer {
+	if p == nil {
+		return s
+	}
+
+	return &pooledStorer{Storer: s, pool: p.sto, refs: true}
+}
+
+// Open returns the git repository of the given repository of a location
+// reading its objects from the ObjectPool. It's the repository of the
+// location if the ObjectPool is nil.
+func (p *ObjectPool) Open(r borges.Repository) (*git.Repository, error) {
+	if p == nil {
+		return r.R(), nil
+	}
+
+	return git.Open(p.Storer(r.R().Storer), nil)
+}
+
+type pooledStorer struct {
+	storage.Storer
+	pool *filesystem.Storage
+	refs bool
+}
+
+var _ storer.PackfileWriter = (*pooledStorer)(nil)
+
+// PackfileWriter implements the storer.PackfileWriter interface writing the
+// packfile into the ObjectPool.
+func (s *pooledStorer) PackfileWriter() (io.WriteCloser, error) {
+	return s.pool.PackfileWriter()
+}
+
+func (s *pooledStorer) SetEncodedObject(
+	obj plumbing.EncodedObject,
+) (plumbing.Hash, error) {
+	return s.pool.SetEncodedObject(obj)
+}
+
+func (s *pooledStorer) EncodedObject(
+	t plumbing.ObjectType,
+	h plumbing.Hash,
+) (plumbing.EncodedObject, error) {
+	obj, err := s.Storer.EncodedObject(t, h)
+	if err == plumbing.ErrObjectNotFound {
+		return s.pool.EncodedObject(t, h)
+	}
+
+	return obj, err
+}
+
+func (s *pooledStorer) HasEncodedObject(h plumbing.Hash) error {
+	err := s.Storer.HasEncodedObject(h)
+	if err == plumbing.ErrObjectNotFound {
+		return s.pool.HasEncodedObject(h)
+	}
+
+	return err
+}
+
+func (s *pooledStorer) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	size, err := s.Storer.EncodedObjectSize(h)
+	if err == plumbing.ErrObjectNotFound {
+		return s.pool.EncodedObjectSize(h)
+	}
+
+	return size, err
+}
+
+func (s *pooledStorer) IterEncodedObjects(
+	t plumbing.ObjectType,
+) (storer.EncodedObjectIter, error) {
+	local, err := s.Storer.IterEncodedObjects(t)
+	if err != nil {
+		return nil, err
+	}
+
+	pooled, err := s.pool.IterEncodedObjects(t)
+	if err != nil {
+		local.Close()
+		return nil, err
+	}
+
+	return storer.NewMultiEncodedObjectIter(
+		[]storer.EncodedObjectIter{local, pooled},
+	), nil
+}
+
+func (s *pooledStorer) IterReferences() (storer.ReferenceIter, error) {
+	local, err := s.Storer.IterReferences()
+	if err != nil || !s.refs {
+		return local, err
+	}
+
+	pooled, err := s.pool.IterReferences()
+	if err != nil {
+		local.Close()
+		return nil, err
+	}
+
+	return storer.NewMultiReferenceIter([]storer.ReferenceIter{
+		local,
+		storer.NewReferenceFilteredIter(
+			func(r *plumbing.Reference) bool {
+				return strings.HasPrefix(r.Name().String(), poolRefsPrefix)
+			},
+			pooled,
+		),
+	}), nil
+}
@@ -0,0 +1,210 @@
+package library
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+const poolRoot = "75773f4b954a85a30bc162b9903c18d88dcf13e3"
+
+func TestObjectPoolAdd(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	pool, err := NewObjectSharing(fs, 2).Pool(poolRoot)
+	require.NoError(err)
+	require.Equal(poolRoot, pool.Root())
+
+	first := memfs.New()
+	a := packBlobs(t, first, "a", "b", "c")
+	d := looseBlob(t, first, "d")
+	require.NoError(pool.Add(first))
+
+	// the packfile is copied and the loose object packed apart.
+	packs, err := fs.ReadDir("gitcollector.objects/75/" + poolRoot + "/objects/pack")
+	require.NoError(err)
+	require.Len(packs, 4)
+
+	fork := memfs.New()
+	e := packBlobs(t, fork, "b", "c", "e")
+	require.NoError(pool.Add(fork))
+
+	packs, err = fs.ReadDir("gitcollector.objects/75/" + poolRoot + "/objects/pack")
+	require.NoError(err)
+	require.Len(packs, 6)
+
+	var objects int
+	iter, err := pool.sto.IterEncodedObjects(plumbing.AnyObject)
+	require.NoError(err)
+	require.NoError(iter.ForEach(func(plumbing.EncodedObject) error {
+		objects++
+		return nil
+	}))
+	require.Equal(5, objects)
+
+	for _, h := range append(append(a, d), e...) {
+		require.NoError(pool.sto.HasEncodedObject(h))
+	}
+
+	// nothing is missing from the pool.
+	require.NoError(pool.Add(fork))
+	packs, err = fs.ReadDir("gitcollector.objects/75/" + poolRoot + "/objects/pack")
+	require.NoError(err)
+	require.Len(packs, 6)
+}
+
+func TestObjectPoolLink(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	sharing := NewObjectSharing(fs, 2)
+	pool, err := sharing.Pool(poolRoot)
+	require.NoError(err)
+
+	cloned := memfs.New()
+	blobs := packBlobs(t, cloned, "a", "b")
+	require.NoError(pool.Add(cloned))
+
+	lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+		Transactional: true,
+	})
+	require.NoError(err)
+
+	loc, err := lib.AddLocation("fork")
+	require.NoError(err)
+
+	r, err := loc.Init("github.com/foo/bar")
+	require.NoError(err)
+
+	linked, err := sharing.Linked(r)
+	require.NoError(err)
+	require.Nil(linked)
+
+	stale := plumbing.NewHashReference(
+		"refs/pool/fork/refs/remotes/foo/old", blobs[1])
+	require.NoError(pool.sto.SetReference(stale))
+	require.NoError(r.R().Storer.SetReference(plumbing.NewHashReference(
+		"refs/remotes/foo/HEAD", blobs[0])))
+	require.NoError(pool.Link(r))
+
+	linked, err = sharing.Linked(r)
+	require.NoError(err)
+	require.Equal(poolRoot, linked.Root())
+
+	_, err = (*ObjectSharing)(nil).Linked(r)
+	require.True(ErrObjectPoolRequired.Is(err))
+
+	ref, err := pool.sto.Reference("refs/pool/fork/refs/remotes/foo/HEAD")
+	require.NoError(err)
+	require.Equal(blobs[0], ref.Hash())
+
+	_, err = pool.sto.Reference(stale.Name())
+	require.Equal(plumbing.ErrReferenceNotFound, err)
+
+	// the objects are read from the pool, only the fetches list its
+	// references.
+	sto := linked.Storer(r.R().Storer)
+	_, err = sto.EncodedObject(plumbing.BlobObject, blobs[1])
+	require.NoError(err)
+	require.NoError(sto.HasEncodedObject(blobs[1]))
+
+	local := refNames(t, sto.IterReferences)
+	require.Contains(local, "refs/remotes/foo/HEAD")
+	fetched := refNames(t, linked.FetchStorer(r.R().Storer).IterReferences)
+	require.Contains(fetched, "refs/pool/fork/refs/remotes/foo/HEAD")
+	require.Len(fetched, 2*len(local))
+
+	var none *ObjectPool
+	require.Equal(r.R().Storer, none.Storer(r.R().Storer))
+	require.Equal(r.R().Storer, none.FetchStorer(r.R().Storer))
+
+	require.NoError(r.Close())
+}
+
+func TestJobLocationKey(t *testing.T) {
+	var require = require.New(t)
+
+	job := &Job{}
+	require.Equal(poolRoot, job.LocationKey("github.com/foo/bar", poolRoot))
+
+	require.NoError(WithNonRooted(nil)(job))
+	key := job.LocationKey("github.com/foo/bar", poolRoot)
+	require.Len(key, 40)
+	require.NotEqual(poolRoot, key)
+	require.NotEqual(key, job.LocationKey("github.com/foo/baz", poolRoot))
+	require.Nil(job.Sharing)
+}
+
+func refNames(
+	t *testing.T,
+	refs func() (storer.ReferenceIter, error),
+) []string {
+	iter, err := refs()
+	require.NoError(t, err)
+
+	var names []string
+	require.NoError(t, iter.ForEach(func(ref *plumbing.Reference) error {
+		if strings.HasPrefix(ref.Name().String(), "refs/") {
+			names = append(names, ref.Name().String())
+		}
+
+		return nil
+	}))
+
+	return names
+}
+
+// packBlobs writes the given contents as blobs in a packfile of the
+// repository in the filesystem.
+func packBlobs(t *testing.T, fs billy.Filesystem, contents ...string) []plumbing.Hash {
+	mem := memory.NewStorage()
+	var hashes []plumbing.Hash
+	for _, c := range contents {
+		hashes = append(hashes, setBlob(t, mem, c))
+	}
+
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	w, err := sto.PackfileWriter()
+	require.NoError(t, err)
+
+	_, err = packfile.NewEncoder(w, mem, false).Encode(hashes, 0)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return hashes
+}
+
+// looseBlob writes the content as a loose blob of the repository in the
+// filesystem.
+func looseBlob(t *testing.T, fs billy.Filesystem, content string) plumbing.Hash {
+	return setBlob(t, filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), content)
+}
+
+func setBlob(
+	t *testing.T,
+	sto storer.EncodedObjectStorer,
+	content string,
+) plumbing.Hash {
+	obj := sto.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	require.NoError(t, err)
+
+	_, err = w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	h, err := sto.SetEncodedObject(obj)
+	require.NoError(t, err)
+	return h
+}
@@ -0,0 +1,62 @@
+package library
+
+import (
+	"fmt"
+
+	"github.com/src-d/gitcollector"
+
+	"github.com/google/uuid"
+)
+
+// NewJournalShutdownFn returns a gitcollector.ShutdownFn registering in the
+// Journal the abandoned Jobs, discarded or canceled, as started. They're
+// returned by Reconcile on the next start so they can be enqueued again.
+func NewJournalShutdownFn(journal *Journal) gitcollector.ShutdownFn {
+	return func(report *gitcollector.ShutdownReport) gitcollector.ShutdownCleanup {
+		cleanup := gitcollector.ShutdownCleanup{Name: "journal checkpoint"}
+
+		var written int
+		abandoned := append(
+			append([]gitcollector.Job(nil), report.Canceled...),
+			report.Discarded...,
+		)
+		for _, j := range abandoned {
+			job, ok := j.(*Job)
+			if !ok {
+				continue
+			}
+
+			if job.ID == "" {
+				job.ID = uuid.New().String()
+			}
+
+			if err := journal.Begin(job); err != nil {
+				cleanup.Err = ErrJournal.Wrap(err, job.ID)
+				break
+			}
+
+			written++
+		}
+
+		cleanup.Detail = fmt.Sprintf(
+			"%d jobs to be resumed on the next start", written,
+		)
+
+		return cleanup
+	}
+}
+
+// NewTempShutdownFn returns a gitcollector.ShutdownFn removing the partial
+// temporal data left in the TempNamespace by the abandoned Jobs.
+func NewTempShutdownFn(ns *TempNamespace) gitcollector.ShutdownFn {
+	return func(*gitcollector.ShutdownReport) gitcollector.ShutdownCleanup {
+		removed, err := ns.Clean()
+		return gitcollector.ShutdownCleanup{
+			Name: "temporal files",
+			Detail: fmt.Sprintf(
+				"%d entries removed from %s", removed, ns.Name(),
+			),
+			Err: err,
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package library
+
+import (
+	"testing"
+
+	"github.com/src-d/gitcollector"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+func TestJournalShutdownFn(t *testing.T) {
+	var require = require.New(t)
+
+	journal := NewJournal(memfs.New(), "")
+	report := &gitcollector.ShutdownReport{
+		Canceled: []gitcollector.Job{&Job{
+			ID:        "canceled",
+			Type:      JobDownload,
+			Endpoints: []string{"git://github.com/src-d/gitcollector"},
+		}},
+		Discarded: []gitcollector.Job{&Job{
+			Type:       JobUpdate,
+			LocationID: "foo",
+		}},
+	}
+
+	cleanup := NewJournalShutdownFn(journal)(report)
+	require.NoError(cleanup.Err)
+	require.Equal("2 jobs to be resumed on the next start", cleanup.Detail)
+
+	pending, err := journal.Pending()
+	require.NoError(err)
+	require.Len(pending, 2)
+	require.Equal("canceled", pending[0].ID)
+	require.Equal(JournalBegin, pending[0].State)
+	require.NotEmpty(pending[1].ID)
+	require.Equal("foo", string(pending[1].LocationID))
+}
+
+func TestTempShutdownFn(t *testing.T) {
+	var require = require.New(t)
+
+	root := memfs.New()
+	ns, err := NewTempNamespace(root, "current", nil)
+	require.NoError(err)
+	defer ns.Close()
+
+	require.NoError(util.WriteFile(ns.FS(), "a/clone", []byte("a"), 0644))
+	require.NoError(util.WriteFile(ns.FS(), "b", []byte("b"), 0644))
+
+	// the temporal directory used to renew the lease is also removed
+	cleanup := NewTempShutdownFn(ns)(&gitcollector.ShutdownReport{})
+	require.NoError(cleanup.Err)
+	require.Equal(
+		"3 entries removed from "+TempPrefix+"current", cleanup.Detail,
+	)
+
+	entries, err := ns.FS().ReadDir("")
+	require.NoError(err)
+	require.Len(entries, 1)
+	require.Equal(LeaseFile, entries[0].Name())
+}
@@ -0,0 +1,81 @@
+package library
+
+import (
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+// StorageOpts holds the go-git storage tuning used by the Jobs for the
+// repositories they handle.
+type StorageOpts struct {
+	// ObjectCacheSize is the maximum size of the object cache of each
+	// repository. 0 means the go-git default (96MiB).
+	ObjectCacheSize cache.FileSize
+	// SharedCacheSize is the maximum size of the object cache shared by
+	// all the repositories of the library. 0 means every repository
+	// opened by a Job gets its own cache of the go-git default size, so an
+	// enormous repository doesn't evict the objects of the ones processed
+	// at the same time.
+	SharedCacheSize cache.FileSize
+	// ExclusiveAccess means that the filesystem is not modified externally
+	// while the repository is open.
+	ExclusiveAccess bool
+	// KeepDescriptors makes the packfile descriptors to be reused until the
+	// repository is closed.
+	KeepDescriptors bool
+	// MaxOpenDescriptors is the maximum number of packfile descriptors kept
+	// open.
+	MaxOpenDescriptors int
+	// TempFS overrides the temporal filesystem where the repositories are
+	// cloned before being moved into the library.
+	TempFS billy.Filesystem
+}
+
+// ObjectCache builds a new object cache honoring ObjectCacheSize.
+func (o *StorageOpts) ObjectCache() cache.Object {
+	if o == nil || o.ObjectCacheSize <= 0 {
+		return cache.NewObjectLRUDefault()
+	}
+
+	return cache.NewObjectLRU(o.ObjectCacheSize)
+}
+
+// SharedCache builds the object cache shared by the repositories of the
+// library, like the Cache of the siva.LibraryOptions. It's nil unless
+// SharedCacheSize is set, so every repository gets its own cache.
+func (o *StorageOpts) SharedCache() cache.Object {
+	if o == nil || o.SharedCacheSize <= 0 {
+		return nil
+	}
+
+	return cache.NewObjectLRU(o.SharedCacheSize)
+}
+
+// NewStorage builds a go-git storage on the given filesystem.
+func (o *StorageOpts) NewStorage(fs billy.Filesystem) *filesystem.Storage {
+	if o == nil {
+		return filesystem.NewStorage(fs, o.ObjectCache())
+	}
+
+	return filesystem.NewStorageWithOptions(fs, o.ObjectCache(),
+		filesystem.Options{
+			ExclusiveAccess:    o.ExclusiveAccess,
+			KeepDescriptors:    o.KeepDescriptors,
+			MaxOpenDescriptors: o.MaxOpenDescriptors,
+		},
+	)
+}
+
+// WithStorage is a JobSetupFn setting the storage options of the Job.
+func WithStorage(opts *StorageOpts) JobSetupFn {
+	return func(job *Job) error {
+		job.Storage = opts
+		if opts != nil && opts.TempFS != nil &&
+			job.Type == JobDownload {
+			job.TempFS = opts.TempFS
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,25 @@
+package library
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+)
+
+func TestStorageOptsSharedCache(t *testing.T) {
+	var require = require.New(t)
+
+	var opts *StorageOpts
+	require.Nil(opts.SharedCache())
+	require.NotNil(opts.ObjectCache())
+
+	// the repositories get their own caches unless the shared one is sized.
+	opts = &StorageOpts{ObjectCacheSize: cache.MiByte}
+	require.Nil(opts.SharedCache())
+
+	opts.SharedCacheSize = cache.MiByte
+	shared := opts.SharedCache()
+	require.NotNil(shared)
+	require.True(shared != opts.SharedCache())
+}
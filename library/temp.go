@@ -0,0 +1,271 @@
+package library
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+const (
+	// TempPrefix is the prefix of the temporal namespaces directories.
+	TempPrefix = "gitcollector-"
+	// LeaseFile is the name of the file holding the lease of a temporal
+	// namespace.
+	LeaseFile = "gitcollector.lease"
+)
+
+// TempLease identifies the process owning a temporal namespace.
+type TempLease struct {
+	RunID   string    `json:"run_id"`
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Renewed time.Time `json:"renewed"`
+}
+
+// TempNamespaceOpts represents configuration options for a TempNamespace.
+type TempNamespaceOpts struct {
+	// TTL is the time a lease is valid without being renewed, the
+	// namespaces with expired leases are considered orphans.
+	TTL time.Duration
+}
+
+const tempLeaseTTL = 10 * time.Minute
+
+// TempNamespace is a temporal directory owned by a run. It holds a lease
+// renewed periodically so the namespaces of crashed runs can be detected and
+// removed by the next ones.
+type TempNamespace struct {
+	fs    billy.Filesystem
+	root  billy.Filesystem
+	name  string
+	lease *TempLease
+	stop  chan struct{}
+	wg    sync.WaitGroup
+	opts  *TempNamespaceOpts
+}
+
+// NewTempNamespace creates the temporal namespace of the given run in the root
+// filesystem.
+func NewTempNamespace(
+	root billy.Filesystem,
+	runID string,
+	opts *TempNamespaceOpts,
+) (*TempNamespace, error) {
+	if opts == nil {
+		opts = &TempNamespaceOpts{}
+	}
+
+	if opts.TTL <= 0 {
+		opts.TTL = tempLeaseTTL
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	name := TempPrefix + runID
+	if err := root.MkdirAll(name, 0755); err != nil {
+		return nil, err
+	}
+
+	fs, err := root.Chroot(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ns := &TempNamespace{
+		fs:   fs,
+		root: root,
+		name: name,
+		lease: &TempLease{
+			RunID: runID,
+			PID:   os.Getpid(),
+			Host:  host,
+		},
+		stop: make(chan struct{}),
+		opts: opts,
+	}
+
+	if err := ns.renew(); err != nil {
+		return nil, err
+	}
+
+	ns.wg.Add(1)
+	go ns.keepAlive()
+	return ns, nil
+}
+
+// FS returns the filesystem of the namespace.
+func (n *TempNamespace) FS() billy.Filesystem {
+	return n.fs
+}
+
+// Name returns the name of the namespace directory in the root filesystem.
+func (n *TempNamespace) Name() string {
+	return n.name
+}
+
+// Close stops renewing the lease and removes the namespace.
+func (n *TempNamespace) Close() error {
+	close(n.stop)
+	n.wg.Wait()
+	return util.RemoveAll(n.root, n.name)
+}
+
+// Clean removes the content of the namespace left by the Jobs, keeping its
+// lease. It returns the number of entries removed from its root.
+func (n *TempNamespace) Clean() (int, error) {
+	entries, err := n.fs.ReadDir("")
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int
+	for _, e := range entries {
+		if e.Name() == LeaseFile {
+			continue
+		}
+
+		if err := util.RemoveAll(n.fs, e.Name()); err != nil {
+			return removed, err
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
+
+func (n *TempNamespace) keepAlive() {
+	defer n.wg.Done()
+
+	ticker := time.NewTicker(n.opts.TTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// a failed renewal is retried on the next tick, the lease
+			// only expires after several of them.
+			n.renew()
+		case <-n.stop:
+			return
+		}
+	}
+}
+
+func (n *TempNamespace) renew() error {
+	n.lease.Renewed = time.Now().UTC()
+	data, err := json.Marshal(n.lease)
+	if err != nil {
+		return err
+	}
+
+	// the lease is replaced atomically so it's never read half written.
+	f, err := util.TempFile(n.fs, "", LeaseFile)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return n.fs.Rename(f.Name(), LeaseFile)
+}
+
+// CleanOrphanNamespaces removes the temporal namespaces in the root filesystem
+// whose owner is dead, that is, a process no longer running in this host or an
+// expired lease. It returns the names of the removed namespaces.
+func CleanOrphanNamespaces(
+	root billy.Filesystem,
+	opts *TempNamespaceOpts,
+) ([]string, error) {
+	if opts == nil {
+		opts = &TempNamespaceOpts{}
+	}
+
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = tempLeaseTTL
+	}
+
+	files, err := root.ReadDir("")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, f := range files {
+		if !f.IsDir() || !strings.HasPrefix(f.Name(), TempPrefix) {
+			continue
+		}
+
+		lease, err := readLease(root, f.Name())
+		if err != nil {
+			// namespaces of older versions or not yet leased, only
+			// removed once they're old enough.
+			if time.Since(f.ModTime()) < ttl {
+				continue
+			}
+		} else if !lease.orphan(host, ttl) {
+			continue
+		}
+
+		if err := util.RemoveAll(root, f.Name()); err != nil {
+			return removed, err
+		}
+
+		removed = append(removed, f.Name())
+	}
+
+	return removed, nil
+}
+
+func readLease(root billy.Filesystem, name string) (*TempLease, error) {
+	f, err := root.Open(root.Join(name, LeaseFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	lease := &TempLease{}
+	if err := json.Unmarshal(data, lease); err != nil {
+		return nil, err
+	}
+
+	return lease, nil
+}
+
+func (l *TempLease) orphan(host string, ttl time.Duration) bool {
+	if l.Host == host && l.PID != os.Getpid() && !processAlive(l.PID) {
+		return true
+	}
+
+	return time.Since(l.Renewed) > ttl
+}
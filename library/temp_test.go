@@ -0,0 +1,75 @@
+package library
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+func TestTempNamespace(t *testing.T) {
+	var require = require.New(t)
+
+	root := memfs.New()
+	ns, err := NewTempNamespace(root, "current", nil)
+	require.NoError(err)
+	require.Equal(TempPrefix+"current", ns.Name())
+	require.NoError(util.WriteFile(ns.FS(), "foo", []byte("foo"), 0644))
+
+	host, err := os.Hostname()
+	require.NoError(err)
+
+	writeLease := func(runID string, lease *TempLease) {
+		data, err := json.Marshal(lease)
+		require.NoError(err)
+		require.NoError(util.WriteFile(
+			root, root.Join(TempPrefix+runID, LeaseFile), data, 0644,
+		))
+	}
+
+	// a process that doesn't exist
+	writeLease("dead", &TempLease{
+		PID: 1 << 30, Host: host, Renewed: time.Now(),
+	})
+
+	// a process in other host that stopped renewing its lease
+	writeLease("expired", &TempLease{
+		PID: 1, Host: "other", Renewed: time.Now().Add(-time.Hour),
+	})
+
+	writeLease("alive", &TempLease{
+		PID: 1, Host: "other", Renewed: time.Now(),
+	})
+
+	require.NoError(root.MkdirAll(TempPrefix+"unleased", 0755))
+	require.NoError(root.MkdirAll("other", 0755))
+
+	removed, err := CleanOrphanNamespaces(root, nil)
+	require.NoError(err)
+	require.ElementsMatch([]string{
+		TempPrefix + "dead",
+		TempPrefix + "expired",
+	}, removed)
+
+	files, err := root.ReadDir("")
+	require.NoError(err)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+
+	require.ElementsMatch([]string{
+		TempPrefix + "current",
+		TempPrefix + "alive",
+		TempPrefix + "unleased",
+		"other",
+	}, names)
+
+	require.NoError(ns.Close())
+	_, err = root.Stat(ns.Name())
+	require.True(os.IsNotExist(err))
+}
@@ -0,0 +1,183 @@
+package library
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// ErrTierNotFound is returned when a rule routes the Jobs to an unknown
+// storage tier.
+var ErrTierNotFound = errors.NewKind("storage tier not found: %s")
+
+// Labels set by the discovery on the Jobs.
+const (
+	// LabelTopics holds the topics of the repository separated by comma.
+	LabelTopics = "topics"
+	// LabelLanguage holds the main language of the repository.
+	LabelLanguage = "language"
+	// LabelPushedAt holds the time of the last push to the repository in
+	// RFC 3339 format.
+	LabelPushedAt = "pushed_at"
+)
+
+// StorageTier is a library where the Jobs can be routed to.
+type StorageTier struct {
+	Name string
+	Lib  borges.Library
+	// TempFS overrides the temporal filesystem of the download Jobs
+	// routed to this tier.
+	TempFS billy.Filesystem
+}
+
+// TierRule routes the Jobs matching all of its conditions to a storage tier.
+// Conditions left empty always match.
+type TierRule struct {
+	// Tier is the name of the storage tier.
+	Tier string `json:"tier"`
+	// Topics matches the repositories with any of these topics.
+	Topics []string `json:"topics,omitempty"`
+	// Language matches the repositories with this main language.
+	Language string `json:"language,omitempty"`
+	// MinSize and MaxSize match the repositories by their size in bytes.
+	// Repositories with unknown size don't match any of them.
+	MinSize uint64 `json:"min_size,omitempty"`
+	MaxSize uint64 `json:"max_size,omitempty"`
+	// ActiveDays matches the repositories pushed in the last days.
+	ActiveDays int `json:"active_days,omitempty"`
+	// InactiveDays matches the repositories not pushed in the last days.
+	InactiveDays int `json:"inactive_days,omitempty"`
+}
+
+// ParseTierRules reads a JSON list of TierRules.
+func ParseTierRules(r io.Reader) ([]*TierRule, error) {
+	var rules []*TierRule
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// Match returns whether the Job matches the rule at the given time.
+func (r *TierRule) Match(job *Job, now time.Time) bool {
+	if len(r.Topics) > 0 && !hasAnyTopic(job, r.Topics) {
+		return false
+	}
+
+	if r.Language != "" &&
+		!strings.EqualFold(job.Labels[LabelLanguage], r.Language) {
+		return false
+	}
+
+	if (r.MinSize > 0 || r.MaxSize > 0) && job.SizeHint == 0 {
+		return false
+	}
+
+	if r.MinSize > 0 && job.SizeHint < r.MinSize {
+		return false
+	}
+
+	if r.MaxSize > 0 && job.SizeHint > r.MaxSize {
+		return false
+	}
+
+	if r.ActiveDays == 0 && r.InactiveDays == 0 {
+		return true
+	}
+
+	pushed, err := time.Parse(time.RFC3339, job.Labels[LabelPushedAt])
+	if err != nil {
+		return false
+	}
+
+	idle := now.Sub(pushed)
+	if r.ActiveDays > 0 && idle > days(r.ActiveDays) {
+		return false
+	}
+
+	if r.InactiveDays > 0 && idle < days(r.InactiveDays) {
+		return false
+	}
+
+	return true
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
+
+func hasAnyTopic(job *Job, topics []string) bool {
+	labels := job.Labels[LabelTopics]
+	if labels == "" {
+		return false
+	}
+
+	for _, t := range strings.Split(labels, ",") {
+		for _, topic := range topics {
+			if strings.EqualFold(t, topic) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// WithStorageTiers is a JobSetupFn routing the download Jobs to the storage
+// tier of the first matching rule. Jobs not matching any rule keep their
+// library. Update Jobs are left untouched since their locations already live
+// in a library.
+//
+// Repositories are only looked up in the library of their tier, so the rules
+// should route each repository always to the same tier.
+func WithStorageTiers(
+	tiers []*StorageTier,
+	rules []*TierRule,
+) (JobSetupFn, error) {
+	byName := make(map[string]*StorageTier, len(tiers))
+	for _, t := range tiers {
+		byName[t.Name] = t
+	}
+
+	for _, r := range rules {
+		if _, ok := byName[r.Tier]; !ok {
+			return nil, ErrTierNotFound.New(r.Tier)
+		}
+	}
+
+	return func(job *Job) error {
+		if job.Type != JobDownload {
+			return nil
+		}
+
+		now := time.Now()
+		for _, r := range rules {
+			if !r.Match(job, now) {
+				continue
+			}
+
+			tier := byName[r.Tier]
+			job.Lib = tier.Lib
+			if tier.TempFS != nil {
+				job.TempFS = tier.TempFS
+			}
+
+			if job.Logger != nil {
+				job.Logger = job.Logger.With(log.Fields{
+					"tier": tier.Name,
+				})
+			}
+
+			return nil
+		}
+
+		return nil
+	}, nil
+}
@@ -0,0 +1,111 @@
+package library
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestTierRuleMatch(t *testing.T) {
+	var require = require.New(t)
+
+	now := time.Now()
+	pushed := func(d time.Duration) string {
+		return now.Add(-d).Format(time.RFC3339)
+	}
+
+	job := &Job{
+		Type:     JobDownload,
+		SizeHint: 10 << 20,
+		Labels: map[string]string{
+			LabelTopics:   "linux,kernel",
+			LabelLanguage: "C",
+			LabelPushedAt: pushed(48 * time.Hour),
+		},
+	}
+
+	tests := []struct {
+		rule  TierRule
+		match bool
+	}{
+		{TierRule{}, true},
+		{TierRule{Topics: []string{"Kernel", "foo"}}, true},
+		{TierRule{Topics: []string{"foo"}}, false},
+		{TierRule{Language: "c"}, true},
+		{TierRule{Language: "Go"}, false},
+		{TierRule{MinSize: 1 << 20, MaxSize: 20 << 20}, true},
+		{TierRule{MaxSize: 1 << 20}, false},
+		{TierRule{MinSize: 20 << 20}, false},
+		{TierRule{ActiveDays: 7}, true},
+		{TierRule{ActiveDays: 1}, false},
+		{TierRule{InactiveDays: 1}, true},
+		{TierRule{InactiveDays: 7}, false},
+		{TierRule{Language: "C", InactiveDays: 7}, false},
+	}
+
+	for i, test := range tests {
+		require.Equal(test.match, test.rule.Match(job, now), "rule %d", i)
+	}
+
+	unknown := &Job{Type: JobDownload}
+	require.False((&TierRule{MinSize: 1}).Match(unknown, now))
+	require.False((&TierRule{ActiveDays: 1}).Match(unknown, now))
+}
+
+func TestWithStorageTiers(t *testing.T) {
+	var require = require.New(t)
+
+	rules, err := ParseTierRules(strings.NewReader(`[
+		{"tier": "cold", "inactive_days": 365},
+		{"tier": "fast", "topics": ["hot"]}
+	]`))
+	require.NoError(err)
+	require.Len(rules, 2)
+
+	_, err = WithStorageTiers(nil, rules)
+	require.True(ErrTierNotFound.Is(err))
+
+	coldLib, err := siva.NewLibrary("cold", memfs.New(),
+		siva.LibraryOptions{})
+	require.NoError(err)
+
+	fastLib, err := siva.NewLibrary("fast", memfs.New(),
+		siva.LibraryOptions{})
+	require.NoError(err)
+
+	var (
+		cold = &StorageTier{Name: "cold", Lib: coldLib}
+		fast = &StorageTier{Name: "fast", Lib: fastLib}
+	)
+
+	setup, err := WithStorageTiers([]*StorageTier{cold, fast}, rules)
+	require.NoError(err)
+
+	job := &Job{
+		Type: JobDownload,
+		Labels: map[string]string{
+			LabelTopics:   "hot",
+			LabelPushedAt: time.Now().Format(time.RFC3339),
+		},
+	}
+	require.NoError(setup(job))
+	require.True(job.Lib == fast.Lib)
+
+	job.Labels[LabelPushedAt] = time.Now().
+		Add(-400 * 24 * time.Hour).Format(time.RFC3339)
+	require.NoError(setup(job))
+	require.True(job.Lib == cold.Lib)
+
+	// update jobs and jobs not matching any rule keep their library
+	update := &Job{Type: JobUpdate, Labels: job.Labels}
+	require.NoError(setup(update))
+	require.Nil(update.Lib)
+
+	other := &Job{Type: JobDownload}
+	require.NoError(setup(other))
+	require.Nil(other.Lib)
+}
@@ -0,0 +1,101 @@
+package library
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/src-d/gitcollector"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage"
+)
+
+// packHeaderLen is the size of the header of a packfile: its signature,
+// version and number of objects.
+const packHeaderLen = 12
+
+// Transfer is the data fetched from the remotes by a Job.
+type Transfer struct {
+	// Packfiles is the number of packfiles fetched.
+	Packfiles int
+	// Bytes is the size of the packfiles fetched.
+	Bytes uint64
+	// Objects is the number of objects in the packfiles fetched.
+	Objects uint64
+}
+
+// JobTransfer implements the gitcollector.TransferJob interface.
+func (j *Job) JobTransfer() gitcollector.TransferStats {
+	if j.Transfer == nil {
+		return gitcollector.TransferStats{}
+	}
+
+	return gitcollector.TransferStats{
+		BytesFetched:  j.Transfer.Bytes,
+		ObjectsPacked: j.Transfer.Objects,
+	}
+}
+
+// Storer wraps the given storage counting into the Transfer the packfiles
+// fetched into it. It's returned as is if the Transfer is nil or the storage
+// doesn't write the packfiles as they're received, since they're never seen
+// whole then.
+func (t *Transfer) Storer(s storage.Storer) storage.Storer {
+	pw, ok := s.(storer.PackfileWriter)
+	if t == nil || !ok {
+		return s
+	}
+
+	return &transferStorer{Storer: s, pw: pw, t: t}
+}
+
+type transferStorer struct {
+	storage.Storer
+	pw storer.PackfileWriter
+	t  *Transfer
+}
+
+var _ storer.PackfileWriter = (*transferStorer)(nil)
+
+// PackfileWriter implements the storer.PackfileWriter interface.
+func (s *transferStorer) PackfileWriter() (io.WriteCloser, error) {
+	w, err := s.pw.PackfileWriter()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.t.Writer(w), nil
+}
+
+// Writer wraps the given writer of a packfile counting it into the Transfer.
+// It's returned as is if the Transfer is nil.
+func (t *Transfer) Writer(w io.WriteCloser) io.WriteCloser {
+	if t == nil {
+		return w
+	}
+
+	t.Packfiles++
+	return &transferWriter{WriteCloser: w, t: t}
+}
+
+type transferWriter struct {
+	io.WriteCloser
+	t      *Transfer
+	header []byte
+}
+
+func (w *transferWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.t.Bytes += uint64(n)
+	if missing := packHeaderLen - len(w.header); missing > 0 {
+		if missing > n {
+			missing = n
+		}
+
+		w.header = append(w.header, p[:missing]...)
+		if len(w.header) == packHeaderLen && string(w.header[:4]) == "PACK" {
+			w.t.Objects += uint64(binary.BigEndian.Uint32(w.header[8:]))
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,79 @@
+package library
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/src-d/gitcollector"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func TestTransfer(t *testing.T) {
+	var require = require.New(t)
+
+	remoteDir, err := ioutil.TempDir("", "gitcollector")
+	require.NoError(err)
+	defer os.RemoveAll(remoteDir)
+
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", remoteDir}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		require.NoError(err, string(out))
+	}
+
+	run("init", "-q")
+	for i := 0; i < 3; i++ {
+		run("commit", "-q", "--allow-empty", "-m", fmt.Sprintf("commit %d", i))
+	}
+
+	dir, err := ioutil.TempDir("", "gitcollector")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	sto := filesystem.NewStorage(osfs.New(dir), cache.NewObjectLRUDefault())
+	repo, err := git.Init(sto, nil)
+	require.NoError(err)
+
+	transfer := &Transfer{}
+	remote := git.NewRemote(transfer.Storer(repo.Storer), &config.RemoteConfig{
+		Name:  "origin",
+		URLs:  []string{"file://" + remoteDir},
+		Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+	})
+	require.NoError(remote.Fetch(&git.FetchOptions{}))
+
+	// three commits sharing the empty tree
+	require.Equal(1, transfer.Packfiles)
+	require.Equal(uint64(4), transfer.Objects)
+	require.True(transfer.Bytes > packHeaderLen)
+
+	err = remote.Fetch(&git.FetchOptions{})
+	require.Equal(git.NoErrAlreadyUpToDate, err)
+	require.Equal(1, transfer.Packfiles)
+
+	job := &Job{Transfer: transfer}
+	require.Equal(gitcollector.TransferStats{
+		BytesFetched:  transfer.Bytes,
+		ObjectsPacked: 4,
+	}, gitcollector.JobTransfer(job))
+	require.Zero(gitcollector.JobTransfer(&Job{}))
+
+	// the storages not writing whole packfiles aren't counted
+	mem := memory.NewStorage()
+	require.True(transfer.Storer(mem) == mem)
+	var none *Transfer
+	require.True(none.Storer(sto) == sto)
+}
@@ -0,0 +1,314 @@
+package library
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrNotInTrash is returned when a location to restore isn't in the
+	// trash.
+	ErrNotInTrash = errors.NewKind("location %s not found in the trash")
+
+	// ErrAlreadyInTrash is returned when a location is deleted while a
+	// previous deletion of it is still in the trash.
+	ErrAlreadyInTrash = errors.NewKind("location %s already in the trash")
+
+	// ErrRestoreConflict is returned when a location is restored but the
+	// library already has a location with the same ID.
+	ErrRestoreConflict = errors.NewKind(
+		"location %s can't be restored, it exists in the library")
+)
+
+const (
+	// TrashDir is the directory of the library where the deleted
+	// locations are kept until their grace period expires.
+	TrashDir = ".trash"
+	// TombstoneFile is the name of the file describing a deleted location.
+	TombstoneFile = "tombstone.json"
+)
+
+// Extensions of the files of a siva location.
+var locationFiles = []string{".siva", ".siva.checkpoint", ".siva.yaml"}
+
+// Tombstone describes a location moved to the trash.
+type Tombstone struct {
+	LocationID borges.LocationID `json:"location"`
+	// Reason is why the location was deleted, like gc or takedown.
+	Reason  string    `json:"reason,omitempty"`
+	Deleted time.Time `json:"deleted"`
+}
+
+// Expired returns whether the grace period of the deleted location is over.
+func (t *Tombstone) Expired(grace time.Duration, now time.Time) bool {
+	return now.Sub(t.Deleted) > grace
+}
+
+// TrashOpts represents configuration options for a Trash.
+type TrashOpts struct {
+	// Bucket is the bucketization level of the library.
+	Bucket int
+	// Grace is the time the deleted locations are kept in the trash.
+	Grace time.Duration
+	// Audit records the deletions, restorations and purges, none by
+	// default.
+	Audit *AuditLog
+}
+
+const trashGrace = 30 * 24 * time.Hour
+
+// Trash gives soft-delete semantics to the removal of the locations of a siva
+// library. Deleted locations are moved to the TrashDir of the library along
+// with a tombstone, so they can be restored until they're purged once their
+// grace period expires.
+//
+// The siva libraries cache their locations, so the libraries opened on the
+// same filesystem shouldn't be using the locations being deleted or restored.
+type Trash struct {
+	fs   billy.Filesystem
+	opts *TrashOpts
+}
+
+// NewTrash builds a new Trash for the library stored in the given filesystem.
+func NewTrash(fs billy.Filesystem, opts *TrashOpts) *Trash {
+	if opts == nil {
+		opts = &TrashOpts{}
+	}
+
+	if opts.Grace <= 0 {
+		opts.Grace = trashGrace
+	}
+
+	return &Trash{fs: fs, opts: opts}
+}
+
+// Delete moves the location to the trash. Pinned locations can't be deleted.
+func (t *Trash) Delete(
+	id borges.LocationID,
+	reason string,
+) (*Tombstone, error) {
+	an, err := NewAnnotations(t.fs).Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if an.Pinned {
+		return nil, ErrLocationPinned.New(id)
+	}
+
+	dir := t.fs.Join(TrashDir, string(id))
+	if _, err := t.fs.Stat(dir); err == nil {
+		return nil, ErrAlreadyInTrash.New(id)
+	}
+
+	base := sivaPath(id, t.opts.Bucket)
+	if _, err := t.fs.Stat(base + ".siva"); err != nil {
+		if os.IsNotExist(err) {
+			return nil, borges.ErrLocationNotExists.New(id)
+		}
+
+		return nil, err
+	}
+
+	if err := t.fs.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	ts := &Tombstone{
+		LocationID: id,
+		Reason:     reason,
+		Deleted:    time.Now().UTC(),
+	}
+
+	// the tombstone is written first, so a trash directory always has one
+	// even if the move is interrupted.
+	data, err := json.Marshal(ts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = util.WriteFile(t.fs, t.fs.Join(dir, TombstoneFile), data, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.move(base, t.fs.Join(dir, string(id))); err != nil {
+		return nil, err
+	}
+
+	if err := t.opts.Audit.Record(AuditDelete, id, reason, ""); err != nil {
+		return nil, err
+	}
+
+	return ts, nil
+}
+
+// Restore moves the location back from the trash into the library.
+func (t *Trash) Restore(id borges.LocationID) error {
+	dir := t.fs.Join(TrashDir, string(id))
+	ts, err := t.tombstone(id)
+	if err != nil {
+		return err
+	}
+
+	base := sivaPath(id, t.opts.Bucket)
+	if _, err := t.fs.Stat(base + ".siva"); err == nil {
+		return ErrRestoreConflict.New(id)
+	}
+
+	if d := path.Dir(base); d != "." {
+		if err := t.fs.MkdirAll(d, 0755); err != nil {
+			return err
+		}
+	}
+
+	if err := t.move(t.fs.Join(dir, string(id)), base); err != nil {
+		return err
+	}
+
+	if err := util.RemoveAll(t.fs, dir); err != nil {
+		return err
+	}
+
+	detail := "deleted " + ts.Deleted.Format(time.RFC3339)
+	return t.opts.Audit.Record(AuditRestore, id, ts.Reason, detail)
+}
+
+// List returns the tombstones of the locations in the trash, the oldest
+// deletions first.
+func (t *Trash) List() ([]*Tombstone, error) {
+	files, err := t.fs.ReadDir(TrashDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var list []*Tombstone
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+
+		ts, err := t.tombstone(borges.LocationID(f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, ts)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Deleted.Before(list[j].Deleted)
+	})
+
+	return list, nil
+}
+
+// Purge permanently removes the locations whose grace period expired and
+// returns their tombstones.
+func (t *Trash) Purge() ([]*Tombstone, error) {
+	list, err := t.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		now    = time.Now()
+		purged []*Tombstone
+	)
+
+	for _, ts := range list {
+		if !ts.Expired(t.opts.Grace, now) {
+			continue
+		}
+
+		dir := t.fs.Join(TrashDir, string(ts.LocationID))
+		if err := util.RemoveAll(t.fs, dir); err != nil {
+			return purged, err
+		}
+
+		err := t.opts.Audit.Record(
+			AuditPurge, ts.LocationID, ts.Reason, "grace period expired",
+		)
+		if err != nil {
+			return purged, err
+		}
+
+		purged = append(purged, ts)
+	}
+
+	return purged, nil
+}
+
+func (t *Trash) tombstone(id borges.LocationID) (*Tombstone, error) {
+	f, err := t.fs.Open(t.fs.Join(TrashDir, string(id), TombstoneFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotInTrash.New(id)
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &Tombstone{}
+	if err := json.Unmarshal(data, ts); err != nil {
+		return nil, err
+	}
+
+	return ts, nil
+}
+
+// move renames the files of a location from one base path to another.
+func (t *Trash) move(from, to string) error {
+	for _, ext := range locationFiles {
+		err := t.fs.Rename(from+ext, to+ext)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sivaPath returns the path without extension of a location in a siva
+// library, the same way go-borges builds it.
+func sivaPath(id borges.LocationID, bucket int) string {
+	if bucket <= 0 {
+		return string(id)
+	}
+
+	r := []rune(id)
+	var dir string
+	if len(r) < bucket {
+		dir = string(id) + strings.Repeat("-", bucket-len(r))
+	} else {
+		dir = string(r[:bucket])
+	}
+
+	return path.Join(dir, string(id))
+}
+
+// LocationFile returns the path of the siva file of a location in a siva
+// library with the given bucketization level.
+func LocationFile(id borges.LocationID, bucket int) string {
+	return sivaPath(id, bucket) + ".siva"
+}
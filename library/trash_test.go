@@ -0,0 +1,134 @@
+package library
+
+import (
+	"testing"
+	"time"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestTrash(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	newLib := func() *siva.Library {
+		lib, err := siva.NewLibrary("test", fs, siva.LibraryOptions{
+			Bucket:        2,
+			Transactional: true,
+			TempFS:        memfs.New(),
+		})
+		require.NoError(err)
+		return lib
+	}
+
+	lib := newLib()
+	for _, id := range []borges.LocationID{"foo", "bar"} {
+		loc, err := lib.AddLocation(id)
+		require.NoError(err)
+		r, err := loc.Init("github.com/src-d/" + borges.RepositoryID(id))
+		require.NoError(err)
+		require.NoError(r.Commit())
+	}
+
+	audit := NewAuditLog(fs, "", "alice")
+	trash := NewTrash(fs, &TrashOpts{
+		Bucket: 2,
+		Grace:  time.Hour,
+		Audit:  audit,
+	})
+
+	require.NoError(NewAnnotations(fs).Set(&Annotation{
+		LocationID: "foo",
+		Pinned:     true,
+	}))
+	_, err := trash.Delete("foo", "gc")
+	require.True(ErrLocationPinned.Is(err))
+	require.NoError(NewAnnotations(fs).Set(&Annotation{LocationID: "foo"}))
+
+	_, err = trash.Delete("baz", "gc")
+	require.True(borges.ErrLocationNotExists.Is(err))
+
+	ts, err := trash.Delete("foo", "takedown")
+	require.NoError(err)
+	require.Equal(borges.LocationID("foo"), ts.LocationID)
+	require.Equal("takedown", ts.Reason)
+
+	_, err = trash.Delete("foo", "gc")
+	require.True(ErrAlreadyInTrash.Is(err))
+
+	require.Equal([]borges.LocationID{"bar"}, locationIDs(t, newLib()))
+
+	list, err := trash.List()
+	require.NoError(err)
+	require.Len(list, 1)
+	require.Equal(ts.LocationID, list[0].LocationID)
+
+	require.True(ErrNotInTrash.Is(trash.Restore("bar")))
+	require.NoError(trash.Restore("foo"))
+	require.ElementsMatch(
+		[]borges.LocationID{"foo", "bar"}, locationIDs(t, newLib()))
+
+	ok, _, _, err := newLib().Has("github.com/src-d/foo")
+	require.NoError(err)
+	require.True(ok)
+
+	// purge only removes the locations past their grace period
+	_, err = trash.Delete("bar", "gc")
+	require.NoError(err)
+
+	purged, err := trash.Purge()
+	require.NoError(err)
+	require.Empty(purged)
+
+	expired := NewTrash(fs, &TrashOpts{
+		Bucket: 2,
+		Grace:  time.Nanosecond,
+		Audit:  audit,
+	})
+	purged, err = expired.Purge()
+	require.NoError(err)
+	require.Len(purged, 1)
+	require.Equal(borges.LocationID("bar"), purged[0].LocationID)
+
+	list, err = trash.List()
+	require.NoError(err)
+	require.Empty(list)
+	require.True(ErrNotInTrash.Is(trash.Restore("bar")))
+	require.False(exists(fs, "ba/bar.siva"))
+
+	// only the successful operations are recorded
+	entries, err := audit.Entries(nil)
+	require.NoError(err)
+	var actions []AuditAction
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+
+	require.Equal([]AuditAction{
+		AuditDelete, AuditRestore, AuditDelete, AuditPurge,
+	}, actions)
+	require.Equal("takedown", entries[1].Reason)
+	require.EqualValues("bar", entries[3].LocationID)
+}
+
+func locationIDs(t *testing.T, lib borges.Library) []borges.LocationID {
+	iter, err := lib.Locations()
+	require.NoError(t, err)
+
+	var ids []borges.LocationID
+	require.NoError(t, iter.ForEach(func(l borges.Location) error {
+		ids = append(ids, l.ID())
+		return nil
+	}))
+
+	return ids
+}
+
+func exists(fs billy.Filesystem, path string) bool {
+	_, err := fs.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,171 @@
+package library
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// DiskUsage is the disk space written by a Job.
+type DiskUsage struct {
+	// Temp is the number of bytes written to the temporal filesystem,
+	// like the clones of the repositories.
+	Temp uint64
+	// Final is the growth in bytes of the location the Job stored the
+	// repository in. It can be negative if the location was repacked.
+	Final int64
+}
+
+// WritesTo must be called by a JobFn once it knows the location it's going
+// to write to, before writing to it.
+func (j *Job) WritesTo(id borges.LocationID) {
+	if j.OnLocation != nil {
+		j.OnLocation(id)
+	}
+}
+
+// DiskUsageOpts represents configuration options for the disk usage
+// measures.
+type DiskUsageOpts struct {
+	// FS is the filesystem of the siva library the Jobs write to.
+	FS billy.Filesystem
+	// Bucket is the bucketization level of the library.
+	Bucket int
+}
+
+// NewDiskUsageJobFn wraps the given JobFn measuring the DiskUsage of every
+// Job. The growth of the locations is measured on their siva files, so it
+// includes the writes of any other Job on the same location at the same time.
+func NewDiskUsageJobFn(opts *DiskUsageOpts, fn JobFn) JobFn {
+	return func(ctx context.Context, job *Job) error {
+		var (
+			temp   = newCountingFS(job.TempFS)
+			before = map[borges.LocationID]int64{}
+			mu     sync.Mutex
+		)
+
+		record := func(id borges.LocationID) {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := before[id]; !ok {
+				before[id] = locationSize(opts, id)
+			}
+		}
+
+		if job.LocationID != "" {
+			record(job.LocationID)
+		}
+
+		onLocation := job.OnLocation
+		job.OnLocation = func(id borges.LocationID) {
+			record(id)
+			if onLocation != nil {
+				onLocation(id)
+			}
+		}
+
+		tempFS := job.TempFS
+		if job.TempFS != nil {
+			job.TempFS = temp
+		}
+
+		err := fn(ctx, job)
+
+		job.TempFS = tempFS
+		job.OnLocation = onLocation
+
+		usage := &DiskUsage{Temp: temp.written()}
+		if job.LocationID != "" {
+			mu.Lock()
+			usage.Final = locationSize(opts, job.LocationID) -
+				before[job.LocationID]
+			mu.Unlock()
+		}
+
+		job.DiskUsage = usage
+		if job.Logger != nil {
+			job.Logger.With(log.Fields{
+				"location":    job.LocationID,
+				"temp_bytes":  usage.Temp,
+				"final_bytes": usage.Final,
+			}).Debugf("disk usage")
+		}
+
+		return err
+	}
+}
+
+// locationSize returns the size of the siva file of the location, 0 if it
+// doesn't exist.
+func locationSize(opts *DiskUsageOpts, id borges.LocationID) int64 {
+	info, err := opts.FS.Stat(sivaPath(id, opts.Bucket) + ".siva")
+	if err != nil {
+		return 0
+	}
+
+	return info.Size()
+}
+
+// countingFS is a billy.Filesystem counting the bytes written to the files
+// it creates or opens.
+type countingFS struct {
+	billy.Filesystem
+	n *uint64
+}
+
+func newCountingFS(fs billy.Filesystem) *countingFS {
+	return &countingFS{Filesystem: fs, n: new(uint64)}
+}
+
+func (fs *countingFS) written() uint64 {
+	return atomic.LoadUint64(fs.n)
+}
+
+func (fs *countingFS) Create(filename string) (billy.File, error) {
+	return fs.wrap(fs.Filesystem.Create(filename))
+}
+
+func (fs *countingFS) OpenFile(
+	filename string,
+	flag int,
+	perm os.FileMode,
+) (billy.File, error) {
+	return fs.wrap(fs.Filesystem.OpenFile(filename, flag, perm))
+}
+
+func (fs *countingFS) TempFile(dir, prefix string) (billy.File, error) {
+	return fs.wrap(fs.Filesystem.TempFile(dir, prefix))
+}
+
+func (fs *countingFS) Chroot(path string) (billy.Filesystem, error) {
+	chroot, err := fs.Filesystem.Chroot(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &countingFS{Filesystem: chroot, n: fs.n}, nil
+}
+
+func (fs *countingFS) wrap(f billy.File, err error) (billy.File, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return &countingFile{File: f, n: fs.n}, nil
+}
+
+type countingFile struct {
+	billy.File
+	n *uint64
+}
+
+func (f *countingFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	atomic.AddUint64(f.n, uint64(n))
+	return n, err
+}
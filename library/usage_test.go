@@ -0,0 +1,62 @@
+package library
+
+import (
+	"context"
+	"testing"
+
+	"github.com/src-d/go-borges"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+func TestDiskUsageJobFn(t *testing.T) {
+	var require = require.New(t)
+
+	var (
+		libFS  = memfs.New()
+		loc    = borges.LocationID("abcdef")
+		opts   = &DiskUsageOpts{FS: libFS, Bucket: 2}
+		called []borges.LocationID
+	)
+
+	siva := sivaPath(loc, opts.Bucket) + ".siva"
+	require.NoError(util.WriteFile(libFS, siva, make([]byte, 100), 0644))
+
+	fn := NewDiskUsageJobFn(opts, func(_ context.Context, job *Job) error {
+		tmp, err := job.TempFS.Chroot("clone")
+		if err != nil {
+			return err
+		}
+
+		err = util.WriteFile(tmp, "pack", make([]byte, 42), 0644)
+		if err != nil {
+			return err
+		}
+
+		job.WritesTo(loc)
+		job.LocationID = loc
+		return util.WriteFile(libFS, siva, make([]byte, 150), 0644)
+	})
+
+	job := &Job{
+		Type:       JobDownload,
+		TempFS:     memfs.New(),
+		OnLocation: func(id borges.LocationID) { called = append(called, id) },
+	}
+
+	temp := job.TempFS
+	require.NoError(fn(context.Background(), job))
+	require.Equal(&DiskUsage{Temp: 42, Final: 50}, job.DiskUsage)
+	require.Equal([]borges.LocationID{loc}, called)
+	require.Equal(temp, job.TempFS)
+
+	// updates know their location beforehand
+	job = &Job{Type: JobUpdate, LocationID: loc}
+	fn = NewDiskUsageJobFn(opts, func(context.Context, *Job) error {
+		return util.WriteFile(libFS, siva, make([]byte, 160), 0644)
+	})
+
+	require.NoError(fn(context.Background(), job))
+	require.Equal(&DiskUsage{Final: 10}, job.DiskUsage)
+}
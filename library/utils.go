@@ -30,5 +30,10 @@ func NewRepositoryID(endpoint string) (borges.RepositoryID, error) {
 // GetOrgFromEndpoint retrieve the organization from an endpoint.
 func GetOrgFromEndpoint(endpoint string) string {
 	id, _ := NewRepositoryID(endpoint)
-	return strings.Split(id.String(), "/")[1]
+	parts := strings.Split(id.String(), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+
+	return parts[1]
 }
@@ -0,0 +1,325 @@
+package metrics
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// Record holds the metrics of a repository processed by a Job.
+type Record struct {
+	// Run is the identifier of the campaign the Job was processed by, so
+	// the records of several campaigns can be compared.
+	Run string
+	// Job is the identifier of the Job.
+	Job string
+	// Kind is the kind of the Job, download or update.
+	Kind     string
+	Endpoint string
+	Location string
+	Success  bool
+	// Class is the category of the error of a failed Job, empty for the
+	// successful ones.
+	Class gitcollector.ErrorClass
+	// Code is the stable code of Class, zero for the successful Jobs.
+	Code gitcollector.ErrorCode
+	// Error is the message of the error of a failed Job. It's left empty
+	// when the Records are anonymized, as it may contain the endpoint.
+	Error string
+	// Duration is the time spent processing the Job.
+	Duration time.Duration
+	// TempBytes is the number of bytes written to the temporal filesystem.
+	TempBytes uint64
+	// SizeDelta is the growth in bytes of the location.
+	SizeDelta int64
+	Finished  time.Time
+}
+
+// RecordWriter writes the Records exported by an Exporter.
+type RecordWriter interface {
+	// Write writes a Record.
+	Write(*Record) error
+	// Close flushes the written Records.
+	Close() error
+}
+
+// CSVHeader is the header of the CSV files written by a CSVWriter.
+var CSVHeader = []string{
+	"run",
+	"job",
+	"kind",
+	"endpoint",
+	"location",
+	"success",
+	"class",
+	"duration_ms",
+	"temp_bytes",
+	"size_delta",
+	"finished",
+	"code",
+}
+
+// CSVWriter is a RecordWriter that writes the Records as CSV rows.
+type CSVWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+var _ RecordWriter = (*CSVWriter)(nil)
+
+// NewCSVWriter builds a new CSVWriter. The CSVHeader is written before the
+// first Record when header is true, set it to false to append to an existing
+// file.
+func NewCSVWriter(w io.Writer, header bool) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w), header: header}
+}
+
+// Write implements the RecordWriter interface. Every row is flushed so the
+// file is usable even if the process is killed.
+func (w *CSVWriter) Write(r *Record) error {
+	if w.header {
+		if err := w.w.Write(CSVHeader); err != nil {
+			return err
+		}
+
+		w.header = false
+	}
+
+	err := w.w.Write([]string{
+		r.Run,
+		r.Job,
+		r.Kind,
+		r.Endpoint,
+		r.Location,
+		strconv.FormatBool(r.Success),
+		string(r.Class),
+		strconv.FormatInt(int64(r.Duration/time.Millisecond), 10),
+		strconv.FormatUint(r.TempBytes, 10),
+		strconv.FormatInt(r.SizeDelta, 10),
+		r.Finished.UTC().Format(time.RFC3339),
+		csvCode(r.Code),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// csvCode leaves the code of the successful Records empty, as their class.
+func csvCode(code gitcollector.ErrorCode) string {
+	if code == gitcollector.ErrorCodeOK {
+		return ""
+	}
+
+	return strconv.Itoa(int(code))
+}
+
+// Close implements the RecordWriter interface.
+func (w *CSVWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// ExporterOpts represents configuration options for an Exporter.
+type ExporterOpts struct {
+	// Run is the identifier of the campaign set on every Record.
+	Run string
+	// Next is the gitcollector.MetricsCollector the metrics are also
+	// sent to, nil means none.
+	Next gitcollector.MetricsCollector
+	// Log is the logger used to report the write errors, default to
+	// log.New(nil).
+	Log log.Logger
+	// Anonymizer replaces the endpoints and locations of the Records with
+	// their hashes, nil keeps them.
+	Anonymizer *library.Anonymizer
+}
+
+// Exporter is an implementation of gitcollector.MetricsCollector that writes
+// a Record for every repository of the processed Jobs, so the campaigns can be
+// analyzed and compared without scraping the logs. The disk usage is only
+// exported for the Jobs it's measured for.
+type Exporter struct {
+	w    RecordWriter
+	opts *ExporterOpts
+
+	mu        sync.Mutex
+	latencies map[gitcollector.Job]time.Duration
+	now       func() time.Time
+}
+
+var (
+	_ gitcollector.ErrorMetricsCollector   = (*Exporter)(nil)
+	_ gitcollector.LatencyMetricsCollector = (*Exporter)(nil)
+)
+
+// NewExporter builds a new Exporter writing to the given RecordWriter.
+func NewExporter(w RecordWriter, opts *ExporterOpts) *Exporter {
+	if opts == nil {
+		opts = &ExporterOpts{}
+	}
+
+	if opts.Log == nil {
+		opts.Log = log.New(nil)
+	}
+
+	return &Exporter{
+		w:         w,
+		opts:      opts,
+		latencies: map[gitcollector.Job]time.Duration{},
+		now:       time.Now,
+	}
+}
+
+// Start implements the gitcollector.MetricsCollector interface.
+func (e *Exporter) Start() {
+	if e.opts.Next != nil {
+		e.opts.Next.Start()
+	}
+}
+
+// Stop implements the gitcollector.MetricsCollector interface. The
+// RecordWriter is closed once the next MetricsCollector is stopped.
+func (e *Exporter) Stop(immediate bool) {
+	if e.opts.Next != nil {
+		e.opts.Next.Stop(immediate)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.w.Close(); err != nil {
+		e.opts.Log.Errorf(err, "couldn't close metrics export")
+	}
+}
+
+// Success implements the gitcollector.MetricsCollector interface.
+func (e *Exporter) Success(job gitcollector.Job) {
+	e.export(job, nil)
+	if e.opts.Next != nil {
+		e.opts.Next.Success(job)
+	}
+}
+
+// Fail implements the gitcollector.MetricsCollector interface.
+func (e *Exporter) Fail(job gitcollector.Job) {
+	e.export(job, &gitcollector.JobFailure{
+		Class: gitcollector.ErrorClassUnknown,
+	})
+
+	if e.opts.Next != nil {
+		e.opts.Next.Fail(job)
+	}
+}
+
+// FailWithError implements the gitcollector.ErrorMetricsCollector interface.
+func (e *Exporter) FailWithError(
+	job gitcollector.Job,
+	failure *gitcollector.JobFailure,
+) {
+	e.export(job, failure)
+	if e.opts.Next == nil {
+		return
+	}
+
+	if mc, ok := e.opts.Next.(gitcollector.ErrorMetricsCollector); ok {
+		mc.FailWithError(job, failure)
+		return
+	}
+
+	e.opts.Next.Fail(job)
+}
+
+// Discover implements the gitcollector.MetricsCollector interface.
+func (e *Exporter) Discover(job gitcollector.Job) {
+	if e.opts.Next != nil {
+		e.opts.Next.Discover(job)
+	}
+}
+
+// Latency implements the gitcollector.LatencyMetricsCollector interface.
+func (e *Exporter) Latency(job gitcollector.Job, elapsed time.Duration) {
+	e.mu.Lock()
+	e.latencies[job] = elapsed
+	e.mu.Unlock()
+
+	if mc, ok := e.opts.Next.(gitcollector.LatencyMetricsCollector); ok {
+		mc.Latency(job, elapsed)
+	}
+}
+
+func (e *Exporter) export(
+	job gitcollector.Job,
+	failure *gitcollector.JobFailure,
+) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	elapsed, ok := e.latencies[job]
+	delete(e.latencies, job)
+	if !ok && failure != nil {
+		elapsed = failure.Elapsed
+	}
+
+	lj, ok := job.(*library.Job)
+	if !ok {
+		return
+	}
+
+	for _, r := range e.records(lj, elapsed, failure) {
+		if err := e.w.Write(r); err != nil {
+			e.opts.Log.With(log.Fields{
+				"job":      r.Job,
+				"endpoint": r.Endpoint,
+			}).Errorf(err, "couldn't export metrics")
+		}
+	}
+}
+
+// records builds a Record for every endpoint of the Job. The endpoints of an
+// update Job share its duration and disk usage.
+func (e *Exporter) records(
+	job *library.Job,
+	elapsed time.Duration,
+	failure *gitcollector.JobFailure,
+) []*Record {
+	finished := e.now()
+	records := make([]*Record, 0, len(job.Endpoints))
+	for _, ep := range job.Endpoints {
+		r := &Record{
+			Run:      e.opts.Run,
+			Job:      job.ID,
+			Kind:     JobKind(job),
+			Endpoint: e.opts.Anonymizer.Hash(ep),
+			Location: e.opts.Anonymizer.Hash(string(job.LocationID)),
+			Success:  failure == nil,
+			Duration: elapsed,
+			Finished: finished,
+		}
+
+		if failure != nil {
+			r.Class = failure.Class
+			r.Code = failure.Code
+			if failure.Err != nil && e.opts.Anonymizer == nil {
+				r.Error = failure.Err.Error()
+			}
+		}
+
+		if job.DiskUsage != nil {
+			r.TempBytes = job.DiskUsage.Temp
+			r.SizeDelta = job.DiskUsage.Final
+		}
+
+		records = append(records, r)
+	}
+
+	return records
+}
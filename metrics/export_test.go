@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporter(t *testing.T) {
+	var require = require.New(t)
+
+	var buf bytes.Buffer
+	exporter := NewExporter(
+		NewCSVWriter(&buf, true),
+		&ExporterOpts{Run: "run-1"},
+	)
+
+	finished := time.Date(2019, 10, 14, 12, 0, 0, 0, time.UTC)
+	exporter.now = func() time.Time { return finished }
+	go exporter.Start()
+
+	download := &library.Job{
+		ID:         "1",
+		Type:       library.JobDownload,
+		Endpoints:  []string{"https://github.com/a/a"},
+		LocationID: "loc-a",
+		DiskUsage:  &library.DiskUsage{Temp: 100, Final: 40},
+	}
+
+	exporter.Latency(download, 2*time.Second)
+	exporter.Success(download)
+
+	update := &library.Job{
+		ID:   "2",
+		Type: library.JobUpdate,
+		Endpoints: []string{
+			"https://github.com/b/b",
+			"https://github.com/c/b",
+		},
+		LocationID: "loc-b",
+	}
+
+	exporter.Latency(update, time.Second)
+	exporter.FailWithError(update, gitcollector.NewJobFailure(
+		fmt.Errorf("boom"), time.Second,
+	))
+
+	exporter.Stop(false)
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(err)
+	require.Equal([][]string{
+		CSVHeader,
+		{
+			"run-1", "1", "download", "https://github.com/a/a", "loc-a",
+			"true", "", "2000", "100", "40", "2019-10-14T12:00:00Z", "",
+		},
+		{
+			"run-1", "2", "update", "https://github.com/b/b", "loc-b",
+			"false", "unknown", "1000", "0", "0", "2019-10-14T12:00:00Z", "1",
+		},
+		{
+			"run-1", "2", "update", "https://github.com/c/b", "loc-b",
+			"false", "unknown", "1000", "0", "0", "2019-10-14T12:00:00Z", "1",
+		},
+	}, rows)
+	require.Empty(exporter.latencies)
+}
+
+func TestExporterNext(t *testing.T) {
+	var require = require.New(t)
+
+	next := NewCollector(&CollectorOpts{SyncTime: time.Hour})
+	exporter := NewExporter(
+		NewCSVWriter(&bytes.Buffer{}, false),
+		&ExporterOpts{Next: next},
+	)
+
+	go exporter.Start()
+
+	job := &library.Job{
+		Type:      library.JobDownload,
+		Endpoints: []string{"https://github.com/a/a"},
+	}
+
+	exporter.Discover(job)
+	exporter.Latency(job, time.Second)
+	exporter.FailWithError(job, gitcollector.NewJobFailure(
+		fmt.Errorf("boom"), time.Second,
+	))
+
+	exporter.Stop(false)
+
+	require.Equal(
+		map[gitcollector.ErrorClass]uint64{gitcollector.ErrorClassUnknown: 1},
+		next.FailuresByClass(),
+	)
+	require.Equal(1, next.Latencies()["download"].Count)
+}
+
+func TestExporterAnonymizer(t *testing.T) {
+	var require = require.New(t)
+
+	var buf bytes.Buffer
+	anonymizer := library.NewAnonymizer(&library.AnonymizerOpts{
+		Key: []byte("secret"),
+	})
+
+	exporter := NewExporter(
+		NewCSVWriter(&buf, false),
+		&ExporterOpts{Anonymizer: anonymizer},
+	)
+
+	go exporter.Start()
+	exporter.Success(&library.Job{
+		Type:       library.JobDownload,
+		Endpoints:  []string{"https://github.com/a/a"},
+		LocationID: "loc-a",
+	})
+	exporter.Stop(false)
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(err)
+	require.Len(rows, 1)
+	require.Equal(anonymizer.Hash("https://github.com/a/a"), rows[0][3])
+	require.Equal(anonymizer.Hash("loc-a"), rows[0][4])
+	require.NotContains(buf.String(), "github.com")
+}
@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SQLExecer runs the statements of a DBWriter, like a sql.DB.
+type SQLExecer interface {
+	ExecContext(
+		ctx context.Context,
+		query string,
+		args ...interface{},
+	) (sql.Result, error)
+	Close() error
+}
+
+var _ SQLExecer = (*sql.DB)(nil)
+
+// dbWriteTimeout is the time a Record can take to be inserted.
+const dbWriteTimeout = 30 * time.Second
+
+const (
+	// JobStatusSuccess is the status of the rows of the successful Jobs.
+	JobStatusSuccess = "success"
+	// JobStatusFailed is the status of the rows of the failed Jobs.
+	JobStatusFailed = "failed"
+)
+
+const (
+	createJobs = `CREATE TABLE IF NOT EXISTS %s (
+		run VARCHAR(64) NOT NULL DEFAULT '',
+		job VARCHAR(64) NOT NULL,
+		kind VARCHAR(16) NOT NULL,
+		endpoint TEXT NOT NULL,
+		location TEXT NOT NULL DEFAULT '',
+		status VARCHAR(16) NOT NULL,
+		class VARCHAR(32),
+		code INTEGER,
+		error TEXT,
+		started TIMESTAMP WITH TIME ZONE NOT NULL,
+		finished TIMESTAMP WITH TIME ZONE NOT NULL,
+		duration_ms BIGINT NOT NULL,
+		temp_bytes BIGINT NOT NULL DEFAULT 0,
+		size_delta BIGINT NOT NULL DEFAULT 0
+	)`
+
+	indexJobsEndpoint = `CREATE INDEX IF NOT EXISTS %[1]s_endpoint_idx
+	ON %[1]s (endpoint, finished)`
+
+	insertJob = `INSERT INTO %s(
+		run, job, kind, endpoint, location, status, class, code, error,
+		started, finished, duration_ms, temp_bytes, size_delta
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+)
+
+// PrepareJobsDB opens the postgres database of the given uri and creates the
+// table where a DBWriter inserts the Records if it doesn't exist yet.
+func PrepareJobsDB(uri string, table string) (*sql.DB, error) {
+	db, err := openDB(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := execAll(db, []string{
+		fmt.Sprintf(createJobs, table),
+		fmt.Sprintf(indexJobsEndpoint, table),
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// DBWriter is a RecordWriter that inserts a row for every Record into a table
+// of a postgres database prepared with PrepareJobsDB, so it holds the whole
+// history of what has been collected and it can be reported with SQL.
+type DBWriter struct {
+	db     SQLExecer
+	insert string
+}
+
+var _ RecordWriter = (*DBWriter)(nil)
+
+// NewDBWriter builds a new DBWriter inserting into the given table.
+func NewDBWriter(db SQLExecer, table string) *DBWriter {
+	return &DBWriter{db: db, insert: fmt.Sprintf(insertJob, table)}
+}
+
+// Write implements the RecordWriter interface. The class, code and error of
+// the successful Jobs are left NULL.
+func (w *DBWriter) Write(r *Record) error {
+	status := JobStatusSuccess
+	if !r.Success {
+		status = JobStatusFailed
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbWriteTimeout)
+	defer cancel()
+
+	_, err := w.db.ExecContext(ctx, w.insert,
+		r.Run,
+		r.Job,
+		r.Kind,
+		r.Endpoint,
+		r.Location,
+		status,
+		sql.NullString{String: string(r.Class), Valid: r.Class != ""},
+		sql.NullInt64{Int64: int64(r.Code), Valid: !r.Success},
+		sql.NullString{String: r.Error, Valid: r.Error != ""},
+		r.Finished.Add(-r.Duration).UTC(),
+		r.Finished.UTC(),
+		int64(r.Duration/time.Millisecond),
+		int64(r.TempBytes),
+		r.SizeDelta,
+	)
+
+	return err
+}
+
+// Close implements the RecordWriter interface.
+func (w *DBWriter) Close() error {
+	return w.db.Close()
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+	"github.com/stretchr/testify/require"
+)
+
+type testSQLExecer struct {
+	queries []string
+	args    [][]interface{}
+	closed  bool
+}
+
+func (db *testSQLExecer) ExecContext(
+	_ context.Context,
+	query string,
+	args ...interface{},
+) (sql.Result, error) {
+	db.queries = append(db.queries, query)
+	db.args = append(db.args, args)
+	return nil, nil
+}
+
+func (db *testSQLExecer) Close() error {
+	db.closed = true
+	return nil
+}
+
+func TestDBWriter(t *testing.T) {
+	var require = require.New(t)
+
+	db := &testSQLExecer{}
+	exporter := NewExporter(NewDBWriter(db, "jobs"), &ExporterOpts{
+		Run: "run-1",
+	})
+
+	finished := time.Date(2019, 10, 14, 12, 0, 0, 0, time.UTC)
+	exporter.now = func() time.Time { return finished }
+	go exporter.Start()
+
+	download := &library.Job{
+		ID:         "1",
+		Type:       library.JobDownload,
+		Endpoints:  []string{"https://github.com/a/a"},
+		LocationID: "loc-a",
+		DiskUsage:  &library.DiskUsage{Temp: 100, Final: 40},
+	}
+
+	exporter.Latency(download, 2*time.Second)
+	exporter.Success(download)
+
+	update := &library.Job{
+		ID:         "2",
+		Type:       library.JobUpdate,
+		Endpoints:  []string{"https://github.com/b/b"},
+		LocationID: "loc-b",
+	}
+
+	exporter.FailWithError(update, gitcollector.NewJobFailure(
+		fmt.Errorf("boom"), time.Second,
+	))
+
+	exporter.Stop(false)
+	require.True(db.closed)
+	require.Len(db.queries, 2)
+	require.Contains(db.queries[0], "INSERT INTO jobs(")
+
+	require.Equal([][]interface{}{
+		{
+			"run-1", "1", "download", "https://github.com/a/a", "loc-a",
+			JobStatusSuccess,
+			sql.NullString{}, sql.NullInt64{}, sql.NullString{},
+			finished.Add(-2 * time.Second), finished,
+			int64(2000), int64(100), int64(40),
+		},
+		{
+			"run-1", "2", "update", "https://github.com/b/b", "loc-b",
+			JobStatusFailed,
+			sql.NullString{String: "unknown", Valid: true},
+			sql.NullInt64{Int64: 1, Valid: true},
+			sql.NullString{String: "boom", Valid: true},
+			finished.Add(-time.Second), finished,
+			int64(1000), int64(0), int64(0),
+		},
+	}, db.args)
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaMessageWriter writes messages to a topic, like a kafka.Writer.
+type KafkaMessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+var _ KafkaMessageWriter = (*kafka.Writer)(nil)
+
+// kafkaWriteTimeout is the time a Record can take to be written.
+const kafkaWriteTimeout = 30 * time.Second
+
+// kafkaRecord is the JSON encoding of the Records written by a KafkaWriter,
+// using the names of the CSVHeader.
+type kafkaRecord struct {
+	Run        string    `json:"run,omitempty"`
+	Job        string    `json:"job"`
+	Kind       string    `json:"kind"`
+	Endpoint   string    `json:"endpoint"`
+	Location   string    `json:"location"`
+	Success    bool      `json:"success"`
+	Class      string    `json:"class,omitempty"`
+	Code       int       `json:"code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	TempBytes  uint64    `json:"temp_bytes"`
+	SizeDelta  int64     `json:"size_delta"`
+	Finished   time.Time `json:"finished"`
+}
+
+// KafkaWriter is a RecordWriter that publishes the Records as JSON messages
+// keyed by their endpoints, so the outcomes of a repository are kept in the
+// same partition.
+type KafkaWriter struct {
+	w KafkaMessageWriter
+}
+
+var _ RecordWriter = (*KafkaWriter)(nil)
+
+// NewKafkaWriter builds a new KafkaWriter publishing to the given writer.
+func NewKafkaWriter(w KafkaMessageWriter) *KafkaWriter {
+	return &KafkaWriter{w: w}
+}
+
+// Write implements the RecordWriter interface.
+func (w *KafkaWriter) Write(r *Record) error {
+	value, err := json.Marshal(&kafkaRecord{
+		Run:        r.Run,
+		Job:        r.Job,
+		Kind:       r.Kind,
+		Endpoint:   r.Endpoint,
+		Location:   r.Location,
+		Success:    r.Success,
+		Class:      string(r.Class),
+		Code:       int(r.Code),
+		Error:      r.Error,
+		DurationMS: int64(r.Duration / time.Millisecond),
+		TempBytes:  r.TempBytes,
+		SizeDelta:  r.SizeDelta,
+		Finished:   r.Finished.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), kafkaWriteTimeout,
+	)
+	defer cancel()
+
+	return w.w.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(r.Endpoint),
+		Value: value,
+		Time:  r.Finished,
+	})
+}
+
+// Close implements the RecordWriter interface.
+func (w *KafkaWriter) Close() error {
+	return w.w.Close()
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+	"github.com/stretchr/testify/require"
+)
+
+type testKafkaWriter struct {
+	messages []kafka.Message
+	closed   bool
+}
+
+func (w *testKafkaWriter) WriteMessages(
+	_ context.Context,
+	msgs ...kafka.Message,
+) error {
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *testKafkaWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestKafkaWriter(t *testing.T) {
+	var require = require.New(t)
+
+	w := &testKafkaWriter{}
+	exporter := NewExporter(NewKafkaWriter(w), &ExporterOpts{Run: "run-1"})
+
+	finished := time.Date(2019, 10, 14, 12, 0, 0, 0, time.UTC)
+	exporter.now = func() time.Time { return finished }
+	go exporter.Start()
+
+	download := &library.Job{
+		ID:         "1",
+		Type:       library.JobDownload,
+		Endpoints:  []string{"https://github.com/a/a"},
+		LocationID: "loc-a",
+		DiskUsage:  &library.DiskUsage{Temp: 100, Final: 40},
+	}
+
+	exporter.Latency(download, 2*time.Second)
+	exporter.Success(download)
+
+	update := &library.Job{
+		ID:         "2",
+		Type:       library.JobUpdate,
+		Endpoints:  []string{"https://github.com/b/b"},
+		LocationID: "loc-b",
+	}
+
+	exporter.FailWithError(update, gitcollector.NewJobFailure(
+		fmt.Errorf("boom"), time.Second,
+	))
+
+	exporter.Stop(false)
+	require.True(w.closed)
+	require.Len(w.messages, 2)
+
+	var records []map[string]interface{}
+	for _, msg := range w.messages {
+		var record map[string]interface{}
+		require.NoError(json.Unmarshal(msg.Value, &record))
+		require.Equal(record["endpoint"], string(msg.Key))
+		records = append(records, record)
+	}
+
+	require.Equal([]map[string]interface{}{
+		{
+			"run": "run-1", "job": "1", "kind": "download",
+			"endpoint": "https://github.com/a/a", "location": "loc-a",
+			"success": true, "duration_ms": 2000.0, "temp_bytes": 100.0,
+			"size_delta": 40.0, "finished": "2019-10-14T12:00:00Z",
+		},
+		{
+			"run": "run-1", "job": "2", "kind": "update",
+			"endpoint": "https://github.com/b/b", "location": "loc-b",
+			"success": false, "class": "unknown", "code": 1.0,
+			"error": "boom", "duration_ms": 1000.0, "temp_bytes": 0.0,
+			"size_delta": 0.0, "finished": "2019-10-14T12:00:00Z",
+		},
+	}, records)
+}
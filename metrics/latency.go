@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyOpts represents configuration options for a LatencyTracker.
+type LatencyOpts struct {
+	// Window is the period of time the percentiles are computed over.
+	Window time.Duration
+	// MaxSamples is the maximum number of samples kept by key, the oldest
+	// ones are discarded first.
+	MaxSamples int
+}
+
+const (
+	latencyWindow     = 10 * time.Minute
+	latencyMaxSamples = 10000
+)
+
+// Percentiles holds the latency percentiles over a window.
+type Percentiles struct {
+	Count int
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+type sample struct {
+	at      time.Time
+	elapsed time.Duration
+}
+
+// LatencyTracker keeps the latencies observed by key over a sliding window.
+type LatencyTracker struct {
+	mu      sync.Mutex
+	samples map[string][]sample
+	now     func() time.Time
+	opts    *LatencyOpts
+}
+
+// NewLatencyTracker builds a new LatencyTracker.
+func NewLatencyTracker(opts *LatencyOpts) *LatencyTracker {
+	if opts == nil {
+		opts = &LatencyOpts{}
+	}
+
+	if opts.Window <= 0 {
+		opts.Window = latencyWindow
+	}
+
+	if opts.MaxSamples <= 0 {
+		opts.MaxSamples = latencyMaxSamples
+	}
+
+	return &LatencyTracker{
+		samples: map[string][]sample{},
+		now:     time.Now,
+		opts:    opts,
+	}
+}
+
+// Observe registers a latency for the given key.
+func (t *LatencyTracker) Observe(key string, elapsed time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	samples := t.prune(key)
+	if len(samples) >= t.opts.MaxSamples {
+		samples = samples[len(samples)-t.opts.MaxSamples+1:]
+	}
+
+	t.samples[key] = append(samples, sample{at: t.now(), elapsed: elapsed})
+}
+
+// prune discards the samples out of the window. It must be called with the
+// lock held.
+func (t *LatencyTracker) prune(key string) []sample {
+	samples := t.samples[key]
+	since := t.now().Add(-t.opts.Window)
+
+	i := sort.Search(len(samples), func(i int) bool {
+		return !samples[i].at.Before(since)
+	})
+
+	samples = samples[i:]
+	t.samples[key] = samples
+	return samples
+}
+
+// Percentiles returns the percentiles of the latencies of the given key in
+// the current window.
+func (t *LatencyTracker) Percentiles(key string) Percentiles {
+	t.mu.Lock()
+	samples := t.prune(key)
+	elapsed := make([]time.Duration, len(samples))
+	for i, s := range samples {
+		elapsed[i] = s.elapsed
+	}
+	t.mu.Unlock()
+
+	if len(elapsed) == 0 {
+		return Percentiles{}
+	}
+
+	sort.Slice(elapsed, func(i, j int) bool { return elapsed[i] < elapsed[j] })
+	return Percentiles{
+		Count: len(elapsed),
+		P50:   percentile(elapsed, 50),
+		P90:   percentile(elapsed, 90),
+		P99:   percentile(elapsed, 99),
+		Max:   elapsed[len(elapsed)-1],
+	}
+}
+
+// Snapshot returns the percentiles of every key with samples in the current
+// window.
+func (t *LatencyTracker) Snapshot() map[string]Percentiles {
+	t.mu.Lock()
+	keys := make([]string, 0, len(t.samples))
+	for key := range t.samples {
+		keys = append(keys, key)
+	}
+	t.mu.Unlock()
+
+	res := make(map[string]Percentiles, len(keys))
+	for _, key := range keys {
+		if p := t.Percentiles(key); p.Count > 0 {
+			res[key] = p
+		}
+	}
+
+	return res
+}
+
+// percentile uses the nearest-rank method over the sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	var require = require.New(t)
+
+	now := time.Now()
+	tracker := NewLatencyTracker(&LatencyOpts{
+		Window:     time.Minute,
+		MaxSamples: 100,
+	})
+	tracker.now = func() time.Time { return now }
+
+	for i := 1; i <= 100; i++ {
+		tracker.Observe("download", time.Duration(i)*time.Second)
+	}
+
+	p := tracker.Percentiles("download")
+	require.Equal(100, p.Count)
+	require.Equal(50*time.Second, p.P50)
+	require.Equal(90*time.Second, p.P90)
+	require.Equal(99*time.Second, p.P99)
+	require.Equal(100*time.Second, p.Max)
+
+	// MaxSamples discards the oldest ones
+	tracker.Observe("download", time.Millisecond)
+	p = tracker.Percentiles("download")
+	require.Equal(100, p.Count)
+	require.Equal(100*time.Second, p.Max)
+
+	now = now.Add(30 * time.Second)
+	tracker.Observe("update", time.Second)
+	require.Len(tracker.Snapshot(), 2)
+
+	// samples out of the window are discarded
+	now = now.Add(45 * time.Second)
+	require.Equal(0, tracker.Percentiles("download").Count)
+
+	snapshot := tracker.Snapshot()
+	require.Len(snapshot, 1)
+	require.Equal(Percentiles{
+		Count: 1,
+		P50:   time.Second,
+		P90:   time.Second,
+		P99:   time.Second,
+		Max:   time.Second,
+	}, snapshot["update"])
+}
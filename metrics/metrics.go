@@ -20,6 +20,8 @@ type CollectorOpts struct {
 	SyncTime  time.Duration
 	Log       log.Logger
 	Send      SendFn
+	// Latency configures the tracking of the jobs latency percentiles.
+	Latency *LatencyOpts
 }
 
 // Collector is an implementation of gitcollector.MetricsCollector
@@ -30,18 +32,29 @@ type Collector struct {
 	success              chan gitcollector.Job
 	successDownloadCount uint64
 	successUpdateCount   uint64
+	noopUpdateCount      uint64
 
-	fail      chan gitcollector.Job
-	failCount uint64
+	fail         chan gitcollector.Job
+	failCount    uint64
+	failByClass  map[gitcollector.ErrorClass]uint64
+	failDuration time.Duration
 
 	discover      chan gitcollector.Job
 	discoverCount uint64
 
+	tempBytes  uint64
+	finalBytes int64
+
+	latency *LatencyTracker
+
 	wg     sync.WaitGroup
 	cancel chan bool
 }
 
-var _ gitcollector.MetricsCollector = (*Collector)(nil)
+var (
+	_ gitcollector.ErrorMetricsCollector   = (*Collector)(nil)
+	_ gitcollector.LatencyMetricsCollector = (*Collector)(nil)
+)
 
 const (
 	batchSize   = 10
@@ -82,9 +95,19 @@ func NewCollector(opts *CollectorOpts) *Collector {
 		fail:     make(chan gitcollector.Job, capacity),
 		discover: make(chan gitcollector.Job, capacity),
 		cancel:   make(chan bool),
+
+		failByClass: map[gitcollector.ErrorClass]uint64{},
+		latency:     NewLatencyTracker(opts.Latency),
 	}
 }
 
+// failedJob is sent through the fail channel when the failure details are
+// known.
+type failedJob struct {
+	gitcollector.Job
+	failure *gitcollector.JobFailure
+}
+
 const (
 	successKind = iota
 	failKind
@@ -144,6 +167,11 @@ func (c *Collector) Start() {
 		}
 
 		if j != nil {
+			var failure *gitcollector.JobFailure
+			if fj, ok := j.(*failedJob); ok {
+				j, failure = fj.Job, fj.failure
+			}
+
 			var ok bool
 			job, ok = j.(*library.Job)
 			if !ok {
@@ -151,7 +179,7 @@ func (c *Collector) Start() {
 				continue
 			}
 
-			if err := c.modifyMetrics(job, kind); err != nil {
+			if err := c.modifyMetrics(job, kind, failure); err != nil {
 				log.Warningf(err.Error())
 				continue
 			}
@@ -190,12 +218,37 @@ func (c *Collector) Start() {
 }
 
 func (c *Collector) logMetrics(debug bool) {
-	logger := c.logger.New(log.Fields{
+	fields := log.Fields{
 		"discover": c.discoverCount,
 		"download": c.successDownloadCount,
 		"update":   c.successUpdateCount,
 		"fail":     c.failCount,
-	})
+	}
+
+	if c.noopUpdateCount > 0 {
+		fields["noop_update"] = c.noopUpdateCount
+	}
+
+	for class, count := range c.failByClass {
+		fields["fail_"+string(class)] = count
+	}
+
+	if c.failDuration > 0 {
+		fields["fail_elapsed"] = c.failDuration.String()
+	}
+
+	if c.tempBytes > 0 || c.finalBytes != 0 {
+		fields["temp_bytes"] = c.tempBytes
+		fields["final_bytes"] = c.finalBytes
+	}
+
+	for kind, p := range c.latency.Snapshot() {
+		fields[kind+"_p50"] = p.P50.String()
+		fields[kind+"_p90"] = p.P90.String()
+		fields[kind+"_p99"] = p.P99.String()
+	}
+
+	logger := c.logger.New(fields)
 
 	msg := "metrics updated"
 	if debug {
@@ -217,7 +270,16 @@ func (c *Collector) close() {
 	c.cancel = nil
 }
 
-func (c *Collector) modifyMetrics(job *library.Job, kind int) error {
+func (c *Collector) modifyMetrics(
+	job *library.Job,
+	kind int,
+	failure *gitcollector.JobFailure,
+) error {
+	if kind != discoverKind && job.DiskUsage != nil {
+		c.tempBytes += job.DiskUsage.Temp
+		c.finalBytes += job.DiskUsage.Final
+	}
+
 	switch kind {
 	case successKind:
 		if job.Type == library.JobDownload {
@@ -228,9 +290,18 @@ func (c *Collector) modifyMetrics(job *library.Job, kind int) error {
 		for range job.Endpoints {
 			c.successUpdateCount++
 		}
+
+		c.noopUpdateCount += uint64(len(job.Unchanged))
 	case failKind:
+		class := gitcollector.ErrorClassUnknown
+		if failure != nil {
+			class = failure.Class
+			c.failDuration += failure.Elapsed
+		}
+
 		for range job.Endpoints {
 			c.failCount++
+			c.failByClass[class]++
 		}
 	case discoverKind:
 		if job.Type == library.JobDownload {
@@ -278,16 +349,85 @@ func (c *Collector) Fail(job gitcollector.Job) {
 	c.fail <- job
 }
 
+// FailWithError implements the gitcollector.ErrorMetricsCollector interface.
+func (c *Collector) FailWithError(
+	job gitcollector.Job,
+	failure *gitcollector.JobFailure,
+) {
+	c.fail <- &failedJob{Job: job, failure: failure}
+}
+
 // Discover implements the gitcollector.MetricsCollector interface.
 func (c *Collector) Discover(job gitcollector.Job) {
 	c.discover <- job
 }
 
+// Latency implements the gitcollector.LatencyMetricsCollector interface.
+func (c *Collector) Latency(job gitcollector.Job, elapsed time.Duration) {
+	c.latency.Observe(JobKind(job), elapsed)
+}
+
+// Latencies returns the latency percentiles by job kind, download or update,
+// over the configured window. It's safe to call it while the Collector is
+// running.
+func (c *Collector) Latencies() map[string]Percentiles {
+	return c.latency.Snapshot()
+}
+
+// JobKind returns the kind of the given Job the metrics are reported by,
+// download or update.
+func JobKind(job gitcollector.Job) string {
+	j, ok := job.(*library.Job)
+	if !ok {
+		return "unknown"
+	}
+
+	switch j.Type {
+	case library.JobDownload:
+		return "download"
+	case library.JobUpdate:
+		return "update"
+	default:
+		return fmt.Sprintf("type_%d", j.Type)
+	}
+}
+
+// FailuresByClass returns the number of failed endpoints for each
+// gitcollector.ErrorClass. It must not be called while the Collector is
+// running.
+func (c *Collector) FailuresByClass() map[gitcollector.ErrorClass]uint64 {
+	res := make(map[gitcollector.ErrorClass]uint64, len(c.failByClass))
+	for class, count := range c.failByClass {
+		res[class] = count
+	}
+
+	return res
+}
+
+// DiskUsage returns the bytes written to the temporal filesystem and the
+// growth of the library by the processed jobs. It must not be called while the
+// Collector is running.
+func (c *Collector) DiskUsage() (temp uint64, final int64) {
+	return c.tempBytes, c.finalBytes
+}
+
+// NoopUpdates returns the number of updated endpoints that weren't fetched
+// because their references didn't change. It must not be called while the
+// Collector is running.
+func (c *Collector) NoopUpdates() uint64 {
+	return c.noopUpdateCount
+}
+
 // CollectorByOrg plays as a reverse proxy Collector for several organizations.
 type CollectorByOrg struct {
 	orgMetrics map[string]*Collector
 }
 
+var (
+	_ gitcollector.ErrorMetricsCollector   = (*CollectorByOrg)(nil)
+	_ gitcollector.LatencyMetricsCollector = (*CollectorByOrg)(nil)
+)
+
 // NewCollectorByOrg builds a new CollectorByOrg.
 func NewCollectorByOrg(orgsMetrics map[string]*Collector) *CollectorByOrg {
 	return &CollectorByOrg{
@@ -335,6 +475,22 @@ func (c *CollectorByOrg) Fail(job gitcollector.Job) {
 	}
 }
 
+// FailWithError implements the gitcollector.ErrorMetricsCollector interface.
+func (c *CollectorByOrg) FailWithError(
+	job gitcollector.Job,
+	failure *gitcollector.JobFailure,
+) {
+	orgs := triageJob(job)
+	for org, job := range orgs {
+		m, ok := c.orgMetrics[org]
+		if !ok {
+			continue
+		}
+
+		m.FailWithError(job, failure)
+	}
+}
+
 // Discover implements the gitcollector.MetricsCollector interface.
 func (c *CollectorByOrg) Discover(job gitcollector.Job) {
 	orgs := triageJob(job)
@@ -365,3 +521,16 @@ func triageJob(job gitcollector.Job) map[string]*library.Job {
 
 	return organizations
 }
+
+// Latency implements the gitcollector.LatencyMetricsCollector interface.
+func (c *CollectorByOrg) Latency(job gitcollector.Job, elapsed time.Duration) {
+	orgs := triageJob(job)
+	for org, job := range orgs {
+		m, ok := c.orgMetrics[org]
+		if !ok {
+			continue
+		}
+
+		m.Latency(job, elapsed)
+	}
+}
@@ -14,15 +14,11 @@ import (
 // PrepareDB performs the necessary operations to send metrics to a postgres
 // database.
 func PrepareDB(uri string, table string, orgs []string) (*sql.DB, error) {
-	db, err := sql.Open("postgres", uri)
+	db, err := openDB(uri)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := db.Ping(); err != nil {
-		return nil, err
-	}
-
 	statements := []string{
 		fmt.Sprintf(create, table),
 		fmt.Sprintf(addColumns, table),
@@ -33,21 +29,23 @@ func PrepareDB(uri string, table string, orgs []string) (*sql.DB, error) {
 			fmt.Sprintf(insert, table, org))
 	}
 
-	tx, err := db.Begin()
-	if err != nil {
+	if err := execAll(db, statements); err != nil {
 		db.Close()
 		return nil, err
 	}
 
-	for _, s := range statements {
-		if _, err := tx.Exec(s); err != nil {
-			tx.Rollback()
-			db.Close()
-			return nil, err
-		}
+	return db, nil
+}
+
+// openDB opens the postgres database of the given uri, checking it can be
+// reached.
+func openDB(uri string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", uri)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := tx.Commit(); err != nil {
+	if err := db.Ping(); err != nil {
 		db.Close()
 		return nil, err
 	}
@@ -55,13 +53,32 @@ func PrepareDB(uri string, table string, orgs []string) (*sql.DB, error) {
 	return db, nil
 }
 
+// execAll runs the given statements in a transaction.
+func execAll(db *sql.DB, statements []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range statements {
+		if _, err := tx.Exec(s); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 const (
 	create = `CREATE TABLE IF NOT EXISTS %s (
 		org VARCHAR(50) NOT NULL,
 		discovered INTEGER NOT NULL,
 		downloaded INTEGER NOT NULL,
 		updated INTEGER NOT NULL,
-		failed INTEGER NOT NULL
+		failed INTEGER NOT NULL,
+		temp_bytes BIGINT NOT NULL DEFAULT 0,
+		final_bytes BIGINT NOT NULL DEFAULT 0
 	)`
 
 	insert = `INSERT INTO %[1]s(org, discovered, downloaded, updated, failed)
@@ -72,13 +89,17 @@ const (
 	ADD COLUMN IF NOT EXISTS discovered INTEGER,
 	ADD COLUMN IF NOT EXISTS downloaded INTEGER,
 	ADD COLUMN IF NOT EXISTS updated INTEGER,
-	ADD COLUMN IF NOT EXISTS failed INTEGER`
+	ADD COLUMN IF NOT EXISTS failed INTEGER,
+	ADD COLUMN IF NOT EXISTS temp_bytes BIGINT NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS final_bytes BIGINT NOT NULL DEFAULT 0`
 
 	update = `UPDATE %s
 	SET discovered = %d,
 	    downloaded = %d,
 	    updated = %d,
-	    failed = %d
+	    failed = %d,
+	    temp_bytes = %d,
+	    final_bytes = %d
 	WHERE org = '%s';`
 )
 
@@ -96,6 +117,8 @@ func SendToDB(db *sql.DB, table, org string) SendFn {
 			mc.successDownloadCount,
 			mc.successUpdateCount,
 			mc.failCount,
+			mc.tempBytes,
+			mc.finalBytes,
 			org,
 		)
 
@@ -0,0 +1,373 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// PrometheusOpts represents configuration options for a PrometheusCollector.
+type PrometheusOpts struct {
+	// Namespace prefixes the names of the metrics, default to
+	// gitcollector.
+	Namespace string
+	// Registerer registers the metrics, default to
+	// prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+	// Gatherer collects the metrics served at Addr, default to the
+	// Registerer if it's a prometheus.Gatherer too, or to
+	// prometheus.DefaultGatherer.
+	Gatherer prometheus.Gatherer
+	// Addr is the address the metrics are served at /metrics once the
+	// collector is started, empty means they aren't served.
+	Addr string
+	// Buckets are the upper bounds in seconds of the histograms of the
+	// processing time of the Jobs, default to 1s doubling up to 4.5h.
+	Buckets []float64
+	// APIUsage reports the github rate limit remaining of every
+	// provider, nil means it isn't exported.
+	APIUsage *gitcollector.APIUsage
+	// Anonymizer replaces the providers of the rate limits, which name
+	// their organizations, with their hashes, nil keeps them.
+	Anonymizer *library.Anonymizer
+	// Next is the gitcollector.MetricsCollector the metrics are also
+	// sent to, nil means none.
+	Next gitcollector.MetricsCollector
+	// Log is the logger used to report the failures serving the metrics,
+	// default to log.New(nil).
+	Log log.Logger
+}
+
+const prometheusNamespace = "gitcollector"
+
+var prometheusBuckets = prometheus.ExponentialBuckets(1, 2, 15)
+
+// PrometheusCollector is an implementation of gitcollector.MetricsCollector
+// that exports the metrics of the Jobs to Prometheus: the Jobs discovered,
+// succeeded and failed by kind, the histograms of their processing time and
+// the bytes and objects they fetched.
+// The depth of the queue and the utilization of the workers of the
+// gitcollector.WorkerPool given to WatchPool, and the rate limit remaining of
+// the APIUsage, are read on every scrape.
+type PrometheusCollector struct {
+	opts *PrometheusOpts
+
+	discovered *prometheus.CounterVec
+	succeeded  *prometheus.CounterVec
+	failed     *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	fetched    *prometheus.CounterVec
+	objects    *prometheus.CounterVec
+
+	queued    *prometheus.Desc
+	workers   *prometheus.Desc
+	busy      *prometheus.Desc
+	rateLimit *prometheus.Desc
+
+	mu   sync.Mutex
+	pool *gitcollector.WorkerPool
+
+	listener net.Listener
+	server   *http.Server
+}
+
+var (
+	_ gitcollector.ErrorMetricsCollector   = (*PrometheusCollector)(nil)
+	_ gitcollector.LatencyMetricsCollector = (*PrometheusCollector)(nil)
+	_ gitcollector.ResultMetricsCollector  = (*PrometheusCollector)(nil)
+	_ prometheus.Collector                 = (*PrometheusCollector)(nil)
+)
+
+// NewPrometheusCollector builds a new PrometheusCollector registering its
+// metrics. The address of the HTTP listener, if any, is listened on right
+// away so a wrong one is reported before the collection starts.
+func NewPrometheusCollector(
+	opts *PrometheusOpts,
+) (*PrometheusCollector, error) {
+	if opts == nil {
+		opts = &PrometheusOpts{}
+	}
+
+	if opts.Namespace == "" {
+		opts.Namespace = prometheusNamespace
+	}
+
+	if opts.Registerer == nil {
+		opts.Registerer = prometheus.DefaultRegisterer
+	}
+
+	if opts.Gatherer == nil {
+		if g, ok := opts.Registerer.(prometheus.Gatherer); ok {
+			opts.Gatherer = g
+		} else {
+			opts.Gatherer = prometheus.DefaultGatherer
+		}
+	}
+
+	if len(opts.Buckets) == 0 {
+		opts.Buckets = prometheusBuckets
+	}
+
+	if opts.Log == nil {
+		opts.Log = log.New(nil)
+	}
+
+	ns := opts.Namespace
+	c := &PrometheusCollector{
+		opts: opts,
+		discovered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "jobs_discovered_total",
+			Help:      "Jobs discovered by kind.",
+		}, []string{"kind"}),
+		succeeded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "jobs_succeeded_total",
+			Help:      "Jobs processed successfully by kind.",
+		}, []string{"kind"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "jobs_failed_total",
+			Help:      "Jobs failed by kind, class and code of error.",
+		}, []string{"kind", "class", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns,
+			Name:      "job_duration_seconds",
+			Help:      "Time spent processing the jobs by kind.",
+			Buckets:   opts.Buckets,
+		}, []string{"kind"}),
+		fetched: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "fetched_bytes_total",
+			Help:      "Bytes of the packfiles fetched by kind of job.",
+		}, []string{"kind"}),
+		objects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "packed_objects_total",
+			Help:      "Objects in the packfiles fetched by kind of job.",
+		}, []string{"kind"}),
+		queued: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, "", "queued_jobs"),
+			"Jobs scheduled waiting for a worker.",
+			nil, nil,
+		),
+		workers: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, "", "workers"),
+			"Workers in the pool.",
+			nil, nil,
+		),
+		busy: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, "", "workers_busy"),
+			"Workers processing a job.",
+			nil, nil,
+		),
+		rateLimit: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, "", "github_rate_limit_remaining"),
+			"Github API requests remaining by provider.",
+			[]string{"provider"}, nil,
+		),
+	}
+
+	for _, collector := range []prometheus.Collector{
+		c.discovered, c.succeeded, c.failed, c.duration,
+		c.fetched, c.objects, c,
+	} {
+		if err := opts.Registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Addr == "" {
+		return c, nil
+	}
+
+	listener, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(
+		opts.Gatherer, promhttp.HandlerOpts{},
+	))
+
+	c.listener = listener
+	c.server = &http.Server{Handler: mux}
+	return c, nil
+}
+
+// WatchPool sets the gitcollector.WorkerPool whose queue and workers are
+// reported. It's meant to be called once the pool is built, since the pool
+// takes the collector in its options.
+func (c *PrometheusCollector) WatchPool(wp *gitcollector.WorkerPool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pool = wp
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queued
+	ch <- c.workers
+	ch <- c.busy
+	ch <- c.rateLimit
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	wp := c.pool
+	c.mu.Unlock()
+
+	if wp != nil {
+		beats := wp.Heartbeats()
+		var busy int
+		for _, hb := range beats {
+			if hb.Busy {
+				busy++
+			}
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			c.queued, prometheus.GaugeValue, float64(wp.Queued()),
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.workers, prometheus.GaugeValue, float64(len(beats)),
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.busy, prometheus.GaugeValue, float64(busy),
+		)
+	}
+
+	for provider, remaining := range c.opts.APIUsage.RateLimits() {
+		ch <- prometheus.MustNewConstMetric(
+			c.rateLimit, prometheus.GaugeValue, float64(remaining),
+			c.opts.Anonymizer.Hash(provider),
+		)
+	}
+}
+
+// Start implements the gitcollector.MetricsCollector interface. The metrics
+// are served until the collector is stopped.
+func (c *PrometheusCollector) Start() {
+	if c.server != nil {
+		go func() {
+			err := c.server.Serve(c.listener)
+			if err != nil && err != http.ErrServerClosed {
+				c.opts.Log.Errorf(err, "couldn't serve the metrics")
+			}
+		}()
+	}
+
+	if c.opts.Next != nil {
+		c.opts.Next.Start()
+	}
+}
+
+// Stop implements the gitcollector.MetricsCollector interface. The HTTP
+// listener is closed once the next MetricsCollector is stopped.
+func (c *PrometheusCollector) Stop(immediate bool) {
+	if c.opts.Next != nil {
+		c.opts.Next.Stop(immediate)
+	}
+
+	if c.server != nil {
+		if err := c.server.Close(); err != nil {
+			c.opts.Log.Warningf("couldn't close the metrics listener: %s", err)
+		}
+	}
+}
+
+// Success implements the gitcollector.MetricsCollector interface.
+func (c *PrometheusCollector) Success(job gitcollector.Job) {
+	c.succeeded.WithLabelValues(JobKind(job)).Inc()
+	if c.opts.Next != nil {
+		c.opts.Next.Success(job)
+	}
+}
+
+// Fail implements the gitcollector.MetricsCollector interface.
+func (c *PrometheusCollector) Fail(job gitcollector.Job) {
+	c.failed.WithLabelValues(
+		JobKind(job),
+		string(gitcollector.ErrorClassUnknown),
+		strconv.Itoa(int(gitcollector.ErrorCodeUnknown)),
+	).Inc()
+
+	if c.opts.Next != nil {
+		c.opts.Next.Fail(job)
+	}
+}
+
+// FailWithError implements the gitcollector.ErrorMetricsCollector interface.
+func (c *PrometheusCollector) FailWithError(
+	job gitcollector.Job,
+	failure *gitcollector.JobFailure,
+) {
+	c.failed.WithLabelValues(
+		JobKind(job), string(failure.Class), strconv.Itoa(int(failure.Code)),
+	).Inc()
+	if c.opts.Next == nil {
+		return
+	}
+
+	if mc, ok := c.opts.Next.(gitcollector.ErrorMetricsCollector); ok {
+		mc.FailWithError(job, failure)
+		return
+	}
+
+	c.opts.Next.Fail(job)
+}
+
+// Discover implements the gitcollector.MetricsCollector interface.
+func (c *PrometheusCollector) Discover(job gitcollector.Job) {
+	c.discovered.WithLabelValues(JobKind(job)).Inc()
+	if c.opts.Next != nil {
+		c.opts.Next.Discover(job)
+	}
+}
+
+// Latency implements the gitcollector.LatencyMetricsCollector interface.
+func (c *PrometheusCollector) Latency(
+	job gitcollector.Job,
+	elapsed time.Duration,
+) {
+	c.duration.WithLabelValues(JobKind(job)).Observe(elapsed.Seconds())
+	if mc, ok := c.opts.Next.(gitcollector.LatencyMetricsCollector); ok {
+		mc.Latency(job, elapsed)
+	}
+}
+
+// Processed implements the gitcollector.ResultMetricsCollector interface. It's
+// called by the gitcollector.WorkerPool instead of Latency, Success and
+// FailWithError.
+func (c *PrometheusCollector) Processed(
+	job gitcollector.Job,
+	r *gitcollector.JobResult,
+) {
+	kind := JobKind(job)
+	c.duration.WithLabelValues(kind).Observe(r.Elapsed.Seconds())
+	c.fetched.WithLabelValues(kind).Add(float64(r.BytesFetched))
+	c.objects.WithLabelValues(kind).Add(float64(r.ObjectsPacked))
+	if f := r.Failure; f != nil {
+		c.failed.WithLabelValues(
+			kind, string(f.Class), strconv.Itoa(int(f.Code)),
+		).Inc()
+	} else {
+		c.succeeded.WithLabelValues(kind).Inc()
+	}
+
+	if c.opts.Next != nil {
+		gitcollector.AdaptMetricsCollector(c.opts.Next).Processed(job, r)
+	}
+}
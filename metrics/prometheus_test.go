@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusCollector(t *testing.T) {
+	var require = require.New(t)
+
+	usage := gitcollector.NewAPIUsage()
+	usage.RateLimitRemaining("github:src-d", 4000)
+
+	var buf bytes.Buffer
+	next := NewExporter(NewCSVWriter(&buf, false), nil)
+	reg := prometheus.NewRegistry()
+	c, err := NewPrometheusCollector(&PrometheusOpts{
+		Registerer: reg,
+		APIUsage:   usage,
+		Next:       next,
+	})
+	require.NoError(err)
+
+	wp := gitcollector.NewWorkerPool(
+		func(context.Context) (gitcollector.Job, error) {
+			return nil, gitcollector.ErrNewJobsNotFound.New()
+		},
+		&gitcollector.WorkerPoolOpts{Metrics: c},
+	)
+	wp.SetWorkers(3)
+	c.WatchPool(wp)
+
+	download := &library.Job{
+		Type:      library.JobDownload,
+		Endpoints: []string{"https://github.com/src-d/gitcollector"},
+	}
+	update := &library.Job{
+		Type:      library.JobUpdate,
+		Endpoints: []string{"https://github.com/src-d/go-borges"},
+	}
+
+	c.Discover(download)
+	c.Latency(download, 3*time.Second)
+	c.Success(download)
+	c.Latency(update, time.Second)
+	c.FailWithError(update, gitcollector.NewJobFailure(
+		context.DeadlineExceeded, time.Second,
+	))
+	c.Fail(update)
+
+	require.Equal(1.0, testutil.ToFloat64(c.discovered.WithLabelValues("download")))
+	require.Equal(1.0, testutil.ToFloat64(c.succeeded.WithLabelValues("download")))
+	require.Equal(1.0, testutil.ToFloat64(
+		c.failed.WithLabelValues("update", "timeout", "11"),
+	))
+	require.Equal(1.0, testutil.ToFloat64(
+		c.failed.WithLabelValues("update", "unknown", "1"),
+	))
+
+	families, err := reg.Gather()
+	require.NoError(err)
+
+	values := map[string]float64{}
+	for _, f := range families {
+		m := f.GetMetric()[0]
+		switch {
+		case m.GetGauge() != nil:
+			values[f.GetName()] = m.GetGauge().GetValue()
+		case m.GetHistogram() != nil:
+			values[f.GetName()] = float64(m.GetHistogram().GetSampleCount())
+		}
+	}
+
+	require.Equal(map[string]float64{
+		"gitcollector_job_duration_seconds":        1,
+		"gitcollector_queued_jobs":                 0,
+		"gitcollector_workers":                     3,
+		"gitcollector_workers_busy":                0,
+		"gitcollector_github_rate_limit_remaining": 4000,
+	}, values)
+
+	// the metrics are sent to the next collector too
+	wp.Close()
+	require.Equal(3, bytes.Count(buf.Bytes(), []byte("\n")))
+}
+
+func TestPrometheusCollectorProcessed(t *testing.T) {
+	var require = require.New(t)
+
+	var buf bytes.Buffer
+	next := NewExporter(NewCSVWriter(&buf, false), nil)
+	go next.Start()
+
+	c, err := NewPrometheusCollector(&PrometheusOpts{
+		Registerer: prometheus.NewRegistry(),
+		Next:       next,
+	})
+	require.NoError(err)
+
+	job := &library.Job{
+		Type:      library.JobDownload,
+		Endpoints: []string{"https://github.com/src-d/gitcollector"},
+		Transfer:  &library.Transfer{Packfiles: 1, Bytes: 2048, Objects: 30},
+	}
+
+	c.Processed(job, gitcollector.NewJobResult(job, nil, time.Second))
+	c.Processed(job, gitcollector.NewJobResult(
+		job, context.Canceled, time.Second,
+	))
+
+	require.Equal(4096.0, testutil.ToFloat64(c.fetched.WithLabelValues("download")))
+	require.Equal(60.0, testutil.ToFloat64(c.objects.WithLabelValues("download")))
+	require.Equal(1.0, testutil.ToFloat64(c.succeeded.WithLabelValues("download")))
+	require.Equal(1.0, testutil.ToFloat64(
+		c.failed.WithLabelValues("download", "canceled", "10"),
+	))
+
+	// the results are sent to the collectors not implementing Processed
+	next.Stop(false)
+	require.Equal(2, bytes.Count(buf.Bytes(), []byte("\n")))
+}
+
+func TestPrometheusCollectorListener(t *testing.T) {
+	var require = require.New(t)
+
+	c, err := NewPrometheusCollector(&PrometheusOpts{
+		Registerer: prometheus.NewRegistry(),
+		Addr:       "127.0.0.1:0",
+	})
+	require.NoError(err)
+
+	c.Start()
+	c.Success(&library.Job{Type: library.JobDownload})
+
+	res, err := http.Get("http://" + c.listener.Addr().String() + "/metrics")
+	require.NoError(err)
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(err)
+	require.Contains(
+		string(body),
+		`gitcollector_jobs_succeeded_total{kind="download"} 1`,
+	)
+
+	c.Stop(false)
+	_, err = http.Get("http://" + c.listener.Addr().String() + "/metrics")
+	require.Error(err)
+
+	_, err = NewPrometheusCollector(&PrometheusOpts{
+		Registerer: prometheus.NewRegistry(),
+		Addr:       "wrong address",
+	})
+	require.Error(err)
+}
@@ -0,0 +1,303 @@
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+var (
+	// ErrVerification is returned when a migrated location doesn't match
+	// its source.
+	ErrVerification = errors.NewKind("location %s verification failed: %s")
+)
+
+// CheckpointFile is the default file where the migrated locations are
+// recorded.
+const CheckpointFile = "gitcollector.migration"
+
+// Checkpoint records the locations already migrated so a migration can be
+// resumed.
+type Checkpoint struct {
+	mu   sync.Mutex
+	fs   billy.Filesystem
+	path string
+	done map[borges.LocationID]struct{}
+}
+
+// LoadCheckpoint loads the checkpoint stored in the given path.
+func LoadCheckpoint(fs billy.Filesystem, path string) (*Checkpoint, error) {
+	if path == "" {
+		path = CheckpointFile
+	}
+
+	cp := &Checkpoint{
+		fs:   fs,
+		path: path,
+		done: map[borges.LocationID]struct{}{},
+	}
+
+	f, err := fs.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cp, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		id := strings.TrimSpace(scanner.Text())
+		if id != "" {
+			cp.done[borges.LocationID(id)] = struct{}{}
+		}
+	}
+
+	return cp, scanner.Err()
+}
+
+// Done returns whether the location was already migrated.
+func (c *Checkpoint) Done(id borges.LocationID) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.done[id]
+	return ok
+}
+
+// Mark records the location as migrated.
+func (c *Checkpoint) Mark(id borges.LocationID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := c.fs.OpenFile(
+		c.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644,
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(f, string(id)+"\n"); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	c.done[id] = struct{}{}
+	return nil
+}
+
+// Opts represents configuration options for a migration.
+type Opts struct {
+	// Checkpoint keeps track of the migrated locations. If nil all the
+	// locations are migrated.
+	Checkpoint *Checkpoint
+	// Logger is the logger used, default to log.New(nil).
+	Logger log.Logger
+}
+
+// Stats holds the results of a migration.
+type Stats struct {
+	Migrated int
+	Skipped  int
+	Failed   int
+}
+
+// Migrate copies every location from the src Store into the dst Store. The
+// locations already recorded in the checkpoint are skipped and every migrated
+// location is verified before being recorded. A failed location doesn't stop
+// the migration.
+func Migrate(ctx context.Context, src, dst Store, opts *Opts) (*Stats, error) {
+	if opts == nil {
+		opts = &Opts{}
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(nil)
+	}
+
+	ids, err := src.Locations()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{}
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		if opts.Checkpoint != nil && opts.Checkpoint.Done(id) {
+			stats.Skipped++
+			continue
+		}
+
+		l := logger.New(log.Fields{"location": id})
+		start := time.Now()
+		if err := Location(ctx, src, dst, id); err != nil {
+			l.Errorf(err, "migration failed")
+			stats.Failed++
+			continue
+		}
+
+		if opts.Checkpoint != nil {
+			if err := opts.Checkpoint.Mark(id); err != nil {
+				return stats, err
+			}
+		}
+
+		stats.Migrated++
+		elapsed := time.Since(start).String()
+		l.With(log.Fields{"elapsed": elapsed}).Infof("migrated")
+	}
+
+	return stats, nil
+}
+
+// Location copies the objects, references and remotes of a location from the
+// src Store into the dst Store and verifies the result.
+func Location(ctx context.Context, src, dst Store, id borges.LocationID) error {
+	from, err := src.Read(id)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+
+	to, err := dst.Write(id)
+	if err != nil {
+		return err
+	}
+
+	hashes, err := copyLocation(ctx, from.R(), to.R())
+	if err == nil {
+		err = verify(id, from.R(), to.R(), hashes)
+	}
+
+	if err != nil {
+		to.Close()
+		return err
+	}
+
+	return to.Commit()
+}
+
+func copyLocation(
+	ctx context.Context,
+	from, to *git.Repository,
+) ([]plumbing.Hash, error) {
+	iter, err := from.Storer.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []plumbing.Hash
+	err = iter.ForEach(func(obj plumbing.EncodedObject) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		hashes = append(hashes, obj.Hash())
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(hashes) > 0 {
+		if err := copyObjects(from, to, hashes); err != nil {
+			return nil, err
+		}
+	}
+
+	refs, err := from.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		return to.Storer.SetReference(ref)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := from.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	dstCfg, err := to.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	dstCfg.Core.IsBare = true
+	for name, remote := range cfg.Remotes {
+		dstCfg.Remotes[name] = remote
+	}
+
+	return hashes, to.Storer.SetConfig(dstCfg)
+}
+
+func copyObjects(from, to *git.Repository, hashes []plumbing.Hash) error {
+	pr, pw := io.Pipe()
+	go func() {
+		enc := packfile.NewEncoder(pw, from.Storer, false)
+		_, err := enc.Encode(hashes, 10)
+		pw.CloseWithError(err)
+	}()
+
+	err := packfile.UpdateObjectStorage(to.Storer, pr)
+	pr.CloseWithError(err)
+	return err
+}
+
+func verify(
+	id borges.LocationID,
+	from, to *git.Repository,
+	hashes []plumbing.Hash,
+) error {
+	for _, h := range hashes {
+		if err := to.Storer.HasEncodedObject(h); err != nil {
+			return ErrVerification.New(id, "missing object "+h.String())
+		}
+	}
+
+	refs, err := from.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	return refs.ForEach(func(ref *plumbing.Reference) error {
+		got, err := to.Storer.Reference(ref.Name())
+		if err != nil {
+			return ErrVerification.Wrap(err, id, ref.Name())
+		}
+
+		if got.Hash() != ref.Hash() || got.Target() != ref.Target() {
+			return ErrVerification.New(id,
+				"reference mismatch "+ref.Name().String())
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,124 @@
+package migrate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func TestMigrate(t *testing.T) {
+	var require = require.New(t)
+
+	bareFS := memfs.New()
+	bare := NewBareStore(bareFS)
+	head := populate(t, bare, "loc1")
+
+	lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+		Transactional: true,
+		TempFS:        memfs.New(),
+	})
+	require.NoError(err)
+
+	sivaStore := NewSivaStore(lib)
+	cp, err := LoadCheckpoint(memfs.New(), "")
+	require.NoError(err)
+
+	ctx := context.Background()
+	stats, err := Migrate(ctx, bare, sivaStore, &Opts{Checkpoint: cp})
+	require.NoError(err)
+	require.Equal(&Stats{Migrated: 1}, stats)
+
+	// resumed migrations skip the migrated locations
+	stats, err = Migrate(ctx, bare, sivaStore, &Opts{Checkpoint: cp})
+	require.NoError(err)
+	require.Equal(&Stats{Skipped: 1}, stats)
+
+	ids, err := sivaStore.Locations()
+	require.NoError(err)
+	require.Equal([]borges.LocationID{"loc1"}, ids)
+
+	// and back to bare repositories
+	back := NewBareStore(memfs.New())
+	stats, err = Migrate(ctx, sivaStore, back, nil)
+	require.NoError(err)
+	require.Equal(&Stats{Migrated: 1}, stats)
+
+	repo, err := back.Read("loc1")
+	require.NoError(err)
+	defer repo.Close()
+
+	ref, err := repo.R().Reference("refs/remotes/foo/master", true)
+	require.NoError(err)
+	require.Equal(head, ref.Hash())
+
+	commit, err := repo.R().CommitObject(head)
+	require.NoError(err)
+	require.Equal("bar", commit.Message)
+
+	remote, err := repo.R().Remote("foo")
+	require.NoError(err)
+	require.Equal([]string{"https://github.com/foo/bar"},
+		remote.Config().URLs)
+}
+
+func populate(t *testing.T, store Store, id borges.LocationID) plumbing.Hash {
+	t.Helper()
+	var require = require.New(t)
+
+	wt := memfs.New()
+	src, err := git.Init(memoryStorage(t), wt)
+	require.NoError(err)
+
+	w, err := src.Worktree()
+	require.NoError(err)
+
+	var head plumbing.Hash
+	for _, content := range []string{"foo", "bar"} {
+		require.NoError(util.WriteFile(wt, "file", []byte(content), 0644))
+		_, err = w.Add("file")
+		require.NoError(err)
+
+		head, err = w.Commit(content, &git.CommitOptions{
+			Author: &object.Signature{
+				Name:  "foo",
+				Email: "foo@bar.com",
+				When:  time.Now(),
+			},
+		})
+		require.NoError(err)
+	}
+
+	_, err = src.CreateRemote(&config.RemoteConfig{
+		Name: "foo",
+		URLs: []string{"https://github.com/foo/bar"},
+	})
+	require.NoError(err)
+
+	require.NoError(src.Storer.SetReference(plumbing.NewHashReference(
+		"refs/remotes/foo/master", head,
+	)))
+
+	repo, err := store.Write(id)
+	require.NoError(err)
+
+	_, err = copyLocation(context.Background(), src, repo.R())
+	require.NoError(err)
+	require.NoError(repo.Commit())
+	return head
+}
+
+func memoryStorage(t *testing.T) *memory.Storage {
+	t.Helper()
+	return memory.NewStorage()
+}
@@ -0,0 +1,172 @@
+package migrate
+
+import (
+	"io"
+	"strings"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+// ErrLocationNotFound is returned when a location can't be found in a Store.
+var ErrLocationNotFound = errors.NewKind("location %s not found")
+
+// Repository is a repository of a Store opened to be read or written.
+type Repository interface {
+	// R returns the git.Repository.
+	R() *git.Repository
+	// Commit persists the write operations.
+	Commit() error
+	// Close releases the repository discarding uncommitted operations if
+	// the store is transactional.
+	Close() error
+}
+
+// Store represents a storage format holding locations, each of them a rooted
+// repository.
+type Store interface {
+	// Locations returns the ids of the stored locations.
+	Locations() ([]borges.LocationID, error)
+	// Read opens the repository of the given location to read.
+	Read(borges.LocationID) (Repository, error)
+	// Write opens the repository of the given location to write, creating
+	// it if it doesn't exist.
+	Write(borges.LocationID) (Repository, error)
+}
+
+// SivaStore is a Store for siva libraries.
+type SivaStore struct {
+	lib *siva.Library
+}
+
+var _ Store = (*SivaStore)(nil)
+
+// NewSivaStore builds a new SivaStore.
+func NewSivaStore(lib *siva.Library) *SivaStore {
+	return &SivaStore{lib: lib}
+}
+
+// Locations implements the Store interface.
+func (s *SivaStore) Locations() ([]borges.LocationID, error) {
+	iter, err := s.lib.Locations()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []borges.LocationID
+	err = iter.ForEach(func(l borges.Location) error {
+		ids = append(ids, l.ID())
+		return nil
+	})
+
+	return ids, err
+}
+
+// Read implements the Store interface.
+func (s *SivaStore) Read(id borges.LocationID) (Repository, error) {
+	loc, err := s.lib.Location(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return loc.Get("", borges.ReadOnlyMode)
+}
+
+// Write implements the Store interface.
+func (s *SivaStore) Write(id borges.LocationID) (Repository, error) {
+	loc, err := s.lib.AddLocation(id)
+	if err != nil {
+		if !siva.ErrLocationExists.Is(err) {
+			return nil, err
+		}
+
+		loc, err = s.lib.Location(id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return loc.Get("", borges.RWMode)
+}
+
+// BareStore is a Store keeping each location as a bare git repository named
+// <location id>.git in a filesystem.
+type BareStore struct {
+	fs billy.Filesystem
+}
+
+var _ Store = (*BareStore)(nil)
+
+// NewBareStore builds a new BareStore.
+func NewBareStore(fs billy.Filesystem) *BareStore {
+	return &BareStore{fs: fs}
+}
+
+const bareSuffix = ".git"
+
+// Locations implements the Store interface.
+func (s *BareStore) Locations() ([]borges.LocationID, error) {
+	files, err := s.fs.ReadDir("")
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []borges.LocationID
+	for _, f := range files {
+		if f.IsDir() && strings.HasSuffix(f.Name(), bareSuffix) {
+			ids = append(ids, borges.LocationID(
+				strings.TrimSuffix(f.Name(), bareSuffix),
+			))
+		}
+	}
+
+	return ids, nil
+}
+
+// Read implements the Store interface.
+func (s *BareStore) Read(id borges.LocationID) (Repository, error) {
+	path := string(id) + bareSuffix
+	if _, err := s.fs.Stat(path); err != nil {
+		return nil, ErrLocationNotFound.Wrap(err, id)
+	}
+
+	return s.open(path, false)
+}
+
+// Write implements the Store interface.
+func (s *BareStore) Write(id borges.LocationID) (Repository, error) {
+	return s.open(string(id)+bareSuffix, true)
+}
+
+func (s *BareStore) open(path string, create bool) (Repository, error) {
+	fs, err := s.fs.Chroot(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	repo, err := git.Open(sto, nil)
+	if err == git.ErrRepositoryNotExists && create {
+		repo, err = git.Init(sto, nil)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &bareRepository{repo: repo, closer: sto}, nil
+}
+
+type bareRepository struct {
+	repo   *git.Repository
+	closer io.Closer
+}
+
+func (r *bareRepository) R() *git.Repository { return r.repo }
+func (r *bareRepository) Commit() error      { return r.closer.Close() }
+func (r *bareRepository) Close() error       { return r.closer.Close() }
@@ -0,0 +1,307 @@
+// Package objstore stores objects in buckets of object storage, like S3 or
+// GCS, through multipart uploads whose parts are sent as they're written, so
+// objects of any size are stored without being kept whole anywhere.
+package objstore
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrObjectNotFound is returned when the requested object isn't in
+	// the bucket.
+	ErrObjectNotFound = errors.NewKind("object not found: %s")
+	// ErrUploadNotFound is returned when the multipart upload doesn't
+	// exist anymore, it was completed or aborted.
+	ErrUploadNotFound = errors.NewKind("upload %s of %s not found")
+	// ErrWrongPart is returned when a multipart upload is completed with
+	// parts it doesn't have.
+	ErrWrongPart = errors.NewKind("wrong part %d of upload %s")
+)
+
+// Part is a part uploaded to a multipart upload.
+type Part struct {
+	Number int    `json:"number"`
+	Size   int64  `json:"size"`
+	ETag   string `json:"etag"`
+	// MD5 is the hex digest of the content of the part, it tells whether
+	// the part written again to a resumed Upload is the same.
+	MD5 string `json:"md5,omitempty"`
+}
+
+// Bucket is a bucket of object storage supporting multipart uploads. The
+// parts are numbered from 1, and uploading a part with the number of another
+// one replaces it.
+type Bucket interface {
+	// Create starts a multipart upload of the given key, returning its ID.
+	Create(ctx context.Context, key string) (string, error)
+	// UploadPart uploads a part to the given multipart upload.
+	UploadPart(
+		ctx context.Context,
+		key, id string,
+		number int,
+		data []byte,
+	) (Part, error)
+	// Parts returns the parts uploaded to the given multipart upload
+	// sorted by number, or ErrUploadNotFound.
+	Parts(ctx context.Context, key, id string) ([]Part, error)
+	// Complete stores the given parts of the multipart upload as the
+	// object of its key, in order.
+	Complete(ctx context.Context, key, id string, parts []Part) error
+	// Abort removes the multipart upload along with its parts.
+	Abort(ctx context.Context, key, id string) error
+	// Put stores a small object whole.
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns the object of the given key, or ErrObjectNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// uploadsDir is the directory of an FSBucket where the parts of its
+// multipart uploads are kept until they're completed.
+const uploadsDir = ".uploads"
+
+// FSBucket is a Bucket storing the objects as files of a billy.Filesystem,
+// like a local directory.
+type FSBucket struct {
+	fs billy.Filesystem
+}
+
+var _ Bucket = (*FSBucket)(nil)
+
+// NewFSBucket builds a new FSBucket on the given filesystem.
+func NewFSBucket(fs billy.Filesystem) *FSBucket {
+	return &FSBucket{fs: fs}
+}
+
+// Create implements the Bucket interface.
+func (b *FSBucket) Create(_ context.Context, key string) (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+
+	upload := hex.EncodeToString(id[:])
+	if err := b.fs.MkdirAll(b.upload(upload), 0755); err != nil {
+		return "", err
+	}
+
+	return upload, nil
+}
+
+// UploadPart implements the Bucket interface.
+func (b *FSBucket) UploadPart(
+	_ context.Context,
+	key, id string,
+	number int,
+	data []byte,
+) (Part, error) {
+	if _, err := b.fs.Stat(b.upload(id)); err != nil {
+		return Part{}, ErrUploadNotFound.New(id, key)
+	}
+
+	name := path.Join(b.upload(id), strconv.Itoa(number))
+	if err := write(b.fs, name, data); err != nil {
+		return Part{}, err
+	}
+
+	sum := md5.Sum(data)
+	return Part{
+		Number: number,
+		Size:   int64(len(data)),
+		ETag:   hex.EncodeToString(sum[:]),
+		MD5:    hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// Parts implements the Bucket interface.
+func (b *FSBucket) Parts(_ context.Context, key, id string) ([]Part, error) {
+	if _, err := b.fs.Stat(b.upload(id)); err != nil {
+		return nil, ErrUploadNotFound.New(id, key)
+	}
+
+	files, err := b.fs.ReadDir(b.upload(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []Part
+	for _, f := range files {
+		number, err := strconv.Atoi(f.Name())
+		if err != nil {
+			// a part being written.
+			continue
+		}
+
+		part, err := b.fs.Open(path.Join(b.upload(id), f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := readAll(part)
+		if err != nil {
+			return nil, err
+		}
+
+		sum := md5.Sum(data)
+		parts = append(parts, Part{
+			Number: number,
+			Size:   int64(len(data)),
+			ETag:   hex.EncodeToString(sum[:]),
+			MD5:    hex.EncodeToString(sum[:]),
+		})
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].Number < parts[j].Number
+	})
+
+	return parts, nil
+}
+
+// Complete implements the Bucket interface.
+func (b *FSBucket) Complete(
+	ctx context.Context,
+	key, id string,
+	parts []Part,
+) error {
+	uploaded, err := b.Parts(ctx, key, id)
+	if err != nil {
+		return err
+	}
+
+	etags := make(map[int]string, len(uploaded))
+	for _, p := range uploaded {
+		etags[p.Number] = p.ETag
+	}
+
+	for _, p := range parts {
+		if etag, ok := etags[p.Number]; !ok || etag != p.ETag {
+			return ErrWrongPart.New(p.Number, id)
+		}
+	}
+
+	if err := b.fs.MkdirAll(path.Dir(key), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := util.TempFile(b.fs, path.Dir(key), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	for _, p := range parts {
+		if err = b.copyPart(tmp, id, p.Number); err != nil {
+			break
+		}
+	}
+
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = b.fs.Rename(tmp.Name(), key)
+	}
+
+	if err != nil {
+		b.fs.Remove(tmp.Name())
+		return err
+	}
+
+	return util.RemoveAll(b.fs, b.upload(id))
+}
+
+func (b *FSBucket) copyPart(w io.Writer, id string, number int) error {
+	f, err := b.fs.Open(path.Join(b.upload(id), strconv.Itoa(number)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Abort implements the Bucket interface.
+func (b *FSBucket) Abort(_ context.Context, key, id string) error {
+	if _, err := b.fs.Stat(b.upload(id)); err != nil {
+		return ErrUploadNotFound.New(id, key)
+	}
+
+	return util.RemoveAll(b.fs, b.upload(id))
+}
+
+// Put implements the Bucket interface.
+func (b *FSBucket) Put(_ context.Context, key string, data []byte) error {
+	return write(b.fs, key, data)
+}
+
+// Get implements the Bucket interface.
+func (b *FSBucket) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	if strings.HasPrefix(key, uploadsDir+"/") {
+		return nil, ErrObjectNotFound.New(key)
+	}
+
+	f, err := b.fs.Open(key)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrObjectNotFound.New(key)
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (b *FSBucket) upload(id string) string {
+	return path.Join(uploadsDir, id)
+}
+
+// write writes the file through a temporary one renamed over it, so it's
+// never seen partially written.
+func write(fs billy.Filesystem, name string, data []byte) error {
+	if err := fs.MkdirAll(path.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := util.TempFile(fs, path.Dir(name), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = fs.Rename(tmp.Name(), name)
+	}
+
+	if err != nil {
+		fs.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+// readAll reads and closes the given object.
+func readAll(rc io.ReadCloser) ([]byte, error) {
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
@@ -0,0 +1,77 @@
+package objstore
+
+import (
+	"context"
+	"testing"
+
+	"gopkg.in/src-d/go-billy.v4/memfs"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFSBucket(t *testing.T) {
+	var require = require.New(t)
+	ctx := context.Background()
+
+	fs := memfs.New()
+	b := NewFSBucket(fs)
+
+	id, err := b.Create(ctx, "foo/bar")
+	require.NoError(err)
+
+	p2, err := b.UploadPart(ctx, "foo/bar", id, 2, []byte("world"))
+	require.NoError(err)
+	_, err = b.UploadPart(ctx, "foo/bar", id, 1, []byte("bye "))
+	require.NoError(err)
+
+	// uploading a part again replaces it.
+	p1, err := b.UploadPart(ctx, "foo/bar", id, 1, []byte("hello "))
+	require.NoError(err)
+	require.Equal(Part{
+		Number: 1,
+		Size:   6,
+		ETag:   "f814893777bcc2295fff05f00e508da6",
+		MD5:    "f814893777bcc2295fff05f00e508da6",
+	}, p1)
+
+	parts, err := b.Parts(ctx, "foo/bar", id)
+	require.NoError(err)
+	require.Equal([]Part{p1, p2}, parts)
+
+	_, err = b.Get(ctx, "foo/bar")
+	require.True(ErrObjectNotFound.Is(err))
+
+	err = b.Complete(ctx, "foo/bar", id, []Part{p1, {Number: 3}})
+	require.True(ErrWrongPart.Is(err))
+
+	require.NoError(b.Complete(ctx, "foo/bar", id, []Part{p1, p2}))
+	require.Equal("hello world", get(t, b, "foo/bar"))
+
+	// the upload is gone once completed.
+	_, err = b.Parts(ctx, "foo/bar", id)
+	require.True(ErrUploadNotFound.Is(err))
+	_, err = b.UploadPart(ctx, "foo/bar", id, 3, []byte("!"))
+	require.True(ErrUploadNotFound.Is(err))
+
+	id, err = b.Create(ctx, "foo/baz")
+	require.NoError(err)
+	require.NoError(b.Abort(ctx, "foo/baz", id))
+	require.True(ErrUploadNotFound.Is(b.Abort(ctx, "foo/baz", id)))
+
+	files, err := fs.ReadDir(uploadsDir)
+	require.NoError(err)
+	require.Len(files, 0)
+
+	require.NoError(b.Put(ctx, "foo/qux", []byte("qux")))
+	require.Equal("qux", get(t, b, "foo/qux"))
+}
+
+func get(t *testing.T, b Bucket, key string) string {
+	t.Helper()
+
+	rc, err := b.Get(context.Background(), key)
+	require.NoError(t, err)
+	data, err := readAll(rc)
+	require.NoError(t, err)
+	return string(data)
+}
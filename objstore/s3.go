@@ -0,0 +1,451 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrRequest is returned when a request to the object storage fails.
+var ErrRequest = errors.NewKind("%s %s: %d %s")
+
+// S3Opts represents configuration options for an S3Bucket.
+type S3Opts struct {
+	// Endpoint is the URL of the S3 API, default to the endpoint of AWS
+	// in the Region. Other implementations of the API can be used, like
+	// https://storage.googleapis.com for GCS with HMAC keys.
+	Endpoint string
+	// Bucket is the name of the bucket.
+	Bucket string
+	// Region is the region of the bucket, default to us-east-1.
+	Region string
+	// AccessKey and SecretKey are the credentials the requests are signed
+	// with.
+	AccessKey string
+	SecretKey string
+	// Client makes the requests, default to http.DefaultClient.
+	Client *http.Client
+}
+
+const (
+	s3Region  = "us-east-1"
+	s3Service = "s3"
+	// amzDate is the format of the time the requests are signed at.
+	amzDate = "20060102T150405Z"
+	// maxErrorBody is the size read from the body of a failed request to
+	// report its error.
+	maxErrorBody = 64 << 10
+)
+
+// S3Bucket is a Bucket of the S3 API, using path-style URLs and requests
+// signed with AWS Signature Version 4, so it works with AWS, GCS through its
+// interoperability API and other compatible storages like MinIO.
+type S3Bucket struct {
+	opts     *S3Opts
+	endpoint *url.URL
+	signer   *signer
+}
+
+var _ Bucket = (*S3Bucket)(nil)
+
+// NewS3Bucket builds a new S3Bucket.
+func NewS3Bucket(opts *S3Opts) (*S3Bucket, error) {
+	o := &S3Opts{}
+	if opts != nil {
+		*o = *opts
+	}
+
+	if o.Region == "" {
+		o.Region = s3Region
+	}
+
+	if o.Endpoint == "" {
+		o.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", o.Region)
+	}
+
+	if o.Client == nil {
+		o.Client = http.DefaultClient
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(o.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Bucket{
+		opts:     o,
+		endpoint: endpoint,
+		signer: &signer{
+			accessKey: o.AccessKey,
+			secretKey: o.SecretKey,
+			region:    o.Region,
+			service:   s3Service,
+		},
+	}, nil
+}
+
+type initiateResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type listPartsResult struct {
+	IsTruncated          bool
+	NextPartNumberMarker int
+	Parts                []struct {
+		PartNumber int
+		ETag       string
+		Size       int64
+	} `xml:"Part"`
+}
+
+type completeUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string
+}
+
+// Create implements the Bucket interface.
+func (b *S3Bucket) Create(ctx context.Context, key string) (string, error) {
+	var res initiateResult
+	err := b.do(ctx, "POST", key, url.Values{"uploads": {""}}, nil, &res)
+	if err != nil {
+		return "", err
+	}
+
+	return res.UploadID, nil
+}
+
+// UploadPart implements the Bucket interface.
+func (b *S3Bucket) UploadPart(
+	ctx context.Context,
+	key, id string,
+	number int,
+	data []byte,
+) (Part, error) {
+	query := url.Values{
+		"partNumber": {strconv.Itoa(number)},
+		"uploadId":   {id},
+	}
+
+	res, err := b.request(ctx, "PUT", key, query, data)
+	if err != nil {
+		return Part{}, err
+	}
+	res.Body.Close()
+
+	sum := md5.Sum(data)
+	return Part{
+		Number: number,
+		Size:   int64(len(data)),
+		ETag:   res.Header.Get("ETag"),
+		MD5:    hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// Parts implements the Bucket interface.
+func (b *S3Bucket) Parts(ctx context.Context, key, id string) ([]Part, error) {
+	var parts []Part
+	var marker int
+	for {
+		query := url.Values{"uploadId": {id}}
+		if marker > 0 {
+			query.Set("part-number-marker", strconv.Itoa(marker))
+		}
+
+		var res listPartsResult
+		if err := b.do(ctx, "GET", key, query, nil, &res); err != nil {
+			return nil, err
+		}
+
+		for _, p := range res.Parts {
+			parts = append(parts, Part{
+				Number: p.PartNumber,
+				Size:   p.Size,
+				ETag:   p.ETag,
+			})
+		}
+
+		if !res.IsTruncated || res.NextPartNumberMarker <= marker {
+			return parts, nil
+		}
+
+		marker = res.NextPartNumberMarker
+	}
+}
+
+// Complete implements the Bucket interface.
+func (b *S3Bucket) Complete(
+	ctx context.Context,
+	key, id string,
+	parts []Part,
+) error {
+	var body completeUpload
+	for _, p := range parts {
+		body.Parts = append(body.Parts, struct {
+			PartNumber int
+			ETag       string
+		}{p.Number, p.ETag})
+	}
+
+	data, err := xml.Marshal(&body)
+	if err != nil {
+		return err
+	}
+
+	// the completion can fail after the response started, with an error
+	// in its body.
+	var res struct {
+		XMLName xml.Name
+		Code    string
+	}
+
+	query := url.Values{"uploadId": {id}}
+	if err := b.do(ctx, "POST", key, query, data, &res); err != nil {
+		return err
+	}
+
+	if res.XMLName.Local == "Error" {
+		return ErrRequest.New("POST", key, http.StatusOK, res.Code)
+	}
+
+	return nil
+}
+
+// Abort implements the Bucket interface.
+func (b *S3Bucket) Abort(ctx context.Context, key, id string) error {
+	return b.do(ctx, "DELETE", key, url.Values{"uploadId": {id}}, nil, nil)
+}
+
+// Put implements the Bucket interface.
+func (b *S3Bucket) Put(ctx context.Context, key string, data []byte) error {
+	return b.do(ctx, "PUT", key, nil, data, nil)
+}
+
+// Get implements the Bucket interface.
+func (b *S3Bucket) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	res, err := b.request(ctx, "GET", key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// do makes the request decoding the XML body of its response into v, unless
+// it's nil.
+func (b *S3Bucket) do(
+	ctx context.Context,
+	method, key string,
+	query url.Values,
+	body []byte,
+	v interface{},
+) error {
+	res, err := b.request(ctx, method, key, query, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if v == nil {
+		_, err = io.Copy(ioutil.Discard, res.Body)
+		return err
+	}
+
+	return xml.NewDecoder(res.Body).Decode(v)
+}
+
+// request makes a signed request, returning ErrObjectNotFound,
+// ErrUploadNotFound or ErrRequest if it didn't succeed.
+func (b *S3Bucket) request(
+	ctx context.Context,
+	method, key string,
+	query url.Values,
+	body []byte,
+) (*http.Response, error) {
+	u := *b.endpoint
+	u.Path = u.Path + "/" + b.opts.Bucket + "/" + key
+	u.RawPath = escapePath(u.Path)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	req.ContentLength = int64(len(body))
+	if body != nil {
+		sum := md5.Sum(body)
+		req.Header.Set("Content-MD5",
+			base64.StdEncoding.EncodeToString(sum[:]))
+	}
+
+	payload := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+	b.signer.sign(req, hex.EncodeToString(payload[:]), time.Now())
+
+	res, err := b.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+
+	defer res.Body.Close()
+	code := http.StatusText(res.StatusCode)
+	var e s3Error
+	data, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+		code = e.Code
+	}
+
+	switch code {
+	case "NoSuchKey":
+		return nil, ErrObjectNotFound.New(key)
+	case "NoSuchUpload":
+		return nil, ErrUploadNotFound.New(query.Get("uploadId"), key)
+	default:
+		return nil, ErrRequest.New(method, key, res.StatusCode, code)
+	}
+}
+
+// signer signs the requests with AWS Signature Version 4.
+type signer struct {
+	accessKey string
+	secretKey string
+	region    string
+	service   string
+}
+
+// sign signs the request made at the given time with the hex digest of its
+// payload, along with its host and all its headers.
+func (s *signer) sign(req *http.Request, payload string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(amzDate))
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(
+			strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signed := strings.Join(names, ";")
+	request := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonical.String(),
+		signed,
+		payload,
+	}, "\n")
+
+	date := now.Format("20060102")
+	scope := strings.Join(
+		[]string{date, s.region, s.service, "aws4_request"}, "/")
+	hash := sha256.Sum256([]byte(request))
+	toSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format(amzDate),
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{date, s.region, s.service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signed,
+		hex.EncodeToString(hmacSHA256(key, toSign)),
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes the query sorted by key as the signature expects
+// it, which the query of the request must match.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var params []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			params = append(params, escape(k, true)+"="+escape(v, true))
+		}
+	}
+
+	return strings.Join(params, "&")
+}
+
+func escapePath(p string) string {
+	return escape(p, false)
+}
+
+// escape percent-encodes everything but the unreserved characters, and the
+// slashes unless asked to.
+func escape(s string, slash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !slash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,266 @@
+package objstore
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4/memfs"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigner(t *testing.T) {
+	var require = require.New(t)
+
+	// the get-vanilla case of the AWS Signature Version 4 test suite.
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	require.NoError(err)
+
+	s := &signer{
+		accessKey: "AKIDEXAMPLE",
+		secretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		region:    "us-east-1",
+		service:   "service",
+	}
+
+	payload := sha256.Sum256(nil)
+	now, err := time.Parse(amzDate, "20150830T123600Z")
+	require.NoError(err)
+	s.sign(req, hex.EncodeToString(payload[:]), now)
+
+	require.Equal("20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	require.Equal("AWS4-HMAC-SHA256 "+
+		"Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, "+
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestEscape(t *testing.T) {
+	var require = require.New(t)
+
+	require.Equal("foo/bar%20baz~-_.%2B", escape("foo/bar baz~-_.+", false))
+	require.Equal("foo%2Fbar", escape("foo/bar", true))
+	require.Equal("partNumber=1&uploadId=a%2Fb&uploads=", canonicalQuery(
+		map[string][]string{
+			"uploads":    {""},
+			"uploadId":   {"a/b"},
+			"partNumber": {"1"},
+		},
+	))
+}
+
+func TestS3Bucket(t *testing.T) {
+	var require = require.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(&fakeS3{t: t, b: NewFSBucket(memfs.New())})
+	defer server.Close()
+
+	b, err := NewS3Bucket(&S3Opts{
+		Endpoint:  server.URL,
+		Bucket:    "packs",
+		AccessKey: "foo",
+		SecretKey: "bar",
+	})
+	require.NoError(err)
+
+	u, err := NewUpload(ctx, b, "github.com/foo/bar/a b.pack", &UploadOpts{
+		PartSize: 4,
+	})
+	require.NoError(err)
+
+	_, err = u.Write([]byte("0123456789"))
+	require.NoError(err)
+
+	parts, err := b.Parts(ctx, u.key, u.state.ID)
+	require.NoError(err)
+	require.Len(parts, 2)
+	require.Equal(`"`+u.parts[0].MD5+`"`, parts[0].ETag)
+
+	require.NoError(u.Close())
+	require.Equal("0123456789", get(t, b, "github.com/foo/bar/a b.pack"))
+
+	_, err = b.Parts(ctx, u.key, u.state.ID)
+	require.True(ErrUploadNotFound.Is(err))
+
+	_, err = b.Get(ctx, "github.com/foo/bar/missing")
+	require.True(ErrObjectNotFound.Is(err))
+
+	require.NoError(b.Put(ctx, "github.com/foo/bar/refs.json", []byte("{}")))
+	require.Equal("{}", get(t, b, "github.com/foo/bar/refs.json"))
+
+	id, err := b.Create(ctx, "foo")
+	require.NoError(err)
+	require.NoError(b.Abort(ctx, "foo", id))
+
+	wrong, err := NewS3Bucket(&S3Opts{
+		Endpoint: server.URL,
+		Bucket:   "packs",
+	})
+	require.NoError(err)
+
+	_, err = wrong.Create(ctx, "foo")
+	require.True(ErrRequest.Is(err))
+	require.Contains(err.Error(), "403 SignatureDoesNotMatch")
+}
+
+// fakeS3 serves the S3 API requests made by an S3Bucket from a bucket.
+type fakeS3 struct {
+	t *testing.T
+	b *FSBucket
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	require.NoError(s.t, err)
+
+	payload := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(payload[:]) {
+		s.error(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+		return
+	}
+
+	if len(body) > 0 {
+		sum := md5.Sum(body)
+		if r.Header.Get("Content-MD5") !=
+			base64.StdEncoding.EncodeToString(sum[:]) {
+			s.error(w, http.StatusBadRequest, "BadDigest")
+			return
+		}
+	}
+
+	if !s.verify(r) {
+		s.error(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/packs/")
+	query := r.URL.Query()
+	id := query.Get("uploadId")
+	ctx := r.Context()
+
+	var v interface{}
+	switch {
+	case r.Method == "POST" && query["uploads"] != nil:
+		id, err = s.b.Create(ctx, key)
+		v = &initiateResult{UploadID: id}
+	case r.Method == "PUT" && id != "":
+		var number int
+		number, err = strconv.Atoi(query.Get("partNumber"))
+		require.NoError(s.t, err)
+
+		var part Part
+		part, err = s.b.UploadPart(ctx, key, id, number, body)
+		if err == nil {
+			w.Header().Set("ETag", `"`+part.ETag+`"`)
+		}
+	case r.Method == "GET" && id != "":
+		var parts []Part
+		parts, err = s.b.Parts(ctx, key, id)
+		var res listPartsResult
+		for _, p := range parts {
+			res.Parts = append(res.Parts, struct {
+				PartNumber int
+				ETag       string
+				Size       int64
+			}{p.Number, `"` + p.ETag + `"`, p.Size})
+		}
+		v = &res
+	case r.Method == "POST" && id != "":
+		var req completeUpload
+		require.NoError(s.t, xml.Unmarshal(body, &req))
+
+		var parts []Part
+		for _, p := range req.Parts {
+			parts = append(parts, Part{
+				Number: p.PartNumber,
+				ETag:   strings.Trim(p.ETag, `"`),
+			})
+		}
+
+		err = s.b.Complete(ctx, key, id, parts)
+		v = &struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		}{}
+	case r.Method == "DELETE" && id != "":
+		err = s.b.Abort(ctx, key, id)
+	case r.Method == "PUT":
+		err = s.b.Put(ctx, key, body)
+	case r.Method == "GET":
+		var data []byte
+		rc, gerr := s.b.Get(ctx, key)
+		if err = gerr; err == nil {
+			data, err = readAll(rc)
+		}
+
+		if err == nil {
+			w.Write(data)
+			return
+		}
+	default:
+		s.error(w, http.StatusNotImplemented, "NotImplemented")
+		return
+	}
+
+	switch {
+	case ErrUploadNotFound.Is(err):
+		s.error(w, http.StatusNotFound, "NoSuchUpload")
+	case ErrObjectNotFound.Is(err):
+		s.error(w, http.StatusNotFound, "NoSuchKey")
+	case err != nil:
+		s.error(w, http.StatusInternalServerError, "InternalError")
+	case v != nil:
+		require.NoError(s.t, xml.NewEncoder(w).Encode(v))
+	}
+}
+
+// verify signs the request again with its signed headers and the
+// credentials of the tests.
+func (s *fakeS3) verify(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	i := strings.Index(auth, "SignedHeaders=")
+	if i < 0 {
+		return false
+	}
+
+	signed := strings.SplitN(auth[i+len("SignedHeaders="):], ",", 2)[0]
+	req, err := http.NewRequest(r.Method, "http://"+r.Host+r.RequestURI, nil)
+	require.NoError(s.t, err)
+	for _, name := range strings.Split(signed, ";") {
+		if name != "host" && name != "x-amz-date" {
+			req.Header.Set(name, r.Header.Get(name))
+		}
+	}
+
+	now, err := time.Parse(amzDate, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+
+	signer := &signer{
+		accessKey: "foo",
+		secretKey: "bar",
+		region:    s3Region,
+		service:   s3Service,
+	}
+	signer.sign(req, r.Header.Get("X-Amz-Content-Sha256"), now)
+	return req.Header.Get("Authorization") == auth
+}
+
+func (s *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code></Error>", code)
+}
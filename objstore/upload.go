@@ -0,0 +1,421 @@
+package objstore
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrUploadClosed is returned when an Upload is written after it's closed or
+// aborted.
+var ErrUploadClosed = errors.NewKind("upload of %s closed")
+
+const (
+	// MinPartSize is the smallest size of the parts but the last one
+	// accepted by S3.
+	MinPartSize = 5 << 20
+	// DefaultPartSize is the default size of the parts of an Upload.
+	DefaultPartSize = 16 << 20
+
+	uploadRetries = 3
+	retryDelay    = time.Second
+)
+
+// UploadOpts represents configuration options for an Upload.
+type UploadOpts struct {
+	// PartSize is the size of the parts, the memory an Upload needs,
+	// default to DefaultPartSize.
+	PartSize int
+	// Retries is the number of times a failed request is retried,
+	// default to 3.
+	Retries int
+	// RetryDelay is the time waited before the first retry, doubled on
+	// every retry, default to a second.
+	RetryDelay time.Duration
+	// Journal keeps the state of the Upload so it can be resumed after a
+	// failure, nil means it's started again.
+	Journal *Journal
+}
+
+// Upload is an io.WriteCloser storing what's written to it as an object of a
+// Bucket, sending every part through a multipart upload as soon as it's
+// complete.
+//
+// With a Journal, an Upload of the same key not completed before is resumed:
+// the object must be written again from the beginning but the parts already
+// uploaded with the same content aren't sent again.
+type Upload struct {
+	ctx  context.Context
+	b    Bucket
+	key  string
+	opts *UploadOpts
+
+	state *UploadState
+	// resumed are the parts of a resumed upload by number.
+	resumed map[int]Part
+	parts   []Part
+	buf     []byte
+	skipped int64
+	closed  bool
+	err     error
+}
+
+// NewUpload starts, or resumes if it's in the Journal, the upload of the given
+// key.
+func NewUpload(
+	ctx context.Context,
+	b Bucket,
+	key string,
+	opts *UploadOpts,
+) (*Upload, error) {
+	o := &UploadOpts{}
+	if opts != nil {
+		*o = *opts
+	}
+
+	if o.PartSize <= 0 {
+		o.PartSize = DefaultPartSize
+	}
+
+	if o.Retries <= 0 {
+		o.Retries = uploadRetries
+	}
+
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = retryDelay
+	}
+
+	u := &Upload{
+		ctx:     ctx,
+		b:       b,
+		key:     key,
+		opts:    o,
+		resumed: make(map[int]Part),
+		buf:     make([]byte, 0, o.PartSize),
+	}
+
+	if err := u.resume(); err != nil {
+		return nil, err
+	}
+
+	if u.state != nil {
+		return u, nil
+	}
+
+	var id string
+	err := u.retry(func() error {
+		var err error
+		id, err = b.Create(ctx, key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	u.state = &UploadState{Key: key, ID: id}
+	if err := u.save(); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// resume loads the state of the upload from the Journal, keeping the parts
+// the bucket still has.
+func (u *Upload) resume() error {
+	if u.opts.Journal == nil {
+		return nil
+	}
+
+	state, err := u.opts.Journal.Load(u.key)
+	if err != nil || state == nil {
+		return err
+	}
+
+	var uploaded []Part
+	err = u.retry(func() error {
+		var err error
+		uploaded, err = u.b.Parts(u.ctx, u.key, state.ID)
+		return err
+	})
+	if ErrUploadNotFound.Is(err) {
+		return u.opts.Journal.Remove(u.key)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	etags := make(map[int]string, len(uploaded))
+	for _, p := range uploaded {
+		etags[p.Number] = p.ETag
+	}
+
+	var parts []Part
+	for _, p := range state.Parts {
+		if etags[p.Number] == p.ETag {
+			u.resumed[p.Number] = p
+			parts = append(parts, p)
+		}
+	}
+
+	state.Parts = parts
+	u.state = state
+	return nil
+}
+
+// Key returns the key of the object.
+func (u *Upload) Key() string {
+	return u.key
+}
+
+// Skipped returns the number of bytes of the parts of a resumed upload which
+// weren't sent again.
+func (u *Upload) Skipped() int64 {
+	return u.skipped
+}
+
+// Write implements the io.Writer interface. It only blocks while a complete
+// part is sent.
+func (u *Upload) Write(p []byte) (int, error) {
+	if u.closed {
+		return 0, ErrUploadClosed.New(u.key)
+	}
+
+	if u.err != nil {
+		return 0, u.err
+	}
+
+	var written int
+	for len(p) > 0 {
+		n := u.opts.PartSize - len(u.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+
+		u.buf = append(u.buf, p[:n]...)
+		p = p[n:]
+		written += n
+
+		if len(u.buf) == u.opts.PartSize {
+			if err := u.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// flush sends the buffered part, unless the resumed upload already has it.
+func (u *Upload) flush() error {
+	number := len(u.parts) + 1
+	sum := md5.Sum(u.buf)
+	digest := hex.EncodeToString(sum[:])
+
+	part, ok := u.resumed[number]
+	if ok && part.MD5 == digest && part.Size == int64(len(u.buf)) {
+		u.skipped += part.Size
+	} else {
+		err := u.retry(func() error {
+			var err error
+			part, err = u.b.UploadPart(
+				u.ctx, u.key, u.state.ID, number, u.buf,
+			)
+			return err
+		})
+		if err != nil {
+			u.err = err
+			return err
+		}
+
+		part.MD5 = digest
+		u.record(part)
+		if err := u.save(); err != nil {
+			u.err = err
+			return err
+		}
+	}
+
+	u.parts = append(u.parts, part)
+	u.buf = u.buf[:0]
+	return nil
+}
+
+// record keeps the uploaded part in the state, replacing the one of the same
+// number.
+func (u *Upload) record(part Part) {
+	delete(u.resumed, part.Number)
+	for i, p := range u.state.Parts {
+		if p.Number == part.Number {
+			u.state.Parts[i] = part
+			return
+		}
+	}
+
+	u.state.Parts = append(u.state.Parts, part)
+}
+
+// Close sends the last part and completes the upload, storing the object.
+// On failure the upload is kept to be resumed, or aborted with Abort.
+func (u *Upload) Close() error {
+	if u.closed {
+		return ErrUploadClosed.New(u.key)
+	}
+
+	if u.err != nil {
+		return u.err
+	}
+
+	// an empty object still needs a part.
+	if len(u.buf) > 0 || len(u.parts) == 0 {
+		if err := u.flush(); err != nil {
+			return err
+		}
+	}
+
+	// the parts of a resumed upload beyond the end of the object aren't
+	// part of it.
+	err := u.retry(func() error {
+		return u.b.Complete(u.ctx, u.key, u.state.ID, u.parts)
+	})
+	if err != nil {
+		u.err = err
+		return err
+	}
+
+	u.closed = true
+	return u.remove()
+}
+
+// Abort removes the upload along with its parts.
+func (u *Upload) Abort() error {
+	if u.closed {
+		return ErrUploadClosed.New(u.key)
+	}
+
+	u.closed = true
+	err := u.b.Abort(u.ctx, u.key, u.state.ID)
+	if err != nil && !ErrUploadNotFound.Is(err) {
+		return err
+	}
+
+	return u.remove()
+}
+
+func (u *Upload) save() error {
+	if u.opts.Journal == nil {
+		return nil
+	}
+
+	return u.opts.Journal.Save(u.state)
+}
+
+func (u *Upload) remove() error {
+	if u.opts.Journal == nil {
+		return nil
+	}
+
+	return u.opts.Journal.Remove(u.key)
+}
+
+// retry runs the request until it succeeds, the retries are exhausted or the
+// upload is gone.
+func (u *Upload) retry(fn func() error) error {
+	delay := u.opts.RetryDelay
+	var err error
+	for i := 0; ; i++ {
+		err = fn()
+		if err == nil || ErrUploadNotFound.Is(err) || i >= u.opts.Retries {
+			return err
+		}
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-u.ctx.Done():
+			return u.ctx.Err()
+		}
+	}
+}
+
+// UploadState is the state of an Upload kept in a Journal.
+type UploadState struct {
+	Key string `json:"key"`
+	ID  string `json:"id"`
+	// Parts are the parts sent, in any order.
+	Parts []Part `json:"parts,omitempty"`
+}
+
+// Journal keeps the state of the Uploads not completed in a filesystem, one
+// file per key, so they can be resumed after a failure or a restart.
+type Journal struct {
+	fs billy.Filesystem
+}
+
+// NewJournal builds a new Journal on the given filesystem.
+func NewJournal(fs billy.Filesystem) *Journal {
+	return &Journal{fs: fs}
+}
+
+// Load returns the state of the Upload of the given key, nil if it isn't in
+// the Journal.
+func (j *Journal) Load(key string) (*UploadState, error) {
+	f, err := j.fs.Open(j.name(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	data, err := readAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var state UploadState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	if state.Key != key {
+		// a collision, the other upload is started again.
+		return nil, nil
+	}
+
+	return &state, nil
+}
+
+// Save stores the state of an Upload.
+func (j *Journal) Save(state *UploadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return write(j.fs, j.name(state.Key), data)
+}
+
+// Remove removes the state of the Upload of the given key.
+func (j *Journal) Remove(key string) error {
+	err := j.fs.Remove(j.name(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (j *Journal) name(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
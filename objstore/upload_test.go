@@ -0,0 +1,166 @@
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4/memfs"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flakyBucket is a Bucket failing the uploads of some parts.
+type flakyBucket struct {
+	*FSBucket
+	// failures is the number of times the upload of every part fails.
+	failures map[int]int
+	uploaded []int
+}
+
+func (b *flakyBucket) UploadPart(
+	ctx context.Context,
+	key, id string,
+	number int,
+	data []byte,
+) (Part, error) {
+	if b.failures[number] > 0 {
+		b.failures[number]--
+		return Part{}, fmt.Errorf("part %d failed", number)
+	}
+
+	b.uploaded = append(b.uploaded, number)
+	return b.FSBucket.UploadPart(ctx, key, id, number, data)
+}
+
+func TestUpload(t *testing.T) {
+	var require = require.New(t)
+	ctx := context.Background()
+
+	b := &flakyBucket{
+		FSBucket: NewFSBucket(memfs.New()),
+		failures: map[int]int{2: 1},
+	}
+
+	u, err := NewUpload(ctx, b, "foo", &UploadOpts{
+		PartSize:   4,
+		RetryDelay: time.Millisecond,
+	})
+	require.NoError(err)
+
+	// only the complete parts are sent while it's written.
+	for _, s := range []string{"01", "234", "5678", "9"} {
+		_, err = u.Write([]byte(s))
+		require.NoError(err)
+	}
+	require.Equal([]int{1, 2}, b.uploaded)
+	require.Equal("89", string(u.buf))
+
+	require.NoError(u.Close())
+	require.Equal([]int{1, 2, 3}, b.uploaded)
+	require.Equal("0123456789", get(t, b, "foo"))
+
+	_, err = u.Write([]byte("a"))
+	require.True(ErrUploadClosed.Is(err))
+	require.True(ErrUploadClosed.Is(u.Close()))
+
+	// an empty object has one empty part.
+	u, err = NewUpload(ctx, b, "empty", nil)
+	require.NoError(err)
+	require.NoError(u.Close())
+	require.Equal("", get(t, b, "empty"))
+}
+
+func TestUploadResume(t *testing.T) {
+	var require = require.New(t)
+	ctx := context.Background()
+
+	b := &flakyBucket{
+		FSBucket: NewFSBucket(memfs.New()),
+		failures: map[int]int{3: 2},
+	}
+
+	journal := NewJournal(memfs.New())
+	opts := &UploadOpts{
+		PartSize:   4,
+		Retries:    1,
+		RetryDelay: time.Millisecond,
+		Journal:    journal,
+	}
+
+	u, err := NewUpload(ctx, b, "foo", opts)
+	require.NoError(err)
+	_, err = u.Write([]byte("0123456789ab"))
+	require.EqualError(err, "part 3 failed")
+	require.EqualError(u.Close(), "part 3 failed")
+
+	state, err := journal.Load("foo")
+	require.NoError(err)
+	require.Equal(u.state.ID, state.ID)
+	require.Len(state.Parts, 2)
+
+	// the object is written again, the parts with the same content
+	// aren't sent again and the changed ones replace them.
+	b.uploaded = nil
+	u, err = NewUpload(ctx, b, "foo", opts)
+	require.NoError(err)
+	require.Equal(state.ID, u.state.ID)
+
+	_, err = u.Write([]byte("0123xxxx89ab"))
+	require.NoError(err)
+	require.NoError(u.Close())
+	require.Equal([]int{2, 3}, b.uploaded)
+	require.Equal(int64(4), u.Skipped())
+	require.Equal("0123xxxx89ab", get(t, b, "foo"))
+
+	state, err = journal.Load("foo")
+	require.NoError(err)
+	require.Nil(state)
+
+	// the parts beyond the end of a shorter object are left out.
+	b.failures = map[int]int{3: 2}
+	u, err = NewUpload(ctx, b, "bar", opts)
+	require.NoError(err)
+	_, err = u.Write([]byte("0123456789ab"))
+	require.Error(err)
+
+	b.uploaded = nil
+	u, err = NewUpload(ctx, b, "bar", opts)
+	require.NoError(err)
+	_, err = u.Write([]byte("012"))
+	require.NoError(err)
+	require.NoError(u.Close())
+	require.Equal([]int{1}, b.uploaded)
+	require.Equal("012", get(t, b, "bar"))
+
+	// an upload gone from the bucket is started again.
+	b.failures = map[int]int{2: 2}
+	u, err = NewUpload(ctx, b, "baz", opts)
+	require.NoError(err)
+	_, err = u.Write([]byte("01234567"))
+	require.Error(err)
+	require.NoError(b.Abort(ctx, "baz", u.state.ID))
+
+	b.uploaded = nil
+	resumed, err := NewUpload(ctx, b, "baz", opts)
+	require.NoError(err)
+	require.NotEqual(u.state.ID, resumed.state.ID)
+	_, err = resumed.Write([]byte("01234567"))
+	require.NoError(err)
+	require.NoError(resumed.Close())
+	require.Equal([]int{1, 2}, b.uploaded)
+	require.Equal(int64(0), resumed.Skipped())
+
+	// an aborted upload leaves nothing behind.
+	u, err = NewUpload(ctx, b, "qux", opts)
+	require.NoError(err)
+	_, err = u.Write([]byte("01234567"))
+	require.NoError(err)
+	require.NoError(u.Abort())
+	state, err = journal.Load("qux")
+	require.NoError(err)
+	require.Nil(state)
+	_, err = b.Parts(ctx, "qux", u.state.ID)
+	require.True(ErrUploadNotFound.Is(err))
+}
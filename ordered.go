@@ -0,0 +1,90 @@
+package gitcollector
+
+import (
+	"sync"
+)
+
+// orderedJob is a Job dispatched by an orderedWindow, it must be released
+// once it's processed.
+type orderedJob struct {
+	Job
+	seq    uint64
+	window *orderedWindow
+}
+
+// orderedWindow bounds the Jobs dispatched in order, a Job is only dispatched
+// when the distance to the oldest unfinished one is lower than the size of the
+// window, so a slow Job holds the ones behind it instead of letting them
+// overtake it.
+type orderedWindow struct {
+	mu     sync.Mutex
+	size   uint64
+	next   uint64
+	oldest uint64
+	done   map[uint64]bool
+	wake   chan struct{}
+}
+
+func newOrderedWindow(size int) *orderedWindow {
+	return &orderedWindow{
+		size: uint64(size),
+		done: map[uint64]bool{},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// acquire waits until the window has room for the next Job, false is
+// returned if cancel is closed before.
+func (w *orderedWindow) acquire(cancel <-chan struct{}) bool {
+	for {
+		w.mu.Lock()
+		free := w.next-w.oldest < w.size
+		w.mu.Unlock()
+		if free {
+			return true
+		}
+
+		select {
+		case <-w.wake:
+		case <-cancel:
+			return false
+		}
+	}
+}
+
+// dispatch assigns the next position of the window to the given Job.
+func (w *orderedWindow) dispatch(job Job) *orderedJob {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	j := &orderedJob{Job: job, seq: w.next, window: w}
+	w.next++
+	return j
+}
+
+// release frees the position of a processed Job.
+func (w *orderedWindow) release(seq uint64) {
+	w.mu.Lock()
+	w.done[seq] = true
+	for w.done[w.oldest] {
+		delete(w.done, w.oldest)
+		w.oldest++
+	}
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// unwrapJob returns the Job to process and the function to call once it's
+// processed.
+func unwrapJob(job Job) (Job, func()) {
+	j, ok := job.(*orderedJob)
+	if !ok {
+		return job, func() {}
+	}
+
+	return j.Job, func() { j.window.release(j.seq) }
+}
@@ -0,0 +1,107 @@
+package gitcollector
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPoolOrdered(t *testing.T) {
+	var require = require.New(t)
+
+	const window = 2
+	var (
+		mu       sync.Mutex
+		started  []int
+		finished int
+		overtook []int
+		blocked  = make(chan struct{})
+	)
+
+	job := func(i int) Job {
+		return &testBlockingFn{fn: func() {
+			mu.Lock()
+			// a job can't start while there are unfinished jobs
+			// a window before it.
+			if finished < i-window+1 {
+				overtook = append(overtook, i)
+			}
+
+			started = append(started, i)
+			mu.Unlock()
+
+			if i == 0 {
+				<-blocked
+			}
+
+			mu.Lock()
+			finished++
+			mu.Unlock()
+		}}
+	}
+
+	queue := make(chan Job, 20)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{
+		OrderedWindow: window,
+	})
+	wp.SetWorkers(4)
+	wp.Run()
+
+	for i := 0; i < 10; i++ {
+		queue <- job(i)
+	}
+	close(queue)
+
+	// the first job holds the rest of them once the window is full.
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	require.ElementsMatch([]int{0, 1}, started)
+	mu.Unlock()
+
+	close(blocked)
+	wp.Wait()
+
+	require.Len(started, 10)
+	require.Equal(10, finished)
+	require.Empty(overtook)
+}
+
+func TestOrderedWindow(t *testing.T) {
+	var require = require.New(t)
+
+	w := newOrderedWindow(2)
+	cancel := make(chan struct{})
+
+	require.True(w.acquire(cancel))
+	a := w.dispatch(&testJob{id: "a"})
+	require.True(w.acquire(cancel))
+	b := w.dispatch(&testJob{id: "b"})
+
+	// the window is full until the oldest job is released, releasing a
+	// newer one doesn't make room.
+	_, release := unwrapJob(b)
+	release()
+
+	close(cancel)
+	require.False(w.acquire(cancel))
+
+	job, release := unwrapJob(a)
+	require.Equal("a", job.(*testJob).id)
+	release()
+	require.True(w.acquire(make(chan struct{})))
+
+	job, _ = unwrapJob(&testJob{id: "c"})
+	require.Equal("c", job.(*testJob).id)
+}
+
+type testBlockingFn struct {
+	fn func()
+}
+
+func (j *testBlockingFn) Process(context.Context) error {
+	j.fn()
+	return nil
+}
@@ -0,0 +1,186 @@
+package gitcollector
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// OutageOpts represents configuration options for an OutageDetector.
+type OutageOpts struct {
+	// Threshold is the number of consecutive upstream failures that
+	// switch to probe mode.
+	Threshold int
+	// ProbeInterval is the time between probes while in probe mode.
+	ProbeInterval time.Duration
+	// OnChange is called every time the probe mode is entered or left.
+	OnChange func(outage bool)
+}
+
+const (
+	outageThreshold     = 20
+	outageProbeInterval = time.Minute
+)
+
+// OutageDetector detects a sustained unavailability of the upstream forge,
+// like connection failures or 5xx responses, and switches into a probe mode
+// where a single operation is allowed every ProbeInterval. The rest of them
+// wait until a probe succeeds instead of failing.
+type OutageDetector struct {
+	mu        sync.Mutex
+	failures  int
+	outage    bool
+	probing   bool
+	nextProbe time.Time
+	changed   chan struct{}
+	opts      *OutageOpts
+}
+
+// NewOutageDetector builds a new OutageDetector.
+func NewOutageDetector(opts *OutageOpts) *OutageDetector {
+	if opts == nil {
+		opts = &OutageOpts{}
+	}
+
+	if opts.Threshold <= 0 {
+		opts.Threshold = outageThreshold
+	}
+
+	if opts.ProbeInterval <= 0 {
+		opts.ProbeInterval = outageProbeInterval
+	}
+
+	return &OutageDetector{
+		changed: make(chan struct{}),
+		opts:    opts,
+	}
+}
+
+// IsUpstreamError returns whether the error is caused by the unavailability of
+// the upstream forge.
+func IsUpstreamError(err error) bool {
+	switch ClassifyError(err) {
+	case ErrorClassNetwork, ErrorClassServer, ErrorClassTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// Outage returns whether the detector is in probe mode.
+func (d *OutageDetector) Outage() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.outage
+}
+
+// Do runs the given function once it's admitted. While in probe mode, the
+// functions failing with upstream errors are retried once the forge recovers,
+// so only the errors happening before the outage is detected are returned.
+func (d *OutageDetector) Do(
+	ctx context.Context,
+	fn func(context.Context) error,
+) error {
+	if d == nil {
+		return fn(ctx)
+	}
+
+	for {
+		probe, err := d.admit(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = fn(ctx)
+		if outage := d.observe(err, probe); !outage ||
+			err == nil || !IsUpstreamError(err) {
+			return err
+		}
+	}
+}
+
+// Observe registers the result of an operation not run through Do.
+func (d *OutageDetector) Observe(err error) {
+	if d == nil {
+		return
+	}
+
+	d.observe(err, false)
+}
+
+func (d *OutageDetector) admit(ctx context.Context) (bool, error) {
+	for {
+		d.mu.Lock()
+		if !d.outage {
+			d.mu.Unlock()
+			return false, nil
+		}
+
+		wait := time.Until(d.nextProbe)
+		if !d.probing && wait <= 0 {
+			d.probing = true
+			d.mu.Unlock()
+			return true, nil
+		}
+
+		if d.probing {
+			wait = d.opts.ProbeInterval
+		}
+
+		changed := d.changed
+		d.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return false, ctx.Err()
+		}
+
+		timer.Stop()
+	}
+}
+
+func (d *OutageDetector) observe(err error, probe bool) bool {
+	d.mu.Lock()
+	if probe {
+		d.probing = false
+		d.nextProbe = time.Now().Add(d.opts.ProbeInterval)
+	}
+
+	var changed bool
+	switch {
+	case err != nil && ClassifyError(err) == ErrorClassCanceled:
+		// says nothing about the forge
+	case err == nil || !IsUpstreamError(err):
+		// any answer means the forge is reachable again
+		d.failures = 0
+		changed = d.outage
+	default:
+		d.failures++
+		changed = !d.outage && d.failures >= d.opts.Threshold
+		if changed {
+			d.nextProbe = time.Now().Add(d.opts.ProbeInterval)
+		}
+	}
+
+	if changed {
+		d.outage = !d.outage
+	}
+
+	if changed || probe {
+		close(d.changed)
+		d.changed = make(chan struct{})
+	}
+
+	outage := d.outage
+	d.mu.Unlock()
+
+	if changed && d.opts.OnChange != nil {
+		d.opts.OnChange(outage)
+	}
+
+	return outage
+}
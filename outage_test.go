@@ -0,0 +1,83 @@
+package gitcollector
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutageDetector(t *testing.T) {
+	var require = require.New(t)
+
+	var changes = make(chan bool, 2)
+	d := NewOutageDetector(&OutageOpts{
+		Threshold:     3,
+		ProbeInterval: 20 * time.Millisecond,
+		OnChange:      func(outage bool) { changes <- outage },
+	})
+
+	var (
+		ctx            = context.Background()
+		upstream       = &net.OpError{Op: "dial", Err: fmt.Errorf("refused")}
+		down     int32 = 1
+		calls    int32
+	)
+
+	fn := func(context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			return upstream
+		}
+
+		return nil
+	}
+
+	// failures before the outage is detected are returned
+	require.Equal(upstream, d.Do(ctx, fn))
+	require.Equal(upstream, d.Do(ctx, fn))
+	require.False(d.Outage())
+
+	// a non upstream error resets the count
+	require.Error(d.Do(ctx, func(context.Context) error {
+		return fmt.Errorf("not found")
+	}))
+
+	require.Equal(upstream, d.Do(ctx, fn))
+	require.Equal(upstream, d.Do(ctx, fn))
+
+	done := make(chan error, 1)
+	go func() { done <- d.Do(ctx, fn) }()
+
+	require.True(<-changes)
+	require.True(d.Outage())
+
+	// the job waits probing every interval
+	time.Sleep(70 * time.Millisecond)
+	probes := atomic.LoadInt32(&calls)
+	require.True(probes >= 6 && probes <= 10, "calls %d", probes)
+
+	select {
+	case err := <-done:
+		require.Fail("job finished during the outage", "%v", err)
+	default:
+	}
+
+	atomic.StoreInt32(&down, 0)
+	require.NoError(<-done)
+	require.False(<-changes)
+	require.False(d.Outage())
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	require.Equal(context.Canceled, d.Do(cctx, func(ctx context.Context) error {
+		return ctx.Err()
+	}))
+
+	var nilDetector *OutageDetector
+	require.NoError(nilDetector.Do(ctx, fn))
+}
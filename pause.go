@@ -0,0 +1,95 @@
+package gitcollector
+
+import (
+	"context"
+	"sync"
+)
+
+// pauseGate is shared by the workers of a WorkerPool to hold the start of new
+// Jobs while the pool is paused.
+type pauseGate struct {
+	mu sync.Mutex
+	// resumed is closed once the pool is resumed, nil if it isn't paused.
+	resumed chan struct{}
+}
+
+var running = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// wait returns a channel closed once the pool isn't paused.
+func (g *pauseGate) wait() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.resumed == nil {
+		return running
+	}
+
+	return g.resumed
+}
+
+func (g *pauseGate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.resumed == nil {
+		g.resumed = make(chan struct{})
+	}
+}
+
+func (g *pauseGate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.resumed != nil {
+		close(g.resumed)
+		g.resumed = nil
+	}
+}
+
+func (g *pauseGate) paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.resumed != nil
+}
+
+// Pause halts the processing of the WorkerPool, like during a maintenance of
+// the storage, until Resume is called. The Jobs being processed keep running
+// but no more of them are started, the scheduled ones stay in the scheduler so
+// the providers keep their state and block once it's full. The pool can still
+// be stopped or drained while it's paused, the Jobs taken by a worker but not
+// started yet are reported as canceled then.
+func (wp *WorkerPool) Pause() {
+	wp.paused.pause()
+}
+
+// Resume restarts the processing of a WorkerPool paused by Pause.
+func (wp *WorkerPool) Resume() {
+	wp.paused.resume()
+}
+
+// Paused reports whether the WorkerPool is paused.
+func (wp *WorkerPool) Paused() bool {
+	return wp.paused.paused()
+}
+
+// hold waits for the pool to be resumed before starting the given Job. It
+// returns false if the worker is stopped meanwhile, the Job is reported as
+// canceled then.
+func (w *worker) hold(ctx context.Context, job Job) bool {
+	select {
+	case <-w.paused.wait():
+		return true
+	case <-w.cancel:
+	case <-ctx.Done():
+	}
+
+	job, release := unwrapJob(job)
+	release()
+	w.abandoned.cancel(job)
+	return false
+}
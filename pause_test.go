@@ -0,0 +1,89 @@
+package gitcollector
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPoolPause(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 10)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{})
+	wp.SetWorkers(2)
+	wp.Run()
+
+	var (
+		started  = make(chan struct{})
+		release  = make(chan struct{})
+		finished int32
+	)
+
+	queue <- &testJob{process: func(string) error {
+		close(started)
+		<-release
+		atomic.AddInt32(&finished, 1)
+		return nil
+	}}
+	<-started
+
+	wp.Pause()
+	require.True(wp.Paused())
+
+	var processed int32
+	for i := 0; i < 5; i++ {
+		queue <- &testJob{process: func(string) error {
+			atomic.AddInt32(&processed, 1)
+			return nil
+		}}
+	}
+
+	// the running job finishes but no more of them are started
+	close(release)
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(int32(1), atomic.LoadInt32(&finished))
+	require.Zero(atomic.LoadInt32(&processed))
+
+	wp.Resume()
+	require.False(wp.Paused())
+	for atomic.LoadInt32(&processed) < 5 {
+		time.Sleep(time.Millisecond)
+	}
+
+	wp.Close()
+	report := wp.ShutdownReport()
+	require.Empty(report.Canceled)
+	require.Empty(report.Discarded)
+}
+
+func TestWorkerPoolStopPaused(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 5)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{})
+	wp.SetWorkers(1)
+	wp.Run()
+	wp.Pause()
+
+	job := &testJob{id: "a", process: func(string) error {
+		require.FailNow("job started while paused")
+		return nil
+	}}
+	queue <- job
+	for len(queue) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the job is reported whether it was taken by the worker or not
+	wp.Stop()
+	report := wp.ShutdownReport()
+	require.True(report.Immediate)
+	require.Equal(
+		[]Job{job},
+		append(report.Canceled, report.Discarded...),
+	)
+	require.Zero(wp.Size())
+}
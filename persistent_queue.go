@@ -0,0 +1,428 @@
+package gitcollector
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// JobCodec encodes the Jobs stored in a PersistentQueue.
+type JobCodec interface {
+	// Encode returns the representation of the Job stored.
+	Encode(Job) ([]byte, error)
+	// Decode rebuilds a Job from its stored representation.
+	Decode([]byte) (Job, error)
+}
+
+// PersistentQueueOpts represents configuration options for a PersistentQueue.
+type PersistentQueueOpts struct {
+	// MaxAttempts is the number of times a Job is begun before it's
+	// removed from the queue without being acknowledged, default to 3.
+	MaxAttempts int
+	// Capacity is the number of Jobs delivered ahead of the workers,
+	// default to 100.
+	Capacity int
+	// OnDrop is called with the Jobs removed after MaxAttempts attempts.
+	OnDrop func(job Job, attempts int)
+}
+
+const (
+	queueAttempts = 3
+	queueCapacity = 100
+	queueTimeout  = time.Second
+)
+
+var queueBucket = []byte("jobs")
+
+// PersistentQueue is a durable queue of Jobs stored in a BoltDB file. The Jobs
+// pushed to it stay stored until they're acknowledged once processed
+// successfully, so the ones lost from the channels of a process stopped
+// abruptly are delivered again when the queue is opened by the next one. A
+// Job that keeps failing, or crashing the process, is removed after
+// MaxAttempts attempts.
+type PersistentQueue struct {
+	db    *bolt.DB
+	codec JobCodec
+	opts  *PersistentQueueOpts
+	jobs  chan Job
+	wake  chan struct{}
+	stop  chan struct{}
+	// done is closed once the delivery finishes.
+	done    chan struct{}
+	started sync.Once
+	closed  sync.Once
+
+	mu   sync.Mutex
+	last uint64
+	// inflight are the Jobs delivered and not acknowledged yet by their
+	// sequence in the queue.
+	inflight map[uint64]Job
+	fed      bool
+	err      error
+}
+
+type queuedJob struct {
+	Attempts int    `json:"attempts"`
+	Job      []byte `json:"job"`
+}
+
+// OpenPersistentQueue opens the queue stored in the given path, creating it if
+// it doesn't exist. The Jobs left in it are delivered first.
+func OpenPersistentQueue(
+	path string,
+	codec JobCodec,
+	opts *PersistentQueueOpts,
+) (*PersistentQueue, error) {
+	if opts == nil {
+		opts = &PersistentQueueOpts{}
+	}
+
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = queueAttempts
+	}
+
+	if opts.Capacity <= 0 {
+		opts.Capacity = queueCapacity
+	}
+
+	// the file is locked while it's open, another process using it makes
+	// the open fail instead of waiting for it.
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: queueTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(queueBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &PersistentQueue{
+		db:       db,
+		codec:    codec,
+		opts:     opts,
+		jobs:     make(chan Job, opts.Capacity),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		inflight: map[uint64]Job{},
+	}, nil
+}
+
+// Push stores the given Job at the end of the queue.
+func (q *PersistentQueue) Push(job Job) error {
+	data, err := q.codec.Encode(job)
+	if err != nil {
+		return err
+	}
+
+	err = q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(queueBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		return putQueuedJob(b, seq, &queuedJob{Job: data})
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Feed pushes the Jobs received from the given channel until it's closed.
+// After that, the channel returned by Jobs is closed once the queue is
+// delivered completely.
+func (q *PersistentQueue) Feed(jobs <-chan Job) error {
+	defer func() {
+		q.mu.Lock()
+		q.fed = true
+		q.mu.Unlock()
+
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}()
+
+	for job := range jobs {
+		if err := q.Push(job); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Jobs returns the channel the stored Jobs are delivered to in the order they
+// were pushed, to be used as the source of a JobScheduleFn.
+func (q *PersistentQueue) Jobs() chan Job {
+	q.started.Do(func() { go q.deliver() })
+	return q.jobs
+}
+
+func (q *PersistentQueue) deliver() {
+	defer close(q.done)
+	defer close(q.jobs)
+	for {
+		q.mu.Lock()
+		fed := q.fed
+		q.mu.Unlock()
+
+		job, err := q.next()
+		if err != nil {
+			q.mu.Lock()
+			q.err = err
+			q.mu.Unlock()
+			return
+		}
+
+		if job == nil {
+			if fed {
+				return
+			}
+
+			select {
+			case <-q.wake:
+				continue
+			case <-q.stop:
+				return
+			}
+		}
+
+		select {
+		case q.jobs <- job:
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// next returns the first stored Job not delivered yet, nil if there isn't any.
+func (q *PersistentQueue) next() (Job, error) {
+	for {
+		var (
+			seq     uint64
+			record  *queuedJob
+			dropped bool
+		)
+
+		err := q.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(queueBucket)
+			k, v := b.Cursor().Seek(queueKey(q.last + 1))
+			if k == nil {
+				return nil
+			}
+
+			seq = binary.BigEndian.Uint64(k)
+			record = &queuedJob{}
+			if err := json.Unmarshal(v, record); err != nil {
+				return err
+			}
+
+			if record.Attempts >= q.opts.MaxAttempts {
+				dropped = true
+				return b.Delete(k)
+			}
+
+			return nil
+		})
+		if err != nil || record == nil {
+			return nil, err
+		}
+
+		q.last = seq
+		job, err := q.codec.Decode(record.Job)
+		if err != nil {
+			return nil, err
+		}
+
+		if dropped {
+			if q.opts.OnDrop != nil {
+				q.opts.OnDrop(job, record.Attempts)
+			}
+
+			continue
+		}
+
+		q.mu.Lock()
+		q.inflight[seq] = job
+		q.mu.Unlock()
+		return job, nil
+	}
+}
+
+// Begin records an attempt to process the given Job, delivered by Jobs. The
+// Jobs begun MaxAttempts times without being acknowledged aren't delivered
+// again.
+func (q *PersistentQueue) Begin(job Job) error {
+	q.mu.Lock()
+	seq, ok := q.sequence(job)
+	q.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	return q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(queueBucket)
+		v := b.Get(queueKey(seq))
+		if v == nil {
+			return nil
+		}
+
+		record := &queuedJob{}
+		if err := json.Unmarshal(v, record); err != nil {
+			return err
+		}
+
+		record.Attempts++
+		return putQueuedJob(b, seq, record)
+	})
+}
+
+// Ack removes from the queue the given Job, delivered by Jobs, once it's
+// processed successfully.
+func (q *PersistentQueue) Ack(job Job) error {
+	q.mu.Lock()
+	seq, ok := q.sequence(job)
+	delete(q.inflight, seq)
+	q.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(queueBucket).Delete(queueKey(seq))
+	})
+}
+
+// NewQueueShutdownFn returns a ShutdownFn storing in the queue the abandoned
+// Jobs, discarded or canceled, that don't come from it, so all of them are
+// delivered on the next start. The ones delivered by the queue are still
+// stored, as they weren't acknowledged.
+func NewQueueShutdownFn(q *PersistentQueue) ShutdownFn {
+	return func(report *ShutdownReport) ShutdownCleanup {
+		cleanup := ShutdownCleanup{Name: "queue checkpoint"}
+
+		var stored, pushed int
+		abandoned := append(
+			append([]Job(nil), report.Canceled...),
+			report.Discarded...,
+		)
+		for _, job := range abandoned {
+			if q.delivered(job) {
+				stored++
+				continue
+			}
+
+			if err := q.Push(job); err != nil {
+				cleanup.Err = err
+				break
+			}
+
+			pushed++
+		}
+
+		cleanup.Detail = fmt.Sprintf(
+			"%d jobs kept in the queue, %d of them pushed",
+			stored+pushed, pushed,
+		)
+
+		return cleanup
+	}
+}
+
+// delivered reports whether the Job was delivered by the queue and not
+// acknowledged yet.
+func (q *PersistentQueue) delivered(job Job) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, ok := q.sequence(job)
+	return ok
+}
+
+// sequence returns the sequence of the given Job if it's delivered and not
+// acknowledged yet. The Jobs of types that can't be compared, like structs
+// holding slices, are compared by value. It must be called holding mu.
+func (q *PersistentQueue) sequence(job Job) (uint64, bool) {
+	if job == nil {
+		return 0, false
+	}
+
+	comparable := reflect.TypeOf(job).Comparable()
+	for seq, j := range q.inflight {
+		if reflect.TypeOf(j) != reflect.TypeOf(job) {
+			continue
+		}
+
+		if comparable && j == job ||
+			!comparable && reflect.DeepEqual(j, job) {
+			return seq, true
+		}
+	}
+
+	return 0, false
+}
+
+// Len returns the number of Jobs stored, delivered or not.
+func (q *PersistentQueue) Len() (int, error) {
+	var n int
+	err := q.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(queueBucket).Stats().KeyN
+		return nil
+	})
+
+	return n, err
+}
+
+// Close stops the delivery of Jobs and closes the file of the queue. It
+// returns the error that stopped the delivery, if any.
+func (q *PersistentQueue) Close() error {
+	var err error
+	q.closed.Do(func() {
+		close(q.stop)
+		q.started.Do(func() { close(q.done) })
+		<-q.done
+		err = q.db.Close()
+	})
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.err != nil {
+		return q.err
+	}
+
+	return err
+}
+
+func queueKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
+
+func putQueuedJob(b *bolt.Bucket, seq uint64, record *queuedJob) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(queueKey(seq), data)
+}
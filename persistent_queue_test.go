@@ -0,0 +1,188 @@
+package gitcollector
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testJobCodec struct{}
+
+func (testJobCodec) Encode(job Job) ([]byte, error) {
+	return []byte(job.(*testJob).id), nil
+}
+
+func (testJobCodec) Decode(data []byte) (Job, error) {
+	return &testJob{id: string(data)}, nil
+}
+
+func TestPersistentQueue(t *testing.T) {
+	var require = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector-queue")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "queue.db")
+	open := func(opts *PersistentQueueOpts) *PersistentQueue {
+		q, err := OpenPersistentQueue(path, testJobCodec{}, opts)
+		require.NoError(err)
+		return q
+	}
+
+	next := func(jobs chan Job) Job {
+		select {
+		case job := <-jobs:
+			require.NotNil(job, "jobs channel closed")
+			return job
+		case <-time.After(5 * time.Second):
+			require.FailNow("job not delivered")
+			return nil
+		}
+	}
+
+	q := open(nil)
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(q.Push(&testJob{id: id}))
+	}
+
+	// the file is locked while it's open
+	_, err = OpenPersistentQueue(path, testJobCodec{}, nil)
+	require.Error(err)
+
+	jobs := q.Jobs()
+	a := next(jobs)
+	require.Equal("a", a.(*testJob).id)
+	require.NoError(q.Begin(a))
+	require.NoError(q.Ack(a))
+
+	// b crashes the process
+	b := next(jobs)
+	require.NoError(q.Begin(b))
+
+	n, err := q.Len()
+	require.NoError(err)
+	require.Equal(2, n)
+	require.NoError(q.Close())
+
+	// the jobs not acknowledged are delivered again before the new ones
+	q = open(nil)
+	feed := make(chan Job, 1)
+	feed <- &testJob{id: "d"}
+	close(feed)
+	require.NoError(q.Feed(feed))
+
+	var got []string
+	for job := range q.Jobs() {
+		got = append(got, job.(*testJob).id)
+	}
+
+	require.Equal([]string{"b", "c", "d"}, got)
+	require.NoError(q.Close())
+
+	// b already made the only attempt allowed
+	var dropped []string
+	q = open(&PersistentQueueOpts{
+		MaxAttempts: 1,
+		OnDrop: func(job Job, attempts int) {
+			require.Equal(1, attempts)
+			dropped = append(dropped, job.(*testJob).id)
+		},
+	})
+
+	require.Equal("c", next(q.Jobs()).(*testJob).id)
+	require.Equal([]string{"b"}, dropped)
+	require.NoError(q.Close())
+}
+
+// valueJob is a Job that can't be used as a map key.
+type valueJob struct {
+	endpoints []string
+}
+
+func (valueJob) Process(context.Context) error { return nil }
+
+type valueJobCodec struct{}
+
+func (valueJobCodec) Encode(job Job) ([]byte, error) {
+	return json.Marshal(job.(valueJob).endpoints)
+}
+
+func (valueJobCodec) Decode(data []byte) (Job, error) {
+	var job valueJob
+	err := json.Unmarshal(data, &job.endpoints)
+	return job, err
+}
+
+func TestPersistentQueueValueJobs(t *testing.T) {
+	var require = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector-queue")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	q, err := OpenPersistentQueue(
+		filepath.Join(dir, "queue.db"), valueJobCodec{}, nil,
+	)
+	require.NoError(err)
+	defer q.Close()
+
+	require.NoError(q.Push(valueJob{endpoints: []string{"a"}}))
+	require.NoError(q.Push(valueJob{endpoints: []string{"b"}}))
+
+	a, b := <-q.Jobs(), <-q.Jobs()
+	require.NoError(q.Begin(b))
+	require.NoError(q.Ack(b))
+	require.True(q.delivered(a))
+	require.False(q.delivered(b))
+
+	n, err := q.Len()
+	require.NoError(err)
+	require.Equal(1, n)
+}
+
+func TestQueueShutdownFn(t *testing.T) {
+	var require = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector-queue")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "queue.db")
+	q, err := OpenPersistentQueue(path, testJobCodec{}, nil)
+	require.NoError(err)
+
+	require.NoError(q.Push(&testJob{id: "a"}))
+	delivered := <-q.Jobs()
+
+	// the discarded job delivered by the queue is still stored, the other
+	// one is pushed
+	cleanup := NewQueueShutdownFn(q)(&ShutdownReport{
+		Discarded: []Job{delivered, &testJob{id: "b"}},
+	})
+	require.NoError(cleanup.Err)
+	require.Equal("queue checkpoint", cleanup.Name)
+	require.Equal("2 jobs kept in the queue, 1 of them pushed", cleanup.Detail)
+	require.NoError(q.Close())
+
+	q, err = OpenPersistentQueue(path, testJobCodec{}, nil)
+	require.NoError(err)
+	defer q.Close()
+
+	feed := make(chan Job)
+	close(feed)
+	require.NoError(q.Feed(feed))
+
+	var got []string
+	for job := range q.Jobs() {
+		got = append(got, job.(*testJob).id)
+	}
+
+	require.Equal([]string{"a", "b"}, got)
+}
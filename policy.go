@@ -0,0 +1,207 @@
+package gitcollector
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrJobTimeout is returned when an attempt is canceled by its TimeoutPolicy,
+// wrapping the error it failed with.
+var ErrJobTimeout = errors.NewKind("timed out after %s")
+
+// RetryPolicy retries the operations failing with a retryable error, waiting
+// an exponential backoff between the attempts.
+type RetryPolicy struct {
+	// Attempts is the maximum number of times an operation is run, it
+	// isn't retried if it's 1 or less.
+	Attempts int
+	// MinBackoff is the time waited before the first retry.
+	MinBackoff time.Duration
+	// MaxBackoff caps the time waited before a retry, 0 means uncapped.
+	MaxBackoff time.Duration
+	// Factor multiplies the backoff after every retry, it's kept constant
+	// if it's 1 or less.
+	Factor float64
+	// Retryable reports whether an operation failed with the given error
+	// can be retried, default to TransientError.
+	Retryable func(error) bool
+}
+
+// Backoff returns the time to wait before the given retry, starting at 1.
+func (p *RetryPolicy) Backoff(retry int) time.Duration {
+	backoff := float64(p.MinBackoff)
+	if p.Factor > 1 && retry > 1 {
+		backoff *= math.Pow(p.Factor, float64(retry-1))
+	}
+
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+
+	return time.Duration(backoff)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+
+	return TransientError(err)
+}
+
+// TransientError reports whether the error is classified as
+// ErrorClassNetwork, ErrorClassTimeout or ErrorClassServer, so the
+// operation may succeed if it's retried.
+func TransientError(err error) bool {
+	switch ClassifyError(err) {
+	case ErrorClassNetwork, ErrorClassTimeout, ErrorClassServer:
+		return true
+	default:
+		return false
+	}
+}
+
+// TimeoutPolicy bounds the time every attempt of an operation can take. The
+// context of the attempt is canceled once it's exceeded, aborting the clones
+// and fetches stuck on the enormous repositories, and the attempt fails with
+// ErrJobTimeout, classified as ErrorClassTimeout so it can be retried.
+type TimeoutPolicy struct {
+	// Timeout is the time an attempt can take, 0 means unlimited.
+	Timeout time.Duration
+}
+
+// RateLimitPolicy bounds the rate the attempts of the operations are started
+// at.
+type RateLimitPolicy struct {
+	// Limiter is waited before every attempt, a nil one doesn't limit
+	// them.
+	Limiter *RateLimiter
+}
+
+// Policies groups the policies applied to an operation, like the processing
+// of a Job. They can be attached to the Jobs, to the Providers producing them
+// and to the WorkerPool processing them, the most specific ones taking
+// precedence: the policies of a Job override the ones of its Provider, and
+// both override the ones of the WorkerPool. A nil policy is taken from the
+// next level, and a nil Policies doesn't apply any.
+type Policies struct {
+	Retry     *RetryPolicy
+	Timeout   *TimeoutPolicy
+	RateLimit *RateLimitPolicy
+}
+
+// Merge returns the Policies with the ones not set taken from fallback.
+func (p *Policies) Merge(fallback *Policies) *Policies {
+	switch {
+	case p == nil:
+		return fallback
+	case fallback == nil:
+		return p
+	}
+
+	merged := *p
+	if merged.Retry == nil {
+		merged.Retry = fallback.Retry
+	}
+
+	if merged.Timeout == nil {
+		merged.Timeout = fallback.Timeout
+	}
+
+	if merged.RateLimit == nil {
+		merged.RateLimit = fallback.RateLimit
+	}
+
+	return &merged
+}
+
+// Run runs fn applying the policies, waiting for the RateLimitPolicy and
+// bounding with the TimeoutPolicy every attempt, and waiting the backoff of
+// the RetryPolicy between attempts. The error of the last attempt is
+// returned once the RetryPolicy gives up.
+func (p *Policies) Run(
+	ctx context.Context,
+	fn func(context.Context) error,
+) error {
+	return p.run(ctx, fn, nil)
+}
+
+// run is Run calling retried, if not nil, with the number of the next attempt,
+// the error of the failed one and the backoff before every retry.
+func (p *Policies) run(
+	ctx context.Context,
+	fn func(context.Context) error,
+	retried func(attempt int, err error, backoff time.Duration),
+) error {
+	if p == nil {
+		return fn(ctx)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := p.attempt(ctx, fn)
+		if err == nil || ctx.Err() != nil || p.Retry == nil ||
+			attempt >= p.Retry.Attempts || !p.Retry.retryable(err) {
+			return err
+		}
+
+		backoff := p.Retry.Backoff(attempt)
+		if retried != nil {
+			retried(attempt+1, err, backoff)
+		}
+
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			}
+		}
+	}
+}
+
+func (p *Policies) attempt(
+	ctx context.Context,
+	fn func(context.Context) error,
+) error {
+	if p.RateLimit != nil {
+		if err := p.RateLimit.Limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	if p.Timeout == nil || p.Timeout.Timeout <= 0 {
+		return fn(ctx)
+	}
+
+	actx, cancel := context.WithTimeout(ctx, p.Timeout.Timeout)
+	defer cancel()
+
+	err := fn(actx)
+	if err != nil && ctx.Err() == nil &&
+		actx.Err() == context.DeadlineExceeded {
+		return ErrJobTimeout.Wrap(err, p.Timeout.Timeout)
+	}
+
+	return err
+}
+
+// PolicyJob is implemented by the Jobs carrying their own Policies.
+type PolicyJob interface {
+	Job
+	// JobPolicies returns the Policies of the Job, nil if it has none.
+	JobPolicies() *Policies
+}
+
+// jobPolicies returns the Policies of the Job, nil if it has none.
+func jobPolicies(job Job) *Policies {
+	if j, ok := job.(PolicyJob); ok {
+		return j.JobPolicies()
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+package gitcollector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+type testTimeoutError struct{}
+
+func (testTimeoutError) Error() string   { return "i/o timeout" }
+func (testTimeoutError) Timeout() bool   { return true }
+func (testTimeoutError) Temporary() bool { return true }
+
+func TestPoliciesMerge(t *testing.T) {
+	var require = require.New(t)
+
+	retry := &RetryPolicy{Attempts: 3}
+	timeout := &TimeoutPolicy{Timeout: time.Second}
+	job := &Policies{Retry: retry}
+	pool := &Policies{
+		Retry:   &RetryPolicy{Attempts: 1},
+		Timeout: timeout,
+	}
+
+	merged := job.Merge(pool)
+	require.True(merged.Retry == retry)
+	require.True(merged.Timeout == timeout)
+	require.Nil(merged.RateLimit)
+	require.Nil(job.Timeout)
+
+	require.True(job.Merge(nil) == job)
+	require.True((*Policies)(nil).Merge(pool) == pool)
+}
+
+func TestPoliciesRun(t *testing.T) {
+	var require = require.New(t)
+
+	ctx := context.Background()
+	policies := &Policies{Retry: &RetryPolicy{Attempts: 3}}
+
+	// the transient errors are retried until the attempts are exhausted
+	var attempts int
+	err := policies.Run(ctx, func(context.Context) error {
+		attempts++
+		return testTimeoutError{}
+	})
+	require.Equal(testTimeoutError{}, err)
+	require.Equal(3, attempts)
+
+	attempts = 0
+	err = policies.Run(ctx, func(context.Context) error {
+		attempts++
+		if attempts < 2 {
+			return testTimeoutError{}
+		}
+
+		return nil
+	})
+	require.NoError(err)
+	require.Equal(2, attempts)
+
+	// the rest of the errors aren't
+	attempts = 0
+	err = policies.Run(ctx, func(context.Context) error {
+		attempts++
+		return transport.ErrAuthenticationRequired
+	})
+	require.Equal(transport.ErrAuthenticationRequired, err)
+	require.Equal(1, attempts)
+
+	// every attempt is bounded by the timeout
+	policies.Timeout = &TimeoutPolicy{Timeout: 10 * time.Millisecond}
+	attempts = 0
+	err = policies.Run(ctx, func(ctx context.Context) error {
+		attempts++
+		<-ctx.Done()
+		return fmt.Errorf("clone aborted: %s", ctx.Err())
+	})
+	require.True(ErrJobTimeout.Is(err))
+	require.EqualError(
+		err.(*errors.Error).Cause(),
+		"clone aborted: context deadline exceeded",
+	)
+	require.Equal(ErrorClassTimeout, ClassifyError(err))
+	require.Equal(3, attempts)
+
+	// the retries stop once the context is canceled
+	policies = &Policies{
+		Retry: &RetryPolicy{Attempts: 3, MinBackoff: time.Hour},
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	attempts = 0
+	err = policies.Run(cctx, func(context.Context) error {
+		attempts++
+		cancel()
+		return testTimeoutError{}
+	})
+	require.Equal(testTimeoutError{}, err)
+	require.Equal(1, attempts)
+
+	// the classifier decides which errors are retried
+	policies = &Policies{Retry: &RetryPolicy{
+		Attempts: 3,
+		Retryable: func(err error) bool {
+			return err == transport.ErrAuthenticationRequired
+		},
+	}}
+	attempts = 0
+	err = policies.Run(ctx, func(context.Context) error {
+		attempts++
+		return transport.ErrAuthenticationRequired
+	})
+	require.Equal(transport.ErrAuthenticationRequired, err)
+	require.Equal(3, attempts)
+
+	// a nil Policies runs the function once
+	err = (*Policies)(nil).Run(ctx, func(context.Context) error {
+		return fmt.Errorf("foo")
+	})
+	require.EqualError(err, "foo")
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	var require = require.New(t)
+
+	p := &RetryPolicy{
+		MinBackoff: time.Second,
+		MaxBackoff: 10 * time.Second,
+		Factor:     3,
+	}
+
+	var backoffs []time.Duration
+	for retry := 1; retry <= 4; retry++ {
+		backoffs = append(backoffs, p.Backoff(retry))
+	}
+
+	require.Equal([]time.Duration{
+		time.Second, 3 * time.Second, 9 * time.Second, 10 * time.Second,
+	}, backoffs)
+
+	p = &RetryPolicy{MinBackoff: time.Second}
+	require.Equal(time.Second, p.Backoff(5))
+}
+
+type testPolicyJob struct {
+	testJob
+	policies *Policies
+}
+
+var _ PolicyJob = (*testPolicyJob)(nil)
+
+func (j *testPolicyJob) JobPolicies() *Policies {
+	return j.policies
+}
+
+func TestWorkerPoolPolicies(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 5)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{
+		Policies: &Policies{Retry: &RetryPolicy{Attempts: 2}},
+	})
+
+	wp.SetWorkers(1)
+	wp.Run()
+
+	var (
+		mu       sync.Mutex
+		attempts = map[string]int{}
+		process  = func(id string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts[id]++
+			return testTimeoutError{}
+		}
+	)
+
+	queue <- &testJob{id: "pool", process: process}
+	queue <- &testPolicyJob{
+		testJob:  testJob{id: "job", process: process},
+		policies: &Policies{Retry: &RetryPolicy{Attempts: 4}},
+	}
+	close(queue)
+
+	wp.Wait()
+	require.Equal(map[string]int{"pool": 2, "job": 4}, attempts)
+}
+
+func TestWorkerPoolJobTimeout(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 5)
+	mc := &testErrorMetrics{}
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{
+		Metrics:    mc,
+		JobTimeout: 10 * time.Millisecond,
+	})
+
+	wp.SetWorkers(1)
+	wp.Run()
+
+	// the stuck job is canceled and the worker processes the next one.
+	queue <- &testBlockingJob{started: make(chan struct{})}
+	queue <- &testJob{}
+	close(queue)
+
+	err := wp.WaitError()
+	require.Error(err)
+
+	runErr, ok := err.(*RunError)
+	require.True(ok)
+	require.Equal(1, runErr.Failed)
+	require.True(ErrJobTimeout.Is(runErr.Jobs[0]))
+
+	mc.Lock()
+	defer mc.Unlock()
+	require.Equal(1, mc.success)
+	require.Len(mc.failures, 1)
+	require.Equal(ErrorClassTimeout, mc.failures[0].Class)
+}
@@ -0,0 +1,82 @@
+package postprocess
+
+import (
+	"context"
+	"time"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// NewJobFn wraps the given library.JobFn to run the post-processing steps on
+// the location modified by each successful Job. The steps are submitted to
+// the Pool so the worker is released as soon as the wrapped function
+// finishes.
+func NewJobFn(pool *Pool, fn library.JobFn, steps ...Step) library.JobFn {
+	return func(ctx context.Context, job *library.Job) error {
+		if err := fn(ctx, job); err != nil {
+			return err
+		}
+
+		if len(steps) == 0 || job.LocationID == "" || job.Lib == nil ||
+			job.Annotations.NoUpdate(job.LocationID) {
+			return nil
+		}
+
+		var (
+			lib   = job.Lib
+			locID = job.LocationID
+			// the job can be reused, the logger is kept
+			logger = job.Logger
+		)
+
+		if logger == nil {
+			logger = log.New(nil)
+		}
+
+		logger = logger.New(log.Fields{
+			"job":      "postprocess",
+			"id":       job.ID,
+			"location": locID,
+		})
+
+		return pool.Submit(ctx, func(ctx context.Context) {
+			start := time.Now()
+			if err := process(ctx, lib, locID, steps); err != nil {
+				logger.Errorf(err, "failed")
+				return
+			}
+
+			elapsed := time.Since(start).String()
+			logger.With(log.Fields{"elapsed": elapsed}).
+				Debugf("finished")
+		})
+	}
+}
+
+func process(
+	ctx context.Context,
+	lib borges.Library,
+	locID borges.LocationID,
+	steps []Step,
+) error {
+	loc, err := lib.Location(locID)
+	if err != nil {
+		return err
+	}
+
+	repo, err := loc.Get("", borges.RWMode)
+	if err != nil {
+		return err
+	}
+
+	for _, step := range steps {
+		if err := step(ctx, repo.R(), repo.FS()); err != nil {
+			repo.Close()
+			return err
+		}
+	}
+
+	return repo.Commit()
+}
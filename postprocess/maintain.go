@@ -0,0 +1,229 @@
+package postprocess
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/go-borges"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// MaintainOpts represents configuration options for a maintenance run.
+type MaintainOpts struct {
+	// Steps are run on every location. The locations are opened read-only
+	// when there are no steps.
+	Steps []Step
+	// ReadOnly means the Steps don't modify the locations, so the
+	// locations are opened read-only.
+	ReadOnly bool
+	// Stats makes the report to include the locations statistics.
+	Stats bool
+	// Workers is the number of locations processed concurrently, default
+	// to GOMAXPROCS.
+	Workers int
+	// Logger is the logger used, default to log.New(nil).
+	Logger log.Logger
+	// Annotations keeps the Steps rewriting the locations, like the repacks,
+	// away from the ones marked as do-not-update.
+	Annotations *library.Annotations
+}
+
+// LocationReport is the result of the maintenance of a location.
+type LocationReport struct {
+	ID           borges.LocationID
+	Repositories int
+	References   int
+	Objects      int
+	Elapsed      time.Duration
+	Err          error
+	// Skipped is set when the location is marked as do-not-update and
+	// the Steps would have modified it.
+	Skipped bool
+}
+
+// MaintainReport is the result of a maintenance run.
+type MaintainReport struct {
+	Locations []*LocationReport
+	Failed    int
+	Skipped   int
+}
+
+// Maintain runs the steps on every location of the library without any
+// network access, so it can be used on offline copies of a library.
+func Maintain(
+	ctx context.Context,
+	lib borges.Library,
+	opts *MaintainOpts,
+) (*MaintainReport, error) {
+	if opts == nil {
+		opts = &MaintainOpts{}
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(nil)
+	}
+
+	iter, err := lib.Locations()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []borges.LocationID
+	err = iter.ForEach(func(l borges.Location) error {
+		ids = append(ids, l.ID())
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	mode := borges.RWMode
+	if opts.ReadOnly || len(opts.Steps) == 0 {
+		mode = borges.ReadOnlyMode
+	}
+
+	var (
+		mu     sync.Mutex
+		report = &MaintainReport{}
+		pool   = NewPool(&PoolOpts{Workers: opts.Workers})
+	)
+
+	for _, id := range ids {
+		id := id
+		err := pool.Submit(ctx, func(ctx context.Context) {
+			r := maintain(ctx, lib, id, mode, opts)
+
+			l := logger.New(log.Fields{"location": id})
+			if r.Err != nil {
+				l.Errorf(r.Err, "maintenance failed")
+			} else if r.Skipped {
+				l.Infof("skipped, location marked as do-not-update")
+			} else {
+				l.With(log.Fields{
+					"elapsed": r.Elapsed.String(),
+				}).Debugf("maintenance finished")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Locations = append(report.Locations, r)
+			if r.Err != nil {
+				report.Failed++
+			}
+
+			if r.Skipped {
+				report.Skipped++
+			}
+		})
+
+		if err != nil {
+			pool.Close(true)
+			return nil, err
+		}
+	}
+
+	pool.Close(false)
+
+	sort.Slice(report.Locations, func(i, j int) bool {
+		return report.Locations[i].ID < report.Locations[j].ID
+	})
+
+	return report, ctx.Err()
+}
+
+func maintain(
+	ctx context.Context,
+	lib borges.Library,
+	id borges.LocationID,
+	mode borges.Mode,
+	opts *MaintainOpts,
+) *LocationReport {
+	start := time.Now()
+	report := &LocationReport{ID: id}
+	defer func() { report.Elapsed = time.Since(start) }()
+
+	if mode == borges.RWMode && opts.Annotations.NoUpdate(id) {
+		report.Skipped = true
+		return report
+	}
+
+	loc, err := lib.Location(id)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+
+	repo, err := loc.Get("", mode)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+
+	for _, step := range opts.Steps {
+		if err := step(ctx, repo.R(), repo.FS()); err != nil {
+			repo.Close()
+			report.Err = err
+			return report
+		}
+	}
+
+	if opts.Stats {
+		if err := locationStats(repo.R(), report); err != nil {
+			repo.Close()
+			report.Err = err
+			return report
+		}
+	}
+
+	if mode == borges.ReadOnlyMode {
+		report.Err = repo.Close()
+		return report
+	}
+
+	report.Err = repo.Commit()
+	return report
+}
+
+func locationStats(repo *git.Repository, report *LocationReport) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+
+	report.Repositories = len(cfg.Remotes)
+
+	refs, err := repo.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		// siva files keep some placeholder references without hash
+		if ref.Type() == plumbing.HashReference && !ref.Hash().IsZero() {
+			report.References++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	objects, err := repo.Storer.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return err
+	}
+
+	return objects.ForEach(func(plumbing.EncodedObject) error {
+		report.Objects++
+		return nil
+	})
+}
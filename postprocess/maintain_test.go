@@ -0,0 +1,108 @@
+package postprocess
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func TestMaintain(t *testing.T) {
+	var require = require.New(t)
+
+	fs := memfs.New()
+	lib, err := siva.NewLibrary("test", fs, siva.LibraryOptions{
+		Transactional: true,
+		TempFS:        memfs.New(),
+	})
+	require.NoError(err)
+
+	for i, id := range []borges.LocationID{"foo", "bar"} {
+		loc, err := lib.AddLocation(id)
+		require.NoError(err)
+
+		repoID := borges.RepositoryID(fmt.Sprintf("github.com/src-d/%s", id))
+		r, err := loc.Init(repoID)
+		require.NoError(err)
+
+		for j := 0; j <= i; j++ {
+			sto := r.R().Storer
+			obj := sto.NewEncodedObject()
+			obj.SetType(plumbing.BlobObject)
+			w, err := obj.Writer()
+			require.NoError(err)
+			_, err = fmt.Fprintf(w, "%s %d", id, j)
+			require.NoError(err)
+			require.NoError(w.Close())
+
+			h, err := sto.SetEncodedObject(obj)
+			require.NoError(err)
+
+			require.NoError(sto.SetReference(plumbing.NewHashReference(
+				plumbing.ReferenceName(fmt.Sprintf(
+					"refs/remotes/%s/%d", repoID, j)),
+				h,
+			)))
+		}
+
+		require.NoError(r.Commit())
+	}
+
+	ctx := context.Background()
+	report, err := Maintain(ctx, lib, &MaintainOpts{
+		Steps:    []Step{VerifyObjects},
+		ReadOnly: true,
+		Stats:    true,
+		Workers:  2,
+	})
+	require.NoError(err)
+	require.Equal(0, report.Failed)
+	require.Len(report.Locations, 2)
+
+	bar, foo := report.Locations[0], report.Locations[1]
+	require.Equal(borges.LocationID("bar"), bar.ID)
+	require.Equal(1, bar.Repositories)
+	require.Equal(2, bar.References)
+	require.Equal(2, bar.Objects)
+	require.Equal(borges.LocationID("foo"), foo.ID)
+	require.Equal(1, foo.References)
+	require.Equal(1, foo.Objects)
+
+	report, err = Maintain(ctx, lib, &MaintainOpts{
+		Steps: []Step{Repack, VerifyObjects},
+		Stats: true,
+	})
+	require.NoError(err)
+	require.Equal(0, report.Failed)
+	require.Equal(2, report.Locations[0].Objects)
+
+	annotations := library.NewAnnotations(fs)
+	require.NoError(annotations.Set(&library.Annotation{
+		LocationID: "foo",
+		NoUpdate:   true,
+	}))
+
+	report, err = Maintain(ctx, lib, &MaintainOpts{
+		Steps:       []Step{Repack},
+		Annotations: annotations,
+	})
+	require.NoError(err)
+	require.Equal(1, report.Skipped)
+	require.False(report.Locations[0].Skipped)
+	require.True(report.Locations[1].Skipped)
+
+	// read-only tasks don't modify the locations.
+	report, err = Maintain(ctx, lib, &MaintainOpts{
+		Steps:       []Step{VerifyObjects},
+		ReadOnly:    true,
+		Annotations: annotations,
+	})
+	require.NoError(err)
+	require.Equal(0, report.Skipped)
+}
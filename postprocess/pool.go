@@ -0,0 +1,108 @@
+package postprocess
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrPoolClosed is returned when a task is submitted to a closed Pool.
+var ErrPoolClosed = errors.NewKind("post-processing pool is closed")
+
+// Task is a CPU bound piece of work run by a Pool.
+type Task func(context.Context)
+
+// PoolOpts represents configuration options for a Pool.
+type PoolOpts struct {
+	// Workers is the number of tasks run concurrently, default to
+	// GOMAXPROCS.
+	Workers int
+	// Queue is the number of submitted tasks waiting to run before Submit
+	// blocks.
+	Queue int
+}
+
+// Pool runs CPU bound tasks with a bounded concurrency, independent of the
+// number of workers processing gitcollector.Jobs.
+type Pool struct {
+	mu     sync.RWMutex
+	tasks  chan Task
+	closed bool
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewPool builds and starts a new Pool.
+func NewPool(opts *PoolOpts) *Pool {
+	if opts == nil {
+		opts = &PoolOpts{}
+	}
+
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(-1)
+	}
+
+	if opts.Queue < 0 {
+		opts.Queue = 0
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		tasks:  make(chan Task, opts.Queue),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	p.wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for task := range p.tasks {
+				task(p.ctx)
+			}
+		}()
+	}
+
+	return p
+}
+
+// Submit queues the given task, blocking while the queue is full.
+func (p *Pool) Submit(ctx context.Context, task Task) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrPoolClosed.New()
+	}
+
+	select {
+	case p.tasks <- task:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close waits for the submitted tasks to finish. If immediate is true the
+// context passed to the running tasks is canceled.
+func (p *Pool) Close(immediate bool) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+
+	p.closed = true
+	close(p.tasks)
+	p.mu.Unlock()
+
+	if immediate {
+		p.cancel()
+	}
+
+	p.wg.Wait()
+	p.cancel()
+}
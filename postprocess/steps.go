@@ -0,0 +1,143 @@
+package postprocess
+
+import (
+	"context"
+	"io"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/commitgraph"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+var (
+	// ErrCorruptedObject is returned when the content of an object
+	// doesn't match its hash.
+	ErrCorruptedObject = errors.NewKind("object %s is corrupted: hash %s")
+
+	// ErrNoFilesystem is returned when a step needs to write files but
+	// the repository doesn't provide a filesystem.
+	ErrNoFilesystem = errors.NewKind("repository filesystem not available")
+)
+
+// Step is a post-processing operation performed on a repository. Changes
+// written to the repository filesystem are committed once all the steps
+// succeed.
+type Step func(context.Context, *git.Repository, billy.Filesystem) error
+
+// VerifyObjects is a Step checking that the content of every object of the
+// repository matches its hash.
+func VerifyObjects(
+	ctx context.Context,
+	repo *git.Repository,
+	_ billy.Filesystem,
+) error {
+	iter, err := repo.Storer.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return err
+	}
+
+	return iter.ForEach(func(obj plumbing.EncodedObject) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		r, err := obj.Reader()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		hasher := plumbing.NewHasher(obj.Type(), obj.Size())
+		if _, err := io.Copy(hasher, r); err != nil {
+			return err
+		}
+
+		if sum := hasher.Sum(); sum != obj.Hash() {
+			return ErrCorruptedObject.New(obj.Hash(), sum)
+		}
+
+		return nil
+	})
+}
+
+// CommitGraphFile is the path of the commit-graph file in a repository.
+const CommitGraphFile = "objects/info/commit-graph"
+
+// WriteCommitGraph is a Step generating the commit-graph file of the
+// repository.
+func WriteCommitGraph(
+	ctx context.Context,
+	repo *git.Repository,
+	fs billy.Filesystem,
+) error {
+	if fs == nil {
+		return ErrNoFilesystem.New()
+	}
+
+	iter, err := repo.Storer.IterEncodedObjects(plumbing.CommitObject)
+	if err != nil {
+		return err
+	}
+
+	idx := commitgraph.NewMemoryIndex()
+	err = iter.ForEach(func(obj plumbing.EncodedObject) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		c, err := object.DecodeCommit(repo.Storer, obj)
+		if err != nil {
+			return err
+		}
+
+		idx.Add(c.Hash, &commitgraph.CommitData{
+			TreeHash:     c.TreeHash,
+			ParentHashes: c.ParentHashes,
+			When:         c.Committer.When,
+		})
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	tmp := CommitGraphFile + ".tmp"
+	f, err := fs.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := commitgraph.NewEncoder(f).Encode(idx); err != nil {
+		f.Close()
+		fs.Remove(tmp)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		fs.Remove(tmp)
+		return err
+	}
+
+	return fs.Rename(tmp, CommitGraphFile)
+}
+
+// Repack is a Step packing all the objects of the repository into a single
+// packfile. Storages without support for packed objects, like the siva files,
+// are left untouched.
+func Repack(
+	_ context.Context,
+	repo *git.Repository,
+	_ billy.Filesystem,
+) error {
+	err := repo.RepackObjects(&git.RepackConfig{})
+	if err == git.ErrPackedObjectsNotSupported {
+		return nil
+	}
+
+	return err
+}
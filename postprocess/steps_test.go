@@ -0,0 +1,95 @@
+package postprocess
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+func TestSteps(t *testing.T) {
+	var require = require.New(t)
+
+	dotgit, wt := memfs.New(), memfs.New()
+	sto := filesystem.NewStorage(dotgit, cache.NewObjectLRUDefault())
+	repo, err := git.Init(sto, wt)
+	require.NoError(err)
+
+	w, err := repo.Worktree()
+	require.NoError(err)
+
+	for _, content := range []string{"foo", "bar"} {
+		require.NoError(util.WriteFile(wt, "file", []byte(content), 0644))
+		_, err = w.Add("file")
+		require.NoError(err)
+
+		_, err = w.Commit(content, &git.CommitOptions{
+			Author: &object.Signature{
+				Name:  "foo",
+				Email: "foo@bar.com",
+				When:  time.Now(),
+			},
+		})
+		require.NoError(err)
+	}
+
+	ctx := context.Background()
+	require.NoError(VerifyObjects(ctx, repo, dotgit))
+	require.NoError(WriteCommitGraph(ctx, repo, dotgit))
+
+	_, err = dotgit.Stat(CommitGraphFile)
+	require.NoError(err)
+
+	require.NoError(Repack(ctx, repo, dotgit))
+	require.NoError(VerifyObjects(ctx, repo, dotgit))
+
+	require.True(ErrNoFilesystem.Is(WriteCommitGraph(ctx, repo, nil)))
+}
+
+func TestPool(t *testing.T) {
+	var require = require.New(t)
+
+	pool := NewPool(&PoolOpts{Workers: 2})
+
+	var (
+		mu      sync.Mutex
+		running int
+		maxRun  int
+		done    int
+	)
+
+	for i := 0; i < 6; i++ {
+		require.NoError(pool.Submit(context.Background(),
+			func(context.Context) {
+				mu.Lock()
+				running++
+				if running > maxRun {
+					maxRun = running
+				}
+				mu.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				mu.Lock()
+				running--
+				done++
+				mu.Unlock()
+			},
+		))
+	}
+
+	pool.Close(false)
+	require.Equal(6, done)
+	require.Equal(2, maxRun)
+
+	err := pool.Submit(context.Background(), func(context.Context) {})
+	require.True(ErrPoolClosed.Is(err))
+}
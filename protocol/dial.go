@@ -0,0 +1,414 @@
+package protocol
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrNoAddress is returned when a host isn't resolved to any address.
+var ErrNoAddress = errors.NewKind("no address found for %s")
+
+// Resolver looks up the addresses of a host, like a net.Resolver.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// ResolveFn looks up the current addresses of a host.
+type ResolveFn func(ctx context.Context) ([]string, error)
+
+// DialPolicy chooses the addresses dialed for a host and learns from the
+// outcome of every connection, so the hosts with flaky DNS or bad edge
+// addresses are fetched from the working ones.
+type DialPolicy interface {
+	// Addrs returns the addresses to dial for the host, in order. The
+	// given ResolveFn looks up the host, it doesn't need to be called if
+	// the policy already knows where to connect.
+	Addrs(ctx context.Context, host string, resolve ResolveFn) ([]string, error)
+	// Report is called with the outcome of dialing an address of the
+	// host, err is nil if the connection was established.
+	Report(host, addr string, err error)
+}
+
+// DialerOpts represents configuration options for a Dialer.
+type DialerOpts struct {
+	// Policy chooses the addresses dialed, default to a ReresolvePolicy.
+	Policy DialPolicy
+	// Resolvers look up the hosts in order, the next one is used when a
+	// lookup fails. Every retry starts with the next resolver, so the
+	// alternate ones are also asked once the addresses of the first one
+	// failed. Default to net.DefaultResolver.
+	Resolvers []Resolver
+	// Dial connects to an address, default to a net.Dialer.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	// Retries is the number of times a host is resolved and dialed again
+	// once every address failed, default to 2.
+	Retries int
+	// RetryDelay is the time to wait between retries, default to 1s.
+	RetryDelay time.Duration
+	// Proxy returns the proxy of the requests made by the Client, default
+	// to http.ProxyFromEnvironment.
+	Proxy func(*http.Request) (*url.URL, error)
+}
+
+const (
+	dialRetries    = 2
+	dialRetryDelay = time.Second
+	dialTimeout    = 30 * time.Second
+	dialKeepAlive  = 30 * time.Second
+	dialCooldown   = 5 * time.Minute
+)
+
+// AddrStats are the connections made to an address of a host.
+type AddrStats struct {
+	Host     string
+	Addr     string
+	Dials    uint64
+	Failures uint64
+	// LastError is the error of the last failed connection.
+	LastError string
+}
+
+type addrKey struct {
+	host string
+	addr string
+}
+
+// Dialer connects to the hosts trying the addresses chosen by its
+// DialPolicy, resolving them again when all of them fail, and keeps the
+// AddrStats of every address dialed.
+type Dialer struct {
+	opts *DialerOpts
+
+	mu    sync.Mutex
+	stats map[addrKey]*AddrStats
+}
+
+// NewDialer builds a new Dialer.
+func NewDialer(opts *DialerOpts) *Dialer {
+	if opts == nil {
+		opts = &DialerOpts{}
+	}
+
+	if opts.Policy == nil {
+		opts.Policy = NewReresolvePolicy(0)
+	}
+
+	if len(opts.Resolvers) == 0 {
+		opts.Resolvers = []Resolver{net.DefaultResolver}
+	}
+
+	if opts.Dial == nil {
+		opts.Dial = (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: dialKeepAlive,
+		}).DialContext
+	}
+
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	} else if opts.Retries == 0 {
+		opts.Retries = dialRetries
+	}
+
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = dialRetryDelay
+	}
+
+	if opts.Proxy == nil {
+		opts.Proxy = http.ProxyFromEnvironment
+	}
+
+	return &Dialer{
+		opts:  opts,
+		stats: map[addrKey]*AddrStats{},
+	}
+}
+
+// DialContext connects to the address on the named network, as
+// net.Dialer.DialContext. The addresses with an IP are dialed directly.
+func (d *Dialer) DialContext(
+	ctx context.Context,
+	network, address string,
+) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if net.ParseIP(host) != nil {
+		return d.opts.Dial(ctx, network, address)
+	}
+
+	var lastErr error
+	for i := 0; i <= d.opts.Retries; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(d.opts.RetryDelay):
+			}
+		}
+
+		addrs, err := d.opts.Policy.Addrs(ctx, host, d.resolveFn(host, i))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		for _, addr := range addrs {
+			conn, err := d.opts.Dial(ctx, network, net.JoinHostPort(addr, port))
+			d.opts.Policy.Report(host, addr, err)
+			d.record(host, addr, err)
+			if err == nil {
+				return conn, nil
+			}
+
+			lastErr = err
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	return nil, lastErr
+}
+
+// resolveFn returns the ResolveFn of the given attempt, asking the resolvers
+// starting by the one of the attempt.
+func (d *Dialer) resolveFn(host string, attempt int) ResolveFn {
+	return func(ctx context.Context) ([]string, error) {
+		var lastErr error
+		resolvers := d.opts.Resolvers
+		for i := range resolvers {
+			r := resolvers[(attempt+i)%len(resolvers)]
+			addrs, err := r.LookupHost(ctx, host)
+			if err == nil && len(addrs) > 0 {
+				return addrs, nil
+			}
+
+			lastErr = err
+		}
+
+		if lastErr == nil {
+			lastErr = ErrNoAddress.New(host)
+		}
+
+		return nil, lastErr
+	}
+}
+
+func (d *Dialer) record(host, addr string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := addrKey{host: host, addr: addr}
+	s, ok := d.stats[key]
+	if !ok {
+		s = &AddrStats{Host: host, Addr: addr}
+		d.stats[key] = s
+	}
+
+	s.Dials++
+	if err != nil {
+		s.Failures++
+		s.LastError = err.Error()
+	}
+}
+
+// Stats returns the AddrStats of every address dialed, the ones with more
+// failures first.
+func (d *Dialer) Stats() []AddrStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := make([]AddrStats, 0, len(d.stats))
+	for _, s := range d.stats {
+		stats = append(stats, *s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Failures != stats[j].Failures {
+			return stats[i].Failures > stats[j].Failures
+		}
+
+		if stats[i].Host != stats[j].Host {
+			return stats[i].Host < stats[j].Host
+		}
+
+		return stats[i].Addr < stats[j].Addr
+	})
+
+	return stats
+}
+
+// Client returns an http.Client connecting with the Dialer, configured as
+// the http.DefaultTransport otherwise.
+func (d *Dialer) Client() *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		Proxy:                 d.opts.Proxy,
+		DialContext:           d.DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}}
+}
+
+// NewNameserverResolver returns a Resolver asking the DNS server at the given
+// address, as host:port, instead of the system one.
+func NewNameserverResolver(addr string) *net.Resolver {
+	var d net.Dialer
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// ReresolvePolicy is a DialPolicy resolving the host on every connection and
+// dialing the addresses that failed recently after the rest.
+type ReresolvePolicy struct {
+	cooldown time.Duration
+
+	mu     sync.Mutex
+	failed map[addrKey]time.Time
+}
+
+var _ DialPolicy = (*ReresolvePolicy)(nil)
+
+// NewReresolvePolicy builds a new ReresolvePolicy avoiding the addresses
+// failed during the given cooldown, 5 minutes by default.
+func NewReresolvePolicy(cooldown time.Duration) *ReresolvePolicy {
+	if cooldown <= 0 {
+		cooldown = dialCooldown
+	}
+
+	return &ReresolvePolicy{
+		cooldown: cooldown,
+		failed:   map[addrKey]time.Time{},
+	}
+}
+
+// Addrs implements the DialPolicy interface.
+func (p *ReresolvePolicy) Addrs(
+	ctx context.Context,
+	host string,
+	resolve ResolveFn,
+) ([]string, error) {
+	addrs, err := resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var good, bad []string
+	for _, addr := range addrs {
+		key := addrKey{host: host, addr: addr}
+		if t, ok := p.failed[key]; ok && time.Since(t) < p.cooldown {
+			bad = append(bad, addr)
+			continue
+		}
+
+		delete(p.failed, key)
+		good = append(good, addr)
+	}
+
+	return append(good, bad...), nil
+}
+
+// Report implements the DialPolicy interface.
+func (p *ReresolvePolicy) Report(host, addr string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := addrKey{host: host, addr: addr}
+	if err != nil {
+		p.failed[key] = time.Now()
+	} else {
+		delete(p.failed, key)
+	}
+}
+
+// PinPolicy is a DialPolicy pinning every host to the first address it's
+// connected to for the rest of the run, so the host isn't resolved again.
+// The pin is dropped if the address fails, resolving the host again with a
+// ReresolvePolicy.
+type PinPolicy struct {
+	fallback *ReresolvePolicy
+
+	mu   sync.Mutex
+	pins map[string]string
+}
+
+var _ DialPolicy = (*PinPolicy)(nil)
+
+// NewPinPolicy builds a new PinPolicy with the given pins of the hosts to
+// their addresses, they can be nil.
+func NewPinPolicy(pins map[string]string) *PinPolicy {
+	p := &PinPolicy{
+		fallback: NewReresolvePolicy(0),
+		pins:     map[string]string{},
+	}
+
+	for host, addr := range pins {
+		p.pins[host] = addr
+	}
+
+	return p
+}
+
+// Addrs implements the DialPolicy interface.
+func (p *PinPolicy) Addrs(
+	ctx context.Context,
+	host string,
+	resolve ResolveFn,
+) ([]string, error) {
+	p.mu.Lock()
+	addr, ok := p.pins[host]
+	p.mu.Unlock()
+
+	if ok {
+		return []string{addr}, nil
+	}
+
+	return p.fallback.Addrs(ctx, host, resolve)
+}
+
+// Report implements the DialPolicy interface.
+func (p *PinPolicy) Report(host, addr string, err error) {
+	p.fallback.Report(host, addr, err)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pinned, ok := p.pins[host]
+	switch {
+	case err == nil && !ok:
+		p.pins[host] = addr
+	case err != nil && ok && pinned == addr:
+		delete(p.pins, host)
+	}
+}
+
+// Pins returns the address every host is pinned to.
+func (p *PinPolicy) Pins() map[string]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pins := make(map[string]string, len(p.pins))
+	for host, addr := range p.pins {
+		pins[host] = addr
+	}
+
+	return pins
+}
@@ -0,0 +1,165 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testResolver struct {
+	addrs []string
+	err   error
+	calls int
+}
+
+func (r *testResolver) LookupHost(
+	_ context.Context,
+	host string,
+) ([]string, error) {
+	r.calls++
+	return r.addrs, r.err
+}
+
+// testDial fails connecting to the given addresses and keeps the ones dialed.
+type testDial struct {
+	mu     sync.Mutex
+	bad    map[string]bool
+	dialed []string
+}
+
+func (d *testDial) dial(
+	_ context.Context,
+	network, addr string,
+) (net.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.dialed = append(d.dialed, addr)
+	if d.bad[addr] {
+		return nil, fmt.Errorf("connection refused")
+	}
+
+	c, _ := net.Pipe()
+	return c, nil
+}
+
+func TestDialerReresolve(t *testing.T) {
+	var require = require.New(t)
+
+	dns := &testResolver{addrs: []string{"10.0.0.1", "10.0.0.2"}}
+	dial := &testDial{bad: map[string]bool{"10.0.0.1:443": true}}
+	d := NewDialer(&DialerOpts{
+		Resolvers: []Resolver{dns},
+		Dial:      dial.dial,
+	})
+
+	for i := 0; i < 2; i++ {
+		conn, err := d.DialContext(context.Background(), "tcp", "host:443")
+		require.NoError(err)
+		require.NoError(conn.Close())
+	}
+
+	// the failed address is dialed last once it failed
+	require.Equal([]string{
+		"10.0.0.1:443", "10.0.0.2:443", "10.0.0.2:443",
+	}, dial.dialed)
+	require.Equal(2, dns.calls)
+
+	require.Equal([]AddrStats{
+		{
+			Host:      "host",
+			Addr:      "10.0.0.1",
+			Dials:     1,
+			Failures:  1,
+			LastError: "connection refused",
+		},
+		{Host: "host", Addr: "10.0.0.2", Dials: 2},
+	}, d.Stats())
+
+	// the addresses with an IP are dialed directly
+	conn, err := d.DialContext(context.Background(), "tcp", "10.0.0.3:80")
+	require.NoError(err)
+	require.NoError(conn.Close())
+	require.Equal(2, dns.calls)
+}
+
+func TestDialerAlternateResolver(t *testing.T) {
+	var require = require.New(t)
+
+	broken := &testResolver{err: fmt.Errorf("no such host")}
+	stale := &testResolver{addrs: []string{"10.0.0.1"}}
+	alternate := &testResolver{addrs: []string{"10.0.0.2"}}
+	dial := &testDial{bad: map[string]bool{"10.0.0.1:443": true}}
+
+	d := NewDialer(&DialerOpts{
+		Resolvers: []Resolver{broken, alternate},
+		Dial:      dial.dial,
+	})
+
+	conn, err := d.DialContext(context.Background(), "tcp", "host:443")
+	require.NoError(err)
+	require.NoError(conn.Close())
+	require.Equal([]string{"10.0.0.2:443"}, dial.dialed)
+
+	// a retry resolves the host with the next resolver
+	dial.dialed = nil
+	d = NewDialer(&DialerOpts{
+		Resolvers:  []Resolver{stale, alternate},
+		Dial:       dial.dial,
+		RetryDelay: time.Millisecond,
+	})
+
+	conn, err = d.DialContext(context.Background(), "tcp", "host:443")
+	require.NoError(err)
+	require.NoError(conn.Close())
+	require.Equal([]string{"10.0.0.1:443", "10.0.0.2:443"}, dial.dialed)
+
+	// every attempt fails
+	d = NewDialer(&DialerOpts{
+		Resolvers:  []Resolver{broken},
+		Dial:       dial.dial,
+		Retries:    1,
+		RetryDelay: time.Millisecond,
+	})
+
+	_, err = d.DialContext(context.Background(), "tcp", "host:443")
+	require.EqualError(err, "no such host")
+	require.Equal(3, broken.calls)
+}
+
+func TestPinPolicy(t *testing.T) {
+	var require = require.New(t)
+
+	dns := &testResolver{addrs: []string{"10.0.0.1", "10.0.0.2"}}
+	dial := &testDial{bad: map[string]bool{}}
+	pins := NewPinPolicy(nil)
+	d := NewDialer(&DialerOpts{
+		Policy:     pins,
+		Resolvers:  []Resolver{dns},
+		Dial:       dial.dial,
+		RetryDelay: time.Millisecond,
+	})
+
+	for i := 0; i < 3; i++ {
+		conn, err := d.DialContext(context.Background(), "tcp", "host:443")
+		require.NoError(err)
+		require.NoError(conn.Close())
+	}
+
+	// the host is only resolved until it's pinned
+	require.Equal(1, dns.calls)
+	require.Equal(map[string]string{"host": "10.0.0.1"}, pins.Pins())
+
+	// the pin is dropped once the address fails
+	dial.bad["10.0.0.1:443"] = true
+	conn, err := d.DialContext(context.Background(), "tcp", "host:443")
+	require.NoError(err)
+	require.NoError(conn.Close())
+	require.Equal(2, dns.calls)
+	require.Equal(map[string]string{"host": "10.0.0.2"}, pins.Pins())
+}
@@ -0,0 +1,58 @@
+package protocol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// delimPkt separates the sections of the protocol v2 messages, it's rejected
+// by the go-git pktline scanner so the responses are read by readLine.
+const delimPkt = "0001"
+
+var (
+	errFlush = fmt.Errorf("flush-pkt")
+	errDelim = fmt.Errorf("delim-pkt")
+)
+
+// readLine reads a pkt-line returning its payload without the trailing
+// newline. The flush, delim and response-end pkts are returned as errFlush,
+// errDelim and errFlush respectively, and ERR lines as errors.
+func readLine(r *bufio.Reader) (string, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return "", err
+	}
+
+	n, err := strconv.ParseUint(string(size[:]), 16, 16)
+	if err != nil {
+		return "", ErrUnexpectedResponse.New(fmt.Sprintf("pkt-len %q", size))
+	}
+
+	switch n {
+	case 0, 2:
+		return "", errFlush
+	case 1:
+		return "", errDelim
+	case 3:
+		return "", ErrUnexpectedResponse.New("pkt-len 0003")
+	}
+
+	payload := make([]byte, n-4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", err
+	}
+
+	line := strings.TrimSuffix(string(payload), "\n")
+	if strings.HasPrefix(line, "ERR ") {
+		return "", ErrUnexpectedResponse.New(strings.TrimPrefix(line, "ERR "))
+	}
+
+	return line, nil
+}
@@ -0,0 +1,138 @@
+// Package protocol provides a go-git transport fetching with the git protocol
+// version 2 over smart HTTP from the hosts configured for it. Some servers
+// only perform acceptably when the references are filtered by the server,
+// which the protocol v0 spoken by go-git can't do.
+package protocol
+
+import (
+	"fmt"
+	"net/http"
+
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+var (
+	// ErrNotSupported is returned when a feature configured for a host
+	// isn't advertised by its server.
+	ErrNotSupported = errors.NewKind("%s doesn't support %s")
+
+	// ErrAuthNotSupported is returned when the authentication method
+	// can't be used by the protocol v2 transport.
+	ErrAuthNotSupported = errors.NewKind(
+		"authentication %s not supported by the protocol v2 transport")
+
+	// ErrUnexpectedResponse is returned when a server response doesn't
+	// follow the protocol v2.
+	ErrUnexpectedResponse = errors.NewKind(
+		"unexpected protocol v2 response: %s")
+)
+
+// HostOpts represents the configuration of the fetches from a host.
+type HostOpts struct {
+	// Version is the protocol version spoken with the host, 2 for the
+	// protocol v2. Any other version uses the go-git transport.
+	Version int
+	// RefPrefixes filter the references listed by the server, all of
+	// them are listed if empty. HEAD is always listed.
+	RefPrefixes []string
+	// ServerOptions are passed to the server with every command, the
+	// server must advertise the server-option capability.
+	ServerOptions []string
+	// Filter is the object filter of the fetches, like blob:none, the
+	// server must advertise the filter feature. The objects filtered out
+	// are missing from the stored repositories.
+	Filter string
+}
+
+// Hosts are the HostOpts by host of the endpoints, as host:port or just host
+// for any port. The ones with an empty host apply to the hosts not found.
+type Hosts map[string]*HostOpts
+
+func (h Hosts) get(ep *transport.Endpoint) *HostOpts {
+	if ep.Port != 0 {
+		if opts, ok := h[fmt.Sprintf("%s:%d", ep.Host, ep.Port)]; ok {
+			return opts
+		}
+	}
+
+	if opts, ok := h[ep.Host]; ok {
+		return opts
+	}
+
+	return h[""]
+}
+
+// Transport is a go-git transport.Transport for the smart HTTP endpoints. It
+// speaks the protocol v2 with the hosts configured for it and delegates the
+// rest, as well as the pushes, to the go-git HTTP transport. The servers not
+// answering with the protocol v2 are also fetched with the go-git transport.
+type Transport struct {
+	hosts    Hosts
+	client   *http.Client
+	fallback transport.Transport
+}
+
+var _ transport.Transport = (*Transport)(nil)
+
+// NewTransport builds a new Transport making the requests with the given
+// client, http.DefaultClient if nil.
+func NewTransport(hosts Hosts, c *http.Client) *Transport {
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	return &Transport{
+		hosts:    hosts,
+		client:   c,
+		fallback: githttp.NewClient(c),
+	}
+}
+
+// NewUploadPackSession implements the transport.Transport interface.
+func (t *Transport) NewUploadPackSession(
+	ep *transport.Endpoint,
+	auth transport.AuthMethod,
+) (transport.UploadPackSession, error) {
+	opts := t.hosts.get(ep)
+	if opts == nil || opts.Version != 2 {
+		return t.fallback.NewUploadPackSession(ep, auth)
+	}
+
+	fallback, err := t.fallback.NewUploadPackSession(ep, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session{
+		client:   t.client,
+		ep:       ep,
+		auth:     auth,
+		opts:     opts,
+		fallback: fallback,
+	}, nil
+}
+
+// NewReceivePackSession implements the transport.Transport interface.
+func (t *Transport) NewReceivePackSession(
+	ep *transport.Endpoint,
+	auth transport.AuthMethod,
+) (transport.ReceivePackSession, error) {
+	return t.fallback.NewReceivePackSession(ep, auth)
+}
+
+// Install registers a Transport with the given hosts for the http and https
+// endpoints of go-git. The protocols are registered globally.
+func Install(hosts Hosts, c *http.Client) {
+	t := NewTransport(hosts, c)
+	client.InstallProtocol("http", t)
+	client.InstallProtocol("https", t)
+}
+
+// Uninstall restores the go-git HTTP transport.
+func Uninstall() {
+	client.InstallProtocol("http", githttp.DefaultClient)
+	client.InstallProtocol("https", githttp.DefaultClient)
+}
@@ -0,0 +1,240 @@
+package protocol
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func TestTransport(t *testing.T) {
+	var require = require.New(t)
+
+	server, versions := gitServer(t)
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	require.NoError(err)
+	endpoint := server.URL + "/repo.git"
+
+	Install(Hosts{u.Host: {
+		Version:       2,
+		RefPrefixes:   []string{"refs/heads/master"},
+		ServerOptions: []string{"foo=bar"},
+	}}, nil)
+	defer Uninstall()
+
+	// only the references with the prefixes are listed
+	ep, err := transport.NewEndpoint(endpoint)
+	require.NoError(err)
+	s, err := NewTransport(Hosts{"": {
+		Version:     2,
+		RefPrefixes: []string{"refs/heads/master"},
+	}}, nil).NewUploadPackSession(ep, nil)
+	require.NoError(err)
+	ar, err := s.AdvertisedReferences()
+	require.NoError(err)
+	require.NotNil(ar.Head)
+	require.Len(ar.References, 1)
+	require.Contains(ar.References, "refs/heads/master")
+	require.NoError(s.Close())
+
+	r, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL: endpoint,
+	})
+	require.NoError(err)
+
+	head, err := r.Head()
+	require.NoError(err)
+	require.Equal(plumbing.ReferenceName("refs/heads/master"), head.Name())
+
+	commit, err := r.CommitObject(head.Hash())
+	require.NoError(err)
+	_, err = commit.File("README")
+	require.NoError(err)
+	require.Equal("version=2", versions.last())
+
+	// the shallow updates are read from the response
+	r, err = git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL:   endpoint,
+		Depth: 1,
+	})
+	require.NoError(err)
+
+	shallows, err := r.Storer.Shallow()
+	require.NoError(err)
+	require.Equal([]plumbing.Hash{head.Hash()}, shallows)
+
+	// the servers not answering with the protocol v2 are fetched with v0
+	server.v0(true)
+	_, err = git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL: endpoint,
+	})
+	require.NoError(err)
+	server.v0(false)
+
+	// the filtered out objects aren't fetched
+	Install(Hosts{"": {Version: 2, Filter: "blob:none"}}, nil)
+	_, err = git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL: endpoint,
+	})
+	require.True(ErrNotSupported.Is(err))
+
+	require.NoError(exec.Command("git", "-C", server.root,
+		"config", "uploadpack.allowFilter", "true").Run())
+	r, err = git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL: endpoint,
+	})
+	require.NoError(err)
+
+	ref, err := r.Reference("refs/remotes/origin/other", true)
+	require.NoError(err)
+
+	commit, err = r.CommitObject(ref.Hash())
+	require.NoError(err)
+	_, err = commit.File("README")
+	require.Error(err)
+
+	// the rest of the hosts use the go-git transport
+	versions.reset()
+	Install(Hosts{"example.com": {Version: 2}}, nil)
+	_, err = git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL: endpoint,
+	})
+	require.NoError(err)
+	require.Equal("", versions.last())
+}
+
+type testServer struct {
+	*httptest.Server
+	dir  string
+	root string
+
+	mu     sync.Mutex
+	stripV bool
+}
+
+// v0 makes the server ignore the protocol version requested.
+func (s *testServer) v0(v0 bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stripV = v0
+}
+
+func (s *testServer) Close() {
+	s.Server.Close()
+	os.RemoveAll(s.dir)
+}
+
+type protocolVersions struct {
+	mu       sync.Mutex
+	versions []string
+}
+
+func (v *protocolVersions) add(version string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.versions = append(v.versions, version)
+}
+
+func (v *protocolVersions) last() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.versions) == 0 {
+		return ""
+	}
+
+	return v.versions[len(v.versions)-1]
+}
+
+func (v *protocolVersions) reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.versions = nil
+}
+
+// gitServer serves a repository with a master and an other branch using the
+// git http-backend, recording the protocol version requested.
+func gitServer(t *testing.T) (*testServer, *protocolVersions) {
+	out, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		t.Skip("git not found")
+	}
+
+	backend := filepath.Join(strings.TrimSpace(string(out)), "git-http-backend")
+	if _, err := os.Stat(backend); err != nil {
+		t.Skip("git http-backend not found")
+	}
+
+	dir, err := ioutil.TempDir("", "gitcollector-protocol")
+	require.NoError(t, err)
+
+	work := filepath.Join(dir, "work")
+	root := filepath.Join(dir, "repo.git")
+	for _, args := range [][]string{
+		{"init", "-q", work},
+		{"-C", work, "checkout", "-q", "-b", "master"},
+		{"-C", work, "commit", "-q", "--allow-empty", "-m", "empty"},
+		{"-C", work, "branch", "other"},
+		{"-C", work, "add", "README"},
+		{"-C", work, "commit", "-q", "-m", "readme"},
+		{"-C", work, "checkout", "-q", "other"},
+		{"-C", work, "add", "README"},
+		{"-C", work, "commit", "-q", "-m", "readme"},
+		{"-C", work, "checkout", "-q", "master"},
+		{"-C", work, "tag", "v1"},
+		{"clone", "-q", "--bare", work, root},
+	} {
+		if len(args) > 2 && args[2] == "add" {
+			require.NoError(t, ioutil.WriteFile(
+				filepath.Join(work, "README"), []byte("readme\n"), 0644))
+		}
+
+		cmd := exec.Command("git", args...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	s := &testServer{dir: dir, root: root}
+	versions := &protocolVersions{}
+	handler := &cgi.Handler{
+		Path: backend,
+		Env: []string{
+			"GIT_PROJECT_ROOT=" + dir,
+			"GIT_HTTP_EXPORT_ALL=1",
+		},
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			versions.add(r.Header.Get(versionHeader))
+
+			s.mu.Lock()
+			if s.stripV {
+				r.Header.Del(versionHeader)
+			}
+			s.mu.Unlock()
+
+			handler.ServeHTTP(w, r)
+		},
+	))
+
+	return s, versions
+}
@@ -0,0 +1,513 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/sideband"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+const (
+	versionHeader   = "Git-Protocol"
+	versionV2       = "version=2"
+	requestType     = "application/x-git-upload-pack-request"
+	resultType      = "application/x-git-upload-pack-result"
+	capServerOption = "server-option"
+	capLsRefs       = "ls-refs"
+	capFetch        = "fetch"
+	featureShallow  = "shallow"
+	featureFilter   = "filter"
+)
+
+// session is a transport.UploadPackSession speaking the protocol v2. The
+// references are listed with the ls-refs command and the objects fetched
+// with the fetch command, translated from and to the protocol v0 structures
+// go-git works with. The wants are always sent by object ID, go-git resolves
+// the references to fetch from the advertised ones, so the want-ref feature
+// isn't used.
+type session struct {
+	client   *http.Client
+	ep       *transport.Endpoint
+	auth     transport.AuthMethod
+	opts     *HostOpts
+	fallback transport.UploadPackSession
+
+	once sync.Once
+	err  error
+	v2   bool
+	caps map[string]string
+}
+
+var _ transport.UploadPackSession = (*session)(nil)
+
+// discover requests the capabilities of the server once. The fallback
+// session is used from then on if the server doesn't speak the protocol v2.
+func (s *session) discover(ctx context.Context) error {
+	s.once.Do(func() {
+		s.caps, s.err = s.requestCapabilities(ctx)
+		s.v2 = s.err == nil && s.caps != nil
+	})
+
+	return s.err
+}
+
+func (s *session) requestCapabilities(
+	ctx context.Context,
+) (map[string]string, error) {
+	url := fmt.Sprintf(
+		"%s/info/refs?service=%s",
+		s.ep.String(), transport.UploadPackServiceName,
+	)
+
+	res, err := s.do(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	r := bufio.NewReader(res.Body)
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// the service line is only sent by some servers.
+	if strings.HasPrefix(line, "# service=") {
+		if _, err := readLine(r); err != errFlush {
+			return nil, ErrUnexpectedResponse.New("service line")
+		}
+
+		if line, err = readLine(r); err != nil {
+			return nil, err
+		}
+	}
+
+	if line != "version 2" {
+		return nil, nil
+	}
+
+	caps := map[string]string{}
+	for {
+		line, err := readLine(r)
+		if err == errFlush {
+			return caps, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) == 2 {
+			caps[kv[0]] = kv[1]
+		} else {
+			caps[kv[0]] = ""
+		}
+	}
+}
+
+func (s *session) supports(capability, feature string) bool {
+	value, ok := s.caps[capability]
+	if !ok {
+		return false
+	}
+
+	if feature == "" {
+		return true
+	}
+
+	for _, f := range strings.Fields(value) {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AdvertisedReferences implements the transport.UploadPackSession interface.
+func (s *session) AdvertisedReferences() (*packp.AdvRefs, error) {
+	ctx := context.Background()
+	if err := s.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	if !s.v2 {
+		return s.fallback.AdvertisedReferences()
+	}
+
+	if !s.supports(capLsRefs, "") {
+		return nil, ErrNotSupported.New(s.ep.Host, capLsRefs)
+	}
+
+	args := []string{"peel", "symrefs"}
+	if len(s.opts.RefPrefixes) > 0 {
+		args = append(args, "ref-prefix HEAD")
+		for _, prefix := range s.opts.RefPrefixes {
+			args = append(args, "ref-prefix "+prefix)
+		}
+	}
+
+	res, err := s.command(ctx, capLsRefs, args)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	ar := packp.NewAdvRefs()
+	if err := s.setCapabilities(ar.Capabilities); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(res.Body)
+	for {
+		line, err := readLine(r)
+		if err == errFlush {
+			return ar, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := addReference(ar, line); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// setCapabilities sets the protocol v0 capabilities matching the protocol v2
+// features of the server, so go-git builds the requests using them.
+func (s *session) setCapabilities(caps *capability.List) error {
+	set := []capability.Capability{
+		capability.OFSDelta,
+		capability.Sideband64k,
+		capability.ThinPack,
+		capability.NoProgress,
+		capability.IncludeTag,
+	}
+
+	if s.supports(capFetch, featureShallow) {
+		set = append(set,
+			capability.Shallow,
+			capability.DeepenSince,
+			capability.DeepenNot,
+		)
+	}
+
+	for _, c := range set {
+		if err := caps.Set(c); err != nil {
+			return err
+		}
+	}
+
+	if agent, ok := s.caps["agent"]; ok {
+		return caps.Set(capability.Agent, agent)
+	}
+
+	return nil
+}
+
+// addReference adds to the AdvRefs a line of the ls-refs output, formatted as
+// "<oid> <name> [symref-target:<target>] [peeled:<oid>]".
+func addReference(ar *packp.AdvRefs, line string) error {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return ErrUnexpectedResponse.New(line)
+	}
+
+	hash := plumbing.NewHash(fields[0])
+	name := fields[1]
+	for _, attr := range fields[2:] {
+		switch {
+		case strings.HasPrefix(attr, "symref-target:"):
+			target := strings.TrimPrefix(attr, "symref-target:")
+			if err := ar.Capabilities.Add(
+				capability.SymRef, name+":"+target,
+			); err != nil {
+				return err
+			}
+		case strings.HasPrefix(attr, "peeled:"):
+			peeled := strings.TrimPrefix(attr, "peeled:")
+			ar.Peeled[name] = plumbing.NewHash(peeled)
+		}
+	}
+
+	if name == "HEAD" {
+		ar.Head = &hash
+		return nil
+	}
+
+	ar.References[name] = hash
+	return nil
+}
+
+// UploadPack implements the transport.UploadPackSession interface.
+func (s *session) UploadPack(
+	ctx context.Context,
+	req *packp.UploadPackRequest,
+) (*packp.UploadPackResponse, error) {
+	if err := s.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	if !s.v2 {
+		return s.fallback.UploadPack(ctx, req)
+	}
+
+	if req.IsEmpty() {
+		return nil, transport.ErrEmptyUploadPackRequest
+	}
+
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	args, err := s.fetchArgs(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.command(ctx, capFetch, args)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(res.Body)
+	shallows, err := readSections(r)
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+
+	// the packfile is always multiplexed in the protocol v2, it's demuxed
+	// by go-git only if the sideband was requested.
+	var pack io.Reader = r
+	if !req.Capabilities.Supports(capability.Sideband64k) &&
+		!req.Capabilities.Supports(capability.Sideband) {
+		pack = sideband.NewDemuxer(sideband.Sideband64k, r)
+	}
+
+	up := packp.NewUploadPackResponseWithPackfile(req, &readCloser{
+		Reader: pack,
+		Closer: res.Body,
+	})
+	up.ShallowUpdate = *shallows
+	return up, nil
+}
+
+func (s *session) fetchArgs(req *packp.UploadPackRequest) ([]string, error) {
+	var args []string
+	for _, c := range []capability.Capability{
+		capability.OFSDelta,
+		capability.ThinPack,
+		capability.NoProgress,
+		capability.IncludeTag,
+	} {
+		if req.Capabilities.Supports(c) {
+			args = append(args, c.String())
+		}
+	}
+
+	if s.opts.Filter != "" {
+		if !s.supports(capFetch, featureFilter) {
+			return nil, ErrNotSupported.New(s.ep.Host, featureFilter)
+		}
+
+		args = append(args, "filter "+s.opts.Filter)
+	}
+
+	for _, h := range req.Shallows {
+		args = append(args, "shallow "+h.String())
+	}
+
+	switch depth := req.Depth.(type) {
+	case packp.DepthCommits:
+		if depth != 0 {
+			args = append(args, "deepen "+strconv.Itoa(int(depth)))
+		}
+	case packp.DepthSince:
+		if !depth.IsZero() {
+			since := time.Time(depth).Unix()
+			args = append(args, "deepen-since "+strconv.FormatInt(since, 10))
+		}
+	case packp.DepthReference:
+		if depth != "" {
+			args = append(args, "deepen-not "+string(depth))
+		}
+	}
+
+	for _, h := range req.Wants {
+		args = append(args, "want "+h.String())
+	}
+
+	for _, h := range req.Haves {
+		args = append(args, "have "+h.String())
+	}
+
+	return append(args, "done"), nil
+}
+
+// readSections reads the sections of a fetch response until the packfile
+// one, returning the shallow updates sent by the server.
+func readSections(r *bufio.Reader) (*packp.ShallowUpdate, error) {
+	shallows := &packp.ShallowUpdate{}
+	for {
+		section, err := readLine(r)
+		if err == errFlush {
+			return nil, ErrUnexpectedResponse.New("missing packfile")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if section == "packfile" {
+			return shallows, nil
+		}
+
+		for {
+			line, err := readLine(r)
+			if err == errDelim {
+				break
+			}
+
+			if err == errFlush {
+				return nil, ErrUnexpectedResponse.New("missing packfile")
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			if section != "shallow-info" {
+				continue
+			}
+
+			switch {
+			case strings.HasPrefix(line, "shallow "):
+				shallows.Shallows = append(shallows.Shallows,
+					plumbing.NewHash(strings.TrimPrefix(line, "shallow ")))
+			case strings.HasPrefix(line, "unshallow "):
+				shallows.Unshallows = append(shallows.Unshallows,
+					plumbing.NewHash(strings.TrimPrefix(line, "unshallow ")))
+			}
+		}
+	}
+}
+
+// Close implements the transport.UploadPackSession interface.
+func (s *session) Close() error {
+	return s.fallback.Close()
+}
+
+// command sends a protocol v2 command with the given arguments and the server
+// options configured for the host.
+func (s *session) command(
+	ctx context.Context,
+	command string,
+	args []string,
+) (*http.Response, error) {
+	if len(s.opts.ServerOptions) > 0 && !s.supports(capServerOption, "") {
+		return nil, ErrNotSupported.New(s.ep.Host, capServerOption)
+	}
+
+	var buf bytes.Buffer
+	e := pktline.NewEncoder(&buf)
+	if err := e.Encodef("command=%s\n", command); err != nil {
+		return nil, err
+	}
+
+	for _, opt := range s.opts.ServerOptions {
+		if err := e.Encodef("server-option=%s\n", opt); err != nil {
+			return nil, err
+		}
+	}
+
+	buf.WriteString(delimPkt)
+	for _, arg := range args {
+		if err := e.Encodef("%s\n", arg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := e.Flush(); err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf(
+		"%s/%s",
+		s.ep.String(), transport.UploadPackServiceName,
+	)
+
+	return s.do(ctx, http.MethodPost, url, &buf)
+}
+
+func (s *session) do(
+	ctx context.Context,
+	method, url string,
+	body io.Reader,
+) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set(versionHeader, versionV2)
+	if body != nil {
+		req.Header.Set("Content-Type", requestType)
+		req.Header.Set("Accept", resultType)
+	}
+
+	if err := s.setAuth(req); err != nil {
+		return nil, err
+	}
+
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := githttp.NewErr(res); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *session) setAuth(req *http.Request) error {
+	switch auth := s.auth.(type) {
+	case nil:
+		if s.ep.User != "" {
+			req.SetBasicAuth(s.ep.User, s.ep.Password)
+		}
+	case *githttp.BasicAuth:
+		req.SetBasicAuth(auth.Username, auth.Password)
+	case *githttp.TokenAuth:
+		req.Header.Set("Authorization", "Bearer "+auth.Token)
+	default:
+		return ErrAuthNotSupported.New(auth.Name())
+	}
+
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
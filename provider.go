@@ -0,0 +1,25 @@
+package gitcollector
+
+import "context"
+
+// StartProvider starts the given Provider until it finishes or the context is
+// done. A ContextProvider is started with the context, the rest are stopped
+// once it's done.
+func StartProvider(ctx context.Context, p Provider) error {
+	if cp, ok := p.(ContextProvider); ok {
+		return cp.StartContext(ctx)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// a provider failing to stop keeps Start blocked.
+			p.Stop()
+		case <-done:
+		}
+	}()
+
+	return p.Start()
+}
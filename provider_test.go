@@ -0,0 +1,57 @@
+package gitcollector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type blockingProvider struct {
+	stop chan struct{}
+}
+
+func (p *blockingProvider) Start() error {
+	<-p.stop
+	return ErrProviderStopped.New()
+}
+
+func (p *blockingProvider) Stop() error {
+	close(p.stop)
+	return nil
+}
+
+type contextProvider struct {
+	blockingProvider
+	ctx context.Context
+}
+
+func (p *contextProvider) StartContext(ctx context.Context) error {
+	p.ctx = ctx
+	<-ctx.Done()
+	return ErrProviderStopped.New()
+}
+
+func TestStartProvider(t *testing.T) {
+	var require = require.New(t)
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 50*time.Millisecond,
+	)
+	defer cancel()
+
+	// the providers without context are stopped
+	err := StartProvider(ctx, &blockingProvider{stop: make(chan struct{})})
+	require.True(ErrProviderStopped.Is(err))
+
+	ctx, cancel = context.WithTimeout(
+		context.Background(), 50*time.Millisecond,
+	)
+	defer cancel()
+
+	p := &contextProvider{}
+	err = StartProvider(ctx, p)
+	require.True(ErrProviderStopped.Is(err))
+	require.Equal(ctx, p.ctx)
+}
@@ -0,0 +1,319 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robertkrimen/otto"
+	"github.com/robertkrimen/otto/parser"
+)
+
+const (
+	// maxCalls is the maximum depth of the function calls of a PAC file.
+	maxCalls = 100
+	// evalTimeout is the time a PAC file can take to choose the proxies,
+	// as its loops may never end.
+	evalTimeout = 5 * time.Second
+)
+
+var errInterrupted = errors.New("the evaluation was interrupted")
+
+// PAC is a proxy auto-config file. It's evaluated by a JavaScript (ES5)
+// interpreter along with the standard PAC functions: isPlainHostName,
+// dnsDomainIs, localHostOrDomainIs, isResolvable, isInNet, dnsResolve,
+// myIpAddress, dnsDomainLevels, shExpMatch, weekdayRange, dateRange and
+// timeRange.
+type PAC struct {
+	lookup func(ctx context.Context, host string) ([]string, error)
+	now    func() time.Time
+
+	mu  sync.Mutex
+	vm  *otto.Otto
+	ctx context.Context
+}
+
+// ParsePAC parses the source of a PAC file, it must declare the
+// FindProxyForURL function.
+func ParsePAC(src string) (*PAC, error) {
+	if _, err := parser.ParseFile(nil, "", src, 0); err != nil {
+		line, msg := 1, err.Error()
+		if list, ok := err.(parser.ErrorList); ok && len(list) > 0 {
+			line, msg = list[0].Position.Line, list[0].Message
+		}
+
+		return nil, ErrPACSyntax.New(line, msg)
+	}
+
+	p := &PAC{
+		lookup: net.DefaultResolver.LookupHost,
+		now:    time.Now,
+		vm:     otto.New(),
+		ctx:    context.Background(),
+	}
+
+	p.vm.SetStackDepthLimit(maxCalls)
+	for name, fn := range p.builtins() {
+		if err := p.vm.Set(name, fn); err != nil {
+			return nil, ErrPACEval.New(err)
+		}
+	}
+
+	// the global variables are initialized once.
+	if _, err := p.run(context.Background(), func() (otto.Value, error) {
+		return p.vm.Run(src)
+	}); err != nil {
+		return nil, err
+	}
+
+	fn, err := p.vm.Get("FindProxyForURL")
+	if err != nil || !fn.IsFunction() {
+		return nil, ErrPACSyntax.New(1, "FindProxyForURL isn't declared")
+	}
+
+	return p, nil
+}
+
+// FindProxy returns the result of the FindProxyForURL function of the PAC
+// file for the given URL and host, like "PROXY proxy:3128; DIRECT".
+func (p *PAC) FindProxy(
+	ctx context.Context,
+	rawurl, host string,
+) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	v, err := p.run(ctx, func() (otto.Value, error) {
+		return p.vm.Call("FindProxyForURL", nil, rawurl, host)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if !v.IsString() {
+		return "", ErrPACEval.New(
+			"FindProxyForURL returned " + v.String() + " instead of a string",
+		)
+	}
+
+	return v.String(), nil
+}
+
+// run runs the given evaluation, interrupting it once the context is done or
+// after evalTimeout.
+func (p *PAC) run(
+	ctx context.Context,
+	fn func() (otto.Value, error),
+) (v otto.Value, err error) {
+	ctx, cancel := context.WithTimeout(ctx, evalTimeout)
+	defer cancel()
+
+	// the interrupt is buffered so it doesn't block once fn returned.
+	interrupt := make(chan func(), 1)
+	done := make(chan struct{})
+	defer close(done)
+
+	p.vm.Interrupt = interrupt
+	go func() {
+		select {
+		case <-ctx.Done():
+			interrupt <- func() { panic(errInterrupted) }
+		case <-done:
+		}
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errInterrupted {
+				panic(r)
+			}
+
+			err = ErrPACEval.New(ctx.Err())
+		}
+	}()
+
+	p.ctx = ctx
+	v, err = fn()
+	if err != nil {
+		return v, ErrPACEval.New(err)
+	}
+
+	return v, nil
+}
+
+// ParseProxies parses the result of a PAC file into the URLs of its proxies,
+// in order. DIRECT is returned as a nil URL. The HTTP, HTTPS and SOCKS5
+// proxies are supported, the rest are skipped.
+func ParseProxies(result string) ([]*url.URL, error) {
+	var proxies []*url.URL
+	for _, entry := range strings.Split(result, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+
+		kind := strings.ToUpper(fields[0])
+		if kind == "DIRECT" {
+			proxies = append(proxies, nil)
+			continue
+		}
+
+		if len(fields) != 2 {
+			return nil, ErrProxyResult.New(result)
+		}
+
+		var scheme string
+		switch kind {
+		case "PROXY", "HTTP":
+			scheme = "http"
+		case "HTTPS":
+			scheme = "https"
+		case "SOCKS", "SOCKS5":
+			scheme = "socks5"
+		default:
+			continue
+		}
+
+		u, err := url.Parse(scheme + "://" + fields[1])
+		if err != nil || u.Host == "" {
+			return nil, ErrProxyResult.New(result)
+		}
+
+		proxies = append(proxies, u)
+	}
+
+	if len(proxies) == 0 {
+		return nil, ErrProxyResult.New(result)
+	}
+
+	return proxies, nil
+}
+
+// builtins returns the standard PAC functions by name.
+func (p *PAC) builtins() map[string]func(otto.FunctionCall) otto.Value {
+	str := func(call otto.FunctionCall, i int) string {
+		if v := call.Argument(i); v.IsDefined() {
+			return v.String()
+		}
+
+		return ""
+	}
+
+	value := func(v interface{}) otto.Value {
+		ov, _ := p.vm.ToValue(v)
+		return ov
+	}
+
+	return map[string]func(otto.FunctionCall) otto.Value{
+		"isPlainHostName": func(call otto.FunctionCall) otto.Value {
+			return value(!strings.Contains(str(call, 0), "."))
+		},
+		"dnsDomainIs": func(call otto.FunctionCall) otto.Value {
+			return value(strings.HasSuffix(
+				strings.ToLower(str(call, 0)),
+				strings.ToLower(str(call, 1)),
+			))
+		},
+		"localHostOrDomainIs": func(call otto.FunctionCall) otto.Value {
+			host := strings.ToLower(str(call, 0))
+			hostdom := strings.ToLower(str(call, 1))
+			return value(host == hostdom || !strings.Contains(host, ".") &&
+				strings.HasPrefix(hostdom, host+"."))
+		},
+		"dnsDomainLevels": func(call otto.FunctionCall) otto.Value {
+			return value(strings.Count(str(call, 0), "."))
+		},
+		"shExpMatch": func(call otto.FunctionCall) otto.Value {
+			return value(shExpMatch(str(call, 0), str(call, 1)))
+		},
+		"isResolvable": func(call otto.FunctionCall) otto.Value {
+			return value(p.resolve(str(call, 0)) != "")
+		},
+		"dnsResolve": func(call otto.FunctionCall) otto.Value {
+			if ip := p.resolve(str(call, 0)); ip != "" {
+				return value(ip)
+			}
+
+			return otto.NullValue()
+		},
+		"isInNet": func(call otto.FunctionCall) otto.Value {
+			return value(isInNet(
+				p.resolve(str(call, 0)), str(call, 1), str(call, 2),
+			))
+		},
+		"myIpAddress": func(call otto.FunctionCall) otto.Value {
+			return value(myIPAddress())
+		},
+		"weekdayRange": func(call otto.FunctionCall) otto.Value {
+			return value(weekdayRange(p.now(), args(call)))
+		},
+		"dateRange": func(call otto.FunctionCall) otto.Value {
+			return value(dateRange(p.now(), args(call)))
+		},
+		"timeRange": func(call otto.FunctionCall) otto.Value {
+			return value(timeRange(p.now(), args(call)))
+		},
+		"alert": func(call otto.FunctionCall) otto.Value {
+			return otto.UndefinedValue()
+		},
+	}
+}
+
+// resolve returns the first IPv4 address of the host, empty if it isn't
+// resolved.
+func (p *PAC) resolve(host string) string {
+	if ip := net.ParseIP(host); ip != nil {
+		return host
+	}
+
+	addrs, err := p.lookup(p.ctx, host)
+	if err != nil {
+		return ""
+	}
+
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
+			return addr
+		}
+	}
+
+	return ""
+}
+
+func isInNet(addr, pattern, mask string) bool {
+	ip, pip, mip := net.ParseIP(addr), net.ParseIP(pattern), net.ParseIP(mask)
+	if ip == nil || pip == nil || mip == nil ||
+		ip.To4() == nil || pip.To4() == nil || mip.To4() == nil {
+		return false
+	}
+
+	m := net.IPMask(mip.To4())
+	return ip.To4().Mask(m).Equal(pip.To4().Mask(m))
+}
+
+func myIPAddress() string {
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+				return ipnet.IP.String()
+			}
+		}
+	}
+
+	return "127.0.0.1"
+}
+
+func shExpMatch(s, exp string) bool {
+	re := regexp.QuoteMeta(exp)
+	re = strings.Replace(re, `\*`, ".*", -1)
+	re = strings.Replace(re, `\?`, ".", -1)
+	ok, _ := regexp.MatchString("^"+re+"$", s)
+	return ok
+}
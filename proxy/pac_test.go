@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPAC = `
+// the internal forges are reached directly
+var internal = ".internal.example.com";
+
+/* the proxies of every forge */
+function forgeProxy(host) {
+	if (dnsDomainIs(host, "gitlab.com") || host == "gitlab.example.com")
+		return "PROXY gitlab-proxy:3128";
+	else if (shExpMatch(host, "*.github.com") || host === "github.com") {
+		return "PROXY github-proxy:8080; DIRECT";
+	}
+
+	return null;
+}
+
+function FindProxyForURL(url, host) {
+	host = host.toLowerCase();
+	if (isPlainHostName(host) || dnsDomainIs(host, internal)) {
+		return "DIRECT";
+	}
+
+	if (isInNet(host, "10.0.0.0", "255.0.0.0")) {
+		return "DIRECT";
+	}
+
+	var proxy = forgeProxy(host);
+	if (proxy != null) {
+		return proxy;
+	}
+
+	if (url.substring(0, 5) == "http:") {
+		return "SOCKS5 socks:1080";
+	}
+
+	return dnsDomainLevels(host) > 2 ? "HTTPS secure:443" : "PROXY default:3128";
+}
+`
+
+func TestPAC(t *testing.T) {
+	var require = require.New(t)
+
+	pac, err := ParsePAC(testPAC)
+	require.NoError(err)
+
+	for _, c := range []struct {
+		url, host string
+		expected  string
+	}{
+		{"https://forge/", "forge", "DIRECT"},
+		{"https://git.internal.example.com/", "git.internal.example.com", "DIRECT"},
+		{"https://10.1.2.3/", "10.1.2.3", "DIRECT"},
+		{"https://gitlab.com/", "GitLab.com", "PROXY gitlab-proxy:3128"},
+		{"https://gitlab.example.com/", "gitlab.example.com", "PROXY gitlab-proxy:3128"},
+		{"https://api.github.com/", "api.github.com", "PROXY github-proxy:8080; DIRECT"},
+		{"https://github.com/", "github.com", "PROXY github-proxy:8080; DIRECT"},
+		{"http://bitbucket.org/", "bitbucket.org", "SOCKS5 socks:1080"},
+		{"https://bitbucket.org/", "bitbucket.org", "PROXY default:3128"},
+		{"https://a.b.c.example.com/", "a.b.c.example.com", "HTTPS secure:443"},
+	} {
+		result, err := pac.FindProxy(context.Background(), c.url, c.host)
+		require.NoError(err, c.host)
+		require.Equal(c.expected, result, c.host)
+	}
+}
+
+func TestPACResolve(t *testing.T) {
+	var require = require.New(t)
+
+	pac, err := ParsePAC(`
+function FindProxyForURL(url, host) {
+	if (!isResolvable(host))
+		return "PROXY unresolved:3128";
+	if (isInNet(dnsResolve(host), "192.168.0.0", "255.255.0.0"))
+		return "DIRECT";
+	return "PROXY " + dnsResolve(host) + ":3128";
+}`)
+	require.NoError(err)
+
+	pac.lookup = func(_ context.Context, host string) ([]string, error) {
+		switch host {
+		case "lan":
+			return []string{"::1", "192.168.1.10"}, nil
+		case "wan":
+			return []string{"1.2.3.4"}, nil
+		}
+
+		return nil, fmt.Errorf("not found")
+	}
+
+	for host, expected := range map[string]string{
+		"lan":     "DIRECT",
+		"wan":     "PROXY 1.2.3.4:3128",
+		"missing": "PROXY unresolved:3128",
+	} {
+		result, err := pac.FindProxy(context.Background(), "https://"+host, host)
+		require.NoError(err)
+		require.Equal(expected, result, host)
+	}
+}
+
+func TestParsePACErrors(t *testing.T) {
+	var require = require.New(t)
+
+	for src, kind := range map[string]string{
+		`var a = 1;`: "FindProxyForURL isn't declared",
+		"function FindProxyForURL(url, host) {\n return a # b }": "line 2: Unexpected token ILLEGAL",
+		`function FindProxyForURL(url, host) { return "DIRECT"`:  "Unexpected end of input",
+		`function FindProxyForURL(url, host) { return "DIRECT }`: "Unexpected token ILLEGAL",
+	} {
+		_, err := ParsePAC(src)
+		require.True(ErrPACSyntax.Is(err), src)
+		require.Contains(err.Error(), kind)
+	}
+
+	pac, err := ParsePAC(`
+function loop(n) { return loop(n + 1); }
+function FindProxyForURL(url, host) {
+	if (host == "loop") return loop(0);
+	if (host == "forever") while (true) {}
+	if (host == "number") return 1;
+	return missing;
+}`)
+	require.NoError(err)
+
+	for _, host := range []string{"loop", "forever", "number", "undefined"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		_, err := pac.FindProxy(ctx, "https://"+host, host)
+		cancel()
+		require.True(ErrPACEval.Is(err), host)
+	}
+
+	// the PAC file keeps working once an evaluation is interrupted
+	_, err = pac.FindProxy(context.Background(), "https://number", "number")
+	require.True(ErrPACEval.Is(err))
+}
+
+func TestPACLoops(t *testing.T) {
+	var require = require.New(t)
+
+	pac, err := ParsePAC(`
+var direct = ["example.com", "example.org"];
+function FindProxyForURL(url, host) {
+	for (var i = 0; i < direct.length; i++) {
+		if (dnsDomainIs(host, direct[i])) return "DIRECT";
+	}
+
+	return "PROXY default:3128";
+}`)
+	require.NoError(err)
+
+	for host, expected := range map[string]string{
+		"git.example.org": "DIRECT",
+		"github.com":      "PROXY default:3128",
+	} {
+		result, err := pac.FindProxy(context.Background(), "https://"+host, host)
+		require.NoError(err)
+		require.Equal(expected, result, host)
+	}
+}
+
+func TestPACTime(t *testing.T) {
+	var require = require.New(t)
+
+	pac, err := ParsePAC(`
+function FindProxyForURL(url, host) {
+	return eval(host) ? "DIRECT" : "PROXY a:1";
+}`)
+	require.NoError(err)
+
+	// a wednesday
+	pac.now = func() time.Time {
+		return time.Date(2020, time.January, 15, 10, 30, 20, 0, time.UTC)
+	}
+
+	for expr, expected := range map[string]bool{
+		`weekdayRange("WED", "GMT")`:                        true,
+		`weekdayRange("MON", "FRI", "GMT")`:                 true,
+		`weekdayRange("FRI", "MON", "GMT")`:                 false,
+		`weekdayRange("SAT", "WED", "GMT")`:                 true,
+		`weekdayRange("FOO", "GMT")`:                        false,
+		`dateRange(15, "GMT")`:                              true,
+		`dateRange("FEB", "GMT")`:                           false,
+		`dateRange(2020, "GMT")`:                            true,
+		`dateRange(1, 14, "GMT")`:                           false,
+		`dateRange("DEC", "JAN", "GMT")`:                    true,
+		`dateRange(20, "DEC", 20, "JAN", "GMT")`:            true,
+		`dateRange(16, "JAN", 20, "DEC", "GMT")`:            false,
+		`dateRange("JAN", 2019, "DEC", 2019, "GMT")`:        false,
+		`dateRange(1, "JAN", 2020, 15, "JAN", 2020, "GMT")`: true,
+		`dateRange(1, "JAN", 2020, "GMT")`:                  false,
+		`timeRange(10, "GMT")`:                              true,
+		`timeRange(8, 10, "GMT")`:                           true,
+		`timeRange(11, 17, "GMT")`:                          false,
+		`timeRange(22, 10, "GMT")`:                          true,
+		`timeRange(10, 30, 10, 45, "GMT")`:                  true,
+		`timeRange(10, 30, 30, 10, 45, 0, "GMT")`:           false,
+		`timeRange(10, 0, 10, 29, "GMT")`:                   false,
+	} {
+		result, err := pac.FindProxy(context.Background(), "https://a", expr)
+		require.NoError(err, expr)
+		require.Equal(expected, result == "DIRECT", expr)
+	}
+}
+
+func TestParseProxies(t *testing.T) {
+	var require = require.New(t)
+
+	proxies, err := ParseProxies(
+		"PROXY a:3128; SOCKS4 b:1080;HTTPS c:443; SOCKS d:1080; DIRECT",
+	)
+	require.NoError(err)
+	require.Len(proxies, 4)
+	require.Equal("http://a:3128", proxies[0].String())
+	require.Equal("https://c:443", proxies[1].String())
+	require.Equal("socks5://d:1080", proxies[2].String())
+	require.Nil(proxies[3])
+
+	for _, result := range []string{"", "SOCKS4 b:1080", "PROXY", "PROXY a b"} {
+		_, err := ParseProxies(result)
+		require.True(ErrProxyResult.Is(err), result)
+	}
+}
@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robertkrimen/otto"
+)
+
+var (
+	weekdays = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+	months   = []string{
+		"JAN", "FEB", "MAR", "APR", "MAY", "JUN",
+		"JUL", "AUG", "SEP", "OCT", "NOV", "DEC",
+	}
+)
+
+// the weights of the fields of dateRange and timeRange, to compare them as a
+// single number.
+const (
+	yearWeight  = 10000
+	monthWeight = 100
+	dayWeight   = 1
+)
+
+// args returns the arguments of a call as strings.
+func args(call otto.FunctionCall) []string {
+	args := make([]string, len(call.ArgumentList))
+	for i, arg := range call.ArgumentList {
+		args[i] = arg.String()
+	}
+
+	return args
+}
+
+// clock returns the time in UTC and the rest of the arguments when the last
+// one is "GMT", the local time and all of them otherwise.
+func clock(now time.Time, args []string) (time.Time, []string) {
+	if len(args) > 0 && strings.EqualFold(args[len(args)-1], "GMT") {
+		return now.UTC(), args[:len(args)-1]
+	}
+
+	return now.Local(), args
+}
+
+// within tells whether v is between from and to, both included, wrapping
+// around when from is bigger, like from friday to monday.
+func within(v, from, to int) bool {
+	if from <= to {
+		return from <= v && v <= to
+	}
+
+	return v >= from || v <= to
+}
+
+func index(names []string, name string) int {
+	for i, n := range names {
+		if strings.EqualFold(n, name) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// weekdayRange tells whether the day of the week is the given one or between
+// the given ones, like weekdayRange("MON", "FRI").
+func weekdayRange(now time.Time, args []string) bool {
+	now, args = clock(now, args)
+	if len(args) == 0 || len(args) > 2 {
+		return false
+	}
+
+	from := index(weekdays, args[0])
+	to := from
+	if len(args) == 2 {
+		to = index(weekdays, args[1])
+	}
+
+	if from < 0 || to < 0 {
+		return false
+	}
+
+	return within(int(now.Weekday()), from, to)
+}
+
+// dateRange tells whether the date is the given day, month or year, or
+// between the given ones, like dateRange(1, "JAN", 15, "JAN") or
+// dateRange("JAN", 2020, "JUN", 2020). The numbers up to 31 are days and the
+// bigger ones years. The ranges without years wrap around the end of the
+// year or of the month.
+func dateRange(now time.Time, args []string) bool {
+	now, args = clock(now, args)
+	if len(args) == 0 || len(args) > 6 || len(args) > 1 && len(args)%2 != 0 {
+		return false
+	}
+
+	current := map[int]int{
+		yearWeight:  now.Year(),
+		monthWeight: int(now.Month()),
+		dayWeight:   now.Day(),
+	}
+
+	weights := make([]int, len(args))
+	values := make([]int, len(args))
+	for i, arg := range args {
+		if m := index(months, arg); m >= 0 {
+			weights[i], values[i] = monthWeight, m+1
+			continue
+		}
+
+		n, err := strconv.Atoi(arg)
+		switch {
+		case err != nil || n < 1:
+			return false
+		case n > 31:
+			weights[i], values[i] = yearWeight, n
+		default:
+			weights[i], values[i] = dayWeight, n
+		}
+	}
+
+	if len(args) == 1 {
+		return current[weights[0]] == values[0]
+	}
+
+	half := len(args) / 2
+	var from, to, cur int
+	var years bool
+	for i := 0; i < half; i++ {
+		w := weights[i]
+		if weights[i+half] != w {
+			return false
+		}
+
+		years = years || w == yearWeight
+		from += values[i] * w
+		to += values[i+half] * w
+		cur += current[w] * w
+	}
+
+	if years {
+		return from <= cur && cur <= to
+	}
+
+	return within(cur, from, to)
+}
+
+// timeRange tells whether the time is in the given hour, or between the given
+// hours, hours and minutes or hours, minutes and seconds, both included, like
+// timeRange(8, 30, 17, 0). The ranges wrap around midnight.
+func timeRange(now time.Time, args []string) bool {
+	now, args = clock(now, args)
+	values := make([]int, len(args))
+	for i, arg := range args {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return false
+		}
+
+		values[i] = n
+	}
+
+	switch len(values) {
+	case 1:
+		return now.Hour() == values[0]
+	case 2, 4, 6:
+	default:
+		return false
+	}
+
+	half := len(values) / 2
+	hms := []int{now.Hour(), now.Minute(), now.Second()}
+	var from, to, cur int
+	for i := 0; i < half; i++ {
+		from = from*60 + values[i]
+		to = to*60 + values[i+half]
+		cur = cur*60 + hms[i]
+	}
+
+	return within(cur, from, to)
+}
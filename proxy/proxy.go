@@ -0,0 +1,186 @@
+// Package proxy decides the proxy the HTTP requests of gitcollector are made
+// through, following the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+// variables and, optionally, a proxy auto-config (PAC) file choosing a proxy
+// by host.
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrPACLoad is returned when a PAC file can't be read or downloaded.
+	ErrPACLoad = errors.NewKind("unable to load the PAC file %s: %s")
+
+	// ErrPACSyntax is returned when a PAC file can't be parsed.
+	ErrPACSyntax = errors.NewKind("wrong PAC file at line %d: %s")
+
+	// ErrPACEval is returned when a PAC file fails to be evaluated.
+	ErrPACEval = errors.NewKind("unable to evaluate the PAC file: %s")
+
+	// ErrProxyResult is returned when the result of a PAC file doesn't
+	// name any supported proxy.
+	ErrProxyResult = errors.NewKind("wrong proxies returned by the PAC file: %q")
+)
+
+const pacTimeout = 30 * time.Second
+
+// Opts represents configuration options for a Proxy.
+type Opts struct {
+	// HTTPProxy, HTTPSProxy and NoProxy follow the semantics of the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables, they
+	// default to them.
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+	// PAC is the path or the http or https URL of a PAC file. It chooses
+	// the proxy of the hosts not excluded by NoProxy instead of HTTPProxy
+	// and HTTPSProxy.
+	PAC string
+}
+
+// Proxy chooses the proxy of every request.
+type Proxy struct {
+	env func(*url.URL) (*url.URL, error)
+	pac *PAC
+
+	mu    sync.Mutex
+	cache map[string]*url.URL
+}
+
+// New builds a new Proxy, loading its PAC file if any.
+func New(opts *Opts) (*Proxy, error) {
+	if opts == nil {
+		opts = &Opts{}
+	}
+
+	cfg := httpproxy.FromEnvironment()
+	if opts.HTTPProxy != "" {
+		cfg.HTTPProxy = opts.HTTPProxy
+	}
+
+	if opts.HTTPSProxy != "" {
+		cfg.HTTPSProxy = opts.HTTPSProxy
+	}
+
+	if opts.NoProxy != "" {
+		cfg.NoProxy = opts.NoProxy
+	}
+
+	p := &Proxy{cache: map[string]*url.URL{}}
+	if opts.PAC == "" {
+		p.env = cfg.ProxyFunc()
+		return p, nil
+	}
+
+	pac, err := LoadPAC(opts.PAC)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the hosts excluded by NoProxy aren't given a proxy, the rest
+	// are left to the PAC file.
+	p.pac = pac
+	p.env = (&httpproxy.Config{
+		HTTPProxy:  "pac",
+		HTTPSProxy: "pac",
+		NoProxy:    cfg.NoProxy,
+	}).ProxyFunc()
+
+	return p, nil
+}
+
+// URL returns the URL of the proxy the request is made through, nil if it's
+// made directly, like the Proxy of an http.Transport. The PAC file is given
+// the URLs without path nor query, so its result is reused for every request
+// to the same host. Only the first proxy returned by it is used.
+func (p *Proxy) URL(req *http.Request) (*url.URL, error) {
+	u, err := p.env(req.URL)
+	if err != nil || u == nil || p.pac == nil {
+		return u, err
+	}
+
+	key := req.URL.Scheme + "://" + req.URL.Host
+	p.mu.Lock()
+	u, ok := p.cache[key]
+	p.mu.Unlock()
+	if ok {
+		return u, nil
+	}
+
+	result, err := p.pac.FindProxy(req.Context(), key+"/", req.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	proxies, err := ParseProxies(result)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.cache[key] = proxies[0]
+	p.mu.Unlock()
+	return proxies[0], nil
+}
+
+// Install makes the requests of the http.DefaultTransport, used by the
+// github clients and the go-git HTTP transport, through the Proxy.
+func (p *Proxy) Install() {
+	http.DefaultTransport.(*http.Transport).Proxy = p.URL
+}
+
+// LoadPAC reads the PAC file at the given path, or downloads it from the
+// given http or https URL without any proxy.
+func LoadPAC(path string) (*PAC, error) {
+	var (
+		src []byte
+		err error
+	)
+
+	if strings.HasPrefix(path, "http://") ||
+		strings.HasPrefix(path, "https://") {
+		src, err = downloadPAC(path)
+	} else {
+		src, err = ioutil.ReadFile(path)
+	}
+
+	if err != nil {
+		return nil, ErrPACLoad.New(path, err)
+	}
+
+	return ParsePAC(string(src))
+}
+
+func downloadPAC(u string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pacTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Transport: &http.Transport{}}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxy(t *testing.T) {
+	var require = require.New(t)
+
+	p, err := New(&Opts{
+		HTTPProxy:  "http-proxy:3128",
+		HTTPSProxy: "https-proxy:3128",
+		NoProxy:    ".internal.example.com,10.0.0.0/8",
+	})
+	require.NoError(err)
+
+	for url, expected := range map[string]string{
+		"http://github.com/src-d/gitcollector":   "http://http-proxy:3128",
+		"https://github.com/src-d/gitcollector":  "http://https-proxy:3128",
+		"https://git.internal.example.com/a/b":   "",
+		"https://10.1.1.1/a/b":                   "",
+		"https://localhost:8080/src-d/something": "",
+	} {
+		require.Equal(expected, proxyOf(t, p, url), url)
+	}
+}
+
+func TestProxyPAC(t *testing.T) {
+	var require = require.New(t)
+
+	var served int
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+
+			served++
+			fmt.Fprint(w, `
+function FindProxyForURL(url, host) {
+	if (shExpMatch(url, "https://*.gitlab.com/"))
+		return "PROXY gitlab-proxy:3128";
+	if (dnsDomainIs(host, "github.com"))
+		return "SOCKS5 github-proxy:1080; DIRECT";
+	return "DIRECT";
+}`)
+		},
+	))
+	defer srv.Close()
+
+	p, err := New(&Opts{
+		HTTPSProxy: "unused:3128",
+		NoProxy:    "internal.gitlab.com",
+		PAC:        srv.URL,
+	})
+	require.NoError(err)
+	require.Equal(1, served)
+
+	for url, expected := range map[string]string{
+		"https://git.gitlab.com/a/b.git":      "http://gitlab-proxy:3128",
+		"http://git.gitlab.com/a/b.git":       "",
+		"https://internal.gitlab.com/a/b.git": "",
+		"https://api.github.com/orgs/src-d":   "socks5://github-proxy:1080",
+		"https://bitbucket.org/a/b":           "",
+	} {
+		require.Equal(expected, proxyOf(t, p, url), url)
+	}
+
+	// the results are cached by host
+	require.Len(p.cache, 4)
+
+	dir, err := ioutil.TempDir("", "gitcollector-proxy")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "proxy.pac")
+	require.NoError(ioutil.WriteFile(path, []byte(`
+function FindProxyForURL(url, host) { return "PROXY file-proxy:3128"; }`,
+	), 0644))
+
+	p, err = New(&Opts{PAC: path})
+	require.NoError(err)
+	require.Equal("http://file-proxy:3128",
+		proxyOf(t, p, "https://github.com/src-d/gitcollector"))
+
+	_, err = New(&Opts{PAC: filepath.Join(dir, "missing.pac")})
+	require.True(ErrPACLoad.Is(err))
+	_, err = New(&Opts{PAC: srv.URL + "/missing"})
+	require.True(ErrPACLoad.Is(err))
+}
+
+func proxyOf(t *testing.T, p *Proxy, url string) string {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+
+	u, err := p.URL(req)
+	require.NoError(t, err)
+	if u == nil {
+		return ""
+	}
+
+	return u.String()
+}
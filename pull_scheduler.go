@@ -0,0 +1,36 @@
+package gitcollector
+
+import "context"
+
+// NewPullScheduleFn builds a new JobScheduleFn requesting the Jobs to the
+// given PullProviders in a round-robin fashion. The source of Jobs is closed
+// once all the providers are stopped.
+func NewPullScheduleFn(providers ...PullProvider) JobScheduleFn {
+	var current int
+	return func(ctx context.Context) (Job, error) {
+		for len(providers) > 0 {
+			if current >= len(providers) {
+				current = 0
+			}
+
+			provider := providers[current]
+			job, err := provider.Next(ctx)
+			if err == nil {
+				current++
+				return job, nil
+			}
+
+			if !ErrProviderStopped.Is(err) {
+				current++
+				return nil, err
+			}
+
+			providers = append(
+				providers[:current:current],
+				providers[current+1:]...,
+			)
+		}
+
+		return nil, ErrJobSource.New()
+	}
+}
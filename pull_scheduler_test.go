@@ -0,0 +1,47 @@
+package gitcollector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testPullProvider struct {
+	jobs []Job
+}
+
+func (p *testPullProvider) Next(ctx context.Context) (Job, error) {
+	if len(p.jobs) == 0 {
+		return nil, ErrProviderStopped.New()
+	}
+
+	var next Job
+	next, p.jobs = p.jobs[0], p.jobs[1:]
+	return next, nil
+}
+
+func TestPullScheduleFn(t *testing.T) {
+	var require = require.New(t)
+
+	schedule := NewPullScheduleFn(
+		&testPullProvider{jobs: []Job{
+			&testJob{id: "a"}, &testJob{id: "a"}, &testJob{id: "a"},
+		}},
+		&testPullProvider{},
+		&testPullProvider{jobs: []Job{&testJob{id: "b"}}},
+	)
+
+	var got []string
+	for {
+		job, err := schedule(context.Background())
+		if err != nil {
+			require.True(ErrJobSource.Is(err))
+			break
+		}
+
+		got = append(got, job.(*testJob).id)
+	}
+
+	require.Equal([]string{"a", "b", "a", "a"}, got)
+}
@@ -0,0 +1,139 @@
+package gitcollector
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiterOpts represents configuration options for a RateLimiter.
+type RateLimiterOpts struct {
+	// Sustained is the number of requests per second allowed on average,
+	// it's never exceeded over any period longer than a burst.
+	Sustained float64
+	// Burst is the number of requests saved while idle that can be made
+	// over the Sustained rate, default to 1.
+	Burst int
+	// BurstRate is the maximum number of requests per second while
+	// bursting, 0 means the saved requests are made at once.
+	BurstRate float64
+}
+
+// RateLimiter is a token bucket limiter with separate burst and sustained
+// rates. The sustained bucket refills at the Sustained rate up to Burst
+// tokens, so the requests saved while idle can be made right away, and the
+// burst bucket spaces them at the BurstRate. A request takes a token from
+// both. It's meant to be shared by all the iterators calling the same API.
+type RateLimiter struct {
+	mu        sync.Mutex
+	sustained *tokenBucket
+	burst     *tokenBucket
+	now       func() time.Time
+}
+
+// NewRateLimiter builds a new RateLimiter, it returns nil when the Sustained
+// rate isn't positive. A nil RateLimiter doesn't limit the requests.
+func NewRateLimiter(opts *RateLimiterOpts) *RateLimiter {
+	if opts == nil || opts.Sustained <= 0 {
+		return nil
+	}
+
+	burst := opts.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+
+	l := &RateLimiter{
+		sustained: newTokenBucket(opts.Sustained, float64(burst)),
+		now:       time.Now,
+	}
+
+	if opts.BurstRate > 0 {
+		l.burst = newTokenBucket(opts.BurstRate, 1)
+	}
+
+	return l
+}
+
+// Wait blocks until a request is allowed or the context is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	wait := l.reserve()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token from the buckets and returns the time to wait until
+// it's available.
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	wait := l.sustained.take(now)
+	if l.burst != nil {
+		wait = time.Duration(math.Max(
+			float64(wait), float64(l.burst.take(now)),
+		))
+	}
+
+	return wait
+}
+
+// cancel gives back the token of a request that won't be made.
+func (l *RateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sustained.tokens++
+	if l.burst != nil {
+		l.burst.tokens++
+	}
+}
+
+// tokenBucket holds the tokens of a bucket, they can be negative once the
+// future ones are reserved.
+type tokenBucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(rate, capacity float64) *tokenBucket {
+	return &tokenBucket{rate: rate, capacity: capacity, tokens: capacity}
+}
+
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	if !b.last.IsZero() && now.After(b.last) {
+		elapsed := now.Sub(b.last).Seconds()
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+	}
+
+	if now.After(b.last) {
+		b.last = now
+	}
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
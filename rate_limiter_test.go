@@ -0,0 +1,77 @@
+package gitcollector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	var require = require.New(t)
+
+	require.Nil(NewRateLimiter(nil))
+	require.Nil(NewRateLimiter(&RateLimiterOpts{Burst: 10}))
+
+	now := time.Now()
+	l := NewRateLimiter(&RateLimiterOpts{Sustained: 1, Burst: 3})
+	l.now = func() time.Time { return now }
+
+	// the burst is available at once, then the sustained rate applies
+	for i := 0; i < 3; i++ {
+		require.Equal(time.Duration(0), l.reserve())
+	}
+
+	require.Equal(time.Second, l.reserve())
+	require.Equal(2*time.Second, l.reserve())
+
+	// the burst is saved again while idle, but not over its size
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		require.Equal(time.Duration(0), l.reserve())
+	}
+
+	require.Equal(time.Second, l.reserve())
+}
+
+func TestRateLimiterBurstRate(t *testing.T) {
+	var require = require.New(t)
+
+	now := time.Now()
+	l := NewRateLimiter(&RateLimiterOpts{
+		Sustained: 1,
+		Burst:     3,
+		BurstRate: 10,
+	})
+	l.now = func() time.Time { return now }
+
+	require.Equal(time.Duration(0), l.reserve())
+	require.Equal(100*time.Millisecond, l.reserve())
+	require.Equal(200*time.Millisecond, l.reserve())
+	require.Equal(time.Second, l.reserve())
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	var require = require.New(t)
+
+	var l *RateLimiter
+	require.NoError(l.Wait(context.Background()))
+
+	l = NewRateLimiter(&RateLimiterOpts{Sustained: 100})
+	require.NoError(l.Wait(context.Background()))
+
+	start := time.Now()
+	require.NoError(l.Wait(context.Background()))
+	require.True(time.Since(start) >= 5*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the canceled requests give back their token
+	l = NewRateLimiter(&RateLimiterOpts{Sustained: 0.001})
+	require.NoError(l.Wait(context.Background()))
+	require.Equal(context.Canceled, l.Wait(ctx))
+	require.Equal(context.Canceled, l.Wait(ctx))
+	require.InDelta(0, l.sustained.tokens, 0.01)
+}
@@ -0,0 +1,145 @@
+package gitcollector
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// RunError aggregates the failures happened while a WorkerPool was running.
+type RunError struct {
+	// Providers are the errors of the providers that failed.
+	Providers []error
+	// Jobs are the errors of the failed jobs, only the first
+	// WorkerPoolOpts.MaxErrors of them are kept.
+	Jobs []error
+	// Failed is the total number of failed jobs.
+	Failed int
+	// Context is the error of the context the pool was run with, if it
+	// was canceled or its deadline exceeded.
+	Context error
+	// Shutdown reports the Jobs abandoned when the context was canceled.
+	Shutdown *ShutdownReport
+}
+
+var _ error = (*RunError)(nil)
+
+// Error implements the error interface.
+func (e *RunError) Error() string {
+	var parts []string
+	if e.Context != nil {
+		parts = append(parts, e.Context.Error())
+	}
+
+	if s := e.Shutdown; s != nil {
+		parts = append(parts, fmt.Sprintf(
+			"%d jobs discarded, %d canceled",
+			len(s.Discarded), len(s.Canceled),
+		))
+	}
+
+	for _, err := range e.Providers {
+		parts = append(parts, "provider: "+err.Error())
+	}
+
+	if e.Failed > 0 {
+		msg := fmt.Sprintf("%d jobs failed", e.Failed)
+		if len(e.Jobs) > 0 {
+			msg += ", first: " + e.Jobs[0].Error()
+		}
+
+		parts = append(parts, msg)
+	}
+
+	return "worker pool run failed: " + strings.Join(parts, "; ")
+}
+
+// runErrors collects the errors of a run. It's safe to use a nil runErrors,
+// no errors are collected then.
+type runErrors struct {
+	mu   sync.Mutex
+	max  int
+	errs RunError
+}
+
+func newRunErrors(max int) *runErrors {
+	return &runErrors{max: max}
+}
+
+func (r *runErrors) job(err error) {
+	if r == nil || err == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.errs.Failed++
+	if len(r.errs.Jobs) < r.max {
+		r.errs.Jobs = append(r.errs.Jobs, err)
+	}
+}
+
+func (r *runErrors) provider(err error) {
+	if r == nil || err == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.errs.Providers = append(r.errs.Providers, err)
+}
+
+func (r *runErrors) context(err error) {
+	if r == nil || err == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.errs.Context = err
+}
+
+func (r *runErrors) canceled() bool {
+	if r == nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.errs.Context != nil
+}
+
+func (r *runErrors) shutdown(report *ShutdownReport) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.errs.Shutdown = report
+}
+
+// err returns the collected errors or nil if there weren't any.
+func (r *runErrors) err() error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.errs.Failed == 0 && len(r.errs.Providers) == 0 &&
+		r.errs.Context == nil {
+		return nil
+	}
+
+	e := r.errs
+	e.Providers = append([]error(nil), r.errs.Providers...)
+	e.Jobs = append([]error(nil), r.errs.Jobs...)
+	return &e
+}
@@ -0,0 +1,332 @@
+// Package sandbox runs parts of the jobs, like the fetches of the
+// repositories, in a child process of gitcollector restricted to a temporal
+// root, with resource limits and unable to execute other programs, so the
+// untrusted repository data is processed with less privileges than the rest
+// of the collection.
+package sandbox
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/src-d/gitcollector/protocol"
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrNotSupported is returned when a restriction of the sandbox can't
+	// be applied in the platform.
+	ErrNotSupported = errors.NewKind("sandbox %s not supported")
+
+	// ErrUnknownTask is returned when the task run isn't registered.
+	ErrUnknownTask = errors.NewKind("unknown sandbox task %s")
+
+	// ErrTaskFailed is returned when the sandboxed process exits without
+	// reporting the result of its task.
+	ErrTaskFailed = errors.NewKind("sandboxed %s failed: %s")
+)
+
+const (
+	// taskEnv holds the name of the task run by the sandboxed process.
+	taskEnv = "GITCOLLECTOR_SANDBOX_TASK"
+	// resultFd is the descriptor of the sandboxed process writing the
+	// result of the task, the first of its extra files.
+	resultFd = 3
+)
+
+// TaskFn is a function run in the sandbox. The root is the directory the
+// process is restricted to, as seen by the process, and args are the
+// arguments of the task encoded as JSON.
+type TaskFn func(ctx context.Context, root string, args json.RawMessage) error
+
+type task struct {
+	fn    TaskFn
+	known []error
+}
+
+var (
+	tasksMu sync.RWMutex
+	tasks   = map[string]*task{}
+)
+
+// Register makes the given TaskFn available to be run in a sandbox with the
+// given name, it must be registered by both gitcollector processes, like in
+// an init function. The errors returned by the task with the message of one
+// of the known ones are returned as it by Sandbox.Run, so they can be
+// compared.
+func Register(name string, fn TaskFn, known ...error) {
+	tasksMu.Lock()
+	defer tasksMu.Unlock()
+
+	tasks[name] = &task{fn: fn, known: known}
+}
+
+func getTask(name string) (*task, bool) {
+	tasksMu.RLock()
+	defer tasksMu.RUnlock()
+
+	t, ok := tasks[name]
+	return t, ok
+}
+
+// Opts represents configuration options for a Sandbox.
+type Opts struct {
+	// Chroot restricts the processes to the root of their tasks, entering
+	// a user namespace when gitcollector isn't run as root.
+	Chroot bool
+	// NoExec forbids the processes to execute any program.
+	NoExec bool
+	// Cgroup is the directory of a cgroup v2, where a child cgroup is
+	// created for every process to apply the Memory, CPU and Pids limits.
+	Cgroup string
+	// Memory is the maximum memory in bytes of every process, unlimited
+	// if 0. It requires a Cgroup.
+	Memory int64
+	// CPU is the maximum number of CPUs used by every process, like 0.5,
+	// unlimited if 0. It requires a Cgroup.
+	CPU float64
+	// Pids is the maximum number of threads of every process, unlimited
+	// if 0. It requires a Cgroup.
+	Pids int
+	// Files is the maximum number of files open by every process,
+	// inherited from gitcollector if 0.
+	Files uint64
+	// FileSize is the maximum size in bytes of the files written by
+	// every process, unlimited if 0.
+	FileSize uint64
+	// Executable is the gitcollector binary run as the sandboxed process,
+	// default to the running one.
+	Executable string
+}
+
+// Sandbox runs the registered tasks in restricted child processes.
+type Sandbox struct {
+	opts *Opts
+}
+
+// New builds a new Sandbox, it fails if a restriction can't be applied in
+// the platform.
+func New(opts *Opts) (*Sandbox, error) {
+	if opts == nil {
+		opts = &Opts{}
+	}
+
+	if opts.Executable == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+
+		opts.Executable = exe
+	}
+
+	if err := supported(opts); err != nil {
+		return nil, err
+	}
+
+	return &Sandbox{opts: opts}, nil
+}
+
+// Task is a registered task run in a Sandbox.
+type Task struct {
+	// Name is the name the TaskFn was registered with.
+	Name string
+	// Root is the directory the process is restricted to, it must exist.
+	Root string
+	// Args are the arguments of the task, encoded as JSON.
+	Args interface{}
+	// Hosts are the hosts the task connects to. They're resolved before
+	// restricting the process, which can't read the system configuration
+	// once it's in its root, and dialed over HTTP at those addresses.
+	Hosts []string
+}
+
+type request struct {
+	Limits *Opts             `json:"limits"`
+	Root   string            `json:"root"`
+	Args   json.RawMessage   `json:"args,omitempty"`
+	Pins   map[string]string `json:"pins,omitempty"`
+}
+
+type result struct {
+	Error string `json:"error,omitempty"`
+}
+
+// Run runs the task in a new sandboxed process, returning the error of the
+// task, if any.
+func (s *Sandbox) Run(ctx context.Context, t *Task) error {
+	task, ok := getTask(t.Name)
+	if !ok {
+		return ErrUnknownTask.New(t.Name)
+	}
+
+	args, err := json.Marshal(t.Args)
+	if err != nil {
+		return err
+	}
+
+	pins := map[string]string{}
+	for _, host := range t.Hosts {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return err
+		}
+
+		pins[host] = addrs[0]
+	}
+
+	// the result is reported through its own pipe, the task can write to
+	// the standard output.
+	rp, wp, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer rp.Close()
+
+	cmd := exec.CommandContext(ctx, s.opts.Executable)
+	cmd.Env = append(os.Environ(), taskEnv+"="+t.Name)
+	cmd.SysProcAttr = sysProcAttr(s.opts)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{wp}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		wp.Close()
+		return err
+	}
+
+	err = cmd.Start()
+	wp.Close()
+	if err != nil {
+		return err
+	}
+
+	var (
+		output []byte
+		done   = make(chan struct{})
+	)
+
+	go func() {
+		output, _ = ioutil.ReadAll(rp)
+		close(done)
+	}()
+
+	// the request is sent once the process is in its cgroup, so the task
+	// doesn't start until the limits apply.
+	cg, err := joinCgroup(s.opts, cmd.Process.Pid)
+	if err == nil {
+		err = json.NewEncoder(stdin).Encode(&request{
+			Limits: s.opts,
+			Root:   t.Root,
+			Args:   args,
+			Pins:   pins,
+		})
+	}
+
+	stdin.Close()
+	if err != nil {
+		cmd.Process.Kill()
+	}
+
+	werr := cmd.Wait()
+	<-done
+	if cg != nil {
+		cg.remove()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var res result
+	if err := json.Unmarshal(output, &res); err != nil {
+		if werr == nil {
+			werr = err
+		}
+
+		return ErrTaskFailed.New(t.Name, werr)
+	}
+
+	if res.Error == "" {
+		return nil
+	}
+
+	for _, known := range task.known {
+		if known.Error() == res.Error {
+			return known
+		}
+	}
+
+	return fmt.Errorf("%s", res.Error)
+}
+
+// Init runs the task of the process if it was started by a Sandbox, exiting
+// once it's done. It must be called at the start of the main function.
+func Init() {
+	name, ok := os.LookupEnv(taskEnv)
+	if !ok {
+		return
+	}
+
+	var res result
+	if err := runTask(os.Stdin, name); err != nil {
+		res.Error = err.Error()
+	}
+
+	json.NewEncoder(os.NewFile(resultFd, "result")).Encode(&res)
+	os.Exit(0)
+}
+
+func runTask(r io.Reader, name string) error {
+	task, ok := getTask(name)
+	if !ok {
+		return ErrUnknownTask.New(name)
+	}
+
+	var req request
+	if err := json.NewDecoder(r).Decode(&req); err != nil {
+		return err
+	}
+
+	if req.Limits == nil {
+		req.Limits = &Opts{}
+	}
+
+	// the certificates are loaded before restricting the process, it
+	// can't read them once it's in its root.
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		return err
+	}
+
+	client := protocol.NewDialer(&protocol.DialerOpts{
+		Policy: protocol.NewPinPolicy(req.Pins),
+	}).Client()
+	client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{
+		RootCAs: pool,
+	}
+
+	protocol.Install(nil, client)
+
+	root, err := restrict(req.Limits, req.Root)
+	if err != nil {
+		return err
+	}
+
+	return task.fn(context.Background(), root, req.Args)
+}
@@ -0,0 +1,211 @@
+package sandbox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetNoNewPrivs       = 38
+	seccompSetModeFilter  = 1
+	seccompFilterFlagSync = 1
+	seccompRetAllow       = 0x7fff0000
+	seccompRetErrno       = 0x00050000
+	cpuPeriod             = 100000
+)
+
+func supported(opts *Opts) error {
+	if opts.NoExec && auditArch == 0 {
+		return ErrNotSupported.New("no exec on " + runtime.GOARCH)
+	}
+
+	if opts.Cgroup != "" {
+		info, err := os.Stat(filepath.Join(opts.Cgroup, "cgroup.procs"))
+		if err != nil || info.IsDir() {
+			return ErrNotSupported.New("cgroup " + opts.Cgroup)
+		}
+	}
+
+	return nil
+}
+
+// sysProcAttr makes the process root of a new user namespace to restrict it
+// to its root without being run as root.
+func sysProcAttr(opts *Opts) *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+	if !opts.Chroot || os.Getuid() == 0 {
+		return attr
+	}
+
+	attr.Cloneflags = syscall.CLONE_NEWUSER
+	attr.UidMappings = []syscall.SysProcIDMap{
+		{ContainerID: 0, HostID: os.Getuid(), Size: 1},
+	}
+	attr.GidMappings = []syscall.SysProcIDMap{
+		{ContainerID: 0, HostID: os.Getgid(), Size: 1},
+	}
+
+	return attr
+}
+
+type cgroup struct {
+	path string
+}
+
+// joinCgroup creates the cgroup of the process with its limits and moves the
+// process into it. It returns nil if there's no cgroup configured.
+func joinCgroup(opts *Opts, pid int) (*cgroup, error) {
+	if opts.Cgroup == "" {
+		return nil, nil
+	}
+
+	cg := &cgroup{
+		path: filepath.Join(opts.Cgroup, fmt.Sprintf("gitcollector-%d", pid)),
+	}
+
+	if err := os.Mkdir(cg.path, 0755); err != nil {
+		return nil, err
+	}
+
+	limits := map[string]string{}
+	if opts.Memory > 0 {
+		limits["memory.max"] = strconv.FormatInt(opts.Memory, 10)
+	}
+
+	if opts.CPU > 0 {
+		limits["cpu.max"] = fmt.Sprintf("%d %d",
+			int64(opts.CPU*cpuPeriod), cpuPeriod)
+	}
+
+	if opts.Pids > 0 {
+		limits["pids.max"] = strconv.Itoa(opts.Pids)
+	}
+
+	limits["cgroup.procs"] = strconv.Itoa(pid)
+	for _, file := range []string{
+		"memory.max", "cpu.max", "pids.max", "cgroup.procs",
+	} {
+		value, ok := limits[file]
+		if !ok {
+			continue
+		}
+
+		path := filepath.Join(cg.path, file)
+		if err := ioutil.WriteFile(path, []byte(value), 0644); err != nil {
+			cg.remove()
+			return nil, err
+		}
+	}
+
+	return cg, nil
+}
+
+func (c *cgroup) remove() error {
+	return os.Remove(c.path)
+}
+
+// restrict applies the limits to the running process, returning its root as
+// seen once it's restricted.
+func restrict(opts *Opts, root string) (string, error) {
+	if opts.Files > 0 {
+		err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &syscall.Rlimit{
+			Cur: opts.Files,
+			Max: opts.Files,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if opts.FileSize > 0 {
+		err := syscall.Setrlimit(syscall.RLIMIT_FSIZE, &syscall.Rlimit{
+			Cur: opts.FileSize,
+			Max: opts.FileSize,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if opts.Chroot {
+		if err := syscall.Chroot(root); err != nil {
+			return "", err
+		}
+
+		if err := syscall.Chdir("/"); err != nil {
+			return "", err
+		}
+
+		root = "/"
+	}
+
+	if opts.NoExec {
+		if err := forbidExec(); err != nil {
+			return "", err
+		}
+	}
+
+	return root, nil
+}
+
+// forbidExec installs a seccomp filter on every thread of the process making
+// execve and execveat fail with EPERM.
+func forbidExec() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	filter := []syscall.SockFilter{
+		// the architecture of the system call
+		bpfStmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, 4),
+		bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, auditArch, 1, 0),
+		bpfStmt(syscall.BPF_RET|syscall.BPF_K, seccompRetErrno|uint32(syscall.EPERM)),
+		// the number of the system call
+		bpfStmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, 0),
+		bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, sysExecve, 2, 0),
+		bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, sysExecveat, 1, 0),
+		bpfStmt(syscall.BPF_RET|syscall.BPF_K, seccompRetAllow),
+		bpfStmt(syscall.BPF_RET|syscall.BPF_K, seccompRetErrno|uint32(syscall.EPERM)),
+	}
+
+	prog := syscall.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0)
+	if errno != 0 {
+		return errno
+	}
+
+	// the filter fails with the ID of the thread that couldn't be
+	// synchronized, if any.
+	tid, _, errno := syscall.RawSyscall(
+		sysSeccomp,
+		seccompSetModeFilter,
+		seccompFilterFlagSync,
+		uintptr(unsafe.Pointer(&prog)),
+	)
+	if errno != 0 {
+		return errno
+	}
+
+	if tid != 0 {
+		return fmt.Errorf("seccomp filter not set on thread %d", tid)
+	}
+
+	return nil
+}
+
+func bpfStmt(code uint16, k uint32) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, K: k}
+}
+
+func bpfJump(code uint16, k uint32, jt, jf uint8) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
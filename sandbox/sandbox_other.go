@@ -0,0 +1,29 @@
+//go:build !linux
+// +build !linux
+
+package sandbox
+
+import "syscall"
+
+// the processes can only be restricted on linux.
+func supported(opts *Opts) error {
+	return ErrNotSupported.New("on this platform")
+}
+
+func sysProcAttr(*Opts) *syscall.SysProcAttr {
+	return nil
+}
+
+type cgroup struct{}
+
+func joinCgroup(*Opts, int) (*cgroup, error) {
+	return nil, nil
+}
+
+func (*cgroup) remove() error {
+	return nil
+}
+
+func restrict(*Opts, string) (string, error) {
+	return "", ErrNotSupported.New("on this platform")
+}
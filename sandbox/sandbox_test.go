@@ -0,0 +1,107 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errTest = fmt.Errorf("test error")
+
+func init() {
+	Register("write", func(
+		_ context.Context,
+		root string,
+		args json.RawMessage,
+	) error {
+		var content string
+		if err := json.Unmarshal(args, &content); err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(
+			filepath.Join(root, "file"), []byte(content), 0644,
+		)
+	})
+
+	Register("exec", func(context.Context, string, json.RawMessage) error {
+		return exec.Command("/bin/true").Run()
+	})
+
+	Register("fail", func(context.Context, string, json.RawMessage) error {
+		return errTest
+	}, errTest)
+}
+
+func TestMain(m *testing.M) {
+	Init()
+	os.Exit(m.Run())
+}
+
+func TestSandbox(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sandbox only supported on linux")
+	}
+
+	var require = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector-sandbox")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s, err := New(&Opts{Chroot: true})
+	require.NoError(err)
+
+	ctx := context.Background()
+	err = s.Run(ctx, &Task{Name: "write", Root: dir, Args: "foo"})
+	if err != nil && os.IsPermission(err) {
+		t.Skip("user namespaces not available")
+	}
+
+	require.NoError(err)
+
+	// the task writes in its root
+	content, err := ioutil.ReadFile(filepath.Join(dir, "file"))
+	require.NoError(err)
+	require.Equal("foo", string(content))
+
+	// the known errors are returned as they are
+	err = s.Run(ctx, &Task{Name: "fail", Root: dir})
+	require.Equal(errTest, err)
+
+	err = s.Run(ctx, &Task{Name: "unknown", Root: dir})
+	require.True(ErrUnknownTask.Is(err))
+}
+
+func TestSandboxNoExec(t *testing.T) {
+	if runtime.GOOS != "linux" || auditArch == 0 {
+		t.Skip("no exec not supported")
+	}
+
+	if _, err := os.Stat("/bin/true"); err != nil {
+		t.Skip("/bin/true not found")
+	}
+
+	var require = require.New(t)
+
+	s, err := New(nil)
+	require.NoError(err)
+
+	ctx := context.Background()
+	require.NoError(s.Run(ctx, &Task{Name: "exec", Root: "/"}))
+
+	s, err = New(&Opts{NoExec: true})
+	require.NoError(err)
+
+	err = s.Run(ctx, &Task{Name: "exec", Root: "/"})
+	require.Error(err)
+	require.Contains(err.Error(), "operation not permitted")
+}
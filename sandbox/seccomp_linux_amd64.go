@@ -0,0 +1,8 @@
+package sandbox
+
+const (
+	auditArch   = 0xc000003e
+	sysSeccomp  = 317
+	sysExecve   = 59
+	sysExecveat = 322
+)
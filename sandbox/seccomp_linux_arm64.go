@@ -0,0 +1,8 @@
+package sandbox
+
+const (
+	auditArch   = 0xc00000b7
+	sysSeccomp  = 277
+	sysExecve   = 221
+	sysExecveat = 281
+)
@@ -2,6 +2,7 @@ package gitcollector
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"gopkg.in/src-d/go-errors.v1"
@@ -22,16 +23,33 @@ var (
 type JobScheduleFn func(context.Context) (Job, error)
 
 type jobScheduler struct {
-	jobs     chan Job
+	jobs chan Job
+	// urgent holds the Jobs with a priority higher than PriorityNormal,
+	// the workers take them first.
+	urgent   chan Job
 	schedule JobScheduleFn
 	cancel   chan struct{}
+	once     sync.Once
+	window   *orderedWindow
 	opts     *WorkerPoolOpts
+	// exited is closed once Schedule returns.
+	exited chan struct{}
+	// discarded holds the Job scheduled when it was canceled, if any.
+	discarded []Job
+	// delayed holds the DelayedJobs until their time comes, they're sent
+	// to the workers by release.
+	delayed *timerWheel
+	// closed is closed once the source of Jobs is closed, so release
+	// closes the queues once delayed is empty.
+	closed   chan struct{}
+	released chan struct{}
 }
 
 const (
-	schedCapacity = 1000
-	jobTimeout    = 3 * time.Second
-	newJobTimeout = 30 * time.Second
+	schedCapacity   = 1000
+	jobTimeout      = 3 * time.Second
+	newJobTimeout   = 30 * time.Second
+	delayResolution = time.Second
 )
 
 func newJobScheduler(
@@ -50,24 +68,74 @@ func newJobScheduler(
 		opts.WaitNewJobTimeout = newJobTimeout
 	}
 
-	return &jobScheduler{
+	if opts.DelayResolution <= 0 {
+		opts.DelayResolution = delayResolution
+	}
+
+	s := &jobScheduler{
 		jobs:     make(chan Job, opts.SchedulerCapacity),
+		urgent:   make(chan Job, opts.SchedulerCapacity),
 		schedule: schedule,
 		cancel:   make(chan struct{}),
 		opts:     opts,
+		exited:   make(chan struct{}),
+		delayed:  newTimerWheel(opts.DelayResolution, time.Now()),
+		closed:   make(chan struct{}),
+		released: make(chan struct{}),
+	}
+
+	if opts.OrderedWindow > 0 {
+		s.window = newOrderedWindow(opts.OrderedWindow)
 	}
+
+	return s
 }
 
 func (s *jobScheduler) finish() {
-	s.cancel <- struct{}{}
+	s.once.Do(func() { close(s.cancel) })
+}
+
+// pending returns the Jobs scheduled that weren't processed, the delayed ones
+// included. It must be called once Schedule returned and the workers finished.
+func (s *jobScheduler) pending() []Job {
+	jobs := drainJobs(s.discarded, s.urgent)
+	jobs = drainJobs(jobs, s.jobs)
+	for _, d := range s.delayed.drain() {
+		jobs = append(jobs, d.discovered)
+	}
+
+	return jobs
+}
+
+func drainJobs(jobs []Job, queue chan Job) []Job {
+	for {
+		select {
+		case job, ok := <-queue:
+			if !ok {
+				return jobs
+			}
+
+			job, _ = unwrapJob(job)
+			jobs = append(jobs, job)
+		default:
+			return jobs
+		}
+	}
 }
 
 func (s *jobScheduler) Schedule() {
+	defer close(s.exited)
+	go s.release()
+	defer func() { <-s.released }()
 	for {
 		select {
 		case <-s.cancel:
 			return
 		default:
+			if s.window != nil && !s.window.acquire(s.cancel) {
+				return
+			}
+
 			ctx, cancel := context.WithTimeout(
 				context.Background(),
 				s.opts.WaitJobTimeout,
@@ -89,20 +157,91 @@ func (s *jobScheduler) Schedule() {
 					}
 				}
 
+				// the queues are closed by release once
+				// all the delayed Jobs are sent.
 				if ErrJobSource.Is(err) {
-					close(s.jobs)
+					close(s.closed)
 					return
 				}
 
 				continue
 			}
 
-			select {
-			case s.jobs <- job:
-				s.opts.Metrics.Discover(job)
-			case <-s.cancel:
+			discovered := job
+			if s.window != nil {
+				job = s.window.dispatch(job)
+			}
+
+			if at := JobNotBefore(discovered); time.Now().Before(at) {
+				s.delayed.add(job, discovered, at)
+				continue
+			}
+
+			if !s.enqueue(job, discovered) {
+				s.discarded = append(s.discarded, discovered)
 				return
 			}
 		}
 	}
 }
+
+// enqueue sends the Job to the workers, it returns false if the scheduler is
+// canceled before.
+func (s *jobScheduler) enqueue(job, discovered Job) bool {
+	queue := s.jobs
+	if JobPriority(discovered) > PriorityNormal {
+		queue = s.urgent
+	}
+
+	// it's published before the Job can be started by a worker.
+	if !s.opts.Events.publish(s.cancel, &JobEvent{
+		Type: JobEnqueued, Job: discovered,
+	}) {
+		return false
+	}
+
+	select {
+	case queue <- job:
+		s.opts.Metrics.Discover(discovered)
+		return true
+	case <-s.cancel:
+		return false
+	}
+}
+
+// release sends the delayed Jobs to the workers once their time comes, until
+// the scheduler is canceled or the source of Jobs is closed and all of them
+// were sent, closing the queues then.
+func (s *jobScheduler) release() {
+	defer close(s.released)
+
+	ticker := time.NewTicker(s.opts.DelayResolution)
+	defer ticker.Stop()
+
+	closed := s.closed
+	for {
+		select {
+		case <-s.cancel:
+			return
+		case <-closed:
+			closed = nil
+		case now := <-ticker.C:
+			due := s.delayed.expire(now)
+			for i, d := range due {
+				if !s.enqueue(d.job, d.discovered) {
+					s.delayed.delivered(i)
+					s.delayed.restore(due[i:])
+					return
+				}
+			}
+
+			s.delayed.delivered(len(due))
+		}
+
+		if closed == nil && s.delayed.len() == 0 {
+			close(s.jobs)
+			close(s.urgent)
+			return
+		}
+	}
+}
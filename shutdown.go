@@ -0,0 +1,76 @@
+package gitcollector
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ShutdownReport describes what was abandoned when a WorkerPool was stopped
+// before processing all its Jobs, so the operators know what to expect on
+// the next start.
+type ShutdownReport struct {
+	// Immediate is set when the Jobs being processed were canceled
+	// instead of waited for.
+	Immediate bool
+	// Discarded are the Jobs scheduled that were never processed.
+	Discarded []Job
+	// Canceled are the Jobs that failed because they were canceled while
+	// being processed.
+	Canceled []Job
+	// Cleanups are the results of the WorkerPoolOpts OnShutdown
+	// functions, in the same order.
+	Cleanups []ShutdownCleanup
+}
+
+// Err returns the errors of the failed cleanups, nil if all of them
+// succeeded.
+func (r *ShutdownReport) Err() error {
+	var failed []string
+	for _, c := range r.Cleanups {
+		if c.Err != nil {
+			failed = append(failed, c.Name+": "+c.Err.Error())
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("shutdown cleanups failed: %v", failed)
+}
+
+// ShutdownCleanup is the result of a ShutdownFn.
+type ShutdownCleanup struct {
+	// Name identifies the cleanup, like "temporal files".
+	Name string
+	// Detail describes what was done, like the number of files removed.
+	Detail string
+	// Err is the error of the cleanup, if it failed.
+	Err error
+}
+
+// ShutdownFn is called once a WorkerPool is stopped and all its Jobs have
+// returned, with the report of the abandoned Jobs. It performs a cleanup, like
+// removing partial temporal data or writing checkpoints of the abandoned Jobs
+// to resume them on the next start.
+type ShutdownFn func(*ShutdownReport) ShutdownCleanup
+
+// abandonedJobs collects the Jobs canceled while being processed.
+type abandonedJobs struct {
+	mu       sync.Mutex
+	canceled []Job
+}
+
+func (a *abandonedJobs) cancel(job Job) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.canceled = append(a.canceled, job)
+}
+
+func (a *abandonedJobs) list() []Job {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]Job(nil), a.canceled...)
+}
@@ -0,0 +1,194 @@
+package gitcollector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPoolStopReport(t *testing.T) {
+	var require = require.New(t)
+
+	var got *ShutdownReport
+	queue := make(chan Job, 10)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{
+		SchedulerCapacity: 10,
+		OnShutdown: []ShutdownFn{
+			func(r *ShutdownReport) ShutdownCleanup {
+				got = r
+				return ShutdownCleanup{Name: "ok", Detail: "done"}
+			},
+			func(*ShutdownReport) ShutdownCleanup {
+				return ShutdownCleanup{
+					Name: "failing",
+					Err:  fmt.Errorf("broken"),
+				}
+			},
+		},
+	})
+
+	wp.SetWorkers(1)
+	wp.Run()
+
+	started := make(chan struct{})
+	blocked := &testBlockingJob{started: started}
+	queue <- blocked
+	<-started
+
+	queued := []Job{&testJob{id: "a"}, &testJob{id: "b"}}
+	for _, j := range queued {
+		queue <- j
+	}
+
+	// wait for the scheduler to take them from the queue
+	for len(queue) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	wp.Stop()
+	report := wp.ShutdownReport()
+	require.True(report.Immediate)
+	require.Equal([]Job{blocked}, report.Canceled)
+	require.ElementsMatch(queued, report.Discarded)
+	require.Len(report.Cleanups, 2)
+	require.Equal("done", report.Cleanups[0].Detail)
+	require.EqualError(
+		report.Err(), "shutdown cleanups failed: [failing: broken]",
+	)
+	require.True(got == report)
+
+	// the report is built once
+	wp.Stop()
+	require.True(wp.ShutdownReport() == report)
+}
+
+func TestWorkerPoolRunContextReport(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 5)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{})
+	wp.SetWorkers(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wp.RunContext(ctx)
+
+	started := make(chan struct{})
+	blocked := &testBlockingJob{started: started}
+	queue <- blocked
+	<-started
+	cancel()
+
+	err := wp.WaitError()
+	require.Error(err)
+
+	runErr, ok := err.(*RunError)
+	require.True(ok)
+	require.NotNil(runErr.Shutdown)
+	require.True(runErr.Shutdown.Immediate)
+	require.Equal([]Job{blocked}, runErr.Shutdown.Canceled)
+	require.NoError(runErr.Shutdown.Err())
+	require.Contains(err.Error(), "0 jobs discarded, 1 canceled")
+}
+
+func TestWorkerPoolCloseReport(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 5)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{})
+	wp.SetWorkers(1)
+	wp.Run()
+
+	processed := make(chan struct{})
+	queue <- &testJob{process: func(string) error {
+		close(processed)
+		return nil
+	}}
+	<-processed
+
+	wp.Close()
+	report := wp.ShutdownReport()
+	require.False(report.Immediate)
+	require.Empty(report.Canceled)
+	require.Empty(report.Discarded)
+}
+
+func TestWorkerPoolDrain(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 10)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{
+		SchedulerCapacity: 10,
+	})
+	wp.SetWorkers(1)
+	wp.Run()
+
+	var (
+		started  = make(chan struct{})
+		release  = make(chan struct{})
+		finished bool
+	)
+
+	queue <- &testJob{process: func(string) error {
+		close(started)
+		<-release
+		finished = true
+		return nil
+	}}
+	<-started
+
+	queued := []Job{&testJob{id: "a"}, &testJob{id: "b"}}
+	for _, j := range queued {
+		queue <- j
+	}
+
+	for len(queue) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	drained := make(chan *ShutdownReport)
+	go func() { drained <- wp.Drain(context.Background()) }()
+
+	// the running job is waited for
+	select {
+	case <-drained:
+		require.FailNow("drained before the running job finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	report := <-drained
+	require.True(finished)
+	require.False(report.Immediate)
+	require.Empty(report.Canceled)
+	require.ElementsMatch(queued, report.Discarded)
+	require.NoError(wp.WaitError())
+}
+
+func TestWorkerPoolDrainDeadline(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 5)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{})
+	wp.SetWorkers(2)
+	wp.Run()
+
+	started := make(chan struct{})
+	blocked := &testBlockingJob{started: started}
+	queue <- blocked
+	<-started
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 10*time.Millisecond,
+	)
+	defer cancel()
+
+	// the jobs still running once the deadline passes are canceled
+	report := wp.Drain(ctx)
+	require.True(report.Immediate)
+	require.Equal([]Job{blocked}, report.Canceled)
+	require.Empty(report.Discarded)
+	require.Zero(wp.Size())
+}
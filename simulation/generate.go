@@ -0,0 +1,174 @@
+package simulation
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// epoch is the date of the first commit of every repository, the commits are
+// an hour apart so the same history always has the same hashes.
+var epoch = time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+const letters = "abcdefghijklmnopqrstuvwxyz0123456789\n"
+
+// generate builds the storage of the repository, its history extends the one
+// of the repository it's forked from.
+func (s *Simulation) generate(repo *Repository) (*memory.Storage, error) {
+	sto := memory.NewStorage()
+	g := &generator{
+		sto:   sto,
+		files: make([]plumbing.Hash, s.opts.Files),
+		size:  s.opts.FileSize,
+	}
+
+	var chain []*Repository
+	for r := repo; r != nil; r = r.Fork {
+		chain = append([]*Repository{r}, chain...)
+	}
+
+	for _, r := range chain {
+		if err := g.commits(r.seed, r.Commits); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(g.history) == 0 {
+		return sto, nil
+	}
+
+	master := plumbing.NewBranchReferenceName("master")
+	refs := []*plumbing.Reference{
+		plumbing.NewSymbolicReference(plumbing.HEAD, master),
+		plumbing.NewHashReference(master, g.history[len(g.history)-1]),
+	}
+
+	for i := 1; i < repo.Branches; i++ {
+		refs = append(refs, plumbing.NewHashReference(
+			plumbing.NewBranchReferenceName(fmt.Sprintf("branch-%d", i)),
+			g.history[len(g.history)*i/repo.Branches],
+		))
+	}
+
+	for _, ref := range refs {
+		if err := sto.SetReference(ref); err != nil {
+			return nil, err
+		}
+	}
+
+	return sto, nil
+}
+
+type generator struct {
+	sto     *memory.Storage
+	files   []plumbing.Hash
+	size    int
+	history []plumbing.Hash
+}
+
+// commits adds n commits to the history, each of them changing one file.
+func (g *generator) commits(seed int64, n int) error {
+	r := rand.New(rand.NewSource(seed))
+	for i := 0; i < n; i++ {
+		idx := len(g.history) % len(g.files)
+		blob, err := g.blob(r)
+		if err != nil {
+			return err
+		}
+
+		g.files[idx] = blob
+		tree, err := g.tree()
+		if err != nil {
+			return err
+		}
+
+		sig := object.Signature{
+			Name:  "gitcollector simulation",
+			Email: "simulation@gitcollector",
+			When:  epoch.Add(time.Duration(len(g.history)) * time.Hour),
+		}
+
+		commit := &object.Commit{
+			Author:    sig,
+			Committer: sig,
+			Message:   fmt.Sprintf("change file-%03d", idx),
+			TreeHash:  tree,
+		}
+
+		if len(g.history) > 0 {
+			commit.ParentHashes = []plumbing.Hash{
+				g.history[len(g.history)-1],
+			}
+		}
+
+		hash, err := g.store(commit)
+		if err != nil {
+			return err
+		}
+
+		g.history = append(g.history, hash)
+	}
+
+	return nil
+}
+
+func (g *generator) blob(r *rand.Rand) (plumbing.Hash, error) {
+	data := make([]byte, g.size)
+	for i := range data {
+		data[i] = letters[r.Intn(len(letters))]
+	}
+
+	obj := g.sto.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return g.sto.SetEncodedObject(obj)
+}
+
+// tree stores the tree with the current files, the ones not written yet are
+// left out.
+func (g *generator) tree() (plumbing.Hash, error) {
+	tree := &object.Tree{}
+	for i, hash := range g.files {
+		if hash.IsZero() {
+			continue
+		}
+
+		tree.Entries = append(tree.Entries, object.TreeEntry{
+			Name: fmt.Sprintf("file-%03d", i),
+			Mode: filemode.Regular,
+			Hash: hash,
+		})
+	}
+
+	return g.store(tree)
+}
+
+type encoder interface {
+	Encode(plumbing.EncodedObject) error
+}
+
+func (g *generator) store(o encoder) (plumbing.Hash, error) {
+	obj := g.sto.NewEncodedObject()
+	if err := o.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return g.sto.SetEncodedObject(obj)
+}
@@ -0,0 +1,49 @@
+package simulation
+
+import (
+	"context"
+	"time"
+
+	"github.com/src-d/gitcollector/discovery"
+
+	"github.com/google/go-github/github"
+)
+
+// ReposIter is a discovery.GHRepositoriesIter over the synthetic repositories
+// of an organization, so they can be discovered by a discovery.GHProvider.
+type ReposIter struct {
+	repos []*Repository
+	next  int
+}
+
+var _ discovery.GHRepositoriesIter = (*ReposIter)(nil)
+
+// OrgIter builds a ReposIter for the given organization.
+func (s *Simulation) OrgIter(org string) *ReposIter {
+	return &ReposIter{repos: s.OrgRepositories(org)}
+}
+
+// Next implements the discovery.GHRepositoriesIter interface. Once all the
+// repositories are returned discovery.ErrNewRepositoriesNotFound is returned.
+func (it *ReposIter) Next(
+	_ context.Context,
+) (*github.Repository, time.Duration, error) {
+	if it.next >= len(it.repos) {
+		return nil, 0, discovery.ErrNewRepositoriesNotFound.New()
+	}
+
+	r := it.repos[it.next]
+	it.next++
+
+	return &github.Repository{
+		Name:     github.String(r.Name),
+		FullName: github.String(r.FullName()),
+		HTMLURL:  github.String(r.Endpoint()),
+		Fork:     github.Bool(r.Fork != nil),
+		Language: github.String(r.Language),
+		Topics:   r.Topics,
+		// the API reports the size in kilobytes.
+		Size:     github.Int(int(r.Size / 1024)),
+		PushedAt: &github.Timestamp{Time: r.PushedAt},
+	}, 0, nil
+}
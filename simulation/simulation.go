@@ -0,0 +1,277 @@
+// Package simulation generates synthetic repositories locally, so the
+// scheduling, quotas, storage and metrics of gitcollector can be load tested
+// and benchmarked deterministically without network access.
+package simulation
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+)
+
+const (
+	// Scheme is the protocol of the endpoints of the synthetic
+	// repositories.
+	Scheme = "sim"
+	// Host is the host of the endpoints of the synthetic repositories.
+	Host = "simulation"
+)
+
+// Opts represents configuration options for a Simulation.
+type Opts struct {
+	// Orgs are the organizations holding the repositories, default to
+	// a single "sim" organization.
+	Orgs []string
+	// Repos is the number of repositories of each organization, default
+	// to 10.
+	Repos int
+	// Seed generates the shape and contents of the repositories, the
+	// same seed always generates the same repositories.
+	Seed int64
+	// MinCommits and MaxCommits bound the number of commits of each
+	// repository, default to 1 and 20.
+	MinCommits int
+	MaxCommits int
+	// Files is the number of files in the tree of every commit, default
+	// to 5.
+	Files int
+	// FileSize is the size in bytes of every file, default to 1KiB.
+	FileSize int
+	// Branches is the number of branches of each repository, default
+	// to 1.
+	Branches int
+	// Forks is the probability of a repository to be a fork of a
+	// previous one of its organization, extending its history.
+	Forks float64
+	// Empty is the probability of a repository to have no commits.
+	Empty float64
+	// Languages are assigned randomly to the repositories, default to
+	// Go, Python and JavaScript.
+	Languages []string
+	// Latency is the time waited before serving a repository, simulating
+	// the network.
+	Latency time.Duration
+	// Now is the time the push dates of the repositories are relative
+	// to, default to the time the Simulation is built.
+	Now time.Time
+}
+
+const (
+	defaultOrg      = "sim"
+	defaultRepos    = 10
+	defaultCommits  = 20
+	defaultFiles    = 5
+	defaultFileSize = 1024
+)
+
+var defaultLanguages = []string{"Go", "Python", "JavaScript"}
+
+// Repository describes a synthetic repository.
+type Repository struct {
+	Org      string
+	Name     string
+	Commits  int
+	Branches int
+	// Fork is the repository whose history this one extends, if any.
+	Fork     *Repository
+	Language string
+	Topics   []string
+	PushedAt time.Time
+	// Size is the approximate size in bytes of the repository contents.
+	Size uint64
+
+	seed int64
+}
+
+// FullName returns the org/name of the repository.
+func (r *Repository) FullName() string {
+	return r.Org + "/" + r.Name
+}
+
+// Endpoint returns the URL the repository is served at.
+func (r *Repository) Endpoint() string {
+	return fmt.Sprintf("%s://%s/%s", Scheme, Host, r.FullName())
+}
+
+// Simulation holds a deterministic set of synthetic repositories and serves
+// them through the Scheme protocol once installed. The repositories are
+// generated in memory every time they're requested.
+type Simulation struct {
+	repos  []*Repository
+	byName map[string]*Repository
+	opts   *Opts
+}
+
+var _ server.Loader = (*Simulation)(nil)
+
+// New builds a new Simulation.
+func New(opts *Opts) *Simulation {
+	if opts == nil {
+		opts = &Opts{}
+	}
+
+	if len(opts.Orgs) == 0 {
+		opts.Orgs = []string{defaultOrg}
+	}
+
+	if opts.Repos <= 0 {
+		opts.Repos = defaultRepos
+	}
+
+	if opts.MinCommits <= 0 {
+		opts.MinCommits = 1
+	}
+
+	if opts.MaxCommits <= 0 {
+		opts.MaxCommits = defaultCommits
+	}
+
+	if opts.MaxCommits < opts.MinCommits {
+		opts.MaxCommits = opts.MinCommits
+	}
+
+	if opts.Files <= 0 {
+		opts.Files = defaultFiles
+	}
+
+	if opts.FileSize <= 0 {
+		opts.FileSize = defaultFileSize
+	}
+
+	if opts.Branches <= 0 {
+		opts.Branches = 1
+	}
+
+	if len(opts.Languages) == 0 {
+		opts.Languages = defaultLanguages
+	}
+
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	s := &Simulation{
+		byName: map[string]*Repository{},
+		opts:   opts,
+	}
+
+	r := rand.New(rand.NewSource(opts.Seed))
+	for _, org := range opts.Orgs {
+		var orgRepos []*Repository
+		for i := 0; i < opts.Repos; i++ {
+			repo := s.newRepository(r, org, i, orgRepos)
+			orgRepos = append(orgRepos, repo)
+			s.repos = append(s.repos, repo)
+			s.byName[repo.FullName()] = repo
+		}
+	}
+
+	return s
+}
+
+func (s *Simulation) newRepository(
+	r *rand.Rand,
+	org string,
+	i int,
+	previous []*Repository,
+) *Repository {
+	repo := &Repository{
+		Org:      org,
+		Name:     fmt.Sprintf("repo-%04d", i),
+		Branches: s.opts.Branches,
+		Language: s.opts.Languages[r.Intn(len(s.opts.Languages))],
+		PushedAt: s.opts.Now.Add(
+			-time.Duration(r.Intn(365*24)) * time.Hour,
+		).UTC(),
+		seed: r.Int63(),
+	}
+
+	repo.Topics = []string{strings.ToLower(repo.Language), "simulation"}
+
+	var (
+		fork  = r.Float64() < s.opts.Forks
+		empty = r.Float64() < s.opts.Empty
+		n     = s.opts.MinCommits +
+			r.Intn(s.opts.MaxCommits-s.opts.MinCommits+1)
+	)
+
+	switch {
+	case empty:
+		repo.Branches = 0
+	case fork && len(previous) > 0:
+		repo.Fork = previous[r.Intn(len(previous))]
+		repo.Commits = n
+	default:
+		repo.Commits = n
+	}
+
+	repo.Size = uint64(repo.history()) * uint64(s.opts.FileSize)
+	return repo
+}
+
+// history returns the number of commits including the ones of the forked
+// repositories.
+func (r *Repository) history() int {
+	n := r.Commits
+	if r.Fork != nil {
+		n += r.Fork.history()
+	}
+
+	return n
+}
+
+// Repositories returns all the synthetic repositories.
+func (s *Simulation) Repositories() []*Repository {
+	return s.repos
+}
+
+// OrgRepositories returns the synthetic repositories of the given
+// organization sorted by name.
+func (s *Simulation) OrgRepositories(org string) []*Repository {
+	var repos []*Repository
+	for _, r := range s.repos {
+		if r.Org == org {
+			repos = append(repos, r)
+		}
+	}
+
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].Name < repos[j].Name
+	})
+
+	return repos
+}
+
+// Install registers the Scheme protocol so the synthetic repositories can be
+// cloned by go-git. The protocol is registered globally, the last installed
+// Simulation serves all the endpoints.
+func (s *Simulation) Install() {
+	client.InstallProtocol(Scheme, newTransport(s))
+}
+
+// Uninstall removes the Scheme protocol.
+func Uninstall() {
+	client.InstallProtocol(Scheme, nil)
+}
+
+// Load implements the server.Loader interface.
+func (s *Simulation) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	name := strings.TrimSuffix(strings.Trim(ep.Path, "/"), ".git")
+	repo, ok := s.byName[name]
+	if ep.Host != Host || !ok {
+		return nil, transport.ErrRepositoryNotFound
+	}
+
+	if s.opts.Latency > 0 {
+		time.Sleep(s.opts.Latency)
+	}
+
+	return s.generate(repo)
+}
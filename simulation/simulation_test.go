@@ -0,0 +1,176 @@
+package simulation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/src-d/gitcollector/discovery"
+	"github.com/src-d/gitcollector/downloader"
+	"github.com/src-d/gitcollector/library"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+var testNow = time.Date(2019, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+func TestSimulationDeterministic(t *testing.T) {
+	var require = require.New(t)
+
+	opts := func() *Opts {
+		return &Opts{
+			Orgs:     []string{"a", "b"},
+			Repos:    5,
+			Seed:     42,
+			Branches: 3,
+			Forks:    0.5,
+			Now:      testNow,
+		}
+	}
+
+	s1, s2 := New(opts()), New(opts())
+	require.Len(s1.Repositories(), 10)
+	require.Len(s1.OrgRepositories("a"), 5)
+
+	for i, r1 := range s1.Repositories() {
+		r2 := s2.Repositories()[i]
+		require.Equal(r1.FullName(), r2.FullName())
+		require.Equal(r1.Commits, r2.Commits)
+		require.Equal(r1.PushedAt, r2.PushedAt)
+		require.Equal(heads(t, s1, r1), heads(t, s2, r2))
+	}
+}
+
+func TestSimulationForks(t *testing.T) {
+	var require = require.New(t)
+
+	s := New(&Opts{Repos: 10, Seed: 1, Forks: 1, Now: testNow})
+	var forks int
+	for _, r := range s.Repositories() {
+		if r.Fork == nil {
+			continue
+		}
+
+		forks++
+		fork := heads(t, s, r)
+		parent := heads(t, s, r.Fork)
+		require.NotEqual(parent, fork)
+
+		// the fork history contains the parent one
+		sto, err := s.generate(r)
+		require.NoError(err)
+		_, err = sto.EncodedObject(
+			plumbing.CommitObject,
+			parent["refs/heads/master"],
+		)
+		require.NoError(err)
+	}
+
+	require.Equal(9, forks)
+}
+
+func TestSimulationLoad(t *testing.T) {
+	var require = require.New(t)
+
+	s := New(&Opts{Repos: 1, Empty: 1, Now: testNow})
+	r := s.Repositories()[0]
+	require.Zero(r.Commits)
+
+	refs := heads(t, s, r)
+	require.Len(refs, 0)
+
+	ep, err := transport.NewEndpoint(Scheme + "://" + Host + "/sim/missing")
+	require.NoError(err)
+	_, err = s.Load(ep)
+	require.Equal(transport.ErrRepositoryNotFound, err)
+}
+
+func TestSimulationDownload(t *testing.T) {
+	var require = require.New(t)
+
+	s := New(&Opts{Repos: 4, Seed: 7, Forks: 0.5, Now: testNow})
+	s.Install()
+	defer Uninstall()
+
+	lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+	})
+	require.NoError(err)
+
+	iter := s.OrgIter("sim")
+	for {
+		repo, _, err := iter.Next(context.Background())
+		if discovery.ErrNewRepositoriesNotFound.Is(err) {
+			break
+		}
+		require.NoError(err)
+
+		job := &library.Job{
+			Lib:       lib,
+			Type:      library.JobDownload,
+			Endpoints: []string{repo.GetHTMLURL()},
+			TempFS:    memfs.New(),
+			AuthToken: func(string) string { return "" },
+			Logger:    log.New(nil),
+		}
+
+		require.NoError(downloader.Download(context.Background(), job))
+	}
+
+	for _, r := range s.Repositories() {
+		id, err := library.NewRepositoryID(r.Endpoint())
+		require.NoError(err)
+
+		ok, _, _, err := lib.Has(id)
+		require.NoError(err)
+		require.True(ok, r.FullName())
+	}
+
+	locs, err := lib.Locations()
+	require.NoError(err)
+
+	var n int
+	require.NoError(locs.ForEach(func(borges.Location) error {
+		n++
+		return nil
+	}))
+
+	var roots int
+	for _, r := range s.Repositories() {
+		if r.Fork == nil {
+			roots++
+		}
+	}
+
+	require.Equal(roots, n)
+}
+
+func heads(
+	t *testing.T,
+	s *Simulation,
+	r *Repository,
+) map[string]plumbing.Hash {
+	sto, err := s.generate(r)
+	require.NoError(t, err)
+
+	iter, err := sto.IterReferences()
+	require.NoError(t, err)
+
+	refs := map[string]plumbing.Hash{}
+	require.NoError(t, iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			refs[ref.Name().String()] = ref.Hash()
+		}
+
+		return nil
+	}))
+
+	return refs
+}
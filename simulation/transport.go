@@ -0,0 +1,74 @@
+package simulation
+
+import (
+	"context"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+)
+
+// simTransport serves the synthetic repositories with the go-git server.
+// Unlike git servers, it fails on haves missing in the repository, like the
+// zero hash sent by the clients fetching into a location, so they're removed
+// from the requests.
+type simTransport struct {
+	transport.Transport
+	loader server.Loader
+}
+
+func newTransport(loader server.Loader) transport.Transport {
+	return &simTransport{
+		Transport: server.NewClient(loader),
+		loader:    loader,
+	}
+}
+
+func (t *simTransport) NewUploadPackSession(
+	ep *transport.Endpoint,
+	auth transport.AuthMethod,
+) (transport.UploadPackSession, error) {
+	sto, err := t.loader.Load(ep)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := server.NewClient(&staticLoader{sto}).
+		NewUploadPackSession(ep, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	return &simSession{UploadPackSession: s, sto: sto}, nil
+}
+
+type simSession struct {
+	transport.UploadPackSession
+	sto storer.Storer
+}
+
+func (s *simSession) UploadPack(
+	ctx context.Context,
+	req *packp.UploadPackRequest,
+) (*packp.UploadPackResponse, error) {
+	haves := req.Haves[:0]
+	for _, h := range req.Haves {
+		if s.sto.HasEncodedObject(h) == nil {
+			haves = append(haves, h)
+		}
+	}
+
+	req.Haves = haves
+	return s.UploadPackSession.UploadPack(ctx, req)
+}
+
+// staticLoader always loads the same storage, so a repository is generated
+// once per session.
+type staticLoader struct {
+	sto storer.Storer
+}
+
+func (l *staticLoader) Load(*transport.Endpoint) (storer.Storer, error) {
+	return l.sto, nil
+}
@@ -0,0 +1,200 @@
+package gitcollector
+
+import (
+	"container/heap"
+	"context"
+	"time"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrUnknownSizeOrder is returned when a SizeOrder isn't supported.
+var ErrUnknownSizeOrder = errors.NewKind("unknown size order %q")
+
+// JobSizeFn returns the estimated size in bytes of a Job, 0 if unknown.
+type JobSizeFn func(Job) uint64
+
+// SizeOrder is the order the Jobs are scheduled by their estimated size.
+type SizeOrder string
+
+const (
+	// SmallestFirst schedules the smallest Jobs first, so a short run
+	// processes as many Jobs as possible. The default.
+	SmallestFirst SizeOrder = "smallest"
+	// LargestFirst schedules the largest Jobs first, so the longest
+	// transfers are started early.
+	LargestFirst SizeOrder = "largest"
+)
+
+// SizeScheduleOpts are configuration options for a JobScheduleFn ordering the
+// Jobs by their size.
+type SizeScheduleOpts struct {
+	// Size estimates the size of the Jobs.
+	Size JobSizeFn
+	// Order is the SizeOrder, default to SmallestFirst.
+	Order SizeOrder
+	// Buffer is the maximum number of Jobs retrieved in advance from the
+	// wrapped JobScheduleFn to be able to choose among them.
+	Buffer int
+	// FillTimeout is the time waited for new Jobs to fill the buffer when
+	// there are Jobs already buffered.
+	FillTimeout time.Duration
+}
+
+const (
+	sizeBuffer      = 1000
+	sizeFillTimeout = 10 * time.Millisecond
+)
+
+// NewSizeScheduleFn wraps the given JobScheduleFn to schedule the buffered
+// Jobs by their estimated size, the ones with a higher priority first. The
+// Jobs of the same size, and the ones whose size is unknown after the rest,
+// keep the order they were retrieved in.
+func NewSizeScheduleFn(
+	schedule JobScheduleFn,
+	opts *SizeScheduleOpts,
+) (JobScheduleFn, error) {
+	if opts == nil {
+		opts = &SizeScheduleOpts{}
+	}
+
+	if opts.Size == nil {
+		opts.Size = func(Job) uint64 { return 0 }
+	}
+
+	if opts.Order == "" {
+		opts.Order = SmallestFirst
+	}
+
+	switch opts.Order {
+	case SmallestFirst, LargestFirst:
+	default:
+		return nil, ErrUnknownSizeOrder.New(opts.Order)
+	}
+
+	if opts.Buffer <= 0 {
+		opts.Buffer = sizeBuffer
+	}
+
+	if opts.FillTimeout <= 0 {
+		opts.FillTimeout = sizeFillTimeout
+	}
+
+	s := &sizeScheduler{
+		schedule: schedule,
+		opts:     opts,
+		jobs:     &sizeHeap{largest: opts.Order == LargestFirst},
+	}
+
+	return s.next, nil
+}
+
+type sizeScheduler struct {
+	schedule JobScheduleFn
+	opts     *SizeScheduleOpts
+	jobs     *sizeHeap
+	seq      int
+	closed   bool
+}
+
+func (s *sizeScheduler) next(ctx context.Context) (Job, error) {
+	if err := s.fill(ctx); err != nil {
+		return nil, err
+	}
+
+	if s.jobs.Len() == 0 {
+		if s.closed {
+			return nil, ErrJobSource.New()
+		}
+
+		return nil, ErrNewJobsNotFound.New()
+	}
+
+	return heap.Pop(s.jobs).(*sizedJob).job, nil
+}
+
+func (s *sizeScheduler) fill(ctx context.Context) error {
+	for !s.closed && s.jobs.Len() < s.opts.Buffer {
+		var (
+			job Job
+			err error
+		)
+
+		if s.jobs.Len() == 0 {
+			job, err = s.schedule(ctx)
+		} else {
+			fillCtx, cancel := context.WithTimeout(
+				ctx, s.opts.FillTimeout,
+			)
+
+			job, err = s.schedule(fillCtx)
+			cancel()
+		}
+
+		if err != nil {
+			if ErrJobSource.Is(err) {
+				s.closed = true
+				return nil
+			}
+
+			if s.jobs.Len() == 0 && !ErrNewJobsNotFound.Is(err) {
+				return err
+			}
+
+			return nil
+		}
+
+		s.seq++
+		heap.Push(s.jobs, &sizedJob{
+			job:      job,
+			size:     s.opts.Size(job),
+			priority: JobPriority(job),
+			seq:      s.seq,
+		})
+	}
+
+	return nil
+}
+
+type sizedJob struct {
+	job      Job
+	size     uint64
+	priority Priority
+	seq      int
+}
+
+type sizeHeap struct {
+	largest bool
+	jobs    []*sizedJob
+}
+
+func (h *sizeHeap) Len() int { return len(h.jobs) }
+
+func (h *sizeHeap) Less(i, j int) bool {
+	a, b := h.jobs[i], h.jobs[j]
+	switch {
+	case a.priority != b.priority:
+		return a.priority > b.priority
+	case a.size == b.size:
+		return a.seq < b.seq
+	case a.size == 0 || b.size == 0:
+		// the unknown sizes go last.
+		return b.size == 0
+	case h.largest:
+		return a.size > b.size
+	default:
+		return a.size < b.size
+	}
+}
+
+func (h *sizeHeap) Swap(i, j int) { h.jobs[i], h.jobs[j] = h.jobs[j], h.jobs[i] }
+
+func (h *sizeHeap) Push(x interface{}) { h.jobs = append(h.jobs, x.(*sizedJob)) }
+
+func (h *sizeHeap) Pop() interface{} {
+	last := len(h.jobs) - 1
+	job := h.jobs[last]
+	h.jobs[last] = nil
+	h.jobs = h.jobs[:last]
+	return job
+}
@@ -0,0 +1,90 @@
+package gitcollector
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeScheduleFn(t *testing.T) {
+	var require = require.New(t)
+
+	_, err := NewSizeScheduleFn(nil, &SizeScheduleOpts{Order: "foo"})
+	require.True(ErrUnknownSizeOrder.Is(err))
+
+	sizes := []string{"30", "?", "10", "20", "10", "?", "40"}
+	run := func(order SizeOrder, buffer int) []string {
+		queue := make(chan Job, len(sizes))
+		for i, size := range sizes {
+			// the unknown sizes keep their order too
+			if size == "?" {
+				size += strconv.Itoa(i)
+			}
+
+			var job Job = &testJob{id: size}
+			if size == "20" {
+				job = &testPriorityJob{
+					testJob:  testJob{id: size},
+					priority: PriorityHigh,
+				}
+			}
+
+			queue <- job
+		}
+
+		close(queue)
+
+		schedule, err := NewSizeScheduleFn(
+			testScheduleFn(queue),
+			&SizeScheduleOpts{
+				Size: func(j Job) uint64 {
+					n, _ := strconv.Atoi(testJobID(j))
+					return uint64(n)
+				},
+				Order:       order,
+				Buffer:      buffer,
+				FillTimeout: 5 * time.Millisecond,
+			},
+		)
+		require.NoError(err)
+
+		var got []string
+		for {
+			job, err := schedule(context.Background())
+			if err != nil {
+				require.True(ErrJobSource.Is(err))
+				break
+			}
+
+			got = append(got, testJobID(job))
+		}
+
+		return got
+	}
+
+	require.Equal(
+		[]string{"20", "10", "10", "30", "40", "?1", "?5"},
+		run("", 0),
+	)
+	require.Equal(
+		[]string{"20", "40", "30", "10", "10", "?1", "?5"},
+		run(LargestFirst, 0),
+	)
+
+	// the order is only kept among the buffered jobs
+	require.Equal(
+		[]string{"30", "10", "20", "10", "?1", "40", "?5"},
+		run(SmallestFirst, 2),
+	)
+}
+
+func testJobID(job Job) string {
+	if j, ok := job.(*testPriorityJob); ok {
+		return j.id
+	}
+
+	return job.(*testJob).id
+}
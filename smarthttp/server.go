@@ -0,0 +1,460 @@
+// Package smarthttp serves the repositories of a library over the git smart
+// HTTP protocol, read-only, so they can be cloned and fetched from it like
+// from a mirror.
+package smarthttp
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/src-d/gitcollector/library"
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	"gopkg.in/src-d/go-git.v4/storage"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+var (
+	// ErrRepositoryNotFound is returned when the requested repository isn't
+	// stored in the library.
+	ErrRepositoryNotFound = errors.NewKind("repository %s not found")
+
+	// ErrWrongRequest is returned when the body of an upload-pack request
+	// can't be decoded.
+	ErrWrongRequest = errors.NewKind("wrong request: %s")
+)
+
+// ServerOpts represents configuration options for a Server.
+type ServerOpts struct {
+	// Addr is the address the repositories are served at once the server
+	// is started, empty means they aren't served but the Handler can
+	// still be mounted elsewhere.
+	Addr string
+	// Sharing reads the objects of the locations linked to an
+	// library.ObjectPool, nil means they can't be served.
+	Sharing *library.ObjectSharing
+	// Rescan is the minimum time between the scans of the library looking
+	// for the repositories not found, default to a minute.
+	Rescan time.Duration
+	// Log is the logger used to report the failures serving the
+	// repositories, default to log.New(nil).
+	Log log.Logger
+}
+
+const (
+	rescan = time.Minute
+
+	uploadPack     = "git-upload-pack"
+	receivePack    = "git-receive-pack"
+	infoRefs       = "/info/refs"
+	uploadPackPath = "/" + uploadPack
+)
+
+// Server serves the repositories of a library over the git smart HTTP
+// protocol, at the path of their ID:
+//
+//	GET  /<id>/info/refs?service=git-upload-pack  the advertised references
+//	POST /<id>/git-upload-pack                    the negotiation and packfile
+//
+// The references of a repository are the ones kept in its location under
+// refs/remotes/<id>/, served without the prefix. The pushes are rejected.
+type Server struct {
+	lib  borges.Library
+	opts *ServerOpts
+
+	mu        sync.Mutex
+	locations map[borges.RepositoryID]borges.LocationID
+	scanned   time.Time
+
+	listener net.Listener
+	server   *http.Server
+}
+
+// NewServer builds a new Server of the given library. The address, if any, is
+// listened on right away so a wrong one is reported before the collection
+// starts. The library is scanned once a repository is requested.
+func NewServer(lib borges.Library, opts *ServerOpts) (*Server, error) {
+	if opts == nil {
+		opts = &ServerOpts{}
+	}
+
+	if opts.Rescan <= 0 {
+		opts.Rescan = rescan
+	}
+
+	if opts.Log == nil {
+		opts.Log = log.New(nil)
+	}
+
+	s := &Server{lib: lib, opts: opts}
+	if opts.Addr == "" {
+		return s, nil
+	}
+
+	listener, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s.listener = listener
+	s.server = &http.Server{Handler: s}
+	return s, nil
+}
+
+// Handler returns the http.Handler serving the repositories.
+func (s *Server) Handler() http.Handler {
+	return s
+}
+
+// Start serves the repositories in the background if the server has an
+// address.
+func (s *Server) Start() {
+	if s.server == nil {
+		return
+	}
+
+	go func() {
+		err := s.server.Serve(s.listener)
+		if err != nil && err != http.ErrServerClosed {
+			s.opts.Log.Errorf(err, "couldn't serve the repositories")
+		}
+	}()
+}
+
+// Close stops serving the repositories.
+func (s *Server) Close() error {
+	if s.server != nil {
+		return s.server.Close()
+	}
+
+	return nil
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case strings.HasSuffix(path, infoRefs):
+		if r.Method != http.MethodGet {
+			notAllowed(w)
+			return
+		}
+
+		service := r.URL.Query().Get("service")
+		if service == receivePack {
+			http.Error(w, "the repositories are read-only",
+				http.StatusForbidden)
+			return
+		}
+
+		// the dumb protocol isn't supported.
+		if service != uploadPack {
+			http.Error(w, "only the smart protocol is supported",
+				http.StatusForbidden)
+			return
+		}
+
+		s.serve(w, r, strings.TrimSuffix(path, infoRefs), s.advertise)
+	case strings.HasSuffix(path, uploadPackPath):
+		if r.Method != http.MethodPost {
+			notAllowed(w)
+			return
+		}
+
+		s.serve(w, r, strings.TrimSuffix(path, uploadPackPath), s.upload)
+	case strings.HasSuffix(path, "/"+receivePack):
+		http.Error(w, "the repositories are read-only", http.StatusForbidden)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type serveFn func(
+	http.ResponseWriter,
+	*http.Request,
+	transport.UploadPackSession,
+	storer.Storer,
+) error
+
+// serve opens the repository with the ID in the given path and serves it
+// with the given function.
+func (s *Server) serve(
+	w http.ResponseWriter,
+	r *http.Request,
+	path string,
+	fn serveFn,
+) {
+	id := borges.RepositoryID(
+		strings.TrimSuffix(strings.Trim(path, "/"), ".git"),
+	)
+
+	repo, sto, err := s.open(id)
+	if ErrRepositoryNotFound.Is(err) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		s.opts.Log.Errorf(err, "couldn't open the repository %s", id)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer repo.Close()
+
+	ep, err := transport.NewEndpoint("/" + id.String())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session, err := server.NewServer(loader{sto}).
+		NewUploadPackSession(ep, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer session.Close()
+
+	w.Header().Set("Cache-Control", "no-cache")
+	err = fn(w, r, session, sto)
+	switch {
+	case err == nil:
+	case ErrWrongRequest.Is(err) ||
+		err == transport.ErrEmptyUploadPackRequest:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		// the response may be halfway, the client finds a broken one.
+		s.opts.Log.With(log.Fields{"repository": id}).
+			Errorf(err, "couldn't serve the repository")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) advertise(
+	w http.ResponseWriter,
+	_ *http.Request,
+	session transport.UploadPackSession,
+	_ storer.Storer,
+) error {
+	ar, err := session.AdvertisedReferences()
+	if err != nil {
+		return err
+	}
+
+	ar.Prefix = [][]byte{
+		[]byte("# service=" + uploadPack),
+		pktline.Flush,
+	}
+
+	w.Header().Set("Content-Type",
+		"application/x-"+uploadPack+"-advertisement")
+	return ar.Encode(w)
+}
+
+// upload negotiates the objects the client has and sends the packfile of the
+// wanted ones once it's done. The server doesn't support multi_ack, so only
+// the first common object is acknowledged; the haves the repository doesn't
+// have are ignored.
+func (s *Server) upload(
+	w http.ResponseWriter,
+	r *http.Request,
+	session transport.UploadPackSession,
+	sto storer.Storer,
+) error {
+	body := io.Reader(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return ErrWrongRequest.Wrap(err, "gzip")
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	req, done, err := decodeRequest(body, sto)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/x-"+uploadPack+"-result")
+
+	var acks packp.ServerResponse
+	if len(req.Haves) > 0 {
+		acks.ACKs = req.Haves[:1]
+	}
+
+	if !done {
+		return acks.Encode(w)
+	}
+
+	res, err := session.UploadPack(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	res.ServerResponse = acks
+	return res.Encode(w)
+}
+
+// decodeRequest decodes an upload-pack request keeping only the haves stored
+// in the repository, and tells whether the client is done negotiating.
+func decodeRequest(
+	r io.Reader,
+	sto storer.Storer,
+) (*packp.UploadPackRequest, bool, error) {
+	req := packp.NewUploadPackRequest()
+	if err := req.UploadRequest.Decode(r); err != nil {
+		return nil, false, ErrWrongRequest.Wrap(err, "wants")
+	}
+
+	var done bool
+	scanner := pktline.NewScanner(r)
+	for !done && scanner.Scan() {
+		line := strings.TrimSpace(string(scanner.Bytes()))
+		switch {
+		case line == "":
+			// the flushes between the batches of haves.
+		case line == "done":
+			done = true
+		case strings.HasPrefix(line, "have "):
+			h := plumbing.NewHash(strings.TrimPrefix(line, "have "))
+			if sto.HasEncodedObject(h) == nil {
+				req.Haves = append(req.Haves, h)
+			}
+		default:
+			return nil, false, ErrWrongRequest.New(
+				fmt.Sprintf("unexpected line %q", line),
+			)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, false, ErrWrongRequest.Wrap(err, "haves")
+	}
+
+	return req, done, nil
+}
+
+// open opens the repository with the given ID, its storer reads the objects
+// of its ObjectPool if it's linked to one.
+func (s *Server) open(
+	id borges.RepositoryID,
+) (borges.Repository, storage.Storer, error) {
+	loc, err := s.location(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	repo, err := loc.Get("", borges.ReadOnlyMode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sto := repo.R().Storer
+	pool, err := s.opts.Sharing.Linked(repo)
+	if err != nil {
+		repo.Close()
+		return nil, nil, err
+	}
+
+	if pool != nil {
+		sto = pool.Storer(sto)
+	}
+
+	return repo, siva.NewRootedStorage(sto, id.String()), nil
+}
+
+// location returns the location of the repository with the given ID,
+// scanning the library again if it isn't known and it wasn't scanned in the
+// last Rescan.
+func (s *Server) location(id borges.RepositoryID) (borges.Location, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	locID, ok := s.locations[id]
+	if !ok && time.Since(s.scanned) >= s.opts.Rescan {
+		locations, err := s.scan()
+		if err != nil {
+			return nil, err
+		}
+
+		s.locations, s.scanned = locations, time.Now()
+		locID, ok = s.locations[id]
+	}
+
+	if !ok {
+		return nil, ErrRepositoryNotFound.New(id)
+	}
+
+	loc, err := s.lib.Location(locID)
+	if borges.ErrLocationNotExists.Is(err) {
+		delete(s.locations, id)
+		return nil, ErrRepositoryNotFound.New(id)
+	}
+
+	return loc, err
+}
+
+// scan returns the location of every repository in the library. The
+// locations that can't be read are skipped.
+func (s *Server) scan() (map[borges.RepositoryID]borges.LocationID, error) {
+	iter, err := s.lib.Locations()
+	if err != nil {
+		return nil, err
+	}
+
+	locations := map[borges.RepositoryID]borges.LocationID{}
+	err = iter.ForEach(func(loc borges.Location) error {
+		repo, err := loc.Get("", borges.ReadOnlyMode)
+		if err != nil {
+			s.opts.Log.Warningf("couldn't read the location %s: %s",
+				loc.ID(), err)
+			return nil
+		}
+		defer repo.Close()
+
+		cfg, err := repo.R().Config()
+		if err != nil {
+			s.opts.Log.Warningf("couldn't read the location %s: %s",
+				loc.ID(), err)
+			return nil
+		}
+
+		for name := range cfg.Remotes {
+			locations[borges.RepositoryID(name)] = loc.ID()
+		}
+
+		return nil
+	})
+
+	return locations, err
+}
+
+// loader loads the storer of the repository being served.
+type loader struct {
+	storer.Storer
+}
+
+// Load implements the server.Loader interface.
+func (l loader) Load(*transport.Endpoint) (storer.Storer, error) {
+	return l.Storer, nil
+}
+
+func notAllowed(w http.ResponseWriter) {
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+		http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,157 @@
+package smarthttp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	var require = require.New(t)
+
+	dir, err := ioutil.TempDir("", "gitcollector-smarthttp")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	commits := func(from, to int) {
+		for i := from; i < to; i++ {
+			gitCmd(t, "-C", src, "commit", "-q", "--allow-empty",
+				"-m", fmt.Sprintf("commit %d", i))
+		}
+	}
+
+	gitCmd(t, "init", "-q", src)
+	commits(0, 5)
+	gitCmd(t, "-C", src, "tag", "v1.0.0")
+
+	lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+		Transactional: true,
+	})
+	require.NoError(err)
+
+	loc, err := lib.AddLocation("foo")
+	require.NoError(err)
+
+	id := borges.RepositoryID("github.com/foo/bar")
+	r, err := loc.Init(id)
+	require.NoError(err)
+	store(t, r, src)
+
+	s, err := NewServer(lib, nil)
+	require.NoError(err)
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	clone := filepath.Join(dir, "clone")
+	gitCmd(t, "clone", "-q", srv.URL+"/github.com/foo/bar.git", clone)
+	require.Equal(
+		gitCmd(t, "-C", src, "rev-parse", "HEAD"),
+		gitCmd(t, "-C", clone, "rev-parse", "HEAD"),
+	)
+	require.Equal("v1.0.0", gitCmd(t, "-C", clone, "tag"))
+
+	// the fetches only get the new commits.
+	commits(5, 8)
+	r, err = loc.Get("", borges.RWMode)
+	require.NoError(err)
+	store(t, r, src)
+
+	gitCmd(t, "-C", clone, "fetch", "-q", "origin")
+	require.Equal(
+		gitCmd(t, "-C", src, "rev-parse", "HEAD"),
+		gitCmd(t, "-C", clone, "rev-parse", "origin/master"),
+	)
+	require.Equal("8", gitCmd(t, "-C", clone,
+		"rev-list", "--count", "origin/master"))
+
+	status := func(method, path string) int {
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		require.NoError(err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	require.Equal(http.StatusNotFound, status("GET",
+		"/github.com/foo/baz/info/refs?service=git-upload-pack"))
+	require.Equal(http.StatusForbidden, status("GET",
+		"/github.com/foo/bar/info/refs?service=git-receive-pack"))
+	require.Equal(http.StatusForbidden, status("POST",
+		"/github.com/foo/bar/git-receive-pack"))
+	require.Equal(http.StatusForbidden, status("GET",
+		"/github.com/foo/bar/info/refs"))
+	require.Equal(http.StatusMethodNotAllowed, status("GET",
+		"/github.com/foo/bar/git-upload-pack"))
+	require.Equal(http.StatusNotFound, status("GET", "/github.com/foo/bar"))
+
+	// the new repositories are found once the library is scanned again.
+	other, err := lib.AddLocation("baz")
+	require.NoError(err)
+	r, err = other.Init("github.com/foo/baz")
+	require.NoError(err)
+	store(t, r, src)
+
+	require.Equal(http.StatusNotFound, status("GET",
+		"/github.com/foo/baz/info/refs?service=git-upload-pack"))
+
+	s.opts.Rescan = time.Nanosecond
+	require.Equal(http.StatusOK, status("GET",
+		"/github.com/foo/baz/info/refs?service=git-upload-pack"))
+}
+
+// store fetches the repository in the given directory to the repository of a
+// location, under its remote, and commits it.
+func store(t *testing.T, r borges.Repository, dir string) {
+	t.Helper()
+	var require = require.New(t)
+
+	id := r.ID().String()
+	if id == "" {
+		// a repository of the whole location, the first remote.
+		remotes, err := r.R().Remotes()
+		require.NoError(err)
+		id = remotes[0].Config().Name
+	}
+
+	remote := git.NewRemote(r.R().Storer, &config.RemoteConfig{
+		Name: "src",
+		URLs: []string{"file://" + dir},
+		Fetch: []config.RefSpec{
+			config.RefSpec(fmt.Sprintf("+HEAD:refs/remotes/%s/HEAD", id)),
+			config.RefSpec(fmt.Sprintf("+refs/*:refs/remotes/%s/*", id)),
+		},
+	})
+
+	require.NoError(remote.Fetch(&git.FetchOptions{}))
+	require.NoError(r.Commit())
+}
+
+func gitCmd(t *testing.T, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
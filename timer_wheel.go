@@ -0,0 +1,147 @@
+package gitcollector
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// wheelSlots is the number of slots of a timerWheel, the delays longer than a
+// revolution stay in their slot for the next ones.
+const wheelSlots = 3600
+
+type delayedJob struct {
+	// job is the Job sent to the workers, wrapped by the ordered window
+	// if any, and discovered the one returned by the JobScheduleFn.
+	job        Job
+	discovered Job
+	tick       int64
+}
+
+// timerWheel holds the DelayedJobs until their time comes. It's a hashed
+// timing wheel: the Jobs are placed in the slot of the tick they expire, so
+// expiring them only looks at the slots of the elapsed ticks.
+type timerWheel struct {
+	mu    sync.Mutex
+	tick  time.Duration
+	slots [][]*delayedJob
+	// next is the first tick not expired yet.
+	next int64
+	// held is the number of Jobs expired not delivered yet.
+	held int
+	size int
+}
+
+func newTimerWheel(tick time.Duration, now time.Time) *timerWheel {
+	return &timerWheel{
+		tick:  tick,
+		slots: make([][]*delayedJob, wheelSlots),
+		next:  now.UnixNano()/int64(tick) + 1,
+	}
+}
+
+// add holds the Job until the given time, it's never expired before.
+func (w *timerWheel) add(job, discovered Job, at time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// rounded up so the Job isn't released early.
+	tick := (at.UnixNano() + int64(w.tick) - 1) / int64(w.tick)
+	if tick < w.next {
+		tick = w.next
+	}
+
+	slot := tick % int64(len(w.slots))
+	w.slots[slot] = append(w.slots[slot], &delayedJob{
+		job:        job,
+		discovered: discovered,
+		tick:       tick,
+	})
+	w.size++
+}
+
+// expire returns the Jobs whose time came before now. They're held by the
+// wheel until delivered is called.
+func (w *timerWheel) expire(now time.Time) []*delayedJob {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	current := now.UnixNano() / int64(w.tick)
+	var due []*delayedJob
+	for i := 0; w.next <= current && i < len(w.slots); i++ {
+		slot := w.next % int64(len(w.slots))
+		kept := w.slots[slot][:0]
+		for _, d := range w.slots[slot] {
+			if d.tick <= current {
+				due = append(due, d)
+			} else {
+				kept = append(kept, d)
+			}
+		}
+
+		w.slots[slot] = kept
+		w.next++
+	}
+
+	// a revolution visits every slot, the rest of ticks can be skipped.
+	if w.next <= current {
+		w.next = current + 1
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].tick < due[j].tick
+	})
+
+	w.size -= len(due)
+	w.held += len(due)
+	return due
+}
+
+// delivered releases n of the Jobs held by the wheel.
+func (w *timerWheel) delivered(n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.held -= n
+}
+
+// restore puts back the expired Jobs not delivered, to be returned by drain.
+func (w *timerWheel) restore(due []*delayedJob) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, d := range due {
+		slot := d.tick % int64(len(w.slots))
+		w.slots[slot] = append(w.slots[slot], d)
+	}
+
+	w.held -= len(due)
+	w.size += len(due)
+}
+
+// len returns the number of Jobs in the wheel, the ones held included.
+func (w *timerWheel) len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.size + w.held
+}
+
+// drain removes all the Jobs from the wheel sorted by their time.
+func (w *timerWheel) drain() []*delayedJob {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var jobs []*delayedJob
+	for i, slot := range w.slots {
+		jobs = append(jobs, slot...)
+		w.slots[i] = nil
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].tick < jobs[j].tick
+	})
+
+	w.size = 0
+	return jobs
+}
@@ -0,0 +1,138 @@
+package gitcollector
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimerWheel(t *testing.T) {
+	var require = require.New(t)
+
+	start := time.Unix(1000, 0)
+	w := newTimerWheel(time.Second, start)
+
+	var (
+		soon  = &testJob{id: "soon"}
+		later = &testJob{id: "later"}
+		far   = &testJob{id: "far"}
+	)
+
+	w.add(later, later, start.Add(2500*time.Millisecond))
+	w.add(soon, soon, start.Add(time.Second))
+	// beyond a revolution of the wheel
+	w.add(far, far, start.Add(2*wheelSlots*time.Second))
+	require.Equal(3, w.len())
+
+	require.Empty(w.expire(start.Add(999 * time.Millisecond)))
+
+	due := w.expire(start.Add(time.Second))
+	require.Len(due, 1)
+	require.Equal(soon, due[0].job)
+	require.Equal(3, w.len())
+	w.delivered(len(due))
+	require.Equal(2, w.len())
+
+	// never released before its time
+	require.Empty(w.expire(start.Add(2 * time.Second)))
+	due = w.expire(start.Add(3 * time.Second))
+	require.Len(due, 1)
+	require.Equal(later, due[0].job)
+
+	w.restore(due)
+	require.Equal(2, w.len())
+
+	drained := w.drain()
+	require.Len(drained, 2)
+	require.Equal(later, drained[0].job)
+	require.Equal(far, drained[1].job)
+	require.Zero(w.len())
+}
+
+func TestTimerWheelSkip(t *testing.T) {
+	var require = require.New(t)
+
+	start := time.Unix(1000, 0)
+	w := newTimerWheel(time.Second, start)
+
+	job := &testJob{id: "a"}
+	w.add(job, job, start.Add(10*wheelSlots*time.Second))
+
+	// the wheel isn't turned more than a revolution at once
+	require.Empty(w.expire(start.Add(5 * wheelSlots * time.Second)))
+	due := w.expire(start.Add(10 * wheelSlots * time.Second))
+	require.Len(due, 1)
+}
+
+type testDelayedJob struct {
+	testJob
+	notBefore time.Time
+}
+
+func (j *testDelayedJob) JobNotBefore() time.Time { return j.notBefore }
+
+func TestWorkerPoolDelayedJobs(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 10)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{
+		DelayResolution: 10 * time.Millisecond,
+	})
+	wp.SetWorkers(1)
+	wp.Run()
+
+	var (
+		mu        sync.Mutex
+		processed []string
+		times     = map[string]time.Time{}
+	)
+
+	process := func(id string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		processed = append(processed, id)
+		times[id] = time.Now()
+		return nil
+	}
+
+	start := time.Now()
+	delay := 100 * time.Millisecond
+	queue <- &testDelayedJob{
+		testJob:   testJob{id: "delayed", process: process},
+		notBefore: start.Add(delay),
+	}
+	queue <- &testJob{id: "now", process: process}
+	close(queue)
+
+	// the queues are closed once the delayed jobs are processed
+	require.NoError(wp.WaitError())
+	require.Equal([]string{"now", "delayed"}, processed)
+	require.False(times["delayed"].Before(start.Add(delay)))
+}
+
+func TestWorkerPoolDelayedJobsPending(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 10)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{})
+	wp.SetWorkers(1)
+	wp.RunContext(context.Background())
+
+	job := &testDelayedJob{
+		testJob:   testJob{id: "delayed"},
+		notBefore: time.Now().Add(time.Hour),
+	}
+	queue <- job
+	for len(queue) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// give the scheduler the time to hold it
+	time.Sleep(10 * time.Millisecond)
+	wp.Stop()
+	report := wp.ShutdownReport()
+	require.Equal([]Job{job}, report.Discarded)
+}
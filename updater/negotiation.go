@@ -0,0 +1,203 @@
+package updater
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/src-d/gitcollector/library"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/sideband"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+)
+
+// negotiatedFetch fetches the objects of the remote missing in the repository
+// advertising the haves chosen by the Negotiation. go-git doesn't allow to
+// choose them, so the upload-pack request is made here and the fetch of
+// go-git only updates the references afterwards.
+func negotiatedFetch(
+	ctx context.Context,
+	repo *git.Repository,
+	remote *git.Remote,
+	auth transport.AuthMethod,
+	n *library.Negotiation,
+	transfer *library.Transfer,
+) error {
+	cfg := remote.Config()
+	ep, err := transport.NewEndpoint(cfg.URLs[0])
+	if err != nil {
+		return err
+	}
+
+	c, err := client.NewClient(ep)
+	if err != nil {
+		return err
+	}
+
+	s, err := c.NewUploadPackSession(ep, auth)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	ar, err := s.AdvertisedReferences()
+	if err != nil {
+		return err
+	}
+
+	refs, err := ar.AllReferences()
+	if err != nil {
+		return err
+	}
+
+	server := make(map[plumbing.Hash]bool, len(refs))
+	var wants []plumbing.Hash
+	for _, ref := range refs {
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+
+		server[ref.Hash()] = true
+		if !matchesAny(cfg.Fetch, ref.Name()) {
+			continue
+		}
+
+		_, err := repo.Storer.EncodedObject(plumbing.AnyObject, ref.Hash())
+		if err == plumbing.ErrObjectNotFound {
+			wants = append(wants, ref.Hash())
+		}
+	}
+
+	if len(wants) == 0 {
+		return nil
+	}
+
+	req := packp.NewUploadPackRequestFromCapabilities(ar.Capabilities)
+	if ar.Capabilities.Supports(capability.NoProgress) {
+		if err := req.Capabilities.Set(capability.NoProgress); err != nil {
+			return err
+		}
+	}
+
+	req.Shallows, err = repo.Storer.Shallow()
+	if err != nil {
+		return err
+	}
+
+	req.Wants = dedupHashes(wants)
+	req.Haves, err = negotiationHaves(repo, cfg.Name, server, n)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.UploadPack(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	return packfile.UpdateObjectStorage(
+		transfer.Storer(repo.Storer), sidebandReader(req.Capabilities, res),
+	)
+}
+
+// negotiationHaves walks the references of the repository, only the ones of
+// the given remote if the Negotiation asks for it, returning the commits the
+// Negotiation advertises. The walk of every reference stops at the commits the
+// server is known to have and at the ones already walked from another one.
+func negotiationHaves(
+	repo *git.Repository,
+	remote string,
+	server map[plumbing.Hash]bool,
+	n *library.Negotiation,
+) ([]plumbing.Hash, error) {
+	refs, err := repo.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := "refs/remotes/" + remote + "/"
+	seen := make(map[plumbing.Hash]bool)
+	var haves []plumbing.Hash
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || seen[ref.Hash()] {
+			return nil
+		}
+
+		if n.RemoteOnly() &&
+			!strings.HasPrefix(ref.Name().String(), prefix) {
+			return nil
+		}
+
+		commit, err := object.GetCommit(repo.Storer, ref.Hash())
+		if err != nil {
+			// not a commit, like an annotated tag.
+			seen[ref.Hash()] = true
+			haves = append(haves, ref.Hash())
+			return nil
+		}
+
+		var visited int
+		walker := object.NewCommitPreorderIter(commit, seen, nil)
+		return walker.ForEach(func(c *object.Commit) error {
+			if n.Advertise(visited) || server[c.Hash] {
+				haves = append(haves, c.Hash)
+			}
+
+			seen[c.Hash] = true
+			visited++
+			if !n.Visit(visited) || server[c.Hash] {
+				return storer.ErrStop
+			}
+
+			return nil
+		})
+	})
+
+	return haves, err
+}
+
+func matchesAny(specs []config.RefSpec, name plumbing.ReferenceName) bool {
+	for _, rs := range specs {
+		if rs.Match(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func dedupHashes(hashes []plumbing.Hash) []plumbing.Hash {
+	seen := make(map[plumbing.Hash]bool, len(hashes))
+	result := hashes[:0]
+	for _, h := range hashes {
+		if !seen[h] {
+			seen[h] = true
+			result = append(result, h)
+		}
+	}
+
+	return result
+}
+
+func sidebandReader(l *capability.List, res io.Reader) io.Reader {
+	var t sideband.Type
+	switch {
+	case l.Supports(capability.Sideband64k):
+		t = sideband.Sideband64k
+	case l.Supports(capability.Sideband):
+		t = sideband.Sideband
+	default:
+		return res
+	}
+
+	return sideband.NewDemuxer(t, res)
+}
@@ -0,0 +1,118 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/src-d/gitcollector/library"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiatedFetch(t *testing.T) {
+	var req = require.New(t)
+
+	_, err := library.NewNegotiation(&library.NegotiationOpts{
+		Algorithm: "foo",
+	})
+	req.True(library.ErrUnknownNegotiation.Is(err))
+
+	dir, err := ioutil.TempDir("", "gitcollector")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	commits := func(from, to int) {
+		for i := from; i < to; i++ {
+			gitCmd(t, "-C", dir, "commit", "-q", "--allow-empty",
+				"-m", fmt.Sprintf("commit %d", i))
+		}
+	}
+
+	gitCmd(t, "init", "-q", dir)
+	commits(0, 20)
+
+	repo, err := git.Init(memory.NewStorage(), nil)
+	req.NoError(err)
+
+	name := "github.com/foo/bar"
+	remote, err := repo.CreateRemote(&config.RemoteConfig{
+		Name: name,
+		URLs: []string{"file://" + dir},
+		Fetch: []config.RefSpec{
+			config.RefSpec(fmt.Sprintf("+HEAD:refs/remotes/%s/HEAD", name)),
+			config.RefSpec(fmt.Sprintf("+refs/*:refs/remotes/%s/*", name)),
+		},
+	})
+	req.NoError(err)
+	req.NoError(remote.Fetch(&git.FetchOptions{}))
+
+	haves := func(opts *library.NegotiationOpts, remote string) int {
+		n, err := library.NewNegotiation(opts)
+		req.NoError(err)
+
+		haves, err := negotiationHaves(repo, remote, nil, n)
+		req.NoError(err)
+		return len(haves)
+	}
+
+	// HEAD and master share their history
+	req.Equal(20, haves(nil, name))
+	req.Equal(5, haves(&library.NegotiationOpts{Depth: 5}, name))
+	req.Equal(4, haves(&library.NegotiationOpts{
+		Algorithm: library.NegotiationSkipping,
+		Depth:     8,
+	}, name))
+	req.Equal(20, haves(&library.NegotiationOpts{}, "other"))
+	req.Zero(haves(&library.NegotiationOpts{RemoteOnly: true}, "other"))
+
+	commits(20, 25)
+
+	n, err := library.NewNegotiation(&library.NegotiationOpts{
+		Algorithm:  library.NegotiationSkipping,
+		RemoteOnly: true,
+	})
+	req.NoError(err)
+	req.NoError(negotiatedFetch(
+		context.Background(), repo, remote, nil, n, nil,
+	))
+
+	head := plumbing.NewHash(gitCmd(t, "-C", dir, "rev-parse", "HEAD"))
+	commit, err := repo.CommitObject(head)
+	req.NoError(err)
+	req.Equal("commit 24\n", commit.Message)
+
+	// the objects are already fetched, go-git only updates the references
+	req.NoError(remote.Fetch(&git.FetchOptions{}))
+
+	ref, err := repo.Reference(
+		plumbing.ReferenceName("refs/remotes/"+name+"/HEAD"), true)
+	req.NoError(err)
+	req.Equal(head, ref.Hash())
+
+	// nothing to fetch
+	req.NoError(negotiatedFetch(
+		context.Background(), repo, remote, nil, n, nil,
+	))
+}
+
+func gitCmd(t *testing.T, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
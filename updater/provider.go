@@ -1,6 +1,8 @@
 package updater
 
 import (
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/src-d/gitcollector"
@@ -15,11 +17,23 @@ type UpdatesProviderOpts struct {
 	TriggerOnce bool
 	// TriggerInterval is the time interval elapsed between updates.
 	TriggerInterval time.Duration
+	// Schedule is the time of the updates instead of TriggerInterval. The
+	// first update waits for it instead of starting right away.
+	Schedule *Schedule
+	// OrgSchedules are the times of the updates of the locations holding
+	// repositories of the given organizations instead of Schedule or
+	// TriggerInterval. A location is updated on the schedules of all its
+	// organizations, and on the default one too if any of them isn't
+	// given one.
+	OrgSchedules map[string]*Schedule
 	// EnqueueTimeout is the time a job waits to be enqueued.
 	EnqueueTimeout time.Duration
 	// StopTimeout is the time the service waits to be stopped after a Stop
 	// call is performed.
 	StopTimeout time.Duration
+	// Annotations holds the locations frozen by the operators, which are
+	// left out of the periodic updates.
+	Annotations *library.Annotations
 }
 
 // UpdatesProvider is gitcollector.Provider implementation. It will periodically
@@ -30,6 +44,8 @@ type UpdatesProvider struct {
 	queue  chan<- gitcollector.Job
 	cancel chan struct{}
 	opts   *UpdatesProviderOpts
+	// orgs are the OrgSchedules by lowercase organization.
+	orgs map[string]*Schedule
 }
 
 var _ gitcollector.Provider = (*UpdatesProvider)(nil)
@@ -62,17 +78,27 @@ func NewUpdatesProvider(
 		opts.EnqueueTimeout = enqueueTimeout
 	}
 
+	orgs := make(map[string]*Schedule, len(opts.OrgSchedules))
+	for org, s := range opts.OrgSchedules {
+		orgs[strings.ToLower(org)] = s
+	}
+
 	return &UpdatesProvider{
 		lib:    lib,
 		queue:  queue,
 		cancel: make(chan struct{}),
 		opts:   opts,
+		orgs:   orgs,
 	}
 }
 
 // Start implements the gitcollector.Provider interface.
 func (p *UpdatesProvider) Start() error {
-	if err := p.update(); err != nil {
+	if p.opts.Schedule != nil || len(p.orgs) > 0 {
+		return p.startSchedules()
+	}
+
+	if err := p.update(nil); err != nil {
 		return err
 	}
 
@@ -85,16 +111,100 @@ func (p *UpdatesProvider) Start() error {
 		case <-p.cancel:
 			return gitcollector.ErrProviderStopped.New()
 		case <-time.After(p.opts.TriggerInterval):
-			if err := p.update(); err != nil {
+			if err := p.update(nil); err != nil {
 				return err
 			}
 		}
 	}
 }
 
+// defaultSchedule is the key of the default schedule, the one of the
+// locations without organizations given their own.
+const defaultSchedule = ""
+
+// startSchedules triggers the updates of the locations on their schedules.
+// The default one follows TriggerInterval if there's no Schedule, updating
+// the locations right away like Start.
+func (p *UpdatesProvider) startSchedules() error {
+	now := time.Now()
+	schedules := map[string]*Schedule{defaultSchedule: p.opts.Schedule}
+	next := map[string]time.Time{}
+	if p.opts.Schedule == nil {
+		schedules[defaultSchedule] = &Schedule{
+			expr:  "@every " + p.opts.TriggerInterval.String(),
+			every: p.opts.TriggerInterval,
+		}
+
+		next[defaultSchedule] = now
+	}
+
+	for org, s := range p.orgs {
+		schedules[org] = s
+	}
+
+	for key, s := range schedules {
+		if _, ok := next[key]; !ok {
+			next[key] = s.Next(now)
+		}
+	}
+
+	for {
+		at, due := nextUpdate(next)
+		if at.IsZero() {
+			return gitcollector.ErrProviderStopped.New()
+		}
+
+		select {
+		case <-p.cancel:
+			return gitcollector.ErrProviderStopped.New()
+		case <-time.After(time.Until(at)):
+		}
+
+		if err := p.update(due); err != nil {
+			return err
+		}
+
+		if p.opts.TriggerOnce {
+			return gitcollector.ErrProviderStopped.New()
+		}
+
+		// the times missed by a long update are skipped
+		now := time.Now()
+		if at.After(now) {
+			now = at
+		}
+
+		for key := range due {
+			next[key] = schedules[key].Next(now)
+		}
+	}
+}
+
+// nextUpdate returns the earliest time of the given ones and the schedules
+// due at it.
+func nextUpdate(next map[string]time.Time) (time.Time, map[string]bool) {
+	var at time.Time
+	for _, t := range next {
+		if !t.IsZero() && (at.IsZero() || t.Before(at)) {
+			at = t
+		}
+	}
+
+	due := map[string]bool{}
+	for key, t := range next {
+		if !at.IsZero() && t.Equal(at) {
+			due[key] = true
+		}
+	}
+
+	return at, due
+}
+
 var errEnqueueTimeout = errors.NewKind("update queue is full")
 
-func (p *UpdatesProvider) update() error {
+// update enqueues the update of the locations due on the given schedules, all
+// of them if nil.
+func (p *UpdatesProvider) update(due map[string]bool) error {
 	var done = make(chan error)
 	go func() {
 		defer close(done)
@@ -106,6 +216,14 @@ func (p *UpdatesProvider) update() error {
 		}
 
 		iter.ForEach(func(l borges.Location) error {
+			if p.opts.Annotations.NoUpdate(l.ID()) {
+				return nil
+			}
+
+			if due != nil && !p.isDue(l, due) {
+				return nil
+			}
+
 			job := &library.Job{
 				Type:       library.JobUpdate,
 				LocationID: l.ID(),
@@ -141,3 +259,58 @@ func (p *UpdatesProvider) Stop() error {
 		return gitcollector.ErrProviderStop.New()
 	}
 }
+
+// isDue returns whether the location is due on any of the given schedules. The
+// locations whose organizations can't be read follow the default one.
+func (p *UpdatesProvider) isDue(l borges.Location, due map[string]bool) bool {
+	if len(p.orgs) == 0 {
+		return due[defaultSchedule]
+	}
+
+	orgs, err := locationOrgs(l)
+	if err != nil || len(orgs) == 0 {
+		return due[defaultSchedule]
+	}
+
+	for _, org := range orgs {
+		if _, ok := p.orgs[org]; !ok {
+			org = defaultSchedule
+		}
+
+		if due[org] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// locationOrgs returns the lowercase organizations of the endpoints of the
+// repositories of a location.
+func locationOrgs(l borges.Location) ([]string, error) {
+	repo, err := l.Get("", borges.ReadOnlyMode)
+	if err != nil {
+		return nil, err
+	}
+	defer repo.Close()
+
+	cfg, err := repo.R().Config()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var orgs []string
+	for _, remote := range cfg.Remotes {
+		for _, ep := range remote.URLs {
+			org := strings.ToLower(library.GetOrgFromEndpoint(ep))
+			if org != "" && !seen[org] {
+				seen[org] = true
+				orgs = append(orgs, org)
+			}
+		}
+	}
+
+	sort.Strings(orgs)
+	return orgs, nil
+}
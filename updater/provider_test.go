@@ -1,6 +1,7 @@
 package updater
 
 import (
+	"sort"
 	"sync"
 	"testing"
 	"time"
@@ -9,8 +10,10 @@ import (
 	"github.com/src-d/gitcollector/library"
 	"github.com/src-d/go-borges"
 	"github.com/src-d/go-borges/plain"
+	"github.com/src-d/go-borges/siva"
 	"github.com/src-d/go-borges/util"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
 )
 
 func TestUpdatesProvider(t *testing.T) {
@@ -55,6 +58,117 @@ func TestUpdatesProvider(t *testing.T) {
 	}
 }
 
+func TestUpdatesProviderAnnotations(t *testing.T) {
+	var require = require.New(t)
+
+	annotations := library.NewAnnotations(memfs.New())
+	require.NoError(annotations.Set(&library.Annotation{
+		LocationID: "b",
+		NoUpdate:   true,
+	}))
+
+	lib := &testLib{locIDs: []borges.LocationID{"a", "b", "c"}}
+	queue := make(chan gitcollector.Job, 3)
+	provider := NewUpdatesProvider(lib, queue, &UpdatesProviderOpts{
+		TriggerOnce: true,
+		Annotations: annotations,
+	})
+
+	runProvider(t, provider)
+	close(queue)
+
+	var ids []borges.LocationID
+	for job := range queue {
+		ids = append(ids, job.(*library.Job).LocationID)
+	}
+
+	require.Equal([]borges.LocationID{"a", "c"}, ids)
+}
+
+func TestUpdatesProviderSchedules(t *testing.T) {
+	var require = require.New(t)
+
+	lib, err := siva.NewLibrary("test", memfs.New(), siva.LibraryOptions{
+		Transactional: true,
+		TempFS:        memfs.New(),
+	})
+	require.NoError(err)
+
+	for loc, repos := range map[string][]string{
+		"a":  {"github.com/src-d/a"},
+		"b":  {"github.com/bblfsh/b"},
+		"ab": {"github.com/src-d/ab", "github.com/bblfsh/ab"},
+		"c":  {"github.com/other/c"},
+	} {
+		l, err := lib.AddLocation(borges.LocationID(loc))
+		require.NoError(err)
+
+		for _, id := range repos {
+			r, err := l.Init(borges.RepositoryID(id))
+			require.NoError(err)
+			require.NoError(r.Commit())
+		}
+	}
+
+	every := func(d time.Duration) *Schedule {
+		s, err := ParseSchedule("@every " + d.String())
+		require.NoError(err)
+		return s
+	}
+
+	locations := func(queue chan gitcollector.Job) []string {
+		var ids []string
+		for len(queue) > 0 {
+			ids = append(ids, string((<-queue).(*library.Job).LocationID))
+		}
+
+		sort.Strings(ids)
+		return ids
+	}
+
+	// the default schedule waits for its time, the organizations are
+	// updated on their own schedules besides the default one if any of
+	// them isn't given one.
+	queue := make(chan gitcollector.Job, 10)
+	provider := NewUpdatesProvider(lib, queue, &UpdatesProviderOpts{
+		TriggerOnce:  true,
+		Schedule:     every(50 * time.Millisecond),
+		OrgSchedules: map[string]*Schedule{"BBLFSH": every(time.Hour)},
+	})
+
+	start := time.Now()
+	runProvider(t, provider)
+	require.True(time.Since(start) >= 50*time.Millisecond)
+	require.Equal([]string{"a", "ab", "c"}, locations(queue))
+
+	provider = NewUpdatesProvider(lib, queue, &UpdatesProviderOpts{
+		TriggerOnce: true,
+		Schedule:    every(time.Hour),
+		OrgSchedules: map[string]*Schedule{
+			"bblfsh": every(10 * time.Millisecond),
+			"src-d":  every(time.Hour),
+		},
+	})
+
+	runProvider(t, provider)
+	require.Equal([]string{"ab", "b"}, locations(queue))
+
+	// without Schedule the locations are updated right away on
+	// TriggerInterval, and the organizations on their schedules.
+	provider = NewUpdatesProvider(lib, queue, &UpdatesProviderOpts{
+		TriggerInterval: time.Hour,
+		OrgSchedules:    map[string]*Schedule{"src-d": every(100 * time.Millisecond)},
+	})
+
+	go runProvider(t, provider)
+	time.Sleep(30 * time.Millisecond)
+	require.Equal([]string{"ab", "b", "c"}, locations(queue))
+
+	time.Sleep(120 * time.Millisecond)
+	require.NoError(provider.Stop())
+	require.Equal([]string{"a", "ab"}, locations(queue))
+}
+
 func runProvider(t *testing.T, provider *UpdatesProvider) {
 	t.Helper()
 	require.True(
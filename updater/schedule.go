@@ -0,0 +1,243 @@
+package updater
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrSchedule is returned when a schedule can't be parsed.
+var ErrSchedule = errors.NewKind("wrong schedule %q: %s")
+
+// scheduleHorizon is how far the next time of a schedule is looked for, long
+// enough to reach a February 29th.
+const scheduleHorizon = 5
+
+var scheduleMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type scheduleField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var scheduleFields = []scheduleField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun",
+		"jul", "aug", "sep", "oct", "nov", "dec",
+	}},
+	// 7 is also sunday
+	{name: "day of week", min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+	}},
+}
+
+// Schedule is the time of the updates of the locations, as a cron expression
+// evaluated in the local time zone.
+type Schedule struct {
+	expr  string
+	every time.Duration
+
+	minute, hour, dom, month, dow uint64
+	// anyDom and anyDow are set when the days of the month or of the week
+	// start with *, then a day only needs to match the other one.
+	anyDom, anyDow bool
+}
+
+// ParseSchedule parses a cron expression with the minute, hour, day of month,
+// month and day of week fields, like "0 3 * * *". The fields accept *, lists,
+// ranges and steps, and the months and days of the week their english names
+// too. The @yearly, @monthly, @weekly, @daily and @hourly macros are supported
+// along with "@every <duration>", a fixed interval following time.Duration
+// syntax.
+func ParseSchedule(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	s := &Schedule{expr: expr}
+	if d := strings.TrimPrefix(expr, "@every "); d != expr {
+		every, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil {
+			return nil, ErrSchedule.New(expr, err)
+		}
+
+		if every <= 0 {
+			return nil, ErrSchedule.New(expr, "the interval must be positive")
+		}
+
+		s.every = every
+		return s, nil
+	}
+
+	spec := expr
+	if macro, ok := scheduleMacros[spec]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(scheduleFields) {
+		return nil, ErrSchedule.New(expr, fmt.Sprintf(
+			"%d fields expected, %d found", len(scheduleFields), len(fields),
+		))
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		bits[i], err = parseField(field, scheduleFields[i])
+		if err != nil {
+			return nil, ErrSchedule.New(expr, err)
+		}
+	}
+
+	s.minute, s.hour, s.dom, s.month, s.dow =
+		bits[0], bits[1], bits[2], bits[3], bits[4]
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	s.anyDom = strings.HasPrefix(fields[2], "*")
+	s.anyDow = strings.HasPrefix(fields[4], "*")
+
+	from := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if s.Next(from).IsZero() {
+		return nil, ErrSchedule.New(expr, "it never happens")
+	}
+
+	return s, nil
+}
+
+func parseField(field string, f scheduleField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rng, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			rng = item[:i]
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("wrong step of the %s: %s", f.name, item)
+			}
+		}
+
+		low, high := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			i := strings.Index(rng, "-")
+			var err error
+			if low, err = fieldValue(rng[:i], f); err != nil {
+				return 0, err
+			}
+
+			if high, err = fieldValue(rng[i+1:], f); err != nil {
+				return 0, err
+			}
+
+			if low > high {
+				return 0, fmt.Errorf("wrong range of the %s: %s", f.name, item)
+			}
+		default:
+			var err error
+			if low, err = fieldValue(rng, f); err != nil {
+				return 0, err
+			}
+
+			// a single value with a step goes up to the end of the field
+			if step == 1 {
+				high = low
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func fieldValue(s string, f scheduleField) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			if f.min == 0 {
+				return i, nil
+			}
+
+			return i + f.min, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("wrong %s: %s", f.name, s)
+	}
+
+	return v, nil
+}
+
+// Next returns the first time of the schedule after the given one, in its
+// time zone. It returns the zero time if there's none in the next years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(scheduleHorizon, 0, 0)
+	for t.Before(limit) {
+		y, m, d := t.Date()
+		switch {
+		case s.month&(1<<uint(m)) == 0:
+			t = advance(t, time.Date(y, m+1, 1, 0, 0, 0, 0, loc))
+		case !s.matchDay(t):
+			t = advance(t, time.Date(y, m, d+1, 0, 0, 0, 0, loc))
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (s *Schedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.anyDom || s.anyDow {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+// advance returns the next time, or an hour after the current one when the
+// daylight saving time makes the next one go back.
+func advance(t, next time.Time) time.Time {
+	if !next.After(t) {
+		return t.Add(time.Hour)
+	}
+
+	return next
+}
+
+// String returns the expression of the schedule.
+func (s *Schedule) String() string {
+	return s.expr
+}
@@ -0,0 +1,78 @@
+package updater
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleNext(t *testing.T) {
+	var require = require.New(t)
+
+	// a wednesday
+	from := time.Date(2020, time.January, 15, 10, 30, 20, 0, time.UTC)
+	for _, c := range []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2020, 1, 15, 10, 31, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2020, 1, 16, 3, 0, 0, 0, time.UTC)},
+		{"45 10 * * *", time.Date(2020, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2020, 1, 15, 10, 40, 0, 0, time.UTC)},
+		{"5/20 1-3 * * *", time.Date(2020, 1, 16, 1, 5, 0, 0, time.UTC)},
+		{"0 0,12 * * *", time.Date(2020, 1, 15, 12, 0, 0, 0, time.UTC)},
+		{"0 3 * * sat,sun", time.Date(2020, 1, 18, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * 7", time.Date(2020, 1, 19, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * Mon-Fri", time.Date(2020, 1, 16, 3, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)},
+		// the days of the month or of the week, and both when one is *
+		{"0 0 1 * mon", time.Date(2020, 1, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 0 */2 * mon", time.Date(2020, 1, 27, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2020, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2020, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90m", time.Date(2020, 1, 15, 12, 0, 20, 0, time.UTC)},
+	} {
+		s, err := ParseSchedule(c.expr)
+		require.NoError(err, c.expr)
+		require.Equal(c.expected, s.Next(from), c.expr)
+		require.Equal(c.expr, s.String())
+	}
+
+	// the time zone of the given time is kept
+	loc := time.FixedZone("test", 2*60*60)
+	s, err := ParseSchedule("0 3 * * *")
+	require.NoError(err)
+	require.Equal(
+		time.Date(2020, 1, 16, 3, 0, 0, 0, loc),
+		s.Next(from.In(loc)),
+	)
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	var require = require.New(t)
+
+	for expr, msg := range map[string]string{
+		"":                "5 fields expected, 0 found",
+		"0 3 * *":         "5 fields expected, 4 found",
+		"60 * * * *":      "wrong minute: 60",
+		"* 24 * * *":      "wrong hour: 24",
+		"* * 0 * *":       "wrong day of month: 0",
+		"* * * foo *":     "wrong month: foo",
+		"* * * * 8":       "wrong day of week: 8",
+		"*/0 * * * *":     "wrong step of the minute: */0",
+		"5-1 * * * *":     "wrong range of the minute: 5-1",
+		"0 0 30 feb *":    "it never happens",
+		"@every 1 minute": "time: unknown unit",
+		"@every -1h":      "the interval must be positive",
+		"@often":          "5 fields expected, 1 found",
+	} {
+		_, err := ParseSchedule(expr)
+		require.True(ErrSchedule.Is(err), expr)
+		require.Contains(err.Error(), msg, expr)
+	}
+}
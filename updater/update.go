@@ -9,7 +9,8 @@ import (
 	"github.com/src-d/go-borges/siva"
 	"gopkg.in/src-d/go-errors.v1"
 	"gopkg.in/src-d/go-git.v4"
-	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-log.v1"
 )
 
@@ -36,9 +37,14 @@ func Update(ctx context.Context, job *library.Job) error {
 	}
 
 	logger = logger.New(log.Fields{"location": job.LocationID})
+	if job.Annotations.NoUpdate(job.LocationID) {
+		logger.Infof("skipped, location marked as do-not-update")
+		return nil
+	}
+
 	location, err := lib.Location(job.LocationID)
 	if err != nil {
-		logger.Errorf(err, "failed")
+		logger.With(library.ErrorFields(err)).Errorf(err, "failed")
 		return err
 	}
 
@@ -49,29 +55,29 @@ func Update(ctx context.Context, job *library.Job) error {
 		return err
 	}
 
-	repo, err := loc.Get("", borges.RWMode)
+	repo, err := loc.Get("", borges.ReadOnlyMode)
 	if err != nil {
 		logger.Errorf(err, "couldn't get repository")
 		return err
 	}
 
-	var remote string
+	var remote, endpoint string
 	if len(job.Endpoints) == 1 {
 		// job redirected from download
 		ep := job.Endpoints[0]
 
 		logger = logger.New(log.Fields{"url": ep})
 
-		id, err := library.NewRepositoryID(ep)
+		id, err := job.RepositoryID(ep)
 		if err != nil {
 			logger.Errorf(err, "wrong repository endpoint")
 			return err
 		}
 
-		remote = id.String()
+		remote, endpoint = id.String(), ep
 	}
 
-	remotes, err := remotesToUpdate(repo, remote)
+	remotes, err := remotesToUpdate(job, repo, remote, endpoint)
 	if err != nil {
 		logger.Errorf(err, "couldn't get remotes")
 		return err
@@ -88,16 +94,61 @@ func Update(ctx context.Context, job *library.Job) error {
 		job.Endpoints = endpoints
 	}
 
+	changed := changedRemotes(ctx, logger, repo, remotes, job)
+	if err := repo.Close(); err != nil {
+		logger.Warningf("couldn't close repository")
+	}
+
+	if len(changed) == 0 {
+		logger.Infof("no-op update, remote references unchanged")
+		return nil
+	}
+
+	// the location is only opened for writing if there's something to
+	// fetch, as it copies the whole siva file
+	repo, err = loc.Get("", borges.RWMode)
+	if err != nil {
+		logger.Errorf(err, "couldn't get repository")
+		return err
+	}
+
+	remotes, err = remotesToUpdate(job, repo, remote, endpoint)
+	if err != nil {
+		if err := repo.Close(); err != nil {
+			logger.Warningf("couldn't close repository")
+		}
+
+		logger.Errorf(err, "couldn't get remotes")
+		return err
+	}
+
+	remotes = filterRemotes(remotes, changed)
+
+	// the objects of the locations linked to a pool are fetched into it.
+	pool, err := job.Sharing.Linked(repo)
+	if err != nil {
+		if err := repo.Close(); err != nil {
+			logger.Warningf("couldn't close repository")
+		}
+
+		logger.Errorf(err, "failed")
+		return err
+	}
+
 	logger.Infof("started")
 	start := time.Now()
+	job.Transfer = &library.Transfer{}
 	if err := updateRepository(
 		ctx,
 		logger,
 		repo,
 		remotes,
-		job.AuthToken,
+		job.FetchAuth,
+		pool,
+		job.Negotiation,
+		job.Transfer,
 	); err != nil {
-		logger.Errorf(err, "failed")
+		logger.With(library.ErrorFields(err)).Errorf(err, "failed")
 		return err
 	}
 
@@ -106,7 +157,144 @@ func Update(ctx context.Context, job *library.Job) error {
 	return nil
 }
 
-func remotesToUpdate(repo borges.Repository, remote string) ([]*git.Remote, error) {
+// changedRemotes lists the references of every remote and returns the names
+// of the ones whose references don't match the stored ones. The endpoints of
+// the rest are added to the Unchanged endpoints of the Job. Remotes whose
+// references can't be listed are considered changed so the fetch reports the
+// error.
+func changedRemotes(
+	ctx context.Context,
+	logger log.Logger,
+	repo borges.Repository,
+	remotes []*git.Remote,
+	job *library.Job,
+) map[string]bool {
+	changed := make(map[string]bool, len(remotes))
+	for _, remote := range remotes {
+		name := remote.Config().Name
+		urls := remote.Config().URLs
+		if len(urls) == 0 {
+			changed[name] = true
+			continue
+		}
+
+		refs, err := listReferences(ctx, remote, urls[0], job.FetchAuth)
+		if err == nil {
+			var same bool
+			same, err = upToDate(repo.R(), remote.Config(), refs)
+			if err == nil && same {
+				job.Unchanged = append(job.Unchanged, urls[0])
+				continue
+			}
+		}
+
+		if err != nil {
+			logger.With(log.Fields{"remote": name, "error": err}).
+				Debugf("couldn't compare remote references")
+		}
+
+		changed[name] = true
+	}
+
+	return changed
+}
+
+// listReferences requests the references of the remote. The request can't be
+// canceled so it's abandoned once the context is done.
+func listReferences(
+	ctx context.Context,
+	remote *git.Remote,
+	endpoint string,
+	fetchAuth library.AuthFn,
+) ([]*plumbing.Reference, error) {
+	auth, err := fetchAuth(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		refs []*plumbing.Reference
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		refs, err := remote.List(&git.ListOptions{Auth: auth})
+		done <- result{refs: refs, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.refs, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// upToDate returns whether the stored references of the remote already point
+// to the same commits as the advertised ones, so fetching it wouldn't write
+// anything.
+func upToDate(
+	repo *git.Repository,
+	remote *config.RemoteConfig,
+	refs []*plumbing.Reference,
+) (bool, error) {
+	hashes := make(map[plumbing.ReferenceName]plumbing.Hash, len(refs))
+	for _, ref := range refs {
+		if ref.Type() == plumbing.HashReference {
+			hashes[ref.Name()] = ref.Hash()
+		}
+	}
+
+	for _, ref := range refs {
+		hash, ok := hashes[ref.Name()]
+		if ref.Type() == plumbing.SymbolicReference {
+			hash, ok = hashes[ref.Target()]
+		}
+
+		if !ok {
+			continue
+		}
+
+		for _, rs := range remote.Fetch {
+			if !rs.Match(ref.Name()) {
+				continue
+			}
+
+			stored, err := repo.Reference(rs.Dst(ref.Name()), true)
+			if err == plumbing.ErrReferenceNotFound {
+				return false, nil
+			}
+
+			if err != nil {
+				return false, err
+			}
+
+			if stored.Hash() != hash {
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
+
+func filterRemotes(remotes []*git.Remote, names map[string]bool) []*git.Remote {
+	var filtered []*git.Remote
+	for _, r := range remotes {
+		if names[r.Config().Name] {
+			filtered = append(filtered, r)
+		}
+	}
+
+	return filtered
+}
+
+func remotesToUpdate(
+	job *library.Job,
+	repo borges.Repository,
+	remote, endpoint string,
+) ([]*git.Remote, error) {
 	var (
 		remotes []*git.Remote
 		err     error
@@ -119,6 +307,12 @@ func remotesToUpdate(repo borges.Repository, remote string) ([]*git.Remote, erro
 		}
 	} else {
 		r, err := repo.R().Remote(remote)
+		if err == git.ErrRemoteNotFound {
+			// libraries written by older tools don't name the
+			// remotes after the repository.
+			r, err = remoteByEndpoint(job, repo.R(), endpoint)
+		}
+
 		if err != nil {
 			return nil, err
 		}
@@ -129,29 +323,93 @@ func remotesToUpdate(repo borges.Repository, remote string) ([]*git.Remote, erro
 	return remotes, nil
 }
 
+// remoteByEndpoint returns the remote of the repository whose URLs are stored
+// with the same ID as the endpoint in the naming of the job.
+func remoteByEndpoint(
+	job *library.Job,
+	repo *git.Repository,
+	endpoint string,
+) (*git.Remote, error) {
+	id, err := job.RepositoryID(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range remotes {
+		for _, url := range r.Config().URLs {
+			urlID, err := job.RepositoryID(url)
+			if err == nil && urlID == id {
+				return r, nil
+			}
+		}
+	}
+
+	return nil, git.ErrRemoteNotFound
+}
+
 func updateRepository(
 	ctx context.Context,
 	logger log.Logger,
 	repo borges.Repository,
 	remotes []*git.Remote,
-	authToken library.AuthTokenFn,
+	fetchAuth library.AuthFn,
+	pool *library.ObjectPool,
+	negotiation *library.Negotiation,
+	transfer *library.Transfer,
 ) error {
+	fetched := repo.R()
+	if pool != nil {
+		var err error
+		fetched, err = git.Open(pool.FetchStorer(fetched.Storer), nil)
+		if err != nil {
+			if err := repo.Close(); err != nil {
+				logger.Warningf("couldn't close repository")
+			}
+
+			return err
+		}
+	}
+
 	var alreadyUpdated int
 	start := time.Now()
 	for _, remote := range remotes {
 		opts := &git.FetchOptions{}
 		urls := remote.Config().URLs
 		if len(urls) > 0 {
-			token := authToken(urls[0])
-			if token != "" {
-				opts.Auth = &http.BasicAuth{
-					Username: "gitcollector",
-					Password: token,
+			auth, err := fetchAuth(ctx, urls[0])
+			if err != nil {
+				if err := repo.Close(); err != nil {
+					logger.Warningf("couldn't close repository")
 				}
+
+				return err
 			}
+
+			opts.Auth = auth
 		}
 
-		err := remote.FetchContext(ctx, opts)
+		if negotiation != nil && len(urls) > 0 {
+			err := negotiatedFetch(
+				ctx, fetched, remote, opts.Auth, negotiation, transfer,
+			)
+			if err != nil {
+				if err := repo.Close(); err != nil {
+					logger.Warningf("couldn't close repository")
+				}
+
+				return err
+			}
+		}
+
+		// the objects are fetched through a remote of its own, into the
+		// pool if the location is linked to one, counting the packfiles.
+		sto := transfer.Storer(fetched.Storer)
+		err := git.NewRemote(sto, remote.Config()).FetchContext(ctx, opts)
 		if err != nil && err != git.NoErrAlreadyUpToDate {
 			if err := repo.Close(); err != nil {
 				logger.Warningf("couldn't close repository")
@@ -175,6 +433,16 @@ func updateRepository(
 	elapsed := time.Since(start).String()
 	logger.With(log.Fields{"elapsed": elapsed}).Debugf("fetched")
 
+	if pool != nil {
+		if err := pool.Link(repo); err != nil {
+			if err := repo.Close(); err != nil {
+				logger.Warningf("couldn't close repository")
+			}
+
+			return err
+		}
+	}
+
 	start = time.Now()
 	if err := repo.Commit(); err != nil {
 		return err
@@ -11,6 +11,10 @@ import (
 	"github.com/src-d/go-borges/siva"
 	"gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
 	"gopkg.in/src-d/go-log.v1"
 
 	"github.com/stretchr/testify/require"
@@ -90,6 +94,69 @@ func TestUpdate(t *testing.T) {
 	req.True(size1 > size2)
 }
 
+func TestUpToDate(t *testing.T) {
+	var req = require.New(t)
+
+	repo, err := git.Init(memory.NewStorage(), nil)
+	req.NoError(err)
+
+	remote := &config.RemoteConfig{
+		Name: "github.com/foo/bar",
+		URLs: []string{"git://github.com/foo/bar.git"},
+		Fetch: []config.RefSpec{
+			"+HEAD:refs/remotes/github.com/foo/bar/HEAD",
+			"+refs/*:refs/remotes/github.com/foo/bar/*",
+		},
+	}
+
+	master := plumbing.NewHash("0000000000000000000000000000000000000001")
+	dev := plumbing.NewHash("0000000000000000000000000000000000000002")
+	for name, hash := range map[string]plumbing.Hash{
+		"refs/remotes/github.com/foo/bar/HEAD":             master,
+		"refs/remotes/github.com/foo/bar/heads/master":     master,
+		"refs/remotes/github.com/foo/bar/heads/dev":        dev,
+		"refs/remotes/github.com/other/bar/heads/master":   dev,
+		"refs/remotes/github.com/foo/bar/pull/1/head":      dev,
+		"refs/remotes/github.com/foo/bar/heads/deprecated": dev,
+	} {
+		ref := plumbing.NewHashReference(plumbing.ReferenceName(name), hash)
+		req.NoError(repo.Storer.SetReference(ref))
+	}
+
+	advertised := []*plumbing.Reference{
+		plumbing.NewSymbolicReference("HEAD", "refs/heads/master"),
+		plumbing.NewHashReference("refs/heads/master", master),
+		plumbing.NewHashReference("refs/heads/dev", dev),
+		plumbing.NewHashReference("refs/pull/1/head", dev),
+	}
+
+	same, err := upToDate(repo, remote, advertised)
+	req.NoError(err)
+	req.True(same)
+
+	// a moved branch
+	moved := append(advertised[:3:3],
+		plumbing.NewHashReference("refs/pull/1/head", master))
+	same, err = upToDate(repo, remote, moved)
+	req.NoError(err)
+	req.False(same)
+
+	// a new branch
+	added := append(advertised[:4:4],
+		plumbing.NewHashReference("refs/heads/feature", master))
+	same, err = upToDate(repo, remote, added)
+	req.NoError(err)
+	req.False(same)
+
+	// a moved HEAD
+	head := append([]*plumbing.Reference{
+		plumbing.NewSymbolicReference("HEAD", "refs/heads/dev"),
+	}, advertised[1:]...)
+	same, err = upToDate(repo, remote, head)
+	req.NoError(err)
+	req.False(same)
+}
+
 func setupLocation(
 	t *testing.T,
 	path string,
@@ -2,23 +2,63 @@ package gitcollector
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"gopkg.in/src-d/go-errors.v1"
 )
 
 type worker struct {
 	id      string
+	ctx     context.Context
 	jobs    chan Job
+	urgent  chan Job
 	cancel  chan bool
+	exited  chan struct{}
 	stopped bool
-	metrics MetricsCollector
+	metrics ResultMetricsCollector
+	errs    *runErrors
+	beat    *workerBeat
+	// policies are applied to the Jobs along with their own ones.
+	policies *Policies
+	// inflight tracks the Jobs being processed, they can outlive the
+	// worker when it's stopped immediately.
+	inflight  *sync.WaitGroup
+	abandoned *abandonedJobs
+	// paused holds the start of new Jobs while the pool is paused.
+	paused *pauseGate
+	// events receives the lifecycle of the Jobs, it can be nil.
+	events *JobEventBus
 }
 
-func newWorker(jobs chan Job, metrics MetricsCollector) *worker {
+func newWorker(
+	ctx context.Context,
+	jobs, urgent chan Job,
+	metrics MetricsCollector,
+	policies *Policies,
+	errs *runErrors,
+	beat *workerBeat,
+	inflight *sync.WaitGroup,
+	abandoned *abandonedJobs,
+	paused *pauseGate,
+	events *JobEventBus,
+) *worker {
 	return &worker{
+		id:      beat.hb.Worker,
+		ctx:     ctx,
 		jobs:    jobs,
+		urgent:  urgent,
 		cancel:  make(chan bool),
-		metrics: metrics,
+		exited:  make(chan struct{}),
+		metrics: AdaptMetricsCollector(metrics),
+		errs:    errs,
+		beat:    beat,
+
+		policies:  policies,
+		inflight:  inflight,
+		abandoned: abandoned,
+		paused:    paused,
+		events:    events,
 	}
 }
 
@@ -28,62 +68,167 @@ var (
 )
 
 func (w *worker) start() {
+	defer close(w.exited)
+
 	// It shouldn't be restarted after a call to stop.
 	if w.stopped {
 		return
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(w.ctx)
 	defer cancel()
 	for {
 		if err := w.consumeJob(ctx); err != nil {
-			if errJobsClosed.Is(err) || errWorkerStopped.Is(err) {
-				close(w.cancel)
-			}
-
 			return
 		}
 	}
 }
 
-func (w *worker) consumeJob(ctx context.Context) error {
-	select {
-	case <-w.cancel:
-		return errWorkerStopped.New()
-	case job, ok := <-w.jobs:
-		if !ok {
-			return errJobsClosed.New()
+// next returns the next Job to process, the urgent ones first.
+func (w *worker) next(ctx context.Context) (Job, error) {
+	for {
+		if w.jobs == nil && w.urgent == nil {
+			return nil, errJobsClosed.New()
+		}
+
+		select {
+		case <-w.cancel:
+			return nil, errWorkerStopped.New()
+		case <-ctx.Done():
+			return nil, errWorkerStopped.New()
+		default:
 		}
 
-		var done = make(chan struct{})
-		go func() {
-			defer close(done)
-			if err := job.Process(ctx); err != nil {
-				w.metrics.Fail(job)
-				return
+		select {
+		case <-w.cancel:
+			return nil, errWorkerStopped.New()
+		case <-ctx.Done():
+			return nil, errWorkerStopped.New()
+		case <-w.paused.wait():
+		}
+
+		select {
+		case job, ok := <-w.urgent:
+			if !ok {
+				w.urgent = nil
+				continue
 			}
 
-			w.metrics.Success(job)
-		}()
+			return job, nil
+		default:
+		}
 
 		select {
-		case now := <-w.cancel:
-			if !now {
-				<-done
+		case <-w.cancel:
+			return nil, errWorkerStopped.New()
+		case <-ctx.Done():
+			return nil, errWorkerStopped.New()
+		case job, ok := <-w.urgent:
+			if !ok {
+				w.urgent = nil
+				continue
+			}
+
+			return job, nil
+		case job, ok := <-w.jobs:
+			if !ok {
+				w.jobs = nil
+				continue
+			}
+
+			return job, nil
+		}
+	}
+}
+
+func (w *worker) consumeJob(ctx context.Context) error {
+	job, err := w.next(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the pool could be paused while the worker was waiting for the Job.
+	if !w.hold(ctx, job) {
+		return errWorkerStopped.New()
+	}
+
+	job, release := unwrapJob(job)
+	var done = make(chan struct{})
+	w.inflight.Add(1)
+	go func() {
+		defer w.inflight.Done()
+		defer close(done)
+		defer release()
+		start := time.Now()
+		w.beat.busy(job, start)
+		defer func() { w.beat.idle(time.Now()) }()
+		w.publish(&JobEvent{
+			Type: JobStarted, Job: job, Attempt: 1, Time: start,
+		})
+
+		attempts := 1
+		err := jobPolicies(job).Merge(w.policies).run(ctx, job.Process,
+			func(attempt int, err error, backoff time.Duration) {
+				attempts = attempt
+				w.publish(&JobEvent{
+					Type:    JobRetried,
+					Job:     job,
+					Attempt: attempt,
+					Err:     err,
+					Backoff: backoff,
+				})
+			},
+		)
+
+		event := JobSucceeded
+		if err != nil {
+			if ctx.Err() != nil {
+				w.abandoned.cancel(job)
 			}
 
-			return errWorkerStopped.New()
-		case <-done:
-			return nil
+			w.errs.job(err)
+			event = JobFailed
+		}
+
+		result := NewJobResult(job, err, time.Since(start))
+		w.metrics.Processed(job, result)
+		w.publish(&JobEvent{
+			Type: event, Job: job, Attempt: attempts, Result: result,
+		})
+	}()
+
+	select {
+	case now := <-w.cancel:
+		if !now {
+			<-done
 		}
+
+		return errWorkerStopped.New()
+	case <-ctx.Done():
+		// the job was canceled along with the worker.
+		<-done
+		return errWorkerStopped.New()
+	case <-done:
+		return nil
 	}
 }
 
+// publish sends the event to the JobEventBus until the pool is canceled, the
+// Jobs canceled with the worker are still reported.
+func (w *worker) publish(event *JobEvent) {
+	event.Worker = w.id
+	w.events.publish(w.ctx.Done(), event)
+}
+
 func (w *worker) stop(immediate bool) {
 	if w.stopped {
 		return
 	}
 
-	w.cancel <- immediate
+	select {
+	case w.cancel <- immediate:
+	case <-w.exited:
+	}
+
 	w.stopped = true
 }
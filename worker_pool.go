@@ -1,6 +1,7 @@
 package gitcollector
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -12,15 +13,55 @@ type WorkerPoolOpts struct {
 	WaitNewJobTimeout time.Duration
 	NotWaitNewJobs    bool
 	Metrics           MetricsCollector
+	// MaxErrors is the maximum number of job errors kept to be returned
+	// by WaitError, default to 100.
+	MaxErrors int
+	// OnShutdown are called in order once the pool is stopped before
+	// processing all its Jobs, by Stop, Close or the cancellation of the
+	// context given to RunContext, with the ShutdownReport of the
+	// abandoned Jobs.
+	OnShutdown []ShutdownFn
+	// OrderedWindow enables the ordered processing when it's greater than
+	// zero. The Jobs are dispatched to the workers strictly in the order
+	// the JobScheduleFn returns them, and a Job isn't dispatched until all
+	// the Jobs OrderedWindow positions before it have been processed.
+	OrderedWindow int
+	// Policies are applied to the processing of every Job, the ones set
+	// by the Job or its Provider take precedence.
+	Policies *Policies
+	// JobTimeout bounds the time every attempt of a Job can take, like a
+	// TimeoutPolicy in Policies, which takes precedence. 0 means
+	// unlimited.
+	JobTimeout time.Duration
+	// DelayResolution is the precision the DelayedJobs are released with
+	// once their time comes, never before it, default to a second.
+	DelayResolution time.Duration
+	// Events receives the JobEvents of the lifecycle of every Job if it's
+	// not nil. It isn't closed by the pool.
+	Events *JobEventBus
 }
 
+const maxRunErrors = 100
+
 // WorkerPool holds a pool of workers to process Jobs.
 type WorkerPool struct {
 	scheduler *jobScheduler
 	workers   []*worker
 	resize    chan struct{}
 	wg        sync.WaitGroup
+	ctx       context.Context
+	cancel    context.CancelFunc
+	errs      *runErrors
 	opts      *WorkerPoolOpts
+	beats     *heartbeats
+	nextID    int
+	running   bool
+	inflight  sync.WaitGroup
+	abandoned abandonedJobs
+	shutdown  sync.Once
+	reportMu  sync.Mutex
+	report    *ShutdownReport
+	paused    pauseGate
 }
 
 // NewWorkerPool builds a new WorkerPool.
@@ -34,19 +75,72 @@ func NewWorkerPool(
 		opts.Metrics = &hollowMetricsCollector{}
 	}
 
+	if opts.MaxErrors <= 0 {
+		opts.MaxErrors = maxRunErrors
+	}
+
+	if opts.JobTimeout > 0 {
+		opts.Policies = opts.Policies.Merge(&Policies{
+			Timeout: &TimeoutPolicy{Timeout: opts.JobTimeout},
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	return &WorkerPool{
 		scheduler: newJobScheduler(schedule, opts),
 		resize:    resize,
+		ctx:       ctx,
+		cancel:    cancel,
+		errs:      newRunErrors(opts.MaxErrors),
 		opts:      opts,
+		beats:     newHeartbeats(),
 	}
 }
 
 // Run notify workers to start.
 func (wp *WorkerPool) Run() {
+	wp.running = true
 	go wp.opts.Metrics.Start()
 	go wp.scheduler.Schedule()
 }
 
+// RunContext notify workers to start. Once the given context is done the
+// scheduling stops, the jobs being processed are canceled and the workers
+// finish, its error is reported by WaitError.
+func (wp *WorkerPool) RunContext(ctx context.Context) {
+	wp.Run()
+	go func() {
+		select {
+		case <-ctx.Done():
+			if wp.ctx.Err() != nil {
+				// the pool already finished
+				return
+			}
+
+			wp.errs.context(ctx.Err())
+			wp.scheduler.finish()
+			wp.cancel()
+		case <-wp.ctx.Done():
+		}
+	}()
+}
+
+// RunProvider starts the given provider in the background. Its failure, if
+// any, is reported by WaitError. Stopping the provider is up to the caller.
+func (wp *WorkerPool) RunProvider(p Provider) {
+	go func() {
+		if err := p.Start(); err != nil && !ErrProviderStopped.Is(err) {
+			wp.ProviderFailed(err)
+		}
+	}()
+}
+
+// ProviderFailed reports the failure of a provider run outside the pool to be
+// returned by WaitError.
+func (wp *WorkerPool) ProviderFailed(err error) {
+	wp.errs.provider(err)
+}
+
 // Size returns the current number of workers in the pool.
 func (wp *WorkerPool) Size() int {
 	<-wp.resize
@@ -55,6 +149,23 @@ func (wp *WorkerPool) Size() int {
 	return len(wp.workers)
 }
 
+// Queued returns the number of scheduled Jobs waiting for a worker.
+func (wp *WorkerPool) Queued() int {
+	return len(wp.scheduler.jobs) + len(wp.scheduler.urgent)
+}
+
+// Delayed returns the number of DelayedJobs held until their time comes.
+func (wp *WorkerPool) Delayed() int {
+	return wp.scheduler.delayed.len()
+}
+
+// Heartbeats returns the Heartbeat of every running worker. Unlike Size it
+// doesn't wait for an ongoing resize, so it can be used to detect stuck
+// workers.
+func (wp *WorkerPool) Heartbeats() []Heartbeat {
+	return wp.beats.list()
+}
+
 // SetWorkers set the number of Workers in the pool to n.
 func (wp *WorkerPool) SetWorkers(n int) {
 	<-wp.resize
@@ -77,9 +188,18 @@ func (wp *WorkerPool) SetWorkers(n int) {
 func (wp *WorkerPool) add(n int) {
 	wp.wg.Add(n)
 	for i := 0; i < n; i++ {
-		w := newWorker(wp.scheduler.jobs, wp.opts.Metrics)
+		wp.nextID++
+		beat := newWorkerBeat(wp.nextID, time.Now())
+		w := newWorker(
+			wp.ctx, wp.scheduler.jobs, wp.scheduler.urgent,
+			wp.opts.Metrics, wp.opts.Policies, wp.errs, beat,
+			&wp.inflight, &wp.abandoned, &wp.paused, wp.opts.Events,
+		)
+
+		wp.beats.add(beat)
 		go func() {
 			w.start()
+			wp.beats.remove(w.id)
 			wp.wg.Done()
 		}()
 
@@ -115,18 +235,37 @@ func (wp *WorkerPool) Wait() {
 
 	wp.wg.Wait()
 	wp.workers = nil
+	wp.cancel()
+	if wp.errs.canceled() {
+		wp.errs.shutdown(wp.shutdownReport(true))
+	}
+
 	wp.opts.Metrics.Stop(false)
 }
 
-// Close stops all the workers in the pool waiting for the jobs to finish.
+// WaitError waits for the workers to finish like Wait and returns a *RunError
+// aggregating the failures of the jobs and providers during the run, or nil if
+// there weren't any. The ShutdownReport of the run is set in the RunError if
+// the context given to RunContext was canceled.
+func (wp *WorkerPool) WaitError() error {
+	wp.Wait()
+	return wp.errs.err()
+}
+
+// Close stops all the workers in the pool waiting for the jobs to finish. The
+// report of the scheduled Jobs left unprocessed is kept in ShutdownReport.
 func (wp *WorkerPool) Close() {
 	wp.SetWorkers(0)
 	wp.wg.Wait()
 	wp.scheduler.finish()
+	wp.cancel()
+	wp.shutdownReport(false)
 	wp.opts.Metrics.Stop(false)
 }
 
-// Stop stops all the workers in the pool immediately.
+// Stop stops all the workers in the pool immediately, canceling the jobs being
+// processed. It returns once all of them returned, with the report of the
+// abandoned Jobs kept in ShutdownReport.
 func (wp *WorkerPool) Stop() {
 	<-wp.resize
 	defer func() { wp.resize <- struct{}{} }()
@@ -138,9 +277,86 @@ func (wp *WorkerPool) Stop() {
 	wp.wg.Wait()
 	wp.workers = nil
 	wp.scheduler.finish()
+	wp.cancel()
+	wp.shutdownReport(true)
 	wp.opts.Metrics.Stop(true)
 }
 
+// ShutdownReport returns the report of the Jobs left unprocessed stopping the
+// WorkerPool, nil until it's stopped by Close, Stop, Drain or the cancellation
+// of the context given to RunContext.
+func (wp *WorkerPool) ShutdownReport() *ShutdownReport {
+	wp.reportMu.Lock()
+	defer wp.reportMu.Unlock()
+	return wp.report
+}
+
+// Drain stops the WorkerPool gracefully, like before a rolling deployment: no
+// more Jobs are scheduled nor started, and the ones being processed are waited
+// for until the context is done, canceling them then. It returns the report of
+// the Jobs left unprocessed, the scheduled ones are reported as discarded so
+// the OnShutdown functions, like the one of NewQueueShutdownFn, can keep them
+// for the next start.
+func (wp *WorkerPool) Drain(ctx context.Context) *ShutdownReport {
+	<-wp.resize
+	defer func() { wp.resize <- struct{}{} }()
+
+	wp.scheduler.finish()
+	for _, w := range wp.workers {
+		w.stop(false)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wp.wg.Wait()
+		close(done)
+	}()
+
+	var immediate bool
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// the jobs still running are canceled along with the workers.
+		immediate = true
+		wp.cancel()
+		<-done
+	}
+
+	wp.workers = nil
+	wp.cancel()
+	report := wp.shutdownReport(immediate)
+	wp.opts.Metrics.Stop(immediate)
+	return report
+}
+
+// shutdownReport builds the ShutdownReport and runs the OnShutdown functions
+// the first time it's called, once the workers are stopped and the context of
+// the jobs canceled.
+func (wp *WorkerPool) shutdownReport(immediate bool) *ShutdownReport {
+	wp.shutdown.Do(func() {
+		wp.inflight.Wait()
+		if wp.running {
+			<-wp.scheduler.exited
+		}
+
+		report := &ShutdownReport{
+			Immediate: immediate,
+			Discarded: wp.scheduler.pending(),
+			Canceled:  wp.abandoned.list(),
+		}
+
+		for _, fn := range wp.opts.OnShutdown {
+			report.Cleanups = append(report.Cleanups, fn(report))
+		}
+
+		wp.reportMu.Lock()
+		wp.report = report
+		wp.reportMu.Unlock()
+	})
+
+	return wp.ShutdownReport()
+}
+
 type hollowMetricsCollector struct{}
 
 var _ MetricsCollector = (*hollowMetricsCollector)(nil)
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-errors.v1"
 )
 
 func TestWorkerPool(t *testing.T) {
@@ -95,3 +96,193 @@ func testScheduleFn(queue chan Job) JobScheduleFn {
 		}
 	}
 }
+
+func TestWorkerPoolPriority(t *testing.T) {
+	var require = require.New(t)
+
+	var (
+		mu      sync.Mutex
+		got     []string
+		started = make(chan struct{})
+		release = make(chan struct{})
+		process = func(id string) error {
+			if id == "first" {
+				close(started)
+				<-release
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, id)
+			return nil
+		}
+	)
+
+	queue := make(chan Job, 20)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{})
+	wp.SetWorkers(1)
+	wp.Run()
+
+	// the worker is busy while the rest are scheduled
+	queue <- &testJob{id: "first", process: process}
+	<-started
+	for _, id := range []string{"a", "b"} {
+		queue <- &testJob{id: id, process: process}
+	}
+
+	queue <- &testPriorityJob{
+		testJob:  testJob{id: "urgent", process: process},
+		priority: PriorityHigh,
+	}
+	queue <- &testJob{id: "c", process: process}
+	close(queue)
+
+	deadline := time.Now().Add(time.Second)
+	for len(wp.scheduler.urgent) != 1 || len(wp.scheduler.jobs) != 3 {
+		require.True(time.Now().Before(deadline), "jobs not scheduled")
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+
+	wp.Wait()
+	require.Equal([]string{"first", "urgent", "a", "b", "c"}, got)
+}
+
+type testPriorityJob struct {
+	testJob
+	priority Priority
+}
+
+var _ PriorityJob = (*testPriorityJob)(nil)
+
+func (j *testPriorityJob) JobPriority() Priority {
+	return j.priority
+}
+
+func TestWorkerPoolErrorMetrics(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 5)
+	mc := &testErrorMetrics{}
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{
+		Metrics: mc,
+	})
+
+	wp.SetWorkers(2)
+	wp.Run()
+
+	queue <- &testJob{process: func(string) error {
+		return context.DeadlineExceeded
+	}}
+	queue <- &testJob{}
+	close(queue)
+
+	wp.Wait()
+
+	mc.Lock()
+	defer mc.Unlock()
+	require.Equal(1, mc.success)
+	require.Len(mc.failures, 1)
+	require.Equal(ErrorClassTimeout, mc.failures[0].Class)
+}
+
+type testErrorMetrics struct {
+	hollowMetricsCollector
+	sync.Mutex
+	success  int
+	failures []*JobFailure
+}
+
+var _ ErrorMetricsCollector = (*testErrorMetrics)(nil)
+
+func (mc *testErrorMetrics) Success(Job) {
+	mc.Lock()
+	defer mc.Unlock()
+	mc.success++
+}
+
+func (mc *testErrorMetrics) FailWithError(_ Job, f *JobFailure) {
+	mc.Lock()
+	defer mc.Unlock()
+	mc.failures = append(mc.failures, f)
+}
+
+func TestWorkerPoolWaitError(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 5)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{
+		MaxErrors: 1,
+	})
+
+	wp.SetWorkers(2)
+	wp.Run()
+
+	errFoo := errors.NewKind("foo")
+	for i := 0; i < 3; i++ {
+		queue <- &testJob{process: func(string) error {
+			return errFoo.New()
+		}}
+	}
+
+	queue <- &testJob{}
+	close(queue)
+
+	wp.ProviderFailed(errFoo.New())
+
+	err := wp.WaitError()
+	require.Error(err)
+
+	runErr, ok := err.(*RunError)
+	require.True(ok)
+	require.Equal(3, runErr.Failed)
+	require.Len(runErr.Jobs, 1)
+	require.True(errFoo.Is(runErr.Jobs[0]))
+	require.Len(runErr.Providers, 1)
+	require.NoError(runErr.Context)
+
+	queue = make(chan Job, 5)
+	wp = NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{})
+	wp.SetWorkers(2)
+	wp.Run()
+	queue <- &testJob{}
+	close(queue)
+	require.NoError(wp.WaitError())
+}
+
+func TestWorkerPoolRunContext(t *testing.T) {
+	var require = require.New(t)
+
+	queue := make(chan Job, 5)
+	wp := NewWorkerPool(testScheduleFn(queue), &WorkerPoolOpts{})
+	wp.SetWorkers(2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wp.RunContext(ctx)
+
+	started := make(chan struct{})
+	queue <- &testBlockingJob{started: started}
+	<-started
+	cancel()
+
+	err := wp.WaitError()
+	require.Error(err)
+
+	runErr, ok := err.(*RunError)
+	require.True(ok)
+	require.Equal(context.Canceled, runErr.Context)
+	require.Equal(1, runErr.Failed)
+}
+
+type testBlockingJob struct {
+	started chan struct{}
+}
+
+var _ Job = (*testBlockingJob)(nil)
+
+func (j *testBlockingJob) Process(ctx context.Context) error {
+	close(j.started)
+	<-ctx.Done()
+	return ctx.Err()
+}